@@ -15,6 +15,7 @@ import (
 	"github.com/user/llm-proxy-go/internal/api/middleware"
 	"github.com/user/llm-proxy-go/internal/config"
 	"github.com/user/llm-proxy-go/internal/database"
+	"github.com/user/llm-proxy-go/internal/models"
 	"github.com/user/llm-proxy-go/internal/repository"
 	"github.com/user/llm-proxy-go/internal/service"
 	"github.com/user/llm-proxy-go/internal/version"
@@ -107,9 +108,17 @@ func run() error {
 	keyRepo := repository.NewAPIKeyRepository(db)
 	userRepo := repository.NewUserRepository(db)
 	logRepo := repository.NewRequestLogRepositoryImpl(db, logger, readDB)
+	logFeed := repository.NewRequestLogFeed()
+	logRepo.SetFeed(logFeed)
+	logRepo.SetCostDisplay(repository.CostDisplay{
+		Precision: cfg.CostDisplay.Precision,
+		Currency:  cfg.CostDisplay.Currency,
+		USDRate:   cfg.CostDisplay.USDRate,
+	})
 	embeddingRepo := repository.NewEmbeddingModelRepository(db, logger)
 	routingModelRepo := repository.NewRoutingModelRepository(db, logger)
 	routingConfigRepo := repository.NewRoutingConfigRepository(db, logger)
+	routingConfigRepo.SetCacheTTL(time.Duration(cfg.Database.HotCacheTTL) * time.Second)
 	embeddingCacheRepo := repository.NewEmbeddingCacheRepository(db, logger)
 	routingRuleRepo := repository.NewRoutingRuleRepository(db, logger)
 	systemConfigRepo := repository.NewSystemConfigRepository(db)
@@ -139,9 +148,42 @@ func run() error {
 	// Initialize services.
 	sessionRepo := repository.NewSessionRepository(db, logger)
 	healthChecker := service.NewHealthChecker(cfg.HealthCheck, logger)
+	healthChecker.SetWebhook(service.NewHealthWebhook(systemConfigRepo, workerCoordinator.IsPrimary, logger))
+	healthChecker.SetProbeBudget(service.NewProbeBudget(cfg.HealthCheck.ProbeDailyBudgetUSD,
+		repository.NewSharedStateRepository(db, logger), workerCoordinator.IsPrimary, logger))
 	loadBalancer := service.NewLoadBalancer(systemConfigRepo)
 	authService := service.NewAuthService(keyRepo, userRepo, sessionRepo, logger)
+	authService.SetAPIKeyCacheTTL(time.Duration(cfg.Database.HotCacheTTL) * time.Second)
+	authService.SetBcryptCost(cfg.Security.BcryptCost)
 	proxyService := service.NewProxyService(healthChecker, loadBalancer, logRepo, logger)
+	proxyService.SetCoalescing(cfg.Coalescing.Enabled)
+	proxyService.SetBufferedStreamMaxTokens(cfg.Proxy.BufferedStreamMaxTokens)
+	proxyService.SetStreamIdleTimeout(time.Duration(cfg.Proxy.StreamIdleTimeout) * time.Second)
+	proxyService.SetForwardEndUserID(cfg.Proxy.ForwardEndUserID)
+	proxyService.SetDefaultMaxTokens(cfg.Proxy.DefaultMaxTokens, map[models.ModelRole]int{
+		models.ModelRoleSimple:  cfg.Proxy.DefaultMaxTokensSimple,
+		models.ModelRoleComplex: cfg.Proxy.DefaultMaxTokensComplex,
+	})
+	conversationAffinity := service.NewConversationAffinity(cfg.LoadBalance)
+	proxyService.SetConversationAffinity(conversationAffinity)
+	proxyService.SetRetryBackoff(cfg.RetryBackoff)
+	retryBudget := service.NewRetryBudget(cfg.RetryBudget)
+	proxyService.SetRetryBudget(retryBudget)
+	proxyService.SetAnthropicVersionPolicy(service.NewAnthropicVersionPolicy(systemConfigRepo, logger))
+	shadowLogRepo := repository.NewShadowLogRepository(db)
+	proxyService.SetShadowMirror(service.NewShadowMirror(endpointStore.GetShadowEndpoints, shadowLogRepo, logger))
+	providerLimiter := service.NewProviderLimiter()
+	endpointStore.SetProviderLimiter(providerLimiter)
+	proxyService.SetProviderLimiter(providerLimiter)
+	contentPolicy, err := service.NewContentPolicy(cfg.ContentPolicy)
+	if err != nil {
+		return fmt.Errorf("init content policy: %w", err)
+	}
+	redactor, err := service.NewContentRedactor(cfg.Redaction)
+	if err != nil {
+		return fmt.Errorf("init content redaction: %w", err)
+	}
+	proxyService.SetContentRedactor(redactor)
 
 	// Create default admin user if not exists.
 	if err := authService.CreateDefaultAdmin(
@@ -155,13 +197,84 @@ func run() error {
 	// Start health checker with current endpoints.
 	healthChecker.Start(endpointStore.GetEndpoints())
 	endpointStore.SetHealthChecker(healthChecker)
+	loadBalancer.SetHealthChecker(healthChecker)
 	defer healthChecker.Stop()
 
-	// Initialize routing cache.
-	routingCache := service.NewRoutingCache(10000, logger)
+	// Bias weighted load balancing by endpoint success rate (nil when disabled).
+	successRates := service.NewSuccessRateTracker(logRepo, healthChecker, cfg.LoadBalance, logger)
+	loadBalancer.SetSuccessRates(successRates)
+	successRates.Start()
+	defer successRates.Stop()
+
+	// Start the routing rule janitor (nil when disabled).
+	ruleJanitor := service.NewRuleJanitor(routingRuleRepo, cfg.RuleJanitor, logger)
+	ruleJanitor.Start()
+	defer ruleJanitor.Stop()
+
+	// Prune request logs past the retention window set in system config.
+	logRetention := service.NewLogRetention(logRepo, systemConfigRepo, cfg.LogRetention, workerCoordinator.IsPrimary, logger)
+	logRetention.Start()
+	defer logRetention.Stop()
+
+	// Deactivate API keys past their expiry.
+	apiKeyExpiry := service.NewAPIKeyExpiry(keyRepo, workerCoordinator.IsPrimary, logger)
+	apiKeyExpiry.Start()
+	defer apiKeyExpiry.Stop()
+
+	// Initialize routing cache, shared by the LLM router and the cache API.
+	// A zero size falls back to the cache's built-in default.
+	routingCacheSize := 0
+	routingCacheTTL := 0
+	if routingCfg, err := routingConfigRepo.GetConfig(context.Background()); err != nil {
+		logger.Warn("failed to load routing config, using default cache size", zap.Error(err))
+	} else {
+		routingCacheSize = routingCfg.CacheMaxSize
+		routingCacheTTL = routingCfg.CacheTTLSeconds
+	}
+	routingCache := service.NewRoutingCache(routingCacheSize, logger)
+
+	// Warm the routing cache from the snapshot saved at the last shutdown.
+	routingCachePath := filepath.Join(filepath.Dir(cfg.Database.Path), "routing_cache.json")
+	if n, err := routingCache.LoadSnapshot(routingCachePath, routingCacheTTL); err != nil {
+		logger.Warn("routing cache snapshot not loaded, starting empty",
+			zap.String("path", routingCachePath), zap.Error(err))
+	} else {
+		logger.Info("routing cache snapshot loaded", zap.Int("entries", n))
+	}
 
-	// Initialize LLM router for intelligent routing.
-	llmRouter := service.NewLLMRouter(db, nil, logger)
+	// Initialize LLM router for intelligent routing. The embedding service
+	// backs the semantic L2 cache lookup.
+	embeddingService := service.NewEmbeddingService(routingConfigRepo, embeddingRepo, logger)
+	llmRouter := service.NewLLMRouter(db, embeddingService, routingCache, logger)
+
+	// Task-type roles known to routing and endpoint selection; admins can
+	// add roles beyond the builtin simple/default/complex.
+	modelRoleRepo := repository.NewModelRoleRepository(db)
+	roleSet := service.NewRoleSet(modelRoleRepo, logger)
+	if err := roleSet.Reload(context.Background()); err != nil {
+		logger.Warn("failed to load model roles, using builtin roles", zap.Error(err))
+	}
+	llmRouter.SetRoleSet(roleSet)
+
+	// Prometheus metrics, served on the proxy port unless given their own.
+	var metrics *service.Metrics
+	var metricsHandler http.Handler
+	if cfg.Metrics.Enabled {
+		metrics = service.NewMetrics(healthChecker)
+		proxyService.SetMetrics(metrics)
+		llmRouter.SetMetrics(metrics)
+		if cfg.Metrics.ListenAddr == "" {
+			metricsHandler = metrics.Handler()
+		}
+	}
+
+	// Initialize the L2 cache embedding rebuilder (runs on the primary worker only).
+	embeddingRebuilder := service.NewEmbeddingRebuilder(embeddingCacheRepo, embeddingService, workerCoordinator.IsPrimary, logger)
+
+	// Initialize the routing cache warmer, which replays recent request logs
+	// into the L1 and L2 caches on demand.
+	cacheWarmer := service.NewCacheWarmer(logRepo, routingRuleRepo, routingConfigRepo, embeddingCacheRepo, routingCache, embeddingService, logger)
+	cacheWarmer.SetRoleSet(roleSet)
 
 	// Initialize routing analyzer for rule optimization.
 	analysisReportRepo := repository.NewAnalysisReportRepository(db, logger, readDB)
@@ -172,22 +285,47 @@ func run() error {
 		ProxyService:       proxyService,
 		AuthService:        authService,
 		HealthChecker:      healthChecker,
+		LoadBalancer:       loadBalancer,
+		Affinity:           conversationAffinity,
 		RoutingCache:       routingCache,
 		LLMRouter:          llmRouter,
 		RoutingAnalyzer:    routingAnalyzer,
 		UserRepo:           userRepo,
 		KeyRepo:            keyRepo,
 		LogRepo:            logRepo,
+		LogFeed:            logFeed,
 		EmbeddingRepo:      embeddingRepo,
 		ModelRepo:          modelRepo,
 		ProviderRepo:       providerRepo,
 		RoutingModelRepo:   routingModelRepo,
 		RoutingConfigRepo:  routingConfigRepo,
 		RoutingRuleRepo:    routingRuleRepo,
+		ModelRoleRepo:      modelRoleRepo,
+		RoleSet:            roleSet,
 		EmbeddingCacheRepo: embeddingCacheRepo,
+		EmbeddingRebuilder: embeddingRebuilder,
+		CacheWarmer:        cacheWarmer,
 		SystemConfigRepo:   systemConfigRepo,
 		AnalysisReportRepo: analysisReportRepo,
+		ShadowLogRepo:      shadowLogRepo,
 		EndpointStore:      endpointStore,
+		ContentPolicy:      contentPolicy,
+		Redactor:           redactor,
+		RetryBudget:        retryBudget,
+		Concurrency:        service.NewConcurrencyLimiter(cfg.Proxy.MaxConcurrentRequests, cfg.Proxy.MaxConcurrentStreams),
+		Maintenance:        service.NewMaintenanceMode(systemConfigRepo, logger),
+		RuleJanitor:        ruleJanitor,
+		StreamResume:       service.NewStreamResumeStore(cfg.StreamResume),
+		Idempotency:        service.NewIdempotencyStore(cfg.Idempotency),
+		Budget:             service.NewBudgetService(logRepo, cfg.Budget),
+		StatsCache:         service.NewStatsCache(logRepo, cfg.StatsCache, logger),
+		MaxRequestBytes:    int64(cfg.Proxy.MaxRequestBytes),
+		CompressMinBytes:   cfg.Proxy.CompressMinBytes,
+		StreamHeartbeat:    time.Duration(cfg.Proxy.StreamHeartbeat) * time.Second,
+		DefaultFallback:    cfg.Proxy.AutoDefaultFallback,
+		StripThinking:      cfg.Proxy.LogStripThinking,
+		ValidateTools:      cfg.Proxy.ValidateTools,
+		Metrics:            metricsHandler,
 		RateLimit: &middleware.RateLimitConfig{
 			Enabled:       cfg.RateLimit.Enabled,
 			MaxRequests:   cfg.RateLimit.MaxRequests,
@@ -216,6 +354,23 @@ func run() error {
 
 	logger.Info("server started", zap.String("addr", addr))
 
+	if metrics != nil && cfg.Metrics.ListenAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer := &http.Server{
+			Addr:              cfg.Metrics.ListenAddr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("metrics server error", zap.Error(err))
+			}
+		}()
+		defer metricsServer.Close()
+		logger.Info("metrics server started", zap.String("addr", cfg.Metrics.ListenAddr))
+	}
+
 	// Wait for shutdown signal.
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -230,6 +385,10 @@ func run() error {
 		return fmt.Errorf("server shutdown: %w", err)
 	}
 
+	if err := routingCache.SaveSnapshot(routingCachePath); err != nil {
+		logger.Warn("failed to save routing cache snapshot", zap.Error(err))
+	}
+
 	logger.Info("server stopped")
 	return nil
 }
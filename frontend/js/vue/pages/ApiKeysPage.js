@@ -337,7 +337,7 @@ window.VuePages = window.VuePages || {};
                     </td>\
                     <td>{{ formatDateTime(key.created_at) }}</td>\
                     <td>{{ formatDateTime(key.last_used_at) }}</td>\
-                    <td>{{ key.expires_at ? formatDateTime(key.expires_at) : "永不过期" }}</td>\
+                    <td>{{ key.expires_at ? formatDateTime(key.expires_at) : "永不过期" }} <span v-show="key.expired" class="badge badge-warning">已过期</span></td>\
                     <td>\
                         <div class="dropdown">\
                             <button class="dropdown-trigger" @click.stop="toggleDropdown(key.id)">\
@@ -388,7 +388,7 @@ window.VuePages = window.VuePages || {};
                 </div>\
                 <div class="key-stat full-width">\
                     <span class="key-stat-label">过期时间</span>\
-                    <span class="key-stat-value">{{ key.expires_at ? formatDateTime(key.expires_at) : "永不过期" }}</span>\
+                    <span class="key-stat-value">{{ key.expires_at ? formatDateTime(key.expires_at) : "永不过期" }} <span v-show="key.expired" class="badge badge-warning">已过期</span></span>\
                 </div>\
             </div>\
             <div class="key-card-actions">\
@@ -74,7 +74,7 @@ window.VuePages = window.VuePages || {};
 
       // 清除缓存模态框
       var showClearModal = ref(false);
-      var clearLayer = ref("memory");
+      var clearLayer = ref("l1");
       var clearStatsOption = ref(false);
 
       // 自动刷新
@@ -313,7 +313,7 @@ window.VuePages = window.VuePages || {};
       async function clearCache() {
         try {
           var response = await VueApi.post(
-            "/api/cache/clear?layer=" +
+            "/api/cache/clear?level=" +
               clearLayer.value +
               "&clear_stats=" +
               clearStatsOption.value,
@@ -603,8 +603,9 @@ window.VuePages = window.VuePages || {};
             <div class="modal-body">\
                 <p class="mb-4">选择要清除的缓存层级：</p>\
                 <div class="radio-group">\
-                    <label class="radio-label"><input type="radio" v-model="clearLayer" value="memory"> 仅内存缓存 (L1)</label>\
-                    <label class="radio-label"><input type="radio" v-model="clearLayer" value="persistent"> 仅持久化缓存 (L2/L3)</label>\
+                    <label class="radio-label"><input type="radio" v-model="clearLayer" value="l1"> 仅内存缓存 (L1)</label>\
+                    <label class="radio-label"><input type="radio" v-model="clearLayer" value="l2"> 仅持久化缓存 (L2/L3)</label>\
+                    <label class="radio-label"><input type="radio" v-model="clearLayer" value="l3"> 仅语义向量 (L3，保留精确匹配)</label>\
                     <label class="radio-label"><input type="radio" v-model="clearLayer" value="all"> 所有缓存</label>\
                 </div>\
                 <div class="checkbox-section">\
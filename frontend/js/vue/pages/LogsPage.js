@@ -21,8 +21,10 @@ window.VuePages = window.VuePages || {};
     rule: "规则",
     cache_l1: "L1缓存",
     cache_l2: "L2缓存",
+    cache_l2_semantic: "L2语义缓存",
     cache_l3: "L3缓存",
     llm: "LLM路由",
+    forced: "强制角色",
     fallback: "回退",
     fallback_same_role: "同角色回退",
     unknown: "未知",
@@ -95,6 +97,7 @@ window.VuePages = window.VuePages || {};
       var endpointOpen = ref(false);
       var statusOpen = ref(false);
       var deleteOpen = ref(false);
+      var exportOpen = ref(false);
       var refreshOpen = ref(false);
       var popoverOpen = ref(false);
 
@@ -102,6 +105,7 @@ window.VuePages = window.VuePages || {};
       var stats = reactive({
         totalRequests: 0,
         totalCost: 0,
+        currency: "USD",
         avgLatency: 0,
         successRate: 0,
       });
@@ -189,6 +193,9 @@ window.VuePages = window.VuePages || {};
         if (method === "llm") {
           return "调用 LLM 分析请求内容后决定使用的模型";
         }
+        if (method === "forced") {
+          return "请求头 X-Proxy-Force-Role 指定了模型角色，跳过智能路由";
+        }
         if (method && method.startsWith("cache_")) {
           return "从缓存中命中了之前的路由决策";
         }
@@ -237,6 +244,7 @@ window.VuePages = window.VuePages || {};
           var data = await response.json();
           stats.totalRequests = data.total_requests || 0;
           stats.totalCost = data.total_cost || 0;
+          stats.currency = data.currency || "USD";
           stats.avgLatency = data.avg_latency || 0;
           stats.successRate = data.success_rate || 0;
           // Extract filter options from the same response
@@ -554,9 +562,17 @@ window.VuePages = window.VuePages || {};
         endpointOpen.value = false;
         statusOpen.value = false;
         deleteOpen.value = false;
+        exportOpen.value = false;
         refreshOpen.value = false;
       }
 
+      // 按当前筛选条件导出日志（csv 或 jsonl）
+      function exportLogs(format) {
+        var params = buildFilterParams();
+        params.set("format", format);
+        window.open("/api/logs/export?" + params, "_blank");
+      }
+
       // header 操作按钮组件
       var LogsHeaderActions = {
         name: "LogsHeaderActions",
@@ -624,6 +640,7 @@ window.VuePages = window.VuePages || {};
         endpointOpen: endpointOpen,
         statusOpen: statusOpen,
         deleteOpen: deleteOpen,
+        exportOpen: exportOpen,
         refreshOpen: refreshOpen,
         popoverOpen: popoverOpen,
         // 数据
@@ -652,6 +669,7 @@ window.VuePages = window.VuePages || {};
         setTimeRange: setTimeRange,
         applyCustomTime: applyCustomTime,
         resetFilters: resetFilters,
+        exportLogs: exportLogs,
         goToPage: goToPage,
         showLogDetail: showLogDetailFn,
         toggleInaccurate: toggleInaccurate,
@@ -679,7 +697,7 @@ window.VuePages = window.VuePages || {};
                 <svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><line x1="12" y1="1" x2="12" y2="23"/><path d="M17 5H9.5a3.5 3.5 0 0 0 0 7h5a3.5 3.5 0 0 1 0 7H6"/></svg>\
             </div>\
             <div class="stat-info">\
-                <span class="stat-value">${{ (stats.totalCost || 0).toFixed(6) }}</span>\
+                <span class="stat-value">{{ stats.currency === "USD" ? "$" : stats.currency + " " }}{{ stats.totalCost || 0 }}</span>\
                 <span class="stat-label">总成本</span>\
             </div>\
         </div>\
@@ -778,6 +796,15 @@ window.VuePages = window.VuePages || {};
                 <button class="icon-btn" @click="resetFilters()" title="重置筛选">\
                     <svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><polyline points="23 4 23 10 17 10"/><polyline points="1 20 1 14 7 14"/><path d="M3.51 9a9 9 0 0 1 14.85-3.36L23 10M1 14l4.64 4.36A9 9 0 0 0 20.49 15"/></svg>\
                 </button>\
+                <div class="dropdown">\
+                    <button class="icon-btn" @click.stop="exportOpen = !exportOpen" title="导出日志">\
+                        <svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><path d="M21 15v4a2 2 0 0 1-2 2H5a2 2 0 0 1-2-2v-4"/><polyline points="7 10 12 15 17 10"/><line x1="12" y1="15" x2="12" y2="3"/></svg>\
+                    </button>\
+                    <div class="dropdown-menu" v-show="exportOpen" v-cloak>\
+                        <button class="dropdown-item" @click="exportOpen = false; exportLogs(\'csv\')">导出筛选结果 (CSV)</button>\
+                        <button class="dropdown-item" @click="exportOpen = false; exportLogs(\'jsonl\')">导出筛选结果 (JSONL)</button>\
+                    </div>\
+                </div>\
                 <div class="dropdown">\
                     <button class="icon-btn icon-btn-danger" @click.stop="deleteOpen = !deleteOpen" title="清除日志">\
                         <svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><polyline points="3 6 5 6 21 6"/><path d="M19 6v14a2 2 0 0 1-2 2H7a2 2 0 0 1-2-2V6m3 0V4a2 2 0 0 1 2-2h4a2 2 0 0 1 2 2v2"/></svg>\
@@ -951,6 +978,24 @@ window.VuePages = window.VuePages || {};
                                 </div>\
                             </div>\
                         </div>\
+                        <div class="detail-item" v-show="logDetail.end_user_id">\
+                            <span class="detail-label">终端用户</span>\
+                            <span class="detail-value">{{ logDetail.end_user_id }}</span>\
+                        </div>\
+                        <div class="detail-item detail-item-full" v-show="logDetail.fallback_chain && logDetail.fallback_chain.length > 0">\
+                            <span class="detail-label">角色降级链</span>\
+                            <span class="detail-value">{{ (logDetail.fallback_chain || []).join(" → ") }}</span>\
+                        </div>\
+                        <div class="detail-item detail-item-full" v-show="logDetail.retry_chain && logDetail.retry_chain.length > 1">\
+                            <span class="detail-label">端点重试链</span>\
+                            <div class="all-matches-list">\
+                                <div class="match-item" v-for="(attempt, idx) in (logDetail.retry_chain || [])" :key="idx">\
+                                    <span class="match-name">{{ attempt.endpoint }}</span>\
+                                    <span class="match-priority">{{ attempt.status_code || "无响应" }}</span>\
+                                    <span class="match-priority" v-if="attempt.error">{{ attempt.error }}</span>\
+                                </div>\
+                            </div>\
+                        </div>\
                     </div>\
                     <!-- Token 和成本 -->\
                     <div class="detail-section">\
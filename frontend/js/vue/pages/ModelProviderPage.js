@@ -54,6 +54,11 @@ window.VuePages = window.VuePages || {};
         billing_multiplier: 1.0,
         weight: 100,
         supports_thinking: false,
+        max_thinking_tokens: 0,
+        default_thinking_tokens: 0,
+        cache_write_multiplier: 1.25,
+        cache_read_multiplier: 0.1,
+        timeout_seconds: 0,
         enabled: true,
       });
       var providerForm = reactive({
@@ -61,19 +66,29 @@ window.VuePages = window.VuePages || {};
         base_url: "",
         api_key: "",
         weight: 1,
-        max_concurrent: 10,
+        max_concurrent: 0,
+        timeout_seconds: 0,
+        stream_only: false,
+        anthropic_version: "",
+        api_path_prefix: "",
+        cost_multiplier: 1,
+        shadow: false,
+        shadow_sample_rate: 0,
         enabled: true,
         description: "",
         model_ids: [],
         custom_headers: "",
+        auth_scheme: "anthropic",
+        auth_header: "",
       });
 
-      // 角色选项
-      var roleOptions = [
+      // 角色选项（内置角色 + 管理员自定义角色）
+      var builtinRoleOptions = [
         { value: "simple", label: "simple - 简单任务" },
         { value: "default", label: "default - 默认任务" },
         { value: "complex", label: "complex - 复杂任务" },
       ];
+      var roleOptions = ref(builtinRoleOptions.slice());
 
       // tier 轮换
       var tierCycle = ["default", "complex", "simple"];
@@ -166,7 +181,7 @@ window.VuePages = window.VuePages || {};
       });
 
       var roleLabel = computed(function () {
-        var found = roleOptions.find(function (o) {
+        var found = roleOptions.value.find(function (o) {
           return o.value === modelForm.role;
         });
         return found ? found.label : "请选择";
@@ -195,11 +210,20 @@ window.VuePages = window.VuePages || {};
           var results = await Promise.all([
             VueApi.get("/api/config/providers"),
             VueApi.get("/api/config/models"),
+            VueApi.get("/api/config/roles"),
           ]);
           var providersData = await results[0].json();
           var modelsData = await results[1].json();
+          var rolesData = await results[2].json();
           providers.value = providersData.providers || [];
           models.value = modelsData.models || [];
+          roleOptions.value = builtinRoleOptions.concat(
+            (rolesData.roles || [])
+              .filter(function (r) { return !r.builtin; })
+              .map(function (r) {
+                return { value: r.name, label: r.name + (r.description ? " - " + r.description : " - 自定义") };
+              })
+          );
         } catch (error) {
           toastStore.error("加载失败: " + error.message);
         } finally {
@@ -218,6 +242,11 @@ window.VuePages = window.VuePages || {};
         modelForm.billing_multiplier = 1.0;
         modelForm.weight = 100;
         modelForm.supports_thinking = false;
+        modelForm.max_thinking_tokens = 0;
+        modelForm.default_thinking_tokens = 0;
+        modelForm.cache_write_multiplier = 1.25;
+        modelForm.cache_read_multiplier = 0.1;
+        modelForm.timeout_seconds = 0;
         modelForm.enabled = true;
         roleSelectOpen.value = false;
         showModelModal.value = true;
@@ -233,6 +262,11 @@ window.VuePages = window.VuePages || {};
           model.billing_multiplier != null ? model.billing_multiplier : 1.0;
         modelForm.weight = model.weight != null ? model.weight : 100;
         modelForm.supports_thinking = !!model.supports_thinking;
+        modelForm.max_thinking_tokens = model.max_thinking_tokens || 0;
+        modelForm.default_thinking_tokens = model.default_thinking_tokens || 0;
+        modelForm.cache_write_multiplier = model.cache_write_multiplier ?? 1.25;
+        modelForm.cache_read_multiplier = model.cache_read_multiplier ?? 0.1;
+        modelForm.timeout_seconds = model.timeout_seconds || 0;
         modelForm.enabled = !!model.enabled;
         roleSelectOpen.value = false;
         showModelModal.value = true;
@@ -255,6 +289,11 @@ window.VuePages = window.VuePages || {};
               billing_multiplier: modelForm.billing_multiplier,
               weight: modelForm.weight,
               supports_thinking: modelForm.supports_thinking,
+              max_thinking_tokens: modelForm.max_thinking_tokens,
+              default_thinking_tokens: modelForm.default_thinking_tokens,
+              cache_write_multiplier: modelForm.cache_write_multiplier,
+              cache_read_multiplier: modelForm.cache_read_multiplier,
+              timeout_seconds: modelForm.timeout_seconds,
               enabled: modelForm.enabled,
             }),
           });
@@ -298,11 +337,20 @@ window.VuePages = window.VuePages || {};
         providerForm.base_url = "";
         providerForm.api_key = "";
         providerForm.weight = 1;
-        providerForm.max_concurrent = 10;
+        providerForm.max_concurrent = 0;
+        providerForm.timeout_seconds = 0;
+        providerForm.stream_only = false;
+        providerForm.anthropic_version = "";
+        providerForm.api_path_prefix = "";
+        providerForm.cost_multiplier = 1;
+        providerForm.shadow = false;
+        providerForm.shadow_sample_rate = 0;
         providerForm.enabled = true;
         providerForm.description = "";
         providerForm.model_ids = [];
         providerForm.custom_headers = "";
+        providerForm.auth_scheme = "anthropic";
+        providerForm.auth_header = "";
         showProviderModal.value = true;
       }
 
@@ -318,6 +366,13 @@ window.VuePages = window.VuePages || {};
         providerForm.api_key = "";
         providerForm.weight = provider.weight;
         providerForm.max_concurrent = provider.max_concurrent;
+        providerForm.timeout_seconds = provider.timeout_seconds || 0;
+        providerForm.stream_only = !!provider.stream_only;
+        providerForm.anthropic_version = provider.anthropic_version || "";
+        providerForm.api_path_prefix = provider.api_path_prefix || "";
+        providerForm.cost_multiplier = provider.cost_multiplier || 1;
+        providerForm.shadow = !!provider.shadow;
+        providerForm.shadow_sample_rate = provider.shadow_sample_rate || 0;
         providerForm.enabled = provider.enabled;
         providerForm.description = provider.description || "";
         providerForm.model_ids = (provider.models || []).map(function (m) {
@@ -326,6 +381,8 @@ window.VuePages = window.VuePages || {};
         providerForm.custom_headers = provider.custom_headers && Object.keys(provider.custom_headers).length > 0
           ? JSON.stringify(provider.custom_headers, null, 2)
           : "";
+        providerForm.auth_scheme = provider.auth_scheme || "anthropic";
+        providerForm.auth_header = provider.auth_header || "";
         showProviderModal.value = true;
       }
 
@@ -346,10 +403,24 @@ window.VuePages = window.VuePages || {};
             base_url: providerForm.base_url,
             weight: providerForm.weight,
             max_concurrent: providerForm.max_concurrent,
+            timeout_seconds: providerForm.timeout_seconds,
+            stream_only: providerForm.stream_only,
+            anthropic_version: providerForm.anthropic_version.trim(),
+            api_path_prefix: providerForm.api_path_prefix.trim(),
+            cost_multiplier: providerForm.cost_multiplier || 1,
+            shadow: providerForm.shadow,
+            shadow_sample_rate: providerForm.shadow_sample_rate || 0,
             enabled: providerForm.enabled,
             description: providerForm.description || null,
             model_ids: providerForm.model_ids,
+            auth_scheme: providerForm.auth_scheme,
+            auth_header: providerForm.auth_scheme === "custom_header" ? providerForm.auth_header : "",
           };
+          if (providerForm.auth_scheme === "custom_header" && !providerForm.auth_header) {
+            toastStore.error("请填写认证请求头名称");
+            saving.value = false;
+            return;
+          }
           if (providerForm.custom_headers) {
             try {
               data.custom_headers = JSON.parse(providerForm.custom_headers);
@@ -941,6 +1012,37 @@ window.VuePages = window.VuePages || {};
                             </label>\
                         </div>\
                     </div>\
+                    <div class="form-row">\
+                        <div class="form-group">\
+                            <label>缓存写入倍率</label>\
+                            <input type="number" v-model.number="modelForm.cache_write_multiplier" step="0.05" min="0">\
+                            <small style="color: var(--text-secondary)">Prompt 缓存写入按输入价格的倍数计费</small>\
+                        </div>\
+                        <div class="form-group">\
+                            <label>缓存读取倍率</label>\
+                            <input type="number" v-model.number="modelForm.cache_read_multiplier" step="0.01" min="0">\
+                            <small style="color: var(--text-secondary)">Prompt 缓存命中按输入价格的倍数计费</small>\
+                        </div>\
+                    </div>\
+                    <div class="form-row" v-if="modelForm.supports_thinking">\
+                        <div class="form-group">\
+                            <label>思考预算上限 (tokens)</label>\
+                            <input type="number" v-model.number="modelForm.max_thinking_tokens" step="1" min="0">\
+                            <small style="color: var(--text-secondary)">超出时截断 budget_tokens，0 表示不限制</small>\
+                        </div>\
+                        <div class="form-group">\
+                            <label>默认思考预算 (tokens)</label>\
+                            <input type="number" v-model.number="modelForm.default_thinking_tokens" step="1" min="0">\
+                            <small style="color: var(--text-secondary)">启用思考但未指定预算时使用，0 表示不设置</small>\
+                        </div>\
+                    </div>\
+                    <div class="form-row">\
+                        <div class="form-group">\
+                            <label>请求超时 (秒)</label>\
+                            <input type="number" v-model.number="modelForm.timeout_seconds" step="1" min="0">\
+                            <small style="color: var(--text-secondary)">非流式请求的超时，优先于服务商设置，0 表示使用服务商超时</small>\
+                        </div>\
+                    </div>\
                 </form>\
             </div>\
             <div class="modal-footer">\
@@ -1053,9 +1155,50 @@ window.VuePages = window.VuePages || {};
                         </div>\
                         <div class="form-group">\
                             <label>最大并发</label>\
-                            <input type="number" v-model.number="providerForm.max_concurrent" min="1">\
+                            <input type="number" v-model.number="providerForm.max_concurrent" min="0" placeholder="0 为不限">\
                         </div>\
                     </div>\
+                    <div class="form-row">\
+                        <div class="form-group">\
+                            <label>请求超时 (秒)</label>\
+                            <input type="number" v-model.number="providerForm.timeout_seconds" step="1" min="0">\
+                            <small style="color: var(--text-secondary)">非流式请求的超时，0 表示默认 120 秒</small>\
+                        </div>\
+                        <div class="form-group">\
+                            <label>API 版本</label>\
+                            <input type="text" v-model="providerForm.anthropic_version" placeholder="留空使用系统设置">\
+                            <small style="color: var(--text-secondary)">固定发往该服务商的 anthropic-version</small>\
+                        </div>\
+                    </div>\
+                    <div class="form-row">\
+                        <div class="form-group">\
+                            <label class="label-with-help">\
+                                认证方式\
+                                <span class="help-icon" data-tooltip="转发请求时 API Key 的发送方式。&#10;&#10;• Anthropic：x-api-key 请求头&#10;• Bearer：Authorization: Bearer，适用于 OpenAI 兼容网关&#10;• 自定义请求头：放在指定名称的请求头中" data-tooltip-pos="bottom">\
+                                    <svg viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2"><circle cx="12" cy="12" r="10"/><path d="M9.09 9a3 3 0 0 1 5.83 1c0 2-3 3-3 3"/><line x1="12" y1="17" x2="12.01" y2="17"/></svg>\
+                                </span>\
+                            </label>\
+                            <select v-model="providerForm.auth_scheme">\
+                                <option value="anthropic">Anthropic (x-api-key)</option>\
+                                <option value="bearer">Bearer (Authorization)</option>\
+                                <option value="custom_header">自定义请求头</option>\
+                            </select>\
+                        </div>\
+                        <div class="form-group" v-show="providerForm.auth_scheme === \'custom_header\'">\
+                            <label>认证请求头名称</label>\
+                            <input type="text" v-model="providerForm.auth_header" placeholder="api-key">\
+                        </div>\
+                    </div>\
+                    <div class="form-group">\
+                        <label>API 路径前缀 <span class="text-muted">(可选)</span></label>\
+                        <input type="text" v-model="providerForm.api_path_prefix" placeholder="/v1">\
+                        <small style="color: var(--text-secondary)">拼接在 Base URL 与 /messages 之间，留空为 /v1，填 / 表示不加前缀（如网关路径 /anthropic/v1）</small>\
+                    </div>\
+                    <div class="form-group">\
+                        <label>价格系数</label>\
+                        <input type="number" v-model.number="providerForm.cost_multiplier" min="0.01" step="0.01">\
+                        <small style="color: var(--text-secondary)">该服务商上模型价格的倍数，1 为官方价格（如八折转售填 0.8），用于费用统计与 least_cost 负载均衡</small>\
+                    </div>\
                     <div class="form-group">\
                         <label>描述 <span class="text-muted">(可选)</span></label>\
                         <input type="text" v-model="providerForm.description" placeholder="服务商描述信息">\
@@ -1069,6 +1212,24 @@ window.VuePages = window.VuePages || {};
                         </label>\
                         <textarea v-model="providerForm.custom_headers" rows="4" placeholder=\'{"User-Agent": "claude-code/1.0", "X-Client-Type": "claude-code"}\' style="font-family: monospace; font-size: 13px;"></textarea>\
                     </div>\
+                    <div class="form-group">\
+                        <label class="checkbox-label">\
+                            <input type="checkbox" v-model="providerForm.stream_only">\
+                            仅支持流式响应\
+                        </label>\
+                        <small style="color: var(--text-secondary)">非流式请求将以流式发往上游，并合并为完整响应返回</small>\
+                    </div>\
+                    <div class="form-group">\
+                        <label class="checkbox-label">\
+                            <input type="checkbox" v-model="providerForm.shadow">\
+                            影子服务商\
+                        </label>\
+                        <small style="color: var(--text-secondary)">不处理客户端请求，仅接收按比例复制的非流式请求，用于与生产服务商对比</small>\
+                    </div>\
+                    <div class="form-group" v-if="providerForm.shadow">\
+                        <label>复制比例 <span class="text-muted">(0-1)</span></label>\
+                        <input type="number" v-model.number="providerForm.shadow_sample_rate" min="0" max="1" step="0.01">\
+                    </div>\
                     <div class="form-group">\
                         <label class="checkbox-label">\
                             <input type="checkbox" v-model="providerForm.enabled">\
@@ -39,11 +39,13 @@ window.VuePages = window.VuePages || {};
         retry_count: 2,
         cache_enabled: true,
         cache_ttl_seconds: 300,
+        cache_max_size: 10000,
         max_tokens: 1024,
         temperature: 0,
         rule_based_routing_enabled: true,
         rule_fallback_strategy: "default",
         rule_fallback_task_type: "default",
+        role_fallback_chain: "",
       });
 
       // 模型模态框
@@ -73,6 +75,7 @@ window.VuePages = window.VuePages || {};
 
       // 规则状态
       var builtinRules = ref([]);
+      var customRoles = ref([]); // 管理员自定义的任务类型角色
       var customRules = ref([]);
       var ruleStats = ref(null);
       var rulesLoading = ref(false);
@@ -90,6 +93,8 @@ window.VuePages = window.VuePages || {};
         task_type: "default",
         priority: 50,
         enabled: true,
+        rollout_percent: 100,
+        observe: false,
       });
       var ruleFormErrors = reactive({
         name: "",
@@ -275,7 +280,7 @@ window.VuePages = window.VuePages || {};
           default: "default (平衡)",
           complex: "complex (高能)",
         };
-        return map[config.rule_fallback_task_type] || "default (平衡)";
+        return map[config.rule_fallback_task_type] || config.rule_fallback_task_type || "default (平衡)";
       });
 
       var primaryModelLabel = computed(function () {
@@ -347,6 +352,8 @@ window.VuePages = window.VuePages || {};
         config.cache_enabled = cfg.cache_enabled !== false;
         config.cache_ttl_seconds =
           cfg.cache_ttl_seconds != null ? cfg.cache_ttl_seconds : 300;
+        config.cache_max_size =
+          cfg.cache_max_size != null ? cfg.cache_max_size : 10000;
         config.max_tokens = cfg.max_tokens != null ? cfg.max_tokens : 1024;
         config.temperature = cfg.temperature != null ? cfg.temperature : 0;
         config.rule_based_routing_enabled =
@@ -354,6 +361,7 @@ window.VuePages = window.VuePages || {};
         config.rule_fallback_strategy = cfg.rule_fallback_strategy || "default";
         config.rule_fallback_task_type =
           cfg.rule_fallback_task_type || "default";
+        config.role_fallback_chain = (cfg.role_fallback_chain || []).join(", ");
       }
 
       function loadData() {
@@ -362,18 +370,21 @@ window.VuePages = window.VuePages || {};
           VueApi.get("/api/config/providers"),
           VueApi.get("/api/config/routing/models"),
           VueApi.get("/api/config/routing/llm-config"),
+          VueApi.get("/api/config/roles"),
         ])
           .then(function (results) {
             return Promise.all([
               results[0].json(),
               results[1].json(),
               results[2].json(),
+              results[3].json(),
             ]);
           })
           .then(function (parsed) {
             providers.value = parsed[0].providers || [];
             models.value = parsed[1].models || [];
             fillConfig(parsed[2]);
+            customRoles.value = (parsed[3].roles || []).filter(function (r) { return !r.builtin; });
           })
           .catch(function (error) {
             toastStore.error("加载数据失败: " + error.message);
@@ -440,6 +451,11 @@ window.VuePages = window.VuePages || {};
           fallback_model_id: config.fallback_model_id
             ? parseInt(config.fallback_model_id)
             : 0,
+          role_fallback_chain: config.role_fallback_chain
+            .split(/[,\s]+/)
+            .filter(function (r) {
+              return r !== "";
+            }),
         });
         VueApi.put("/api/config/routing/llm-config", payload)
           .then(function () {
@@ -613,6 +629,8 @@ window.VuePages = window.VuePages || {};
           ruleForm.task_type = rule.task_type || "default";
           ruleForm.priority = rule.priority != null ? rule.priority : 50;
           ruleForm.enabled = rule.enabled !== false;
+          ruleForm.rollout_percent = rule.rollout_percent || 100;
+          ruleForm.observe = rule.observe === true;
         } else {
           ruleForm.name = "";
           ruleForm.description = "";
@@ -622,6 +640,8 @@ window.VuePages = window.VuePages || {};
           ruleForm.task_type = "default";
           ruleForm.priority = 50;
           ruleForm.enabled = true;
+          ruleForm.rollout_percent = 100;
+          ruleForm.observe = false;
         }
         // 清空错误信息
         ruleFormErrors.name = "";
@@ -704,6 +724,8 @@ window.VuePages = window.VuePages || {};
           task_type: ruleForm.task_type,
           priority: ruleForm.priority,
           enabled: ruleForm.enabled,
+          rollout_percent: ruleForm.rollout_percent,
+          observe: ruleForm.observe,
         };
         var url = editingRule.value
           ? "/api/config/routing/rules/" + editingRule.value.id
@@ -1259,6 +1281,7 @@ window.VuePages = window.VuePages || {};
         testResult: testResult,
         testing: testing,
         builtinRules: builtinRules,
+        customRoles: customRoles,
         customRules: customRules,
         ruleStats: ruleStats,
         rulesLoading: rulesLoading,
@@ -1396,9 +1419,15 @@ window.VuePages = window.VuePages || {};
                                     <button type="button" class="custom-select-option" :class="{ \'selected\': config.rule_fallback_task_type === \'simple\' }" @click="config.rule_fallback_task_type = \'simple\'; openDropdown = null">simple (轻量)</button>\
                                     <button type="button" class="custom-select-option" :class="{ \'selected\': config.rule_fallback_task_type === \'default\' }" @click="config.rule_fallback_task_type = \'default\'; openDropdown = null">default (平衡)</button>\
                                     <button type="button" class="custom-select-option" :class="{ \'selected\': config.rule_fallback_task_type === \'complex\' }" @click="config.rule_fallback_task_type = \'complex\'; openDropdown = null">complex (高能)</button>\
+                                    <button type="button" v-for="role in customRoles" :key="role.name" class="custom-select-option" :class="{ \'selected\': config.rule_fallback_task_type === role.name }" @click="config.rule_fallback_task_type = role.name; openDropdown = null">{{ role.name }}</button>\
                                 </div>\
                             </div>\
                         </div>\
+                        <div class="form-group">\
+                            <label>角色降级链</label>\
+                            <input type="text" v-model="config.role_fallback_chain" placeholder="complex, default, simple">\
+                            <p class="help-text">首选角色没有健康端点时，按顺序尝试其后的角色；留空使用内置顺序</p>\
+                        </div>\
                     </div>\
             <div class="collapsible-section" v-show="config.rule_based_routing_enabled && config.rule_fallback_strategy === \'llm\'" v-cloak>\
                 <button class="collapsible-header" @click="llmConfigExpanded = !llmConfigExpanded">\
@@ -1622,6 +1651,8 @@ window.VuePages = window.VuePages || {};
                         <div class="rule-card-body">\
                             <div class="rule-card-meta">\
                                 <span class="rule-card-meta-item">优先级: <span class="meta-value">{{ r.priority }}</span></span>\
+                                <span class="rule-card-meta-item" v-show="r.rollout_percent > 0 && r.rollout_percent < 100">灰度: <span class="meta-value">{{ r.rollout_percent }}%</span></span>\
+                                <span class="rule-card-meta-item" v-show="r.observe"><span class="meta-value">仅观察</span></span>\
                                 <span class="rule-card-meta-item meta-sep">|</span>\
                                 <span class="rule-card-meta-item" v-show="getRuleHit(r.id)">命中: <span class="meta-value">{{ getRuleHit(r.id) ? getRuleHit(r.id).count : 0 }}</span> <span class="text-muted" style="font-size:10px">{{ getRuleHit(r.id) && getRuleHit(r.id).percentage ? \'(\' + getRuleHit(r.id).percentage.toFixed(1) + \'%)\' : \'\' }}</span></span>\
                                 <span class="rule-card-meta-item meta-sep" v-show="getRuleHit(r.id)">|</span>\
@@ -1716,6 +1747,11 @@ window.VuePages = window.VuePages || {};
                             <input type="number" v-model.number="config.cache_ttl_seconds" min="60" max="86400">\
                             <p class="help-text">L1 内存缓存和 L2 精确匹配缓存的过期时间</p>\
                         </div>\
+                        <div class="form-group">\
+                            <label>L1 缓存容量（条）</label>\
+                            <input type="number" v-model.number="config.cache_max_size" min="1">\
+                            <p class="help-text">L1 内存缓存最大条目数，保存后立即生效，超出部分按时间淘汰最旧条目</p>\
+                        </div>\
                     </div>\
                 </div>\
             </div>\
@@ -1893,7 +1929,7 @@ window.VuePages = window.VuePages || {};
                         <label>条件表达式</label>\
                         <input type="text" v-model="ruleForm.condition" placeholder="如: len(message) > 2000 AND contains(message, \'分析\')" :class="{ \'error\': ruleFormErrors.condition }">\
                         <p class="error-text" v-if="ruleFormErrors.condition">{{ ruleFormErrors.condition }}</p>\
-                        <p class="help-text" v-else>支持: len(), contains(), has_code_block(), count(), matches(), AND/OR/NOT</p>\
+                        <p class="help-text" v-else>支持: len(), token_estimate(), contains(), has_code_block(), count(), matches(), AND/OR/NOT</p>\
                     </div>\
                     <div class="form-row">\
                         <div class="form-group">\
@@ -1902,6 +1938,7 @@ window.VuePages = window.VuePages || {};
                                 <option value="simple">simple</option>\
                                 <option value="default">default</option>\
                                 <option value="complex">complex</option>\
+                                <option v-for="role in customRoles" :key="role.name" :value="role.name">{{ role.name }}</option>\
                             </select>\
                             <p class="error-text" v-if="ruleFormErrors.task_type">{{ ruleFormErrors.task_type }}</p>\
                         </div>\
@@ -1911,6 +1948,18 @@ window.VuePages = window.VuePages || {};
                             <p class="help-text">数字越大优先级越高</p>\
                         </div>\
                     </div>\
+                    <div class="form-group">\
+                        <label>灰度比例 (%)</label>\
+                        <input type="number" v-model.number="ruleForm.rollout_percent" min="0" max="100">\
+                        <p class="help-text">仅对该比例的匹配请求生效，同一消息结果固定；100 为全量</p>\
+                    </div>\
+                    <div class="form-group">\
+                        <label class="checkbox-label">\
+                            <input type="checkbox" v-model="ruleForm.observe">\
+                            仅观察\
+                        </label>\
+                        <p class="help-text">只记录命中，不参与决定任务类型，无论优先级多高</p>\
+                    </div>\
                     <div class="form-group">\
                         <label class="checkbox-label">\
                             <input type="checkbox" v-model="ruleForm.enabled">\
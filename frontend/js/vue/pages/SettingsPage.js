@@ -28,9 +28,19 @@ window.VuePages = window.VuePages || {};
         dashboard_refresh_seconds: 30,
         logs_refresh_seconds: 30,
       });
+      var logRetention = reactive({ retention_days: 0 });
+      var anthropicVersion = reactive({
+        pinned_version: "",
+        default_version: "2023-06-01",
+        allowed_versions: "",
+      });
+      var healthWebhook = reactive({ url: "", secret: "", secret_set: false });
       var configSource = ref("-");
       var savingHealthCheck = ref(false);
       var savingUIConfig = ref(false);
+      var savingLogRetention = ref(false);
+      var savingAnthropicVersion = ref(false);
+      var savingHealthWebhook = ref(false);
       var exporting = ref(false);
       var importing = ref(false);
       var strategyOpen = ref(false);
@@ -39,7 +49,12 @@ window.VuePages = window.VuePages || {};
         { value: "round_robin", label: "轮询 (Round Robin)" },
         { value: "weighted", label: "加权 (Weighted)" },
         { value: "least_connections", label: "最少连接 (Least Connections)" },
+        {
+          value: "weighted_least_connections",
+          label: "加权最少连接 (Weighted Least Connections)",
+        },
         { value: "conversation_hash", label: "会话哈希 (Conversation Hash)" },
+        { value: "least_cost", label: "最低成本 (Least Cost)" },
       ];
 
       function strategyLabel() {
@@ -55,16 +70,29 @@ window.VuePages = window.VuePages || {};
             VueApi.get("/api/config/load-balance"),
             VueApi.get("/api/config/health-check"),
             VueApi.get("/api/config/ui"),
+            VueApi.get("/api/config/log-retention"),
+            VueApi.get("/api/config/anthropic-version"),
+            VueApi.get("/api/config/health-webhook"),
           ]);
           var lb = await results[0].json();
           var hc = await results[1].json();
           var ui = await results[2].json();
+          var lr = await results[3].json();
+          var av = await results[4].json();
+          var hw = await results[5].json();
           loadBalance.strategy = lb.strategy;
           healthCheck.enabled = !!hc.enabled;
           healthCheck.interval_seconds = hc.interval_seconds;
           healthCheck.timeout_seconds = hc.timeout_seconds;
           uiConfig.dashboard_refresh_seconds = ui.dashboard_refresh_seconds;
           uiConfig.logs_refresh_seconds = ui.logs_refresh_seconds;
+          logRetention.retention_days = lr.retention_days || 0;
+          anthropicVersion.pinned_version = av.pinned_version || "";
+          anthropicVersion.default_version = av.default_version || "2023-06-01";
+          anthropicVersion.allowed_versions = (av.allowed_versions || []).join(", ");
+          healthWebhook.url = hw.url || "";
+          healthWebhook.secret = "";
+          healthWebhook.secret_set = !!hw.secret_set;
         } catch (error) {
           toastStore.error("加载设置失败: " + error.message);
         }
@@ -119,6 +147,81 @@ window.VuePages = window.VuePages || {};
         }
       }
 
+      async function updateLogRetention() {
+        savingLogRetention.value = true;
+        try {
+          var response = await VueApi.put("/api/config/log-retention", {
+            retention_days: logRetention.retention_days || 0,
+          });
+          if (!response.ok) {
+            var result = await response.json();
+            throw new Error(result.detail || "更新失败");
+          }
+          toastStore.success("日志保留设置已更新");
+        } catch (error) {
+          toastStore.error(error.message);
+        } finally {
+          savingLogRetention.value = false;
+        }
+      }
+
+      async function updateAnthropicVersion() {
+        savingAnthropicVersion.value = true;
+        try {
+          var response = await VueApi.put("/api/config/anthropic-version", {
+            pinned_version: anthropicVersion.pinned_version.trim(),
+            default_version: anthropicVersion.default_version.trim(),
+            allowed_versions: anthropicVersion.allowed_versions
+              .split(",")
+              .map(function (v) {
+                return v.trim();
+              })
+              .filter(Boolean),
+          });
+          if (!response.ok) {
+            var result = await response.json();
+            throw new Error(result.detail || "更新失败");
+          }
+          toastStore.success("API 版本设置已更新");
+        } catch (error) {
+          toastStore.error(error.message);
+        } finally {
+          savingAnthropicVersion.value = false;
+        }
+      }
+
+      async function updateHealthWebhook() {
+        savingHealthWebhook.value = true;
+        try {
+          var body = { url: healthWebhook.url.trim() };
+          // 留空则保留当前签名密钥
+          if (healthWebhook.secret) body.secret = healthWebhook.secret;
+          var response = await VueApi.put("/api/config/health-webhook", body);
+          if (!response.ok) {
+            var result = await response.json();
+            throw new Error(result.detail || "更新失败");
+          }
+          if (healthWebhook.secret) healthWebhook.secret_set = true;
+          healthWebhook.secret = "";
+          toastStore.success("健康告警设置已更新");
+        } catch (error) {
+          toastStore.error(error.message);
+        } finally {
+          savingHealthWebhook.value = false;
+        }
+      }
+
+      async function clearHealthWebhookSecret() {
+        try {
+          var response = await VueApi.put("/api/config/health-webhook", { secret: "" });
+          if (!response.ok) throw new Error("更新失败");
+          healthWebhook.secret_set = false;
+          toastStore.success("签名密钥已清除");
+        } catch (error) {
+          toastStore.error(error.message);
+        }
+      }
+
       function exportConfig() {
         exporting.value = true;
         try {
@@ -183,9 +286,15 @@ window.VuePages = window.VuePages || {};
         loadBalance: loadBalance,
         healthCheck: healthCheck,
         uiConfig: uiConfig,
+        logRetention: logRetention,
+        anthropicVersion: anthropicVersion,
+        healthWebhook: healthWebhook,
         configSource: configSource,
         savingHealthCheck: savingHealthCheck,
         savingUIConfig: savingUIConfig,
+        savingLogRetention: savingLogRetention,
+        savingAnthropicVersion: savingAnthropicVersion,
+        savingHealthWebhook: savingHealthWebhook,
         exporting: exporting,
         importing: importing,
         strategyOpen: strategyOpen,
@@ -193,6 +302,10 @@ window.VuePages = window.VuePages || {};
         strategyLabel: strategyLabel,
         updateHealthCheck: updateHealthCheck,
         updateUIConfig: updateUIConfig,
+        updateLogRetention: updateLogRetention,
+        updateAnthropicVersion: updateAnthropicVersion,
+        updateHealthWebhook: updateHealthWebhook,
+        clearHealthWebhookSecret: clearHealthWebhookSecret,
         exportConfig: exportConfig,
         triggerImport: triggerImport,
         handleImportFile: handleImportFile,
@@ -274,6 +387,69 @@ window.VuePages = window.VuePages || {};
             </button>\
         </form>\
     </div>\
+    <!-- 日志保留 -->\
+    <div class="section">\
+        <h3>日志保留</h3>\
+        <form @submit.prevent="updateLogRetention">\
+            <div class="form-group">\
+                <label>请求日志保留天数</label>\
+                <input type="number" v-model.number="logRetention.retention_days" min="0" max="3650">\
+                <span class="help-text">超过保留天数的请求日志会被后台任务定期删除，0 表示永久保留</span>\
+            </div>\
+            <button type="submit" class="btn btn-primary" :disabled="savingLogRetention">\
+                <span v-show="!savingLogRetention">保存日志保留设置</span>\
+                <span v-show="savingLogRetention">保存中...</span>\
+            </button>\
+        </form>\
+    </div>\
+    <!-- API 版本 -->\
+    <div class="section">\
+        <h3>API 版本</h3>\
+        <form @submit.prevent="updateAnthropicVersion">\
+            <div class="form-group">\
+                <label>固定版本</label>\
+                <input type="text" v-model="anthropicVersion.pinned_version" placeholder="留空则按客户端版本">\
+                <span class="help-text">设置后所有上游请求都使用该 anthropic-version</span>\
+            </div>\
+            <div class="form-group">\
+                <label>允许的客户端版本</label>\
+                <input type="text" v-model="anthropicVersion.allowed_versions" placeholder="2023-06-01, ...">\
+                <span class="help-text">逗号分隔；客户端版本不在列表中时改用默认版本，留空表示全部允许</span>\
+            </div>\
+            <div class="form-group">\
+                <label>默认版本</label>\
+                <input type="text" v-model="anthropicVersion.default_version">\
+                <span class="help-text">客户端未携带版本或版本不被允许时使用；服务商可单独固定版本</span>\
+            </div>\
+            <button type="submit" class="btn btn-primary" :disabled="savingAnthropicVersion">\
+                <span v-show="!savingAnthropicVersion">保存 API 版本设置</span>\
+                <span v-show="savingAnthropicVersion">保存中...</span>\
+            </button>\
+        </form>\
+    </div>\
+    <!-- 健康告警 -->\
+    <div class="section">\
+        <h3>健康告警</h3>\
+        <form @submit.prevent="updateHealthWebhook">\
+            <div class="form-group">\
+                <label>Webhook 地址</label>\
+                <input type="text" v-model="healthWebhook.url" placeholder="留空则不发送">\
+                <span class="help-text">端点在健康与不健康之间切换时 POST JSON 通知</span>\
+            </div>\
+            <div class="form-group">\
+                <label>签名密钥</label>\
+                <input type="password" v-model="healthWebhook.secret" :placeholder="healthWebhook.secret_set ? \'已设置，留空保持不变\' : \'留空则不签名\'">\
+                <span class="help-text">设置后请求带 X-Signature-256 头（HMAC-SHA256）</span>\
+            </div>\
+            <div class="actions-row">\
+                <button type="submit" class="btn btn-primary" :disabled="savingHealthWebhook">\
+                    <span v-show="!savingHealthWebhook">保存健康告警设置</span>\
+                    <span v-show="savingHealthWebhook">保存中...</span>\
+                </button>\
+                <button type="button" class="btn" v-show="healthWebhook.secret_set" @click="clearHealthWebhookSecret()">清除密钥</button>\
+            </div>\
+        </form>\
+    </div>\
     <!-- 数据管理 -->\
     <div class="section">\
         <h3>数据管理</h3>\
@@ -44,6 +44,7 @@ window.VuePages = window.VuePages || {};
       var editForm = reactive({
         role: "user",
         is_active: true,
+        monthly_budget_usd: "",
       });
       var passwordForm = reactive({
         password: "",
@@ -117,6 +118,8 @@ window.VuePages = window.VuePages || {};
         editingUser.value = user;
         editForm.role = user.role;
         editForm.is_active = user.is_active;
+        editForm.monthly_budget_usd =
+          user.monthly_budget_usd == null ? "" : user.monthly_budget_usd;
         editRoleOpen.value = false;
         showEdit.value = true;
       }
@@ -163,6 +166,8 @@ window.VuePages = window.VuePages || {};
             {
               role: editForm.role,
               is_active: editForm.is_active,
+              // 空值或 0 表示不限制
+              monthly_budget_usd: Number(editForm.monthly_budget_usd) || 0,
             },
           );
           if (response.ok) {
@@ -484,6 +489,10 @@ window.VuePages = window.VuePages || {};
                             账号启用\
                         </label>\
                     </div>\
+                    <div class="form-group">\
+                        <label>月度预算（USD）</label>\
+                        <input type="number" min="0" step="0.01" v-model="editForm.monthly_budget_usd" placeholder="不限制">\
+                    </div>\
                 </form>\
             </div>\
             <div class="modal-footer">\
@@ -6,10 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
 	"github.com/user/llm-proxy-go/internal/service"
 )
 
@@ -17,6 +20,9 @@ import (
 type BackupHandler struct {
 	db            *sql.DB
 	endpointStore *service.EndpointStore
+	roles         *service.RoleSet
+	authService   *service.AuthService
+	routingConfig *repository.RoutingConfigRepository
 }
 
 // NewBackupHandler creates a new BackupHandler.
@@ -24,12 +30,27 @@ func NewBackupHandler(db *sql.DB, endpointStore *service.EndpointStore) *BackupH
 	return &BackupHandler{db: db, endpointStore: endpointStore}
 }
 
+// SetRoleSet sets the role set reloaded after an import.
+func (h *BackupHandler) SetRoleSet(rs *service.RoleSet) {
+	h.roles = rs
+}
+
+// SetCaches sets the API key and routing config caches invalidated after an
+// import.
+func (h *BackupHandler) SetCaches(authService *service.AuthService, routingConfig *repository.RoutingConfigRepository) {
+	h.authService = authService
+	h.routingConfig = routingConfig
+}
+
 // --- Backup data structures (override json:"-" fields) ---
 
-// BackupData is the top-level export envelope.
+// BackupData is the top-level export envelope. Sections are exported in a
+// stable order without timestamps, so exports of unchanged config are
+// byte-identical and config changes show up as diffs.
 type BackupData struct {
 	Version         int                    `json:"version"`
-	ExportedAt      string                 `json:"exported_at"`
+	ExportedAt      string                 `json:"exported_at,omitempty"` // Set only by older exports; the file name carries the time
+	ModelRoles      []backupModelRole      `json:"model_roles"`
 	Models          []backupModel          `json:"models"`
 	Providers       []backupProvider       `json:"providers"`
 	Users           []backupUser           `json:"users"`
@@ -41,6 +62,12 @@ type BackupData struct {
 	SystemConfig    backupSystemConfig     `json:"system_config"`
 }
 
+// backupModelRole is an admin-defined role; builtin roles are not exported.
+type backupModelRole struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
 type backupModel struct {
 	Name              string  `json:"name"`
 	Role              string  `json:"role"`
@@ -50,17 +77,43 @@ type backupModel struct {
 	SupportsThinking  bool    `json:"supports_thinking"`
 	Enabled           bool    `json:"enabled"`
 	Weight            int     `json:"weight"`
+
+	MaxThinkingTokens     int `json:"max_thinking_tokens"`
+	DefaultThinkingTokens int `json:"default_thinking_tokens"`
+
+	// Pointers so backups taken before prompt-cache pricing import with the
+	// default multipliers.
+	CacheWriteMultiplier *float64 `json:"cache_write_multiplier,omitempty"`
+	CacheReadMultiplier  *float64 `json:"cache_read_multiplier,omitempty"`
+
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
 }
 
+
 type backupProvider struct {
-	Name          string   `json:"name"`
-	BaseURL       string   `json:"base_url"`
-	APIKey        string   `json:"api_key"`
-	Weight        int      `json:"weight"`
-	MaxConcurrent int      `json:"max_concurrent"`
-	Enabled       bool     `json:"enabled"`
-	Description   string   `json:"description,omitempty"`
-	ModelNames    []string `json:"model_names"`
+	Name              string             `json:"name"`
+	BaseURL           string             `json:"base_url"`
+	APIKey            string             `json:"api_key"`
+	Weight            int                `json:"weight"`
+	MaxConcurrent     int                `json:"max_concurrent"`
+	Priority          int                `json:"priority"`
+	RPMLimit          int                `json:"rpm_limit"`
+	TPMLimit          int                `json:"tpm_limit"`
+	RetryRules        []models.RetryRule `json:"retry_rules,omitempty"`
+	HealthCheckMethod string             `json:"health_check_method,omitempty"`
+	HealthCheckPath   string             `json:"health_check_path,omitempty"`
+	AuthScheme        string             `json:"auth_scheme,omitempty"`
+	AuthHeader        string             `json:"auth_header,omitempty"`
+	TimeoutSeconds    int                `json:"timeout_seconds,omitempty"`
+	StreamOnly        bool               `json:"stream_only,omitempty"`
+	AnthropicVersion  string             `json:"anthropic_version,omitempty"`
+	APIPathPrefix     string             `json:"api_path_prefix,omitempty"`
+	CostMultiplier    float64            `json:"cost_multiplier,omitempty"`
+	Shadow            bool               `json:"shadow,omitempty"`
+	ShadowSampleRate  float64            `json:"shadow_sample_rate,omitempty"`
+	Enabled           bool               `json:"enabled"`
+	Description       string             `json:"description,omitempty"`
+	ModelNames        []string           `json:"model_names"`
 }
 
 type backupUser struct {
@@ -68,6 +121,8 @@ type backupUser struct {
 	PasswordHash string `json:"password_hash"`
 	Role         string `json:"role"`
 	IsActive     bool   `json:"is_active"`
+
+	MonthlyBudgetUSD *float64 `json:"monthly_budget_usd,omitempty"`
 }
 
 type backupAPIKey struct {
@@ -78,6 +133,9 @@ type backupAPIKey struct {
 	Username  string  `json:"username"`
 	IsActive  bool    `json:"is_active"`
 	ExpiresAt *string `json:"expires_at,omitempty"`
+
+	AllowedModels   []string `json:"allowed_models,omitempty"`
+	RateLimitPerMin int      `json:"rate_limit_per_min,omitempty"`
 }
 
 type backupRoutingModel struct {
@@ -92,15 +150,17 @@ type backupRoutingModel struct {
 }
 
 type backupRoutingRule struct {
-	Name        string   `json:"name"`
-	Description string   `json:"description"`
-	Keywords    []string `json:"keywords"`
-	Pattern     string   `json:"pattern"`
-	Condition   string   `json:"condition"`
-	TaskType    string   `json:"task_type"`
-	Priority    int      `json:"priority"`
-	IsBuiltin   bool     `json:"is_builtin"`
-	Enabled     bool     `json:"enabled"`
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	Keywords       []string `json:"keywords"`
+	Pattern        string   `json:"pattern"`
+	Condition      string   `json:"condition"`
+	TaskType       string   `json:"task_type"`
+	Priority       int      `json:"priority"`
+	IsBuiltin      bool     `json:"is_builtin"`
+	Enabled        bool     `json:"enabled"`
+	RolloutPercent int      `json:"rollout_percent"`
+	Observe        bool     `json:"observe"`
 }
 
 type backupEmbeddingModel struct {
@@ -115,18 +175,25 @@ type backupEmbeddingModel struct {
 }
 
 type backupSystemConfig struct {
-	Routing     map[string]any `json:"routing"`
-	LoadBalance map[string]any `json:"load_balance"`
-	HealthCheck map[string]any `json:"health_check"`
-	UI          map[string]any `json:"ui"`
+	Routing          map[string]any `json:"routing"`
+	LoadBalance      map[string]any `json:"load_balance"`
+	HealthCheck      map[string]any `json:"health_check"`
+	UI               map[string]any `json:"ui"`
+	LogRetention     map[string]any `json:"log_retention,omitempty"`
+	AnthropicVersion map[string]any `json:"anthropic_version,omitempty"`
+	HealthWebhook    map[string]any `json:"health_webhook,omitempty"`
 }
 
 // Export handles GET /api/config/backup/export - exports all config as JSON file.
 func (h *BackupHandler) Export(c *gin.Context) {
 	ctx := c.Request.Context()
-	data := BackupData{Version: 1, ExportedAt: time.Now().UTC().Format(time.RFC3339)}
+	data := BackupData{Version: 1}
 
 	var err error
+	if data.ModelRoles, err = h.exportModelRoles(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("export model_roles: %v", err)})
+		return
+	}
 	if data.Models, err = h.exportModels(ctx); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("export models: %v", err)})
 		return
@@ -163,14 +230,34 @@ func (h *BackupHandler) Export(c *gin.Context) {
 	data.SystemConfig.LoadBalance, _ = h.exportSingletonTable(ctx, "load_balance_config")
 	data.SystemConfig.HealthCheck, _ = h.exportSingletonTable(ctx, "health_check_config")
 	data.SystemConfig.UI, _ = h.exportSingletonTable(ctx, "ui_config")
+	data.SystemConfig.LogRetention, _ = h.exportSingletonTable(ctx, "log_retention_config")
+	data.SystemConfig.AnthropicVersion, _ = h.exportSingletonTable(ctx, "anthropic_version_config")
+	data.SystemConfig.HealthWebhook, _ = h.exportSingletonTable(ctx, "health_webhook_config")
 
 	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="llm-proxy-backup-%s.json"`,
 		time.Now().Format("20060102-150405")))
 	c.JSON(http.StatusOK, data)
 }
 
+func (h *BackupHandler) exportModelRoles(ctx context.Context) ([]backupModelRole, error) {
+	rows, err := h.db.QueryContext(ctx, `SELECT name, description FROM model_roles WHERE builtin = 0 ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := []backupModelRole{}
+	for rows.Next() {
+		var r backupModelRole
+		if err := rows.Scan(&r.Name, &r.Description); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
 func (h *BackupHandler) exportModels(ctx context.Context) ([]backupModel, error) {
-	rows, err := h.db.QueryContext(ctx, `SELECT name, role, cost_per_mtok_input, cost_per_mtok_output, billing_multiplier, supports_thinking, enabled, weight FROM models`)
+	rows, err := h.db.QueryContext(ctx, `SELECT name, role, cost_per_mtok_input, cost_per_mtok_output, billing_multiplier, supports_thinking, enabled, weight, max_thinking_tokens, default_thinking_tokens, cache_write_multiplier, cache_read_multiplier, timeout_seconds FROM models ORDER BY name`)
 	if err != nil {
 		return nil, err
 	}
@@ -179,7 +266,7 @@ func (h *BackupHandler) exportModels(ctx context.Context) ([]backupModel, error)
 	for rows.Next() {
 		var m backupModel
 		var st, en int
-		if err := rows.Scan(&m.Name, &m.Role, &m.CostPerMtokInput, &m.CostPerMtokOutput, &m.BillingMultiplier, &st, &en, &m.Weight); err != nil {
+		if err := rows.Scan(&m.Name, &m.Role, &m.CostPerMtokInput, &m.CostPerMtokOutput, &m.BillingMultiplier, &st, &en, &m.Weight, &m.MaxThinkingTokens, &m.DefaultThinkingTokens, &m.CacheWriteMultiplier, &m.CacheReadMultiplier, &m.TimeoutSeconds); err != nil {
 			return nil, err
 		}
 		m.SupportsThinking = st == 1
@@ -190,22 +277,40 @@ func (h *BackupHandler) exportModels(ctx context.Context) ([]backupModel, error)
 }
 
 func (h *BackupHandler) exportProviders(ctx context.Context) ([]backupProvider, error) {
-	rows, err := h.db.QueryContext(ctx, `SELECT id, name, base_url, api_key, weight, max_concurrent, enabled, COALESCE(description,'') FROM providers`)
+	rows, err := h.db.QueryContext(ctx, `SELECT id, name, base_url, api_key, weight, max_concurrent, priority, rpm_limit, tpm_limit, retry_rules, health_check_method, health_check_path, auth_scheme, auth_header, timeout_seconds, stream_only, anthropic_version, api_path_prefix, cost_multiplier, shadow, shadow_sample_rate, enabled, COALESCE(description,'') FROM providers ORDER BY name, id`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var result []backupProvider
+	var ids []int64
 	for rows.Next() {
 		var p backupProvider
 		var id int64
-		var en int
-		if err := rows.Scan(&id, &p.Name, &p.BaseURL, &p.APIKey, &p.Weight, &p.MaxConcurrent, &en, &p.Description); err != nil {
+		var en, so, sh int
+		var retryRules string
+		if err := rows.Scan(&id, &p.Name, &p.BaseURL, &p.APIKey, &p.Weight, &p.MaxConcurrent, &p.Priority, &p.RPMLimit, &p.TPMLimit, &retryRules, &p.HealthCheckMethod, &p.HealthCheckPath, &p.AuthScheme, &p.AuthHeader, &p.TimeoutSeconds, &so, &p.AnthropicVersion, &p.APIPathPrefix, &p.CostMultiplier, &sh, &p.ShadowSampleRate, &en, &p.Description); err != nil {
 			return nil, err
 		}
 		p.Enabled = en == 1
-		// Fetch associated model names
-		mrows, err := h.db.QueryContext(ctx, `SELECT m.name FROM provider_models pm JOIN models m ON pm.model_id = m.id WHERE pm.provider_id = ?`, id)
+		p.StreamOnly = so == 1
+		p.Shadow = sh == 1
+		if retryRules != "" {
+			if err := json.Unmarshal([]byte(retryRules), &p.RetryRules); err != nil {
+				return nil, fmt.Errorf("unmarshal retry_rules of provider %s: %w", p.Name, err)
+			}
+		}
+		result = append(result, p)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Fetch associated model names once the provider rows are released.
+	for i, id := range ids {
+		mrows, err := h.db.QueryContext(ctx, `SELECT m.name FROM provider_models pm JOIN models m ON pm.model_id = m.id WHERE pm.provider_id = ? ORDER BY m.name`, id)
 		if err != nil {
 			return nil, err
 		}
@@ -215,16 +320,19 @@ func (h *BackupHandler) exportProviders(ctx context.Context) ([]backupProvider,
 				mrows.Close()
 				return nil, err
 			}
-			p.ModelNames = append(p.ModelNames, mn)
+			result[i].ModelNames = append(result[i].ModelNames, mn)
 		}
+		err = mrows.Err()
 		mrows.Close()
-		result = append(result, p)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return result, rows.Err()
+	return result, nil
 }
 
 func (h *BackupHandler) exportUsers(ctx context.Context) ([]backupUser, error) {
-	rows, err := h.db.QueryContext(ctx, `SELECT username, password_hash, role, is_active FROM users`)
+	rows, err := h.db.QueryContext(ctx, `SELECT username, password_hash, role, is_active, monthly_budget_usd FROM users ORDER BY username`)
 	if err != nil {
 		return nil, err
 	}
@@ -233,7 +341,7 @@ func (h *BackupHandler) exportUsers(ctx context.Context) ([]backupUser, error) {
 	for rows.Next() {
 		var u backupUser
 		var active int
-		if err := rows.Scan(&u.Username, &u.PasswordHash, &u.Role, &active); err != nil {
+		if err := rows.Scan(&u.Username, &u.PasswordHash, &u.Role, &active, &u.MonthlyBudgetUSD); err != nil {
 			return nil, err
 		}
 		u.IsActive = active == 1
@@ -243,7 +351,7 @@ func (h *BackupHandler) exportUsers(ctx context.Context) ([]backupUser, error) {
 }
 
 func (h *BackupHandler) exportAPIKeys(ctx context.Context) ([]backupAPIKey, error) {
-	rows, err := h.db.QueryContext(ctx, `SELECT ak.name, ak.key_hash, ak.key_full, ak.key_prefix, u.username, ak.is_active, ak.expires_at FROM api_keys ak JOIN users u ON ak.user_id = u.id`)
+	rows, err := h.db.QueryContext(ctx, `SELECT ak.name, ak.key_hash, ak.key_full, ak.key_prefix, u.username, ak.is_active, ak.expires_at, ak.allowed_models, ak.rate_limit_per_min FROM api_keys ak JOIN users u ON ak.user_id = u.id ORDER BY u.username, ak.name, ak.key_hash`)
 	if err != nil {
 		return nil, err
 	}
@@ -253,20 +361,26 @@ func (h *BackupHandler) exportAPIKeys(ctx context.Context) ([]backupAPIKey, erro
 		var k backupAPIKey
 		var active int
 		var expiresAt sql.NullString
-		if err := rows.Scan(&k.Name, &k.KeyHash, &k.KeyFull, &k.KeyPrefix, &k.Username, &active, &expiresAt); err != nil {
+		var allowedModels string
+		if err := rows.Scan(&k.Name, &k.KeyHash, &k.KeyFull, &k.KeyPrefix, &k.Username, &active, &expiresAt, &allowedModels, &k.RateLimitPerMin); err != nil {
 			return nil, err
 		}
 		k.IsActive = active == 1
 		if expiresAt.Valid {
 			k.ExpiresAt = &expiresAt.String
 		}
+		if allowedModels != "" {
+			if err := json.Unmarshal([]byte(allowedModels), &k.AllowedModels); err != nil {
+				return nil, fmt.Errorf("unmarshal allowed_models of api_key %s: %w", k.Name, err)
+			}
+		}
 		result = append(result, k)
 	}
 	return result, rows.Err()
 }
 
 func (h *BackupHandler) exportRoutingModels(ctx context.Context) ([]backupRoutingModel, error) {
-	rows, err := h.db.QueryContext(ctx, `SELECT p.name, rm.model_name, rm.enabled, rm.priority, rm.cost_per_mtok_input, rm.cost_per_mtok_output, rm.billing_multiplier, COALESCE(rm.description,'') FROM routing_models rm JOIN providers p ON rm.provider_id = p.id`)
+	rows, err := h.db.QueryContext(ctx, `SELECT p.name, rm.model_name, rm.enabled, rm.priority, rm.cost_per_mtok_input, rm.cost_per_mtok_output, rm.billing_multiplier, COALESCE(rm.description,'') FROM routing_models rm JOIN providers p ON rm.provider_id = p.id ORDER BY p.name, rm.model_name, rm.id`)
 	if err != nil {
 		return nil, err
 	}
@@ -285,7 +399,7 @@ func (h *BackupHandler) exportRoutingModels(ctx context.Context) ([]backupRoutin
 }
 
 func (h *BackupHandler) exportRoutingRules(ctx context.Context) ([]backupRoutingRule, error) {
-	rows, err := h.db.QueryContext(ctx, `SELECT name, COALESCE(description,''), COALESCE(keywords,'[]'), COALESCE(pattern,''), COALESCE(condition,''), task_type, priority, is_builtin, enabled FROM routing_rules`)
+	rows, err := h.db.QueryContext(ctx, `SELECT name, COALESCE(description,''), COALESCE(keywords,'[]'), COALESCE(pattern,''), COALESCE(condition,''), task_type, priority, is_builtin, enabled, rollout_percent, observe FROM routing_rules ORDER BY name, id`)
 	if err != nil {
 		return nil, err
 	}
@@ -294,12 +408,13 @@ func (h *BackupHandler) exportRoutingRules(ctx context.Context) ([]backupRouting
 	for rows.Next() {
 		var r backupRoutingRule
 		var keywordsJSON string
-		var builtin, en int
-		if err := rows.Scan(&r.Name, &r.Description, &keywordsJSON, &r.Pattern, &r.Condition, &r.TaskType, &r.Priority, &builtin, &en); err != nil {
+		var builtin, en, observe int
+		if err := rows.Scan(&r.Name, &r.Description, &keywordsJSON, &r.Pattern, &r.Condition, &r.TaskType, &r.Priority, &builtin, &en, &r.RolloutPercent, &observe); err != nil {
 			return nil, err
 		}
 		r.IsBuiltin = builtin == 1
 		r.Enabled = en == 1
+		r.Observe = observe == 1
 		_ = json.Unmarshal([]byte(keywordsJSON), &r.Keywords)
 		if r.Keywords == nil {
 			r.Keywords = []string{}
@@ -310,7 +425,7 @@ func (h *BackupHandler) exportRoutingRules(ctx context.Context) ([]backupRouting
 }
 
 func (h *BackupHandler) exportEmbeddingModels(ctx context.Context) ([]backupEmbeddingModel, error) {
-	rows, err := h.db.QueryContext(ctx, `SELECT name, dimension, COALESCE(description,''), fastembed_supported, COALESCE(fastembed_name,''), is_builtin, enabled, sort_order FROM embedding_models`)
+	rows, err := h.db.QueryContext(ctx, `SELECT name, dimension, COALESCE(description,''), fastembed_supported, COALESCE(fastembed_name,''), is_builtin, enabled, sort_order FROM embedding_models ORDER BY name`)
 	if err != nil {
 		return nil, err
 	}
@@ -330,7 +445,13 @@ func (h *BackupHandler) exportEmbeddingModels(ctx context.Context) ([]backupEmbe
 	return result, rows.Err()
 }
 
-// exportSingletonTable reads all columns (except id) from a single-row config table.
+// backupVolatileColumns are left out of exported config tables so that
+// exporting unchanged config produces identical files.
+var backupVolatileColumns = []string{"id", "created_at", "updated_at"}
+
+// exportSingletonTable reads all columns (except id and timestamps) from a
+// single-row config table. encoding/json writes map keys sorted, so the
+// output is stable.
 func (h *BackupHandler) exportSingletonTable(ctx context.Context, table string) (map[string]any, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE id = 1", table)
 	rows, err := h.db.QueryContext(ctx, query)
@@ -355,7 +476,7 @@ func (h *BackupHandler) exportSingletonTable(ctx context.Context, table string)
 	}
 	result := make(map[string]any, len(cols))
 	for i, col := range cols {
-		if col == "id" {
+		if slices.Contains(backupVolatileColumns, col) {
 			continue
 		}
 		if b, ok := values[i].([]byte); ok {
@@ -367,8 +488,169 @@ func (h *BackupHandler) exportSingletonTable(ctx context.Context, table string)
 	return result, nil
 }
 
+// Backup sections that can be imported on their own, in import order.
+var backupSectionOrder = []string{
+	"model_roles", "models", "providers", "users", "api_keys",
+	"routing_models", "routing_rules", "routing_llm_config", "embedding_models", "system_config",
+}
+
+// backupSectionDependents lists the sections whose rows refer to a
+// section's rows by ID. Importing a section gives its rows new IDs, so its
+// dependents are imported along with it.
+var backupSectionDependents = map[string][]string{
+	"users":     {"api_keys"},
+	"providers": {"routing_models"},
+}
+
+// parseBackupSections parses the comma-separated sections query parameter
+// into the set of sections to import; empty means all of them.
+func parseBackupSections(param string) (map[string]bool, error) {
+	sections := make(map[string]bool)
+	if strings.TrimSpace(param) == "" {
+		for _, s := range backupSectionOrder {
+			sections[s] = true
+		}
+		return sections, nil
+	}
+	for _, s := range strings.Split(param, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !slices.Contains(backupSectionOrder, s) {
+			return nil, fmt.Errorf("unknown backup section %q (valid: %s)", s, strings.Join(backupSectionOrder, ", "))
+		}
+		sections[s] = true
+		for _, dep := range backupSectionDependents[s] {
+			sections[dep] = true
+		}
+	}
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("no backup sections given")
+	}
+	return sections, nil
+}
+
+// keepSections drops the data of sections that are not imported.
+func (d *BackupData) keepSections(sections map[string]bool) {
+	if !sections["model_roles"] {
+		d.ModelRoles = nil
+	}
+	if !sections["models"] {
+		d.Models = nil
+	}
+	if !sections["providers"] {
+		d.Providers = nil
+	}
+	if !sections["users"] {
+		d.Users = nil
+	}
+	if !sections["api_keys"] {
+		d.APIKeys = nil
+	}
+	if !sections["routing_models"] {
+		d.RoutingModels = nil
+	}
+	if !sections["routing_rules"] {
+		d.RoutingRules = nil
+	}
+	if !sections["routing_llm_config"] {
+		d.RoutingLLMConfig = nil
+	}
+	if !sections["embedding_models"] {
+		d.EmbeddingModels = nil
+	}
+	if !sections["system_config"] {
+		d.SystemConfig = backupSystemConfig{}
+	}
+}
+
+// backupRefs holds the name→ID maps of existing rows that imported
+// sections refer to, for referenced sections that are not imported; a nil
+// map means the section is imported.
+type backupRefs struct {
+	models    map[string]int64
+	providers map[string]int64
+	users     map[string]int64
+}
+
+// loadBackupRefs reads the rows imported sections may refer to from the
+// sections that are kept.
+func loadBackupRefs(ctx context.Context, tx *sql.Tx, sections map[string]bool) (backupRefs, error) {
+	var refs backupRefs
+	var err error
+	if !sections["models"] {
+		if refs.models, err = loadNameIDs(ctx, tx, "SELECT name, id FROM models"); err != nil {
+			return refs, fmt.Errorf("load models: %w", err)
+		}
+	}
+	if !sections["providers"] {
+		if refs.providers, err = loadNameIDs(ctx, tx, "SELECT name, id FROM providers"); err != nil {
+			return refs, fmt.Errorf("load providers: %w", err)
+		}
+	}
+	if !sections["users"] {
+		if refs.users, err = loadNameIDs(ctx, tx, "SELECT username, id FROM users"); err != nil {
+			return refs, fmt.Errorf("load users: %w", err)
+		}
+	}
+	return refs, nil
+}
+
+// loadNameIDs runs a query selecting (name, id) rows into a map.
+func loadNameIDs(ctx context.Context, tx *sql.Tx, query string) (map[string]int64, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var id int64
+		if err := rows.Scan(&name, &id); err != nil {
+			return nil, err
+		}
+		ids[name] = id
+	}
+	return ids, rows.Err()
+}
+
+// providerModelLink is a provider_models row with the model named.
+type providerModelLink struct {
+	providerID int64
+	modelName  string
+}
+
+// loadProviderModelLinks reads which models each provider serves.
+func loadProviderModelLinks(ctx context.Context, tx *sql.Tx) ([]providerModelLink, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT pm.provider_id, m.name FROM provider_models pm JOIN models m ON m.id = pm.model_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var links []providerModelLink
+	for rows.Next() {
+		var l providerModelLink
+		if err := rows.Scan(&l.providerID, &l.modelName); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
 // Import handles POST /api/config/backup/import - restores config from JSON.
+// The optional sections query parameter (e.g. ?sections=routing_rules,models)
+// limits which sections are cleared and imported; the rest are left intact.
+// Without it the whole configuration is replaced.
 func (h *BackupHandler) Import(c *gin.Context) {
+	sections, err := parseBackupSections(c.Query("sections"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	var data BackupData
 	if err := c.ShouldBindJSON(&data); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid JSON: %v", err)})
@@ -378,6 +660,7 @@ func (h *BackupHandler) Import(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported backup version: %d", data.Version)})
 		return
 	}
+	data.keepSections(sections)
 
 	tx, err := h.db.BeginTx(c.Request.Context(), nil)
 	if err != nil {
@@ -388,24 +671,77 @@ func (h *BackupHandler) Import(c *gin.Context) {
 
 	ctx := c.Request.Context()
 
+	refs, err := loadBackupRefs(ctx, tx, sections)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Importing clears the imported sections first, so reject a backup that
+	// would fail partway before touching anything.
+	if problems := validateBackup(&data, refs); len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid backup data", "problems": problems})
+		return
+	}
+
+	// Links from kept providers to replaced models are restored by model
+	// name once the models are imported.
+	var providerLinks []providerModelLink
+	if sections["models"] && !sections["providers"] {
+		if providerLinks, err = loadProviderModelLinks(ctx, tx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("load provider_models: %v", err)})
+			return
+		}
+	}
+
 	// 1. Clear dependent tables first (foreign key order)
-	clearTables := []string{
-		"provider_models", "api_keys", "routing_models",
-		"routing_rules", "embedding_models", "models", "providers", "users",
+	clearTables := []struct{ table, section string }{
+		{"provider_models", "providers"}, {"provider_models", "models"},
+		{"api_keys", "api_keys"}, {"routing_models", "routing_models"},
+		{"routing_rules", "routing_rules"}, {"embedding_models", "embedding_models"},
+		{"models", "models"}, {"providers", "providers"}, {"users", "users"},
 	}
 	for _, t := range clearTables {
-		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", t)); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("clear %s: %v", t, err)})
+		if !sections[t.section] {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", t.table)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("clear %s: %v", t.table, err)})
+			return
+		}
+	}
+
+	// Custom roles come before the models and rules using them; builtin
+	// roles always exist.
+	if sections["model_roles"] {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM model_roles WHERE builtin = 0`); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("clear model_roles: %v", err)})
+			return
+		}
+	}
+	for _, r := range data.ModelRoles {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR IGNORE INTO model_roles (name, description) VALUES (?,?)`, r.Name, r.Description); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("insert model_role %s: %v", r.Name, err)})
 			return
 		}
 	}
 
 	// 2. Import models → build name→ID map
-	modelIDs := make(map[string]int64)
+	modelIDs := refs.models
+	if modelIDs == nil {
+		modelIDs = make(map[string]int64)
+	}
 	for _, m := range data.Models {
+		cacheWrite, cacheRead := models.DefaultCacheWriteMultiplier, models.DefaultCacheReadMultiplier
+		if m.CacheWriteMultiplier != nil {
+			cacheWrite = *m.CacheWriteMultiplier
+		}
+		if m.CacheReadMultiplier != nil {
+			cacheRead = *m.CacheReadMultiplier
+		}
 		res, err := tx.ExecContext(ctx,
-			`INSERT INTO models (name, role, cost_per_mtok_input, cost_per_mtok_output, billing_multiplier, supports_thinking, enabled, weight) VALUES (?,?,?,?,?,?,?,?)`,
-			m.Name, m.Role, m.CostPerMtokInput, m.CostPerMtokOutput, m.BillingMultiplier, boolInt(m.SupportsThinking), boolInt(m.Enabled), m.Weight)
+			`INSERT INTO models (name, role, cost_per_mtok_input, cost_per_mtok_output, billing_multiplier, supports_thinking, enabled, weight, max_thinking_tokens, default_thinking_tokens, cache_write_multiplier, cache_read_multiplier, timeout_seconds) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+			m.Name, m.Role, m.CostPerMtokInput, m.CostPerMtokOutput, m.BillingMultiplier, boolInt(m.SupportsThinking), boolInt(m.Enabled), m.Weight, m.MaxThinkingTokens, m.DefaultThinkingTokens, cacheWrite, cacheRead, m.TimeoutSeconds)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("insert model %s: %v", m.Name, err)})
 			return
@@ -413,20 +749,37 @@ func (h *BackupHandler) Import(c *gin.Context) {
 		id, _ := res.LastInsertId()
 		modelIDs[m.Name] = id
 	}
+	for _, l := range providerLinks {
+		mid, ok := modelIDs[l.modelName]
+		if !ok {
+			continue // The model is no longer configured
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO provider_models (provider_id, model_id) VALUES (?,?)`, l.providerID, mid); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("restore provider_model %s: %v", l.modelName, err)})
+			return
+		}
+	}
 
 	// 3. Import providers → build name→ID map, then insert provider_models
-	providerIDs := make(map[string]int64)
+	providerIDs := refs.providers
+	if providerIDs == nil {
+		providerIDs = make(map[string]int64)
+	}
 	if err := h.importProviders(ctx, tx, data.Providers, modelIDs, providerIDs); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// 4. Import users → build username→ID map
-	userIDs := make(map[string]int64)
+	userIDs := refs.users
+	if userIDs == nil {
+		userIDs = make(map[string]int64)
+	}
 	for _, u := range data.Users {
 		res, err := tx.ExecContext(ctx,
-			`INSERT INTO users (username, password_hash, role, is_active) VALUES (?,?,?,?)`,
-			u.Username, u.PasswordHash, u.Role, boolInt(u.IsActive))
+			`INSERT INTO users (username, password_hash, role, is_active, monthly_budget_usd) VALUES (?,?,?,?,?)`,
+			u.Username, u.PasswordHash, u.Role, boolInt(u.IsActive), u.MonthlyBudgetUSD)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("insert user %s: %v", u.Username, err)})
 			return
@@ -446,9 +799,14 @@ func (h *BackupHandler) Import(c *gin.Context) {
 		if k.ExpiresAt != nil {
 			expiresAt = sql.NullString{String: *k.ExpiresAt, Valid: true}
 		}
+		allowedModels := ""
+		if len(k.AllowedModels) > 0 {
+			b, _ := json.Marshal(k.AllowedModels)
+			allowedModels = string(b)
+		}
 		if _, err := tx.ExecContext(ctx,
-			`INSERT INTO api_keys (user_id, key_hash, key_full, key_prefix, name, is_active, expires_at) VALUES (?,?,?,?,?,?,?)`,
-			uid, k.KeyHash, k.KeyFull, k.KeyPrefix, k.Name, boolInt(k.IsActive), expiresAt); err != nil {
+			`INSERT INTO api_keys (user_id, key_hash, key_full, key_prefix, name, is_active, expires_at, allowed_models, rate_limit_per_min) VALUES (?,?,?,?,?,?,?,?,?)`,
+			uid, k.KeyHash, k.KeyFull, k.KeyPrefix, k.Name, boolInt(k.IsActive), expiresAt, allowedModels, k.RateLimitPerMin); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("insert api_key %s: %v", k.Name, err)})
 			return
 		}
@@ -472,14 +830,27 @@ func (h *BackupHandler) Import(c *gin.Context) {
 	// 7. Import routing rules
 	for _, r := range data.RoutingRules {
 		kw, _ := json.Marshal(r.Keywords)
+		// Backups from before rollouts carry no rollout_percent.
+		rollout := r.RolloutPercent
+		if rollout == 0 {
+			rollout = 100
+		}
 		if _, err := tx.ExecContext(ctx,
-			`INSERT INTO routing_rules (name, description, keywords, pattern, condition, task_type, priority, is_builtin, enabled) VALUES (?,?,?,?,?,?,?,?,?)`,
-			r.Name, r.Description, string(kw), r.Pattern, r.Condition, r.TaskType, r.Priority, boolInt(r.IsBuiltin), boolInt(r.Enabled)); err != nil {
+			`INSERT INTO routing_rules (name, description, keywords, pattern, condition, task_type, priority, is_builtin, enabled, rollout_percent, observe) VALUES (?,?,?,?,?,?,?,?,?,?,?)`,
+			r.Name, r.Description, string(kw), r.Pattern, r.Condition, r.TaskType, r.Priority, boolInt(r.IsBuiltin), boolInt(r.Enabled), rollout, boolInt(r.Observe)); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("insert routing_rule %s: %v", r.Name, err)})
 			return
 		}
 	}
 
+	// Backups from before custom roles carry none; keep the roles models
+	// and rules refer to valid.
+	if _, err := tx.ExecContext(ctx,
+		`INSERT OR IGNORE INTO model_roles (name) SELECT role FROM models UNION SELECT task_type FROM routing_rules WHERE task_type != ''`); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("insert referenced model_roles: %v", err)})
+		return
+	}
+
 	// 8. Import embedding models
 	for _, m := range data.EmbeddingModels {
 		if _, err := tx.ExecContext(ctx,
@@ -511,24 +882,175 @@ func (h *BackupHandler) Import(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("update ui_config: %v", err)})
 		return
 	}
+	if err := h.importSingletonTable(ctx, tx, "log_retention_config", data.SystemConfig.LogRetention); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("update log_retention_config: %v", err)})
+		return
+	}
+	if err := h.importSingletonTable(ctx, tx, "anthropic_version_config", data.SystemConfig.AnthropicVersion); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("update anthropic_version_config: %v", err)})
+		return
+	}
+	if err := h.importSingletonTable(ctx, tx, "health_webhook_config", data.SystemConfig.HealthWebhook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("update health_webhook_config: %v", err)})
+		return
+	}
 
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("commit: %v", err)})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "配置导入成功"})
+	resp := gin.H{"message": "配置导入成功"}
+	if len(sections) < len(backupSectionOrder) {
+		imported := make([]string, 0, len(sections))
+		for _, s := range backupSectionOrder {
+			if sections[s] {
+				imported = append(imported, s)
+			}
+		}
+		resp["sections"] = imported
+	}
+	imported := make([]*models.Provider, 0, len(data.Providers))
+	for _, p := range data.Providers {
+		imported = append(imported, &models.Provider{Name: p.Name, BaseURL: p.BaseURL, APIKey: p.APIKey})
+	}
+	if dups := findDuplicateProviders(imported); len(dups) > 0 {
+		resp["warnings"] = duplicateProviderWarnings(dups)
+	}
+	c.JSON(http.StatusOK, resp)
 
 	// Refresh in-memory endpoint store so dashboard reflects imported data immediately.
 	go h.endpointStore.ReloadAndNotify(context.Background())
+	h.roles.Invalidate()
+	h.authService.InvalidateAPIKeys()
+	h.routingConfig.InvalidateCache()
+}
+
+// validateBackup checks a backup's required fields, uniqueness and the
+// references between its sections, returning every problem found.
+// References to sections that are not imported are checked against the
+// existing rows in refs.
+func validateBackup(data *BackupData, refs backupRefs) []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	// unique reports a missing or repeated name in a section whose names
+	// the schema requires to be unique.
+	unique := func(section string, i int, name string, seen map[string]bool) {
+		switch {
+		case name == "":
+			add("%s[%d]: name is required", section, i)
+		case seen[name]:
+			add("%s[%d]: duplicate name %q", section, i, name)
+		}
+		seen[name] = true
+	}
+
+	modelNames := nameSet(refs.models)
+	for i, m := range data.Models {
+		unique("models", i, m.Name, modelNames)
+		if m.Role == "" {
+			add("models[%d] %q: role is required", i, m.Name)
+		}
+	}
+
+	providerNames := nameSet(refs.providers)
+	for i, p := range data.Providers {
+		if p.Name == "" {
+			add("providers[%d]: name is required", i)
+		}
+		providerNames[p.Name] = true
+		if p.BaseURL == "" {
+			add("providers[%d] %q: base_url is required", i, p.Name)
+		}
+		for _, mn := range p.ModelNames {
+			if !modelNames[mn] {
+				add("providers[%d] %q: references unknown model %q", i, p.Name, mn)
+			}
+		}
+	}
+
+	usernames := nameSet(refs.users)
+	for i, u := range data.Users {
+		unique("users", i, u.Username, usernames)
+		if u.PasswordHash == "" {
+			add("users[%d] %q: password_hash is required", i, u.Username)
+		}
+		if u.Role == "" {
+			add("users[%d] %q: role is required", i, u.Username)
+		}
+	}
+
+	keyHashes := make(map[string]bool)
+	for i, k := range data.APIKeys {
+		switch {
+		case k.KeyHash == "":
+			add("api_keys[%d] %q: key_hash is required", i, k.Name)
+		case keyHashes[k.KeyHash]:
+			add("api_keys[%d] %q: duplicate key_hash", i, k.Name)
+		}
+		keyHashes[k.KeyHash] = true
+		if !usernames[k.Username] {
+			add("api_keys[%d] %q: references unknown user %q", i, k.Name, k.Username)
+		}
+	}
+
+	for i, rm := range data.RoutingModels {
+		if rm.ModelName == "" {
+			add("routing_models[%d]: model_name is required", i)
+		}
+		if !providerNames[rm.ProviderName] {
+			add("routing_models[%d] %q: references unknown provider %q", i, rm.ModelName, rm.ProviderName)
+		}
+	}
+
+	for i, r := range data.RoutingRules {
+		if r.Name == "" {
+			add("routing_rules[%d]: name is required", i)
+		}
+	}
+
+	embeddingNames := make(map[string]bool)
+	for i, m := range data.EmbeddingModels {
+		unique("embedding_models", i, m.Name, embeddingNames)
+		if m.Dimension <= 0 {
+			add("embedding_models[%d] %q: dimension must be positive", i, m.Name)
+		}
+	}
+	return problems
+}
+
+// nameSet returns the names of ids as a set.
+func nameSet(ids map[string]int64) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for name := range ids {
+		set[name] = true
+	}
+	return set
 }
 
 // importProviders inserts providers and their provider_models associations.
 func (h *BackupHandler) importProviders(ctx context.Context, tx *sql.Tx, providers []backupProvider, modelIDs map[string]int64, providerIDs map[string]int64) error {
 	for _, p := range providers {
+		if p.HealthCheckMethod == "" {
+			p.HealthCheckMethod = string(models.HealthCheckGet)
+		}
+		if p.AuthScheme == "" {
+			p.AuthScheme = string(models.AuthSchemeAnthropic)
+		}
+		// Backups from before per-provider pricing carry no cost_multiplier.
+		if p.CostMultiplier <= 0 {
+			p.CostMultiplier = 1
+		}
+		retryRules := ""
+		if len(p.RetryRules) > 0 {
+			b, _ := json.Marshal(p.RetryRules)
+			retryRules = string(b)
+		}
 		res, err := tx.ExecContext(ctx,
-			`INSERT INTO providers (name, base_url, api_key, weight, max_concurrent, enabled, description) VALUES (?,?,?,?,?,?,?)`,
-			p.Name, p.BaseURL, p.APIKey, p.Weight, p.MaxConcurrent, boolInt(p.Enabled), p.Description)
+			`INSERT INTO providers (name, base_url, api_key, weight, max_concurrent, priority, rpm_limit, tpm_limit, retry_rules, health_check_method, health_check_path, auth_scheme, auth_header, timeout_seconds, stream_only, anthropic_version, api_path_prefix, cost_multiplier, shadow, shadow_sample_rate, enabled, description) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+			p.Name, p.BaseURL, p.APIKey, p.Weight, p.MaxConcurrent, p.Priority, p.RPMLimit, p.TPMLimit, retryRules, p.HealthCheckMethod, p.HealthCheckPath, p.AuthScheme, p.AuthHeader, p.TimeoutSeconds, boolInt(p.StreamOnly), p.AnthropicVersion, p.APIPathPrefix, p.CostMultiplier, boolInt(p.Shadow), p.ShadowSampleRate, boolInt(p.Enabled), p.Description)
 		if err != nil {
 			return fmt.Errorf("insert provider %s: %v", p.Name, err)
 		}
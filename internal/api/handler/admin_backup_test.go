@@ -0,0 +1,228 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/internal/service"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+func TestBackupHandler_Import_ValidatesBeforeClearing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	var usersBefore int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM users").Scan(&usersBefore))
+	require.NotZero(t, usersBefore)
+
+	h := NewBackupHandler(db, nil)
+	r := gin.New()
+	r.POST("/api/config/backup/import", h.Import)
+
+	body, err := json.Marshal(BackupData{
+		Version:   1,
+		Models:    []backupModel{{Name: "m1", Role: "default"}, {Name: "m1"}},
+		Providers: []backupProvider{{Name: "p1", BaseURL: "https://api.example.com", ModelNames: []string{"m1", "missing-model"}}},
+		Users:     []backupUser{{Username: "alice", PasswordHash: "hash", Role: "user"}},
+		APIKeys:   []backupAPIKey{{Name: "k1", KeyHash: "h1", Username: "bob"}},
+		RoutingModels: []backupRoutingModel{
+			{ProviderName: "p1", ModelName: "ok"},
+			{ProviderName: "missing-provider", ModelName: "orphan"},
+		},
+	})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/config/backup/import", bytes.NewReader(body)))
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var resp struct {
+		Error    string   `json:"error"`
+		Problems []string `json:"problems"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.ElementsMatch(t, []string{
+		`models[1]: duplicate name "m1"`,
+		`models[1] "m1": role is required`,
+		`providers[0] "p1": references unknown model "missing-model"`,
+		`api_keys[0] "k1": references unknown user "bob"`,
+		`routing_models[1] "orphan": references unknown provider "missing-provider"`,
+	}, resp.Problems)
+
+	var usersAfter int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM users").Scan(&usersAfter))
+	assert.Equal(t, usersBefore, usersAfter, "nothing is cleared when validation fails")
+}
+
+func TestBackupHandler_Import_Sections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	modelRepo := repository.NewModelRepository(db)
+	h := NewBackupHandler(db, service.NewEndpointStore(modelRepo, repository.NewProviderRepository(db), zap.NewNop()))
+	r := gin.New()
+	r.POST("/api/config/backup/import", h.Import)
+	importBackup := func(sections string, data BackupData) *httptest.ResponseRecorder {
+		data.Version = 1
+		body, err := json.Marshal(data)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/config/backup/import?sections="+sections, bytes.NewReader(body)))
+		return w
+	}
+	count := func(query string) int {
+		var n int
+		require.NoError(t, db.QueryRow(query).Scan(&n))
+		return n
+	}
+
+	// Only the chosen sections are replaced; data for the others is ignored.
+	w := importBackup("routing_rules", BackupData{
+		RoutingRules: []backupRoutingRule{{Name: "imported-rule", TaskType: "complex", Enabled: true}},
+		Users:        []backupUser{{Username: "ignored", PasswordHash: "hash", Role: "user"}},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"sections":["routing_rules"]`)
+	assert.Equal(t, 1, count("SELECT COUNT(*) FROM routing_rules"))
+	assert.Equal(t, 3, count("SELECT COUNT(*) FROM users"))
+	assert.Equal(t, 3, count("SELECT COUNT(*) FROM api_keys"))
+
+	// References to sections left out are checked against existing rows.
+	w = importBackup("routing_models", BackupData{
+		RoutingModels: []backupRoutingModel{
+			{ProviderName: "anthropic-primary", ModelName: "ok"},
+			{ProviderName: "missing-provider", ModelName: "orphan"},
+		},
+	})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `references unknown provider \"missing-provider\"`)
+	assert.NotContains(t, w.Body.String(), "anthropic-primary")
+
+	// Kept providers are relinked to imported models by name.
+	w = importBackup("models", BackupData{
+		Models: []backupModel{{Name: "claude-sonnet-4", Role: "default", Enabled: true}, {Name: "new-model", Role: "default"}},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, 2, count("SELECT COUNT(*) FROM models"))
+	assert.Equal(t, 2, count(`SELECT COUNT(*) FROM provider_models pm JOIN models m ON m.id = pm.model_id WHERE m.name = 'claude-sonnet-4'`))
+	assert.Equal(t, 2, count("SELECT COUNT(*) FROM provider_models"), "links to dropped models are removed")
+
+	// Importing users brings their API keys along.
+	w = importBackup("users", BackupData{
+		Users:   []backupUser{{Username: "alice", PasswordHash: "hash", Role: "admin", IsActive: true}},
+		APIKeys: []backupAPIKey{{Name: "alice-key", KeyHash: "alice-hash", Username: "alice", IsActive: true}},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"sections":["users","api_keys"]`)
+	assert.Equal(t, 1, count("SELECT COUNT(*) FROM api_keys"))
+
+	w = importBackup("bogus", BackupData{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown backup section")
+}
+
+func TestBackupHandler_Export_Deterministic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.NewTestDBWithDefaults(t)
+	testutil.SeedTestData(t, db)
+	modelRepo := repository.NewModelRepository(db)
+	h := NewBackupHandler(db, service.NewEndpointStore(modelRepo, repository.NewProviderRepository(db), zap.NewNop()))
+	r := gin.New()
+	r.GET("/api/config/backup/export", h.Export)
+	r.POST("/api/config/backup/import", h.Import)
+	export := func() []byte {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/config/backup/export", nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return w.Body.Bytes()
+	}
+
+	first := export()
+	assert.Equal(t, string(first), string(export()))
+	assert.NotContains(t, string(first), "exported_at")
+	assert.NotContains(t, string(first), "updated_at")
+
+	// Restoring an export gives every row a new ID; the next export is
+	// still the same.
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/config/backup/import", bytes.NewReader(first)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, string(first), string(export()))
+}
+
+func TestBackupHandler_RoundTrip_APIKeyRestrictions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	ctx := context.Background()
+	keyRepo := repository.NewAPIKeyRepository(db)
+	_, err := keyRepo.Insert(ctx, &models.APIKey{
+		UserID: 2, KeyHash: "restricted-hash", KeyPrefix: "sk-r", Name: "restricted", IsActive: true,
+		AllowedModels: []string{"claude-haiku", "claude-sonnet-4"}, RateLimitPerMin: 30,
+	})
+	require.NoError(t, err)
+
+	h := NewBackupHandler(db, service.NewEndpointStore(repository.NewModelRepository(db), repository.NewProviderRepository(db), zap.NewNop()))
+	r := gin.New()
+	r.GET("/api/config/backup/export", h.Export)
+	r.POST("/api/config/backup/import", h.Import)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/config/backup/export", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w2 := httptest.NewRecorder()
+	r.ServeHTTP(w2, httptest.NewRequest(http.MethodPost, "/api/config/backup/import?sections=users", bytes.NewReader(w.Body.Bytes())))
+	require.Equal(t, http.StatusOK, w2.Code, w2.Body.String())
+
+	restored, err := keyRepo.FindByKeyHash(ctx, "restricted-hash")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"claude-haiku", "claude-sonnet-4"}, restored.AllowedModels)
+	assert.Equal(t, 30, restored.RateLimitPerMin)
+}
+
+func TestBackupHandler_RoundTrip_ProviderRetryRules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	ctx := context.Background()
+	providerRepo := repository.NewProviderRepository(db)
+	rules := []models.RetryRule{{StatusCodes: []int{400}, MessageRegex: "overloaded", Retry: true}}
+	_, err := providerRepo.Insert(ctx, &models.Provider{Name: "retrying", BaseURL: "https://api.example.com", Weight: 1, Enabled: true, RetryRules: rules}, nil)
+	require.NoError(t, err)
+
+	h := NewBackupHandler(db, service.NewEndpointStore(repository.NewModelRepository(db), providerRepo, zap.NewNop()))
+	r := gin.New()
+	r.GET("/api/config/backup/export", h.Export)
+	r.POST("/api/config/backup/import", h.Import)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/config/backup/export", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w2 := httptest.NewRecorder()
+	r.ServeHTTP(w2, httptest.NewRequest(http.MethodPost, "/api/config/backup/import?sections=providers", bytes.NewReader(w.Body.Bytes())))
+	require.Equal(t, http.StatusOK, w2.Code, w2.Body.String())
+
+	providers, err := providerRepo.FindAll(ctx)
+	require.NoError(t, err)
+	var restored *models.Provider
+	for _, p := range providers {
+		if p.Name == "retrying" {
+			restored = p
+		}
+	}
+	require.NotNil(t, restored)
+	assert.Equal(t, rules, restored.RetryRules)
+}
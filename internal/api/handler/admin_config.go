@@ -1,10 +1,16 @@
 package handler
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/internal/service"
 )
 
 // RoutingUpdate represents a routing configuration update.
@@ -30,9 +36,49 @@ type UIConfigUpdate struct {
 	LogsRefreshSeconds      *int `json:"logs_refresh_seconds"`
 }
 
+// LogRetentionConfigUpdate represents a log retention configuration update.
+type LogRetentionConfigUpdate struct {
+	RetentionDays *int `json:"retention_days" binding:"required"`
+}
+
+// AnthropicVersionConfigUpdate represents an anthropic-version policy update.
+type AnthropicVersionConfigUpdate struct {
+	PinnedVersion   *string   `json:"pinned_version"`
+	DefaultVersion  *string   `json:"default_version"`
+	AllowedVersions *[]string `json:"allowed_versions"`
+}
+
+// HealthWebhookConfigUpdate represents a health webhook configuration update.
+type HealthWebhookConfigUpdate struct {
+	URL    *string `json:"url"`
+	Secret *string `json:"secret"`
+}
+
+// MaintenanceConfigUpdate represents a maintenance mode update.
+type MaintenanceConfigUpdate struct {
+	Enabled           *bool   `json:"enabled" binding:"required"`
+	Message           *string `json:"message"`
+	RetryAfterSeconds *int    `json:"retry_after_seconds"`
+}
+
+// anthropicVersionRe matches anthropic-version values such as 2023-06-01.
+var anthropicVersionRe = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// maxLogRetentionDays bounds the configurable request log retention window.
+const maxLogRetentionDays = 3650
+
+// maxMaintenanceRetryAfter bounds the Retry-After sent during maintenance.
+const maxMaintenanceRetryAfter = 86400
+
+// reloadDrainTimeout bounds how long ReloadConfig waits for removed
+// endpoints to finish their in-flight requests.
+const reloadDrainTimeout = 30 * time.Second
+
 // ConfigHandler handles system configuration API endpoints.
 type ConfigHandler struct {
-	repo *repository.SystemConfigRepository
+	repo          *repository.SystemConfigRepository
+	endpointStore *service.EndpointStore
+	maintenance   *service.MaintenanceMode
 }
 
 // NewConfigHandler creates a new ConfigHandler.
@@ -40,6 +86,17 @@ func NewConfigHandler(repo *repository.SystemConfigRepository) *ConfigHandler {
 	return &ConfigHandler{repo: repo}
 }
 
+// SetEndpointStore lets ReloadConfig reload endpoints.
+func (h *ConfigHandler) SetEndpointStore(s *service.EndpointStore) {
+	h.endpointStore = s
+}
+
+// SetMaintenanceMode sets the maintenance mode refreshed after an update, so
+// the change takes effect on this worker immediately.
+func (h *ConfigHandler) SetMaintenanceMode(m *service.MaintenanceMode) {
+	h.maintenance = m
+}
+
 // GetRoutingConfig returns the current routing configuration.
 func (h *ConfigHandler) GetRoutingConfig(c *gin.Context) {
 	cfg, err := h.repo.GetRoutingConfig(c.Request.Context())
@@ -84,7 +141,8 @@ func (h *ConfigHandler) UpdateLoadBalanceConfig(c *gin.Context) {
 	if strategy, ok := req["strategy"].(string); ok {
 		valid := map[string]bool{
 			"round_robin": true, "weighted": true,
-			"least_connections": true, "conversation_hash": true,
+			"least_connections": true, "weighted_least_connections": true,
+			"conversation_hash": true, "least_cost": true,
 		}
 		if !valid[strategy] {
 			errorResponse(c, http.StatusBadRequest, "invalid strategy")
@@ -145,9 +203,192 @@ func (h *ConfigHandler) UpdateUIConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "UI config updated"})
 }
 
-// ReloadConfig reloads the configuration.
-func ReloadConfig(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "Config reloaded"})
+// GetLogRetentionConfig returns the request log retention configuration.
+func (h *ConfigHandler) GetLogRetentionConfig(c *gin.Context) {
+	cfg, err := h.repo.GetLogRetentionConfig(c.Request.Context())
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, cfg)
+}
+
+// UpdateLogRetentionConfig updates the request log retention window.
+// retention_days = 0 keeps logs forever.
+func (h *ConfigHandler) UpdateLogRetentionConfig(c *gin.Context) {
+	var req LogRetentionConfigUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if *req.RetentionDays < 0 || *req.RetentionDays > maxLogRetentionDays {
+		errorResponse(c, http.StatusBadRequest, fmt.Sprintf("retention_days must be between 0 and %d", maxLogRetentionDays))
+		return
+	}
+	updates := map[string]any{"retention_days": *req.RetentionDays}
+	if err := h.repo.UpdateLogRetentionConfig(c.Request.Context(), updates); err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Log retention config updated"})
+}
+
+// GetAnthropicVersionConfig returns the anthropic-version header policy.
+func (h *ConfigHandler) GetAnthropicVersionConfig(c *gin.Context) {
+	cfg, err := h.repo.GetAnthropicVersionConfig(c.Request.Context())
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if cfg.AllowedVersions == nil {
+		cfg.AllowedVersions = []string{}
+	}
+	c.JSON(http.StatusOK, cfg)
+}
+
+// UpdateAnthropicVersionConfig updates the anthropic-version header policy.
+// An empty pinned_version or allowed_versions turns that rule off.
+func (h *ConfigHandler) UpdateAnthropicVersionConfig(c *gin.Context) {
+	var req AnthropicVersionConfigUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	updates := map[string]any{}
+	if req.PinnedVersion != nil {
+		if *req.PinnedVersion != "" && !anthropicVersionRe.MatchString(*req.PinnedVersion) {
+			errorResponse(c, http.StatusBadRequest, "pinned_version must look like 2023-06-01")
+			return
+		}
+		updates["pinned_version"] = *req.PinnedVersion
+	}
+	if req.DefaultVersion != nil {
+		if !anthropicVersionRe.MatchString(*req.DefaultVersion) {
+			errorResponse(c, http.StatusBadRequest, "default_version must look like 2023-06-01")
+			return
+		}
+		updates["default_version"] = *req.DefaultVersion
+	}
+	if req.AllowedVersions != nil {
+		for _, v := range *req.AllowedVersions {
+			if !anthropicVersionRe.MatchString(v) {
+				errorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid allowed version %q", v))
+				return
+			}
+		}
+		allowed, _ := json.Marshal(*req.AllowedVersions)
+		updates["allowed_versions"] = string(allowed)
+	}
+	if err := h.repo.UpdateAnthropicVersionConfig(c.Request.Context(), updates); err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Anthropic version config updated"})
+}
+
+// GetHealthWebhookConfig returns the health webhook settings. The secret is
+// never returned, only whether one is set.
+func (h *ConfigHandler) GetHealthWebhookConfig(c *gin.Context) {
+	cfg, err := h.repo.GetHealthWebhookConfig(c.Request.Context())
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": cfg.URL, "secret_set": cfg.Secret != ""})
+}
+
+// UpdateHealthWebhookConfig updates the health webhook settings. An empty
+// url turns notifications off and an empty secret sends them unsigned; an
+// omitted secret keeps the current one.
+func (h *ConfigHandler) UpdateHealthWebhookConfig(c *gin.Context) {
+	var req HealthWebhookConfigUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	updates := map[string]any{}
+	if req.URL != nil {
+		if *req.URL != "" {
+			u, err := url.Parse(*req.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errorResponse(c, http.StatusBadRequest, "url must be an http or https URL")
+				return
+			}
+		}
+		updates["url"] = *req.URL
+	}
+	if req.Secret != nil {
+		updates["secret"] = *req.Secret
+	}
+	if err := h.repo.UpdateHealthWebhookConfig(c.Request.Context(), updates); err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Health webhook config updated"})
+}
+
+// GetMaintenanceConfig returns the maintenance mode settings.
+func (h *ConfigHandler) GetMaintenanceConfig(c *gin.Context) {
+	cfg, err := h.repo.GetMaintenanceConfig(c.Request.Context())
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, cfg)
+}
+
+// SetMaintenanceConfig turns maintenance mode on or off. While it is on,
+// proxy requests are answered with 503 and the admin API keeps working.
+// An omitted message or retry_after_seconds keeps the current one.
+func (h *ConfigHandler) SetMaintenanceConfig(c *gin.Context) {
+	var req MaintenanceConfigUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	updates := map[string]any{"enabled": *req.Enabled}
+	if req.Message != nil {
+		updates["message"] = *req.Message
+	}
+	if req.RetryAfterSeconds != nil {
+		if *req.RetryAfterSeconds < 0 || *req.RetryAfterSeconds > maxMaintenanceRetryAfter {
+			errorResponse(c, http.StatusBadRequest, fmt.Sprintf("retry_after_seconds must be between 0 and %d", maxMaintenanceRetryAfter))
+			return
+		}
+		updates["retry_after_seconds"] = *req.RetryAfterSeconds
+	}
+	if err := h.repo.UpdateMaintenanceConfig(c.Request.Context(), updates); err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.maintenance.Invalidate()
+	h.maintenance.Status()
+
+	cfg, err := h.repo.GetMaintenanceConfig(c.Request.Context())
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, cfg)
+}
+
+// ReloadConfig reloads endpoints from the database. Endpoints that were
+// removed finish their in-flight requests first; it waits up to
+// reloadDrainTimeout for them and reports those still draining.
+func (h *ConfigHandler) ReloadConfig(c *gin.Context) {
+	if h.endpointStore == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Config reloaded"})
+		return
+	}
+	draining, err := h.endpointStore.ReloadAndDrain(c.Request.Context(), reloadDrainTimeout)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if draining == nil {
+		draining = map[string]int{}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Config reloaded", "draining": draining})
 }
 
 // MigrateConfig handles config migration (stub).
@@ -21,6 +21,15 @@ type ModelCreate struct {
 	SupportsThinking  bool    `json:"supports_thinking"`
 	Enabled           bool    `json:"enabled"`
 	Weight            int     `json:"weight"`
+
+	MaxThinkingTokens     int `json:"max_thinking_tokens" binding:"min=0"`
+	DefaultThinkingTokens int `json:"default_thinking_tokens" binding:"min=0"`
+
+	// Omitted cache multipliers default to Anthropic's pricing.
+	CacheWriteMultiplier *float64 `json:"cache_write_multiplier" binding:"omitempty,min=0"`
+	CacheReadMultiplier  *float64 `json:"cache_read_multiplier" binding:"omitempty,min=0"`
+
+	TimeoutSeconds int `json:"timeout_seconds" binding:"min=0"`
 }
 
 // ModelUpdate represents a model update request.
@@ -33,18 +42,34 @@ type ModelUpdate struct {
 	SupportsThinking  *bool    `json:"supports_thinking"`
 	Enabled           *bool    `json:"enabled"`
 	Weight            *int     `json:"weight"`
+
+	MaxThinkingTokens     *int `json:"max_thinking_tokens" binding:"omitempty,min=0"`
+	DefaultThinkingTokens *int `json:"default_thinking_tokens" binding:"omitempty,min=0"`
+
+	CacheWriteMultiplier *float64 `json:"cache_write_multiplier" binding:"omitempty,min=0"`
+	CacheReadMultiplier  *float64 `json:"cache_read_multiplier" binding:"omitempty,min=0"`
+
+	TimeoutSeconds *int `json:"timeout_seconds" binding:"omitempty,min=0"`
 }
 
 // ModelHandler handles model management API endpoints.
 type ModelHandler struct {
 	repo          *repository.SQLModelRepository
 	endpointStore *service.EndpointStore
+	roles         *service.RoleSet
 }
 
 // NewModelHandler creates a new ModelHandler.
 func NewModelHandler(repo *repository.SQLModelRepository, endpointStore *service.EndpointStore) *ModelHandler {
 	return &ModelHandler{repo: repo, endpointStore: endpointStore}
 }
+
+// SetRoleSet sets the roles a model's role is checked against (nil means the
+// builtin roles only).
+func (h *ModelHandler) SetRoleSet(rs *service.RoleSet) {
+	h.roles = rs
+}
+
 // ListModels returns all models.
 func (h *ModelHandler) ListModels(c *gin.Context) {
 	list, err := h.repo.FindAll(c.Request.Context())
@@ -84,6 +109,10 @@ func (h *ModelHandler) CreateModel(c *gin.Context) {
 		errorResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
+	if err := h.roles.Validate(req.Role); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
 	m := &models.Model{
 		Name:              req.Name,
 		Role:              models.ModelRole(req.Role),
@@ -93,6 +122,20 @@ func (h *ModelHandler) CreateModel(c *gin.Context) {
 		SupportsThinking:  req.SupportsThinking,
 		Enabled:           req.Enabled,
 		Weight:            req.Weight,
+
+		MaxThinkingTokens:     req.MaxThinkingTokens,
+		DefaultThinkingTokens: req.DefaultThinkingTokens,
+
+		CacheWriteMultiplier: models.DefaultCacheWriteMultiplier,
+		CacheReadMultiplier:  models.DefaultCacheReadMultiplier,
+
+		TimeoutSeconds: req.TimeoutSeconds,
+	}
+	if req.CacheWriteMultiplier != nil {
+		m.CacheWriteMultiplier = *req.CacheWriteMultiplier
+	}
+	if req.CacheReadMultiplier != nil {
+		m.CacheReadMultiplier = *req.CacheReadMultiplier
 	}
 	id, err := h.repo.Insert(c.Request.Context(), m)
 	if err != nil {
@@ -115,6 +158,12 @@ func (h *ModelHandler) UpdateModel(c *gin.Context) {
 		errorResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
+	if req.Role != nil {
+		if err := h.roles.Validate(*req.Role); err != nil {
+			errorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
 	updates := make(map[string]any)
 	if req.Name != nil { updates["name"] = *req.Name }
 	if req.Role != nil { updates["role"] = *req.Role }
@@ -124,6 +173,11 @@ func (h *ModelHandler) UpdateModel(c *gin.Context) {
 	if req.SupportsThinking != nil { updates["supports_thinking"] = *req.SupportsThinking }
 	if req.Enabled != nil { updates["enabled"] = *req.Enabled }
 	if req.Weight != nil { updates["weight"] = *req.Weight }
+	if req.MaxThinkingTokens != nil { updates["max_thinking_tokens"] = *req.MaxThinkingTokens }
+	if req.DefaultThinkingTokens != nil { updates["default_thinking_tokens"] = *req.DefaultThinkingTokens }
+	if req.CacheWriteMultiplier != nil { updates["cache_write_multiplier"] = *req.CacheWriteMultiplier }
+	if req.CacheReadMultiplier != nil { updates["cache_read_multiplier"] = *req.CacheReadMultiplier }
+	if req.TimeoutSeconds != nil { updates["timeout_seconds"] = *req.TimeoutSeconds }
 	if err := h.repo.Update(c.Request.Context(), id, updates); err != nil {
 		errorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -2,7 +2,9 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -20,30 +22,115 @@ func maskAPIKey(apiKey string) string {
 	return apiKey[:4] + "****...****" + apiKey[len(apiKey)-4:]
 }
 
+// DuplicateProviderGroup lists providers that point at the same upstream
+// account (same base URL and API key). Each one counts separately in load
+// balancing, so a duplicate silently multiplies the account's effective weight.
+type DuplicateProviderGroup struct {
+	BaseURL   string   `json:"base_url"`
+	APIKey    string   `json:"api_key"`
+	Providers []string `json:"providers"`
+}
+
+// providerIdentity normalizes the (base URL, API key) pair that identifies an
+// upstream account, ignoring case and trailing slashes in the URL.
+func providerIdentity(baseURL, apiKey string) string {
+	u := strings.ToLower(strings.TrimRight(strings.TrimSpace(baseURL), "/"))
+	return u + "\x00" + strings.TrimSpace(apiKey)
+}
+
+// findDuplicateProviders groups providers sharing the same base URL and API key.
+// Groups are returned in order of first appearance; API keys are masked.
+func findDuplicateProviders(providers []*models.Provider) []DuplicateProviderGroup {
+	index := make(map[string]int)
+	var groups []DuplicateProviderGroup
+	for _, p := range providers {
+		key := providerIdentity(p.BaseURL, p.APIKey)
+		if i, ok := index[key]; ok {
+			groups[i].Providers = append(groups[i].Providers, p.Name)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, DuplicateProviderGroup{
+			BaseURL:   p.BaseURL,
+			APIKey:    maskAPIKey(p.APIKey),
+			Providers: []string{p.Name},
+		})
+	}
+
+	result := make([]DuplicateProviderGroup, 0)
+	for _, g := range groups {
+		if len(g.Providers) > 1 {
+			result = append(result, g)
+		}
+	}
+	return result
+}
+
+// duplicateProviderWarnings renders duplicate groups as human-readable warnings.
+func duplicateProviderWarnings(groups []DuplicateProviderGroup) []string {
+	warnings := make([]string, 0, len(groups))
+	for _, g := range groups {
+		warnings = append(warnings, fmt.Sprintf(
+			"providers %s share the same base_url and api_key (%s); each one adds to the upstream's effective weight",
+			strings.Join(g.Providers, ", "), g.BaseURL))
+	}
+	return warnings
+}
+
 // ProviderCreate represents a provider creation request.
 type ProviderCreate struct {
-	Name          string            `json:"name" binding:"required"`
-	BaseURL       string            `json:"base_url" binding:"required"`
-	APIKey        string            `json:"api_key" binding:"required"`
-	Weight        int               `json:"weight"`
-	MaxConcurrent int               `json:"max_concurrent"`
-	Enabled       bool              `json:"enabled"`
-	Description   string            `json:"description"`
-	ModelIDs      []int64           `json:"model_ids"`
-	CustomHeaders map[string]string `json:"custom_headers"`
+	Name              string                   `json:"name" binding:"required"`
+	BaseURL           string                   `json:"base_url" binding:"required"`
+	APIKey            string                   `json:"api_key" binding:"required"`
+	Weight            int                      `json:"weight"`
+	MaxConcurrent     int                      `json:"max_concurrent"`
+	Priority          int                      `json:"priority"`
+	RPMLimit          int                      `json:"rpm_limit"`
+	TPMLimit          int                      `json:"tpm_limit"`
+	Enabled           bool                     `json:"enabled"`
+	Description       string                   `json:"description"`
+	ModelIDs          []int64                  `json:"model_ids"`
+	CustomHeaders     map[string]string        `json:"custom_headers"`
+	RetryRules        []models.RetryRule       `json:"retry_rules"`
+	HealthCheckMethod models.HealthCheckMethod `json:"health_check_method"`
+	HealthCheckPath   string                   `json:"health_check_path"`
+	AuthScheme        models.AuthScheme        `json:"auth_scheme"`
+	AuthHeader        string                   `json:"auth_header"`
+	TimeoutSeconds    int                      `json:"timeout_seconds" binding:"min=0"`
+	StreamOnly        bool                     `json:"stream_only"`
+	AnthropicVersion  string                   `json:"anthropic_version"`
+	APIPathPrefix     string                   `json:"api_path_prefix"`
+	CostMultiplier    *float64                 `json:"cost_multiplier" binding:"omitempty,gt=0"` // Defaults to 1 (list price)
+	Shadow            bool                     `json:"shadow"`
+	ShadowSampleRate  float64                  `json:"shadow_sample_rate" binding:"min=0,max=1"`
 }
 
 // ProviderUpdate represents a provider update request.
 type ProviderUpdate struct {
-	Name          *string            `json:"name"`
-	BaseURL       *string            `json:"base_url"`
-	APIKey        *string            `json:"api_key"`
-	Weight        *int               `json:"weight"`
-	MaxConcurrent *int               `json:"max_concurrent"`
-	Enabled       *bool              `json:"enabled"`
-	Description   *string            `json:"description"`
-	ModelIDs      []int64            `json:"model_ids"`
-	CustomHeaders *map[string]string `json:"custom_headers"`
+	Name              *string                   `json:"name"`
+	BaseURL           *string                   `json:"base_url"`
+	APIKey            *string                   `json:"api_key"`
+	Weight            *int                      `json:"weight"`
+	MaxConcurrent     *int                      `json:"max_concurrent"`
+	Priority          *int                      `json:"priority"`
+	RPMLimit          *int                      `json:"rpm_limit"`
+	TPMLimit          *int                      `json:"tpm_limit"`
+	Enabled           *bool                     `json:"enabled"`
+	Description       *string                   `json:"description"`
+	ModelIDs          []int64                   `json:"model_ids"`
+	CustomHeaders     *map[string]string        `json:"custom_headers"`
+	RetryRules        *[]models.RetryRule       `json:"retry_rules"`
+	HealthCheckMethod *models.HealthCheckMethod `json:"health_check_method"`
+	HealthCheckPath   *string                   `json:"health_check_path"`
+	AuthScheme        *models.AuthScheme        `json:"auth_scheme"`
+	AuthHeader        *string                   `json:"auth_header"`
+	TimeoutSeconds    *int                      `json:"timeout_seconds" binding:"omitempty,min=0"`
+	StreamOnly        *bool                     `json:"stream_only"`
+	AnthropicVersion  *string                   `json:"anthropic_version"`
+	APIPathPrefix     *string                   `json:"api_path_prefix"`
+	CostMultiplier    *float64                  `json:"cost_multiplier" binding:"omitempty,gt=0"`
+	Shadow            *bool                     `json:"shadow"`
+	ShadowSampleRate  *float64                  `json:"shadow_sample_rate" binding:"omitempty,min=0,max=1"`
 }
 
 // DetectModelsRequest represents a model detection request.
@@ -145,22 +232,75 @@ func (h *ProviderHandler) CreateProvider(c *gin.Context) {
 		errorResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
+	if err := service.ValidateRetryRules(req.RetryRules); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.HealthCheckMethod == "" {
+		req.HealthCheckMethod = models.HealthCheckGet
+	}
+	if !req.HealthCheckMethod.IsValid() {
+		errorResponse(c, http.StatusBadRequest, "health_check_method must be one of get, messages, passive, tcp")
+		return
+	}
+	if req.AuthScheme == "" {
+		req.AuthScheme = models.AuthSchemeAnthropic
+	}
+	if msg := validateAuthScheme(req.AuthScheme, req.AuthHeader); msg != "" {
+		errorResponse(c, http.StatusBadRequest, msg)
+		return
+	}
+	if req.AnthropicVersion != "" && !anthropicVersionRe.MatchString(req.AnthropicVersion) {
+		errorResponse(c, http.StatusBadRequest, "anthropic_version must look like 2023-06-01")
+		return
+	}
+	if msg := validateAPIPathPrefix(req.APIPathPrefix); msg != "" {
+		errorResponse(c, http.StatusBadRequest, msg)
+		return
+	}
 	p := &models.Provider{
-		Name:          req.Name,
-		BaseURL:       req.BaseURL,
-		APIKey:        req.APIKey,
-		Weight:        req.Weight,
-		MaxConcurrent: req.MaxConcurrent,
-		Enabled:       req.Enabled,
-		Description:   req.Description,
-		CustomHeaders: req.CustomHeaders,
+		Name:              req.Name,
+		BaseURL:           req.BaseURL,
+		APIKey:            req.APIKey,
+		Weight:            req.Weight,
+		MaxConcurrent:     req.MaxConcurrent,
+		Priority:          req.Priority,
+		RPMLimit:          req.RPMLimit,
+		TPMLimit:          req.TPMLimit,
+		Enabled:           req.Enabled,
+		Description:       req.Description,
+		CustomHeaders:     req.CustomHeaders,
+		RetryRules:        req.RetryRules,
+		HealthCheckMethod: req.HealthCheckMethod,
+		HealthCheckPath:   req.HealthCheckPath,
+		AuthScheme:        req.AuthScheme,
+		AuthHeader:        req.AuthHeader,
+		TimeoutSeconds:    req.TimeoutSeconds,
+		StreamOnly:        req.StreamOnly,
+		AnthropicVersion:  req.AnthropicVersion,
+		APIPathPrefix:     req.APIPathPrefix,
+		CostMultiplier:    1,
+		Shadow:            req.Shadow,
+		ShadowSampleRate:  req.ShadowSampleRate,
+	}
+	if req.CostMultiplier != nil {
+		p.CostMultiplier = *req.CostMultiplier
+	}
+	existing, err := h.providerRepo.FindAll(c.Request.Context())
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
 	}
 	id, err := h.providerRepo.Insert(c.Request.Context(), p, req.ModelIDs)
 	if err != nil {
 		errorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"id": id, "message": "Provider created"})
+	resp := gin.H{"id": id, "message": "Provider created"}
+	if dups := findDuplicateProviders(append(existing, p)); len(dups) > 0 {
+		resp["warnings"] = duplicateProviderWarnings(dups)
+	}
+	c.JSON(http.StatusOK, resp)
 	go h.endpointStore.ReloadAndNotify(context.Background())
 }
 
@@ -176,22 +316,139 @@ func (h *ProviderHandler) UpdateProvider(c *gin.Context) {
 		errorResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
+	if req.RetryRules != nil {
+		if err := service.ValidateRetryRules(*req.RetryRules); err != nil {
+			errorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.HealthCheckMethod != nil && !req.HealthCheckMethod.IsValid() {
+		errorResponse(c, http.StatusBadRequest, "health_check_method must be one of get, messages, passive, tcp")
+		return
+	}
+	if req.AnthropicVersion != nil && *req.AnthropicVersion != "" && !anthropicVersionRe.MatchString(*req.AnthropicVersion) {
+		errorResponse(c, http.StatusBadRequest, "anthropic_version must look like 2023-06-01")
+		return
+	}
+	if req.APIPathPrefix != nil {
+		if msg := validateAPIPathPrefix(*req.APIPathPrefix); msg != "" {
+			errorResponse(c, http.StatusBadRequest, msg)
+			return
+		}
+	}
+	if req.AuthScheme != nil || req.AuthHeader != nil {
+		// Validate the scheme and header as they will be stored, filling in
+		// whichever of the two the update leaves unchanged.
+		existing, err := h.providerRepo.FindByID(c.Request.Context(), id)
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if existing == nil {
+			errorResponse(c, http.StatusNotFound, "Provider not found")
+			return
+		}
+		scheme, header := existing.AuthScheme, existing.AuthHeader
+		if req.AuthScheme != nil {
+			scheme = *req.AuthScheme
+		}
+		if req.AuthHeader != nil {
+			header = *req.AuthHeader
+		}
+		if msg := validateAuthScheme(scheme, header); msg != "" {
+			errorResponse(c, http.StatusBadRequest, msg)
+			return
+		}
+	}
 	updates := make(map[string]any)
 	if req.Name != nil { updates["name"] = *req.Name }
 	if req.BaseURL != nil { updates["base_url"] = *req.BaseURL }
 	if req.APIKey != nil { updates["api_key"] = *req.APIKey }
 	if req.Weight != nil { updates["weight"] = *req.Weight }
 	if req.MaxConcurrent != nil { updates["max_concurrent"] = *req.MaxConcurrent }
+	if req.Priority != nil { updates["priority"] = *req.Priority }
+	if req.RPMLimit != nil { updates["rpm_limit"] = *req.RPMLimit }
+	if req.TPMLimit != nil { updates["tpm_limit"] = *req.TPMLimit }
 	if req.Enabled != nil { updates["enabled"] = *req.Enabled }
 	if req.Description != nil { updates["description"] = *req.Description }
 	if req.CustomHeaders != nil { updates["custom_headers"] = *req.CustomHeaders }
+	if req.RetryRules != nil { updates["retry_rules"] = *req.RetryRules }
+	if req.HealthCheckMethod != nil { updates["health_check_method"] = string(*req.HealthCheckMethod) }
+	if req.HealthCheckPath != nil { updates["health_check_path"] = *req.HealthCheckPath }
+	if req.AuthScheme != nil { updates["auth_scheme"] = string(*req.AuthScheme) }
+	if req.AuthHeader != nil { updates["auth_header"] = *req.AuthHeader }
+	if req.TimeoutSeconds != nil { updates["timeout_seconds"] = *req.TimeoutSeconds }
+	if req.StreamOnly != nil { updates["stream_only"] = *req.StreamOnly }
+	if req.AnthropicVersion != nil { updates["anthropic_version"] = *req.AnthropicVersion }
+	if req.APIPathPrefix != nil { updates["api_path_prefix"] = *req.APIPathPrefix }
+	if req.CostMultiplier != nil { updates["cost_multiplier"] = *req.CostMultiplier }
+	if req.Shadow != nil { updates["shadow"] = *req.Shadow }
+	if req.ShadowSampleRate != nil { updates["shadow_sample_rate"] = *req.ShadowSampleRate }
 	if err := h.providerRepo.Update(c.Request.Context(), id, updates, req.ModelIDs); err != nil {
 		errorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"id": id, "message": "Provider updated"})
+	resp := gin.H{"id": id, "message": "Provider updated"}
+	if req.BaseURL != nil || req.APIKey != nil {
+		// Warn, as on create, if the provider now duplicates another account.
+		all, err := h.providerRepo.FindAll(c.Request.Context())
+		if err != nil {
+			errorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if warnings := providerDuplicateWarnings(all, id); len(warnings) > 0 {
+			resp["warnings"] = warnings
+		}
+	}
+	c.JSON(http.StatusOK, resp)
 	go h.endpointStore.ReloadAndNotify(context.Background())
 }
+
+// providerDuplicateWarnings returns the duplicate warnings for the group the
+// provider with the given ID belongs to, if any.
+func providerDuplicateWarnings(providers []*models.Provider, id int64) []string {
+	var name string
+	for _, p := range providers {
+		if p.ID == id {
+			name = p.Name
+		}
+	}
+	for _, g := range findDuplicateProviders(providers) {
+		if slices.Contains(g.Providers, name) {
+			return duplicateProviderWarnings([]DuplicateProviderGroup{g})
+		}
+	}
+	return nil
+}
+// validateAuthScheme checks a provider's upstream auth settings and returns
+// an error message, or "" when they are valid.
+func validateAuthScheme(scheme models.AuthScheme, header string) string {
+	if !scheme.IsValid() {
+		return "auth_scheme must be one of anthropic, bearer, custom_header"
+	}
+	if scheme == models.AuthSchemeCustomHeader {
+		if header == "" {
+			return "auth_header is required for the custom_header auth scheme"
+		}
+		if strings.ContainsAny(header, " \t\r\n:") {
+			return "auth_header must be a valid header name"
+		}
+	}
+	return ""
+}
+
+// validateAPIPathPrefix checks a provider's API path prefix and returns an
+// error message, or "" when it is valid. Empty means the default /v1.
+func validateAPIPathPrefix(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	if !strings.HasPrefix(prefix, "/") || strings.ContainsAny(prefix, "?# \t\r\n") {
+		return "api_path_prefix must be a URL path starting with /"
+	}
+	return ""
+}
+
 // DeleteProvider deletes a provider.
 func (h *ProviderHandler) DeleteProvider(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("provider_id"), 10, 64)
@@ -207,6 +464,22 @@ func (h *ProviderHandler) DeleteProvider(c *gin.Context) {
 	go h.endpointStore.ReloadAndNotify(context.Background())
 }
 
+// ValidateConfig runs configuration diagnostics. Currently it reports providers
+// that duplicate the same upstream account under different names.
+func (h *ProviderHandler) ValidateConfig(c *gin.Context) {
+	providers, err := h.providerRepo.FindAll(c.Request.Context())
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	dups := findDuplicateProviders(providers)
+	c.JSON(http.StatusOK, gin.H{
+		"valid":               len(dups) == 0,
+		"duplicate_providers": dups,
+		"warnings":            duplicateProviderWarnings(dups),
+	})
+}
+
 // GetProviderModels returns models associated with a provider.
 func (h *ProviderHandler) GetProviderModels(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("provider_id"), 10, 64)
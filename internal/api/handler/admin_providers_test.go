@@ -0,0 +1,164 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/internal/service"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+func newTestProviderHandler(t *testing.T) *ProviderHandler {
+	t.Helper()
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	providerRepo := repository.NewProviderRepository(db)
+	modelRepo := repository.NewModelRepository(db)
+	store := service.NewEndpointStore(modelRepo, providerRepo, zap.NewNop())
+	return NewProviderHandler(providerRepo, modelRepo, service.NewModelDetector(zap.NewNop()), store)
+}
+
+func TestProviderHandler_CreateProvider_DuplicateWarning(t *testing.T) {
+	h := newTestProviderHandler(t)
+
+	// Unique account: no warning.
+	c, w := testutil.NewTestContextWithRequest(http.MethodPost, "/api/config/providers", ProviderCreate{
+		Name: "openai", BaseURL: "https://api.openai.com", APIKey: "sk-openai", Weight: 1, Enabled: true,
+	})
+	h.CreateProvider(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.NotContains(t, resp, "warnings")
+
+	// Same base URL (modulo trailing slash) and key under a new name.
+	c, w = testutil.NewTestContextWithRequest(http.MethodPost, "/api/config/providers", ProviderCreate{
+		Name: "openai-copy", BaseURL: "https://api.openai.com/", APIKey: "sk-openai", Weight: 1, Enabled: true,
+	})
+	h.CreateProvider(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	resp = nil
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Contains(t, resp, "warnings")
+	warnings := resp["warnings"].([]any)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "openai, openai-copy")
+
+	// Updating a provider onto another's account warns too.
+	c, w = testutil.NewTestContextWithRequest(http.MethodPost, "/api/config/providers", ProviderCreate{
+		Name: "other", BaseURL: "https://other.example.com", APIKey: "sk-other", Weight: 1, Enabled: true,
+	})
+	h.CreateProvider(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	update := func(body ProviderUpdate) map[string]any {
+		c, w := testutil.NewTestContextWithRequest(http.MethodPut, "/api/config/providers/x", body)
+		c.Params = []gin.Param{{Key: "provider_id", Value: strconv.FormatInt(created.ID, 10)}}
+		h.UpdateProvider(c)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+	desc := "unrelated change"
+	assert.NotContains(t, update(ProviderUpdate{Description: &desc}), "warnings")
+	baseURL, key := "https://api.openai.com", "sk-openai"
+	resp = update(ProviderUpdate{BaseURL: &baseURL, APIKey: &key})
+	require.Contains(t, resp, "warnings")
+	assert.Contains(t, resp["warnings"].([]any)[0], "openai, openai-copy, other")
+}
+
+func TestProviderHandler_AuthScheme(t *testing.T) {
+	h := newTestProviderHandler(t)
+
+	// custom_header needs a header name.
+	c, w := testutil.NewTestContextWithRequest(http.MethodPost, "/api/config/providers", ProviderCreate{
+		Name: "gateway", BaseURL: "https://gw.example.com", APIKey: "sk-gw", Weight: 1, Enabled: true,
+		AuthScheme: models.AuthSchemeCustomHeader,
+	})
+	h.CreateProvider(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	c, w = testutil.NewTestContextWithRequest(http.MethodPost, "/api/config/providers", ProviderCreate{
+		Name: "gateway", BaseURL: "https://gw.example.com", APIKey: "sk-gw", Weight: 1, Enabled: true,
+		AuthScheme: "basic",
+	})
+	h.CreateProvider(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	c, w = testutil.NewTestContextWithRequest(http.MethodPost, "/api/config/providers", ProviderCreate{
+		Name: "gateway", BaseURL: "https://gw.example.com", APIKey: "sk-gw", Weight: 1, Enabled: true,
+		AuthScheme: models.AuthSchemeBearer,
+	})
+	h.CreateProvider(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	p, err := h.providerRepo.FindByID(c.Request.Context(), created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.AuthSchemeBearer, p.AuthScheme)
+
+	// Switching to custom_header is validated against the stored header.
+	update := func(body ProviderUpdate) int {
+		c, w := testutil.NewTestContextWithRequest(http.MethodPut, "/api/config/providers/x", body)
+		c.Params = []gin.Param{{Key: "provider_id", Value: strconv.FormatInt(created.ID, 10)}}
+		h.UpdateProvider(c)
+		return w.Code
+	}
+	custom := models.AuthSchemeCustomHeader
+	assert.Equal(t, http.StatusBadRequest, update(ProviderUpdate{AuthScheme: &custom}))
+	header := "api-key"
+	assert.Equal(t, http.StatusOK, update(ProviderUpdate{AuthScheme: &custom, AuthHeader: &header}))
+	p, err = h.providerRepo.FindByID(c.Request.Context(), created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.AuthSchemeCustomHeader, p.AuthScheme)
+	assert.Equal(t, "api-key", p.AuthHeader)
+	empty := ""
+	assert.Equal(t, http.StatusBadRequest, update(ProviderUpdate{AuthHeader: &empty}))
+}
+
+func TestProviderHandler_ValidateConfig(t *testing.T) {
+	h := newTestProviderHandler(t)
+
+	c, w := testutil.NewTestContextWithRequest(http.MethodGet, "/api/config/validate", nil)
+	h.ValidateConfig(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Valid              bool                     `json:"valid"`
+		DuplicateProviders []DuplicateProviderGroup `json:"duplicate_providers"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Valid)
+	assert.Empty(t, resp.DuplicateProviders)
+
+	// Seeded providers share a base URL but use different keys; add a true duplicate.
+	_, err := h.providerRepo.Insert(c.Request.Context(), &models.Provider{
+		Name: "anthropic-dup", BaseURL: "https://API.anthropic.com", APIKey: "sk-ant-test-key-1", Weight: 1, Enabled: true,
+	}, nil)
+	require.NoError(t, err)
+
+	c, w = testutil.NewTestContextWithRequest(http.MethodGet, "/api/config/validate", nil)
+	h.ValidateConfig(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.Valid)
+	require.Len(t, resp.DuplicateProviders, 1)
+	assert.Equal(t, []string{"anthropic-primary", "anthropic-dup"}, resp.DuplicateProviders[0].Providers)
+	assert.NotContains(t, resp.DuplicateProviders[0].APIKey, "test-key-1")
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/internal/service"
+)
+
+// roleNamePattern limits role names to what routing models and headers can
+// echo back unambiguously.
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// ModelRoleCreate represents a role creation request.
+type ModelRoleCreate struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// ModelRoleUpdate represents a role update request.
+type ModelRoleUpdate struct {
+	Description string `json:"description"`
+}
+
+// RoleHandler handles task-type role management API endpoints.
+type RoleHandler struct {
+	repo  *repository.ModelRoleRepository
+	roles *service.RoleSet
+}
+
+// NewRoleHandler creates a new RoleHandler. roles is reloaded after every
+// change.
+func NewRoleHandler(repo *repository.ModelRoleRepository, roles *service.RoleSet) *RoleHandler {
+	return &RoleHandler{repo: repo, roles: roles}
+}
+
+// ListRoles returns all roles, builtin roles first.
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.repo.List(c.Request.Context())
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// CreateRole adds a custom role.
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req ModelRoleCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !roleNamePattern.MatchString(req.Name) {
+		errorResponse(c, http.StatusBadRequest, "name must be 1-32 lowercase letters, digits, '-' or '_', starting with a letter")
+		return
+	}
+	role := &models.ModelRoleDefinition{Name: models.ModelRole(req.Name), Description: req.Description}
+	if err := h.repo.Create(c.Request.Context(), role); err != nil {
+		if errors.Is(err, repository.ErrModelRoleExists) {
+			errorResponse(c, http.StatusConflict, err.Error())
+			return
+		}
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.roles.Invalidate()
+	c.JSON(http.StatusOK, gin.H{"name": req.Name, "message": "Role created"})
+}
+
+// UpdateRole changes a role's description.
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	var req ModelRoleUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.repo.UpdateDescription(c.Request.Context(), c.Param("name"), req.Description); err != nil {
+		if errors.Is(err, repository.ErrModelRoleNotFound) {
+			errorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.roles.Invalidate()
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated"})
+}
+
+// DeleteRole removes a custom role no model or routing rule uses.
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	if err := h.repo.Delete(c.Request.Context(), c.Param("name")); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrModelRoleNotFound):
+			errorResponse(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, repository.ErrModelRoleBuiltin), errors.Is(err, repository.ErrModelRoleInUse):
+			errorResponse(c, http.StatusConflict, err.Error())
+		default:
+			errorResponse(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	h.roles.Invalidate()
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
@@ -0,0 +1,65 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/internal/service"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+func TestRoleHandler_CustomRoleLifecycle(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	roleRepo := repository.NewModelRoleRepository(db)
+	roles := service.NewRoleSet(roleRepo, zap.NewNop())
+	h := NewRoleHandler(roleRepo, roles)
+
+	modelRepo := repository.NewModelRepository(db)
+	modelHandler := NewModelHandler(modelRepo, service.NewEndpointStore(modelRepo, repository.NewProviderRepository(db), zap.NewNop()))
+	modelHandler.SetRoleSet(roles)
+
+	createModel := func(role string) int {
+		c, w := testutil.NewTestContextWithRequest(http.MethodPost, "/api/config/models", ModelCreate{Name: "claude-" + role, Role: role, Enabled: true})
+		modelHandler.CreateModel(c)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusBadRequest, createModel("vision"), "unknown roles are rejected")
+
+	c, w := testutil.NewTestContextWithRequest(http.MethodPost, "/api/config/roles", ModelRoleCreate{Name: "Vision!"})
+	h.CreateRole(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	c, w = testutil.NewTestContextWithRequest(http.MethodPost, "/api/config/roles", ModelRoleCreate{Name: "vision", Description: "images"})
+	h.CreateRole(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	c, w = testutil.NewTestContextWithRequest(http.MethodPost, "/api/config/roles", ModelRoleCreate{Name: "vision"})
+	h.CreateRole(c)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	assert.Equal(t, http.StatusOK, createModel("vision"), "a new role is usable at once")
+
+	c, w = testutil.NewTestContext()
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/config/roles", nil)
+	h.ListRoles(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"vision","description":"images","builtin":false`)
+
+	deleteRole := func(name string) int {
+		c, w := testutil.NewTestContext()
+		c.Request, _ = http.NewRequest(http.MethodDelete, "/api/config/roles/"+name, nil)
+		c.Params = []gin.Param{{Key: "name", Value: name}}
+		h.DeleteRole(c)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusConflict, deleteRole("vision"), "still used by a model")
+	assert.Equal(t, http.StatusConflict, deleteRole("default"))
+	assert.Equal(t, http.StatusNotFound, deleteRole("audio"))
+}
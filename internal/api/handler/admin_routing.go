@@ -1,12 +1,15 @@
 package handler
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/user/llm-proxy-go/internal/models"
 	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/internal/service"
 )
 
 // RoutingModelCreate represents a routing model creation request.
@@ -35,30 +38,36 @@ type RoutingModelUpdate struct {
 
 // LLMRoutingConfigUpdate represents an LLM routing configuration update.
 type LLMRoutingConfigUpdate struct {
-	Enabled                 *bool    `json:"enabled"`
-	PrimaryModelID          *int64   `json:"primary_model_id"`
-	FallbackModelID         *int64   `json:"fallback_model_id"`
-	TimeoutSeconds          *int     `json:"timeout_seconds"`
-	CacheEnabled            *bool    `json:"cache_enabled"`
-	CacheTTLSeconds         *int     `json:"cache_ttl_seconds"`
-	CacheTTLL3Seconds       *int     `json:"cache_ttl_l3_seconds"`
-	MaxTokens               *int     `json:"max_tokens"`
-	Temperature             *float64 `json:"temperature"`
-	RetryCount              *int     `json:"retry_count"`
-	SemanticCacheEnabled    *bool    `json:"semantic_cache_enabled"`
-	EmbeddingModelID        *int64   `json:"embedding_model_id"`
-	SimilarityThreshold     *float64 `json:"similarity_threshold"`
-	LocalEmbeddingModel     *string  `json:"local_embedding_model"`
-	ForceSmartRouting       *bool    `json:"force_smart_routing"`
-	RuleBasedRoutingEnabled *bool    `json:"rule_based_routing_enabled"`
-	RuleFallbackStrategy    *string  `json:"rule_fallback_strategy"`
-	RuleFallbackTaskType    *string  `json:"rule_fallback_task_type"`
+	Enabled                 *bool     `json:"enabled"`
+	PrimaryModelID          *int64    `json:"primary_model_id"`
+	FallbackModelID         *int64    `json:"fallback_model_id"`
+	TimeoutSeconds          *int      `json:"timeout_seconds"`
+	CacheEnabled            *bool     `json:"cache_enabled"`
+	CacheTTLSeconds         *int      `json:"cache_ttl_seconds"`
+	CacheTTLL3Seconds       *int      `json:"cache_ttl_l3_seconds"`
+	CacheMaxSize            *int      `json:"cache_max_size"`
+	MaxTokens               *int      `json:"max_tokens"`
+	Temperature             *float64  `json:"temperature"`
+	RetryCount              *int      `json:"retry_count"`
+	SemanticCacheEnabled    *bool     `json:"semantic_cache_enabled"`
+	EmbeddingModelID        *int64    `json:"embedding_model_id"`
+	SimilarityThreshold     *float64  `json:"similarity_threshold"`
+	LocalEmbeddingModel     *string   `json:"local_embedding_model"`
+	ForceSmartRouting       *bool     `json:"force_smart_routing"`
+	RuleBasedRoutingEnabled *bool     `json:"rule_based_routing_enabled"`
+	RuleFallbackStrategy    *string   `json:"rule_fallback_strategy"`
+	RuleFallbackTaskType    *string   `json:"rule_fallback_task_type"`
+	MaxOutputTokens         *int      `json:"max_output_tokens"`
+	RoutingTriggerModels    *[]string `json:"routing_trigger_models"`
+	RoleFallbackChain       *[]string `json:"role_fallback_chain"`
 }
 
 // RoutingHandler handles routing model and LLM config API endpoints.
 type RoutingHandler struct {
-	modelRepo  *repository.RoutingModelRepository
-	configRepo *repository.RoutingConfigRepository
+	modelRepo    *repository.RoutingModelRepository
+	configRepo   *repository.RoutingConfigRepository
+	routingCache *service.RoutingCache
+	roles        *service.RoleSet
 }
 
 // NewRoutingHandler creates a new RoutingHandler.
@@ -66,6 +75,17 @@ func NewRoutingHandler(modelRepo *repository.RoutingModelRepository, configRepo
 	return &RoutingHandler{modelRepo: modelRepo, configRepo: configRepo}
 }
 
+// SetRoutingCache sets the L1 routing cache resized when cache_max_size changes.
+func (h *RoutingHandler) SetRoutingCache(rc *service.RoutingCache) {
+	h.routingCache = rc
+}
+
+// SetRoleSet sets the roles rule_fallback_task_type and role_fallback_chain
+// are checked against (nil means the builtin roles only).
+func (h *RoutingHandler) SetRoleSet(rs *service.RoleSet) {
+	h.roles = rs
+}
+
 // ListRoutingModels returns all routing models.
 func (h *RoutingHandler) ListRoutingModels(c *gin.Context) {
 	var providerID *int64
@@ -188,6 +208,56 @@ func (h *RoutingHandler) UpdateLLMRoutingConfig(c *gin.Context) {
 		errorResponse(c, http.StatusBadRequest, err.Error())
 		return
 	}
+	if req.CacheMaxSize != nil && *req.CacheMaxSize <= 0 {
+		errorResponse(c, http.StatusBadRequest, "cache_max_size must be positive")
+		return
+	}
+	if req.MaxOutputTokens != nil && *req.MaxOutputTokens < 0 {
+		errorResponse(c, http.StatusBadRequest, "max_output_tokens must not be negative")
+		return
+	}
+	if req.RuleFallbackTaskType != nil && *req.RuleFallbackTaskType != "" {
+		if err := h.roles.Validate(*req.RuleFallbackTaskType); err != nil {
+			errorResponse(c, http.StatusBadRequest, "rule_fallback_task_type: "+err.Error())
+			return
+		}
+	}
+	var triggerModelsJSON string
+	if req.RoutingTriggerModels != nil {
+		for _, name := range *req.RoutingTriggerModels {
+			if strings.TrimSpace(name) == "" {
+				errorResponse(c, http.StatusBadRequest, "routing_trigger_models must not contain empty names")
+				return
+			}
+		}
+		b, err := json.Marshal(*req.RoutingTriggerModels)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		triggerModelsJSON = string(b)
+	}
+	var fallbackChainJSON string
+	if req.RoleFallbackChain != nil {
+		seen := make(map[string]bool, len(*req.RoleFallbackChain))
+		for _, role := range *req.RoleFallbackChain {
+			if err := h.roles.Validate(role); err != nil {
+				errorResponse(c, http.StatusBadRequest, "role_fallback_chain: "+err.Error())
+				return
+			}
+			if seen[role] {
+				errorResponse(c, http.StatusBadRequest, "role_fallback_chain must not repeat a role: "+role)
+				return
+			}
+			seen[role] = true
+		}
+		b, err := json.Marshal(*req.RoleFallbackChain)
+		if err != nil {
+			errorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		fallbackChainJSON = string(b)
+	}
 	updates := make(map[string]any)
 	if req.Enabled != nil { updates["enabled"] = *req.Enabled }
 	if req.PrimaryModelID != nil { updates["primary_model_id"] = *req.PrimaryModelID }
@@ -196,6 +266,7 @@ func (h *RoutingHandler) UpdateLLMRoutingConfig(c *gin.Context) {
 	if req.CacheEnabled != nil { updates["cache_enabled"] = *req.CacheEnabled }
 	if req.CacheTTLSeconds != nil { updates["cache_ttl_seconds"] = *req.CacheTTLSeconds }
 	if req.CacheTTLL3Seconds != nil { updates["cache_ttl_l3_seconds"] = *req.CacheTTLL3Seconds }
+	if req.CacheMaxSize != nil { updates["cache_max_size"] = *req.CacheMaxSize }
 	if req.MaxTokens != nil { updates["max_tokens"] = *req.MaxTokens }
 	if req.Temperature != nil { updates["temperature"] = *req.Temperature }
 	if req.RetryCount != nil { updates["retry_count"] = *req.RetryCount }
@@ -207,9 +278,15 @@ func (h *RoutingHandler) UpdateLLMRoutingConfig(c *gin.Context) {
 	if req.RuleBasedRoutingEnabled != nil { updates["rule_based_routing_enabled"] = *req.RuleBasedRoutingEnabled }
 	if req.RuleFallbackStrategy != nil { updates["rule_fallback_strategy"] = *req.RuleFallbackStrategy }
 	if req.RuleFallbackTaskType != nil { updates["rule_fallback_task_type"] = *req.RuleFallbackTaskType }
+	if req.MaxOutputTokens != nil { updates["max_output_tokens"] = *req.MaxOutputTokens }
+	if req.RoutingTriggerModels != nil { updates["routing_trigger_models"] = triggerModelsJSON }
+	if req.RoleFallbackChain != nil { updates["role_fallback_chain"] = fallbackChainJSON }
 	if err := h.configRepo.UpdateConfig(c.Request.Context(), updates); err != nil {
 		errorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if req.CacheMaxSize != nil && h.routingCache != nil {
+		h.routingCache.Resize(*req.CacheMaxSize)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "LLM routing config updated"})
 }
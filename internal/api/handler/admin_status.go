@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -21,11 +22,17 @@ type HealthResponse struct {
 
 // StatusResponse represents the system status response.
 type StatusResponse struct {
-	UptimeSeconds int64               `json:"uptime_seconds"`
-	TotalRequests int64               `json:"total_requests"`
-	TotalErrors   int64               `json:"total_errors"`
-	Models        []ModelInfo         `json:"models"`
-	Endpoints     []EndpointStateInfo `json:"endpoints"`
+	UptimeSeconds  int64                           `json:"uptime_seconds"`
+	TotalRequests  int64                           `json:"total_requests"`
+	TotalErrors    int64                           `json:"total_errors"`
+	Models         []ModelInfo                     `json:"models"`
+	Endpoints      []EndpointStateInfo             `json:"endpoints"`
+	PolicyBlocks   int64                           `json:"policy_blocks"`
+	ProviderUsage  []service.ProviderUsageSnapshot `json:"provider_usage"`
+	RoutingLatency []service.RoutingLayerLatency   `json:"routing_latency"`
+	RetryBudget    service.RetryBudgetSnapshot     `json:"retry_budget"`
+	Concurrency    service.ConcurrencySnapshot     `json:"concurrency"`
+	ProbeBudget    service.ProbeBudgetSnapshot     `json:"probe_budget"`
 }
 
 // ModelInfo represents model information in status response.
@@ -39,13 +46,19 @@ type ModelInfo struct {
 
 // EndpointStateInfo represents endpoint state information.
 type EndpointStateInfo struct {
-	Name              string  `json:"name"`
-	Status            string  `json:"status"`
-	TotalRequests     int64   `json:"total_requests"`
-	TotalErrors       int64   `json:"total_errors"`
-	CurrentConns      int     `json:"current_connections"`
-	AvgResponseTimeMs float64 `json:"avg_response_time_ms"`
-	LastCheckTime     string  `json:"last_check_time,omitempty"`
+	Name                string  `json:"name"`
+	Status              string  `json:"status"`
+	TotalRequests       int64   `json:"total_requests"`
+	TotalErrors         int64   `json:"total_errors"`
+	CurrentConns        int     `json:"current_connections"`
+	AvgResponseTimeMs   float64 `json:"avg_response_time_ms"`
+	LastCheckTime       string  `json:"last_check_time,omitempty"`
+	CircuitState        string  `json:"circuit_state"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	CircuitTrips        int     `json:"circuit_trips"`
+	BaseWeight          int     `json:"base_weight"`
+	SuccessRateFactor   float64 `json:"success_rate_factor"`
+	EffectiveWeight     float64 `json:"effective_weight"`
 }
 // RoutingDebugResponse represents routing debug information.
 type RoutingDebugResponse struct {
@@ -80,6 +93,10 @@ type StatusHandler struct {
 	logRepo       repository.RequestLogRepository
 	llmRouter     *service.LLMRouter
 	endpointStore *service.EndpointStore
+	contentPolicy *service.ContentPolicy
+	retryBudget   *service.RetryBudget
+	concurrency   *service.ConcurrencyLimiter
+	loadBalancer  *service.LoadBalancer
 }
 
 // NewStatusHandler creates a new StatusHandler.
@@ -98,10 +115,40 @@ func NewStatusHandler(
 		endpointStore: endpointStore,
 	}
 }
+
+// SetContentPolicy sets the content policy whose block count is reported.
+func (h *StatusHandler) SetContentPolicy(p *service.ContentPolicy) {
+	h.contentPolicy = p
+}
+
+// SetRetryBudget sets the retry budget whose spend is reported.
+func (h *StatusHandler) SetRetryBudget(b *service.RetryBudget) {
+	h.retryBudget = b
+}
+
+// SetConcurrencyLimiter sets the limiter whose in-flight requests are
+// reported.
+func (h *StatusHandler) SetConcurrencyLimiter(l *service.ConcurrencyLimiter) {
+	h.concurrency = l
+}
+
+// SetLoadBalancer sets the load balancer whose effective endpoint weights
+// are reported.
+func (h *StatusHandler) SetLoadBalancer(lb *service.LoadBalancer) {
+	h.loadBalancer = lb
+}
+
 // GetSystemStatus returns detailed system status.
 func (h *StatusHandler) GetSystemStatus(c *gin.Context) {
 	states := h.healthChecker.GetAllStates()
 
+	endpointsByName := make(map[string]*models.Endpoint)
+	if h.endpointStore != nil {
+		for _, ep := range h.endpointStore.GetEndpoints() {
+			endpointsByName[service.EndpointName(ep)] = ep
+		}
+	}
+
 	// Query historical stats from database
 	var dbStats map[string]*repository.EndpointModelStats
 	if h.logRepo != nil {
@@ -121,10 +168,21 @@ func (h *StatusHandler) GetSystemStatus(c *gin.Context) {
 		}
 
 		epInfo := EndpointStateInfo{
-			Name:          name,
-			Status:        string(s.Status),
-			CurrentConns:  s.CurrentConnections,
-			LastCheckTime: lastCheck,
+			Name:                name,
+			Status:              string(s.Status),
+			CurrentConns:        s.CurrentConnections,
+			LastCheckTime:       lastCheck,
+			CircuitState:        string(s.CircuitState),
+			ConsecutiveFailures: s.ConsecutiveFailures,
+			CircuitTrips:        s.CircuitTrips,
+			SuccessRateFactor:   1,
+		}
+		if ep := endpointsByName[name]; ep != nil && ep.Provider != nil {
+			epInfo.BaseWeight = ep.Provider.Weight
+			if h.loadBalancer != nil {
+				epInfo.SuccessRateFactor = h.loadBalancer.SuccessRateFactor(ep)
+			}
+			epInfo.EffectiveWeight = float64(epInfo.BaseWeight) * epInfo.SuccessRateFactor
 		}
 
 		// Use DB stats for historical data, memory for real-time
@@ -143,9 +201,15 @@ func (h *StatusHandler) GetSystemStatus(c *gin.Context) {
 		epInfos = append(epInfos, epInfo)
 	}
 
-	// Build model info from endpoints
+	// Build model info and provider rate limit usage from endpoints
 	modelMap := make(map[string]*ModelInfo)
+	providerUsage := make([]service.ProviderUsageSnapshot, 0)
+	seenProviders := make(map[int64]bool)
 	for _, ep := range h.endpointStore.GetEndpoints() {
+		if !seenProviders[ep.Provider.ID] {
+			seenProviders[ep.Provider.ID] = true
+			providerUsage = append(providerUsage, h.healthChecker.ProviderUsage(ep.Provider))
+		}
 		name := ep.Model.Name
 		mi, ok := modelMap[name]
 		if !ok {
@@ -175,13 +239,22 @@ func (h *StatusHandler) GetSystemStatus(c *gin.Context) {
 	sort.Slice(epInfos, func(i, j int) bool {
 		return epInfos[i].Name < epInfos[j].Name
 	})
+	sort.Slice(providerUsage, func(i, j int) bool {
+		return providerUsage[i].Provider < providerUsage[j].Provider
+	})
 
 	c.JSON(http.StatusOK, StatusResponse{
-		UptimeSeconds: int64(time.Since(startTime).Seconds()),
-		TotalRequests: totalReqs,
-		TotalErrors:   totalErrs,
-		Models:        modelInfos,
-		Endpoints:     epInfos,
+		UptimeSeconds:  int64(time.Since(startTime).Seconds()),
+		TotalRequests:  totalReqs,
+		TotalErrors:    totalErrs,
+		Models:         modelInfos,
+		Endpoints:      epInfos,
+		PolicyBlocks:   h.contentPolicy.BlockedCount(),
+		ProviderUsage:  providerUsage,
+		RoutingLatency: h.llmRouter.LatencyStats(),
+		RetryBudget:    h.retryBudget.Snapshot(),
+		Concurrency:    h.concurrency.Snapshot(),
+		ProbeBudget:    h.healthChecker.ProbeBudget().Snapshot(),
 	})
 }
 
@@ -268,6 +341,25 @@ func (h *StatusHandler) TestRouting(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+// TraceRouting runs the routing pipeline as a dry run for a full request and
+// returns every layer's outcome. The routing LLM is only called when
+// ?call_llm=true; otherwise the prompt it would receive is returned.
+func (h *StatusHandler) TraceRouting(c *gin.Context) {
+	var req models.AnthropicRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	callLLM, _ := strconv.ParseBool(c.Query("call_llm"))
+
+	trace, err := h.llmRouter.Trace(c.Request.Context(), &req, callLLM)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, trace)
+}
+
 // TriggerHealthCheck immediately executes a health check.
 func (h *StatusHandler) TriggerHealthCheck(c *gin.Context) {
 	h.healthChecker.CheckNow()
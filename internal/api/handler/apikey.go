@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -14,7 +16,9 @@ import (
 
 // APIKeyHandler handles API key management endpoints.
 type APIKeyHandler struct {
-	keyRepo repository.APIKeyRepository
+	keyRepo     repository.APIKeyRepository
+	authService *service.AuthService            // API keys it caches are invalidated on change; nil = none
+	logRepo     repository.RequestLogRepository // Source of per-key usage stats; nil = unavailable
 }
 
 // NewAPIKeyHandler creates a new APIKeyHandler.
@@ -22,6 +26,17 @@ func NewAPIKeyHandler(keyRepo repository.APIKeyRepository) *APIKeyHandler {
 	return &APIKeyHandler{keyRepo: keyRepo}
 }
 
+// SetAuthService sets the AuthService whose cached API keys are dropped
+// when a key is updated, revoked, toggled or deleted.
+func (h *APIKeyHandler) SetAuthService(a *service.AuthService) {
+	h.authService = a
+}
+
+// SetLogRepo sets the request log repository GetAPIKeyStats aggregates.
+func (h *APIKeyHandler) SetLogRepo(r repository.RequestLogRepository) {
+	h.logRepo = r
+}
+
 // ListAPIKeys lists API keys.
 // GET /api/keys
 func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
@@ -46,6 +61,10 @@ func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
 		return
 	}
 
+	now := time.Now()
+	for _, k := range keys {
+		k.Expired = k.IsExpired(now)
+	}
 	c.JSON(http.StatusOK, keys)
 }
 
@@ -76,9 +95,65 @@ func (h *APIKeyHandler) GetAPIKey(c *gin.Context) {
 		return
 	}
 
+	key.Expired = key.IsExpired(time.Now())
 	c.JSON(http.StatusOK, key)
 }
 
+// GetAPIKeyStats returns an API key's request count, cost, token totals,
+// success rate and model distribution, optionally limited to a time range.
+// GET /api/keys/:id/stats?start_time=...&end_time=...
+func (h *APIKeyHandler) GetAPIKeyStats(c *gin.Context) {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		errorResponse(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+	if h.logRepo == nil {
+		errorResponse(c, http.StatusServiceUnavailable, "Usage statistics are not available")
+		return
+	}
+
+	keyID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "Invalid key ID")
+		return
+	}
+
+	key, err := h.keyRepo.FindByID(c.Request.Context(), keyID)
+	if err != nil {
+		errorResponse(c, http.StatusNotFound, "API key not found")
+		return
+	}
+
+	// Check permission: users can only see their own keys
+	if currentUser.Role != string(models.UserRoleAdmin) && key.UserID != currentUser.UserID {
+		errorResponse(c, http.StatusForbidden, "No permission to view this API key")
+		return
+	}
+
+	var startTime, endTime *time.Time
+	if st := c.Query("start_time"); st != "" {
+		if t, err := time.Parse(time.RFC3339, st); err == nil {
+			startTime = &t
+		}
+	}
+	if et := c.Query("end_time"); et != "" {
+		if t, err := time.Parse(time.RFC3339, et); err == nil {
+			endTime = &t
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), logQueryTimeout)
+	defer cancel()
+
+	stats, err := h.logRepo.GetAPIKeyStatistics(ctx, keyID, startTime, endTime)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, "Failed to retrieve API key statistics")
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
 // CreateAPIKey creates a new API key.
 // POST /api/keys
 func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
@@ -92,6 +167,9 @@ func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
 		Name        string     `json:"name" binding:"required,max=100"`
 		ExpiresDays *int       `json:"expires_days"`
 		ExpiresAt   *time.Time `json:"expires_at"`
+		// AllowedModels restricts the models the key may request; empty allows all.
+		AllowedModels   []string `json:"allowed_models"`
+		RateLimitPerMin int      `json:"rate_limit_per_min" binding:"min=0"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -120,6 +198,9 @@ func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
 		IsActive:  true,
 		CreatedAt: time.Now().UTC(),
 		ExpiresAt: expiresAt,
+
+		AllowedModels:   req.AllowedModels,
+		RateLimitPerMin: req.RateLimitPerMin,
 	}
 
 	id, err := h.keyRepo.Insert(c.Request.Context(), key)
@@ -135,9 +216,132 @@ func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
 		"key_prefix": keyPrefix,
 		"name":       key.Name,
 		"expires_at": expiresAt,
+
+		"allowed_models":     key.AllowedModels,
+		"rate_limit_per_min": key.RateLimitPerMin,
 	})
 }
 
+// UpdateAPIKey updates the model allowlist and rate limit of an API key.
+// The restrictions are admin-only so owners cannot lift them.
+// PUT /api/keys/:id (admin only)
+func (h *APIKeyHandler) UpdateAPIKey(c *gin.Context) {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		errorResponse(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	keyID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "Invalid key ID")
+		return
+	}
+
+	var req struct {
+		AllowedModels   []string `json:"allowed_models"`
+		RateLimitPerMin int      `json:"rate_limit_per_min" binding:"min=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	key, err := h.keyRepo.FindByID(c.Request.Context(), keyID)
+	if err != nil {
+		errorResponse(c, http.StatusNotFound, "API key not found")
+		return
+	}
+
+	if err := h.keyRepo.UpdateRestrictions(c.Request.Context(), keyID, nil, req.AllowedModels, req.RateLimitPerMin); err != nil {
+		errorResponse(c, http.StatusInternalServerError, "Failed to update API key")
+		return
+	}
+	h.authService.InvalidateAPIKeys()
+
+	key.AllowedModels = req.AllowedModels
+	key.RateLimitPerMin = req.RateLimitPerMin
+	c.JSON(http.StatusOK, key)
+}
+
+// maxBulkAPIKeys caps how many keys a single bulk request may create.
+const maxBulkAPIKeys = 100
+
+// BulkCreateAPIKeys creates several API keys with the same settings in one
+// transaction. The full secrets are only returned in this response.
+// POST /api/keys/bulk
+func (h *APIKeyHandler) BulkCreateAPIKeys(c *gin.Context) {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		errorResponse(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	var req struct {
+		Count           int        `json:"count" binding:"required,min=1"`
+		NamePrefix      string     `json:"name_prefix" binding:"required,max=90"`
+		ExpiresDays     *int       `json:"expires_days"`
+		ExpiresAt       *time.Time `json:"expires_at"`
+		AllowedModels   []string   `json:"allowed_models"`
+		RateLimitPerMin int        `json:"rate_limit_per_min" binding:"min=0"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Count > maxBulkAPIKeys {
+		errorResponse(c, http.StatusBadRequest, fmt.Sprintf("count must not exceed %d", maxBulkAPIKeys))
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		expiresAt = req.ExpiresAt
+	} else if req.ExpiresDays != nil && *req.ExpiresDays > 0 {
+		exp := time.Now().UTC().AddDate(0, 0, *req.ExpiresDays)
+		expiresAt = &exp
+	}
+
+	now := time.Now().UTC()
+	keys := make([]*models.APIKey, req.Count)
+	for i := range keys {
+		fullKey, keyHash, keyPrefix := service.GenerateAPIKey()
+		keys[i] = &models.APIKey{
+			UserID:          currentUser.UserID,
+			KeyHash:         keyHash,
+			KeyFull:         fullKey,
+			KeyPrefix:       keyPrefix,
+			Name:            fmt.Sprintf("%s-%d", req.NamePrefix, i+1),
+			IsActive:        true,
+			CreatedAt:       now,
+			ExpiresAt:       expiresAt,
+			AllowedModels:   req.AllowedModels,
+			RateLimitPerMin: req.RateLimitPerMin,
+		}
+	}
+
+	if err := h.keyRepo.InsertBatch(c.Request.Context(), keys); err != nil {
+		errorResponse(c, http.StatusInternalServerError, "Failed to create API keys")
+		return
+	}
+
+	created := make([]gin.H, len(keys))
+	for i, key := range keys {
+		created[i] = gin.H{
+			"id":         key.ID,
+			"key":        key.KeyFull,
+			"key_prefix": key.KeyPrefix,
+			"name":       key.Name,
+			"expires_at": key.ExpiresAt,
+
+			"allowed_models":     key.AllowedModels,
+			"rate_limit_per_min": key.RateLimitPerMin,
+		}
+	}
+	c.JSON(http.StatusCreated, gin.H{"keys": created})
+}
+
 // RevokeAPIKey revokes (disables) an API key.
 // POST /api/keys/:id/revoke
 func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
@@ -174,6 +378,7 @@ func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
 		errorResponse(c, http.StatusInternalServerError, "Failed to revoke API key")
 		return
 	}
+	h.authService.InvalidateAPIKeys()
 
 	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
 }
@@ -215,6 +420,7 @@ func (h *APIKeyHandler) ToggleAPIKey(c *gin.Context) {
 		errorResponse(c, http.StatusInternalServerError, "Failed to toggle API key")
 		return
 	}
+	h.authService.InvalidateAPIKeys()
 
 	c.JSON(http.StatusOK, gin.H{"message": "OK", "is_active": newActive})
 }
@@ -255,6 +461,7 @@ func (h *APIKeyHandler) DeleteAPIKey(c *gin.Context) {
 		errorResponse(c, http.StatusInternalServerError, "Failed to delete API key")
 		return
 	}
+	h.authService.InvalidateAPIKeys()
 
 	c.JSON(http.StatusOK, gin.H{"message": "API key deleted"})
 }
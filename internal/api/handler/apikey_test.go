@@ -6,6 +6,7 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -18,6 +19,7 @@ import (
 	"github.com/user/llm-proxy-go/internal/repository"
 	"github.com/user/llm-proxy-go/internal/service"
 	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
 )
 
 func TestAPIKeyHandler_ListAPIKeys_Admin(t *testing.T) {
@@ -90,6 +92,50 @@ func TestAPIKeyHandler_ListAPIKeys_Admin(t *testing.T) {
 	assert.Len(t, keys, 2)
 }
 
+func TestAPIKeyHandler_ListAPIKeys_Expired(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	keyRepo := repository.NewAPIKeyRepository(db)
+	userRepo := repository.NewUserRepository(db)
+
+	ctx := context.Background()
+	userID, err := userRepo.Insert(ctx, &models.User{
+		Username:     "testuser",
+		PasswordHash: "$2a$10$hashedpassword",
+		Role:         models.UserRoleUser,
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	for name, expiresAt := range map[string]*time.Time{"past": &past, "future": &future, "never": nil} {
+		_, err = keyRepo.Insert(ctx, &models.APIKey{
+			UserID:    userID,
+			KeyHash:   "hash_" + name,
+			KeyPrefix: "sk-" + name,
+			Name:      name,
+			IsActive:  true,
+			ExpiresAt: expiresAt,
+		})
+		require.NoError(t, err)
+	}
+
+	handler := NewAPIKeyHandler(keyRepo)
+	c, w := testutil.NewTestContext()
+	c.Request = httptest.NewRequest("GET", "/api/keys", nil)
+	c.Set("current_user", &service.CurrentUser{UserID: userID, Username: "testuser", Role: "user"})
+
+	handler.ListAPIKeys(c)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var keys []*models.APIKey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+	require.Len(t, keys, 3)
+	for _, k := range keys {
+		assert.Equal(t, k.Name == "past", k.Expired, k.Name)
+	}
+}
+
 func TestAPIKeyHandler_ListAPIKeys_User(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	keyRepo := repository.NewAPIKeyRepository(db)
@@ -416,6 +462,87 @@ func TestAPIKeyHandler_CreateAPIKey_InvalidRequest(t *testing.T) {
 	assert.Contains(t, resp["detail"], "Name")
 }
 
+func TestAPIKeyHandler_BulkCreateAPIKeys(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	keyRepo := repository.NewAPIKeyRepository(db)
+	userRepo := repository.NewUserRepository(db)
+
+	ctx := context.Background()
+	adminID, err := userRepo.Insert(ctx, &models.User{
+		Username:     "admin",
+		PasswordHash: "$2a$10$hashedpassword",
+		Role:         models.UserRoleAdmin,
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+
+	handler := NewAPIKeyHandler(keyRepo)
+
+	reqBody := map[string]any{
+		"count":              5,
+		"name_prefix":        "team-a",
+		"expires_days":       30,
+		"allowed_models":     []string{"claude-haiku"},
+		"rate_limit_per_min": 60,
+	}
+	c, w := testutil.NewTestContextWithRequest("POST", "/api/keys/bulk", reqBody)
+	c.Set("current_user", &service.CurrentUser{
+		UserID:   adminID,
+		Username: "admin",
+		Role:     "admin",
+	})
+
+	handler.BulkCreateAPIKeys(c)
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var resp struct {
+		Keys []struct {
+			ID   int64  `json:"id"`
+			Key  string `json:"key"`
+			Name string `json:"name"`
+		} `json:"keys"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Keys, 5)
+
+	secrets := make(map[string]bool)
+	for i, created := range resp.Keys {
+		assert.Equal(t, fmt.Sprintf("team-a-%d", i+1), created.Name)
+		assert.NotEmpty(t, created.Key)
+		secrets[created.Key] = true
+
+		key, err := keyRepo.FindByID(ctx, created.ID)
+		require.NoError(t, err)
+		assert.Equal(t, adminID, key.UserID)
+		assert.Equal(t, created.Name, key.Name)
+		assert.Equal(t, created.Key, key.KeyFull)
+		assert.Equal(t, service.HashAPIKey(created.Key), key.KeyHash)
+		assert.Equal(t, []string{"claude-haiku"}, key.AllowedModels)
+		assert.Equal(t, 60, key.RateLimitPerMin)
+		assert.NotNil(t, key.ExpiresAt)
+		assert.True(t, key.IsActive)
+	}
+	assert.Len(t, secrets, 5, "each key must have a unique secret")
+}
+
+func TestAPIKeyHandler_BulkCreateAPIKeys_TooMany(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	keyRepo := repository.NewAPIKeyRepository(db)
+	handler := NewAPIKeyHandler(keyRepo)
+
+	reqBody := map[string]any{"count": maxBulkAPIKeys + 1, "name_prefix": "team-a"}
+	c, w := testutil.NewTestContextWithRequest("POST", "/api/keys/bulk", reqBody)
+	c.Set("current_user", &service.CurrentUser{UserID: 1, Username: "admin", Role: "admin"})
+
+	handler.BulkCreateAPIKeys(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	keys, err := keyRepo.FindAll(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
 func TestAPIKeyHandler_DeleteAPIKey_Success(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	keyRepo := repository.NewAPIKeyRepository(db)
@@ -468,6 +595,41 @@ func TestAPIKeyHandler_DeleteAPIKey_Success(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestAPIKeyHandler_ToggleAPIKey_InvalidatesCache(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	keyRepo := repository.NewAPIKeyRepository(db)
+	userRepo := repository.NewUserRepository(db)
+	authService := service.NewAuthService(keyRepo, userRepo, repository.NewSessionRepository(db, testutil.NewTestLogger()), testutil.NewTestLogger())
+	authService.SetAPIKeyCacheTTL(time.Hour)
+
+	ctx := context.Background()
+	userID, err := userRepo.Insert(ctx, &models.User{
+		Username:     "testuser",
+		PasswordHash: "$2a$10$hashedpassword",
+		Role:         models.UserRoleUser,
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+	fullKey, keyHash, keyPrefix := service.GenerateAPIKey()
+	keyID, err := keyRepo.Insert(ctx, &models.APIKey{UserID: userID, KeyHash: keyHash, KeyPrefix: keyPrefix, Name: "Test Key", IsActive: true})
+	require.NoError(t, err)
+	_, err = authService.ValidateAPIKey(ctx, fullKey)
+	require.NoError(t, err)
+
+	handler := NewAPIKeyHandler(keyRepo)
+	handler.SetAuthService(authService)
+	c, w := testutil.NewTestContext()
+	c.Request = httptest.NewRequest("POST", fmt.Sprintf("/api/keys/%d/toggle", keyID), nil)
+	c.Params = []gin.Param{{Key: "id", Value: fmt.Sprint(keyID)}}
+	c.Set("current_user", &service.CurrentUser{UserID: userID, Username: "testuser", Role: "user"})
+	handler.ToggleAPIKey(c)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// The disabled key is rejected at once despite the cached lookup.
+	_, err = authService.ValidateAPIKey(ctx, fullKey)
+	assert.ErrorContains(t, err, "inactive")
+}
+
 func TestAPIKeyHandler_DeleteAPIKey_NotFound(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	keyRepo := repository.NewAPIKeyRepository(db)
@@ -626,3 +788,68 @@ func TestAPIKeyHandler_CopyAPIKey_Forbidden(t *testing.T) {
 
 	assert.Contains(t, resp["detail"], "permission")
 }
+
+func TestAPIKeyHandler_GetAPIKeyStats(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	keyRepo := repository.NewAPIKeyRepository(db)
+	userRepo := repository.NewUserRepository(db)
+	logRepo := repository.NewRequestLogRepositoryImpl(db, zap.NewNop())
+
+	ctx := context.Background()
+	ownerID, err := userRepo.Insert(ctx, &models.User{
+		Username:     "owner",
+		PasswordHash: "$2a$10$hashedpassword",
+		Role:         models.UserRoleUser,
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+	otherUserID, err := userRepo.Insert(ctx, &models.User{
+		Username:     "otheruser",
+		PasswordHash: "$2a$10$hashedpassword",
+		Role:         models.UserRoleUser,
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+
+	keyID, err := keyRepo.Insert(ctx, &models.APIKey{
+		UserID:    ownerID,
+		KeyHash:   "hash_owner_key",
+		KeyFull:   "sk-owner-full-key",
+		KeyPrefix: "sk-owner",
+		Name:      "Owner Key",
+		IsActive:  true,
+		CreatedAt: time.Now().UTC(),
+	})
+	require.NoError(t, err)
+	_, err = logRepo.Insert(ctx, &models.RequestLogEntry{
+		RequestID: "req_1", UserID: ownerID, APIKeyID: &keyID, ModelName: "claude-sonnet-4",
+		EndpointName: "ep1", InputTokens: 100, OutputTokens: 20, Cost: 0.01, Success: true,
+	})
+	require.NoError(t, err)
+
+	handler := NewAPIKeyHandler(keyRepo)
+	handler.SetLogRepo(logRepo)
+	getStats := func(user *service.CurrentUser) *httptest.ResponseRecorder {
+		c, w := testutil.NewTestContext()
+		c.Request = httptest.NewRequest("GET", fmt.Sprintf("/api/keys/%d/stats", keyID), nil)
+		c.Params = []gin.Param{{Key: "id", Value: fmt.Sprint(keyID)}}
+		c.Set("current_user", user)
+		handler.GetAPIKeyStats(c)
+		return w
+	}
+
+	w := getStats(&service.CurrentUser{UserID: ownerID, Username: "owner", Role: "user"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var stats repository.APIKeyStatistics
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, int64(1), stats.TotalRequests)
+	assert.Equal(t, int64(100), stats.TotalInputTokens)
+	require.Len(t, stats.ByModel, 1)
+	assert.Equal(t, "claude-sonnet-4", stats.ByModel[0].ModelName)
+
+	w = getStats(&service.CurrentUser{UserID: otherUserID, Username: "otheruser", Role: "user"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = getStats(&service.CurrentUser{UserID: otherUserID, Username: "admin", Role: "admin"})
+	assert.Equal(t, http.StatusOK, w.Code, "admins can see any key")
+}
@@ -1,8 +1,13 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/user/llm-proxy-go/internal/repository"
@@ -13,6 +18,31 @@ import (
 type CacheHandler struct {
 	routingCache       *service.RoutingCache
 	embeddingCacheRepo *repository.EmbeddingCacheRepository
+	routingConfigRepo  *repository.RoutingConfigRepository
+	embeddingModelRepo *repository.EmbeddingModelRepository
+	embeddingRebuilder *service.EmbeddingRebuilder
+	cacheWarmer        *service.CacheWarmer
+}
+
+// EmbeddingCacheExport is the file format for embedding cache export/import.
+type EmbeddingCacheExport struct {
+	Version        int                         `json:"version"`
+	ExportedAt     string                      `json:"exported_at"`
+	EmbeddingModel string                      `json:"embedding_model,omitempty"`
+	Dimension      int                         `json:"dimension"`
+	Entries        []EmbeddingCacheExportEntry `json:"entries"`
+}
+
+// EmbeddingCacheExportEntry is a single exported embedding cache entry.
+type EmbeddingCacheExportEntry struct {
+	ContentHash    string     `json:"content_hash"`
+	ContentPreview string     `json:"content_preview"`
+	Embedding      []float64  `json:"embedding"`
+	TaskType       string     `json:"task_type"`
+	Reason         string     `json:"reason"`
+	HitCount       int        `json:"hit_count"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastHitAt      *time.Time `json:"last_hit_at,omitempty"`
 }
 
 // NewCacheHandler creates a new CacheHandler.
@@ -23,11 +53,29 @@ func NewCacheHandler(rc *service.RoutingCache, ecr *repository.EmbeddingCacheRep
 	}
 }
 
+// SetEmbeddingModelSource sets the repositories used to resolve the active
+// embedding model, whose dimension import validates against.
+func (h *CacheHandler) SetEmbeddingModelSource(configRepo *repository.RoutingConfigRepository, modelRepo *repository.EmbeddingModelRepository) {
+	h.routingConfigRepo = configRepo
+	h.embeddingModelRepo = modelRepo
+}
+
+// SetEmbeddingRebuilder sets the rebuilder behind RebuildEmbeddings.
+func (h *CacheHandler) SetEmbeddingRebuilder(b *service.EmbeddingRebuilder) {
+	h.embeddingRebuilder = b
+}
+
+// SetCacheWarmer sets the warmer behind WarmCache.
+func (h *CacheHandler) SetCacheWarmer(w *service.CacheWarmer) {
+	h.cacheWarmer = w
+}
+
 // GetStats returns cache statistics overview.
 func (h *CacheHandler) GetStats(c *gin.Context) {
-	l1Size := 0
+	l1Size, l1MaxSize := 0, 0
 	if h.routingCache != nil {
 		l1Size = h.routingCache.Size()
+		l1MaxSize = h.routingCache.MaxSize()
 	}
 
 	var l2Size int64
@@ -63,7 +111,7 @@ func (h *CacheHandler) GetStats(c *gin.Context) {
 			"semantic_cache_enabled": h.embeddingCacheRepo != nil,
 		},
 		"by_layer": gin.H{
-			"l1": gin.H{"size": l1Size, "max_size": 10000, "hit_rate": 0.0, "hits": 0, "misses": 0},
+			"l1": gin.H{"size": l1Size, "max_size": l1MaxSize, "hit_rate": 0.0, "hits": 0, "misses": 0},
 			"l2": gin.H{"size": l2Size, "max_size": 0, "hit_rate": l2HitRate, "hits": l2Hits, "misses": 0},
 			"l3": gin.H{"size": l2Size, "max_size": 0, "hit_rate": 0.0, "hits": 0, "misses": 0},
 		},
@@ -124,15 +172,47 @@ func (h *CacheHandler) GetEntries(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"total": total, "entries": result})
 }
 
-// Clear clears the cache.
+// Clear clears the cache level given by the level query parameter: l1 (the
+// in-memory routing cache), l2 (the persistent cache), l3 (only the
+// persistent cache's embeddings, used for semantic matches) or all, the
+// default. It reports how many entries each level lost.
 func (h *CacheHandler) Clear(c *gin.Context) {
-	if h.routingCache != nil {
-		h.routingCache.Clear()
+	level := strings.ToLower(c.DefaultQuery("level", "all"))
+	switch level {
+	case "l1", "l2", "l3", "all":
+	default:
+		errorResponse(c, http.StatusBadRequest, "level must be one of l1, l2, l3, all")
+		return
+	}
+
+	cleared := gin.H{}
+	if level == "l1" || level == "all" {
+		n := 0
+		if h.routingCache != nil {
+			n = h.routingCache.Clear()
+		}
+		cleared["l1"] = n
 	}
 	if h.embeddingCacheRepo != nil {
-		_, _ = h.embeddingCacheRepo.DeleteAll(c.Request.Context())
+		ctx := c.Request.Context()
+		if level == "l3" || level == "all" {
+			n, err := h.embeddingCacheRepo.ClearEmbeddings(ctx)
+			if err != nil {
+				errorResponse(c, http.StatusInternalServerError, err.Error())
+				return
+			}
+			cleared["l3"] = n
+		}
+		if level == "l2" || level == "all" {
+			n, err := h.embeddingCacheRepo.DeleteAll(ctx)
+			if err != nil {
+				errorResponse(c, http.StatusInternalServerError, err.Error())
+				return
+			}
+			cleared["l2"] = n
+		}
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Cache cleared successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Cache cleared successfully", "level": level, "cleared": cleared})
 }
 
 // ResetStats resets cache statistics.
@@ -142,3 +222,214 @@ func (h *CacheHandler) ResetStats(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Cache statistics reset successfully"})
 }
+
+// ExportEmbeddings exports the full embedding cache as a downloadable file.
+func (h *CacheHandler) ExportEmbeddings(c *gin.Context) {
+	if h.embeddingCacheRepo == nil {
+		errorResponse(c, http.StatusServiceUnavailable, "embedding cache not available")
+		return
+	}
+	ctx := c.Request.Context()
+	entries, err := h.embeddingCacheRepo.ExportAll(ctx)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	data := EmbeddingCacheExport{
+		Version:    1,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Entries:    make([]EmbeddingCacheExportEntry, 0, len(entries)),
+	}
+	if name, dim, err := h.activeEmbeddingModel(ctx); err == nil {
+		data.EmbeddingModel, data.Dimension = name, dim
+	}
+	for _, e := range entries {
+		if data.Dimension == 0 && len(e.Embedding) > 0 {
+			data.Dimension = len(e.Embedding)
+		}
+		data.Entries = append(data.Entries, EmbeddingCacheExportEntry{
+			ContentHash:    e.ContentHash,
+			ContentPreview: e.ContentPreview,
+			Embedding:      e.Embedding,
+			TaskType:       e.TaskType,
+			Reason:         e.Reason,
+			HitCount:       e.HitCount,
+			CreatedAt:      e.CreatedAt,
+			LastHitAt:      e.LastHitAt,
+		})
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="llm-proxy-embedding-cache-%s.json"`,
+		time.Now().Format("20060102-150405")))
+	c.JSON(http.StatusOK, data)
+}
+
+// ImportEmbeddings imports an embedding cache export. Every embedding must
+// match the dimension of the active embedding model; entries without an
+// embedding (exact-match only) are always accepted.
+func (h *CacheHandler) ImportEmbeddings(c *gin.Context) {
+	if h.embeddingCacheRepo == nil {
+		errorResponse(c, http.StatusServiceUnavailable, "embedding cache not available")
+		return
+	}
+	var data EmbeddingCacheExport
+	if err := c.ShouldBindJSON(&data); err != nil {
+		errorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid JSON: %v", err))
+		return
+	}
+	ctx := c.Request.Context()
+
+	_, dim, err := h.activeEmbeddingModel(ctx)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if dim > 0 && data.Dimension > 0 && data.Dimension != dim {
+		errorResponse(c, http.StatusBadRequest, fmt.Sprintf(
+			"embedding dimension mismatch: file has %d, active model expects %d", data.Dimension, dim))
+		return
+	}
+
+	entries := make([]*repository.EmbeddingCacheEntry, 0, len(data.Entries))
+	for i, e := range data.Entries {
+		if e.ContentHash == "" {
+			errorResponse(c, http.StatusBadRequest, fmt.Sprintf("entry %d: content_hash is required", i))
+			return
+		}
+		if len(e.Embedding) > 0 && dim > 0 && len(e.Embedding) != dim {
+			errorResponse(c, http.StatusBadRequest, fmt.Sprintf(
+				"entry %d: embedding dimension %d does not match active model dimension %d", i, len(e.Embedding), dim))
+			return
+		}
+		entries = append(entries, &repository.EmbeddingCacheEntry{
+			ContentHash:    e.ContentHash,
+			ContentPreview: e.ContentPreview,
+			Embedding:      e.Embedding,
+			TaskType:       e.TaskType,
+			Reason:         e.Reason,
+			HitCount:       e.HitCount,
+			LastHitAt:      e.LastHitAt,
+		})
+	}
+
+	imported, err := h.embeddingCacheRepo.ImportEntries(ctx, entries)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"imported": imported, "message": "Embedding cache imported"})
+}
+
+// activeEmbeddingModel returns the name and dimension of the embedding model
+// configured for semantic routing. A zero dimension means none is known.
+func (h *CacheHandler) activeEmbeddingModel(ctx context.Context) (string, int, error) {
+	if h.routingConfigRepo == nil || h.embeddingModelRepo == nil {
+		return "", 0, nil
+	}
+	cfg, err := h.routingConfigRepo.GetConfig(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	if cfg.EmbeddingModelID != nil {
+		list, err := h.embeddingModelRepo.ListModels(ctx, false)
+		if err != nil {
+			return "", 0, err
+		}
+		for _, m := range list {
+			if m.ID == *cfg.EmbeddingModelID {
+				return m.Name, m.Dimension, nil
+			}
+		}
+		return "", 0, nil
+	}
+	if cfg.LocalEmbeddingModel == "" {
+		return "", 0, nil
+	}
+	m, err := h.embeddingModelRepo.GetModelByName(ctx, cfg.LocalEmbeddingModel)
+	if err != nil || m == nil {
+		return "", 0, err
+	}
+	return m.Name, m.Dimension, nil
+}
+
+// RebuildEmbeddings starts recomputing the L2 cache embeddings with the
+// active embedding model from the stored content previews. Entries that
+// cannot be re-embedded lose their embedding. Runs on the primary worker only.
+func (h *CacheHandler) RebuildEmbeddings(c *gin.Context) {
+	if h.embeddingRebuilder == nil {
+		errorResponse(c, http.StatusServiceUnavailable, "embedding cache not available")
+		return
+	}
+	_, dim, err := h.activeEmbeddingModel(c.Request.Context())
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := h.embeddingRebuilder.Start(dim); err != nil {
+		if errors.Is(err, service.ErrNotPrimary) || errors.Is(err, service.ErrRebuildRunning) {
+			errorResponse(c, http.StatusConflict, err.Error())
+			return
+		}
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusAccepted, h.embeddingRebuilder.Progress())
+}
+
+// GetRebuildProgress returns the progress of the current or last embedding
+// rebuild.
+func (h *CacheHandler) GetRebuildProgress(c *gin.Context) {
+	if h.embeddingRebuilder == nil {
+		errorResponse(c, http.StatusServiceUnavailable, "embedding cache not available")
+		return
+	}
+	c.JSON(http.StatusOK, h.embeddingRebuilder.Progress())
+}
+
+// WarmCache starts pre-populating the routing caches from recent request
+// logs and returns the task ID to poll. The body is optional.
+// POST /api/config/cache/warm
+func (h *CacheHandler) WarmCache(c *gin.Context) {
+	if h.cacheWarmer == nil {
+		errorResponse(c, http.StatusServiceUnavailable, "cache warmer not available")
+		return
+	}
+	var req service.CacheWarmRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			errorResponse(c, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	if req.Days < 0 || req.Limit < 0 {
+		errorResponse(c, http.StatusBadRequest, "days and limit must not be negative")
+		return
+	}
+
+	taskID, err := h.cacheWarmer.StartWarm(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, service.ErrCacheWarmRunning) || errors.Is(err, service.ErrRoutingCacheDisabled) {
+			errorResponse(c, http.StatusConflict, err.Error())
+			return
+		}
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"task_id": taskID})
+}
+
+// GetWarmTask returns the progress of a cache warm-up task.
+// GET /api/config/cache/warm/:task_id
+func (h *CacheHandler) GetWarmTask(c *gin.Context) {
+	if h.cacheWarmer == nil {
+		errorResponse(c, http.StatusServiceUnavailable, "cache warmer not available")
+		return
+	}
+	task := h.cacheWarmer.GetTask(c.Param("task_id"))
+	if task == nil {
+		errorResponse(c, http.StatusNotFound, "task not found")
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
@@ -4,13 +4,17 @@
 package handler
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/models"
 	"github.com/user/llm-proxy-go/internal/repository"
 	"github.com/user/llm-proxy-go/internal/service"
 	"github.com/user/llm-proxy-go/tests/testutil"
@@ -86,3 +90,236 @@ func TestCacheHandler_Clear_Success(t *testing.T) {
 
 	assert.Equal(t, "Cache cleared successfully", resp["message"])
 }
+
+func TestCacheHandler_Clear_Levels(t *testing.T) {
+	logger := testutil.NewTestLogger()
+	db := testutil.NewTestDB(t)
+	defer db.Close()
+
+	routingCache := service.NewRoutingCache(1000, logger)
+	embeddingCacheRepo := repository.NewEmbeddingCacheRepository(db, logger)
+	handler := NewCacheHandler(routingCache, embeddingCacheRepo)
+	ctx := context.Background()
+	seed := func() {
+		routingCache.Set("k1", models.ModelRoleSimple)
+		routingCache.Set("k2", models.ModelRoleComplex)
+		require.NoError(t, embeddingCacheRepo.SaveCache(ctx, "hash_1", "p1", []float64{0.1}, "simple", "r1"))
+	}
+	clearLevel := func(query string) map[string]any {
+		c, w := testutil.NewTestContext()
+		c.Request = httptest.NewRequest("POST", "/api/cache/clear"+query, nil)
+		handler.Clear(c)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp["cleared"].(map[string]any)
+	}
+
+	seed()
+	assert.Equal(t, map[string]any{"l1": 2.0}, clearLevel("?level=l1"))
+	assert.Zero(t, routingCache.Size())
+	count, err := embeddingCacheRepo.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "L1 flush keeps the persistent cache")
+
+	assert.Equal(t, map[string]any{"l3": 1.0}, clearLevel("?level=l3"))
+	count, err = embeddingCacheRepo.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "L3 flush keeps exact-match entries")
+
+	seed()
+	assert.Equal(t, map[string]any{"l2": 1.0}, clearLevel("?level=L2"))
+	assert.Equal(t, 2, routingCache.Size(), "L2 flush keeps the in-memory cache")
+
+	seed()
+	assert.Equal(t, map[string]any{"l1": 2.0, "l2": 1.0, "l3": 1.0}, clearLevel(""))
+	assert.Zero(t, routingCache.Size())
+
+	c, w := testutil.NewTestContext()
+	c.Request = httptest.NewRequest("POST", "/api/cache/clear?level=l4", nil)
+	handler.Clear(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCacheHandler_GetStats_SharedWithRouter(t *testing.T) {
+	logger := testutil.NewTestLogger()
+	db := testutil.NewTestDBWithDefaults(t)
+	defer db.Close()
+
+	_, err := db.Exec(`UPDATE routing_llm_config SET enabled = 1, cache_enabled = 1, rule_based_routing_enabled = 0 WHERE id = 1`)
+	require.NoError(t, err)
+
+	routingCache := service.NewRoutingCache(1000, logger)
+	embeddingCacheRepo := repository.NewEmbeddingCacheRepository(db, logger)
+	router := service.NewLLMRouter(db, nil, routingCache, logger)
+
+	// Seed L2 so the router promotes the decision into its L1 cache
+	message := "summarize this document"
+	require.NoError(t, embeddingCacheRepo.SaveCache(t.Context(), service.GetCacheKey("", message), message, nil, "simple", "seeded"))
+	_, decision, err := router.InferTaskType(t.Context(), &models.AnthropicRequest{
+		Messages: []models.Message{{Role: "user", Content: models.MessageContent{Text: message}}},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, decision)
+	assert.Equal(t, "L2", decision.CacheType)
+
+	statsL1 := func() map[string]any {
+		handler := NewCacheHandler(routingCache, embeddingCacheRepo)
+		c, w := testutil.NewTestContext()
+		c.Request = httptest.NewRequest("GET", "/api/cache/stats", nil)
+		handler.GetStats(c)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp["by_layer"].(map[string]any)["l1"].(map[string]any)
+	}
+
+	l1 := statsL1()
+	assert.Equal(t, float64(1), l1["size"])
+	assert.Equal(t, float64(1000), l1["max_size"])
+
+	// Updating cache_max_size resizes the shared cache live and persists it
+	configRepo := repository.NewRoutingConfigRepository(db, logger)
+	routingHandler := NewRoutingHandler(repository.NewRoutingModelRepository(db, logger), configRepo)
+	routingHandler.SetRoutingCache(routingCache)
+	c, w := testutil.NewTestContextWithRequest("PUT", "/api/config/llm-routing", map[string]any{"cache_max_size": 50})
+	routingHandler.UpdateLLMRoutingConfig(c)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	l1 = statsL1()
+	assert.Equal(t, float64(50), l1["max_size"])
+	cfg, err := configRepo.GetConfig(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 50, cfg.CacheMaxSize)
+
+	c, w = testutil.NewTestContextWithRequest("PUT", "/api/config/llm-routing", map[string]any{"cache_max_size": 0})
+	routingHandler.UpdateLLMRoutingConfig(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func newTestEmbeddingCacheHandler(t *testing.T, dimension int) (*CacheHandler, *sql.DB) {
+	t.Helper()
+	logger := testutil.NewTestLogger()
+	db := testutil.NewTestDBWithDefaults(t)
+	modelRepo := repository.NewEmbeddingModelRepository(db, logger)
+	_, err := modelRepo.AddModel(t.Context(), &models.EmbeddingModel{
+		Name:      models.DefaultRoutingConfig().LocalEmbeddingModel,
+		Dimension: dimension,
+		Enabled:   true,
+	})
+	require.NoError(t, err)
+
+	h := NewCacheHandler(service.NewRoutingCache(100, logger), repository.NewEmbeddingCacheRepository(db, logger))
+	h.SetEmbeddingModelSource(repository.NewRoutingConfigRepository(db, logger), modelRepo)
+	return h, db
+}
+
+func TestCacheHandler_ExportImportEmbeddings_RoundTrip(t *testing.T) {
+	src, _ := newTestEmbeddingCacheHandler(t, 3)
+	message := "translate this paragraph into french"
+	hash := service.GetCacheKey("", message)
+	require.NoError(t, src.embeddingCacheRepo.SaveCache(t.Context(), hash, message, []float64{0.1, 0.2, 0.3}, "simple", "seeded"))
+	require.NoError(t, src.embeddingCacheRepo.UpdateHitCountByHash(t.Context(), hash))
+	require.NoError(t, src.embeddingCacheRepo.SaveCache(t.Context(), "exact-only", "preview", nil, "complex", "no embedding"))
+
+	c, w := testutil.NewTestContext()
+	c.Request = httptest.NewRequest("GET", "/api/cache/embeddings/export", nil)
+	src.ExportEmbeddings(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+	var exported EmbeddingCacheExport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &exported))
+	assert.Equal(t, 3, exported.Dimension)
+	require.Len(t, exported.Entries, 2)
+	assert.Equal(t, hash, exported.Entries[0].ContentHash)
+	assert.Equal(t, []float64{0.1, 0.2, 0.3}, exported.Entries[0].Embedding)
+	assert.Equal(t, 1, exported.Entries[0].HitCount)
+
+	// Import into a fresh database
+	dst, dstDB := newTestEmbeddingCacheHandler(t, 3)
+	c, w = testutil.NewTestContextWithRequest("POST", "/api/cache/embeddings/import", exported)
+	dst.ImportEmbeddings(c)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	entry, err := dst.embeddingCacheRepo.GetExactMatch(t.Context(), hash, 300)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	assert.Equal(t, "simple", entry.TaskType)
+	assert.Equal(t, []float64{0.1, 0.2, 0.3}, entry.Embedding)
+	assert.Equal(t, 1, entry.HitCount)
+
+	// The router serves the imported decision from L2
+	_, err = dstDB.Exec(`UPDATE routing_llm_config SET enabled = 1, cache_enabled = 1, rule_based_routing_enabled = 0 WHERE id = 1`)
+	require.NoError(t, err)
+	router := service.NewLLMRouter(dstDB, nil, nil, testutil.NewTestLogger())
+	taskType, decision, err := router.InferTaskType(t.Context(), &models.AnthropicRequest{
+		Messages: []models.Message{{Role: "user", Content: models.MessageContent{Text: message}}},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, decision)
+	assert.Equal(t, "L2", decision.CacheType)
+	assert.Equal(t, models.ModelRoleSimple, taskType)
+}
+
+func TestCacheHandler_ImportEmbeddings_DimensionMismatch(t *testing.T) {
+	h, _ := newTestEmbeddingCacheHandler(t, 384)
+
+	payload := EmbeddingCacheExport{
+		Version:   1,
+		Dimension: 3,
+		Entries:   []EmbeddingCacheExportEntry{{ContentHash: "h1", Embedding: []float64{0.1, 0.2, 0.3}, TaskType: "simple"}},
+	}
+	c, w := testutil.NewTestContextWithRequest("POST", "/api/cache/embeddings/import", payload)
+	h.ImportEmbeddings(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Per-entry dimensions are checked even when the file omits one
+	payload.Dimension = 0
+	c, w = testutil.NewTestContextWithRequest("POST", "/api/cache/embeddings/import", payload)
+	h.ImportEmbeddings(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	count, err := h.embeddingCacheRepo.Count(t.Context())
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestCacheHandler_WarmCache(t *testing.T) {
+	logger := testutil.NewTestLogger()
+	db := testutil.NewTestDB(t)
+	routingCache := service.NewRoutingCache(1000, logger)
+	embeddingCacheRepo := repository.NewEmbeddingCacheRepository(db, logger)
+	h := NewCacheHandler(routingCache, embeddingCacheRepo)
+
+	c, w := testutil.NewTestContextWithRequest("POST", "/api/config/cache/warm", nil)
+	h.WarmCache(c)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	h.SetCacheWarmer(service.NewCacheWarmer(repository.NewRequestLogRepositoryImpl(db, logger), repository.NewRoutingRuleRepository(db, logger),
+		repository.NewRoutingConfigRepository(db, logger), embeddingCacheRepo, routingCache, nil, logger))
+
+	c, w = testutil.NewTestContextWithRequest("POST", "/api/config/cache/warm", map[string]int{"limit": -1})
+	h.WarmCache(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	c, w = testutil.NewTestContextWithRequest("POST", "/api/config/cache/warm", map[string]int{"days": 1})
+	h.WarmCache(c)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var started map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &started))
+	require.NotEmpty(t, started["task_id"])
+
+	c, w = testutil.NewTestContext()
+	c.Request = httptest.NewRequest("GET", "/api/config/cache/warm/"+started["task_id"], nil)
+	c.Params = []gin.Param{{Key: "task_id", Value: started["task_id"]}}
+	h.GetWarmTask(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), started["task_id"])
+
+	c, w = testutil.NewTestContext()
+	c.Request = httptest.NewRequest("GET", "/api/config/cache/warm/nope", nil)
+	c.Params = []gin.Param{{Key: "task_id", Value: "nope"}}
+	h.GetWarmTask(c)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
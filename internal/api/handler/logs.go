@@ -2,13 +2,21 @@ package handler
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/user/llm-proxy-go/internal/api/middleware"
+	"github.com/user/llm-proxy-go/internal/models"
 	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/internal/service"
 	"go.uber.org/zap"
 )
 
@@ -17,12 +25,18 @@ const (
 	logQueryTimeout = 10 * time.Second
 	// maxLogLimit caps the maximum number of log entries per page.
 	maxLogLimit = 500
+	// logStreamHeartbeat is how often an idle live log stream sends a
+	// keepalive comment.
+	logStreamHeartbeat = 15 * time.Second
 )
 
 // LogsHandler handles request log endpoints.
 type LogsHandler struct {
-	logRepo repository.RequestLogRepository
-	logger  *zap.Logger
+	logRepo  repository.RequestLogRepository
+	replayer *service.LogReplayer
+	feed     *repository.RequestLogFeed
+	stats    *service.StatsCache
+	logger   *zap.Logger
 }
 
 // NewLogsHandler creates a new LogsHandler.
@@ -30,6 +44,21 @@ func NewLogsHandler(logRepo repository.RequestLogRepository, logger *zap.Logger)
 	return &LogsHandler{logRepo: logRepo, logger: logger}
 }
 
+// SetLogReplayer enables replaying logged requests (nil disables it).
+func (h *LogsHandler) SetLogReplayer(r *service.LogReplayer) {
+	h.replayer = r
+}
+
+// SetLogFeed sets the feed StreamRequestLogs follows (nil disables it).
+func (h *LogsHandler) SetLogFeed(feed *repository.RequestLogFeed) {
+	h.feed = feed
+}
+
+// SetStatsCache sets the cache GetLogStats serves from (nil disables it).
+func (h *LogsHandler) SetStatsCache(cache *service.StatsCache) {
+	h.stats = cache
+}
+
 // optionalStringParam returns a pointer to the query parameter value if non-empty, nil otherwise.
 // This fixes the bug where empty strings were passed as non-nil pointers to repository methods.
 func optionalStringParam(c *gin.Context, key string) *string {
@@ -41,6 +70,8 @@ func optionalStringParam(c *gin.Context, key string) *string {
 
 // GetRequestLogs retrieves request logs (admin only).
 // GET /api/logs?limit=100&offset=0&model=...&endpoint=...&start_time=...&end_time=...&success=...
+// Passing cursor (empty for the first page) switches from offset to keyset
+// pagination: the response carries next_cursor instead of total and offset.
 func (h *LogsHandler) GetRequestLogs(c *gin.Context) {
 	// Check admin permission
 	currentUser := middleware.GetCurrentUser(c)
@@ -81,6 +112,36 @@ func (h *LogsHandler) GetRequestLogs(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), logQueryTimeout)
 	defer cancel()
 
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		if limit <= 0 {
+			limit = 100
+		}
+		logs, next, err := h.logRepo.ListAfter(
+			ctx,
+			cursor, limit,
+			nil, // userID
+			model, endpoint,
+			startTime, endTime,
+			success,
+		)
+		if errors.Is(err, repository.ErrInvalidLogCursor) {
+			errorResponse(c, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		if err != nil {
+			h.logger.Error("failed to retrieve logs", zap.Error(err))
+			errorResponse(c, http.StatusInternalServerError, "Failed to retrieve logs")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"logs":        logs,
+			"limit":       limit,
+			"next_cursor": next,
+			"has_more":    next != "",
+		})
+		return
+	}
+
 	logs, total, err := h.logRepo.List(
 		ctx,
 		limit, offset,
@@ -103,6 +164,198 @@ func (h *LogsHandler) GetRequestLogs(c *gin.Context) {
 	})
 }
 
+// StreamRequestLogs pushes request logs to the client as they are saved,
+// using Server-Sent Events (admin only). Each log is a data event shaped
+// like the logs of GetRequestLogs; a "dropped" event reports how many logs
+// were skipped because the client fell behind. model and success are
+// applied before sending. Only logs saved by this worker are streamed.
+// GET /api/logs/stream?model=...&success=...
+func (h *LogsHandler) StreamRequestLogs(c *gin.Context) {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil || currentUser.Role != "admin" {
+		errorResponse(c, http.StatusForbidden, "Admin access required")
+		return
+	}
+	if h.feed == nil {
+		errorResponse(c, http.StatusServiceUnavailable, "Live request logs are not available")
+		return
+	}
+
+	model := c.Query("model")
+	var success *bool
+	if s := c.Query("success"); s != "" {
+		b := s == "true"
+		success = &b
+	}
+
+	sub := h.feed.Subscribe()
+	defer h.feed.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	w := c.Writer
+	reportDropped := func() error {
+		if dropped := sub.Dropped(); dropped > 0 {
+			_, err := fmt.Fprintf(w, "event: dropped\ndata: {\"count\":%d}\n\n", dropped)
+			return err
+		}
+		return nil
+	}
+
+	heartbeat := time.NewTicker(logStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if err = reportDropped(); err == nil {
+				_, err = w.Write(sseHeartbeat)
+			}
+		case log := <-sub.C:
+			if err = reportDropped(); err != nil {
+				break
+			}
+			if model != "" && log.ModelName != model {
+				continue
+			}
+			if success != nil && log.Success != *success {
+				continue
+			}
+			data, _ := json.Marshal(log)
+			_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		if err != nil {
+			return
+		}
+		w.Flush()
+	}
+}
+
+// logExportColumns is the CSV header of a log export.
+var logExportColumns = []string{
+	"id", "request_id", "created_at", "user_id", "username", "api_key_id",
+	"model_name", "endpoint_name", "task_type", "status_code", "success", "stream",
+	"input_tokens", "output_tokens", "cache_creation_input_tokens", "cache_read_input_tokens",
+	"latency_ms", "cost", "routing_method", "matched_rule_name", "is_inaccurate",
+}
+
+// logExportRecord renders one log as a CSV row matching logExportColumns.
+func logExportRecord(log *models.RequestLog) []string {
+	var apiKeyID, statusCode string
+	if log.APIKeyID != nil {
+		apiKeyID = strconv.FormatInt(*log.APIKeyID, 10)
+	}
+	if log.StatusCode != nil {
+		statusCode = strconv.Itoa(*log.StatusCode)
+	}
+	return []string{
+		strconv.FormatInt(log.ID, 10), log.RequestID, log.CreatedAt.UTC().Format(time.RFC3339),
+		strconv.FormatInt(log.UserID, 10), log.Username, apiKeyID,
+		log.ModelName, log.EndpointName, log.TaskType, statusCode,
+		strconv.FormatBool(log.Success), strconv.FormatBool(log.Stream),
+		strconv.Itoa(log.InputTokens), strconv.Itoa(log.OutputTokens),
+		strconv.Itoa(log.CacheCreationInputTokens), strconv.Itoa(log.CacheReadInputTokens),
+		strconv.FormatFloat(log.LatencyMs, 'f', -1, 64), strconv.FormatFloat(log.Cost, 'f', -1, 64),
+		log.RoutingMethod, log.MatchedRuleName, strconv.FormatBool(log.IsInaccurate),
+	}
+}
+
+// ExportRequestLogs streams all logs matching the filters as a CSV or JSON
+// Lines download (admin only). Rows are written as they are read, so the
+// export size is not limited by memory. An error after the first row can
+// only truncate the download, since the status has already been sent.
+// GET /api/logs/export?format=csv|jsonl&model=...&endpoint=...&start_time=...&end_time=...&success=...
+func (h *LogsHandler) ExportRequestLogs(c *gin.Context) {
+	// Check admin permission
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil || currentUser.Role != "admin" {
+		errorResponse(c, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "jsonl" {
+		errorResponse(c, http.StatusBadRequest, "format must be csv or jsonl")
+		return
+	}
+
+	model := optionalStringParam(c, "model")
+	endpoint := optionalStringParam(c, "endpoint")
+
+	var startTime, endTime *time.Time
+	if st := c.Query("start_time"); st != "" {
+		if t, err := time.Parse(time.RFC3339, st); err == nil {
+			startTime = &t
+		}
+	}
+	if et := c.Query("end_time"); et != "" {
+		if t, err := time.Parse(time.RFC3339, et); err == nil {
+			endTime = &t
+		}
+	}
+
+	var success *bool
+	if s := c.Query("success"); s != "" {
+		b := s == "true"
+		success = &b
+	}
+
+	var write func(*models.RequestLog) error
+	var flush func() error
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		write = func(log *models.RequestLog) error { return w.Write(logExportRecord(log)) }
+		flush = func() error { w.Flush(); return w.Error() }
+		if err := w.Write(logExportColumns); err != nil {
+			return
+		}
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(c.Writer)
+		write = func(log *models.RequestLog) error { return enc.Encode(log) }
+		flush = func() error { return nil }
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="llm-proxy-logs-%s.%s"`,
+		time.Now().Format("20060102-150405"), format))
+	c.Status(http.StatusOK)
+
+	var rows int
+	err := h.logRepo.Export(
+		c.Request.Context(),
+		nil, // userID
+		model, endpoint,
+		startTime, endTime,
+		success,
+		func(log *models.RequestLog) error {
+			if err := write(log); err != nil {
+				return err
+			}
+			// Push a chunk to the client every so often rather than
+			// holding the whole export in the response buffer.
+			if rows++; rows%500 == 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+				c.Writer.Flush()
+			}
+			return nil
+		},
+	)
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		h.logger.Error("log export failed", zap.Int("rows", rows), zap.Error(err))
+	}
+}
+
 // DeleteRequestLogs deletes request logs (admin only).
 // DELETE /api/logs?model=...&endpoint=...&start_time=...&end_time=...
 func (h *LogsHandler) DeleteRequestLogs(c *gin.Context) {
@@ -147,7 +400,8 @@ func (h *LogsHandler) DeleteRequestLogs(c *gin.Context) {
 }
 
 // GetLogStats retrieves log statistics (admin only).
-// GET /api/logs/stats?start_time=...&end_time=...&model=...&endpoint=...&success=...
+// GET /api/logs/stats?start_time=...&end_time=...&model=...&endpoint=...&success=...&fresh=true
+// Results may come from the stats cache; fresh=true bypasses it.
 func (h *LogsHandler) GetLogStats(c *gin.Context) {
 	// Check admin permission
 	currentUser := middleware.GetCurrentUser(c)
@@ -181,13 +435,25 @@ func (h *LogsHandler) GetLogStats(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), logQueryTimeout)
 	defer cancel()
 
-	stats, err := h.logRepo.GetStatistics(
-		ctx,
-		startTime, endTime,
-		nil, // userID
-		model, endpoint,
-		success,
-	)
+	var stats *repository.LogStatistics
+	var err error
+	if h.stats != nil {
+		stats, err = h.stats.Get(ctx, service.StatsFilter{
+			StartTime: startTime,
+			EndTime:   endTime,
+			Model:     model,
+			Endpoint:  endpoint,
+			Success:   success,
+		}, c.Query("fresh") == "true")
+	} else {
+		stats, err = h.logRepo.GetStatistics(
+			ctx,
+			startTime, endTime,
+			nil, // userID
+			model, endpoint,
+			success,
+		)
+	}
 	if err != nil {
 		h.logger.Error("failed to retrieve statistics", zap.Error(err))
 		errorResponse(c, http.StatusInternalServerError, "Failed to retrieve statistics")
@@ -196,3 +462,145 @@ func (h *LogsHandler) GetLogStats(c *gin.Context) {
 
 	c.JSON(http.StatusOK, stats)
 }
+
+const (
+	defaultUsageWindowHours = 24
+	maxUsageWindowHours     = 90 * 24
+	usageTopN               = 5
+)
+
+// UserUsageOverview summarizes one user's recent traffic for support.
+type UserUsageOverview struct {
+	UserID              int64                           `json:"user_id"`
+	WindowHours         int                             `json:"window_hours"`
+	StartTime           time.Time                       `json:"start_time"`
+	TotalRequests       int64                           `json:"total_requests"`
+	ErrorRate           float64                         `json:"error_rate"` // Percentage of failed requests, rate-limit rejections included
+	RateLimitRejections int64                           `json:"rate_limit_rejections"`
+	TotalCost           float64                         `json:"total_cost"`
+	Currency            string                          `json:"currency"`
+	TotalInputTokens    int64                           `json:"total_input_tokens"`
+	TotalOutputTokens   int64                           `json:"total_output_tokens"`
+	TopModels           []repository.ModelStatistics    `json:"top_models"`
+	TopEndpoints        []repository.EndpointStatistics `json:"top_endpoints"`
+}
+
+// GetUserUsage returns a usage overview of one user (admin, or the user themself).
+// GET /api/users/:id/usage?hours=24
+func (h *LogsHandler) GetUserUsage(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil || (currentUser.Role != "admin" && currentUser.UserID != userID) {
+		errorResponse(c, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	hours := defaultUsageWindowHours
+	if v := c.Query("hours"); v != "" {
+		hours, err = strconv.Atoi(v)
+		if err != nil || hours < 1 || hours > maxUsageWindowHours {
+			errorResponse(c, http.StatusBadRequest, "hours must be between 1 and 2160")
+			return
+		}
+	}
+	startTime := time.Now().UTC().Add(-time.Duration(hours) * time.Hour).Truncate(time.Second)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), logQueryTimeout)
+	defer cancel()
+
+	stats, err := h.logRepo.GetStatistics(ctx, &startTime, nil, &userID, nil, nil, nil)
+	if err != nil {
+		h.logger.Error("failed to retrieve user statistics", zap.Int64("user_id", userID), zap.Error(err))
+		errorResponse(c, http.StatusInternalServerError, "Failed to retrieve statistics")
+		return
+	}
+	rejections, err := h.logRepo.CountRateLimited(ctx, &userID, &startTime, nil)
+	if err != nil {
+		h.logger.Error("failed to count rate-limited requests", zap.Int64("user_id", userID), zap.Error(err))
+		errorResponse(c, http.StatusInternalServerError, "Failed to retrieve statistics")
+		return
+	}
+
+	overview := UserUsageOverview{
+		UserID:              userID,
+		WindowHours:         hours,
+		StartTime:           startTime,
+		TotalRequests:       stats.TotalRequests + rejections,
+		RateLimitRejections: rejections,
+		TotalCost:           stats.TotalCost,
+		Currency:            stats.Currency,
+		TotalInputTokens:    stats.TotalInputTokens,
+		TotalOutputTokens:   stats.TotalOutputTokens,
+		TopModels:           []repository.ModelStatistics{},
+		TopEndpoints:        []repository.EndpointStatistics{},
+	}
+	// Rejections are counted apart from the logs, which they never reach.
+	if overview.TotalRequests > 0 {
+		failed := math.Round(float64(stats.TotalRequests)*(100-stats.SuccessRate)/100) + float64(rejections)
+		overview.ErrorRate = math.Round(failed/float64(overview.TotalRequests)*10000) / 100
+	}
+
+	sort.Slice(stats.ByModel, func(i, j int) bool { return stats.ByModel[i].Requests > stats.ByModel[j].Requests })
+	for _, m := range stats.ByModel {
+		if len(overview.TopModels) == usageTopN {
+			break
+		}
+		overview.TopModels = append(overview.TopModels, m)
+	}
+	sort.Slice(stats.ByEndpoint, func(i, j int) bool { return stats.ByEndpoint[i].Requests > stats.ByEndpoint[j].Requests })
+	for _, e := range stats.ByEndpoint {
+		if len(overview.TopEndpoints) == usageTopN {
+			break
+		}
+		// Requests rejected before routing have no endpoint.
+		if e.EndpointName == "" {
+			continue
+		}
+		overview.TopEndpoints = append(overview.TopEndpoints, e)
+	}
+
+	c.JSON(http.StatusOK, overview)
+}
+
+// ReplayLog routes a logged request again with the current rules and
+// configuration and returns the new decision next to the original one. The
+// request is only sent upstream, at normal cost, with execute=true.
+// POST /api/logs/:id/replay?execute=false
+func (h *LogsHandler) ReplayLog(c *gin.Context) {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil || currentUser.Role != "admin" {
+		errorResponse(c, http.StatusForbidden, "Admin access required")
+		return
+	}
+	if h.replayer == nil {
+		errorResponse(c, http.StatusServiceUnavailable, "Log replay is not available")
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, "Invalid log ID")
+		return
+	}
+	execute := c.Query("execute") == "true"
+
+	result, err := h.replayer.Replay(c.Request.Context(), id, execute, currentUser.UserID)
+	switch {
+	case errors.Is(err, service.ErrReplayLogNotFound):
+		errorResponse(c, http.StatusNotFound, "Log not found")
+		return
+	case errors.Is(err, service.ErrReplayNoContent), errors.Is(err, service.ErrReplayInvalidContent),
+		errors.Is(err, service.ErrReplayRedacted):
+		errorResponse(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	case err != nil:
+		h.logger.Error("failed to replay log", zap.Error(err), zap.Int64("id", id))
+		errorResponse(c, http.StatusInternalServerError, "Failed to replay log")
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
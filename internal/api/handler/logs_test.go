@@ -4,14 +4,22 @@
 package handler
 
 import (
+	"bufio"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
 	"github.com/user/llm-proxy-go/internal/models"
 	"github.com/user/llm-proxy-go/internal/repository"
 	"github.com/user/llm-proxy-go/internal/service"
@@ -85,6 +93,126 @@ func TestLogsHandler_GetRequestLogs_Success(t *testing.T) {
 	assert.Len(t, logs, 1, "logs array should contain 1 entry")
 }
 
+func TestLogsHandler_GetRequestLogs_Cursor(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	logRepo := repository.NewRequestLogRepositoryImpl(db, testutil.NewTestLogger())
+	userRepo := repository.NewUserRepository(db)
+
+	ctx := context.Background()
+	adminID, err := userRepo.Insert(ctx, &models.User{
+		Username:     "admin",
+		PasswordHash: "$2a$10$hashedpassword",
+		Role:         models.UserRoleAdmin,
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+	for i := range 3 {
+		_, err = logRepo.Insert(ctx, &models.RequestLogEntry{
+			RequestID:    fmt.Sprintf("req_cursor_%d", i),
+			UserID:       adminID,
+			ModelName:    "claude-sonnet-4",
+			EndpointName: "anthropic-primary",
+			Success:      true,
+		})
+		require.NoError(t, err)
+	}
+
+	handler := NewLogsHandler(logRepo, testutil.NewTestLogger())
+	get := func(url string) (int, map[string]any) {
+		c, w := testutil.NewTestContext()
+		c.Request = httptest.NewRequest("GET", url, nil)
+		c.Set("current_user", &service.CurrentUser{
+			UserID:   adminID,
+			Username: "admin",
+			Role:     string(models.UserRoleAdmin),
+		})
+		handler.GetRequestLogs(c)
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w.Code, resp
+	}
+
+	code, resp := get("/api/logs?cursor=&limit=2")
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, resp["logs"], 2)
+	assert.Equal(t, true, resp["has_more"])
+	assert.Nil(t, resp["total"])
+
+	code, resp = get("/api/logs?limit=2&cursor=" + resp["next_cursor"].(string))
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, resp["logs"], 1)
+	assert.Equal(t, false, resp["has_more"])
+	assert.Equal(t, "", resp["next_cursor"])
+
+	code, _ = get("/api/logs?cursor=bm90LWEtY3Vyc29y")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestLogsHandler_ExportRequestLogs(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	logRepo := repository.NewRequestLogRepositoryImpl(db, testutil.NewTestLogger())
+	userRepo := repository.NewUserRepository(db)
+
+	ctx := context.Background()
+	adminID, err := userRepo.Insert(ctx, &models.User{
+		Username:     "admin",
+		PasswordHash: "$2a$10$hashedpassword",
+		Role:         models.UserRoleAdmin,
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+	for i, model := range []string{"claude-sonnet-4", "claude-haiku-4", "claude-sonnet-4"} {
+		status := 200
+		_, err = logRepo.Insert(ctx, &models.RequestLogEntry{
+			RequestID:    fmt.Sprintf("req_export_%d", i),
+			UserID:       adminID,
+			ModelName:    model,
+			EndpointName: "anthropic-primary",
+			StatusCode:   &status,
+			Cost:         0.25,
+			Success:      true,
+		})
+		require.NoError(t, err)
+	}
+
+	handler := NewLogsHandler(logRepo, testutil.NewTestLogger())
+	export := func(url string) *httptest.ResponseRecorder {
+		c, w := testutil.NewTestContext()
+		c.Request = httptest.NewRequest("GET", url, nil)
+		c.Set("current_user", &service.CurrentUser{
+			UserID:   adminID,
+			Username: "admin",
+			Role:     string(models.UserRoleAdmin),
+		})
+		handler.ExportRequestLogs(c)
+		return w
+	}
+
+	w := export("/api/logs/export?format=csv&model=claude-sonnet-4")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment;")
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, logExportColumns, records[0])
+	assert.Equal(t, "req_export_0", records[1][1])
+	assert.Equal(t, "req_export_2", records[2][1])
+	assert.Equal(t, "200", records[1][9])
+	assert.Equal(t, "0.25", records[1][17])
+
+	w = export("/api/logs/export?format=jsonl")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 3)
+	var first models.RequestLog
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.Equal(t, "req_export_0", first.RequestID)
+
+	w = export("/api/logs/export?format=xml")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 func TestLogsHandler_GetRequestLogs_Forbidden(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	logRepo := repository.NewRequestLogRepositoryImpl(db, testutil.NewTestLogger())
@@ -280,6 +408,38 @@ func TestLogsHandler_GetLogStats_Success(t *testing.T) {
 	}
 }
 
+func TestLogsHandler_GetLogStats_Cached(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	logRepo := repository.NewRequestLogRepositoryImpl(db, testutil.NewTestLogger())
+	handler := NewLogsHandler(logRepo, testutil.NewTestLogger())
+	handler.SetStatsCache(service.NewStatsCache(logRepo, config.StatsCacheConfig{TTLSeconds: 60}, testutil.NewTestLogger()))
+
+	insert := func(requestID string) {
+		_, err := logRepo.Insert(context.Background(), &models.RequestLogEntry{
+			RequestID: requestID, UserID: 1, ModelName: "claude-sonnet-4", EndpointName: "anthropic-primary", Success: true,
+		})
+		require.NoError(t, err)
+	}
+	totalRequests := func(url string) float64 {
+		c, w := testutil.NewTestContext()
+		c.Request = httptest.NewRequest("GET", url, nil)
+		c.Set("current_user", &service.CurrentUser{UserID: 1, Username: "admin", Role: "admin"})
+		handler.GetLogStats(c)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp["total_requests"].(float64)
+	}
+
+	insert("req_cached_1")
+	assert.Equal(t, float64(1), totalRequests("/api/logs/stats"))
+	insert("req_cached_2")
+	assert.Equal(t, float64(1), totalRequests("/api/logs/stats"), "served from the cache")
+	assert.Equal(t, float64(2), totalRequests("/api/logs/stats?model=claude-sonnet-4"), "other filters are queried")
+	assert.Equal(t, float64(2), totalRequests("/api/logs/stats?fresh=true"))
+	assert.Equal(t, float64(2), totalRequests("/api/logs/stats"), "fresh results refresh the cache")
+}
+
 func TestLogsHandler_GetLogStats_Forbidden(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	logRepo := repository.NewRequestLogRepositoryImpl(db, testutil.NewTestLogger())
@@ -309,3 +469,171 @@ func TestLogsHandler_GetLogStats_Forbidden(t *testing.T) {
 	assert.Equal(t, http.StatusForbidden, w.Code)
 }
 
+
+func TestLogsHandler_GetUserUsage(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	logRepo := repository.NewRequestLogRepositoryImpl(db, testutil.NewTestLogger())
+	userRepo := repository.NewUserRepository(db)
+	ctx := context.Background()
+
+	insertUser := func(name string, role models.UserRole) int64 {
+		id, err := userRepo.Insert(ctx, &models.User{Username: name, PasswordHash: "$2a$10$hashedpassword", Role: role, IsActive: true})
+		require.NoError(t, err)
+		return id
+	}
+	adminID := insertUser("admin", models.UserRoleAdmin)
+	aliceID := insertUser("alice", models.UserRoleUser)
+	bobID := insertUser("bob", models.UserRoleUser)
+
+	insertLog := func(userID int64, model, endpoint string, status int, cost float64) {
+		_, err := logRepo.Insert(ctx, &models.RequestLogEntry{
+			RequestID:    fmt.Sprintf("req_%d_%s_%s_%d_%f", userID, model, endpoint, status, cost),
+			UserID:       userID,
+			ModelName:    model,
+			EndpointName: endpoint,
+			InputTokens:  100,
+			OutputTokens: 10,
+			Cost:         cost,
+			StatusCode:   &status,
+			Success:      status == http.StatusOK,
+		})
+		require.NoError(t, err)
+	}
+	insertLog(aliceID, "claude-sonnet-4", "primary", http.StatusOK, 0.01)
+	insertLog(aliceID, "claude-sonnet-4", "primary", http.StatusOK, 0.02)
+	insertLog(aliceID, "claude-sonnet-4", "primary", http.StatusBadGateway, 0)
+	insertLog(aliceID, "claude-haiku", "backup", http.StatusOK, 0.005)
+	require.NoError(t, logRepo.RecordRateLimited(ctx, aliceID, time.Now())) // Counted, not logged
+	insertLog(bobID, "claude-opus-4", "primary", http.StatusOK, 1.0)
+
+	handler := NewLogsHandler(logRepo, testutil.NewTestLogger())
+	get := func(asID int64, role models.UserRole, targetID int64) *httptest.ResponseRecorder {
+		c, w := testutil.NewTestContext()
+		c.Request = httptest.NewRequest("GET", fmt.Sprintf("/api/users/%d/usage?hours=24", targetID), nil)
+		c.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(targetID, 10)}}
+		c.Set("current_user", &service.CurrentUser{UserID: asID, Role: string(role)})
+		handler.GetUserUsage(c)
+		return w
+	}
+
+	w := get(adminID, models.UserRoleAdmin, aliceID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var overview UserUsageOverview
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &overview))
+	assert.Equal(t, aliceID, overview.UserID)
+	assert.Equal(t, 24, overview.WindowHours)
+	assert.Equal(t, int64(5), overview.TotalRequests)
+	assert.Equal(t, 40.0, overview.ErrorRate)
+	assert.Equal(t, int64(1), overview.RateLimitRejections)
+	assert.InDelta(t, 0.035, overview.TotalCost, 1e-9)
+	assert.Equal(t, int64(400), overview.TotalInputTokens)
+	require.Len(t, overview.TopModels, 2)
+	assert.Equal(t, "claude-sonnet-4", overview.TopModels[0].ModelName)
+	assert.Equal(t, int64(3), overview.TopModels[0].Requests)
+	require.Len(t, overview.TopEndpoints, 2)
+	assert.Equal(t, "primary", overview.TopEndpoints[0].EndpointName)
+	assert.Equal(t, int64(3), overview.TopEndpoints[0].Requests)
+
+	// A user can see their own overview but nobody else's.
+	w = get(aliceID, models.UserRoleUser, aliceID)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = get(aliceID, models.UserRoleUser, bobID)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	c, w := testutil.NewTestContext()
+	c.Request = httptest.NewRequest("GET", "/api/users/1/usage?hours=0", nil)
+	c.Params = gin.Params{{Key: "id", Value: strconv.FormatInt(aliceID, 10)}}
+	c.Set("current_user", &service.CurrentUser{UserID: adminID, Role: string(models.UserRoleAdmin)})
+	handler.GetUserUsage(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestLogsHandler_ReplayLog(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	logRepo := repository.NewRequestLogRepositoryImpl(db, testutil.NewTestLogger())
+	logID, err := logRepo.Insert(context.Background(), &models.RequestLogEntry{RequestID: "req-no-content", UserID: 2, Success: true})
+	require.NoError(t, err)
+
+	handler := NewLogsHandler(logRepo, testutil.NewTestLogger())
+	replay := func(id string, role string) *httptest.ResponseRecorder {
+		c, w := testutil.NewTestContext()
+		c.Request = httptest.NewRequest("POST", "/api/logs/"+id+"/replay", nil)
+		c.Params = gin.Params{{Key: "id", Value: id}}
+		c.Set("current_user", &service.CurrentUser{UserID: 1, Username: "admin", Role: role})
+		handler.ReplayLog(c)
+		return w
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, replay(strconv.FormatInt(logID, 10), "admin").Code, "no replayer configured")
+
+	handler.SetLogReplayer(service.NewLogReplayer(logRepo, nil, nil, nil, testutil.NewTestLogger()))
+	assert.Equal(t, http.StatusForbidden, replay(strconv.FormatInt(logID, 10), "user").Code)
+	assert.Equal(t, http.StatusBadRequest, replay("abc", "admin").Code)
+	assert.Equal(t, http.StatusNotFound, replay("9999", "admin").Code)
+
+	w := replay(strconv.FormatInt(logID, 10), "admin")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "full content logging")
+}
+
+func TestLogsHandler_StreamRequestLogs(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	logRepo := repository.NewRequestLogRepositoryImpl(db, testutil.NewTestLogger())
+	feed := repository.NewRequestLogFeed()
+	logRepo.SetFeed(feed)
+	handler := NewLogsHandler(logRepo, testutil.NewTestLogger())
+	handler.SetLogFeed(feed)
+
+	router := gin.New()
+	router.GET("/api/logs/stream", func(c *gin.Context) {
+		c.Set("current_user", &service.CurrentUser{UserID: 1, Username: "admin", Role: string(models.UserRoleAdmin)})
+		handler.StreamRequestLogs(c)
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/logs/stream?model=claude-sonnet-4&success=false")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	require.Eventually(t, func() bool { return feed.Subscribers() == 1 }, time.Second, 5*time.Millisecond)
+
+	for i, entry := range []struct {
+		model   string
+		success bool
+	}{
+		{"claude-sonnet-4", true},
+		{"claude-haiku-4", false},
+		{"claude-sonnet-4", false},
+	} {
+		_, err := logRepo.Insert(context.Background(), &models.RequestLogEntry{
+			RequestID: fmt.Sprintf("req_live_%d", i),
+			ModelName: entry.model,
+			Success:   entry.success,
+		})
+		require.NoError(t, err)
+	}
+
+	// Only the log matching both filters is pushed.
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+	require.True(t, ok, line)
+	var log models.RequestLog
+	require.NoError(t, json.Unmarshal([]byte(data), &log))
+	assert.Equal(t, "req_live_2", log.RequestID)
+	assert.NotZero(t, log.ID)
+
+	resp.Body.Close()
+	require.Eventually(t, func() bool { return feed.Subscribers() == 0 }, time.Second, 5*time.Millisecond)
+
+	// Without a feed the stream is unavailable.
+	c, w := testutil.NewTestContext()
+	c.Request = httptest.NewRequest("GET", "/api/logs/stream", nil)
+	c.Set("current_user", &service.CurrentUser{UserID: 1, Username: "admin", Role: string(models.UserRoleAdmin)})
+	NewLogsHandler(logRepo, testutil.NewTestLogger()).StreamRequestLogs(c)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/service"
+)
+
+// ChatCompletions handles POST /v1/chat/completions. OpenAI-format requests
+// are translated to Anthropic Messages requests and routed through the same
+// endpoint selection, proxying and request logging as /v1/messages.
+func (h *ProxyHandler) ChatCompletions(c *gin.Context) {
+	format := openAIFormat{}
+	user, ok := h.authenticate(c, format)
+	if !ok {
+		return
+	}
+
+	var chatReq models.ChatCompletionRequest
+	if !h.bindRequest(c, &chatReq, format) {
+		return
+	}
+
+	req, err := service.ChatRequestToAnthropic(&chatReq)
+	if err != nil {
+		format.writeError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	h.proxyService.ApplyDefaultMaxTokens(req)
+
+	jsonMode, ok := jsonModeRequested(c, format)
+	if !ok {
+		return
+	}
+	if chatReq.ResponseFormat != nil {
+		switch chatReq.ResponseFormat.Type {
+		case "", "text":
+		case "json_object":
+			jsonMode = true
+		default:
+			format.writeError(c, http.StatusBadRequest, "invalid_request_error",
+				"unsupported response_format type: "+chatReq.ResponseFormat.Type)
+			return
+		}
+	}
+
+	format.includeUsage = chatReq.StreamOptions != nil && chatReq.StreamOptions.IncludeUsage
+	h.serve(c, req, user, format, jsonMode)
+}
+
+// openAIFormat renders responses in the OpenAI Chat Completions format.
+type openAIFormat struct {
+	includeUsage bool
+}
+
+func (openAIFormat) writeError(c *gin.Context, status int, errType, message string) {
+	c.JSON(status, models.ChatErrorResponse{Error: models.ChatErrorDetail{
+		Message: message,
+		Type:    errType,
+	}})
+}
+
+func (openAIFormat) writeUpstreamError(c *gin.Context, ue *service.UpstreamError) {
+	c.JSON(ue.StatusCode, service.AnthropicErrorToChat(ue.ClientBody()))
+}
+
+func (openAIFormat) writeResponse(c *gin.Context, resp *models.AnthropicResponse) {
+	c.JSON(http.StatusOK, service.AnthropicToChatResponse(resp))
+}
+
+func (f openAIFormat) newStreamTranslator() func(line []byte) []byte {
+	return service.NewChatStreamTranslator(f.includeUsage).Translate
+}
@@ -1,15 +1,22 @@
 package handler
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/user/llm-proxy-go/internal/api/middleware"
 	"github.com/user/llm-proxy-go/internal/models"
 	"github.com/user/llm-proxy-go/internal/repository"
 	"github.com/user/llm-proxy-go/internal/service"
@@ -22,6 +29,16 @@ type ProxyHandler struct {
 	authService       *service.AuthService
 	endpointSelector  *service.EndpointSelector
 	routingConfigRepo *repository.RoutingConfigRepository
+	contentPolicy     *service.ContentPolicy
+	redactor          *service.ContentRedactor
+	stripThinking     bool
+	validateTools     bool
+	keyLimiter        *service.KeyRateLimiter
+	streamResume      *service.StreamResumeStore
+	idempotency       *service.IdempotencyStore
+	budget            *service.BudgetService
+	maxRequestBytes   int64
+	streamHeartbeat   time.Duration
 	logger            *zap.Logger
 }
 
@@ -38,78 +55,235 @@ func NewProxyHandler(
 		authService:       as,
 		endpointSelector:  es,
 		routingConfigRepo: rcr,
+		keyLimiter:        service.NewKeyRateLimiter(),
 		logger:            logger,
 	}
 }
 
+// SetContentPolicy enables request content blocking (nil disables it).
+func (h *ProxyHandler) SetContentPolicy(p *service.ContentPolicy) {
+	h.contentPolicy = p
+}
+
+// SetContentRedactor masks secrets in logged request and response content
+// (nil logs it unchanged).
+func (h *ProxyHandler) SetContentRedactor(r *service.ContentRedactor) {
+	h.redactor = r
+}
+
+// SetStripThinking sets whether thinking blocks are left out of logged
+// response content. It applies before and independently of redaction.
+func (h *ProxyHandler) SetStripThinking(strip bool) {
+	h.stripThinking = strip
+}
+
+// SetToolValidation sets whether Messages rejects requests with malformed
+// tool definitions itself instead of forwarding them.
+func (h *ProxyHandler) SetToolValidation(validate bool) {
+	h.validateTools = validate
+}
+
+// SetStreamResume enables Last-Event-ID stream resumption (nil disables it).
+func (h *ProxyHandler) SetStreamResume(s *service.StreamResumeStore) {
+	h.streamResume = s
+}
+
+// SetIdempotency enables Idempotency-Key replay of non-streaming responses
+// (nil disables it).
+func (h *ProxyHandler) SetIdempotency(s *service.IdempotencyStore) {
+	h.idempotency = s
+}
+
+// SetBudget enforces per-user monthly budgets (nil disables it).
+func (h *ProxyHandler) SetBudget(b *service.BudgetService) {
+	h.budget = b
+}
+
+// SetMaxRequestBytes limits the size of proxy request bodies (0 disables
+// the limit).
+func (h *ProxyHandler) SetMaxRequestBytes(n int64) {
+	h.maxRequestBytes = n
+}
+
+// SetStreamHeartbeat sends an SSE comment every d while a stream waits for
+// its first upstream data, so idle-timeouts in clients and intermediaries
+// do not drop slow-starting streams (0 disables it).
+func (h *ProxyHandler) SetStreamHeartbeat(d time.Duration) {
+	h.streamHeartbeat = d
+}
+
 // Messages handles POST /v1/messages.
 func (h *ProxyHandler) Messages(c *gin.Context) {
+	format := anthropicFormat{}
+	user, ok := h.authenticate(c, format)
+	if !ok {
+		return
+	}
+
+	// Parse request body.
+	var req models.AnthropicRequest
+	if !h.bindRequest(c, &req, format) {
+		return
+	}
+	h.proxyService.ApplyDefaultMaxTokens(&req)
+	if h.validateTools {
+		if err := service.ValidateTools(req.Tools); err != nil {
+			format.writeError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+	}
+
+	jsonMode, ok := jsonModeRequested(c, format)
+	if !ok {
+		return
+	}
+	h.serve(c, &req, user, format, jsonMode)
+}
+
+// bindRequest decodes the JSON request body, enforcing the configured size
+// limit. It writes an error response and returns false on failure.
+func (h *ProxyHandler) bindRequest(c *gin.Context, obj any, format apiFormat) bool {
+	if h.maxRequestBytes > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxRequestBytes)
+	}
+	if err := c.ShouldBindJSON(obj); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.logger.Warn("request body too large",
+				zap.Int64("limit", tooLarge.Limit),
+				zap.String("ip", c.ClientIP()))
+			format.writeError(c, http.StatusRequestEntityTooLarge, "invalid_request_error",
+				fmt.Sprintf("Request body exceeds the limit of %d bytes", tooLarge.Limit))
+			return false
+		}
+		h.logger.Warn("invalid request body",
+			zap.String("error", err.Error()),
+			zap.String("ip", c.ClientIP()))
+		format.writeError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// jsonModeRequested reads the response format header, writing an error
+// response when it has an unsupported value.
+func jsonModeRequested(c *gin.Context, format apiFormat) (bool, bool) {
+	switch v := c.GetHeader(service.ResponseFormatHeader); {
+	case v == "":
+		return false, true
+	case strings.EqualFold(v, "json"):
+		return true, true
+	default:
+		format.writeError(c, http.StatusBadRequest, "invalid_request_error",
+			"unsupported "+service.ResponseFormatHeader+" value: "+v)
+		return false, false
+	}
+}
+
+// authenticate validates the client API key, writing an error response in
+// the client's format when it is missing or invalid.
+func (h *ProxyHandler) authenticate(c *gin.Context, format apiFormat) (*service.CurrentUser, bool) {
 	// Extract API key from header.
 	apiKey := extractAPIKey(c)
 	if apiKey == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"type": "error",
-			"error": gin.H{
-				"type":    "authentication_error",
-				"message": "Missing API key",
-			},
-		})
-		return
+		format.writeError(c, http.StatusUnauthorized, "authentication_error", "Missing API key")
+		return nil, false
 	}
 
 	// Validate API key.
 	user, err := h.authService.ValidateAPIKey(c.Request.Context(), apiKey)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"type": "error",
-			"error": gin.H{
-				"type":    "authentication_error",
-				"message": err.Error(),
-			},
-		})
-		return
+		format.writeError(c, http.StatusUnauthorized, "authentication_error", err.Error())
+		return nil, false
 	}
 
 	h.logger.Debug("authenticated user", zap.String("username", user.Username))
+	return user, true
+}
 
-	// Parse request body.
-	var req models.AnthropicRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		h.logger.Warn("invalid request body",
-			zap.String("error", err.Error()),
-			zap.String("ip", c.ClientIP()))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"type": "error",
-			"error": gin.H{
-				"type":    "invalid_request_error",
-				"message": "Invalid request body: " + err.Error(),
-			},
-		})
+// serve validates an Anthropic-format request and proxies it, writing
+// responses and errors in the client's format. In JSON mode the upstream is
+// instructed to answer in JSON, and non-stream responses are validated.
+func (h *ProxyHandler) serve(c *gin.Context, req *models.AnthropicRequest, user *service.CurrentUser, format apiFormat, jsonMode bool) {
+	// The concurrency middleware admitted the request before its body was
+	// read; now that it is known whether it streams, check that kind's limit.
+	if !middleware.GetConcurrencySlot(c).Classify(req.Stream) {
+		c.Header("Retry-After", middleware.ConcurrencyRetryAfter)
+		format.writeError(c, http.StatusServiceUnavailable, "overloaded_error",
+			"Too many concurrent requests, please retry shortly")
 		return
 	}
 
+	// A reconnecting client continues its buffered stream instead of
+	// starting a new request.
+	if lastEventID := c.GetHeader("Last-Event-ID"); lastEventID != "" {
+		if h.resumeStream(c, lastEventID, user, format) {
+			return
+		}
+	}
+
 	// Validate request.
 	if req.Model == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"type": "error",
-			"error": gin.H{
-				"type":    "invalid_request_error",
-				"message": "model is required",
-			},
-		})
+		format.writeError(c, http.StatusBadRequest, "invalid_request_error", "model is required")
+		return
+	}
+
+	req.ConversationID = c.GetHeader(service.ConversationIDHeader)
+
+	// Enforce the API key's own restrictions.
+	if !user.AllowsModel(req.Model) {
+		format.writeError(c, http.StatusForbidden, "permission_error",
+			fmt.Sprintf("API key is not allowed to use model %q", req.Model))
+		return
+	}
+	if user.APIKeyID != nil {
+		if ok, retryAfter := h.keyLimiter.Allow(*user.APIKeyID, user.RateLimitPerMin); !ok {
+			msg := fmt.Sprintf("API key rate limit of %d requests per minute exceeded", user.RateLimitPerMin)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			format.writeError(c, http.StatusTooManyRequests, "rate_limit_error", msg)
+			// Counted rather than logged, for the per-user usage overview.
+			h.proxyService.RecordRateLimited(user.UserID)
+			return
+		}
+	}
+
+	if h.budget != nil {
+		usage, err := h.budget.Check(c.Request.Context(), user)
+		if errors.Is(err, service.ErrBudgetExceeded) {
+			msg := fmt.Sprintf("Monthly budget of $%.2f exhausted ($%.2f spent); it resets on %s",
+				*usage.BudgetUSD, usage.SpentUSD, usage.PeriodEnd.Format("2006-01-02"))
+			format.writeError(c, http.StatusPaymentRequired, "billing_error", msg)
+			h.proxyService.SaveRequestLog(c.Request.Context(), &service.ProxyMetadata{
+				RequestID:       uuid.New().String(),
+				SelectedModel:   req.Model,
+				StatusCode:      http.StatusPaymentRequired,
+				Stream:          req.Stream,
+				ResponseContent: msg,
+				EndUserID:       req.EndUserID(),
+			}, user.UserID, user.APIKeyID)
+			return
+		}
+		if err != nil {
+			// Spend is unknown; serve the request rather than block everyone
+			// with a budget on a database hiccup.
+			h.logger.Warn("budget check failed", zap.Int64("user_id", user.UserID), zap.Error(err))
+		}
+	}
+
+	// Reject content matching the configured policy before it leaves the proxy.
+	if pattern, blocked := h.contentPolicy.Check(req); blocked {
+		h.logger.Warn("request blocked by content policy",
+			zap.String("username", user.Username),
+			zap.String("pattern", pattern))
+		format.writeError(c, http.StatusBadRequest, "invalid_request_error",
+			"Request blocked by content policy: message contains forbidden content")
 		return
 	}
 
 	// Get endpoints from context
 	endpoints, ok := c.Get("endpoints")
 	if !ok || endpoints == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"type": "error",
-			"error": gin.H{
-				"type":    "api_error",
-				"message": "No endpoints configured",
-			},
-		})
+		format.writeError(c, http.StatusServiceUnavailable, "api_error", "No endpoints configured")
 		return
 	}
 
@@ -117,33 +291,72 @@ func (h *ProxyHandler) Messages(c *gin.Context) {
 
 	// Check if streaming is requested
 	if req.Stream {
-		h.handleStreamRequest(c, &req, eps, user)
+		if jsonMode {
+			// Streamed output cannot be validated; only the instruction applies.
+			req = service.WithJSONInstruction(req)
+		}
+		h.handleStreamRequest(c, req, eps, user, format)
 		return
 	}
 
-	// Non-streaming request
-	h.handleNonStreamRequest(c, &req, eps, user)
+	// Non-streaming request. Streaming requests ignore Idempotency-Key:
+	// an interrupted stream is continued with Last-Event-ID instead.
+	if key := c.GetHeader(service.IdempotencyKeyHeader); key != "" && h.idempotency != nil {
+		h.handleIdempotentRequest(c, key, req, eps, user, format, jsonMode)
+		return
+	}
+	h.handleNonStreamRequest(c, req, eps, user, format, jsonMode)
 }
 
-// handleNonStreamRequest handles non-streaming proxy requests.
-func (h *ProxyHandler) handleNonStreamRequest(c *gin.Context, req *models.AnthropicRequest, eps []*models.Endpoint, user *service.CurrentUser) {
-	ctx := c.Request.Context()
+// handleIdempotentRequest proxies a non-streaming request carrying an
+// Idempotency-Key, or replays the stored response when the key was already
+// served. A replay makes no upstream call and is not logged again; its
+// headers report the original request and cost.
+func (h *ProxyHandler) handleIdempotentRequest(c *gin.Context, key string, req *models.AnthropicRequest, eps []*models.Endpoint, user *service.CurrentUser, format apiFormat, jsonMode bool) {
+	resp, meta, err := h.idempotency.Reserve(user.UserID, key, req)
+	switch {
+	case errors.Is(err, service.ErrIdempotencyInProgress):
+		format.writeError(c, http.StatusConflict, "invalid_request_error", err.Error())
+		return
+	case err != nil:
+		format.writeError(c, http.StatusUnprocessableEntity, "invalid_request_error", err.Error())
+		return
+	case resp != nil:
+		h.logger.Debug("replayed idempotent request",
+			zap.String("request_id", meta.RequestID),
+			zap.String("username", user.Username))
+		c.Header("X-Proxy-Idempotent-Replay", "true")
+		setProxyHeaders(c, meta)
+		format.writeResponse(c, resp)
+		return
+	}
 
-	// Use EndpointSelector to select endpoint
-	selection, err := h.endpointSelector.SelectEndpoint(ctx, req, eps)
-	if err != nil {
-		h.logger.Error("endpoint selection failed", zap.Error(err))
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"type": "error",
-			"error": gin.H{
-				"type":    "api_error",
-				"message": err.Error(),
-			},
-		})
+	resp, meta = h.handleNonStreamRequest(c, req, eps, user, format, jsonMode)
+	if resp == nil {
+		h.idempotency.Release(user.UserID, key)
 		return
 	}
+	h.idempotency.Complete(user.UserID, key, resp, meta)
+}
+
+// handleNonStreamRequest handles non-streaming proxy requests. It returns the
+// response and its metadata when the request succeeded.
+func (h *ProxyHandler) handleNonStreamRequest(c *gin.Context, req *models.AnthropicRequest, eps []*models.Endpoint, user *service.CurrentUser, format apiFormat, jsonMode bool) (*models.AnthropicResponse, *service.ProxyMetadata) {
+	ctx := c.Request.Context()
+
+	start := time.Now()
+	selection, ok := h.selectEndpoint(c, req, eps, user, format)
+	if !ok {
+		return nil, nil
+	}
+	selected := time.Now()
+	selection.MaxOutputTokens = h.maxOutputTokens(ctx)
 
-	resp, meta, err := h.proxyService.ProxyRequest(ctx, req, c.Request.Header, selection, eps)
+	proxy := h.proxyService.ProxyRequest
+	if jsonMode {
+		proxy = h.proxyService.ProxyJSONRequest
+	}
+	resp, meta, err := proxy(ctx, req, c.Request.Header, selection, eps)
 	if err != nil {
 		if ue, ok := err.(*service.UpstreamError); ok {
 			// Save error request log with proper RequestID
@@ -161,11 +374,11 @@ func (h *ProxyHandler) handleNonStreamRequest(c *gin.Context, req *models.Anthro
 			meta.RuleMatchResult = selection.RuleMatchResult
 			h.attachContent(ctx, meta, req, nil)
 			// Save upstream error response body (always, regardless of LogFullContent)
-			meta.ResponseContent = string(ue.Body)
+			meta.ResponseContent = h.redactor.Redact(string(ue.Body))
 			h.proxyService.SaveRequestLog(ctx, meta, user.UserID, user.APIKeyID)
 
-			c.Data(ue.StatusCode, "application/json", ue.Body)
-			return
+			format.writeUpstreamError(c, ue)
+			return nil, nil
 		}
 		h.logger.Error("proxy request failed", zap.Error(err))
 
@@ -175,7 +388,8 @@ func (h *ProxyHandler) handleNonStreamRequest(c *gin.Context, req *models.Anthro
 				RequestID: uuid.New().String(),
 			}
 		}
-		meta.StatusCode = http.StatusBadGateway
+		status, errType := proxyErrorStatus(err)
+		meta.StatusCode = status
 		meta.Success = false
 		meta.SelectedModel = selection.Model.Name
 		meta.SelectedEndpoint = selection.Endpoint.Provider.Name
@@ -184,17 +398,11 @@ func (h *ProxyHandler) handleNonStreamRequest(c *gin.Context, req *models.Anthro
 		meta.RuleMatchResult = selection.RuleMatchResult
 		h.attachContent(ctx, meta, req, nil)
 		// Save error message as response content
-		meta.ResponseContent = err.Error()
+		meta.ResponseContent = h.redactor.Redact(err.Error())
 		h.proxyService.SaveRequestLog(ctx, meta, user.UserID, user.APIKeyID)
 
-		c.JSON(http.StatusBadGateway, gin.H{
-			"type": "error",
-			"error": gin.H{
-				"type":    "api_error",
-				"message": err.Error(),
-			},
-		})
-		return
+		format.writeError(c, status, errType, err.Error())
+		return nil, nil
 	}
 
 	// Attach routing decision to metadata
@@ -203,6 +411,8 @@ func (h *ProxyHandler) handleNonStreamRequest(c *gin.Context, req *models.Anthro
 	meta.RoutingDecision = selection.RoutingDecision
 	meta.RuleMatchResult = selection.RuleMatchResult
 	meta.InferredTaskType = string(selection.TaskType)
+	meta.RoutingLatencyMs = selection.RoutingLatencyMs
+	upstreamDone := time.Now()
 
 	// Attach full content if configured
 	h.attachContent(ctx, meta, req, resp)
@@ -212,29 +422,91 @@ func (h *ProxyHandler) handleNonStreamRequest(c *gin.Context, req *models.Anthro
 
 	// Set proxy metadata headers.
 	setProxyHeaders(c, meta)
-	c.JSON(http.StatusOK, resp)
+	setServerTiming(c, meta.RoutingLatencyMs, start, selected, upstreamDone)
+	format.writeResponse(c, resp)
+	return resp, meta
 }
 
-// handleStreamRequest handles SSE streaming proxy requests.
-func (h *ProxyHandler) handleStreamRequest(c *gin.Context, req *models.AnthropicRequest, eps []*models.Endpoint, user *service.CurrentUser) {
-	ctx := c.Request.Context()
+// forceRoleHeader names the model role a request must be served by,
+// bypassing routing.
+const forceRoleHeader = "X-Proxy-Force-Role"
 
-	// Use EndpointSelector to select endpoint
-	selection, err := h.endpointSelector.SelectEndpoint(ctx, req, eps)
+// selectEndpoint selects the endpoint for a request, writing the error
+// response when none can be selected. A request carrying forceRoleHeader is
+// served by that role without routing or cross-role fallback; the header
+// takes precedence over ForceSmartRouting and the requested model. Only the
+// models the user's API key allows are candidates: smart routing and
+// fallback can pick a model other than the requested one.
+func (h *ProxyHandler) selectEndpoint(c *gin.Context, req *models.AnthropicRequest, eps []*models.Endpoint, user *service.CurrentUser, format apiFormat) (*service.EndpointSelectionResult, bool) {
+	allowed := user.AllowedEndpoints(eps)
+	if header := c.GetHeader(forceRoleHeader); header != "" {
+		role := models.ModelRole(strings.ToLower(header))
+		selection, err := h.endpointSelector.SelectForcedRole(role, req, allowed)
+		if errors.Is(err, service.ErrNoEndpointForRole) && len(allowed) < len(eps) &&
+			slices.ContainsFunc(eps, func(ep *models.Endpoint) bool { return ep.Model.Role == role && ep.Model.Enabled }) {
+			format.writeError(c, http.StatusForbidden, "permission_error",
+				fmt.Sprintf("API key is not allowed to use any model of role %s", role))
+			return nil, false
+		}
+		if err != nil {
+			status := http.StatusServiceUnavailable
+			errType := "api_error"
+			if errors.Is(err, service.ErrInvalidForcedRole) || errors.Is(err, service.ErrNoEndpointForRole) {
+				status, errType = http.StatusBadRequest, "invalid_request_error"
+			}
+			format.writeError(c, status, errType, err.Error())
+			return nil, false
+		}
+		return selection, true
+	}
+
+	if len(allowed) == 0 {
+		format.writeError(c, http.StatusForbidden, "permission_error",
+			"API key is not allowed to use any available model")
+		return nil, false
+	}
+	selection, err := h.endpointSelector.SelectEndpoint(c.Request.Context(), req, allowed)
 	if err != nil {
 		h.logger.Error("endpoint selection failed", zap.Error(err))
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"type": "error",
-			"error": gin.H{
-				"type":    "api_error",
-				"message": err.Error(),
-			},
-		})
+		format.writeError(c, http.StatusServiceUnavailable, "api_error", err.Error())
+		return nil, false
+	}
+	return selection, true
+}
+
+// proxyErrorStatus maps a non-upstream proxy error to the HTTP status and
+// error type returned to the client. Saturated providers are a transient
+// capacity condition, so clients get a retryable 503 instead of a 502.
+func proxyErrorStatus(err error) (int, string) {
+	if errors.Is(err, service.ErrProvidersSaturated) {
+		return http.StatusServiceUnavailable, "overloaded_error"
+	}
+	return http.StatusBadGateway, "api_error"
+}
+
+// handleStreamRequest handles SSE streaming proxy requests.
+func (h *ProxyHandler) handleStreamRequest(c *gin.Context, req *models.AnthropicRequest, eps []*models.Endpoint, user *service.CurrentUser, format apiFormat) {
+	ctx := c.Request.Context()
+
+	start := time.Now()
+	selection, ok := h.selectEndpoint(c, req, eps, user, format)
+	if !ok {
 		return
 	}
+	selected := time.Now()
+	selection.MaxOutputTokens = h.maxOutputTokens(ctx)
 
-	chunkChan, meta, err := h.proxyService.ProxyStreamRequest(ctx, req, c.Request.Header, selection, eps)
+	// With resumption enabled the upstream read outlives the client
+	// connection; the resumable stream cancels it once abandoned.
+	upstreamCtx, cancel := ctx, context.CancelFunc(func() {})
+	if h.streamResume != nil {
+		upstreamCtx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	}
+
+	chunkChan, meta, started, err := h.connectStream(c, upstreamCtx, req, selection, eps)
+	upstreamDone := time.Now()
 	if err != nil {
+		cancel()
 		if ue, ok := err.(*service.UpstreamError); ok {
 			// Save error request log with proper RequestID
 			if meta == nil {
@@ -252,10 +524,14 @@ func (h *ProxyHandler) handleStreamRequest(c *gin.Context, req *models.Anthropic
 			meta.RuleMatchResult = selection.RuleMatchResult
 			h.attachStreamContent(ctx, meta, req)
 			// Save upstream error response body (always, regardless of LogFullContent)
-			meta.ResponseContent = string(ue.Body)
+			meta.ResponseContent = h.redactor.Redact(string(ue.Body))
 			h.proxyService.SaveRequestLog(ctx, meta, user.UserID, user.APIKeyID)
 
-			c.Data(ue.StatusCode, "application/json", ue.Body)
+			if started {
+				writeStreamError(c, format, ue.ClientBody())
+			} else {
+				format.writeUpstreamError(c, ue)
+			}
 			return
 		}
 		h.logger.Error("proxy stream request failed", zap.Error(err))
@@ -266,7 +542,8 @@ func (h *ProxyHandler) handleStreamRequest(c *gin.Context, req *models.Anthropic
 				RequestID: uuid.New().String(),
 			}
 		}
-		meta.StatusCode = http.StatusBadGateway
+		status, errType := proxyErrorStatus(err)
+		meta.StatusCode = status
 		meta.Success = false
 		meta.Stream = true
 		meta.SelectedModel = selection.Model.Name
@@ -276,16 +553,18 @@ func (h *ProxyHandler) handleStreamRequest(c *gin.Context, req *models.Anthropic
 		meta.RuleMatchResult = selection.RuleMatchResult
 		h.attachStreamContent(ctx, meta, req)
 		// Save error message as response content
-		meta.ResponseContent = err.Error()
+		meta.ResponseContent = h.redactor.Redact(err.Error())
 		h.proxyService.SaveRequestLog(ctx, meta, user.UserID, user.APIKeyID)
 
-		c.JSON(http.StatusBadGateway, gin.H{
-			"type": "error",
-			"error": gin.H{
-				"type":    "api_error",
-				"message": err.Error(),
-			},
-		})
+		if started {
+			body, _ := json.Marshal(models.ErrorResponse{
+				Type:  "error",
+				Error: models.ErrorDetail{Type: errType, Message: err.Error()},
+			})
+			writeStreamError(c, format, body)
+		} else {
+			format.writeError(c, status, errType, err.Error())
+		}
 		return
 	}
 
@@ -294,15 +573,12 @@ func (h *ProxyHandler) handleStreamRequest(c *gin.Context, req *models.Anthropic
 	meta.RuleMatchResult = selection.RuleMatchResult
 	meta.FallbackInfo = selection.FallbackInfo
 	meta.InferredTaskType = string(selection.TaskType)
+	meta.RoutingLatencyMs = selection.RoutingLatencyMs
 
 	// Attach request content if configured
 	h.attachStreamContent(ctx, meta, req)
 
-	// Set SSE headers
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("X-Accel-Buffering", "no") // Disable nginx buffering
+	setSSEHeaders(c)
 
 	// Set initial proxy metadata headers
 	c.Header("X-Proxy-Request-Id", meta.RequestID)
@@ -310,60 +586,52 @@ func (h *ProxyHandler) handleStreamRequest(c *gin.Context, req *models.Anthropic
 	c.Header("X-Proxy-Endpoint", url.QueryEscape(meta.SelectedEndpoint))
 	c.Header("X-Proxy-Task-Type", meta.InferredTaskType)
 	c.Header("X-Proxy-Stream", "true")
+	setFallbackHeader(c, meta.FallbackInfo)
+	setServerTiming(c, meta.RoutingLatencyMs, start, selected, upstreamDone)
 
 	// Flush headers immediately
 	c.Writer.Flush()
 
+	translate := format.newStreamTranslator()
+
+	if stream := h.streamResume.Open(meta.RequestID, user.UserID, cancel); stream != nil {
+		go h.pumpStream(upstreamCtx, chunkChan, stream, translate, meta, user)
+		h.followStream(c, meta.RequestID, stream, -1)
+		return
+	}
+
 	// Stream chunks to client
 	clientGone := c.Request.Context().Done()
+	heartbeat, stopHeartbeat := h.heartbeat()
+	defer stopHeartbeat()
 	for {
 		select {
 		case <-clientGone:
 			h.logger.Debug("client disconnected during stream",
 				zap.String("request_id", meta.RequestID))
 			return
+		case <-heartbeat:
+			if !h.writeHeartbeat(c, meta.RequestID) {
+				return
+			}
 		case chunk, ok := <-chunkChan:
 			if !ok {
 				// Channel closed
 				return
 			}
 
-			if chunk.Err != nil {
-				h.logger.Error("stream error",
-					zap.String("request_id", meta.RequestID),
-					zap.Error(chunk.Err))
-				if chunk.Meta != nil {
-					chunk.Meta.RoutingDecision = meta.RoutingDecision
-					chunk.Meta.RuleMatchResult = meta.RuleMatchResult
-					chunk.Meta.RequestContent = meta.RequestContent
-					h.proxyService.SaveRequestLog(c.Request.Context(), chunk.Meta, user.UserID, user.APIKeyID)
-				}
-				return
-			}
-
-			if chunk.Done {
-				// Final chunk with metadata
-				if chunk.Meta != nil {
-					// Propagate routing fields set by handler
-					chunk.Meta.RoutingDecision = meta.RoutingDecision
-					chunk.Meta.RuleMatchResult = meta.RuleMatchResult
-					chunk.Meta.RequestContent = meta.RequestContent
-					// Save request log
-					h.proxyService.SaveRequestLog(c.Request.Context(), chunk.Meta, user.UserID, user.APIKeyID)
-
-					h.logger.Debug("stream completed",
-						zap.String("request_id", chunk.Meta.RequestID),
-						zap.Int("input_tokens", chunk.Meta.InputTokens),
-						zap.Int("output_tokens", chunk.Meta.OutputTokens),
-						zap.Float64("cost", chunk.Meta.Cost),
-						zap.Float64("latency_ms", chunk.Meta.LatencyMs))
-				}
+			if chunk.Err != nil || chunk.Done {
+				h.finishStream(c.Request.Context(), chunk, meta, user)
 				return
 			}
 
 			// Write chunk to response
-			if len(chunk.Data) > 0 {
-				_, err := c.Writer.Write(chunk.Data)
+			data := chunk.Data
+			if translate != nil {
+				data = translate(data)
+			}
+			if len(data) > 0 {
+				_, err := c.Writer.Write(data)
 				if err != nil {
 					h.logger.Error("failed to write chunk",
 						zap.String("request_id", meta.RequestID),
@@ -371,11 +639,260 @@ func (h *ProxyHandler) handleStreamRequest(c *gin.Context, req *models.Anthropic
 					return
 				}
 				c.Writer.Flush()
+				heartbeat = nil
+			}
+		}
+	}
+}
+
+// finishStream saves the request log for the final chunk of a stream.
+func (h *ProxyHandler) finishStream(ctx context.Context, chunk service.StreamChunk, meta *service.ProxyMetadata, user *service.CurrentUser) {
+	if chunk.Err != nil {
+		h.logger.Error("stream error",
+			zap.String("request_id", meta.RequestID),
+			zap.Error(chunk.Err))
+	}
+	if chunk.Meta == nil {
+		return
+	}
+	// Propagate routing fields set by handler
+	chunk.Meta.RoutingDecision = meta.RoutingDecision
+	chunk.Meta.RuleMatchResult = meta.RuleMatchResult
+	chunk.Meta.RequestContent = meta.RequestContent
+	chunk.Meta.EndUserID = meta.EndUserID
+	// Save request log
+	h.proxyService.SaveRequestLog(ctx, chunk.Meta, user.UserID, user.APIKeyID)
+
+	if chunk.Err == nil {
+		h.logger.Debug("stream completed",
+			zap.String("request_id", chunk.Meta.RequestID),
+			zap.Int("input_tokens", chunk.Meta.InputTokens),
+			zap.Int("output_tokens", chunk.Meta.OutputTokens),
+			zap.Float64("cost", chunk.Meta.Cost),
+			zap.Float64("latency_ms", chunk.Meta.LatencyMs))
+	}
+}
+
+// pumpStream moves upstream chunks into a resumable stream, one SSE event at
+// a time, until the upstream read ends. It runs independently of the client
+// connection so a reconnecting client can continue the stream.
+func (h *ProxyHandler) pumpStream(
+	ctx context.Context,
+	chunkChan <-chan service.StreamChunk,
+	stream *service.ResumableStream,
+	translate func([]byte) []byte,
+	meta *service.ProxyMetadata,
+	user *service.CurrentUser,
+) {
+	defer stream.Close()
+	var framer service.SSEFramer
+	for chunk := range chunkChan {
+		if chunk.Err != nil || chunk.Done {
+			if tail := framer.Flush(); tail != nil {
+				stream.Append(tail)
+			}
+			h.finishStream(ctx, chunk, meta, user)
+			return
+		}
+		data := chunk.Data
+		if translate != nil {
+			data = translate(data)
+		}
+		for _, event := range framer.Write(data) {
+			stream.Append(event)
+		}
+	}
+}
+
+// followStream writes the events of a resumable stream after seq to the
+// client, each tagged with its id, then keeps writing new events until the
+// stream completes or the client disconnects.
+func (h *ProxyHandler) followStream(c *gin.Context, requestID string, stream *service.ResumableStream, seq int64) {
+	stream.Attach()
+	defer stream.Detach()
+
+	clientGone := c.Request.Context().Done()
+	heartbeat, stopHeartbeat := h.heartbeat()
+	defer stopHeartbeat()
+	for {
+		events, done, changed, ok := stream.Since(seq)
+		if !ok {
+			h.logger.Warn("client fell behind the stream resume buffer",
+				zap.String("request_id", requestID),
+				zap.Int64("last_event", seq))
+			return
+		}
+		for _, event := range events {
+			data := service.WithEventID(event.Data, service.StreamEventID(requestID, event.Seq))
+			if _, err := c.Writer.Write(data); err != nil {
+				h.logger.Error("failed to write chunk",
+					zap.String("request_id", requestID),
+					zap.Error(err))
+				return
+			}
+			seq = event.Seq
+		}
+		if len(events) > 0 {
+			c.Writer.Flush()
+			heartbeat = nil
+		}
+		if done {
+			return
+		}
+		select {
+		case <-clientGone:
+			h.logger.Debug("client disconnected during stream",
+				zap.String("request_id", requestID))
+			return
+		case <-heartbeat:
+			if !h.writeHeartbeat(c, requestID) {
+				return
+			}
+		case <-changed:
+		}
+	}
+}
+
+// connectStream connects to the upstream stream. While the upstream is slow
+// to answer, e.g. delaying its headers or buffering a short response, the
+// SSE response is started and heartbeats are sent as usual, so clients and
+// intermediaries do not time out before the first byte. started reports
+// whether the response was started: errors must then be sent as an SSE error
+// event, and proxy headers only known after connecting are not sent.
+func (h *ProxyHandler) connectStream(
+	c *gin.Context,
+	ctx context.Context,
+	req *models.AnthropicRequest,
+	selection *service.EndpointSelectionResult,
+	eps []*models.Endpoint,
+) (chunks <-chan service.StreamChunk, meta *service.ProxyMetadata, started bool, err error) {
+	heartbeat, stopHeartbeat := h.heartbeat()
+	defer stopHeartbeat()
+	if heartbeat == nil {
+		chunks, meta, err = h.proxyService.ProxyStreamRequest(ctx, req, c.Request.Header, selection, eps)
+		return chunks, meta, false, err
+	}
+
+	type result struct {
+		chunks <-chan service.StreamChunk
+		meta   *service.ProxyMetadata
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		chunks, meta, err := h.proxyService.ProxyStreamRequest(ctx, req, c.Request.Header, selection, eps)
+		done <- result{chunks, meta, err}
+	}()
+	for {
+		select {
+		case r := <-done:
+			return r.chunks, r.meta, started, r.err
+		case <-heartbeat:
+			if !started {
+				setSSEHeaders(c)
+				c.Header("X-Proxy-Stream", "true")
+				c.Status(http.StatusOK)
+				started = true
+			}
+			if !h.writeHeartbeat(c, "") {
+				heartbeat = nil // Client gone; wait for the upstream to give up
 			}
 		}
 	}
 }
 
+// writeStreamError ends a started stream with an SSE error event carrying
+// body, an Anthropic error envelope, in the client's format.
+func writeStreamError(c *gin.Context, format apiFormat, body []byte) {
+	var data bytes.Buffer
+	data.WriteString("data: ")
+	if err := json.Compact(&data, body); err != nil {
+		data.Truncate(len("data: "))
+		b, _ := json.Marshal(models.ErrorResponse{
+			Type:  "error",
+			Error: models.ErrorDetail{Type: "api_error", Message: string(body)},
+		})
+		data.Write(b)
+	}
+	var event []byte
+	if translate := format.newStreamTranslator(); translate != nil {
+		event = translate(data.Bytes())
+	} else {
+		event = append([]byte("event: error\n"), data.Bytes()...)
+		event = append(event, "\n\n"...)
+	}
+	c.Writer.Write(event)
+	c.Writer.Flush()
+}
+
+// sseHeartbeat is an SSE comment line, which clients ignore.
+var sseHeartbeat = []byte(": ping\n\n")
+
+// heartbeat returns a channel that ticks every stream heartbeat interval, and
+// a function to stop it. The channel is nil, i.e. never ready, when
+// heartbeats are disabled; callers set it to nil once data flows.
+func (h *ProxyHandler) heartbeat() (<-chan time.Time, func()) {
+	if h.streamHeartbeat <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(h.streamHeartbeat)
+	return ticker.C, ticker.Stop
+}
+
+// writeHeartbeat writes and flushes an SSE heartbeat comment. The comment
+// goes straight to the client, bypassing the upstream stream, its usage
+// accounting and the resume buffer. It reports false when the write fails.
+func (h *ProxyHandler) writeHeartbeat(c *gin.Context, requestID string) bool {
+	if _, err := c.Writer.Write(sseHeartbeat); err != nil {
+		h.logger.Debug("failed to write stream heartbeat",
+			zap.String("request_id", requestID),
+			zap.Error(err))
+		return false
+	}
+	c.Writer.Flush()
+	return true
+}
+
+// resumeStream serves a reconnect carrying Last-Event-ID by replaying the
+// buffered events the client missed and continuing the live stream. It
+// reports false when the header does not name a proxy stream, in which case
+// the request is handled normally.
+func (h *ProxyHandler) resumeStream(c *gin.Context, lastEventID string, user *service.CurrentUser, format apiFormat) bool {
+	requestID, seq, ok := service.ParseStreamEventID(lastEventID)
+	if !ok || h.streamResume == nil {
+		return false
+	}
+	stream := h.streamResume.Lookup(requestID)
+	available := stream != nil && stream.Owner() == user.UserID
+	if available {
+		// The events after seq may already have been evicted.
+		_, _, _, available = stream.Since(seq)
+	}
+	if !available {
+		format.writeError(c, http.StatusNotFound, "not_found_error",
+			fmt.Sprintf("stream %s can no longer be resumed", requestID))
+		return true
+	}
+
+	h.logger.Debug("resuming stream",
+		zap.String("request_id", requestID),
+		zap.Int64("last_event", seq))
+	setSSEHeaders(c)
+	c.Header("X-Proxy-Request-Id", requestID)
+	c.Header("X-Proxy-Stream", "true")
+	c.Writer.Flush()
+	h.followStream(c, requestID, stream, seq)
+	return true
+}
+
+// setSSEHeaders sets the headers of an SSE response.
+func setSSEHeaders(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable nginx buffering
+}
+
 // setProxyHeaders sets the proxy metadata headers on the response.
 func setProxyHeaders(c *gin.Context, meta *service.ProxyMetadata) {
 	c.Header("X-Proxy-Request-Id", meta.RequestID)
@@ -386,6 +903,68 @@ func setProxyHeaders(c *gin.Context, meta *service.ProxyMetadata) {
 	c.Header("X-Proxy-Cost", strconv.FormatFloat(meta.Cost, 'f', -1, 64))
 	c.Header("X-Proxy-Input-Tokens", strconv.Itoa(meta.InputTokens))
 	c.Header("X-Proxy-Output-Tokens", strconv.Itoa(meta.OutputTokens))
+	setFallbackHeader(c, meta.FallbackInfo)
+}
+
+// setServerTiming sets the Server-Timing header breaking the request down
+// into routing inference, the rest of endpoint selection, the upstream call
+// (until the response, or for streams until the upstream connected) and the
+// total, from the handler's start, selected and upstreamDone timestamps.
+func setServerTiming(c *gin.Context, routingMs float64, start, selected, upstreamDone time.Time) {
+	selectMs := math.Max(durationMs(selected.Sub(start))-routingMs, 0)
+	c.Header("Server-Timing", fmt.Sprintf("routing;dur=%.1f, select;dur=%.1f, upstream;dur=%.1f, total;dur=%.1f",
+		routingMs, selectMs, durationMs(upstreamDone.Sub(selected)), durationMs(time.Since(start))))
+}
+
+// durationMs converts d to fractional milliseconds.
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// setFallbackHeader reports a degraded selection to the client: the roles
+// walked, in order, ending with the one that served the request.
+func setFallbackHeader(c *gin.Context, info *models.FallbackInfo) {
+	if info == nil || len(info.FallbackChain) == 0 {
+		return
+	}
+	c.Header("X-Proxy-Fallback-Chain", strings.Join(info.FallbackChain, ","))
+}
+
+// apiFormat adapts proxy errors and responses to the wire format of the
+// ingress endpoint the client called. Requests are always proxied upstream in
+// Anthropic format.
+type apiFormat interface {
+	writeError(c *gin.Context, status int, errType, message string)
+	writeUpstreamError(c *gin.Context, ue *service.UpstreamError)
+	writeResponse(c *gin.Context, resp *models.AnthropicResponse)
+	// newStreamTranslator returns a per-request function converting one
+	// upstream SSE line into client bytes, or nil to pass lines through.
+	newStreamTranslator() func(line []byte) []byte
+}
+
+// anthropicFormat passes Anthropic Messages API responses through unchanged.
+type anthropicFormat struct{}
+
+func (anthropicFormat) writeError(c *gin.Context, status int, errType, message string) {
+	c.JSON(status, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    errType,
+			"message": message,
+		},
+	})
+}
+
+func (anthropicFormat) writeUpstreamError(c *gin.Context, ue *service.UpstreamError) {
+	c.Data(ue.StatusCode, "application/json", ue.ClientBody())
+}
+
+func (anthropicFormat) writeResponse(c *gin.Context, resp *models.AnthropicResponse) {
+	c.JSON(http.StatusOK, resp)
+}
+
+func (anthropicFormat) newStreamTranslator() func(line []byte) []byte {
+	return nil
 }
 
 // extractAPIKey extracts the API key from x-api-key header or Authorization bearer.
@@ -403,8 +982,23 @@ func extractAPIKey(c *gin.Context) string {
 	return ""
 }
 
-// attachContent attaches full request/response content to metadata if configured.
+// maxOutputTokens returns the configured output token budget, 0 if unset.
+func (h *ProxyHandler) maxOutputTokens(ctx context.Context) int {
+	if h.routingConfigRepo == nil {
+		return 0
+	}
+	cfg, err := h.routingConfigRepo.GetConfig(ctx)
+	if err != nil {
+		h.logger.Warn("failed to get routing config for output budget", zap.Error(err))
+		return 0
+	}
+	return cfg.MaxOutputTokens
+}
+
+// attachContent attaches the request's end user and, if configured, full
+// request/response content to metadata, with secrets redacted.
 func (h *ProxyHandler) attachContent(ctx context.Context, meta *service.ProxyMetadata, req *models.AnthropicRequest, resp *models.AnthropicResponse) {
+	meta.EndUserID = req.EndUserID()
 	if h.routingConfigRepo == nil {
 		return
 	}
@@ -420,21 +1014,42 @@ func (h *ProxyHandler) attachContent(ctx context.Context, meta *service.ProxyMet
 	}
 
 	// Serialize request content
-	if reqBytes, err := json.Marshal(req); err == nil {
-		meta.RequestContent = string(reqBytes)
+	if reqBytes, err := json.Marshal(service.ClientRequest(req)); err == nil {
+		meta.RequestContent = h.redactor.Redact(string(reqBytes))
 	}
 
 	// Serialize response content
 	if resp != nil {
+		if h.stripThinking {
+			resp = withoutThinking(resp)
+		}
 		if respBytes, err := json.Marshal(resp); err == nil {
-			meta.ResponseContent = string(respBytes)
+			meta.ResponseContent = h.redactor.Redact(string(respBytes))
 		}
 	}
 }
 
-// attachStreamContent attaches request content to stream metadata if configured.
-// Response content is not available for streaming requests.
+// withoutThinking returns a copy of resp without its thinking and
+// redacted_thinking blocks, keeping the final text and tool calls. resp is
+// returned as is when it has none, which is always the case for models
+// without extended thinking.
+func withoutThinking(resp *models.AnthropicResponse) *models.AnthropicResponse {
+	isThinking := func(part models.ContentPart) bool {
+		return part.Type == "thinking" || part.Type == "redacted_thinking"
+	}
+	if !slices.ContainsFunc(resp.Content, isThinking) {
+		return resp
+	}
+	stripped := *resp
+	stripped.Content = slices.DeleteFunc(slices.Clone(resp.Content), isThinking)
+	return &stripped
+}
+
+// attachStreamContent attaches the request's end user and, if configured,
+// request content to stream metadata. Response content is not available for
+// streaming requests.
 func (h *ProxyHandler) attachStreamContent(ctx context.Context, meta *service.ProxyMetadata, req *models.AnthropicRequest) {
+	meta.EndUserID = req.EndUserID()
 	if h.routingConfigRepo == nil {
 		return
 	}
@@ -449,7 +1064,7 @@ func (h *ProxyHandler) attachStreamContent(ctx context.Context, meta *service.Pr
 		return
 	}
 
-	if reqBytes, err := json.Marshal(req); err == nil {
-		meta.RequestContent = string(reqBytes)
+	if reqBytes, err := json.Marshal(service.ClientRequest(req)); err == nil {
+		meta.RequestContent = h.redactor.Redact(string(reqBytes))
 	}
 }
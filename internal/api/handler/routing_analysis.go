@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
@@ -52,8 +53,20 @@ type RoutingStats struct {
 	TotalRequests    int64                    `json:"total_requests"`
 	ByMethod         map[string]MethodStats   `json:"by_method"`
 	ByRule           []RuleStats              `json:"by_rule"`
+	ByObserveRule    []RuleStats              `json:"by_observe_rule"` // Would-be matches of observe-only rules
 	InaccurateCount  int64                    `json:"inaccurate_count"`
 	InaccurateRate   float64                  `json:"inaccurate_rate"`
+	ByTaskType       map[string]TaskTypeStats `json:"by_task_type"`
+}
+
+// TaskTypeStats represents outcome statistics for an inferred task type.
+type TaskTypeStats struct {
+	Count        int64   `json:"count"`
+	Percentage   float64 `json:"percentage"`
+	SuccessRate  float64 `json:"success_rate"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	TotalCost    float64 `json:"total_cost"`
+	AvgCost      float64 `json:"avg_cost"`
 }
 
 // MethodStats represents statistics for a routing method.
@@ -106,6 +119,8 @@ func (h *RoutingAnalysisHandler) GetRoutingStats(c *gin.Context) {
 		TotalRequests: total,
 		ByMethod:      make(map[string]MethodStats),
 		ByRule:        make([]RuleStats, 0),
+		ByObserveRule: make([]RuleStats, 0),
+		ByTaskType:    make(map[string]TaskTypeStats),
 	}
 
 	for method, count := range agg.MethodCounts {
@@ -132,6 +147,45 @@ func (h *RoutingAnalysisHandler) GetRoutingStats(c *gin.Context) {
 		})
 	}
 
+	for ruleName, count := range agg.ObserveCounts {
+		pct := 0.0
+		if total > 0 {
+			pct = float64(count) * 100.0 / float64(total)
+		}
+		stats.ByObserveRule = append(stats.ByObserveRule, RuleStats{
+			RuleID:     agg.RuleIDs[ruleName],
+			RuleName:   ruleName,
+			Count:      count,
+			Percentage: roundToPlaces(pct, 2),
+		})
+	}
+	sort.Slice(stats.ByObserveRule, func(i, j int) bool {
+		a, b := stats.ByObserveRule[i], stats.ByObserveRule[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.RuleName < b.RuleName
+	})
+
+	for taskType, ts := range agg.TaskTypeStats {
+		pct, successRate, avgCost := 0.0, 0.0, 0.0
+		if total > 0 {
+			pct = float64(ts.Count) * 100.0 / float64(total)
+		}
+		if ts.Count > 0 {
+			successRate = float64(ts.SuccessCount) * 100.0 / float64(ts.Count)
+			avgCost = ts.TotalCost / float64(ts.Count)
+		}
+		stats.ByTaskType[taskType] = TaskTypeStats{
+			Count:        ts.Count,
+			Percentage:   roundToPlaces(pct, 2),
+			SuccessRate:  roundToPlaces(successRate, 2),
+			AvgLatencyMs: roundToPlaces(ts.AvgLatencyMs, 2),
+			TotalCost:    roundToPlaces(ts.TotalCost, 6),
+			AvgCost:      roundToPlaces(avgCost, 6),
+		}
+	}
+
 	stats.InaccurateCount = agg.InaccurateCount
 	if total > 0 {
 		stats.InaccurateRate = roundToPlaces(float64(agg.InaccurateCount)*100.0/float64(total), 2)
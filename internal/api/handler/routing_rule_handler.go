@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
+	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/user/llm-proxy-go/internal/models"
 	"github.com/user/llm-proxy-go/internal/repository"
 	"github.com/user/llm-proxy-go/internal/service"
@@ -21,29 +25,65 @@ type RoutingRuleCreate struct {
 	TaskType    string   `json:"task_type" binding:"required"`
 	Priority    int      `json:"priority"`
 	Enabled     bool     `json:"enabled"`
+	// RolloutPercent defaults to 100 when omitted.
+	RolloutPercent *int `json:"rollout_percent"`
+	Observe        bool `json:"observe"`
+}
+
+// toRule converts the request into an unsaved routing rule.
+func (r *RoutingRuleCreate) toRule() *models.RoutingRule {
+	rollout := 100
+	if r.RolloutPercent != nil {
+		rollout = *r.RolloutPercent
+	}
+	return &models.RoutingRule{
+		Name:           r.Name,
+		Description:    r.Description,
+		Keywords:       r.Keywords,
+		Pattern:        r.Pattern,
+		Condition:      r.Condition,
+		TaskType:       r.TaskType,
+		Priority:       r.Priority,
+		Enabled:        r.Enabled,
+		RolloutPercent: rollout,
+		Observe:        r.Observe,
+	}
 }
 
 // RoutingRuleUpdate represents a routing rule update request.
 type RoutingRuleUpdate struct {
-	Name        *string   `json:"name"`
-	Description *string   `json:"description"`
-	Keywords    *[]string `json:"keywords"`
-	Pattern     *string   `json:"pattern"`
-	Condition   *string   `json:"condition"`
-	TaskType    *string   `json:"task_type"`
-	Priority    *int      `json:"priority"`
-	Enabled     *bool     `json:"enabled"`
+	Name           *string   `json:"name"`
+	Description    *string   `json:"description"`
+	Keywords       *[]string `json:"keywords"`
+	Pattern        *string   `json:"pattern"`
+	Condition      *string   `json:"condition"`
+	TaskType       *string   `json:"task_type"`
+	Priority       *int      `json:"priority"`
+	Enabled        *bool     `json:"enabled"`
+	RolloutPercent *int      `json:"rollout_percent"`
+	Observe        *bool     `json:"observe"`
 }
 
 // TestMessageRequest represents a rule test request.
 type TestMessageRequest struct {
 	Message      string `json:"message" binding:"required"`
 	SystemPrompt string `json:"system_prompt"`
+	Trace        bool   `json:"trace"` // Include a step-by-step trace of each rule condition
 }
 
+// TestBatchRequest represents a batch rule test request.
+type TestBatchRequest struct {
+	Messages []string `json:"messages" binding:"required"`
+}
+
+// maxTestBatchMessages caps the messages classified by one batch test.
+const maxTestBatchMessages = 500
+
 // RoutingRuleHandler handles routing rule API endpoints.
 type RoutingRuleHandler struct {
 	ruleRepo *repository.RoutingRuleRepo
+	janitor  *service.RuleJanitor
+	roles    *service.RoleSet
 	logger   *zap.Logger
 }
 
@@ -52,6 +92,26 @@ func NewRoutingRuleHandler(ruleRepo *repository.RoutingRuleRepo, logger *zap.Log
 	return &RoutingRuleHandler{ruleRepo: ruleRepo, logger: logger}
 }
 
+// SetRoleSet sets the roles a rule's task_type is checked against (nil
+// means the builtin roles only).
+func (h *RoutingRuleHandler) SetRoleSet(rs *service.RoleSet) {
+	h.roles = rs
+}
+
+// validateRule checks a rule's fields and that its task type is a known
+// role.
+func (h *RoutingRuleHandler) validateRule(rule *models.RoutingRule) error {
+	if err := service.ValidateRule(rule); err != nil {
+		return err
+	}
+	return h.roles.Validate(rule.TaskType)
+}
+
+// SetRuleJanitor sets the janitor whose idle rule report is included in stats.
+func (h *RoutingRuleHandler) SetRuleJanitor(j *service.RuleJanitor) {
+	h.janitor = j
+}
+
 // ListRules returns all routing rules, optionally filtered by enabled status.
 func (h *RoutingRuleHandler) ListRules(c *gin.Context) {
 	enabledOnly := c.Query("enabled_only") == "true"
@@ -97,15 +157,10 @@ func (h *RoutingRuleHandler) CreateRule(c *gin.Context) {
 		return
 	}
 
-	rule := &models.RoutingRule{
-		Name:        req.Name,
-		Description: req.Description,
-		Keywords:    req.Keywords,
-		Pattern:     req.Pattern,
-		Condition:   req.Condition,
-		TaskType:    req.TaskType,
-		Priority:    req.Priority,
-		Enabled:     req.Enabled,
+	rule := req.toRule()
+	if err := h.validateRule(rule); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	id, err := h.ruleRepo.AddRule(c.Request.Context(), rule)
@@ -143,6 +198,28 @@ func (h *RoutingRuleHandler) UpdateRule(c *gin.Context) {
 		return
 	}
 
+	// Validate the rule as it will be after the update.
+	merged := *existing
+	if req.Name != nil {
+		merged.Name = *req.Name
+	}
+	if req.Pattern != nil {
+		merged.Pattern = *req.Pattern
+	}
+	if req.Condition != nil {
+		merged.Condition = *req.Condition
+	}
+	if req.TaskType != nil {
+		merged.TaskType = *req.TaskType
+	}
+	if req.RolloutPercent != nil {
+		merged.RolloutPercent = *req.RolloutPercent
+	}
+	if err := h.validateRule(&merged); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	updates := make(map[string]any)
 	if req.Name != nil {
 		updates["name"] = *req.Name
@@ -168,6 +245,12 @@ func (h *RoutingRuleHandler) UpdateRule(c *gin.Context) {
 	if req.Enabled != nil {
 		updates["enabled"] = *req.Enabled
 	}
+	if req.RolloutPercent != nil {
+		updates["rollout_percent"] = *req.RolloutPercent
+	}
+	if req.Observe != nil {
+		updates["observe"] = *req.Observe
+	}
 
 	if err := h.ruleRepo.UpdateRule(c.Request.Context(), id, updates); err != nil {
 		h.logger.Error("failed to update rule", zap.Error(err))
@@ -177,6 +260,20 @@ func (h *RoutingRuleHandler) UpdateRule(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"id": id, "message": "Routing rule updated"})
 }
 
+// ValidateRule checks a rule the same way CreateRule does, without saving it.
+func (h *RoutingRuleHandler) ValidateRule(c *gin.Context) {
+	var req RoutingRuleCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.validateRule(req.toRule()); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"valid": true})
+}
+
 // DeleteRule deletes a routing rule.
 func (h *RoutingRuleHandler) DeleteRule(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("rule_id"), 10, 64)
@@ -226,8 +323,59 @@ func (h *RoutingRuleHandler) TestMessage(c *gin.Context) {
 	}
 
 	classifier := service.NewRoutingClassifier(rules)
-	result := classifier.TestMessage(req.Message)
+	resp := testResultResponse(classifier.TestMessage(req.Message))
+	if req.Trace {
+		resp["condition_traces"] = classifier.TraceConditions(req.Message)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// TestBatch classifies many messages against all routing rules, reporting
+// each message's match and how the batch splits across task types. Only
+// rules are evaluated; the routing model is never called.
+func (h *RoutingRuleHandler) TestBatch(c *gin.Context) {
+	var req TestBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.Messages) == 0 {
+		errorResponse(c, http.StatusBadRequest, "messages must not be empty")
+		return
+	}
+	if len(req.Messages) > maxTestBatchMessages {
+		errorResponse(c, http.StatusBadRequest, fmt.Sprintf("at most %d messages can be tested at once", maxTestBatchMessages))
+		return
+	}
+
+	rules, err := h.ruleRepo.ListRules(c.Request.Context(), true)
+	if err != nil {
+		h.logger.Error("failed to list rules for batch test", zap.Error(err))
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	classified := service.NewRoutingClassifier(rules).ClassifyAll(req.Messages, runtime.GOMAXPROCS(0))
+	results := make([]gin.H, len(classified))
+	distribution := make(map[string]int)
+	unmatched := 0
+	for i, result := range classified {
+		results[i] = testResultResponse(result)
+		distribution[result.TaskType]++
+		if result.Rule == nil {
+			unmatched++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"total":        len(classified),
+		"unmatched":    unmatched,
+		"distribution": distribution,
+		"results":      results,
+	})
+}
 
+// testResultResponse renders a rule test result.
+func testResultResponse(result *service.ClassifyResult) gin.H {
 	resp := gin.H{
 		"final_task_type": result.TaskType,
 		"reason":          result.Reason,
@@ -240,7 +388,7 @@ func (h *RoutingRuleHandler) TestMessage(c *gin.Context) {
 			"task_type": result.Rule.TaskType,
 		}
 	}
-	c.JSON(http.StatusOK, resp)
+	return resp
 }
 
 // GetStats returns routing rule statistics.
@@ -251,6 +399,13 @@ func (h *RoutingRuleHandler) GetStats(c *gin.Context) {
 		errorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	idle, err := h.janitor.IdleRules(c.Request.Context())
+	if err != nil {
+		h.logger.Error("failed to get idle rules", zap.Error(err))
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	stats.IdleRules = idle
 	c.JSON(http.StatusOK, stats)
 }
 
@@ -281,3 +436,89 @@ func (h *RoutingRuleHandler) ListCustomRules(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"rules": rules})
 }
+
+// ExportRules returns all custom routing rules in the RuleExport format.
+// GET /api/config/routing/rules/export
+func (h *RoutingRuleHandler) ExportRules(c *gin.Context) {
+	rules, err := h.ruleRepo.ListCustomRules(c.Request.Context())
+	if err != nil {
+		h.logger.Error("failed to list custom rules for export", zap.Error(err))
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	export := models.RuleExport{
+		Version:    models.RuleExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Rules:      make([]models.RoutingRule, 0, len(rules)),
+	}
+	for _, rule := range rules {
+		export.Rules = append(export.Rules, *rule)
+	}
+	c.JSON(http.StatusOK, export)
+}
+
+// ImportRules imports routing rules from a RuleExport envelope as custom
+// rules. The mode query parameter is "merge" (default, skip rules whose name
+// is taken) or "replace" (delete all custom rules first). Rules that fail
+// validation are reported and not imported.
+// POST /api/config/routing/rules/import
+func (h *RoutingRuleHandler) ImportRules(c *gin.Context) {
+	mode := c.DefaultQuery("mode", "merge")
+	if mode != "merge" && mode != "replace" {
+		errorResponse(c, http.StatusBadRequest, "mode must be merge or replace")
+		return
+	}
+
+	var export models.RuleExport
+	if err := c.ShouldBindBodyWith(&export, binding.JSON); err != nil {
+		errorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if export.Version != models.RuleExportVersion {
+		errorResponse(c, http.StatusBadRequest, "unsupported export version: "+export.Version)
+		return
+	}
+	// Exports from before rollouts carry no rollout_percent; their rules
+	// applied to every request. An explicit 0 still fails validation.
+	var legacy struct {
+		Rules []struct {
+			RolloutPercent *int `json:"rollout_percent"`
+		} `json:"rules"`
+	}
+	if err := c.ShouldBindBodyWith(&legacy, binding.JSON); err == nil {
+		for i, r := range legacy.Rules {
+			if r.RolloutPercent == nil && i < len(export.Rules) {
+				export.Rules[i].RolloutPercent = 100
+			}
+		}
+	}
+
+	result := models.RuleImportResult{}
+	valid := make([]*models.RoutingRule, 0, len(export.Rules))
+	for i := range export.Rules {
+		rule := &export.Rules[i]
+		if err := h.validateRule(rule); err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, models.RuleImportError{Name: rule.Name, Error: err.Error()})
+			continue
+		}
+		valid = append(valid, rule)
+	}
+
+	inserted, skipped, err := h.ruleRepo.ImportCustomRules(c.Request.Context(), valid, mode == "replace")
+	if err != nil {
+		h.logger.Error("failed to import rules", zap.Error(err))
+		errorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	result.Inserted = inserted
+	result.Skipped = skipped
+
+	h.logger.Info("routing rules imported",
+		zap.String("mode", mode),
+		zap.Int("inserted", result.Inserted),
+		zap.Int("skipped", result.Skipped),
+		zap.Int("failed", result.Failed))
+	c.JSON(http.StatusOK, result)
+}
@@ -335,6 +335,41 @@ func TestRoutingRuleHandler_TestMessage_Success(t *testing.T) {
 	assert.NotEmpty(t, resp["final_task_type"])
 }
 
+func TestRoutingRuleHandler_TestMessage_Trace(t *testing.T) {
+	handler, _, adminID := setupRoutingRuleTest(t)
+
+	body := `{"message":"列出当前目录的文件","trace":true}`
+	c, w := testutil.NewTestContext()
+	c.Request = httptest.NewRequest("POST", "/api/config/routing/rules/test", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("current_user", &service.CurrentUser{
+		UserID:   adminID,
+		Username: "admin",
+		Role:     string(models.UserRoleAdmin),
+	})
+
+	handler.TestMessage(c)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		ConditionTraces []service.ConditionTraceResult `json:"condition_traces"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	var found bool
+	for _, trace := range resp.ConditionTraces {
+		if trace.RuleName != "simple_operations" {
+			continue
+		}
+		found = true
+		assert.True(t, trace.Result)
+		require.Len(t, trace.Steps, 2)
+		assert.Equal(t, "len(message)=9 < 200", trace.Steps[0].Expr)
+		assert.Equal(t, `contains(message, "分析")`, trace.Steps[1].Expr)
+		assert.False(t, trace.Steps[1].Result)
+	}
+	assert.True(t, found, "builtin rule conditions are traced")
+}
+
 func TestRoutingRuleHandler_TestMessage_EmptyMessage(t *testing.T) {
 	handler, _, adminID := setupRoutingRuleTest(t)
 
@@ -452,3 +487,250 @@ func TestRoutingRuleHandler_InvalidRuleID(t *testing.T) {
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
+
+func TestRoutingRuleHandler_ExportRules(t *testing.T) {
+	handler, repo, _ := setupRoutingRuleTest(t)
+	seedTestRules(t, repo)
+
+	c, w := testutil.NewTestContext()
+	c.Request = httptest.NewRequest("GET", "/api/config/routing/rules/export", nil)
+
+	handler.ExportRules(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var export models.RuleExport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+	assert.Equal(t, models.RuleExportVersion, export.Version)
+	assert.False(t, export.ExportedAt.IsZero())
+	require.Len(t, export.Rules, 2)
+	for _, rule := range export.Rules {
+		assert.False(t, rule.IsBuiltin)
+	}
+}
+
+func importRules(t *testing.T, handler *RoutingRuleHandler, mode string, export models.RuleExport) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(export)
+	require.NoError(t, err)
+	c, w := testutil.NewTestContext()
+	c.Request = httptest.NewRequest("POST", "/api/config/routing/rules/import?mode="+mode, bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler.ImportRules(c)
+	return w
+}
+
+func TestRoutingRuleHandler_ImportRules_Merge(t *testing.T) {
+	handler, repo, _ := setupRoutingRuleTest(t)
+	seedTestRules(t, repo)
+
+	w := importRules(t, handler, "merge", models.RuleExport{
+		Version: models.RuleExportVersion,
+		Rules: []models.RoutingRule{
+			{Name: "custom_simple", Keywords: []string{"重复"}, TaskType: "simple", Enabled: true, RolloutPercent: 100},
+			{Name: "imported_long", Condition: "len(message) > 2000", TaskType: "complex", Priority: 70, Enabled: true, RolloutPercent: 100},
+			{Name: "imported_builtin", Keywords: []string{"x"}, TaskType: "simple", IsBuiltin: true, Enabled: true, RolloutPercent: 100},
+			{Name: "bad_pattern", Pattern: "([a-z", TaskType: "simple", Enabled: true, RolloutPercent: 100},
+			{Name: "bad_condition", Condition: "lenn(message) > 1", TaskType: "simple", Enabled: true, RolloutPercent: 100},
+		},
+	})
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result models.RuleImportResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 2, result.Inserted)
+	assert.Equal(t, 1, result.Skipped)
+	assert.Equal(t, 2, result.Failed)
+	require.Len(t, result.Errors, 2)
+	assert.Equal(t, "bad_pattern", result.Errors[0].Name)
+	assert.Contains(t, result.Errors[0].Error, "invalid pattern")
+	assert.Equal(t, "bad_condition", result.Errors[1].Name)
+	assert.Contains(t, result.Errors[1].Error, "invalid condition")
+
+	custom, err := repo.ListCustomRules(context.Background())
+	require.NoError(t, err)
+	names := make([]string, 0, len(custom))
+	for _, rule := range custom {
+		names = append(names, rule.Name)
+		if rule.Name == "custom_simple" {
+			assert.Equal(t, []string{"列出"}, rule.Keywords, "existing rule must not be overwritten")
+		}
+	}
+	assert.ElementsMatch(t, []string{"custom_simple", "disabled_rule", "imported_long", "imported_builtin"}, names)
+}
+
+func TestRoutingRuleHandler_ImportRules_Replace(t *testing.T) {
+	handler, repo, _ := setupRoutingRuleTest(t)
+	seedTestRules(t, repo)
+
+	w := importRules(t, handler, "replace", models.RuleExport{
+		Version: models.RuleExportVersion,
+		Rules: []models.RoutingRule{
+			{Name: "custom_simple", Keywords: []string{"新"}, TaskType: "simple", Enabled: true, RolloutPercent: 100},
+			{Name: "builtin_complex", Keywords: []string{"冲突"}, TaskType: "simple", Enabled: true, RolloutPercent: 100},
+		},
+	})
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result models.RuleImportResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 1, result.Inserted)
+	assert.Equal(t, 1, result.Skipped, "name of a builtin rule stays taken")
+
+	custom, err := repo.ListCustomRules(context.Background())
+	require.NoError(t, err)
+	require.Len(t, custom, 1)
+	assert.Equal(t, "custom_simple", custom[0].Name)
+	assert.Equal(t, []string{"新"}, custom[0].Keywords)
+
+	builtin, err := repo.ListBuiltinRules(context.Background())
+	require.NoError(t, err)
+	require.Len(t, builtin, 1)
+	assert.Equal(t, []string{"架构", "设计"}, builtin[0].Keywords)
+}
+
+func TestRoutingRuleHandler_ImportRules_InvalidRequest(t *testing.T) {
+	handler, _, _ := setupRoutingRuleTest(t)
+
+	w := importRules(t, handler, "overwrite", models.RuleExport{Version: models.RuleExportVersion})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = importRules(t, handler, "merge", models.RuleExport{Version: "0.1"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRoutingRuleHandler_ImportRules_LegacyRollout(t *testing.T) {
+	handler, repo, _ := setupRoutingRuleTest(t)
+
+	// Exports from before rollouts have no rollout_percent; an explicit 0 is invalid.
+	body := `{"version":"` + models.RuleExportVersion + `","rules":[
+		{"name":"legacy","keywords":["旧"],"task_type":"simple","enabled":true},
+		{"name":"zero","keywords":["零"],"task_type":"simple","enabled":true,"rollout_percent":0}]}`
+	c, w := testutil.NewTestContext()
+	c.Request = httptest.NewRequest("POST", "/api/config/routing/rules/import", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler.ImportRules(c)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result models.RuleImportResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 1, result.Inserted)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "zero", result.Errors[0].Name)
+	assert.Contains(t, result.Errors[0].Error, "rollout_percent")
+
+	custom, err := repo.ListCustomRules(context.Background())
+	require.NoError(t, err)
+	require.Len(t, custom, 1)
+	assert.Equal(t, 100, custom[0].RolloutPercent)
+}
+
+func postRuleJSON(handler gin.HandlerFunc, body string, params ...gin.Param) *httptest.ResponseRecorder {
+	c, w := testutil.NewTestContext()
+	c.Request = httptest.NewRequest("POST", "/api/config/routing/rules", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	handler(c)
+	return w
+}
+
+func TestRoutingRuleHandler_CreateRule_RejectsInvalidRule(t *testing.T) {
+	handler, repo, _ := setupRoutingRuleTest(t)
+
+	w := postRuleJSON(handler.CreateRule, `{"name":"bad_regex","pattern":"(unclosed","task_type":"complex"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid pattern")
+
+	w = postRuleJSON(handler.CreateRule, `{"name":"bad_condition","condition":"len(message) >","task_type":"complex"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid condition")
+
+	w = postRuleJSON(handler.CreateRule, `{"name":"zero_rollout","keywords":["x"],"task_type":"complex","rollout_percent":0}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "rollout_percent")
+
+	rules, err := repo.ListRules(context.Background(), false)
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+}
+
+func TestRoutingRuleHandler_UpdateRule_RejectsInvalidRule(t *testing.T) {
+	handler, repo, _ := setupRoutingRuleTest(t)
+	ctx := context.Background()
+	id, err := repo.AddRule(ctx, &models.RoutingRule{Name: "valid", Pattern: "^ok$", TaskType: "default", Enabled: true})
+	require.NoError(t, err)
+	param := gin.Param{Key: "rule_id", Value: fmt.Sprintf("%d", id)}
+
+	w := postRuleJSON(handler.UpdateRule, `{"pattern":"[a-"}`, param)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid pattern")
+
+	w = postRuleJSON(handler.UpdateRule, `{"condition":"nosuchfn(message)"}`, param)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid condition")
+
+	rule, err := repo.GetRule(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "^ok$", rule.Pattern)
+	assert.Empty(t, rule.Condition)
+}
+
+func TestRoutingRuleHandler_ValidateRule(t *testing.T) {
+	handler, repo, _ := setupRoutingRuleTest(t)
+
+	w := postRuleJSON(handler.ValidateRule, `{"name":"dry_run","pattern":"(?i)deploy","condition":"len(message) > 10","task_type":"complex"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"valid":true}`, w.Body.String())
+
+	w = postRuleJSON(handler.ValidateRule, `{"name":"dry_run","pattern":"(?<bad)","task_type":"complex"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid pattern")
+
+	rules, err := repo.ListRules(context.Background(), false)
+	require.NoError(t, err)
+	assert.Empty(t, rules, "validation must not persist the rule")
+}
+
+func TestRoutingRuleHandler_TestBatch(t *testing.T) {
+	handler, repo, _ := setupRoutingRuleTest(t)
+	seedTestRules(t, repo)
+
+	w := postRuleJSON(handler.TestBatch, `{"messages":["帮我设计一个微服务架构","列出所有文件","禁用这条","今天天气"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Total        int            `json:"total"`
+		Unmatched    int            `json:"unmatched"`
+		Distribution map[string]int `json:"distribution"`
+		Results      []struct {
+			FinalTaskType string `json:"final_task_type"`
+			MatchedRule   *struct {
+				Name string `json:"name"`
+			} `json:"matched_rule"`
+		} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 4, resp.Total)
+	assert.Equal(t, 2, resp.Unmatched, "disabled rules do not match")
+	assert.Equal(t, map[string]int{"complex": 1, "simple": 1, "default": 2}, resp.Distribution)
+	require.Len(t, resp.Results, 4)
+	assert.Equal(t, "complex", resp.Results[0].FinalTaskType)
+	assert.Equal(t, "simple", resp.Results[1].FinalTaskType)
+	assert.NotNil(t, resp.Results[1].MatchedRule)
+	assert.Nil(t, resp.Results[3].MatchedRule)
+}
+
+func TestRoutingRuleHandler_TestBatch_InvalidRequest(t *testing.T) {
+	handler, _, _ := setupRoutingRuleTest(t)
+
+	messages := make([]string, maxTestBatchMessages+1)
+	for i := range messages {
+		messages[i] = "hi"
+	}
+	tooMany, err := json.Marshal(map[string]any{"messages": messages})
+	require.NoError(t, err)
+
+	for _, body := range []string{`{}`, `{"messages":[]}`, string(tooMany)} {
+		w := postRuleJSON(handler.TestBatch, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+// ShadowLogsHandler serves the results of requests mirrored to shadow
+// providers.
+type ShadowLogsHandler struct {
+	repo   *repository.ShadowLogRepository
+	logger *zap.Logger
+}
+
+// NewShadowLogsHandler creates a new ShadowLogsHandler.
+func NewShadowLogsHandler(repo *repository.ShadowLogRepository, logger *zap.Logger) *ShadowLogsHandler {
+	return &ShadowLogsHandler{repo: repo, logger: logger}
+}
+
+// ListShadowLogs handles GET /api/logs/shadow.
+func (h *ShadowLogsHandler) ListShadowLogs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > maxLogLimit {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), logQueryTimeout)
+	defer cancel()
+
+	logs, total, err := h.repo.List(ctx, limit, offset)
+	if err != nil {
+		h.logger.Error("failed to list shadow logs", zap.Error(err))
+		errorResponse(c, http.StatusInternalServerError, "Failed to list shadow logs")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"logs":   logs,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
@@ -15,6 +15,7 @@ import (
 type UserHandler struct {
 	userRepo    repository.UserRepository
 	authService *service.AuthService
+	budget      *service.BudgetService
 }
 
 // NewUserHandler creates a new UserHandler.
@@ -25,6 +26,11 @@ func NewUserHandler(userRepo repository.UserRepository, authService *service.Aut
 	}
 }
 
+// SetBudget enables the spend report of GET /api/users/me/usage.
+func (h *UserHandler) SetBudget(b *service.BudgetService) {
+	h.budget = b
+}
+
 // ListUsers lists all users (admin only).
 // GET /api/users?offset=0&limit=50
 func (h *UserHandler) ListUsers(c *gin.Context) {
@@ -65,6 +71,8 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		Username string `json:"username" binding:"required,min=3,max=50"`
 		Password string `json:"password" binding:"required,min=8"`
 		Role     string `json:"role" binding:"required,oneof=admin user"`
+		// Monthly spend cap in USD; omitted or 0 = unlimited.
+		MonthlyBudgetUSD float64 `json:"monthly_budget_usd" binding:"min=0"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -92,6 +100,9 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		Role:         models.UserRole(req.Role),
 		IsActive:     true,
 	}
+	if req.MonthlyBudgetUSD > 0 {
+		user.MonthlyBudgetUSD = &req.MonthlyBudgetUSD
+	}
 
 	id, err := h.userRepo.Insert(c.Request.Context(), user)
 	if err != nil {
@@ -116,6 +127,8 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		Username string `json:"username" binding:"omitempty,min=3,max=50"`
 		Role     string `json:"role" binding:"omitempty,oneof=admin user"`
 		IsActive *bool  `json:"is_active"`
+		// Monthly spend cap in USD; 0 removes it.
+		MonthlyBudgetUSD *float64 `json:"monthly_budget_usd" binding:"omitempty,min=0"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -144,11 +157,19 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	if req.IsActive != nil {
 		user.IsActive = *req.IsActive
 	}
+	if req.MonthlyBudgetUSD != nil {
+		if *req.MonthlyBudgetUSD > 0 {
+			user.MonthlyBudgetUSD = req.MonthlyBudgetUSD
+		} else {
+			user.MonthlyBudgetUSD = nil
+		}
+	}
 
 	if err := h.userRepo.Update(c.Request.Context(), user); err != nil {
 		errorResponse(c, http.StatusInternalServerError, "Failed to update user")
 		return
 	}
+	h.authService.InvalidateAPIKeys()
 
 	c.JSON(http.StatusOK, user)
 }
@@ -184,6 +205,7 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		errorResponse(c, http.StatusInternalServerError, "Failed to delete user")
 		return
 	}
+	h.authService.InvalidateAPIKeys()
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
 }
@@ -259,6 +281,35 @@ func (h *UserHandler) GetCurrentUser(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
+// GetMyUsage returns the current user's spend this month and the budget
+// left.
+// GET /api/users/me/usage
+func (h *UserHandler) GetMyUsage(c *gin.Context) {
+	currentUser := middleware.GetCurrentUser(c)
+	if currentUser == nil {
+		errorResponse(c, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+	if h.budget == nil {
+		errorResponse(c, http.StatusServiceUnavailable, "Usage reporting is not available")
+		return
+	}
+
+	user, err := h.userRepo.FindByID(c.Request.Context(), currentUser.UserID)
+	if err != nil {
+		errorResponse(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	usage, err := h.budget.Usage(c.Request.Context(), user.ID, string(user.Role), user.MonthlyBudgetUSD)
+	if err != nil {
+		errorResponse(c, http.StatusInternalServerError, "Failed to compute usage")
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
 // AdminChangePassword allows admin to change any user's password.
 // POST /api/users/:id/password
 func (h *UserHandler) AdminChangePassword(c *gin.Context) {
@@ -10,10 +10,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
 	"github.com/user/llm-proxy-go/internal/models"
 	"github.com/user/llm-proxy-go/internal/repository"
 	"github.com/user/llm-proxy-go/internal/service"
@@ -269,3 +271,63 @@ func TestUserHandler_DeleteUser_CannotDeleteSelf(t *testing.T) {
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
+
+func TestUserHandler_MonthlyBudget(t *testing.T) {
+	handler, userRepo, _, adminID := setupUserTest(t)
+	ctx := context.Background()
+
+	userID, err := userRepo.Insert(ctx, &models.User{
+		Username:     "budgeted",
+		PasswordHash: "$2a$10$hashedpassword",
+		Role:         models.UserRoleUser,
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+
+	update := func(budget float64) {
+		c, w := testutil.NewTestContextWithRequest("PUT", fmt.Sprintf("/api/users/%d", userID), map[string]any{"monthly_budget_usd": budget})
+		c.Params = []gin.Param{{Key: "id", Value: fmt.Sprintf("%d", userID)}}
+		c.Set("current_user", &service.CurrentUser{UserID: adminID, Username: "admin", Role: "admin"})
+		handler.UpdateUser(c)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	update(25)
+	user, err := userRepo.FindByID(ctx, userID)
+	require.NoError(t, err)
+	require.NotNil(t, user.MonthlyBudgetUSD)
+	assert.Equal(t, 25.0, *user.MonthlyBudgetUSD)
+
+	// No budget service configured.
+	c, w := testutil.NewTestContextWithRequest("GET", "/api/users/me/usage", nil)
+	c.Set("current_user", &service.CurrentUser{UserID: userID, Username: "budgeted", Role: "user"})
+	handler.GetMyUsage(c)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	handler.SetBudget(service.NewBudgetService(stubSpendRepo{spent: 10}, config.BudgetConfig{ExemptAdmins: true}))
+	c, w = testutil.NewTestContextWithRequest("GET", "/api/users/me/usage", nil)
+	c.Set("current_user", &service.CurrentUser{UserID: userID, Username: "budgeted", Role: "user"})
+	handler.GetMyUsage(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	var usage service.BudgetUsage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &usage))
+	assert.Equal(t, 10.0, usage.SpentUSD)
+	require.NotNil(t, usage.RemainingUSD)
+	assert.Equal(t, 15.0, *usage.RemainingUSD)
+
+	// Zero clears the budget.
+	update(0)
+	user, err = userRepo.FindByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Nil(t, user.MonthlyBudgetUSD)
+}
+
+// stubSpendRepo reports a fixed spend for every user.
+type stubSpendRepo struct {
+	repository.RequestLogRepository
+	spent float64
+}
+
+func (s stubSpendRepo) MonthlySpendForUser(ctx context.Context, userID int64, month time.Time) (float64, error) {
+	return s.spent, nil
+}
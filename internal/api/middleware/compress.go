@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Compress returns a Gin middleware that gzip- or deflate-encodes responses
+// for clients that accept it. Only responses whose first write is at least
+// minBytes are compressed, which covers JSON bodies written in one piece.
+// Server-sent event streams are never compressed, so every event still
+// reaches the client as soon as it is flushed. minBytes <= 0 disables it.
+func Compress(minBytes int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if minBytes <= 0 {
+			c.Next()
+			return
+		}
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" {
+			c.Next()
+			return
+		}
+		cw := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minBytes: minBytes}
+		c.Writer = cw
+		defer cw.close()
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header,
+// preferring gzip. It returns "" when neither is acceptable.
+func negotiateEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[name] = q > 0
+	}
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	case accepted["*"]:
+		for _, encoding := range []string{"gzip", "deflate"} {
+			if _, listed := accepted[encoding]; !listed {
+				return encoding
+			}
+		}
+	}
+	return ""
+}
+
+// flushWriteCloser is the part of gzip.Writer and zlib.Writer used here.
+type flushWriteCloser interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter decides on the first write whether to compress, once the
+// handler has set the response headers.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minBytes int
+	decided  bool
+	enc      flushWriteCloser // nil = written as is
+}
+
+func (w *compressWriter) decide(n int) {
+	w.decided = true
+	h := w.Header()
+	status := w.Status()
+	if status == http.StatusNoContent || status == http.StatusNotModified || h.Get("Content-Encoding") != "" ||
+		strings.HasPrefix(h.Get("Content-Type"), "text/event-stream") {
+		return
+	}
+	h.Add("Vary", "Accept-Encoding")
+	if n < w.minBytes {
+		return
+	}
+	h.Set("Content-Encoding", w.encoding)
+	h.Del("Content-Length")
+	if w.encoding == "gzip" {
+		w.enc = gzip.NewWriter(w.ResponseWriter)
+	} else {
+		w.enc = zlib.NewWriter(w.ResponseWriter)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.decide(len(p))
+	}
+	if w.enc == nil {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.enc.Write(p)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Flush() {
+	if w.enc != nil {
+		_ = w.enc.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) close() {
+	if w.enc != nil {
+		_ = w.enc.Close()
+	}
+}
@@ -0,0 +1,87 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "gzip", negotiateEncoding("gzip, deflate, br"))
+	assert.Equal(t, "deflate", negotiateEncoding("deflate"))
+	assert.Equal(t, "deflate", negotiateEncoding("gzip;q=0, deflate;q=0.5"))
+	assert.Equal(t, "gzip", negotiateEncoding("*"))
+	assert.Equal(t, "deflate", negotiateEncoding("gzip;q=0, *"))
+	assert.Equal(t, "", negotiateEncoding("br"))
+	assert.Equal(t, "", negotiateEncoding(""))
+	assert.Equal(t, "", negotiateEncoding("identity, *;q=0"))
+}
+
+func TestCompress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	large := strings.Repeat(`{"type":"text","text":"hello"},`, 100)
+	r := gin.New()
+	r.Use(Compress(1024))
+	r.GET("/large", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"content": large}) })
+	r.GET("/small", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+	r.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			c.Writer.WriteString("data: " + large + "\n\n")
+			c.Writer.Flush()
+		}
+	})
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/large", "gzip, deflate")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Less(t, w.Body.Len(), len(large))
+	zr, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `{\"type\":\"text\"`)
+
+	w = get("/large", "deflate")
+	assert.Equal(t, "deflate", w.Header().Get("Content-Encoding"))
+	fr, err := zlib.NewReader(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	body, err = io.ReadAll(fr)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"content"`)
+
+	w = get("/large", "")
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "client did not ask")
+	assert.Contains(t, w.Body.String(), `"content"`)
+
+	w = get("/small", "gzip")
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "below the size threshold")
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.JSONEq(t, `{"ok":true}`, w.Body.String())
+
+	w = get("/stream", "gzip")
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "event streams stay uncompressed")
+	assert.Equal(t, 3, strings.Count(w.Body.String(), "data: "))
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/llm-proxy-go/internal/service"
+)
+
+// ConcurrencyRetryAfter is the Retry-After, in seconds, sent with requests
+// rejected by the concurrency limit.
+const ConcurrencyRetryAfter = "1"
+
+// LimitConcurrency returns a Gin middleware that admits a proxy request only
+// while limiter has a free slot, answering 503 with Retry-After otherwise.
+// The slot is held until the handler returns, which for a stream is when
+// it ends or the client disconnects. Admission is against the combined
+// budget without reading the body; the handler classifies the request as
+// streaming or not once it has parsed it (see GetConcurrencySlot).
+func LimitConcurrency(limiter *service.ConcurrencyLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+		slot, ok := limiter.Admit()
+		if !ok {
+			c.Header("Retry-After", ConcurrencyRetryAfter)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"type": "error",
+				"error": gin.H{
+					"type":    "overloaded_error",
+					"message": "Too many concurrent requests, please retry shortly",
+				},
+			})
+			return
+		}
+		defer slot.Release()
+		c.Set("concurrency_slot", slot)
+		c.Next()
+	}
+}
+
+// GetConcurrencySlot retrieves the request's concurrency slot from context.
+// It returns nil, which classifies as always admitted, when there is none.
+func GetConcurrencySlot(c *gin.Context) *service.ConcurrencySlot {
+	slot, ok := c.Get("concurrency_slot")
+	if !ok {
+		return nil
+	}
+	s, _ := slot.(*service.ConcurrencySlot)
+	return s
+}
@@ -0,0 +1,93 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/service"
+)
+
+func TestLimitConcurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := service.NewConcurrencyLimiter(1, 0)
+	entered := make(chan struct{}, 1)
+	r := gin.New()
+	r.Use(LimitConcurrency(limiter))
+	r.POST("/v1/messages", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		if !GetConcurrencySlot(c).Classify(strings.Contains(string(body), `"stream":true`)) {
+			c.Status(http.StatusServiceUnavailable)
+			return
+		}
+		if strings.Contains(string(body), "hold") {
+			// Like a stream: runs until the client goes away.
+			entered <- struct{}{}
+			<-c.Request.Context().Done()
+			return
+		}
+		c.String(http.StatusOK, string(body))
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	post := func(ctx context.Context, body string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/v1/messages", strings.NewReader(body))
+		require.NoError(t, err)
+		return http.DefaultClient.Do(req)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if resp, err := post(ctx, `{"stream":true,"text":"hold"}`); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-entered
+	snap := limiter.Snapshot()
+	assert.Equal(t, 1, snap.InFlight)
+	assert.Equal(t, 1, snap.InFlightStreams)
+
+	resp, err := post(context.Background(), `{"stream":false}`)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+	assert.Equal(t, int64(1), limiter.Snapshot().Rejected)
+
+	// The client disconnecting mid-stream frees the slot.
+	cancel()
+	<-done
+	assert.Eventually(t, func() bool { return limiter.Snapshot().InFlight == 0 }, time.Second, 5*time.Millisecond)
+
+	// The middleware leaves the body to the handler.
+	resp, err = post(context.Background(), `{"stream":false,"text":"hello"}`)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	got, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, `{"stream":false,"text":"hello"}`, string(got))
+}
+
+func TestLimitConcurrency_Disabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(LimitConcurrency(nil))
+	r.POST("/v1/messages", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/llm-proxy-go/internal/service"
+)
+
+// Maintenance returns a Gin middleware that answers proxy requests with 503
+// and Retry-After while maintenance mode is enabled. It is only mounted on
+// the proxy routes, so the admin API keeps working during maintenance.
+func Maintenance(mode *service.MaintenanceMode) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := mode.Status()
+		if !status.Enabled {
+			c.Next()
+			return
+		}
+		if status.RetryAfterSeconds > 0 {
+			c.Header("Retry-After", strconv.Itoa(status.RetryAfterSeconds))
+		}
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"type": "error",
+			"error": gin.H{
+				"type":    "overloaded_error",
+				"message": status.Message,
+			},
+		})
+	}
+}
@@ -0,0 +1,59 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/internal/service"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+func TestMaintenance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := repository.NewSystemConfigRepository(testutil.NewTestDBWithDefaults(t))
+	mode := service.NewMaintenanceMode(repo, zap.NewNop())
+	r := gin.New()
+	v1 := r.Group("/v1")
+	v1.Use(Maintenance(mode))
+	v1.POST("/messages", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/api/status", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(`{"stream":true}`)))
+		return w
+	}
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/v1/messages").Code)
+
+	require.NoError(t, repo.UpdateMaintenanceConfig(t.Context(), map[string]any{
+		"enabled":             true,
+		"message":             "Rotating provider keys",
+		"retry_after_seconds": 120,
+	}))
+	mode.Invalidate()
+	w := do(http.MethodPost, "/v1/messages")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "120", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "Rotating provider keys")
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/status").Code, "the admin API stays up")
+
+	require.NoError(t, repo.UpdateMaintenanceConfig(t.Context(), map[string]any{"enabled": false}))
+	mode.Invalidate()
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/v1/messages").Code)
+
+	// A nil mode never blocks.
+	r = gin.New()
+	r.Use(Maintenance(nil))
+	r.POST("/v1/messages", func(c *gin.Context) { c.Status(http.StatusOK) })
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/v1/messages").Code)
+}
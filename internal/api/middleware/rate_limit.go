@@ -27,6 +27,7 @@ func DefaultRateLimitConfig() *RateLimitConfig {
 		ExemptPaths: []string{
 			"/api/health",
 			"/api/status",
+			"/metrics",
 			"/css/",
 			"/js/",
 			"/vendor/",
@@ -3,6 +3,7 @@ package api
 import (
 	"database/sql"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/user/llm-proxy-go/internal/api/handler"
@@ -23,22 +24,47 @@ type ServerDeps struct {
 	ProxyService     *service.ProxyService
 	AuthService      *service.AuthService
 	HealthChecker    *service.HealthChecker
+	LoadBalancer     *service.LoadBalancer // Shared with the proxy service; nil creates one without success rates
+	Affinity         *service.ConversationAffinity // Shared with the proxy service; nil = no conversation stickiness
 	RoutingCache     *service.RoutingCache
 	LLMRouter        *service.LLMRouter
 	RoutingAnalyzer  *service.RoutingAnalyzer
 	UserRepo         repository.UserRepository
 	KeyRepo          repository.APIKeyRepository
 	LogRepo          repository.RequestLogRepository
+	LogFeed          *repository.RequestLogFeed // Saved request logs for the live stream; nil disables it
 	EmbeddingRepo    *repository.EmbeddingModelRepository
 	ModelRepo        *repository.SQLModelRepository
 	ProviderRepo     *repository.SQLProviderRepository
 	RoutingModelRepo *repository.RoutingModelRepository
 	RoutingConfigRepo *repository.RoutingConfigRepository
 	RoutingRuleRepo   *repository.RoutingRuleRepo
+	ModelRoleRepo     *repository.ModelRoleRepository
+	RoleSet           *service.RoleSet
 	EmbeddingCacheRepo *repository.EmbeddingCacheRepository
+	EmbeddingRebuilder *service.EmbeddingRebuilder
+	CacheWarmer        *service.CacheWarmer
 	SystemConfigRepo *repository.SystemConfigRepository
 	AnalysisReportRepo *repository.AnalysisReportRepository
+	ShadowLogRepo    *repository.ShadowLogRepository
 	EndpointStore    *service.EndpointStore
+	ContentPolicy    *service.ContentPolicy
+	Redactor         *service.ContentRedactor
+	RetryBudget      *service.RetryBudget
+	Concurrency      *service.ConcurrencyLimiter // Caps proxy requests in flight; nil = unlimited
+	Maintenance      *service.MaintenanceMode    // Pauses proxy traffic when enabled; nil = never
+	RuleJanitor      *service.RuleJanitor
+	StreamResume     *service.StreamResumeStore
+	Idempotency      *service.IdempotencyStore
+	Budget           *service.BudgetService
+	StatsCache       *service.StatsCache // Caches /api/logs/stats results; nil queries every time
+	MaxRequestBytes  int64 // Proxy request body limit, 0 = unlimited
+	CompressMinBytes int   // Smallest proxy response compressed for the client, 0 = never
+	StreamHeartbeat  time.Duration // SSE keepalive interval before a stream's first data, 0 = none
+	DefaultFallback  bool          // Serve smart-routed requests from the default role when the inferred one is unavailable
+	StripThinking    bool          // Leave thinking blocks out of logged response content
+	ValidateTools    bool          // Reject malformed tool definitions with a local 400
+	Metrics          http.Handler // Served at /metrics when set
 	RateLimit        *middleware.RateLimitConfig
 	DB               *sql.DB
 	Logger           *zap.Logger
@@ -72,9 +98,17 @@ func NewServer(deps ServerDeps) *Server {
 	healthHandler := handler.NewHealthHandler(deps.HealthChecker)
 	r.GET("/api/health", healthHandler.Health)
 
+	// Prometheus metrics (no auth).
+	if deps.Metrics != nil {
+		r.GET("/metrics", gin.WrapH(deps.Metrics))
+	}
+
 	// Create ModelSelector and EndpointSelector
 	modelSelector := service.NewModelSelector(deps.HealthChecker, logger)
-	loadBalancer := service.NewLoadBalancer(deps.SystemConfigRepo)
+	loadBalancer := deps.LoadBalancer
+	if loadBalancer == nil {
+		loadBalancer = service.NewLoadBalancer(deps.SystemConfigRepo)
+	}
 	endpointSelector := service.NewEndpointSelector(
 		modelSelector,
 		deps.HealthChecker,
@@ -83,12 +117,28 @@ func NewServer(deps ServerDeps) *Server {
 		deps.RoutingConfigRepo,
 		logger,
 	)
+	endpointSelector.SetRoleSet(deps.RoleSet)
+	endpointSelector.SetDefaultFallback(deps.DefaultFallback)
+	endpointSelector.SetConversationAffinity(deps.Affinity)
 
 	// Proxy endpoint (API key auth).
 	proxyHandler := handler.NewProxyHandler(deps.ProxyService, authService, endpointSelector, deps.RoutingConfigRepo, logger)
+	proxyHandler.SetContentPolicy(deps.ContentPolicy)
+	proxyHandler.SetContentRedactor(deps.Redactor)
+	proxyHandler.SetStripThinking(deps.StripThinking)
+	proxyHandler.SetToolValidation(deps.ValidateTools)
+	proxyHandler.SetStreamResume(deps.StreamResume)
+	proxyHandler.SetIdempotency(deps.Idempotency)
+	proxyHandler.SetBudget(deps.Budget)
+	proxyHandler.SetMaxRequestBytes(deps.MaxRequestBytes)
+	proxyHandler.SetStreamHeartbeat(deps.StreamHeartbeat)
 	v1 := r.Group("/v1")
+	v1.Use(middleware.Maintenance(deps.Maintenance))
+	v1.Use(middleware.LimitConcurrency(deps.Concurrency))
+	v1.Use(middleware.Compress(deps.CompressMinBytes))
 	{
 		v1.POST("/messages", proxyHandler.Messages)
+		v1.POST("/chat/completions", proxyHandler.ChatCompletions)
 	}
 
 	// Auth endpoints.
@@ -103,11 +153,18 @@ func NewServer(deps ServerDeps) *Server {
 
 	// User management endpoints.
 	userHandler := handler.NewUserHandler(deps.UserRepo, authService)
+	userHandler.SetBudget(deps.Budget)
+	logsHandler := handler.NewLogsHandler(deps.LogRepo, logger)
+	logsHandler.SetLogFeed(deps.LogFeed)
+	logsHandler.SetStatsCache(deps.StatsCache)
+	logsHandler.SetLogReplayer(service.NewLogReplayer(deps.LogRepo, endpointSelector, deps.ProxyService, deps.EndpointStore.GetEndpoints, logger))
 	userGroup := r.Group("/api/users")
 	userGroup.Use(middleware.RequireAuth(authService))
 	{
 		userGroup.GET("/me", userHandler.GetCurrentUser)
+		userGroup.GET("/me/usage", userHandler.GetMyUsage)
 		userGroup.POST("/change-password", userHandler.ChangePassword)
+		userGroup.GET("/:id/usage", logsHandler.GetUserUsage) // Admin, or the user themself
 		adminGroup := userGroup.Group("")
 		adminGroup.Use(middleware.RequireAdmin())
 		{
@@ -122,19 +179,23 @@ func NewServer(deps ServerDeps) *Server {
 
 	// API Key management endpoints.
 	keyHandler := handler.NewAPIKeyHandler(deps.KeyRepo)
+	keyHandler.SetAuthService(authService)
+	keyHandler.SetLogRepo(deps.LogRepo)
 	keyGroup := r.Group("/api/keys")
 	keyGroup.Use(middleware.RequireAuth(authService))
 	{
 		keyGroup.GET("", keyHandler.ListAPIKeys)
 		keyGroup.POST("", keyHandler.CreateAPIKey)
+		keyGroup.POST("/bulk", middleware.RequireAdmin(), keyHandler.BulkCreateAPIKeys)
 		keyGroup.GET("/:id", keyHandler.GetAPIKey)
+		keyGroup.GET("/:id/stats", keyHandler.GetAPIKeyStats)
+		keyGroup.PUT("/:id", middleware.RequireAdmin(), keyHandler.UpdateAPIKey)
 		keyGroup.POST("/:id/revoke", keyHandler.RevokeAPIKey)
 		keyGroup.POST("/:id/toggle", keyHandler.ToggleAPIKey)
 		keyGroup.DELETE("/:id", keyHandler.DeleteAPIKey)
 	}
 
 	// Logs endpoints (admin only).
-	logsHandler := handler.NewLogsHandler(deps.LogRepo, logger)
 	routingAnalysisHandler := handler.NewRoutingAnalysisHandler(deps.LogRepo, deps.RoutingRuleRepo, logger)
 	logsGroup := r.Group("/api/logs")
 	logsGroup.Use(middleware.RequireAuth(authService))
@@ -143,8 +204,14 @@ func NewServer(deps ServerDeps) *Server {
 		logsGroup.GET("", logsHandler.GetRequestLogs)
 		logsGroup.DELETE("", logsHandler.DeleteRequestLogs)
 		logsGroup.GET("/stats", logsHandler.GetLogStats)
+		logsGroup.GET("/export", logsHandler.ExportRequestLogs)
+		logsGroup.GET("/stream", logsHandler.StreamRequestLogs)
+		if deps.ShadowLogRepo != nil {
+			logsGroup.GET("/shadow", handler.NewShadowLogsHandler(deps.ShadowLogRepo, logger).ListShadowLogs)
+		}
 		logsGroup.GET("/:id", routingAnalysisHandler.GetLogDetail)
 		logsGroup.POST("/:id/mark-inaccurate", routingAnalysisHandler.MarkLogInaccurate)
+		logsGroup.POST("/:id/replay", logsHandler.ReplayLog)
 	}
 
 	// Routing analysis endpoints (admin only).
@@ -181,6 +248,10 @@ func NewServer(deps ServerDeps) *Server {
 
 	// Admin status endpoints.
 	statusHandler := handler.NewStatusHandler(deps.HealthChecker, deps.ModelRepo, deps.LogRepo, deps.LLMRouter, deps.EndpointStore)
+	statusHandler.SetContentPolicy(deps.ContentPolicy)
+	statusHandler.SetRetryBudget(deps.RetryBudget)
+	statusHandler.SetConcurrencyLimiter(deps.Concurrency)
+	statusHandler.SetLoadBalancer(loadBalancer)
 	statusGroup := r.Group("/api")
 	statusGroup.Use(middleware.RequireAuth(authService))
 	{
@@ -191,19 +262,25 @@ func NewServer(deps ServerDeps) *Server {
 		adminStatusGroup.Use(middleware.RequireAdmin())
 		{
 			adminStatusGroup.POST("/health/check-now", statusHandler.TriggerHealthCheck)
+			adminStatusGroup.POST("/routing/trace", statusHandler.TraceRouting)
 		}
 	}
 
 	// Admin config endpoints (admin only).
 	configHandler := handler.NewConfigHandler(deps.SystemConfigRepo)
+	configHandler.SetEndpointStore(deps.EndpointStore)
+	configHandler.SetMaintenanceMode(deps.Maintenance)
 	routingHandler := handler.NewRoutingHandler(deps.RoutingModelRepo, deps.RoutingConfigRepo)
+	routingHandler.SetRoutingCache(deps.RoutingCache)
+	routingHandler.SetRoleSet(deps.RoleSet)
 	modelHandler := handler.NewModelHandler(deps.ModelRepo, deps.EndpointStore)
+	modelHandler.SetRoleSet(deps.RoleSet)
 	providerHandler := handler.NewProviderHandler(deps.ProviderRepo, deps.ModelRepo, service.NewModelDetector(logger), deps.EndpointStore)
 	configGroup := r.Group("/api/config")
 	configGroup.Use(middleware.RequireAuth(authService))
 	configGroup.Use(middleware.RequireAdmin())
 	{
-		// System config (routing/load-balance/health-check/ui)
+		// System config (routing/load-balance/health-check/ui/log-retention/anthropic-version/health-webhook/maintenance)
 		configGroup.GET("/routing", configHandler.GetRoutingConfig)
 		configGroup.PUT("/routing", configHandler.UpdateRoutingConfig)
 		configGroup.GET("/load-balance", configHandler.GetLoadBalanceConfig)
@@ -212,9 +289,17 @@ func NewServer(deps ServerDeps) *Server {
 		configGroup.PUT("/health-check", configHandler.UpdateHealthCheckConfig)
 		configGroup.GET("/ui", configHandler.GetUIConfig)
 		configGroup.PUT("/ui", configHandler.UpdateUIConfig)
+		configGroup.GET("/log-retention", configHandler.GetLogRetentionConfig)
+		configGroup.PUT("/log-retention", configHandler.UpdateLogRetentionConfig)
+		configGroup.GET("/anthropic-version", configHandler.GetAnthropicVersionConfig)
+		configGroup.PUT("/anthropic-version", configHandler.UpdateAnthropicVersionConfig)
+		configGroup.GET("/health-webhook", configHandler.GetHealthWebhookConfig)
+		configGroup.PUT("/health-webhook", configHandler.UpdateHealthWebhookConfig)
+		configGroup.GET("/maintenance", configHandler.GetMaintenanceConfig)
+		configGroup.POST("/maintenance", configHandler.SetMaintenanceConfig)
 
 		// Config reload / migrate / legacy
-		configGroup.POST("/reload", handler.ReloadConfig)
+		configGroup.POST("/reload", configHandler.ReloadConfig)
 		configGroup.POST("/migrate", handler.MigrateConfig)
 		configGroup.GET("/endpoints", handler.ListEndpoints)
 		configGroup.POST("/endpoints", handler.CreateEndpoint)
@@ -222,9 +307,18 @@ func NewServer(deps ServerDeps) *Server {
 
 		// Backup / restore
 		backupHandler := handler.NewBackupHandler(deps.DB, deps.EndpointStore)
+		backupHandler.SetRoleSet(deps.RoleSet)
+		backupHandler.SetCaches(authService, deps.RoutingConfigRepo)
 		configGroup.GET("/backup/export", backupHandler.Export)
 		configGroup.POST("/backup/import", backupHandler.Import)
 
+		// Task-type roles
+		roleHandler := handler.NewRoleHandler(deps.ModelRoleRepo, deps.RoleSet)
+		configGroup.GET("/roles", roleHandler.ListRoles)
+		configGroup.POST("/roles", roleHandler.CreateRole)
+		configGroup.PUT("/roles/:name", roleHandler.UpdateRole)
+		configGroup.DELETE("/roles/:name", roleHandler.DeleteRole)
+
 		// Model management
 		configGroup.GET("/models", modelHandler.ListModels)
 		configGroup.GET("/models/:model_id", modelHandler.GetModel)
@@ -240,6 +334,7 @@ func NewServer(deps ServerDeps) *Server {
 		configGroup.DELETE("/providers/:provider_id", providerHandler.DeleteProvider)
 		configGroup.GET("/providers/:provider_id/models", providerHandler.GetProviderModels)
 		configGroup.POST("/detect-models", providerHandler.DetectModels)
+		configGroup.GET("/validate", providerHandler.ValidateConfig)
 
 		// Routing model management
 		configGroup.GET("/routing/models", routingHandler.ListRoutingModels)
@@ -252,11 +347,17 @@ func NewServer(deps ServerDeps) *Server {
 
 		// Routing rule management
 		ruleHandler := handler.NewRoutingRuleHandler(deps.RoutingRuleRepo, logger)
+		ruleHandler.SetRuleJanitor(deps.RuleJanitor)
+		ruleHandler.SetRoleSet(deps.RoleSet)
 		configGroup.GET("/routing/rules", ruleHandler.ListRules)
 		configGroup.GET("/routing/rules/builtin", ruleHandler.ListBuiltinRules)
 		configGroup.GET("/routing/rules/custom", ruleHandler.ListCustomRules)
 		configGroup.GET("/routing/rules/stats", ruleHandler.GetStats)
 		configGroup.POST("/routing/rules/test", ruleHandler.TestMessage)
+		configGroup.POST("/routing/rules/test-batch", ruleHandler.TestBatch)
+		configGroup.POST("/routing/rules/validate", ruleHandler.ValidateRule)
+		configGroup.GET("/routing/rules/export", ruleHandler.ExportRules)
+		configGroup.POST("/routing/rules/import", ruleHandler.ImportRules)
 		configGroup.GET("/routing/rules/:rule_id", ruleHandler.GetRule)
 		configGroup.POST("/routing/rules", ruleHandler.CreateRule)
 		configGroup.PUT("/routing/rules/:rule_id", ruleHandler.UpdateRule)
@@ -275,11 +376,20 @@ func NewServer(deps ServerDeps) *Server {
 
 		// Cache monitoring
 		cacheHandler := handler.NewCacheHandler(deps.RoutingCache, deps.EmbeddingCacheRepo)
+		cacheHandler.SetEmbeddingModelSource(deps.RoutingConfigRepo, deps.EmbeddingRepo)
+		cacheHandler.SetEmbeddingRebuilder(deps.EmbeddingRebuilder)
+		cacheHandler.SetCacheWarmer(deps.CacheWarmer)
 		configGroup.GET("/cache/stats", cacheHandler.GetStats)
 		configGroup.GET("/cache/stats/timeseries", cacheHandler.GetTimeseries)
 		configGroup.GET("/cache/entries", cacheHandler.GetEntries)
 		configGroup.POST("/cache/clear", cacheHandler.Clear)
 		configGroup.POST("/cache/stats/reset", cacheHandler.ResetStats)
+		configGroup.GET("/cache/embeddings/export", cacheHandler.ExportEmbeddings)
+		configGroup.POST("/cache/embeddings/import", cacheHandler.ImportEmbeddings)
+		configGroup.POST("/cache/rebuild-embeddings", cacheHandler.RebuildEmbeddings)
+		configGroup.GET("/cache/rebuild-embeddings", cacheHandler.GetRebuildProgress)
+		configGroup.POST("/cache/warm", cacheHandler.WarmCache)
+		configGroup.GET("/cache/warm/:task_id", cacheHandler.GetWarmTask)
 	}
 
 	// Cache monitoring routes (frontend uses /api/cache/ path).
@@ -288,11 +398,20 @@ func NewServer(deps ServerDeps) *Server {
 	cacheGroup.Use(middleware.RequireAdmin())
 	{
 		cachePublicHandler := handler.NewCacheHandler(deps.RoutingCache, deps.EmbeddingCacheRepo)
+		cachePublicHandler.SetEmbeddingModelSource(deps.RoutingConfigRepo, deps.EmbeddingRepo)
+		cachePublicHandler.SetEmbeddingRebuilder(deps.EmbeddingRebuilder)
+		cachePublicHandler.SetCacheWarmer(deps.CacheWarmer)
 		cacheGroup.GET("/stats", cachePublicHandler.GetStats)
 		cacheGroup.GET("/stats/timeseries", cachePublicHandler.GetTimeseries)
 		cacheGroup.GET("/entries", cachePublicHandler.GetEntries)
 		cacheGroup.POST("/clear", cachePublicHandler.Clear)
 		cacheGroup.POST("/stats/reset", cachePublicHandler.ResetStats)
+		cacheGroup.GET("/embeddings/export", cachePublicHandler.ExportEmbeddings)
+		cacheGroup.POST("/embeddings/import", cachePublicHandler.ImportEmbeddings)
+		cacheGroup.POST("/rebuild-embeddings", cachePublicHandler.RebuildEmbeddings)
+		cacheGroup.GET("/rebuild-embeddings", cachePublicHandler.GetRebuildProgress)
+		cacheGroup.POST("/warm", cachePublicHandler.WarmCache)
+		cacheGroup.GET("/warm/:task_id", cachePublicHandler.GetWarmTask)
 	}
 
 	// SPA frontend: all unmatched routes serve index.html.
@@ -3,7 +3,10 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -11,13 +14,130 @@ import (
 
 // Config holds all application configuration.
 type Config struct {
-	Proxy       ProxyConfig
-	Security    SecurityConfig
-	HealthCheck HealthCheckConfig
-	LoadBalance LoadBalanceConfig
-	Database    DatabaseConfig
-	LogRotation LogRotationConfig
-	RateLimit   RateLimitConfig
+	Proxy         ProxyConfig
+	Security      SecurityConfig
+	HealthCheck   HealthCheckConfig
+	LoadBalance   LoadBalanceConfig
+	Database      DatabaseConfig
+	LogRotation   LogRotationConfig
+	RateLimit     RateLimitConfig
+	ContentPolicy ContentPolicyConfig
+	Redaction     RedactionConfig
+	Coalescing    CoalescingConfig
+	RuleJanitor   RuleJanitorConfig
+	StreamResume  StreamResumeConfig
+	Idempotency   IdempotencyConfig
+	Budget        BudgetConfig
+	CostDisplay   CostDisplayConfig
+	RetryBackoff  RetryBackoffConfig
+	RetryBudget   RetryBudgetConfig
+	LogRetention  LogRetentionConfig
+	Metrics       MetricsConfig
+	StatsCache    StatsCacheConfig
+
+	envErrors []error // Environment overrides that could not be parsed; fail Validate
+}
+
+// MetricsConfig controls the Prometheus /metrics endpoint.
+type MetricsConfig struct {
+	Enabled    bool   // Serve /metrics (no auth); off by default
+	ListenAddr string // Separate host:port for /metrics; empty = the proxy port
+}
+
+// LogRetentionConfig controls the background pruning of old request logs.
+// The retention window itself is stored in system config so it can be
+// changed at runtime.
+type LogRetentionConfig struct {
+	IntervalMinutes int // How often the retention job runs
+	BatchSize       int // Logs deleted per statement
+	VacuumThreshold int // Vacuum after a run that pruned at least this many logs, 0 = never
+}
+
+// StatsCacheConfig controls the in-memory cache of request log statistics.
+type StatsCacheConfig struct {
+	TTLSeconds int // How long cached statistics are served before they are refreshed, 0 = no caching
+}
+
+// RetryBackoffConfig spaces out endpoint retries of a proxied request.
+type RetryBackoffConfig struct {
+	BaseDelayMs        int     // Delay before the first retry, doubled for each later one; 0 = no backoff
+	MaxDelayMs         int     // Upper bound of the doubled delay
+	Jitter             float64 // Fraction (0-1) of each delay that is randomized away
+	MaxRetryAfterMs    int     // Longest upstream Retry-After on a 429/529 that is waited out
+	OverloadCooldownMs int     // How long a provider answering 529 (overloaded) is avoided; 0 = never
+}
+
+// RetryBudgetConfig limits endpoint retries to a share of recent requests,
+// so outages do not turn into retry storms.
+type RetryBudgetConfig struct {
+	Ratio         float64 // Retries allowed per request over the window; 0 = unlimited
+	MinPerSecond  int     // Retries per second always allowed, whatever the traffic
+	WindowSeconds int     // Length of the sliding window requests and retries are counted over
+}
+
+// CostDisplayConfig controls how costs are presented in statistics. Stored
+// costs are always USD.
+type CostDisplayConfig struct {
+	Precision int     // Decimal places costs are rounded to
+	Currency  string  // Currency label reported with statistics
+	USDRate   float64 // Units of Currency per USD
+}
+
+// StreamResumeConfig holds settings for resuming interrupted SSE streams
+// via Last-Event-ID.
+type StreamResumeConfig struct {
+	Enabled       bool // Buffer stream events and keep upstream reads alive across reconnects
+	BufferEvents  int  // Most recent events kept per stream
+	WindowSeconds int  // How long a disconnected or finished stream can still be resumed
+}
+
+// IdempotencyConfig holds settings for replaying non-streaming responses to
+// requests retried with the same Idempotency-Key.
+type IdempotencyConfig struct {
+	Enabled    bool // Honor the Idempotency-Key header
+	TTLSeconds int  // How long a response can be replayed
+	MaxEntries int  // Most responses kept at once
+}
+
+// BudgetConfig controls enforcement of per-user monthly budgets.
+type BudgetConfig struct {
+	ExemptAdmins bool // Admins are never limited by their budget
+}
+
+// RuleJanitorConfig holds settings for flagging custom routing rules that
+// never match.
+type RuleJanitorConfig struct {
+	IdleDays    int  // Flag custom rules with no hits for this many days, 0 = disabled
+	AutoDisable bool // Disable flagged rules once the grace period has also elapsed
+	GraceDays   int  // Days a flagged rule stays enabled before auto-disable
+}
+
+// CoalescingConfig holds in-flight request coalescing settings.
+type CoalescingConfig struct {
+	Enabled bool // Share one upstream call among identical deterministic requests
+}
+
+// ContentPolicyConfig holds request content blocking settings.
+type ContentPolicyConfig struct {
+	Enabled  bool
+	Patterns []string // Regexes; a request whose text matches any is rejected
+}
+
+// RedactionConfig holds settings for masking secrets and personal data in
+// request and response content before it is written to the request log.
+type RedactionConfig struct {
+	Enabled  bool
+	Patterns []string // Regexes; matches inside logged JSON string values are replaced with [REDACTED]
+}
+
+// DefaultRedactionPatterns mask API keys and bearer tokens, email addresses
+// and credit-card-like numbers.
+var DefaultRedactionPatterns = []string{
+	`sk-[A-Za-z0-9_-]{16,}`,
+	`AKIA[0-9A-Z]{16}`,
+	`(?i)bearer\s+[A-Za-z0-9._~+/-]{16,}=*`,
+	`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	`\b(?:\d[ -]?){12,18}\d\b`,
 }
 
 // LogRotationConfig holds log rotation settings powered by lumberjack.
@@ -50,12 +170,27 @@ type ProxyConfig struct {
 	SSLCertfile             string
 	SSLKeyfilePassword      string
 	LogLevel                string
+	MaxRequestBytes         int  // Largest accepted proxy request body, 0 = unlimited
+	BufferedStreamMaxTokens int  // Serve streaming requests with max_tokens up to this as non-streaming upstream calls, 0 = disabled
+	StreamIdleTimeout       int  // Seconds a streaming upstream may send nothing before it is aborted, 0 = disabled
+	StreamHeartbeat         int  // Seconds between SSE keepalive comments while a stream waits for its first data, 0 = disabled
+	CompressMinBytes        int  // Compress non-streaming proxy responses of at least this many bytes for clients that accept it, 0 = disabled
+	MaxConcurrentRequests   int  // Proxy requests in flight at once, excess rejected with 503; 0 = unlimited
+	MaxConcurrentStreams    int  // Separate in-flight budget for streaming requests, 0 = streams share MaxConcurrentRequests
+	ForwardEndUserID        bool // Send the request's metadata.user_id upstream; it is logged either way
+	AutoDefaultFallback     bool // Serve smart-routed requests from the default role when the inferred role has no available endpoint
+	LogStripThinking        bool // Drop thinking blocks from response content saved to the request log
+	ValidateTools           bool // Reject requests with malformed tool definitions locally instead of forwarding them
+	DefaultMaxTokens        int  // max_tokens injected into Messages requests that omit it, 0 = forward them unchanged
+	DefaultMaxTokensSimple  int  // Override of DefaultMaxTokens for simple-role models, 0 = no override
+	DefaultMaxTokensComplex int  // Override of DefaultMaxTokens for complex-role models, 0 = no override
 }
 
 // SecurityConfig holds security-related configuration.
 type SecurityConfig struct {
 	SecretKey          string
 	SessionExpireHours int
+	BcryptCost         int // bcrypt cost of new password hashes; weaker stored hashes are upgraded on login
 	DefaultAdmin       DefaultAdminConfig
 }
 
@@ -67,14 +202,35 @@ type DefaultAdminConfig struct {
 
 // HealthCheckConfig holds health check configuration.
 type HealthCheckConfig struct {
-	Enabled         bool
-	IntervalSeconds int
-	TimeoutSeconds  int
+	Enabled                       bool
+	IntervalSeconds               int
+	TimeoutSeconds                int
+	ProbeMode                     string  // passive, tcp or completion for every provider; empty = each provider's own method
+	CircuitBreakerThreshold       int     // Consecutive failures that open an endpoint's breaker, 0 = disabled
+	CircuitBreakerCooldownSeconds int     // How long a tripped breaker stays open before a half-open probe
+	ProbeDailyBudgetUSD           float64 // Per-provider daily spend on completion probes, then TCP probes until the next UTC day; 0 = unlimited
 }
 
+// Health check probe modes. A probe mode applies to every provider and
+// overrides the per-provider health check method.
+const (
+	ProbeModePassive    = "passive"    // No active probes; endpoints are judged by real traffic
+	ProbeModeTCP        = "tcp"        // Only check that the provider's host accepts connections
+	ProbeModeCompletion = "completion" // Send a 1-token /v1/messages request per endpoint
+)
+
 // LoadBalanceConfig holds load balancing configuration.
 type LoadBalanceConfig struct {
-	Strategy string // round_robin, weighted, least_connections, conversation_hash
+	Strategy string // round_robin, weighted, least_connections, weighted_least_connections, conversation_hash, least_cost
+
+	SuccessRateWeighting      bool // Scale provider weights by recent and live success rate
+	SuccessRateRefreshSeconds int  // How often success rates are recomputed
+	SuccessRateMinRequests    int  // Samples needed before a success rate is trusted
+	SuccessRateWindowMinutes  int  // Period success rates are computed over (0 = all time)
+
+	ConversationAffinity           bool // Keep an X-Conversation-Id conversation on the endpoint it last succeeded on
+	ConversationAffinityTTLSeconds int  // How long an idle conversation stays pinned
+	ConversationAffinityMaxEntries int  // Most conversations remembered at once
 }
 
 // DatabaseConfig holds database configuration.
@@ -83,6 +239,7 @@ type DatabaseConfig struct {
 	MaxOpenConns    int
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
+	HotCacheTTL     int // Seconds validated API keys and the routing config are served from memory, riding out database contention; 0 = disabled
 }
 
 // DefaultConfig returns the default configuration.
@@ -98,27 +255,47 @@ func DefaultConfig() *Config {
 			ForwardedAllowIPs: "*",
 			Reload:            false,
 			LogLevel:          "DEBUG",
+			MaxRequestBytes:   32 << 20,
+			StreamIdleTimeout: 300,
+			StreamHeartbeat:   15,
+			CompressMinBytes:  1024,
+			ForwardEndUserID:  true,
+
+			AutoDefaultFallback: true,
+
+			DefaultMaxTokens:       4096,
+			DefaultMaxTokensSimple: 1024,
 		},
 		Security: SecurityConfig{
 			SecretKey:          "change-this-to-a-random-secret-key",
 			SessionExpireHours: 24,
+			BcryptCost:         10,
 			DefaultAdmin: DefaultAdminConfig{
 				Username: "admin",
 				Password: "admin123",
 			},
 		},
 		HealthCheck: HealthCheckConfig{
-			Enabled:         true,
-			IntervalSeconds: 60,
-			TimeoutSeconds:  10,
+			Enabled:                       true,
+			IntervalSeconds:               60,
+			TimeoutSeconds:                10,
+			CircuitBreakerThreshold:       5,
+			CircuitBreakerCooldownSeconds: 30,
 		},
 		LoadBalance: LoadBalanceConfig{
-			Strategy: "weighted",
+			Strategy:                  "weighted",
+			SuccessRateRefreshSeconds: 60,
+			SuccessRateMinRequests:    20,
+			SuccessRateWindowMinutes:  15,
+
+			ConversationAffinityTTLSeconds: 600,
+			ConversationAffinityMaxEntries: 10000,
 		},
 		Database: DatabaseConfig{
 			MaxOpenConns:    25,
 			MaxIdleConns:    5,
 			ConnMaxLifetime: 5 * time.Minute,
+			HotCacheTTL:     10,
 		},
 		LogRotation: LogRotationConfig{
 			MaxSizeMB:  10,
@@ -131,11 +308,59 @@ func DefaultConfig() *Config {
 			MaxRequests:   100,
 			WindowSeconds: 60,
 		},
+		Redaction: RedactionConfig{
+			Enabled:  true,
+			Patterns: DefaultRedactionPatterns,
+		},
+		RuleJanitor: RuleJanitorConfig{
+			IdleDays:  30,
+			GraceDays: 7,
+		},
+		StreamResume: StreamResumeConfig{
+			BufferEvents:  256,
+			WindowSeconds: 30,
+		},
+		Idempotency: IdempotencyConfig{
+			Enabled:    true,
+			TTLSeconds: 300,
+			MaxEntries: 1000,
+		},
+		Budget: BudgetConfig{
+			ExemptAdmins: true,
+		},
+		RetryBackoff: RetryBackoffConfig{
+			BaseDelayMs:        100,
+			MaxDelayMs:         2000,
+			Jitter:             0.5,
+			MaxRetryAfterMs:    10000,
+			OverloadCooldownMs: 5000,
+		},
+		RetryBudget: RetryBudgetConfig{
+			Ratio:         0.1,
+			MinPerSecond:  10,
+			WindowSeconds: 10,
+		},
+		LogRetention: LogRetentionConfig{
+			IntervalMinutes: 60,
+			BatchSize:       1000,
+			VacuumThreshold: 100000,
+		},
+		StatsCache: StatsCacheConfig{
+			TTLSeconds: 30,
+		},
+		CostDisplay: CostDisplayConfig{
+			Precision: 6,
+			Currency:  "USD",
+			USDRate:   1,
+		},
 	}
 }
 
 // Validate checks the configuration for errors.
 func (c *Config) Validate() error {
+	if len(c.envErrors) > 0 {
+		return c.envErrors[0]
+	}
 	if c.Proxy.Port < 1 || c.Proxy.Port > 65535 {
 		return &ConfigError{Field: "proxy.port", Message: "must be between 1 and 65535"}
 	}
@@ -145,6 +370,75 @@ func (c *Config) Validate() error {
 	if c.Proxy.Workers > 1 && c.Proxy.Reload {
 		return &ConfigError{Field: "proxy", Message: "workers > 1 and reload=true are mutually exclusive"}
 	}
+	if c.Proxy.CompressMinBytes < 0 {
+		return &ConfigError{Field: "proxy.compress_min_bytes", Message: "must not be negative"}
+	}
+	if c.Proxy.StreamIdleTimeout < 0 {
+		return &ConfigError{Field: "proxy.stream_idle_timeout", Message: "must not be negative"}
+	}
+	if c.Proxy.StreamHeartbeat < 0 {
+		return &ConfigError{Field: "proxy.stream_heartbeat", Message: "must not be negative"}
+	}
+	if c.Proxy.MaxConcurrentRequests < 0 {
+		return &ConfigError{Field: "proxy.max_concurrent_requests", Message: "must not be negative"}
+	}
+	if c.Proxy.MaxConcurrentStreams < 0 {
+		return &ConfigError{Field: "proxy.max_concurrent_streams", Message: "must not be negative"}
+	}
+	if c.Proxy.DefaultMaxTokens < 0 || c.Proxy.DefaultMaxTokensSimple < 0 || c.Proxy.DefaultMaxTokensComplex < 0 {
+		return &ConfigError{Field: "proxy.default_max_tokens", Message: "must not be negative"}
+	}
+	if c.CostDisplay.Precision < 0 || c.CostDisplay.Precision > 10 {
+		return &ConfigError{Field: "cost_display.precision", Message: "must be between 0 and 10"}
+	}
+	switch c.HealthCheck.ProbeMode {
+	case "", ProbeModePassive, ProbeModeTCP, ProbeModeCompletion:
+	default:
+		return &ConfigError{Field: "health_check.probe_mode", Message: "must be one of passive, tcp, completion"}
+	}
+	if c.HealthCheck.ProbeDailyBudgetUSD < 0 {
+		return &ConfigError{Field: "health_check.probe_daily_budget_usd", Message: "must not be negative"}
+	}
+	if c.RetryBackoff.Jitter < 0 || c.RetryBackoff.Jitter > 1 {
+		return &ConfigError{Field: "retry_backoff.jitter", Message: "must be between 0 and 1"}
+	}
+	if c.RetryBudget.Ratio < 0 {
+		return &ConfigError{Field: "retry_budget.ratio", Message: "must not be negative"}
+	}
+	if c.RetryBudget.MinPerSecond < 0 {
+		return &ConfigError{Field: "retry_budget.min_per_second", Message: "must not be negative"}
+	}
+	if c.RetryBudget.WindowSeconds < 1 {
+		return &ConfigError{Field: "retry_budget.window_seconds", Message: "must be at least 1"}
+	}
+	if c.LogRetention.IntervalMinutes < 1 {
+		return &ConfigError{Field: "log_retention.interval_minutes", Message: "must be at least 1"}
+	}
+	if c.LogRetention.BatchSize < 1 {
+		return &ConfigError{Field: "log_retention.batch_size", Message: "must be at least 1"}
+	}
+	if c.StatsCache.TTLSeconds < 0 {
+		return &ConfigError{Field: "stats_cache.ttl_seconds", Message: "must not be negative"}
+	}
+	if c.Security.BcryptCost < 4 || c.Security.BcryptCost > 31 {
+		return &ConfigError{Field: "security.bcrypt_cost", Message: "must be between 4 and 31"}
+	}
+	if c.Database.HotCacheTTL < 0 {
+		return &ConfigError{Field: "database.hot_cache_ttl", Message: "must not be negative"}
+	}
+	if c.CostDisplay.USDRate <= 0 {
+		return &ConfigError{Field: "cost_display.usd_rate", Message: "must be positive"}
+	}
+	for _, p := range c.ContentPolicy.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return &ConfigError{Field: "content_policy.patterns", Message: fmt.Sprintf("invalid pattern %q: %v", p, err)}
+		}
+	}
+	for _, p := range c.Redaction.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return &ConfigError{Field: "redaction.patterns", Message: fmt.Sprintf("invalid pattern %q: %v", p, err)}
+		}
+	}
 	return nil
 }
 
@@ -179,6 +473,18 @@ func getEnvInt(key string, defaultVal int) int {
 	return n
 }
 
+func getEnvFloat(key string, defaultVal float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultVal
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return defaultVal
+	}
+	return f
+}
+
 func getEnvIntOptional(key string) *int {
 	v := os.Getenv(key)
 	if v == "" {
@@ -191,6 +497,21 @@ func getEnvIntOptional(key string) *int {
 	return &n
 }
 
+// getEnvStringList parses a JSON array of strings, e.g. ["a","b"]. A set
+// value that is not one is an error, rather than silently falling back to
+// the default, since these lists configure blocking and redaction.
+func getEnvStringList(key string, defaultVal []string) ([]string, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultVal, nil
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(v), &list); err != nil {
+		return defaultVal, &ConfigError{Field: key, Message: fmt.Sprintf("must be a JSON array of strings: %v", err)}
+	}
+	return list, nil
+}
+
 func getEnvBool(key string, defaultVal bool) bool {
 	v := os.Getenv(key)
 	if v == "" {
@@ -107,6 +107,15 @@ func loadFromDatabase(cfg *Config) error {
 	return nil
 }
 
+// envStringList is getEnvStringList, recording a parse error for Validate.
+func (c *Config) envStringList(key string, defaultVal []string) []string {
+	list, err := getEnvStringList(key, defaultVal)
+	if err != nil {
+		c.envErrors = append(c.envErrors, err)
+	}
+	return list
+}
+
 // applyEnvOverrides applies environment variable overrides to config.
 func applyEnvOverrides(cfg *Config) {
 	// Proxy config
@@ -119,6 +128,20 @@ func applyEnvOverrides(cfg *Config) {
 	cfg.Proxy.ProxyHeaders = getEnvBool("LLM_PROXY_PROXY_HEADERS", cfg.Proxy.ProxyHeaders)
 	cfg.Proxy.ForwardedAllowIPs = getEnvStr("LLM_PROXY_FORWARDED_ALLOW_IPS", cfg.Proxy.ForwardedAllowIPs)
 	cfg.Proxy.Reload = getEnvBool("LLM_PROXY_RELOAD", cfg.Proxy.Reload)
+	cfg.Proxy.MaxRequestBytes = getEnvInt("LLM_PROXY_MAX_REQUEST_BYTES", cfg.Proxy.MaxRequestBytes)
+	cfg.Proxy.BufferedStreamMaxTokens = getEnvInt("LLM_PROXY_BUFFERED_STREAM_MAX_TOKENS", cfg.Proxy.BufferedStreamMaxTokens)
+	cfg.Proxy.StreamIdleTimeout = getEnvInt("LLM_PROXY_STREAM_IDLE_TIMEOUT", cfg.Proxy.StreamIdleTimeout)
+	cfg.Proxy.StreamHeartbeat = getEnvInt("LLM_PROXY_STREAM_HEARTBEAT", cfg.Proxy.StreamHeartbeat)
+	cfg.Proxy.CompressMinBytes = getEnvInt("LLM_PROXY_COMPRESS_MIN_BYTES", cfg.Proxy.CompressMinBytes)
+	cfg.Proxy.MaxConcurrentRequests = getEnvInt("LLM_PROXY_MAX_CONCURRENT_REQUESTS", cfg.Proxy.MaxConcurrentRequests)
+	cfg.Proxy.MaxConcurrentStreams = getEnvInt("LLM_PROXY_MAX_CONCURRENT_STREAMS", cfg.Proxy.MaxConcurrentStreams)
+	cfg.Proxy.ForwardEndUserID = getEnvBool("LLM_PROXY_FORWARD_END_USER_ID", cfg.Proxy.ForwardEndUserID)
+	cfg.Proxy.AutoDefaultFallback = getEnvBool("LLM_PROXY_AUTO_DEFAULT_FALLBACK", cfg.Proxy.AutoDefaultFallback)
+	cfg.Proxy.LogStripThinking = getEnvBool("LLM_PROXY_LOG_STRIP_THINKING", cfg.Proxy.LogStripThinking)
+	cfg.Proxy.ValidateTools = getEnvBool("LLM_PROXY_VALIDATE_TOOLS", cfg.Proxy.ValidateTools)
+	cfg.Proxy.DefaultMaxTokens = getEnvInt("LLM_PROXY_DEFAULT_MAX_TOKENS", cfg.Proxy.DefaultMaxTokens)
+	cfg.Proxy.DefaultMaxTokensSimple = getEnvInt("LLM_PROXY_DEFAULT_MAX_TOKENS_SIMPLE", cfg.Proxy.DefaultMaxTokensSimple)
+	cfg.Proxy.DefaultMaxTokensComplex = getEnvInt("LLM_PROXY_DEFAULT_MAX_TOKENS_COMPLEX", cfg.Proxy.DefaultMaxTokensComplex)
 	cfg.Proxy.LogLevel = getEnvStr("LOG_LEVEL", cfg.Proxy.LogLevel)
 
 	// SSL config
@@ -129,6 +152,7 @@ func applyEnvOverrides(cfg *Config) {
 	// Security config
 	cfg.Security.SecretKey = getEnvStr("LLM_PROXY_SECRET_KEY", cfg.Security.SecretKey)
 	cfg.Security.SessionExpireHours = getEnvInt("LLM_PROXY_SESSION_EXPIRE_HOURS", cfg.Security.SessionExpireHours)
+	cfg.Security.BcryptCost = getEnvInt("LLM_PROXY_BCRYPT_COST", cfg.Security.BcryptCost)
 	cfg.Security.DefaultAdmin.Username = getEnvStr("LLM_PROXY_DEFAULT_ADMIN_USERNAME", cfg.Security.DefaultAdmin.Username)
 	cfg.Security.DefaultAdmin.Password = getEnvStr("LLM_PROXY_DEFAULT_ADMIN_PASSWORD", cfg.Security.DefaultAdmin.Password)
 
@@ -136,6 +160,7 @@ func applyEnvOverrides(cfg *Config) {
 	if dbPath := os.Getenv("LLM_PROXY_DB"); dbPath != "" {
 		cfg.Database.Path = dbPath
 	}
+	cfg.Database.HotCacheTTL = getEnvInt("LLM_PROXY_DB_HOT_CACHE_TTL", cfg.Database.HotCacheTTL)
 
 	// Log rotation config
 	cfg.LogRotation.MaxSizeMB = getEnvInt("LLM_PROXY_LOG_MAX_SIZE_MB", cfg.LogRotation.MaxSizeMB)
@@ -147,6 +172,81 @@ func applyEnvOverrides(cfg *Config) {
 	cfg.RateLimit.Enabled = getEnvBool("LLM_PROXY_RATE_LIMIT_ENABLED", cfg.RateLimit.Enabled)
 	cfg.RateLimit.MaxRequests = getEnvInt("LLM_PROXY_RATE_LIMIT_MAX_REQUESTS", cfg.RateLimit.MaxRequests)
 	cfg.RateLimit.WindowSeconds = getEnvInt("LLM_PROXY_RATE_LIMIT_WINDOW_SECONDS", cfg.RateLimit.WindowSeconds)
+
+	// Content policy config
+	cfg.ContentPolicy.Enabled = getEnvBool("LLM_PROXY_CONTENT_POLICY_ENABLED", cfg.ContentPolicy.Enabled)
+	cfg.ContentPolicy.Patterns = cfg.envStringList("LLM_PROXY_CONTENT_POLICY_PATTERNS", cfg.ContentPolicy.Patterns)
+
+	// Log content redaction config
+	cfg.Redaction.Enabled = getEnvBool("LLM_PROXY_REDACTION_ENABLED", cfg.Redaction.Enabled)
+	cfg.Redaction.Patterns = cfg.envStringList("LLM_PROXY_REDACTION_PATTERNS", cfg.Redaction.Patterns)
+
+	// Request coalescing config
+	cfg.Coalescing.Enabled = getEnvBool("LLM_PROXY_COALESCING_ENABLED", cfg.Coalescing.Enabled)
+
+	// Health check probe mode
+	cfg.HealthCheck.ProbeMode = getEnvStr("LLM_PROXY_HEALTH_CHECK_PROBE_MODE", cfg.HealthCheck.ProbeMode)
+	cfg.HealthCheck.ProbeDailyBudgetUSD = getEnvFloat("LLM_PROXY_HEALTH_CHECK_PROBE_DAILY_BUDGET_USD", cfg.HealthCheck.ProbeDailyBudgetUSD)
+
+	// Circuit breaker config
+	cfg.HealthCheck.CircuitBreakerThreshold = getEnvInt("LLM_PROXY_CIRCUIT_BREAKER_THRESHOLD", cfg.HealthCheck.CircuitBreakerThreshold)
+	cfg.HealthCheck.CircuitBreakerCooldownSeconds = getEnvInt("LLM_PROXY_CIRCUIT_BREAKER_COOLDOWN_SECONDS", cfg.HealthCheck.CircuitBreakerCooldownSeconds)
+
+	// Success rate weighting config
+	cfg.LoadBalance.SuccessRateWeighting = getEnvBool("LLM_PROXY_LOAD_BALANCE_SUCCESS_RATE_WEIGHTING", cfg.LoadBalance.SuccessRateWeighting)
+	cfg.LoadBalance.SuccessRateRefreshSeconds = getEnvInt("LLM_PROXY_LOAD_BALANCE_SUCCESS_RATE_REFRESH_SECONDS", cfg.LoadBalance.SuccessRateRefreshSeconds)
+	cfg.LoadBalance.SuccessRateMinRequests = getEnvInt("LLM_PROXY_LOAD_BALANCE_SUCCESS_RATE_MIN_REQUESTS", cfg.LoadBalance.SuccessRateMinRequests)
+	cfg.LoadBalance.SuccessRateWindowMinutes = getEnvInt("LLM_PROXY_LOAD_BALANCE_SUCCESS_RATE_WINDOW_MINUTES", cfg.LoadBalance.SuccessRateWindowMinutes)
+	cfg.LoadBalance.ConversationAffinity = getEnvBool("LLM_PROXY_LOAD_BALANCE_CONVERSATION_AFFINITY", cfg.LoadBalance.ConversationAffinity)
+	cfg.LoadBalance.ConversationAffinityTTLSeconds = getEnvInt("LLM_PROXY_LOAD_BALANCE_CONVERSATION_AFFINITY_TTL_SECONDS", cfg.LoadBalance.ConversationAffinityTTLSeconds)
+	cfg.LoadBalance.ConversationAffinityMaxEntries = getEnvInt("LLM_PROXY_LOAD_BALANCE_CONVERSATION_AFFINITY_MAX_ENTRIES", cfg.LoadBalance.ConversationAffinityMaxEntries)
+
+	// Routing rule janitor config
+	cfg.RuleJanitor.IdleDays = getEnvInt("LLM_PROXY_RULE_JANITOR_IDLE_DAYS", cfg.RuleJanitor.IdleDays)
+	cfg.RuleJanitor.AutoDisable = getEnvBool("LLM_PROXY_RULE_JANITOR_AUTO_DISABLE", cfg.RuleJanitor.AutoDisable)
+	cfg.RuleJanitor.GraceDays = getEnvInt("LLM_PROXY_RULE_JANITOR_GRACE_DAYS", cfg.RuleJanitor.GraceDays)
+
+	// Stream resumption config
+	cfg.StreamResume.Enabled = getEnvBool("LLM_PROXY_STREAM_RESUME_ENABLED", cfg.StreamResume.Enabled)
+	cfg.StreamResume.BufferEvents = getEnvInt("LLM_PROXY_STREAM_RESUME_BUFFER_EVENTS", cfg.StreamResume.BufferEvents)
+	cfg.StreamResume.WindowSeconds = getEnvInt("LLM_PROXY_STREAM_RESUME_WINDOW_SECONDS", cfg.StreamResume.WindowSeconds)
+
+	// Idempotency key config
+	cfg.Idempotency.Enabled = getEnvBool("LLM_PROXY_IDEMPOTENCY_ENABLED", cfg.Idempotency.Enabled)
+	cfg.Idempotency.TTLSeconds = getEnvInt("LLM_PROXY_IDEMPOTENCY_TTL_SECONDS", cfg.Idempotency.TTLSeconds)
+	cfg.Idempotency.MaxEntries = getEnvInt("LLM_PROXY_IDEMPOTENCY_MAX_ENTRIES", cfg.Idempotency.MaxEntries)
+
+	// Budget config
+	cfg.Budget.ExemptAdmins = getEnvBool("LLM_PROXY_BUDGET_EXEMPT_ADMINS", cfg.Budget.ExemptAdmins)
+
+	// Retry backoff config
+	cfg.RetryBackoff.BaseDelayMs = getEnvInt("LLM_PROXY_RETRY_BASE_DELAY_MS", cfg.RetryBackoff.BaseDelayMs)
+	cfg.RetryBackoff.MaxDelayMs = getEnvInt("LLM_PROXY_RETRY_MAX_DELAY_MS", cfg.RetryBackoff.MaxDelayMs)
+	cfg.RetryBackoff.Jitter = getEnvFloat("LLM_PROXY_RETRY_JITTER", cfg.RetryBackoff.Jitter)
+	cfg.RetryBackoff.MaxRetryAfterMs = getEnvInt("LLM_PROXY_RETRY_MAX_RETRY_AFTER_MS", cfg.RetryBackoff.MaxRetryAfterMs)
+	cfg.RetryBackoff.OverloadCooldownMs = getEnvInt("LLM_PROXY_RETRY_OVERLOAD_COOLDOWN_MS", cfg.RetryBackoff.OverloadCooldownMs)
+
+	// Retry budget config
+	cfg.RetryBudget.Ratio = getEnvFloat("LLM_PROXY_RETRY_BUDGET_RATIO", cfg.RetryBudget.Ratio)
+	cfg.RetryBudget.MinPerSecond = getEnvInt("LLM_PROXY_RETRY_BUDGET_MIN_PER_SECOND", cfg.RetryBudget.MinPerSecond)
+	cfg.RetryBudget.WindowSeconds = getEnvInt("LLM_PROXY_RETRY_BUDGET_WINDOW_SECONDS", cfg.RetryBudget.WindowSeconds)
+
+	// Log retention config
+	cfg.LogRetention.IntervalMinutes = getEnvInt("LLM_PROXY_LOG_RETENTION_INTERVAL_MINUTES", cfg.LogRetention.IntervalMinutes)
+	cfg.LogRetention.BatchSize = getEnvInt("LLM_PROXY_LOG_RETENTION_BATCH_SIZE", cfg.LogRetention.BatchSize)
+	cfg.LogRetention.VacuumThreshold = getEnvInt("LLM_PROXY_LOG_RETENTION_VACUUM_THRESHOLD", cfg.LogRetention.VacuumThreshold)
+
+	// Stats cache config
+	cfg.StatsCache.TTLSeconds = getEnvInt("LLM_PROXY_STATS_CACHE_TTL_SECONDS", cfg.StatsCache.TTLSeconds)
+
+	// Metrics config
+	cfg.Metrics.Enabled = getEnvBool("LLM_PROXY_METRICS_ENABLED", cfg.Metrics.Enabled)
+	cfg.Metrics.ListenAddr = getEnvStr("LLM_PROXY_METRICS_LISTEN_ADDR", cfg.Metrics.ListenAddr)
+
+	// Cost display config
+	cfg.CostDisplay.Precision = getEnvInt("LLM_PROXY_COST_PRECISION", cfg.CostDisplay.Precision)
+	cfg.CostDisplay.Currency = getEnvStr("LLM_PROXY_COST_CURRENCY", cfg.CostDisplay.Currency)
+	cfg.CostDisplay.USDRate = getEnvFloat("LLM_PROXY_COST_USD_RATE", cfg.CostDisplay.USDRate)
 }
 
 // String utility functions (avoiding external dependencies).
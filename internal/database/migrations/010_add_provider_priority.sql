@@ -0,0 +1,4 @@
+-- 010: Add priority column to providers table
+-- Lower values are preferred; the load balancer only picks among the
+-- best (lowest) priority tier that still has healthy endpoints.
+ALTER TABLE providers ADD COLUMN priority INTEGER DEFAULT 0 NOT NULL;
@@ -0,0 +1,4 @@
+-- 011: Add retry_rules column to providers table
+-- Stores JSON list of rules matching upstream error type/message to decide
+-- whether a failed request should fail over to another endpoint
+ALTER TABLE providers ADD COLUMN retry_rules TEXT DEFAULT '' NOT NULL;
@@ -0,0 +1,3 @@
+-- 012: Add cache_max_size column to routing_llm_config
+-- Capacity of the L1 in-memory routing cache; applied live on update
+ALTER TABLE routing_llm_config ADD COLUMN cache_max_size INTEGER DEFAULT 10000;
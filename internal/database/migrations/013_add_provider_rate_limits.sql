@@ -0,0 +1,4 @@
+-- 013: Add rpm_limit/tpm_limit columns to providers table
+-- Documented requests/tokens per minute ceilings; 0 means unlimited
+ALTER TABLE providers ADD COLUMN rpm_limit INTEGER DEFAULT 0 NOT NULL;
+ALTER TABLE providers ADD COLUMN tpm_limit INTEGER DEFAULT 0 NOT NULL;
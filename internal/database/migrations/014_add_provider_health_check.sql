@@ -0,0 +1,4 @@
+-- 014: Add health check method/path columns to providers table
+-- method: get (GET health_check_path, base URL if empty), messages (minimal /v1/messages probe), passive (no probe)
+ALTER TABLE providers ADD COLUMN health_check_method TEXT DEFAULT 'get' NOT NULL;
+ALTER TABLE providers ADD COLUMN health_check_path TEXT DEFAULT '' NOT NULL;
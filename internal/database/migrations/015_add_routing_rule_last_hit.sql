@@ -0,0 +1,5 @@
+-- 015: Add last_hit_at column to routing_rules table
+-- Lets the rule janitor find rules that have not matched within a window.
+-- Rules with historical hits start a fresh window from now.
+ALTER TABLE routing_rules ADD COLUMN last_hit_at TIMESTAMP;
+UPDATE routing_rules SET last_hit_at = CURRENT_TIMESTAMP WHERE hit_count > 0;
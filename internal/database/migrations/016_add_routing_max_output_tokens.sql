@@ -0,0 +1,3 @@
+-- 016: Add max_output_tokens column to routing_llm_config
+-- Output token budget per proxied request; 0 disables the cutoff
+ALTER TABLE routing_llm_config ADD COLUMN max_output_tokens INTEGER DEFAULT 0;
@@ -0,0 +1,5 @@
+-- 017: Add per-key model allowlist and rate limit to api_keys
+-- allowed_models is a JSON array of model names; empty allows all models
+ALTER TABLE api_keys ADD COLUMN allowed_models TEXT DEFAULT '' NOT NULL;
+-- Maximum proxy requests per minute for the key; 0 means unlimited
+ALTER TABLE api_keys ADD COLUMN rate_limit_per_min INTEGER DEFAULT 0 NOT NULL;
@@ -0,0 +1,4 @@
+-- 018: Add routing_trigger_models column to routing_llm_config
+-- JSON array of model names that trigger intelligent routing; NULL means ["auto"],
+-- an empty array disables the trigger keyword entirely
+ALTER TABLE routing_llm_config ADD COLUMN routing_trigger_models TEXT;
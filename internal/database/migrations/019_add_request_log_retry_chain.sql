@@ -0,0 +1,4 @@
+-- 019: Add retry_chain column to request_logs
+-- JSON array of the endpoints tried for a request, in order, with the status
+-- or error of each attempt
+ALTER TABLE request_logs ADD COLUMN retry_chain TEXT DEFAULT '[]';
@@ -0,0 +1,8 @@
+-- 020: Add per-model thinking budget cap and default
+-- max_thinking_tokens clamps thinking.budget_tokens (0 = no cap);
+-- default_thinking_tokens is used when thinking is enabled without a budget (0 = none)
+ALTER TABLE models ADD COLUMN max_thinking_tokens INTEGER DEFAULT 0;
+ALTER TABLE models ADD COLUMN default_thinking_tokens INTEGER DEFAULT 0;
+
+-- Requested thinking budget of requests whose budget was clamped (0 = not clamped)
+ALTER TABLE request_logs ADD COLUMN thinking_clamped_from INTEGER DEFAULT 0;
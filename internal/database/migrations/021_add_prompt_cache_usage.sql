@@ -0,0 +1,8 @@
+-- 021: Add prompt-cache pricing and usage
+-- Cache writes and reads are priced relative to cost_per_mtok_input
+ALTER TABLE models ADD COLUMN cache_write_multiplier REAL DEFAULT 1.25;
+ALTER TABLE models ADD COLUMN cache_read_multiplier REAL DEFAULT 0.1;
+
+-- Prompt tokens written to and read from the upstream prompt cache
+ALTER TABLE request_logs ADD COLUMN cache_creation_input_tokens INTEGER DEFAULT 0;
+ALTER TABLE request_logs ADD COLUMN cache_read_input_tokens INTEGER DEFAULT 0;
@@ -0,0 +1,8 @@
+-- 022: Add request log retention configuration (singleton)
+-- retention_days = 0 keeps request logs forever
+CREATE TABLE IF NOT EXISTS log_retention_config (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    retention_days INTEGER DEFAULT 0
+);
+
+INSERT OR IGNORE INTO log_retention_config (id, retention_days) VALUES (1, 0);
@@ -0,0 +1,4 @@
+-- 023: Add per-provider upstream auth scheme
+-- scheme: anthropic (x-api-key), bearer (Authorization: Bearer), custom_header (key in auth_header)
+ALTER TABLE providers ADD COLUMN auth_scheme TEXT DEFAULT 'anthropic' NOT NULL;
+ALTER TABLE providers ADD COLUMN auth_header TEXT DEFAULT '' NOT NULL;
@@ -0,0 +1,4 @@
+-- 024: Add per-model and per-provider upstream request timeouts
+-- timeout_seconds: 0 = use the proxy default; a model's timeout wins over its provider's
+ALTER TABLE models ADD COLUMN timeout_seconds INTEGER DEFAULT 0 NOT NULL;
+ALTER TABLE providers ADD COLUMN timeout_seconds INTEGER DEFAULT 0 NOT NULL;
@@ -0,0 +1,5 @@
+-- 025: Add per-user monthly spend caps
+-- monthly_budget_usd: NULL = unlimited; requests are rejected once the user's
+-- cost for the current calendar month (UTC) reaches it
+ALTER TABLE users ADD COLUMN monthly_budget_usd REAL;
+CREATE INDEX IF NOT EXISTS idx_request_logs_user_created ON request_logs(user_id, created_at);
@@ -0,0 +1,3 @@
+-- 026: Mark providers that only support streaming responses
+-- stream_only: 1 = non-streaming requests are sent upstream as streams and assembled
+ALTER TABLE providers ADD COLUMN stream_only INTEGER DEFAULT 0 NOT NULL;
@@ -0,0 +1,15 @@
+-- 027: Control the anthropic-version header sent upstream
+-- pinned_version: sent on every upstream request when set
+-- default_version: sent when the client sends none or a version outside allowed_versions
+-- allowed_versions: JSON array of client versions forwarded as-is; empty allows any
+-- providers.anthropic_version pins a version for one provider, overriding all of the above
+CREATE TABLE IF NOT EXISTS anthropic_version_config (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    pinned_version TEXT DEFAULT '' NOT NULL,
+    default_version TEXT DEFAULT '2023-06-01' NOT NULL,
+    allowed_versions TEXT DEFAULT '[]' NOT NULL
+);
+
+INSERT OR IGNORE INTO anthropic_version_config (id) VALUES (1);
+
+ALTER TABLE providers ADD COLUMN anthropic_version TEXT DEFAULT '' NOT NULL;
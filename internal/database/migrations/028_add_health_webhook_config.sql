@@ -0,0 +1,10 @@
+-- 028: Webhook notified when an endpoint turns healthy or unhealthy
+-- url: receives a JSON POST per transition; empty disables notifications
+-- secret: when set, the body is signed with HMAC-SHA256 in X-Signature-256
+CREATE TABLE IF NOT EXISTS health_webhook_config (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    url TEXT DEFAULT '' NOT NULL,
+    secret TEXT DEFAULT '' NOT NULL
+);
+
+INSERT OR IGNORE INTO health_webhook_config (id) VALUES (1);
@@ -0,0 +1,28 @@
+-- 029: Shadow providers receive a mirrored copy of sampled requests for comparison
+-- providers.shadow: the provider only receives mirrored traffic, never client requests
+-- providers.shadow_sample_rate: fraction (0-1) of requests mirrored to it
+-- shadow_logs: outcome of each mirrored request next to the primary response
+ALTER TABLE providers ADD COLUMN shadow INTEGER DEFAULT 0 NOT NULL;
+ALTER TABLE providers ADD COLUMN shadow_sample_rate REAL DEFAULT 0 NOT NULL;
+
+CREATE TABLE IF NOT EXISTS shadow_logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    request_id TEXT NOT NULL,
+    model_name TEXT NOT NULL,
+    primary_endpoint TEXT NOT NULL,
+    shadow_endpoint TEXT NOT NULL,
+    routing_method TEXT DEFAULT 'shadow' NOT NULL,
+    status_code INTEGER DEFAULT 0 NOT NULL,
+    success INTEGER DEFAULT 0 NOT NULL,
+    error_message TEXT DEFAULT '' NOT NULL,
+    latency_ms REAL DEFAULT 0 NOT NULL,
+    primary_latency_ms REAL DEFAULT 0 NOT NULL,
+    input_tokens INTEGER DEFAULT 0 NOT NULL,
+    output_tokens INTEGER DEFAULT 0 NOT NULL,
+    cost REAL DEFAULT 0 NOT NULL,
+    primary_cost REAL DEFAULT 0 NOT NULL,
+    diff_summary TEXT DEFAULT '' NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_shadow_logs_created_at ON shadow_logs(created_at);
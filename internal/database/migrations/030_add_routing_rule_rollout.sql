@@ -0,0 +1,3 @@
+-- 030: Percentage rollout for routing rules
+-- routing_rules.rollout_percent: share (0-100) of matching requests the rule applies to
+ALTER TABLE routing_rules ADD COLUMN rollout_percent INTEGER DEFAULT 100 NOT NULL;
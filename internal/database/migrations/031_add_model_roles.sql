@@ -0,0 +1,17 @@
+-- 031: Task-type roles become data-driven so admins can add tiers beyond simple/default/complex
+-- model_roles: role names models can serve and routing can pick; builtin roles cannot be deleted
+-- description: shown in the admin UI and given to the routing model for custom roles
+CREATE TABLE IF NOT EXISTS model_roles (
+    name TEXT PRIMARY KEY,
+    description TEXT DEFAULT '' NOT NULL,
+    builtin INTEGER DEFAULT 0 NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT OR IGNORE INTO model_roles (name, description, builtin) VALUES
+    ('simple', '轻量模型：快速响应、低延迟任务', 1),
+    ('default', '平衡模型：常规开发任务', 1),
+    ('complex', '高能模型：复杂推理、深度分析', 1);
+
+-- Keep roles already assigned to models valid.
+INSERT OR IGNORE INTO model_roles (name) SELECT DISTINCT role FROM models WHERE role != '';
@@ -0,0 +1,6 @@
+-- 032: Configurable role fallback chain
+-- routing_llm_config.role_fallback_chain: JSON array of task types walked in order
+-- when the preferred role has no healthy endpoint; NULL uses the built-in order
+-- request_logs.fallback_chain: JSON array of the roles walked for a request
+ALTER TABLE routing_llm_config ADD COLUMN role_fallback_chain TEXT;
+ALTER TABLE request_logs ADD COLUMN fallback_chain TEXT DEFAULT '[]';
@@ -0,0 +1,4 @@
+-- 033: Attribute requests to the end users of an API key
+-- end_user_id: the request's metadata.user_id, the client's identifier for its own user
+ALTER TABLE request_logs ADD COLUMN end_user_id TEXT DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_request_logs_end_user_id ON request_logs(end_user_id);
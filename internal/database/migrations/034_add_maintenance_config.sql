@@ -0,0 +1,12 @@
+-- 034: Maintenance mode, which pauses proxy traffic while the admin API stays up
+-- enabled: when 1, /v1/* requests are answered with 503
+-- message: error message returned to clients; empty uses a default
+-- retry_after_seconds: Retry-After sent with the 503
+CREATE TABLE IF NOT EXISTS maintenance_config (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    enabled INTEGER DEFAULT 0 NOT NULL,
+    message TEXT DEFAULT '' NOT NULL,
+    retry_after_seconds INTEGER DEFAULT 60 NOT NULL
+);
+
+INSERT OR IGNORE INTO maintenance_config (id) VALUES (1);
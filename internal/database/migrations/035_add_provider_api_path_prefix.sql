@@ -0,0 +1,4 @@
+-- 035: Per-provider API path prefix, for upstreams mounted behind gateways
+-- api_path_prefix: put between base_url and /messages or /chat/completions;
+-- empty = /v1, '/' = no prefix
+ALTER TABLE providers ADD COLUMN api_path_prefix TEXT DEFAULT '' NOT NULL;
@@ -0,0 +1,3 @@
+-- 036: Observe-only routing rules
+-- routing_rules.observe: the rule's matches are recorded but never decide the task type
+ALTER TABLE routing_rules ADD COLUMN observe INTEGER DEFAULT 0 NOT NULL;
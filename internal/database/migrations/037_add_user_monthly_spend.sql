@@ -0,0 +1,17 @@
+-- 037: Per-user monthly spend ledger for budgets
+-- user_monthly_spend: cost in USD per user and UTC calendar month (period "YYYY-MM"),
+-- added to as request logs are inserted and never pruned with them, so log
+-- retention and clearing logs do not reset spend against monthly budgets
+CREATE TABLE IF NOT EXISTS user_monthly_spend (
+    user_id INTEGER NOT NULL,
+    period TEXT NOT NULL,
+    cost REAL DEFAULT 0 NOT NULL,
+    PRIMARY KEY (user_id, period)
+);
+
+-- Start from the spend still logged.
+INSERT OR IGNORE INTO user_monthly_spend (user_id, period, cost)
+    SELECT user_id, strftime('%Y-%m', created_at), SUM(cost)
+    FROM request_logs
+    WHERE cost > 0 AND strftime('%Y-%m', created_at) IS NOT NULL
+    GROUP BY user_id, strftime('%Y-%m', created_at);
@@ -0,0 +1,6 @@
+-- 038: Reset the unenforced provider concurrency default
+-- providers.max_concurrent defaulted to 10 since 001 but was never enforced; now that
+-- it is, treat the untouched default as unlimited (0) so upgrades are not silently capped.
+-- Only providers never edited since creation are reset; a limit of 10 set on purpose
+-- through an update is kept.
+UPDATE providers SET max_concurrent = 0 WHERE max_concurrent = 10 AND updated_at = created_at;
@@ -0,0 +1,4 @@
+-- 039: Normalize routing rules saved with rollout_percent 0
+-- rollout_percent 0 used to be accepted and meant a full rollout; it is now rejected
+-- (1-100), so store what such rules did to keep them editable
+UPDATE routing_rules SET rollout_percent = 100 WHERE rollout_percent = 0;
@@ -0,0 +1,4 @@
+-- 040: Per-provider pricing
+-- providers.cost_multiplier: scales the bound models' prices for requests served by this
+-- provider (e.g. 0.8 for a reseller at 80% of list price), default 1 = list price
+ALTER TABLE providers ADD COLUMN cost_multiplier REAL DEFAULT 1.0 NOT NULL;
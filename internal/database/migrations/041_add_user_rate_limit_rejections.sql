@@ -0,0 +1,18 @@
+-- 041: Per-user counter of API key rate-limit rejections
+-- user_rate_limit_rejections: rejections per user and UTC hour ("YYYY-MM-DD HH:00:00"),
+-- counted instead of logging every rejected request, so a client retrying
+-- against its limit cannot flood request_logs
+CREATE TABLE IF NOT EXISTS user_rate_limit_rejections (
+    user_id INTEGER NOT NULL,
+    hour TEXT NOT NULL,
+    count INTEGER DEFAULT 0 NOT NULL,
+    PRIMARY KEY (user_id, hour)
+);
+
+-- Move the rejections logged so far (status 429 without an endpoint) into the counter.
+INSERT OR IGNORE INTO user_rate_limit_rejections (user_id, hour, count)
+    SELECT user_id, strftime('%Y-%m-%d %H:00:00', created_at), COUNT(*)
+    FROM request_logs
+    WHERE status_code = 429 AND endpoint_name = '' AND strftime('%Y-%m-%d %H:00:00', created_at) IS NOT NULL
+    GROUP BY user_id, strftime('%Y-%m-%d %H:00:00', created_at);
+DELETE FROM request_logs WHERE status_code = 429 AND endpoint_name = '';
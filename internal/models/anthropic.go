@@ -22,6 +22,20 @@ type AnthropicRequest struct {
 	Tools         []Tool            `json:"tools,omitempty"`
 	ToolChoice    *ToolChoice       `json:"tool_choice,omitempty"`
 	Thinking      *ThinkingConfig   `json:"thinking,omitempty"`
+
+	// ConversationID is the client-supplied session key used by
+	// conversation_hash load balancing. It is never sent upstream.
+	ConversationID string `json:"-"`
+	// MaxTokensDefaulted is set when the client omitted max_tokens and
+	// MaxTokens holds the proxy's default. Each endpoint is then sent the
+	// default of its model's role.
+	MaxTokensDefaulted bool `json:"-"`
+}
+
+// EndUserID returns metadata.user_id, the client's identifier for the end
+// user the request is made for.
+func (r *AnthropicRequest) EndUserID() string {
+	return r.Metadata["user_id"]
 }
 
 // Message represents a conversation message.
@@ -44,8 +58,17 @@ type ContentPart struct {
 	ToolUseID string      `json:"tool_use_id,omitempty"`
 	Content   interface{} `json:"content,omitempty"` // Can be string or []ContentPart
 	IsError   *bool       `json:"is_error,omitempty"`
-	// thinking field (extended thinking)
-	Thinking string `json:"thinking,omitempty"`
+	// thinking fields (extended thinking)
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// Prompt caching breakpoint; must be forwarded upstream untouched.
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// CacheControl marks a prompt caching breakpoint on a content block or tool.
+type CacheControl struct {
+	Type string `json:"type"`
+	TTL  string `json:"ttl,omitempty"`
 }
 
 // MessageContent represents message content that can be either a string or an array of content parts.
@@ -121,9 +144,11 @@ type ImageSource struct {
 
 // Tool represents a tool definition.
 type Tool struct {
-	Name        string      `json:"name"`
-	Description string      `json:"description,omitempty"`
-	InputSchema interface{} `json:"input_schema"`
+	Type         string        `json:"type,omitempty"` // Empty or "custom" for client tools, e.g. "web_search_20250305" for server tools
+	Name         string        `json:"name"`
+	Description  string        `json:"description,omitempty"`
+	InputSchema  interface{}   `json:"input_schema,omitempty"` // Absent for server tools
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
 }
 
 // ToolChoice represents tool choice configuration.
@@ -150,10 +175,14 @@ type AnthropicResponse struct {
 	Usage        Usage         `json:"usage"`
 }
 
-// Usage represents token usage statistics.
+// Usage represents token usage statistics. InputTokens excludes prompt
+// tokens written to or read from the prompt cache, which are reported
+// separately.
 type Usage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
 }
 
 // StreamEvent represents a Server-Sent Event for streaming responses.
@@ -142,3 +142,42 @@ func TestAnthropicRequest_UnmarshalJSON_WithNullSystem(t *testing.T) {
 	require.NoError(t, err)
 	assert.Nil(t, req.System)
 }
+
+func TestAnthropicRequest_RoundTrip_SystemForms(t *testing.T) {
+	tests := []struct {
+		name   string
+		system string
+	}{
+		{name: "string", system: `"You are helpful."`},
+		{name: "array with cache_control", system: `[{"type":"text","text":"Long reference document.","cache_control":{"type":"ephemeral"}},{"type":"text","text":"Be brief."}]`},
+		{name: "cache_control with ttl", system: `[{"type":"text","text":"Cached.","cache_control":{"type":"ephemeral","ttl":"1h"}}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := `{"model":"claude-3","messages":[],"max_tokens":100,"system":` + tt.system + `}`
+			var req AnthropicRequest
+			require.NoError(t, json.Unmarshal([]byte(input), &req))
+
+			out, err := json.Marshal(&req)
+			require.NoError(t, err)
+			var got map[string]json.RawMessage
+			require.NoError(t, json.Unmarshal(out, &got))
+			assert.JSONEq(t, tt.system, string(got["system"]))
+		})
+	}
+}
+
+func TestAnthropicRequest_RoundTrip_ToolType(t *testing.T) {
+	input := `{"model":"claude-3","messages":[],"max_tokens":100,"tools":[{"type":"web_search_20250305","name":"web_search"},{"name":"get_weather","input_schema":{"type":"object"}}]}`
+	var req AnthropicRequest
+	require.NoError(t, json.Unmarshal([]byte(input), &req))
+	require.Len(t, req.Tools, 2)
+	assert.Equal(t, "web_search_20250305", req.Tools[0].Type)
+	assert.Empty(t, req.Tools[1].Type)
+
+	out, err := json.Marshal(req)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `{"type":"web_search_20250305","name":"web_search"}`)
+	assert.Contains(t, string(out), `{"name":"get_weather","input_schema":{"type":"object"}}`)
+}
@@ -1,9 +1,13 @@
 // Package models defines the domain models for the LLM proxy service.
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
-// ModelRole represents the role of a model.
+// ModelRole represents the role of a model. The builtin roles below always
+// exist; admins can define more in the model_roles table.
 type ModelRole string
 
 const (
@@ -12,14 +16,28 @@ const (
 	ModelRoleComplex ModelRole = "complex"
 )
 
+// BuiltinModelRoles lists the roles that cannot be deleted.
+var BuiltinModelRoles = []ModelRole{ModelRoleSimple, ModelRoleDefault, ModelRoleComplex}
+
+// ModelRoleDefinition is a task-type role models can serve and routing can
+// pick.
+type ModelRoleDefinition struct {
+	Name        ModelRole `json:"name"`
+	Description string    `json:"description"` // Given to the routing model for custom roles
+	Builtin     bool      `json:"builtin"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
 // LoadBalanceStrategy represents a load balancing strategy.
 type LoadBalanceStrategy string
 
 const (
-	StrategyRoundRobin        LoadBalanceStrategy = "round_robin"
-	StrategyWeighted          LoadBalanceStrategy = "weighted"
-	StrategyLeastConnections  LoadBalanceStrategy = "least_connections"
-	StrategyConversationHash  LoadBalanceStrategy = "conversation_hash"
+	StrategyRoundRobin               LoadBalanceStrategy = "round_robin"
+	StrategyWeighted                 LoadBalanceStrategy = "weighted"
+	StrategyLeastConnections         LoadBalanceStrategy = "least_connections"
+	StrategyWeightedLeastConnections LoadBalanceStrategy = "weighted_least_connections"
+	StrategyConversationHash         LoadBalanceStrategy = "conversation_hash"
+	StrategyLeastCost                LoadBalanceStrategy = "least_cost"
 )
 
 // EndpointStatus represents the health status of an endpoint.
@@ -29,8 +47,58 @@ const (
 	EndpointHealthy   EndpointStatus = "healthy"
 	EndpointUnhealthy EndpointStatus = "unhealthy"
 	EndpointUnknown   EndpointStatus = "unknown"
+	EndpointDraining  EndpointStatus = "draining" // Removed by a reload, finishing in-flight requests
 )
 
+// HealthCheckMethod selects how the active health checker probes a provider.
+type HealthCheckMethod string
+
+const (
+	// HealthCheckGet sends a GET to the provider's health check path (the
+	// base URL when no path is configured).
+	HealthCheckGet HealthCheckMethod = "get"
+	// HealthCheckMessages sends a minimal /v1/messages request, which
+	// consumes a few tokens per probe.
+	HealthCheckMessages HealthCheckMethod = "messages"
+	// HealthCheckPassive disables active probing; the provider is assumed
+	// healthy and judged by real traffic only.
+	HealthCheckPassive HealthCheckMethod = "passive"
+	// HealthCheckTCP only checks that the provider's host accepts TCP
+	// connections.
+	HealthCheckTCP HealthCheckMethod = "tcp"
+)
+
+// IsValid reports whether m is a known health check method.
+func (m HealthCheckMethod) IsValid() bool {
+	switch m {
+	case HealthCheckGet, HealthCheckMessages, HealthCheckPassive, HealthCheckTCP:
+		return true
+	}
+	return false
+}
+
+// AuthScheme selects how the provider's API key is sent upstream.
+type AuthScheme string
+
+const (
+	// AuthSchemeAnthropic sends the key in the x-api-key header.
+	AuthSchemeAnthropic AuthScheme = "anthropic"
+	// AuthSchemeBearer sends the key as "Authorization: Bearer <key>", as
+	// OpenAI-compatible gateways expect.
+	AuthSchemeBearer AuthScheme = "bearer"
+	// AuthSchemeCustomHeader sends the key in the provider's AuthHeader.
+	AuthSchemeCustomHeader AuthScheme = "custom_header"
+)
+
+// IsValid reports whether s is a known auth scheme.
+func (s AuthScheme) IsValid() bool {
+	switch s {
+	case AuthSchemeAnthropic, AuthSchemeBearer, AuthSchemeCustomHeader:
+		return true
+	}
+	return false
+}
+
 // UserRole represents a user's role.
 type UserRole string
 
@@ -51,21 +119,123 @@ type Model struct {
 	Enabled           bool      `json:"enabled"`
 	Weight            int       `json:"weight"`
 	CreatedAt         time.Time `json:"created_at"`
+
+	// MaxThinkingTokens caps thinking.budget_tokens of proxied requests;
+	// 0 disables the cap. DefaultThinkingTokens is the budget used when a
+	// request enables thinking without one; 0 leaves such requests as is.
+	MaxThinkingTokens     int `json:"max_thinking_tokens"`
+	DefaultThinkingTokens int `json:"default_thinking_tokens"`
+
+	// CacheWriteMultiplier and CacheReadMultiplier price prompt-cache writes
+	// and reads relative to CostPerMtokInput.
+	CacheWriteMultiplier float64 `json:"cache_write_multiplier"`
+	CacheReadMultiplier  float64 `json:"cache_read_multiplier"`
+
+	// TimeoutSeconds bounds a non-streaming upstream request to this model,
+	// overriding the provider's timeout; 0 defers to the provider.
+	TimeoutSeconds int `json:"timeout_seconds"`
 }
 
+// Default prompt-cache multipliers, matching Anthropic's pricing.
+const (
+	DefaultCacheWriteMultiplier = 1.25
+	DefaultCacheReadMultiplier  = 0.1
+)
+
 // Provider represents an API provider (e.g., Anthropic, OpenAI).
 type Provider struct {
-	ID            int64             `json:"id"`
-	Name          string            `json:"name"`
-	BaseURL       string            `json:"base_url"`
-	APIKey        string            `json:"-"` // Never serialize API key
-	Weight        int               `json:"weight"`
-	MaxConcurrent int               `json:"max_concurrent"`
-	Enabled       bool              `json:"enabled"`
-	Description   string            `json:"description,omitempty"`
-	CustomHeaders map[string]string `json:"custom_headers,omitempty"`
-	CreatedAt     time.Time         `json:"created_at"`
-	UpdatedAt     time.Time         `json:"updated_at"`
+	ID                int64             `json:"id"`
+	Name              string            `json:"name"`
+	BaseURL           string            `json:"base_url"`
+	APIKey            string            `json:"-"` // Never serialize API key
+	Weight            int               `json:"weight"`
+	MaxConcurrent     int               `json:"max_concurrent"`
+	Priority          int               `json:"priority"`  // Preference tier: lower is tried first
+	RPMLimit          int               `json:"rpm_limit"` // Requests per minute ceiling, 0 = unlimited
+	TPMLimit          int               `json:"tpm_limit"` // Tokens per minute ceiling, 0 = unlimited
+	Enabled           bool              `json:"enabled"`
+	Description       string            `json:"description,omitempty"`
+	CustomHeaders     map[string]string `json:"custom_headers,omitempty"`
+	RetryRules        []RetryRule       `json:"retry_rules,omitempty"`
+	HealthCheckMethod HealthCheckMethod `json:"health_check_method"`         // How the active health checker probes
+	HealthCheckPath   string            `json:"health_check_path,omitempty"` // Path for GET probes, empty = base URL
+	AuthScheme        AuthScheme        `json:"auth_scheme"`                 // How the API key is sent upstream
+	AuthHeader        string            `json:"auth_header,omitempty"`       // Header carrying the key for custom_header
+	TimeoutSeconds    int               `json:"timeout_seconds"`             // Non-streaming request timeout, 0 = proxy default
+	StreamOnly        bool              `json:"stream_only"`                 // Upstream only streams; non-streaming requests are assembled from the stream
+	AnthropicVersion  string            `json:"anthropic_version,omitempty"` // anthropic-version sent to this provider, empty = system policy
+	APIPathPrefix     string            `json:"api_path_prefix,omitempty"`   // Path before /messages, empty = /v1, "/" = none
+	CostMultiplier    float64           `json:"cost_multiplier"`             // Scales the bound models' prices on this provider, 1 = list price
+	Shadow            bool              `json:"shadow"`                      // Only receives mirrored traffic for comparison, never client requests
+	ShadowSampleRate  float64           `json:"shadow_sample_rate"`          // Fraction of requests mirrored to a shadow provider, 0-1
+	CreatedAt         time.Time         `json:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at"`
+}
+
+// DefaultAPIPathPrefix is put between a provider's base URL and the API
+// endpoint path when the provider configures no prefix.
+const DefaultAPIPathPrefix = "/v1"
+
+// ProviderAPIURL builds the URL of an upstream API endpoint such as
+// "/messages": baseURL, then prefix, then endpoint. An empty prefix means
+// DefaultAPIPathPrefix and "/" means none, for gateways that mount the API
+// elsewhere.
+func ProviderAPIURL(baseURL, prefix, endpoint string) string {
+	switch prefix {
+	case "":
+		prefix = DefaultAPIPathPrefix
+	case "/":
+		prefix = ""
+	}
+	return baseURL + strings.TrimSuffix(prefix, "/") + endpoint
+}
+
+// PriceFactor returns the provider's CostMultiplier. Saved providers always
+// have a positive multiplier; a nil provider or the zero value of one built
+// in code means list price.
+func (p *Provider) PriceFactor() float64 {
+	if p == nil || p.CostMultiplier <= 0 {
+		return 1
+	}
+	return p.CostMultiplier
+}
+
+// MessagesURL returns the provider's Messages API URL.
+func (p *Provider) MessagesURL() string {
+	return ProviderAPIURL(p.BaseURL, p.APIPathPrefix, "/messages")
+}
+
+// RetryRule overrides the status-code based retry decision for a provider.
+// A rule matches when every non-empty criterion matches the upstream error;
+// the first matching rule decides whether to fail over to another endpoint.
+type RetryRule struct {
+	StatusCodes  []int  `json:"status_codes,omitempty"`  // Empty matches any status
+	ErrorType    string `json:"error_type,omitempty"`    // Regex against error.type
+	MessageRegex string `json:"message_regex,omitempty"` // Regex against error.message
+	Retry        bool   `json:"retry"`
+}
+
+// AnthropicVersionConfig controls the anthropic-version header sent upstream.
+// A provider's own AnthropicVersion overrides it.
+type AnthropicVersionConfig struct {
+	PinnedVersion   string   `json:"pinned_version"`   // Sent on every request when set
+	DefaultVersion  string   `json:"default_version"`  // Sent when the client's version is missing or not allowed
+	AllowedVersions []string `json:"allowed_versions"` // Client versions forwarded as-is; empty allows any
+}
+
+// HealthWebhookConfig names the webhook notified of endpoint health
+// transitions.
+type HealthWebhookConfig struct {
+	URL    string `json:"url"`    // Empty disables notifications
+	Secret string `json:"secret"` // HMAC-SHA256 signing key; empty sends unsigned
+}
+
+// MaintenanceConfig describes maintenance mode, during which proxy traffic
+// is refused.
+type MaintenanceConfig struct {
+	Enabled           bool   `json:"enabled"`
+	Message           string `json:"message"`             // Returned to clients; empty uses a default
+	RetryAfterSeconds int    `json:"retry_after_seconds"` // Sent as Retry-After
 }
 
 // Endpoint represents a resolved endpoint (provider + model).
@@ -84,6 +254,9 @@ type User struct {
 	IsActive     bool      `json:"is_active"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+
+	// MonthlyBudgetUSD caps the user's spend per calendar month (UTC); nil = unlimited.
+	MonthlyBudgetUSD *float64 `json:"monthly_budget_usd"`
 }
 
 // APIKey represents an API key for authentication.
@@ -98,6 +271,18 @@ type APIKey struct {
 	CreatedAt  time.Time  `json:"created_at"`
 	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
 	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	// Expired is set by listings when ExpiresAt has passed.
+	Expired bool `json:"expired"`
+	// AllowedModels restricts the models the key may request; empty allows all.
+	AllowedModels []string `json:"allowed_models"`
+	// RateLimitPerMin caps the key's proxy requests per minute; 0 is unlimited.
+	RateLimitPerMin int `json:"rate_limit_per_min"`
+}
+
+// IsExpired reports whether the key's expiry is at or before now. Keys
+// without an expiry never expire.
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
 }
 
 // RequestLogEntry represents a request log entry for insertion.
@@ -120,12 +305,23 @@ type RequestLogEntry struct {
 	MessagePreview  string     // Truncated to 200 chars for display
 	RequestContent  string     // Full request content (optional)
 	ResponseContent string     // Full response content (optional)
-	RoutingMethod   string     // rule/cache_l1/cache_l2/llm/fallback
+	RoutingMethod   string     // rule/cache_l1/cache_l2/cache_l2_semantic/llm/fallback
 	RoutingReason   string     // Routing decision reason
 	MatchedRuleID   *int64     // Matched rule ID
 	MatchedRuleName string     // Matched rule name
 	AllMatches      []*RuleHit // All matched rules
 	IsInaccurate    bool       // Marked as inaccurate
+
+	RetryChain []RetryAttempt // Endpoints tried, in order
+
+	FallbackChain []string // Roles walked before an endpoint was found, when the preferred role had none
+
+	EndUserID string // Request's metadata.user_id, the API key holder's own end user
+
+	ThinkingClampedFrom int // Requested thinking budget when it was clamped, 0 otherwise
+
+	CacheCreationInputTokens int // Prompt tokens written to the upstream prompt cache
+	CacheReadInputTokens     int // Prompt tokens served from the upstream prompt cache
 }
 
 // RequestLog represents a request log record from the database.
@@ -157,6 +353,39 @@ type RequestLog struct {
 	MatchedRuleName string     `json:"matched_rule_name,omitempty"`
 	AllMatches      []*RuleHit `json:"all_matches,omitempty"`
 	IsInaccurate    bool       `json:"is_inaccurate"`
+
+	RetryChain []RetryAttempt `json:"retry_chain,omitempty"`
+
+	FallbackChain []string `json:"fallback_chain,omitempty"`
+
+	EndUserID string `json:"end_user_id,omitempty"`
+
+	ThinkingClampedFrom int `json:"thinking_clamped_from,omitempty"`
+
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// ShadowLog records a request mirrored to a shadow provider, next to the
+// primary response it is compared with.
+type ShadowLog struct {
+	ID               int64     `json:"id"`
+	RequestID        string    `json:"request_id"` // Request ID of the primary request
+	ModelName        string    `json:"model_name"`
+	PrimaryEndpoint  string    `json:"primary_endpoint"`
+	ShadowEndpoint   string    `json:"shadow_endpoint"`
+	RoutingMethod    string    `json:"routing_method"` // Always "shadow"
+	StatusCode       int       `json:"status_code"`
+	Success          bool      `json:"success"`
+	ErrorMessage     string    `json:"error_message,omitempty"`
+	LatencyMs        float64   `json:"latency_ms"`
+	PrimaryLatencyMs float64   `json:"primary_latency_ms"`
+	InputTokens      int       `json:"input_tokens"`
+	OutputTokens     int       `json:"output_tokens"`
+	Cost             float64   `json:"cost"`
+	PrimaryCost      float64   `json:"primary_cost"`
+	DiffSummary      string    `json:"diff_summary"`
+	CreatedAt        time.Time `json:"created_at"`
 }
 
 // RoutingConfig represents the LLM routing configuration (single row, id=1).
@@ -168,6 +397,7 @@ type RoutingConfig struct {
 	CacheEnabled         bool    `json:"cache_enabled"`
 	CacheTTLSeconds      int     `json:"cache_ttl_seconds"`
 	CacheTTLL3Seconds    int     `json:"cache_ttl_l3_seconds"`
+	CacheMaxSize         int     `json:"cache_max_size"`
 	MaxTokens            int     `json:"max_tokens"`
 	Temperature          float64 `json:"temperature"`
 	RetryCount           int     `json:"retry_count"`
@@ -185,6 +415,20 @@ type RoutingConfig struct {
 
 	// Logging fields
 	LogFullContent bool `json:"log_full_content"`
+
+	// MaxOutputTokens caps the output tokens of each proxied response.
+	// Streams exceeding it are cut off with stop_reason "max_tokens";
+	// 0 disables the budget.
+	MaxOutputTokens int `json:"max_output_tokens"`
+
+	// RoutingTriggerModels lists the requested model names (case-insensitive)
+	// that trigger intelligent routing. Empty disables the trigger.
+	RoutingTriggerModels []string `json:"routing_trigger_models"`
+
+	// RoleFallbackChain is the ordered degradation chain of task types
+	// (e.g. complex, default, simple) walked when the preferred role has no
+	// healthy endpoint. Empty uses the built-in fallback order.
+	RoleFallbackChain []string `json:"role_fallback_chain"`
 }
 
 // DefaultRoutingConfig returns the default routing configuration.
@@ -195,6 +439,7 @@ func DefaultRoutingConfig() *RoutingConfig {
 		CacheEnabled:         true,
 		CacheTTLSeconds:      300,
 		CacheTTLL3Seconds:    604800,
+		CacheMaxSize:         10000,
 		MaxTokens:            100,
 		Temperature:          0.0,
 		RetryCount:           2,
@@ -208,6 +453,8 @@ func DefaultRoutingConfig() *RoutingConfig {
 		RuleFallbackTaskType:    "default",
 
 		LogFullContent: true,
+
+		RoutingTriggerModels: []string{"auto"},
 	}
 }
 
@@ -229,8 +476,15 @@ type RoutingModel struct {
 // RoutingModelWithProvider includes provider details for API calls.
 type RoutingModelWithProvider struct {
 	RoutingModel
-	BaseURL string `json:"base_url"`
-	APIKey  string `json:"-"`
+	BaseURL       string `json:"base_url"`
+	APIKey        string `json:"-"`
+	APIPathPrefix string `json:"api_path_prefix,omitempty"` // The provider's API path prefix
+}
+
+// ChatCompletionsURL returns the provider's OpenAI-compatible chat
+// completions URL.
+func (m *RoutingModelWithProvider) ChatCompletionsURL() string {
+	return ProviderAPIURL(m.BaseURL, m.APIPathPrefix, "/chat/completions")
 }
 
 // EmbeddingModel represents an embedding model configuration.
@@ -255,6 +509,10 @@ type RoutingDecision struct {
 	FromCache bool      `json:"from_cache"`
 	CacheType string    `json:"cache_type,omitempty"` // "L1", "L2", "L3", ""
 	ModelUsed string    `json:"model_used,omitempty"`
+
+	// RuleMatch is the rule classification behind a "rule" decision, so
+	// the request log can record every rule that matched.
+	RuleMatch *RuleMatchResult `json:"-"`
 }
 
 // FallbackStrategy defines the behavior when no routing rule matches.
@@ -268,19 +526,26 @@ const (
 
 // RoutingRule represents a routing rule for rule-based classification.
 type RoutingRule struct {
-	ID          int64     `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Keywords    []string  `json:"keywords"`
-	Pattern     string    `json:"pattern"`
-	Condition   string    `json:"condition"`
-	TaskType    string    `json:"task_type"`
-	Priority    int       `json:"priority"`
-	IsBuiltin   bool      `json:"is_builtin"`
-	Enabled     bool      `json:"enabled"`
-	HitCount    int64     `json:"hit_count"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int64    `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Keywords    []string `json:"keywords"`
+	Pattern     string   `json:"pattern"`
+	Condition   string   `json:"condition"`
+	TaskType    string   `json:"task_type"`
+	Priority    int      `json:"priority"`
+	IsBuiltin   bool     `json:"is_builtin"`
+	Enabled     bool     `json:"enabled"`
+	// RolloutPercent is the share (1-100) of matching requests the rule
+	// applies to; 100 means every request. Saved rules never hold 0.
+	RolloutPercent int `json:"rollout_percent"`
+	// Observe makes the rule observe-only: its matches are recorded and
+	// counted but it never decides the task type, whatever its priority.
+	Observe   bool       `json:"observe"`
+	HitCount  int64      `json:"hit_count"`
+	LastHitAt *time.Time `json:"last_hit_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
 }
 
 // RuleMatchResult represents the result of a rule match evaluation.
@@ -298,6 +563,7 @@ type RuleHit struct {
 	Priority int    `json:"priority"`
 	TaskType string `json:"task_type"`
 	Reason   string `json:"reason"`
+	Observe  bool   `json:"observe,omitempty"` // Hit of an observe-only rule, which never decides the task type
 }
 
 // FallbackInfo records model fallback information.
@@ -310,11 +576,33 @@ type FallbackInfo struct {
 	FallbackChain  []string  `json:"fallback_chain,omitempty"`
 }
 
+// RetryAttempt records one endpoint tried while serving a request, in the
+// order the endpoints were tried.
+type RetryAttempt struct {
+	Endpoint   string  `json:"endpoint"`
+	StatusCode int     `json:"status_code,omitempty"` // 0 when no HTTP response was received
+	Error      string  `json:"error,omitempty"`
+	LatencyMs  float64 `json:"latency_ms"`
+}
+
 // RuleStats represents routing rule statistics.
 type RuleStats struct {
 	TotalRequests    int64              `json:"total_requests"`
 	RuleHits         map[int64]HitStat  `json:"rule_hits"`
 	UnmatchedSamples []UnmatchedSample  `json:"unmatched_samples"`
+	IdleRules        []IdleRule         `json:"idle_rules,omitempty"`
+}
+
+// IdleRule is a custom routing rule flagged for not matching any request
+// within the configured idle window.
+type IdleRule struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	HitCount  int64      `json:"hit_count"`
+	LastHitAt *time.Time `json:"last_hit_at,omitempty"`
+	IdleSince time.Time  `json:"idle_since"`
+	DisableAt *time.Time `json:"disable_at,omitempty"` // Set when auto-disable is on
+	Disabled  bool       `json:"disabled"`
 }
 
 // HitStat represents hit statistics for a single rule.
@@ -348,11 +636,28 @@ type SuggestedRule struct {
 	Explanation string   `json:"explanation"`
 }
 
+// RuleExportVersion is the current version of the RuleExport format.
+const RuleExportVersion = "1.0"
+
 // RuleExport represents the export format for routing rules.
 type RuleExport struct {
-	Version    string         `json:"version"`
+	Version    string        `json:"version"`
 	ExportedAt time.Time     `json:"exported_at"`
-	Rules      []RoutingRule  `json:"rules"`
+	Rules      []RoutingRule `json:"rules"`
+}
+
+// RuleImportResult summarizes a routing rule import.
+type RuleImportResult struct {
+	Inserted int               `json:"inserted"`
+	Skipped  int               `json:"skipped"` // Name already taken (merge mode)
+	Failed   int               `json:"failed"`  // Rejected by validation
+	Errors   []RuleImportError `json:"errors,omitempty"`
+}
+
+// RuleImportError describes a rule rejected during import.
+type RuleImportError struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
 }
 
 // AnalysisRequest represents parameters for starting a routing analysis.
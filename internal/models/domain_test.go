@@ -0,0 +1,33 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderAPIURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   string
+	}{
+		{"default", "", "https://api.example.com/v1/messages"},
+		{"no prefix", "/", "https://api.example.com/messages"},
+		{"custom", "/anthropic/v1", "https://api.example.com/anthropic/v1/messages"},
+		{"trailing slash", "/anthropic/v1/", "https://api.example.com/anthropic/v1/messages"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ProviderAPIURL("https://api.example.com", tt.prefix, "/messages"))
+		})
+	}
+}
+
+func TestRoutingModelWithProvider_ChatCompletionsURL(t *testing.T) {
+	m := &RoutingModelWithProvider{BaseURL: "https://gw.example.com", APIPathPrefix: "/openai"}
+	assert.Equal(t, "https://gw.example.com/openai/chat/completions", m.ChatCompletionsURL())
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ChatCompletionRequest represents a request to the OpenAI Chat Completions API.
+type ChatCompletionRequest struct {
+	Model               string              `json:"model"`
+	Messages            []ChatMessage       `json:"messages"`
+	MaxTokens           *int                `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int                `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64            `json:"temperature,omitempty"`
+	TopP                *float64            `json:"top_p,omitempty"`
+	Stop                ChatStop            `json:"stop,omitempty"`
+	Stream              bool                `json:"stream,omitempty"`
+	StreamOptions       *ChatStreamOptions  `json:"stream_options,omitempty"`
+	User                string              `json:"user,omitempty"`
+	ResponseFormat      *ChatResponseFormat `json:"response_format,omitempty"`
+}
+
+// ChatStreamOptions controls optional streaming behavior.
+type ChatStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ChatResponseFormat selects the output format; "json_object" enables the
+// proxy's JSON mode and "text" is the default.
+type ChatResponseFormat struct {
+	Type string `json:"type"`
+}
+
+// ChatMessage represents a chat completions message.
+type ChatMessage struct {
+	Role    string      `json:"role"`
+	Content ChatContent `json:"content"`
+	Name    string      `json:"name,omitempty"`
+}
+
+// ChatContent is message content sent as a string or an array of content
+// parts. Only text parts are supported; they are joined into Text.
+type ChatContent struct {
+	Text string
+}
+
+// UnmarshalJSON handles string, null and array-of-parts formats.
+func (c *ChatContent) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		c.Text = ""
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		c.Text = str
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or array of content parts")
+	}
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Type != "text" {
+			return fmt.Errorf("unsupported content part type %q", p.Type)
+		}
+		texts = append(texts, p.Text)
+	}
+	c.Text = strings.Join(texts, "\n")
+	return nil
+}
+
+// MarshalJSON always serializes content as a string.
+func (c ChatContent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Text)
+}
+
+// ChatStop holds stop sequences sent as a single string or an array.
+type ChatStop []string
+
+// UnmarshalJSON handles both string and array formats.
+func (s *ChatStop) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = ChatStop{str}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("stop must be a string or array of strings")
+	}
+	*s = list
+	return nil
+}
+
+// ChatCompletionResponse represents a chat completions response.
+type ChatCompletionResponse struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []ChatChoice `json:"choices"`
+	Usage   ChatUsage    `json:"usage"`
+}
+
+// ChatChoice is a single completion choice.
+type ChatChoice struct {
+	Index        int         `json:"index"`
+	Message      ChatMessage `json:"message"`
+	FinishReason string      `json:"finish_reason"`
+}
+
+// ChatUsage represents token usage in OpenAI format.
+type ChatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ChatCompletionChunk is a single streamed chat completions event.
+type ChatCompletionChunk struct {
+	ID      string            `json:"id"`
+	Object  string            `json:"object"`
+	Created int64             `json:"created"`
+	Model   string            `json:"model"`
+	Choices []ChatChunkChoice `json:"choices"`
+	Usage   *ChatUsage        `json:"usage,omitempty"`
+}
+
+// ChatChunkChoice is the incremental choice in a streamed chunk.
+type ChatChunkChoice struct {
+	Index        int       `json:"index"`
+	Delta        ChatDelta `json:"delta"`
+	FinishReason *string   `json:"finish_reason"`
+}
+
+// ChatDelta carries the incremental message fields of a streamed chunk.
+type ChatDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// ChatErrorResponse represents an OpenAI-style error response.
+type ChatErrorResponse struct {
+	Error ChatErrorDetail `json:"error"`
+}
+
+// ChatErrorDetail contains OpenAI-style error details.
+type ChatErrorDetail struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Code    *string `json:"code"`
+}
@@ -3,11 +3,17 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/user/llm-proxy-go/internal/models"
 )
 
+// apiKeyColumns is the column list scanned by scanAPIKey.
+const apiKeyColumns = `id, user_id, key_hash, key_full, key_prefix, name, is_active, created_at, last_used_at, expires_at,
+	allowed_models, rate_limit_per_min`
+
 // SQLAPIKeyRepository implements APIKeyRepository using database/sql.
 type SQLAPIKeyRepository struct {
 	db *sql.DB
@@ -19,49 +25,64 @@ func NewAPIKeyRepository(db *sql.DB) *SQLAPIKeyRepository {
 }
 
 func (r *SQLAPIKeyRepository) FindByKeyHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
-	row := r.db.QueryRowContext(ctx,
-		`SELECT id, user_id, key_hash, key_full, key_prefix, name, is_active, created_at, last_used_at, expires_at
-		 FROM api_keys WHERE key_hash = ?`, keyHash)
+	return scanAPIKey(r.db.QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = ?`, keyHash))
+}
 
-	var k models.APIKey
-	var isActive int
-	var keyFull sql.NullString
-	var lastUsed, expires sql.NullTime
+func (r *SQLAPIKeyRepository) FindByID(ctx context.Context, id int64) (*models.APIKey, error) {
+	return scanAPIKey(r.db.QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id))
+}
 
-	err := row.Scan(
-		&k.ID, &k.UserID, &k.KeyHash, &keyFull, &k.KeyPrefix, &k.Name,
-		&isActive, &k.CreatedAt, &lastUsed, &expires,
-	)
+func (r *SQLAPIKeyRepository) FindByUserID(ctx context.Context, userID int64) ([]*models.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = ? ORDER BY created_at DESC`, userID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	k.IsActive = isActive == 1
-	if keyFull.Valid {
-		k.KeyFull = keyFull.String
+	var keys []*models.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
 	}
-	if lastUsed.Valid {
-		k.LastUsedAt = &lastUsed.Time
+	return keys, rows.Err()
+}
+
+func (r *SQLAPIKeyRepository) FindAll(ctx context.Context) ([]*models.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
 	}
-	if expires.Valid {
-		k.ExpiresAt = &expires.Time
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
 	}
-	return &k, nil
+	return keys, rows.Err()
 }
 
-func (r *SQLAPIKeyRepository) FindByID(ctx context.Context, id int64) (*models.APIKey, error) {
-	row := r.db.QueryRowContext(ctx,
-		`SELECT id, user_id, key_hash, key_full, key_prefix, name, is_active, created_at, last_used_at, expires_at
-		 FROM api_keys WHERE id = ?`, id)
-
+// scanAPIKey scans a row selected with apiKeyColumns.
+func scanAPIKey(row scanner) (*models.APIKey, error) {
 	var k models.APIKey
 	var isActive int
-	var keyFull sql.NullString
+	var keyFull, allowedModels sql.NullString
 	var lastUsed, expires sql.NullTime
 
 	err := row.Scan(
 		&k.ID, &k.UserID, &k.KeyHash, &keyFull, &k.KeyPrefix, &k.Name,
 		&isActive, &k.CreatedAt, &lastUsed, &expires,
+		&allowedModels, &k.RateLimitPerMin,
 	)
 	if err != nil {
 		return nil, err
@@ -77,96 +98,67 @@ func (r *SQLAPIKeyRepository) FindByID(ctx context.Context, id int64) (*models.A
 	if expires.Valid {
 		k.ExpiresAt = &expires.Time
 	}
+	if allowedModels.Valid && allowedModels.String != "" {
+		if err := json.Unmarshal([]byte(allowedModels.String), &k.AllowedModels); err != nil {
+			return nil, fmt.Errorf("unmarshal allowed_models for API key %d: %w", k.ID, err)
+		}
+	}
 	return &k, nil
 }
 
-func (r *SQLAPIKeyRepository) FindByUserID(ctx context.Context, userID int64) ([]*models.APIKey, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, user_id, key_hash, key_full, key_prefix, name, is_active, created_at, last_used_at, expires_at
-		 FROM api_keys WHERE user_id = ? ORDER BY created_at DESC`, userID)
+// encodeAllowedModels stores an empty allowlist as an empty string.
+func encodeAllowedModels(allowed []string) string {
+	if len(allowed) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(allowed)
 	if err != nil {
-		return nil, err
+		return ""
 	}
-	defer rows.Close()
-
-	var keys []*models.APIKey
-	for rows.Next() {
-		var k models.APIKey
-		var isActive int
-		var keyFull sql.NullString
-		var lastUsed, expires sql.NullTime
-
-		if err := rows.Scan(
-			&k.ID, &k.UserID, &k.KeyHash, &keyFull, &k.KeyPrefix, &k.Name,
-			&isActive, &k.CreatedAt, &lastUsed, &expires,
-		); err != nil {
-			return nil, err
-		}
+	return string(b)
+}
 
-		k.IsActive = isActive == 1
-		if keyFull.Valid {
-			k.KeyFull = keyFull.String
-		}
-		if lastUsed.Valid {
-			k.LastUsedAt = &lastUsed.Time
-		}
-		if expires.Valid {
-			k.ExpiresAt = &expires.Time
-		}
-		keys = append(keys, &k)
-	}
-	return keys, rows.Err()
+func (r *SQLAPIKeyRepository) Insert(ctx context.Context, key *models.APIKey) (int64, error) {
+	return insertAPIKey(ctx, r.db, key)
 }
 
-func (r *SQLAPIKeyRepository) FindAll(ctx context.Context) ([]*models.APIKey, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, user_id, key_hash, key_full, key_prefix, name, is_active, created_at, last_used_at, expires_at
-		 FROM api_keys ORDER BY created_at DESC`)
+// InsertBatch inserts all keys in one transaction, setting their IDs. Either
+// every key is created or none is.
+func (r *SQLAPIKeyRepository) InsertBatch(ctx context.Context, keys []*models.APIKey) error {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to begin tx: %w", err)
 	}
-	defer rows.Close()
-
-	var keys []*models.APIKey
-	for rows.Next() {
-		var k models.APIKey
-		var isActive int
-		var keyFull sql.NullString
-		var lastUsed, expires sql.NullTime
-
-		if err := rows.Scan(
-			&k.ID, &k.UserID, &k.KeyHash, &keyFull, &k.KeyPrefix, &k.Name,
-			&isActive, &k.CreatedAt, &lastUsed, &expires,
-		); err != nil {
-			return nil, err
-		}
+	defer tx.Rollback()
 
-		k.IsActive = isActive == 1
-		if keyFull.Valid {
-			k.KeyFull = keyFull.String
-		}
-		if lastUsed.Valid {
-			k.LastUsedAt = &lastUsed.Time
-		}
-		if expires.Valid {
-			k.ExpiresAt = &expires.Time
+	for _, key := range keys {
+		id, err := insertAPIKey(ctx, tx, key)
+		if err != nil {
+			return fmt.Errorf("failed to insert API key %q: %w", key.Name, err)
 		}
-		keys = append(keys, &k)
+		key.ID = id
 	}
-	return keys, rows.Err()
+	return tx.Commit()
 }
 
-func (r *SQLAPIKeyRepository) Insert(ctx context.Context, key *models.APIKey) (int64, error) {
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertAPIKey(ctx context.Context, db execer, key *models.APIKey) (int64, error) {
 	now := time.Now().UTC()
 	if key.CreatedAt.IsZero() {
 		key.CreatedAt = now
 	}
 
-	result, err := r.db.ExecContext(ctx,
-		`INSERT INTO api_keys (user_id, key_hash, key_full, key_prefix, name, is_active, created_at, expires_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+	result, err := db.ExecContext(ctx,
+		`INSERT INTO api_keys (user_id, key_hash, key_full, key_prefix, name, is_active, created_at, expires_at,
+		                       allowed_models, rate_limit_per_min)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		key.UserID, key.KeyHash, key.KeyFull, key.KeyPrefix, key.Name,
-		boolToInt(key.IsActive), key.CreatedAt, key.ExpiresAt)
+		boolToInt(key.IsActive), key.CreatedAt, key.ExpiresAt,
+		encodeAllowedModels(key.AllowedModels), key.RateLimitPerMin)
 	if err != nil {
 		return 0, err
 	}
@@ -180,6 +172,21 @@ func (r *SQLAPIKeyRepository) UpdateLastUsed(ctx context.Context, id int64) erro
 	return err
 }
 
+// UpdateRestrictions sets the model allowlist and per-minute rate limit of
+// an API key. An empty allowlist allows all models; a zero limit is unlimited.
+func (r *SQLAPIKeyRepository) UpdateRestrictions(ctx context.Context, id int64, userID *int64, allowedModels []string, rateLimitPerMin int) error {
+	if userID != nil {
+		_, err := r.db.ExecContext(ctx,
+			`UPDATE api_keys SET allowed_models = ?, rate_limit_per_min = ? WHERE id = ? AND user_id = ?`,
+			encodeAllowedModels(allowedModels), rateLimitPerMin, id, *userID)
+		return err
+	}
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE api_keys SET allowed_models = ?, rate_limit_per_min = ? WHERE id = ?`,
+		encodeAllowedModels(allowedModels), rateLimitPerMin, id)
+	return err
+}
+
 func (r *SQLAPIKeyRepository) Revoke(ctx context.Context, id int64, userID *int64) error {
 	return r.SetActive(ctx, id, userID, false)
 }
@@ -213,6 +220,18 @@ func (r *SQLAPIKeyRepository) Delete(ctx context.Context, id int64, userID *int6
 	return err
 }
 
+// DeactivateExpired marks active keys whose expiry is not after now as
+// inactive and returns how many were deactivated.
+func (r *SQLAPIKeyRepository) DeactivateExpired(ctx context.Context, now time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE api_keys SET is_active = 0 WHERE is_active = 1 AND expires_at IS NOT NULL AND expires_at <= ?`,
+		now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 func (r *SQLAPIKeyRepository) CleanupExpired(ctx context.Context) (int64, error) {
 	result, err := r.db.ExecContext(ctx,
 		`DELETE FROM api_keys WHERE expires_at IS NOT NULL AND expires_at < ?`,
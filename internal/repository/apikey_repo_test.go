@@ -211,6 +211,34 @@ func TestAPIKeyRepository_UpdateLastUsed(t *testing.T) {
 	assert.NotNil(t, after.LastUsedAt)
 }
 
+func TestAPIKeyRepository_UpdateRestrictions(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	repo := NewAPIKeyRepository(db)
+	ctx := context.Background()
+
+	before, err := repo.FindByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, before.AllowedModels)
+	assert.Equal(t, 0, before.RateLimitPerMin)
+
+	err = repo.UpdateRestrictions(ctx, 1, nil, []string{"claude-haiku", "claude-sonnet-4"}, 30)
+	require.NoError(t, err)
+
+	after, err := repo.FindByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"claude-haiku", "claude-sonnet-4"}, after.AllowedModels)
+	assert.Equal(t, 30, after.RateLimitPerMin)
+
+	// Clearing the allowlist allows all models again.
+	err = repo.UpdateRestrictions(ctx, 1, nil, nil, 0)
+	require.NoError(t, err)
+	after, err = repo.FindByID(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, after.AllowedModels)
+	assert.Equal(t, 0, after.RateLimitPerMin)
+}
+
 func TestAPIKeyRepository_Revoke(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	testutil.SeedTestData(t, db)
@@ -265,6 +293,33 @@ func TestAPIKeyRepository_Delete(t *testing.T) {
 	}
 }
 
+func TestAPIKeyRepository_DeactivateExpired(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	repo := NewAPIKeyRepository(db)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+	pastID, err := repo.Insert(ctx, &models.APIKey{UserID: 1, KeyHash: "past", KeyPrefix: "sk-p", Name: "past", IsActive: true, ExpiresAt: &past})
+	require.NoError(t, err)
+	futureID, err := repo.Insert(ctx, &models.APIKey{UserID: 1, KeyHash: "future", KeyPrefix: "sk-f", Name: "future", IsActive: true, ExpiresAt: &future})
+	require.NoError(t, err)
+	neverID, err := repo.Insert(ctx, &models.APIKey{UserID: 1, KeyHash: "never", KeyPrefix: "sk-n", Name: "never", IsActive: true})
+	require.NoError(t, err)
+
+	n, err := repo.DeactivateExpired(ctx, now)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+
+	for id, active := range map[int64]bool{pastID: false, futureID: true, neverID: true} {
+		key, err := repo.FindByID(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, active, key.IsActive, key.Name)
+	}
+}
+
 func TestAPIKeyRepository_CleanupExpired(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	testutil.SeedTestData(t, db)
@@ -146,6 +146,50 @@ func (r *EmbeddingCacheRepository) FindAllEmbeddings(ctx context.Context, ttlSec
 	return entries, rows.Err()
 }
 
+// FindRecentEmbeddings retrieves up to limit of the newest entries within
+// TTL that have an embedding, newest first, for a bounded similarity search.
+func (r *EmbeddingCacheRepository) FindRecentEmbeddings(ctx context.Context, ttlSeconds, limit int) ([]*EmbeddingCacheEntry, error) {
+	if ttlSeconds <= 0 || limit <= 0 {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, content_hash, embedding, task_type, reason, created_at
+		FROM routing_embedding_cache
+		WHERE created_at >= datetime('now', '-%d seconds')
+		AND embedding NOT IN ('null', '[]')
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, ttlSeconds)
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find recent embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*EmbeddingCacheEntry
+	for rows.Next() {
+		var entry EmbeddingCacheEntry
+		var embeddingJSON, createdAt string
+
+		err := rows.Scan(&entry.ID, &entry.ContentHash, &embeddingJSON, &entry.TaskType, &entry.Reason, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan embedding: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(embeddingJSON), &entry.Embedding); err != nil {
+			r.logger.Warn("failed to unmarshal embedding", zap.Error(err), zap.Int64("id", entry.ID))
+			continue
+		}
+		entry.CreatedAt = parseFlexibleTime(createdAt)
+
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
+
 // UpdateHitCount increments the hit count for a cache entry
 func (r *EmbeddingCacheRepository) UpdateHitCount(ctx context.Context, id int64) error {
 	_, err := r.db.ExecContext(ctx, `
@@ -255,6 +299,141 @@ func (r *EmbeddingCacheRepository) GetTopEntries(ctx context.Context, sortBy str
 	return entries, rows.Err()
 }
 
+// ExportAll retrieves every cache entry, including embeddings, ordered by id.
+func (r *EmbeddingCacheRepository) ExportAll(ctx context.Context) ([]*EmbeddingCacheEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, content_hash, COALESCE(content_preview, ''), embedding, COALESCE(task_type, ''),
+			COALESCE(reason, ''), hit_count, created_at, last_hit_at
+		FROM routing_embedding_cache
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export cache entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*EmbeddingCacheEntry
+	for rows.Next() {
+		var entry EmbeddingCacheEntry
+		var embeddingJSON string
+		var createdAt string
+		var lastHitAt sql.NullString
+
+		err := rows.Scan(
+			&entry.ID, &entry.ContentHash, &entry.ContentPreview,
+			&embeddingJSON, &entry.TaskType, &entry.Reason,
+			&entry.HitCount, &createdAt, &lastHitAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan entry: %w", err)
+		}
+		if err := json.Unmarshal([]byte(embeddingJSON), &entry.Embedding); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal embedding for %s: %w", entry.ContentHash, err)
+		}
+
+		entry.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+		if lastHitAt.Valid {
+			t, _ := time.Parse("2006-01-02 15:04:05", lastHitAt.String)
+			entry.LastHitAt = &t
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// ImportEntries upserts entries by content hash in a single transaction,
+// keeping their hit statistics. Imported entries are stamped with the current
+// time so they are subject to the normal TTL from the moment of import.
+func (r *EmbeddingCacheRepository) ImportEntries(ctx context.Context, entries []*EmbeddingCacheEntry) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO routing_embedding_cache (content_hash, content_preview, embedding, task_type, reason, hit_count, created_at, last_hit_at)
+		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?)
+		ON CONFLICT(content_hash) DO UPDATE SET
+			content_preview = excluded.content_preview,
+			embedding = excluded.embedding,
+			task_type = excluded.task_type,
+			reason = excluded.reason,
+			hit_count = excluded.hit_count,
+			created_at = CURRENT_TIMESTAMP,
+			last_hit_at = excluded.last_hit_at
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare import: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, e := range entries {
+		embeddingJSON, err := json.Marshal(e.Embedding)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal embedding for %s: %w", e.ContentHash, err)
+		}
+		var lastHitAt any
+		if e.LastHitAt != nil {
+			lastHitAt = e.LastHitAt.UTC().Format("2006-01-02 15:04:05")
+		}
+		if _, err := stmt.ExecContext(ctx, e.ContentHash, e.ContentPreview, string(embeddingJSON),
+			e.TaskType, e.Reason, e.HitCount, lastHitAt); err != nil {
+			return 0, fmt.Errorf("failed to import entry %s: %w", e.ContentHash, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit: %w", err)
+	}
+
+	r.logger.Info("imported embedding cache entries", zap.Int("count", len(entries)))
+	return len(entries), nil
+}
+
+// ListPreviewsAfter returns up to limit entries with an id greater than
+// afterID, ordered by id. Only ID, ContentHash and ContentPreview are set;
+// callers page through the table by passing the last id seen.
+func (r *EmbeddingCacheRepository) ListPreviewsAfter(ctx context.Context, afterID int64, limit int) ([]*EmbeddingCacheEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, content_hash, COALESCE(content_preview, '')
+		FROM routing_embedding_cache
+		WHERE id > ?
+		ORDER BY id
+		LIMIT ?
+	`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache previews: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*EmbeddingCacheEntry
+	for rows.Next() {
+		var entry EmbeddingCacheEntry
+		if err := rows.Scan(&entry.ID, &entry.ContentHash, &entry.ContentPreview); err != nil {
+			return nil, fmt.Errorf("failed to scan cache preview: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
+
+// UpdateEmbedding replaces the embedding of an entry. A nil embedding clears
+// it, leaving the entry usable for exact matches only.
+func (r *EmbeddingCacheRepository) UpdateEmbedding(ctx context.Context, id int64, embedding []float64) error {
+	embeddingJSON, err := json.Marshal(embedding)
+	if err != nil {
+		return fmt.Errorf("failed to marshal embedding: %w", err)
+	}
+	_, err = r.db.ExecContext(ctx, `UPDATE routing_embedding_cache SET embedding = ? WHERE id = ?`, string(embeddingJSON), id)
+	if err != nil {
+		return fmt.Errorf("failed to update embedding: %w", err)
+	}
+	return nil
+}
+
 // DeleteAll removes all cache entries
 func (r *EmbeddingCacheRepository) DeleteAll(ctx context.Context) (int64, error) {
 	result, err := r.db.ExecContext(ctx, `DELETE FROM routing_embedding_cache`)
@@ -271,6 +450,24 @@ func (r *EmbeddingCacheRepository) DeleteAll(ctx context.Context) (int64, error)
 	return rowsAffected, nil
 }
 
+// ClearEmbeddings drops the embedding of every entry, which disables
+// semantic matching while keeping the entries for exact matches, and returns
+// how many entries had one.
+func (r *EmbeddingCacheRepository) ClearEmbeddings(ctx context.Context) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `UPDATE routing_embedding_cache SET embedding = 'null' WHERE embedding NOT IN ('null', '[]')`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear embeddings: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	r.logger.Info("cleared cache embeddings", zap.Int64("count", rowsAffected))
+	return rowsAffected, nil
+}
+
 // Count returns the total number of cache entries
 func (r *EmbeddingCacheRepository) Count(ctx context.Context) (int64, error) {
 	var count int64
@@ -123,6 +123,38 @@ func TestEmbeddingCacheRepository_FindAllEmbeddings(t *testing.T) {
 	}
 }
 
+func TestEmbeddingCacheRepository_FindRecentEmbeddings(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	repo := NewEmbeddingCacheRepository(db, zap.NewNop())
+	ctx := context.Background()
+
+	require.NoError(t, repo.SaveCache(ctx, "hash_old", "old", []float64{0.1, 0.2}, "simple", ""))
+	require.NoError(t, repo.SaveCache(ctx, "hash_new", "new", []float64{0.3, 0.4}, "complex", ""))
+	require.NoError(t, repo.SaveCache(ctx, "hash_none", "none", nil, "default", ""))
+	require.NoError(t, repo.SaveCache(ctx, "hash_expired", "expired", []float64{0.5, 0.6}, "default", ""))
+	_, err := db.Exec(`UPDATE routing_embedding_cache SET created_at = datetime('now', '-10 minutes') WHERE content_hash = 'hash_old'`)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE routing_embedding_cache SET created_at = datetime('now', '-2 hours') WHERE content_hash = 'hash_expired'`)
+	require.NoError(t, err)
+
+	// Newest first, without entries lacking an embedding or past the TTL.
+	entries, err := repo.FindRecentEmbeddings(ctx, 3600, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "hash_new", entries[0].ContentHash)
+	assert.Equal(t, "hash_old", entries[1].ContentHash)
+	assert.False(t, entries[1].CreatedAt.IsZero())
+
+	entries, err = repo.FindRecentEmbeddings(ctx, 3600, 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "hash_new", entries[0].ContentHash)
+
+	entries, err = repo.FindRecentEmbeddings(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
 func TestEmbeddingCacheRepository_UpdateHitCount(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	repo := NewEmbeddingCacheRepository(db, zap.NewNop())
@@ -189,6 +221,30 @@ func TestEmbeddingCacheRepository_DeleteAll(t *testing.T) {
 	assert.Equal(t, int64(0), count)
 }
 
+func TestEmbeddingCacheRepository_ClearEmbeddings(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	repo := NewEmbeddingCacheRepository(db, zap.NewNop())
+	ctx := context.Background()
+
+	require.NoError(t, repo.SaveCache(ctx, "hash_1", "p1", []float64{0.1}, "simple", "r1"))
+	require.NoError(t, repo.SaveCache(ctx, "hash_2", "p2", nil, "default", "r2"))
+
+	cleared, err := repo.ClearEmbeddings(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cleared, "entries without an embedding are not counted")
+
+	// Entries still serve exact matches, but no longer semantic ones.
+	entry, err := repo.GetExactMatch(ctx, "hash_1", 3600)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	assert.Equal(t, "simple", entry.TaskType)
+	entries, err := repo.FindAllEmbeddings(ctx, 3600)
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.Empty(t, e.Embedding)
+	}
+}
+
 func TestEmbeddingCacheRepository_Count(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	repo := NewEmbeddingCacheRepository(db, zap.NewNop())
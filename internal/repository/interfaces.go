@@ -39,11 +39,14 @@ type APIKeyRepository interface {
 	FindByUserID(ctx context.Context, userID int64) ([]*models.APIKey, error)
 	FindAll(ctx context.Context) ([]*models.APIKey, error)
 	Insert(ctx context.Context, key *models.APIKey) (int64, error)
+	InsertBatch(ctx context.Context, keys []*models.APIKey) error
 	UpdateLastUsed(ctx context.Context, id int64) error
+	UpdateRestrictions(ctx context.Context, id int64, userID *int64, allowedModels []string, rateLimitPerMin int) error
 	Revoke(ctx context.Context, id int64, userID *int64) error
 	SetActive(ctx context.Context, id int64, userID *int64, active bool) error
 	Delete(ctx context.Context, id int64, userID *int64) error
 	CleanupExpired(ctx context.Context) (int64, error)
+	DeactivateExpired(ctx context.Context, now time.Time) (int64, error)
 }
 
 // UserRepository provides access to user data.
@@ -77,8 +80,22 @@ type RequestLogRepository interface {
 	Insert(ctx context.Context, entry *models.RequestLogEntry) (int64, error)
 	GetByID(ctx context.Context, id int64) (*models.RequestLog, error)
 	List(ctx context.Context, limit, offset int, userID *int64, modelName, endpointName *string, startTime, endTime *time.Time, success *bool) ([]*models.RequestLog, int64, error)
+	// ListAfter pages logs by (created_at, id) and returns the next-page cursor.
+	ListAfter(ctx context.Context, cursor string, limit int, userID *int64, modelName, endpointName *string, startTime, endTime *time.Time, success *bool) ([]*models.RequestLog, string, error)
+	// Export streams every matching log to fn, oldest first.
+	Export(ctx context.Context, userID *int64, modelName, endpointName *string, startTime, endTime *time.Time, success *bool, fn func(*models.RequestLog) error) error
 	GetStatistics(ctx context.Context, startTime, endTime *time.Time, userID *int64, modelName, endpointName *string, success *bool) (*LogStatistics, error)
+	// GetAPIKeyStatistics aggregates one API key's requests in a time range.
+	GetAPIKeyStatistics(ctx context.Context, apiKeyID int64, startTime, endTime *time.Time) (*APIKeyStatistics, error)
 	Count(ctx context.Context, modelName, endpointName *string, startTime, endTime *time.Time) (int64, error)
+	// MonthlySpendForUser returns the user's cost in USD in the UTC calendar
+	// month containing month, including requests whose logs were since deleted.
+	MonthlySpendForUser(ctx context.Context, userID int64, month time.Time) (float64, error)
+	// RecordRateLimited counts a request rejected by the per-key rate limit;
+	// such requests are not logged.
+	RecordRateLimited(ctx context.Context, userID int64, at time.Time) error
+	// CountRateLimited counts requests rejected by the per-key rate limit.
+	CountRateLimited(ctx context.Context, userID *int64, startTime, endTime *time.Time) (int64, error)
 	Delete(ctx context.Context, modelName, endpointName *string, startTime, endTime *time.Time) (int64, error)
 	MarkInaccurate(ctx context.Context, id int64, inaccurate bool) error
 	// GetRoutingAggregation returns routing method/rule counts via SQL aggregation.
@@ -89,4 +106,7 @@ type RequestLogRepository interface {
 	ListForAnalysis(ctx context.Context, startTime, endTime *time.Time, maxResults int) ([]*models.RequestLog, error)
 	// GetEndpointModelStats returns historical stats grouped by endpoint_name/model_name.
 	GetEndpointModelStats(ctx context.Context) (map[string]*EndpointModelStats, error)
+	// GetEndpointModelStatsSince is GetEndpointModelStats restricted to requests
+	// logged since the given time; a zero time means all time.
+	GetEndpointModelStatsSince(ctx context.Context, since time.Time) (map[string]*EndpointModelStats, error)
 }
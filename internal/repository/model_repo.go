@@ -23,7 +23,9 @@ func NewModelRepository(db *sql.DB) *SQLModelRepository {
 func (r *SQLModelRepository) FindByID(ctx context.Context, id int64) (*models.Model, error) {
 	row := r.db.QueryRowContext(ctx,
 		`SELECT id, name, role, cost_per_mtok_input, cost_per_mtok_output,
-		        billing_multiplier, supports_thinking, enabled, weight, created_at
+		        billing_multiplier, supports_thinking, enabled, weight, created_at,
+		        max_thinking_tokens, default_thinking_tokens,
+		        cache_write_multiplier, cache_read_multiplier, timeout_seconds
 		 FROM models WHERE id = ?`, id)
 	return scanModel(row)
 }
@@ -31,7 +33,9 @@ func (r *SQLModelRepository) FindByID(ctx context.Context, id int64) (*models.Mo
 func (r *SQLModelRepository) FindByName(ctx context.Context, name string) (*models.Model, error) {
 	row := r.db.QueryRowContext(ctx,
 		`SELECT id, name, role, cost_per_mtok_input, cost_per_mtok_output,
-		        billing_multiplier, supports_thinking, enabled, weight, created_at
+		        billing_multiplier, supports_thinking, enabled, weight, created_at,
+		        max_thinking_tokens, default_thinking_tokens,
+		        cache_write_multiplier, cache_read_multiplier, timeout_seconds
 		 FROM models WHERE name = ?`, name)
 	return scanModel(row)
 }
@@ -39,7 +43,9 @@ func (r *SQLModelRepository) FindByName(ctx context.Context, name string) (*mode
 func (r *SQLModelRepository) FindByRole(ctx context.Context, role models.ModelRole) ([]*models.Model, error) {
 	rows, err := r.db.QueryContext(ctx,
 		`SELECT id, name, role, cost_per_mtok_input, cost_per_mtok_output,
-		        billing_multiplier, supports_thinking, enabled, weight, created_at
+		        billing_multiplier, supports_thinking, enabled, weight, created_at,
+		        max_thinking_tokens, default_thinking_tokens,
+		        cache_write_multiplier, cache_read_multiplier, timeout_seconds
 		 FROM models WHERE role = ? AND enabled = 1 ORDER BY weight DESC`, string(role))
 	if err != nil {
 		return nil, err
@@ -51,7 +57,9 @@ func (r *SQLModelRepository) FindByRole(ctx context.Context, role models.ModelRo
 func (r *SQLModelRepository) FindAllEnabled(ctx context.Context) ([]*models.Model, error) {
 	rows, err := r.db.QueryContext(ctx,
 		`SELECT id, name, role, cost_per_mtok_input, cost_per_mtok_output,
-		        billing_multiplier, supports_thinking, enabled, weight, created_at
+		        billing_multiplier, supports_thinking, enabled, weight, created_at,
+		        max_thinking_tokens, default_thinking_tokens,
+		        cache_write_multiplier, cache_read_multiplier, timeout_seconds
 		 FROM models WHERE enabled = 1 ORDER BY id`)
 	if err != nil {
 		return nil, err
@@ -76,6 +84,8 @@ func scanModel(s scanner) (*models.Model, error) {
 		&m.CostPerMtokInput, &m.CostPerMtokOutput,
 		&m.BillingMultiplier, &supportsThinking, &enabled,
 		&m.Weight, &createdAt,
+		&m.MaxThinkingTokens, &m.DefaultThinkingTokens,
+		&m.CacheWriteMultiplier, &m.CacheReadMultiplier, &m.TimeoutSeconds,
 	)
 	if err != nil {
 		return nil, err
@@ -107,7 +117,9 @@ func scanModels(rows *sql.Rows) ([]*models.Model, error) {
 func (r *SQLModelRepository) FindAll(ctx context.Context) ([]*models.Model, error) {
 	rows, err := r.db.QueryContext(ctx,
 		`SELECT id, name, role, cost_per_mtok_input, cost_per_mtok_output,
-		        billing_multiplier, supports_thinking, enabled, weight, created_at
+		        billing_multiplier, supports_thinking, enabled, weight, created_at,
+		        max_thinking_tokens, default_thinking_tokens,
+		        cache_write_multiplier, cache_read_multiplier, timeout_seconds
 		 FROM models ORDER BY id`)
 	if err != nil {
 		return nil, err
@@ -119,10 +131,14 @@ func (r *SQLModelRepository) FindAll(ctx context.Context) ([]*models.Model, erro
 func (r *SQLModelRepository) Insert(ctx context.Context, m *models.Model) (int64, error) {
 	result, err := r.db.ExecContext(ctx,
 		`INSERT INTO models (name, role, cost_per_mtok_input, cost_per_mtok_output,
-		        billing_multiplier, supports_thinking, enabled, weight, created_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+		        billing_multiplier, supports_thinking, enabled, weight, created_at,
+		        max_thinking_tokens, default_thinking_tokens,
+		        cache_write_multiplier, cache_read_multiplier, timeout_seconds)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)`,
 		m.Name, string(m.Role), m.CostPerMtokInput, m.CostPerMtokOutput,
-		m.BillingMultiplier, boolToInt(m.SupportsThinking), boolToInt(m.Enabled), m.Weight)
+		m.BillingMultiplier, boolToInt(m.SupportsThinking), boolToInt(m.Enabled), m.Weight,
+		m.MaxThinkingTokens, m.DefaultThinkingTokens,
+		m.CacheWriteMultiplier, m.CacheReadMultiplier, m.TimeoutSeconds)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert model: %w", err)
 	}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+var (
+	// ErrModelRoleExists is returned when creating a role whose name is taken.
+	ErrModelRoleExists = errors.New("role already exists")
+	// ErrModelRoleNotFound is returned when deleting a role that does not exist.
+	ErrModelRoleNotFound = errors.New("role not found")
+	// ErrModelRoleBuiltin is returned when deleting a builtin role.
+	ErrModelRoleBuiltin = errors.New("builtin roles cannot be deleted")
+	// ErrModelRoleInUse is returned when deleting a role that models, routing
+	// rules or the routing config still refer to.
+	ErrModelRoleInUse = errors.New("role is still in use")
+)
+
+// ModelRoleRepository provides access to the task-type roles.
+type ModelRoleRepository struct {
+	db *sql.DB
+}
+
+// NewModelRoleRepository creates a new ModelRoleRepository.
+func NewModelRoleRepository(db *sql.DB) *ModelRoleRepository {
+	return &ModelRoleRepository{db: db}
+}
+
+// List returns all roles, builtin roles first.
+func (r *ModelRoleRepository) List(ctx context.Context) ([]*models.ModelRoleDefinition, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT name, description, builtin, created_at FROM model_roles
+		 ORDER BY builtin DESC, CASE name WHEN 'simple' THEN 0 WHEN 'default' THEN 1 WHEN 'complex' THEN 2 ELSE 3 END, name`)
+	if err != nil {
+		return nil, fmt.Errorf("query model roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []*models.ModelRoleDefinition{}
+	for rows.Next() {
+		var role models.ModelRoleDefinition
+		var builtin int
+		var createdAt sql.NullTime
+		if err := rows.Scan(&role.Name, &role.Description, &builtin, &createdAt); err != nil {
+			return nil, fmt.Errorf("scan model role: %w", err)
+		}
+		role.Builtin = builtin == 1
+		if createdAt.Valid {
+			role.CreatedAt = createdAt.Time
+		}
+		roles = append(roles, &role)
+	}
+	return roles, rows.Err()
+}
+
+// Create adds a custom role.
+func (r *ModelRoleRepository) Create(ctx context.Context, role *models.ModelRoleDefinition) error {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO model_roles (name, description, builtin, created_at) VALUES (?, ?, 0, ?)`,
+		string(role.Name), role.Description, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("insert model role: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrModelRoleExists
+	}
+	return nil
+}
+
+// UpdateDescription changes a role's description.
+func (r *ModelRoleRepository) UpdateDescription(ctx context.Context, name, description string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE model_roles SET description = ? WHERE name = ?`, description, name)
+	if err != nil {
+		return fmt.Errorf("update model role: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrModelRoleNotFound
+	}
+	return nil
+}
+
+// Delete removes a custom role that no model or routing rule refers to.
+func (r *ModelRoleRepository) Delete(ctx context.Context, name string) error {
+	var builtin int
+	err := r.db.QueryRowContext(ctx, `SELECT builtin FROM model_roles WHERE name = ?`, name).Scan(&builtin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrModelRoleNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("get model role: %w", err)
+	}
+	if builtin == 1 {
+		return ErrModelRoleBuiltin
+	}
+
+	var uses int
+	if err := r.db.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM models WHERE role = ?) + (SELECT COUNT(*) FROM routing_rules WHERE task_type = ?)`,
+		name, name).Scan(&uses); err != nil {
+		return fmt.Errorf("count model role uses: %w", err)
+	}
+	if uses > 0 {
+		return fmt.Errorf("%w by %d models or routing rules", ErrModelRoleInUse, uses)
+	}
+	if setting, err := r.routingConfigUse(ctx, name); err != nil {
+		return err
+	} else if setting != "" {
+		return fmt.Errorf("%w by the routing config's %s", ErrModelRoleInUse, setting)
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM model_roles WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("delete model role: %w", err)
+	}
+	return nil
+}
+
+// routingConfigUse returns the routing config setting that refers to the
+// role, or "" if none does. An unparseable fallback chain is ignored, as the
+// routing config itself ignores it.
+func (r *ModelRoleRepository) routingConfigUse(ctx context.Context, name string) (string, error) {
+	var fallbackTaskType, fallbackChain sql.NullString
+	err := r.db.QueryRowContext(ctx,
+		`SELECT rule_fallback_task_type, role_fallback_chain FROM routing_llm_config WHERE id = 1`,
+	).Scan(&fallbackTaskType, &fallbackChain)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get routing config roles: %w", err)
+	}
+	if fallbackTaskType.String == name {
+		return "rule_fallback_task_type", nil
+	}
+	var chain []string
+	if fallbackChain.String != "" && json.Unmarshal([]byte(fallbackChain.String), &chain) == nil && slices.Contains(chain, name) {
+		return "role_fallback_chain", nil
+	}
+	return "", nil
+}
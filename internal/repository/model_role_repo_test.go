@@ -0,0 +1,59 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/tests/testutil"
+)
+
+func TestModelRoleRepository_CreateListDelete(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	repo := NewModelRoleRepository(db)
+	ctx := context.Background()
+
+	require.NoError(t, repo.Create(ctx, &models.ModelRoleDefinition{Name: "vision", Description: "image input"}))
+	assert.ErrorIs(t, repo.Create(ctx, &models.ModelRoleDefinition{Name: "vision"}), ErrModelRoleExists)
+	require.NoError(t, repo.Create(ctx, &models.ModelRoleDefinition{Name: "long-context"}))
+	require.NoError(t, repo.UpdateDescription(ctx, "long-context", "200k+ prompts"))
+	assert.ErrorIs(t, repo.UpdateDescription(ctx, "missing", ""), ErrModelRoleNotFound)
+
+	roles, err := repo.List(ctx)
+	require.NoError(t, err)
+	var names []models.ModelRole
+	for _, r := range roles {
+		names = append(names, r.Name)
+	}
+	assert.Equal(t, []models.ModelRole{"simple", "default", "complex", "long-context", "vision"}, names)
+	assert.True(t, roles[0].Builtin)
+	assert.False(t, roles[4].Builtin)
+	assert.Equal(t, "image input", roles[4].Description)
+	assert.Equal(t, "200k+ prompts", roles[3].Description)
+
+	_, err = db.Exec(`INSERT INTO models (name, role) VALUES ('claude-vision', 'vision')`)
+	require.NoError(t, err)
+	assert.ErrorIs(t, repo.Delete(ctx, "vision"), ErrModelRoleInUse)
+	assert.ErrorIs(t, repo.Delete(ctx, "simple"), ErrModelRoleBuiltin)
+	assert.ErrorIs(t, repo.Delete(ctx, "missing"), ErrModelRoleNotFound)
+
+	// Roles the routing config falls back to are in use too.
+	_, err = db.Exec(`INSERT INTO routing_llm_config (id, rule_fallback_task_type, role_fallback_chain) VALUES (1, 'long-context', '["long-context","default"]')`)
+	require.NoError(t, err)
+	assert.ErrorIs(t, repo.Delete(ctx, "long-context"), ErrModelRoleInUse)
+	_, err = db.Exec(`UPDATE routing_llm_config SET rule_fallback_task_type = 'default'`)
+	require.NoError(t, err)
+	assert.ErrorIs(t, repo.Delete(ctx, "long-context"), ErrModelRoleInUse)
+	_, err = db.Exec(`UPDATE routing_llm_config SET role_fallback_chain = '["complex","default"]'`)
+	require.NoError(t, err)
+	require.NoError(t, repo.Delete(ctx, "long-context"))
+
+	roles, err = repo.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, roles, 4)
+}
@@ -23,16 +23,16 @@ func NewProviderRepository(db *sql.DB) *SQLProviderRepository {
 
 func (r *SQLProviderRepository) FindByID(ctx context.Context, id int64) (*models.Provider, error) {
 	row := r.db.QueryRowContext(ctx,
-		`SELECT id, name, base_url, api_key, weight, max_concurrent,
-		        enabled, description, custom_headers, created_at, updated_at
+		`SELECT id, name, base_url, api_key, weight, max_concurrent, priority, rpm_limit, tpm_limit,
+		        enabled, description, custom_headers, retry_rules, health_check_method, health_check_path, auth_scheme, auth_header, timeout_seconds, stream_only, anthropic_version, api_path_prefix, cost_multiplier, shadow, shadow_sample_rate, created_at, updated_at
 		 FROM providers WHERE id = ?`, id)
 	return scanProvider(row)
 }
 
 func (r *SQLProviderRepository) FindByModelID(ctx context.Context, modelID int64) ([]*models.Provider, error) {
 	rows, err := r.db.QueryContext(ctx,
-		`SELECT p.id, p.name, p.base_url, p.api_key, p.weight, p.max_concurrent,
-		        p.enabled, p.description, p.custom_headers, p.created_at, p.updated_at
+		`SELECT p.id, p.name, p.base_url, p.api_key, p.weight, p.max_concurrent, p.priority, p.rpm_limit, p.tpm_limit,
+		        p.enabled, p.description, p.custom_headers, p.retry_rules, p.health_check_method, p.health_check_path, p.auth_scheme, p.auth_header, p.timeout_seconds, p.stream_only, p.anthropic_version, p.api_path_prefix, p.cost_multiplier, p.shadow, p.shadow_sample_rate, p.created_at, p.updated_at
 		 FROM providers p
 		 JOIN provider_models pm ON p.id = pm.provider_id
 		 WHERE pm.model_id = ? AND p.enabled = 1
@@ -46,8 +46,8 @@ func (r *SQLProviderRepository) FindByModelID(ctx context.Context, modelID int64
 
 func (r *SQLProviderRepository) FindAllEnabled(ctx context.Context) ([]*models.Provider, error) {
 	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, name, base_url, api_key, weight, max_concurrent,
-		        enabled, description, custom_headers, created_at, updated_at
+		`SELECT id, name, base_url, api_key, weight, max_concurrent, priority, rpm_limit, tpm_limit,
+		        enabled, description, custom_headers, retry_rules, health_check_method, health_check_path, auth_scheme, auth_header, timeout_seconds, stream_only, anthropic_version, api_path_prefix, cost_multiplier, shadow, shadow_sample_rate, created_at, updated_at
 		 FROM providers WHERE enabled = 1 ORDER BY id`)
 	if err != nil {
 		return nil, err
@@ -58,21 +58,24 @@ func (r *SQLProviderRepository) FindAllEnabled(ctx context.Context) ([]*models.P
 
 func scanProvider(s scanner) (*models.Provider, error) {
 	var p models.Provider
-	var enabled int
+	var enabled, streamOnly, shadow int
 	var description sql.NullString
 	var customHeaders sql.NullString
+	var retryRules sql.NullString
 	var createdAt, updatedAt sql.NullTime
 
 	err := s.Scan(
 		&p.ID, &p.Name, &p.BaseURL, &p.APIKey,
-		&p.Weight, &p.MaxConcurrent, &enabled,
-		&description, &customHeaders, &createdAt, &updatedAt,
+		&p.Weight, &p.MaxConcurrent, &p.Priority, &p.RPMLimit, &p.TPMLimit, &enabled,
+		&description, &customHeaders, &retryRules, &p.HealthCheckMethod, &p.HealthCheckPath, &p.AuthScheme, &p.AuthHeader, &p.TimeoutSeconds, &streamOnly, &p.AnthropicVersion, &p.APIPathPrefix, &p.CostMultiplier, &shadow, &p.ShadowSampleRate, &createdAt, &updatedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
 
 	p.Enabled = enabled == 1
+	p.StreamOnly = streamOnly == 1
+	p.Shadow = shadow == 1
 	if description.Valid {
 		p.Description = description.String
 	}
@@ -81,6 +84,11 @@ func scanProvider(s scanner) (*models.Provider, error) {
 			return nil, fmt.Errorf("unmarshal custom_headers for provider %d: %w", p.ID, err)
 		}
 	}
+	if retryRules.Valid && retryRules.String != "" {
+		if err := json.Unmarshal([]byte(retryRules.String), &p.RetryRules); err != nil {
+			return nil, fmt.Errorf("unmarshal retry_rules for provider %d: %w", p.ID, err)
+		}
+	}
 	if createdAt.Valid {
 		p.CreatedAt = createdAt.Time
 	} else {
@@ -108,8 +116,8 @@ func scanProviders(rows *sql.Rows) ([]*models.Provider, error) {
 
 func (r *SQLProviderRepository) FindAll(ctx context.Context) ([]*models.Provider, error) {
 	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, name, base_url, api_key, weight, max_concurrent,
-		        enabled, description, custom_headers, created_at, updated_at
+		`SELECT id, name, base_url, api_key, weight, max_concurrent, priority, rpm_limit, tpm_limit,
+		        enabled, description, custom_headers, retry_rules, health_check_method, health_check_path, auth_scheme, auth_header, timeout_seconds, stream_only, anthropic_version, api_path_prefix, cost_multiplier, shadow, shadow_sample_rate, created_at, updated_at
 		 FROM providers ORDER BY id`)
 	if err != nil {
 		return nil, err
@@ -132,12 +140,27 @@ func (r *SQLProviderRepository) Insert(ctx context.Context, p *models.Provider,
 			customHeadersJSON = string(b)
 		}
 	}
+	retryRulesJSON := ""
+	if len(p.RetryRules) > 0 {
+		if b, err := json.Marshal(p.RetryRules); err == nil {
+			retryRulesJSON = string(b)
+		}
+	}
+	healthCheckMethod := p.HealthCheckMethod
+	if healthCheckMethod == "" {
+		healthCheckMethod = models.HealthCheckGet
+	}
+	authScheme := p.AuthScheme
+	if authScheme == "" {
+		authScheme = models.AuthSchemeAnthropic
+	}
 	result, err := tx.ExecContext(ctx,
-		`INSERT INTO providers (name, base_url, api_key, weight, max_concurrent,
-		        enabled, description, custom_headers, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		p.Name, p.BaseURL, p.APIKey, p.Weight, p.MaxConcurrent,
-		boolToInt(p.Enabled), p.Description, customHeadersJSON, now, now)
+		`INSERT INTO providers (name, base_url, api_key, weight, max_concurrent, priority, rpm_limit, tpm_limit,
+		        enabled, description, custom_headers, retry_rules, health_check_method, health_check_path, auth_scheme, auth_header, timeout_seconds, stream_only, anthropic_version, api_path_prefix, cost_multiplier, shadow, shadow_sample_rate, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.Name, p.BaseURL, p.APIKey, p.Weight, p.MaxConcurrent, p.Priority, p.RPMLimit, p.TPMLimit,
+		boolToInt(p.Enabled), p.Description, customHeadersJSON, retryRulesJSON, healthCheckMethod, p.HealthCheckPath,
+		authScheme, p.AuthHeader, p.TimeoutSeconds, boolToInt(p.StreamOnly), p.AnthropicVersion, p.APIPathPrefix, p.PriceFactor(), boolToInt(p.Shadow), p.ShadowSampleRate, now, now)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert provider: %w", err)
 	}
@@ -183,6 +206,16 @@ func (r *SQLProviderRepository) Update(ctx context.Context, id int64, updates ma
 					}
 				}
 			}
+			if field == "retry_rules" {
+				if rules, ok := value.([]models.RetryRule); ok {
+					value = ""
+					if len(rules) > 0 {
+						if b, err := json.Marshal(rules); err == nil {
+							value = string(b)
+						}
+					}
+				}
+			}
 			setClauses = append(setClauses, field+" = ?")
 			params = append(params, value)
 		}
@@ -132,7 +132,15 @@ func TestProviderRepository_Insert(t *testing.T) {
 				APIKey:        "sk-azure-key",
 				Weight:        1,
 				MaxConcurrent: 5,
+				Priority:      2,
+				RPMLimit:      500,
+				TPMLimit:      80000,
 				Enabled:       true,
+				RetryRules: []models.RetryRule{
+					{StatusCodes: []int{400}, MessageRegex: "model loading", Retry: true},
+				},
+				HealthCheckMethod: models.HealthCheckGet,
+				HealthCheckPath:   "/health",
 			},
 			modelIDs: nil,
 			wantErr:  false,
@@ -153,6 +161,12 @@ func TestProviderRepository_Insert(t *testing.T) {
 				require.NoError(t, err)
 				assert.Equal(t, tt.provider.Name, found.Name)
 				assert.Equal(t, tt.provider.BaseURL, found.BaseURL)
+				assert.Equal(t, tt.provider.Priority, found.Priority)
+				assert.Equal(t, tt.provider.RPMLimit, found.RPMLimit)
+				assert.Equal(t, tt.provider.TPMLimit, found.TPMLimit)
+				assert.Equal(t, tt.provider.RetryRules, found.RetryRules)
+				assert.Equal(t, models.HealthCheckGet, found.HealthCheckMethod)
+				assert.Equal(t, tt.provider.HealthCheckPath, found.HealthCheckPath)
 
 				// Verify model associations
 				if len(tt.modelIDs) > 0 {
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// requestLogFeedBuffer is how many logs a subscriber may fall behind before
+// further logs are dropped for it.
+const requestLogFeedBuffer = 256
+
+// RequestLogFeed fans newly inserted request logs out to live subscribers.
+// It is in-process only: with several workers a subscriber sees the logs of
+// the worker serving it. Publishing never blocks; a subscriber whose buffer
+// is full misses logs and is told how many through Dropped. A nil feed
+// publishes nothing.
+type RequestLogFeed struct {
+	mu   sync.RWMutex
+	subs map[*RequestLogSubscription]struct{}
+}
+
+// RequestLogSubscription receives the logs published to a RequestLogFeed.
+type RequestLogSubscription struct {
+	C <-chan *models.RequestLog
+
+	ch      chan *models.RequestLog
+	dropped atomic.Int64
+}
+
+// NewRequestLogFeed creates an empty RequestLogFeed.
+func NewRequestLogFeed() *RequestLogFeed {
+	return &RequestLogFeed{subs: make(map[*RequestLogSubscription]struct{})}
+}
+
+// Subscribe registers a subscriber. Callers must Unsubscribe when done.
+func (f *RequestLogFeed) Subscribe() *RequestLogSubscription {
+	ch := make(chan *models.RequestLog, requestLogFeedBuffer)
+	sub := &RequestLogSubscription{C: ch, ch: ch}
+	f.mu.Lock()
+	f.subs[sub] = struct{}{}
+	f.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe removes a subscriber; no more logs are sent to it.
+func (f *RequestLogFeed) Unsubscribe(sub *RequestLogSubscription) {
+	f.mu.Lock()
+	delete(f.subs, sub)
+	f.mu.Unlock()
+}
+
+// Subscribers returns the number of current subscribers.
+func (f *RequestLogFeed) Subscribers() int {
+	if f == nil {
+		return 0
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.subs)
+}
+
+// Publish sends log to every subscriber with room in its buffer and counts
+// it as dropped for the others.
+func (f *RequestLogFeed) Publish(log *models.RequestLog) {
+	if f == nil {
+		return
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for sub := range f.subs {
+		select {
+		case sub.ch <- log:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped returns the number of logs dropped for the subscriber since the
+// last call.
+func (s *RequestLogSubscription) Dropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+// requestLogFromEntry builds the log published for an inserted entry. Like
+// List it leaves out the request and response content.
+func requestLogFromEntry(id int64, entry *models.RequestLogEntry, createdAt time.Time) *models.RequestLog {
+	return &models.RequestLog{
+		ID:                       id,
+		RequestID:                entry.RequestID,
+		UserID:                   entry.UserID,
+		APIKeyID:                 entry.APIKeyID,
+		ModelName:                entry.ModelName,
+		EndpointName:             entry.EndpointName,
+		TaskType:                 entry.TaskType,
+		InputTokens:              entry.InputTokens,
+		OutputTokens:             entry.OutputTokens,
+		LatencyMs:                entry.LatencyMs,
+		Cost:                     entry.Cost,
+		StatusCode:               entry.StatusCode,
+		Success:                  entry.Success,
+		Stream:                   entry.Stream,
+		CreatedAt:                createdAt,
+		RoutingMethod:            entry.RoutingMethod,
+		RoutingReason:            entry.RoutingReason,
+		MatchedRuleID:            entry.MatchedRuleID,
+		MatchedRuleName:          entry.MatchedRuleName,
+		AllMatches:               entry.AllMatches,
+		IsInaccurate:             entry.IsInaccurate,
+		RetryChain:               entry.RetryChain,
+		FallbackChain:            entry.FallbackChain,
+		EndUserID:                entry.EndUserID,
+		ThinkingClampedFrom:      entry.ThinkingClampedFrom,
+		CacheCreationInputTokens: entry.CacheCreationInputTokens,
+		CacheReadInputTokens:     entry.CacheReadInputTokens,
+	}
+}
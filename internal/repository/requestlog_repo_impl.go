@@ -3,8 +3,11 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,18 +17,37 @@ import (
 
 // RequestLogRepositoryImpl implements request log data access.
 type RequestLogRepositoryImpl struct {
-	db     *sql.DB // write operations
-	readDB *sql.DB // read operations (may be a separate read-only pool)
-	logger *zap.Logger
+	db          *sql.DB // write operations
+	readDB      *sql.DB // read operations (may be a separate read-only pool)
+	logger      *zap.Logger
+	costDisplay CostDisplay
+	feed        *RequestLogFeed // Receives each inserted log; nil = none
+}
+
+// CostDisplay controls how costs are presented in statistics. Stored costs
+// are always USD and are never converted.
+type CostDisplay struct {
+	Precision int     // Decimal places costs are rounded to
+	Currency  string  // Currency label reported with statistics
+	USDRate   float64 // Units of Currency per USD
+}
+
+// DefaultCostDisplay reports costs in USD to six decimal places.
+var DefaultCostDisplay = CostDisplay{Precision: 6, Currency: "USD", USDRate: 1}
+
+// convert turns a stored USD cost into a display amount.
+func (d CostDisplay) convert(usd float64) float64 {
+	return roundToPlaces(usd*d.USDRate, d.Precision)
 }
 
 // NewRequestLogRepositoryImpl creates a new RequestLogRepositoryImpl.
 // If readDB is nil, db is used for both reads and writes.
 func NewRequestLogRepositoryImpl(db *sql.DB, logger *zap.Logger, readDB ...*sql.DB) *RequestLogRepositoryImpl {
 	r := &RequestLogRepositoryImpl{
-		db:     db,
-		readDB: db,
-		logger: logger,
+		db:          db,
+		readDB:      db,
+		logger:      logger,
+		costDisplay: DefaultCostDisplay,
 	}
 	if len(readDB) > 0 && readDB[0] != nil {
 		r.readDB = readDB[0]
@@ -33,14 +55,42 @@ func NewRequestLogRepositoryImpl(db *sql.DB, logger *zap.Logger, readDB ...*sql.
 	return r
 }
 
-// Insert inserts a new request log entry.
+// SetCostDisplay sets the precision and currency of costs in statistics.
+func (r *RequestLogRepositoryImpl) SetCostDisplay(d CostDisplay) {
+	r.costDisplay = d
+}
+
+// SetFeed sets the feed inserted logs are published to (nil disables it).
+func (r *RequestLogRepositoryImpl) SetFeed(feed *RequestLogFeed) {
+	r.feed = feed
+}
+
+// Insert inserts a new request log entry and publishes it to the feed.
 func (r *RequestLogRepositoryImpl) Insert(ctx context.Context, entry *models.RequestLogEntry) (int64, error) {
 	allMatchesJSON, err := json.Marshal(entry.AllMatches)
 	if err != nil {
 		allMatchesJSON = []byte("[]")
 	}
+	retryChainJSON := []byte("[]")
+	if len(entry.RetryChain) > 0 {
+		if b, err := json.Marshal(entry.RetryChain); err == nil {
+			retryChainJSON = b
+		}
+	}
+	fallbackChainJSON := []byte("[]")
+	if len(entry.FallbackChain) > 0 {
+		if b, err := json.Marshal(entry.FallbackChain); err == nil {
+			fallbackChainJSON = b
+		}
+	}
 
-	result, err := r.db.ExecContext(ctx,
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert request log: %w", err)
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx,
 		`INSERT INTO request_logs (
 			request_id, user_id, api_key_id, model_name, endpoint_name,
 			task_type, input_tokens, output_tokens, latency_ms, cost,
@@ -48,19 +98,37 @@ func (r *RequestLogRepositoryImpl) Insert(ctx context.Context, entry *models.Req
 			message_preview, request_content, response_content,
 			routing_method, routing_reason,
 			matched_rule_id, matched_rule_name, all_matches,
-			is_inaccurate, created_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			is_inaccurate, retry_chain, fallback_chain, thinking_clamped_from,
+			cache_creation_input_tokens, cache_read_input_tokens, end_user_id, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		entry.RequestID, entry.UserID, entry.APIKeyID, entry.ModelName, entry.EndpointName,
 		entry.TaskType, entry.InputTokens, entry.OutputTokens, entry.LatencyMs, entry.Cost,
 		entry.StatusCode, boolToInt(entry.Success), boolToInt(entry.Stream),
 		entry.MessagePreview, entry.RequestContent, entry.ResponseContent,
 		entry.RoutingMethod, entry.RoutingReason,
 		entry.MatchedRuleID, entry.MatchedRuleName, string(allMatchesJSON),
-		boolToInt(entry.IsInaccurate), time.Now().UTC().Format("2006-01-02 15:04:05"))
+		boolToInt(entry.IsInaccurate), string(retryChainJSON), string(fallbackChainJSON), entry.ThinkingClampedFrom,
+		entry.CacheCreationInputTokens, entry.CacheReadInputTokens, entry.EndUserID, createdAt.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert request log: %w", err)
+	}
+	id, err := result.LastInsertId()
 	if err != nil {
+		return 0, err
+	}
+	if entry.Cost > 0 {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO user_monthly_spend (user_id, period, cost) VALUES (?, ?, ?)
+			 ON CONFLICT(user_id, period) DO UPDATE SET cost = cost + excluded.cost`,
+			entry.UserID, createdAt.Format(spendPeriodLayout), entry.Cost); err != nil {
+			return 0, fmt.Errorf("failed to record user spend: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
 		return 0, fmt.Errorf("failed to insert request log: %w", err)
 	}
-	return result.LastInsertId()
+	r.feed.Publish(requestLogFromEntry(id, entry, createdAt))
+	return id, nil
 }
 
 // List retrieves request logs with filtering and pagination.
@@ -72,7 +140,7 @@ func (r *RequestLogRepositoryImpl) List(
 	startTime, endTime *time.Time,
 	success *bool,
 ) ([]*models.RequestLog, int64, error) {
-	whereSQL, params := r.buildWhere(userID, modelName, endpointName, startTime, endTime, success)
+	whereSQL, params := r.buildWhere(userID, nil, modelName, endpointName, startTime, endTime, success)
 
 	// Count total
 	var total int64
@@ -93,7 +161,9 @@ func (r *RequestLogRepositoryImpl) List(
 			'' as message_preview, '' as request_content, '' as response_content,
 			request_logs.routing_method, request_logs.routing_reason,
 			request_logs.matched_rule_id, request_logs.matched_rule_name, request_logs.all_matches,
-			request_logs.is_inaccurate
+			request_logs.is_inaccurate, request_logs.retry_chain, request_logs.fallback_chain, request_logs.thinking_clamped_from,
+			request_logs.cache_creation_input_tokens, request_logs.cache_read_input_tokens,
+			request_logs.end_user_id
 		FROM request_logs
 		LEFT JOIN users u ON request_logs.user_id = u.id
 		WHERE %s
@@ -120,6 +190,161 @@ func (r *RequestLogRepositoryImpl) List(
 	return logs, total, rows.Err()
 }
 
+// ErrInvalidLogCursor is returned by ListAfter for a malformed cursor token.
+var ErrInvalidLogCursor = errors.New("invalid log cursor")
+
+// logCursorTimeFormat matches how created_at is stored.
+const logCursorTimeFormat = "2006-01-02 15:04:05"
+
+// encodeLogCursor returns the opaque token that resumes listing after log.
+func encodeLogCursor(log *models.RequestLog) string {
+	raw := log.CreatedAt.UTC().Format(logCursorTimeFormat) + "|" + strconv.FormatInt(log.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeLogCursor splits a cursor token into its created_at and id.
+func decodeLogCursor(token string) (string, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", 0, ErrInvalidLogCursor
+	}
+	createdAt, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return "", 0, ErrInvalidLogCursor
+	}
+	if _, err := time.Parse(logCursorTimeFormat, createdAt); err != nil {
+		return "", 0, ErrInvalidLogCursor
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return "", 0, ErrInvalidLogCursor
+	}
+	return createdAt, id, nil
+}
+
+// ListAfter retrieves request logs newest first using keyset pagination on
+// (created_at, id), which stays fast on large tables and neither skips nor
+// repeats rows as new logs arrive. An empty cursor starts from the newest log.
+// The returned cursor fetches the next page and is empty after the last one.
+func (r *RequestLogRepositoryImpl) ListAfter(
+	ctx context.Context,
+	cursor string,
+	limit int,
+	userID *int64,
+	modelName, endpointName *string,
+	startTime, endTime *time.Time,
+	success *bool,
+) ([]*models.RequestLog, string, error) {
+	whereSQL, params := r.buildWhere(userID, nil, modelName, endpointName, startTime, endTime, success)
+	if cursor != "" {
+		createdAt, id, err := decodeLogCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		whereSQL += " AND (request_logs.created_at < ? OR (request_logs.created_at = ? AND request_logs.id < ?))"
+		params = append(params, createdAt, createdAt, id)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			request_logs.id, request_logs.request_id, request_logs.user_id,
+			COALESCE(u.username, '未知用户') as username,
+			request_logs.api_key_id, request_logs.model_name, request_logs.endpoint_name,
+			request_logs.task_type, request_logs.input_tokens, request_logs.output_tokens,
+			request_logs.latency_ms, request_logs.cost, request_logs.status_code,
+			request_logs.success, request_logs.stream, request_logs.created_at,
+			'' as message_preview, '' as request_content, '' as response_content,
+			request_logs.routing_method, request_logs.routing_reason,
+			request_logs.matched_rule_id, request_logs.matched_rule_name, request_logs.all_matches,
+			request_logs.is_inaccurate, request_logs.retry_chain, request_logs.fallback_chain, request_logs.thinking_clamped_from,
+			request_logs.cache_creation_input_tokens, request_logs.cache_read_input_tokens,
+			request_logs.end_user_id
+		FROM request_logs
+		LEFT JOIN users u ON request_logs.user_id = u.id
+		WHERE %s
+		ORDER BY request_logs.created_at DESC, request_logs.id DESC
+		LIMIT ?
+	`, whereSQL)
+
+	// Fetch one extra row to learn whether another page follows.
+	params = append(params, limit+1)
+	rows, err := r.readDB.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query logs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := make([]*models.RequestLog, 0, limit)
+	for rows.Next() {
+		log, err := r.scanLog(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		logs = append(logs, log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(logs) > limit {
+		logs = logs[:limit]
+		next = encodeLogCursor(logs[limit-1])
+	}
+	return logs, next, nil
+}
+
+// Export calls fn for every request log matching the filters, oldest first,
+// reading rows one at a time so arbitrarily large exports use constant
+// memory. Content columns are left empty, as in List. Iteration stops at the
+// first error from fn, which is returned.
+func (r *RequestLogRepositoryImpl) Export(
+	ctx context.Context,
+	userID *int64,
+	modelName, endpointName *string,
+	startTime, endTime *time.Time,
+	success *bool,
+	fn func(*models.RequestLog) error,
+) error {
+	whereSQL, params := r.buildWhere(userID, nil, modelName, endpointName, startTime, endTime, success)
+	query := fmt.Sprintf(`
+		SELECT
+			request_logs.id, request_logs.request_id, request_logs.user_id,
+			COALESCE(u.username, '未知用户') as username,
+			request_logs.api_key_id, request_logs.model_name, request_logs.endpoint_name,
+			request_logs.task_type, request_logs.input_tokens, request_logs.output_tokens,
+			request_logs.latency_ms, request_logs.cost, request_logs.status_code,
+			request_logs.success, request_logs.stream, request_logs.created_at,
+			'' as message_preview, '' as request_content, '' as response_content,
+			request_logs.routing_method, request_logs.routing_reason,
+			request_logs.matched_rule_id, request_logs.matched_rule_name, request_logs.all_matches,
+			request_logs.is_inaccurate, request_logs.retry_chain, request_logs.fallback_chain, request_logs.thinking_clamped_from,
+			request_logs.cache_creation_input_tokens, request_logs.cache_read_input_tokens,
+			request_logs.end_user_id
+		FROM request_logs
+		LEFT JOIN users u ON request_logs.user_id = u.id
+		WHERE %s
+		ORDER BY request_logs.created_at, request_logs.id
+	`, whereSQL)
+
+	rows, err := r.readDB.QueryContext(ctx, query, params...)
+	if err != nil {
+		return fmt.Errorf("failed to query logs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		log, err := r.scanLog(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(log); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 // GetStatistics retrieves aggregated statistics. Queries run sequentially
 // to stay compatible with single-connection SQLite (e.g. in-memory test DBs).
 func (r *RequestLogRepositoryImpl) GetStatistics(
@@ -129,7 +354,7 @@ func (r *RequestLogRepositoryImpl) GetStatistics(
 	modelName, endpointName *string,
 	success *bool,
 ) (*LogStatistics, error) {
-	whereSQL, params := r.buildWhere(userID, modelName, endpointName, startTime, endTime, success)
+	whereSQL, params := r.buildWhere(userID, nil, modelName, endpointName, startTime, endTime, success)
 
 	var stats LogStatistics
 
@@ -144,17 +369,25 @@ func (r *RequestLogRepositoryImpl) GetStatistics(
 				ELSE 0
 			END as success_rate,
 			COALESCE(SUM(input_tokens), 0) as total_input_tokens,
-			COALESCE(SUM(output_tokens), 0) as total_output_tokens
+			COALESCE(SUM(output_tokens), 0) as total_output_tokens,
+			COALESCE(SUM(request_logs.cache_creation_input_tokens), 0) as total_cache_creation_tokens,
+			COALESCE(SUM(request_logs.cache_read_input_tokens), 0) as total_cache_read_tokens,
+			COALESCE(SUM(request_logs.cache_read_input_tokens * m.cost_per_mtok_input
+				* (1 - m.cache_read_multiplier)), 0) / 1000000.0 as cache_savings
 		FROM request_logs
+		LEFT JOIN models m ON m.name = request_logs.model_name
 		WHERE %s
 	`, whereSQL)
 	if err := r.readDB.QueryRowContext(ctx, overallQuery, params...).Scan(
 		&stats.TotalRequests, &stats.TotalCost, &stats.AvgLatency,
 		&stats.SuccessRate, &stats.TotalInputTokens, &stats.TotalOutputTokens,
+		&stats.TotalCacheCreationTokens, &stats.TotalCacheReadTokens, &stats.CacheSavings,
 	); err != nil {
 		return nil, fmt.Errorf("failed to get overall statistics: %w", err)
 	}
-	stats.TotalCost = roundToPlaces(stats.TotalCost, 6)
+	stats.TotalCost = r.costDisplay.convert(stats.TotalCost)
+	stats.CacheSavings = r.costDisplay.convert(stats.CacheSavings)
+	stats.Currency = r.costDisplay.Currency
 	stats.AvgLatency = roundToPlaces(stats.AvgLatency, 2)
 	stats.SuccessRate = roundToPlaces(stats.SuccessRate, 2)
 
@@ -202,7 +435,7 @@ func (r *RequestLogRepositoryImpl) GetStatistics(
 			stats.ByModel = append(stats.ByModel, ModelStatistics{
 				ModelName:    name,
 				Requests:     requests,
-				Cost:         roundToPlaces(cost, 6),
+				Cost:         r.costDisplay.convert(cost),
 				AvgLatency:   roundToPlaces(avgLatency, 2),
 				InputTokens:  inputTokens,
 				OutputTokens: outputTokens,
@@ -211,7 +444,7 @@ func (r *RequestLogRepositoryImpl) GetStatistics(
 			stats.ByEndpoint = append(stats.ByEndpoint, EndpointStatistics{
 				EndpointName: name,
 				Requests:     requests,
-				Cost:         roundToPlaces(cost, 6),
+				Cost:         r.costDisplay.convert(cost),
 				AvgLatency:   roundToPlaces(avgLatency, 2),
 				SuccessRate:  roundToPlaces(successRate, 2),
 			})
@@ -221,6 +454,91 @@ func (r *RequestLogRepositoryImpl) GetStatistics(
 		return nil, fmt.Errorf("failed to iterate grouped statistics: %w", err)
 	}
 
+	// 3. By end user (metadata.user_id), most expensive first
+	endUserQuery := fmt.Sprintf(`
+		SELECT end_user_id, COUNT(*), COALESCE(SUM(cost),0),
+			COALESCE(SUM(input_tokens),0), COALESCE(SUM(output_tokens),0)
+		FROM request_logs WHERE %s AND end_user_id != ''
+		GROUP BY end_user_id
+		ORDER BY 3 DESC, end_user_id
+		LIMIT %d
+	`, whereSQL, maxEndUserStatistics)
+	endUserRows, err := r.readDB.QueryContext(ctx, endUserQuery, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get end user statistics: %w", err)
+	}
+	defer endUserRows.Close()
+	for endUserRows.Next() {
+		var s EndUserStatistics
+		if err := endUserRows.Scan(&s.EndUserID, &s.Requests, &s.Cost, &s.InputTokens, &s.OutputTokens); err != nil {
+			return nil, fmt.Errorf("failed to scan end user statistics: %w", err)
+		}
+		s.Cost = r.costDisplay.convert(s.Cost)
+		stats.ByEndUser = append(stats.ByEndUser, s)
+	}
+	if err := endUserRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate end user statistics: %w", err)
+	}
+
+	return &stats, nil
+}
+
+// maxEndUserStatistics caps LogStatistics.ByEndUser, which can be as long as
+// a client's user base.
+const maxEndUserStatistics = 100
+
+// GetAPIKeyStatistics aggregates the requests made with an API key between
+// startTime and endTime (either may be nil for an open range).
+func (r *RequestLogRepositoryImpl) GetAPIKeyStatistics(ctx context.Context, apiKeyID int64, startTime, endTime *time.Time) (*APIKeyStatistics, error) {
+	whereSQL, params := r.buildWhere(nil, &apiKeyID, nil, nil, startTime, endTime, nil)
+
+	stats := APIKeyStatistics{APIKeyID: apiKeyID, Currency: r.costDisplay.Currency, ByModel: []ModelStatistics{}}
+	overallQuery := fmt.Sprintf(`
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(cost), 0),
+			CASE WHEN COUNT(*) > 0
+				THEN SUM(CASE WHEN success = 1 THEN 1 ELSE 0 END) * 100.0 / COUNT(*)
+				ELSE 0
+			END,
+			COALESCE(SUM(input_tokens), 0),
+			COALESCE(SUM(output_tokens), 0)
+		FROM request_logs
+		WHERE %s
+	`, whereSQL)
+	if err := r.readDB.QueryRowContext(ctx, overallQuery, params...).Scan(
+		&stats.TotalRequests, &stats.TotalCost, &stats.SuccessRate,
+		&stats.TotalInputTokens, &stats.TotalOutputTokens,
+	); err != nil {
+		return nil, fmt.Errorf("failed to get api key statistics: %w", err)
+	}
+	stats.TotalCost = r.costDisplay.convert(stats.TotalCost)
+	stats.SuccessRate = roundToPlaces(stats.SuccessRate, 2)
+
+	modelQuery := fmt.Sprintf(`
+		SELECT model_name, COUNT(*), COALESCE(SUM(cost),0), COALESCE(AVG(latency_ms),0),
+			COALESCE(SUM(input_tokens),0), COALESCE(SUM(output_tokens),0)
+		FROM request_logs WHERE %s
+		GROUP BY model_name
+		ORDER BY 2 DESC, model_name
+	`, whereSQL)
+	rows, err := r.readDB.QueryContext(ctx, modelQuery, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key model statistics: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m ModelStatistics
+		if err := rows.Scan(&m.ModelName, &m.Requests, &m.Cost, &m.AvgLatency, &m.InputTokens, &m.OutputTokens); err != nil {
+			return nil, fmt.Errorf("failed to scan api key model statistics: %w", err)
+		}
+		m.Cost = r.costDisplay.convert(m.Cost)
+		m.AvgLatency = roundToPlaces(m.AvgLatency, 2)
+		stats.ByModel = append(stats.ByModel, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate api key model statistics: %w", err)
+	}
 	return &stats, nil
 }
 
@@ -230,7 +548,7 @@ func (r *RequestLogRepositoryImpl) Count(
 	modelName, endpointName *string,
 	startTime, endTime *time.Time,
 ) (int64, error) {
-	whereSQL, params := r.buildWhere(nil, modelName, endpointName, startTime, endTime, nil)
+	whereSQL, params := r.buildWhere(nil, nil, modelName, endpointName, startTime, endTime, nil)
 
 	var count int64
 	query := fmt.Sprintf(`SELECT COUNT(*) FROM request_logs WHERE %s`, whereSQL)
@@ -240,13 +558,79 @@ func (r *RequestLogRepositoryImpl) Count(
 	return count, nil
 }
 
+// spendPeriodLayout formats the UTC calendar month of user_monthly_spend.
+const spendPeriodLayout = "2006-01"
+
+// MonthlySpendForUser returns the user's cost in USD in the UTC calendar
+// month containing month. It is kept apart from the request logs, so pruning
+// or deleting logs does not lower it.
+func (r *RequestLogRepositoryImpl) MonthlySpendForUser(ctx context.Context, userID int64, month time.Time) (float64, error) {
+	var total float64
+	err := r.readDB.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(cost), 0) FROM user_monthly_spend WHERE user_id = ? AND period = ?`,
+		userID, month.UTC().Format(spendPeriodLayout)).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user spend: %w", err)
+	}
+	return total, nil
+}
+
+// rejectionHourLayout formats the UTC hour of user_rate_limit_rejections.
+const rejectionHourLayout = "2006-01-02 15:00:00"
+
+// RecordRateLimited counts one request of userID rejected at at by the
+// proxy's own per-key rate limit. Rejections are counted per hour rather
+// than logged, so a client retrying against its limit adds no log rows.
+func (r *RequestLogRepositoryImpl) RecordRateLimited(ctx context.Context, userID int64, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO user_rate_limit_rejections (user_id, hour, count) VALUES (?, ?, 1)
+		 ON CONFLICT(user_id, hour) DO UPDATE SET count = count + 1`,
+		userID, at.UTC().Format(rejectionHourLayout))
+	if err != nil {
+		return fmt.Errorf("failed to record rate-limited request: %w", err)
+	}
+	return nil
+}
+
+// CountRateLimited counts requests rejected by the proxy's own per-key rate
+// limit. The counts are kept per hour, so startTime and endTime are rounded
+// down to the hour.
+func (r *RequestLogRepositoryImpl) CountRateLimited(
+	ctx context.Context,
+	userID *int64,
+	startTime, endTime *time.Time,
+) (int64, error) {
+	conditions := []string{"1=1"}
+	var params []any
+	if userID != nil {
+		conditions = append(conditions, "user_id = ?")
+		params = append(params, *userID)
+	}
+	if startTime != nil {
+		conditions = append(conditions, "hour >= ?")
+		params = append(params, startTime.UTC().Format(rejectionHourLayout))
+	}
+	if endTime != nil {
+		conditions = append(conditions, "hour <= ?")
+		params = append(params, endTime.UTC().Format(rejectionHourLayout))
+	}
+
+	var count int64
+	query := fmt.Sprintf(`SELECT COALESCE(SUM(count), 0) FROM user_rate_limit_rejections WHERE %s`,
+		strings.Join(conditions, " AND "))
+	if err := r.readDB.QueryRowContext(ctx, query, params...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count rate-limited requests: %w", err)
+	}
+	return count, nil
+}
+
 // Delete deletes logs matching the filters.
 func (r *RequestLogRepositoryImpl) Delete(
 	ctx context.Context,
 	modelName, endpointName *string,
 	startTime, endTime *time.Time,
 ) (int64, error) {
-	whereSQL, params := r.buildWhere(nil, modelName, endpointName, startTime, endTime, nil)
+	whereSQL, params := r.buildWhere(nil, nil, modelName, endpointName, startTime, endTime, nil)
 
 	query := fmt.Sprintf(`DELETE FROM request_logs WHERE %s`, whereSQL)
 	result, err := r.db.ExecContext(ctx, query, params...)
@@ -266,10 +650,37 @@ func (r *RequestLogRepositoryImpl) Delete(
 	return rowsAffected, nil
 }
 
+// DeleteOlderThan deletes at most limit logs created before cutoff and
+// returns how many were removed. Deleting in bounded batches keeps each
+// write transaction, and so the SQLite write lock, short.
+func (r *RequestLogRepositoryImpl) DeleteOlderThan(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM request_logs WHERE id IN (
+			SELECT id FROM request_logs WHERE created_at < ? ORDER BY created_at LIMIT ?
+		)`, cutoff.UTC().Format("2006-01-02 15:04:05"), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune logs: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected, nil
+}
+
+// Vacuum rebuilds the database file to return the space freed by deleted
+// logs to the filesystem.
+func (r *RequestLogRepositoryImpl) Vacuum(ctx context.Context) error {
+	if _, err := r.db.ExecContext(ctx, "VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	return nil
+}
+
 // buildWhere builds the WHERE clause for log queries.
 // All column references are qualified with table name to avoid ambiguity in JOIN queries.
 func (r *RequestLogRepositoryImpl) buildWhere(
-	userID *int64,
+	userID, apiKeyID *int64,
 	modelName, endpointName *string,
 	startTime, endTime *time.Time,
 	success *bool,
@@ -281,6 +692,10 @@ func (r *RequestLogRepositoryImpl) buildWhere(
 		conditions = append(conditions, "request_logs.user_id = ?")
 		params = append(params, *userID)
 	}
+	if apiKeyID != nil {
+		conditions = append(conditions, "request_logs.api_key_id = ?")
+		params = append(params, *apiKeyID)
+	}
 	if modelName != nil {
 		conditions = append(conditions, "request_logs.model_name = ?")
 		params = append(params, *modelName)
@@ -321,6 +736,10 @@ func (r *RequestLogRepositoryImpl) scanLog(rows *sql.Rows) (*models.RequestLog,
 	var matchedRuleName sql.NullString
 	var allMatchesJSON sql.NullString
 	var isInaccurate int
+	var retryChainJSON, fallbackChainJSON sql.NullString
+	var thinkingClampedFrom sql.NullInt64
+	var cacheCreationTokens, cacheReadTokens sql.NullInt64
+	var endUserID sql.NullString
 
 	err := rows.Scan(
 		&log.ID, &log.RequestID, &log.UserID, &log.Username,
@@ -330,7 +749,9 @@ func (r *RequestLogRepositoryImpl) scanLog(rows *sql.Rows) (*models.RequestLog,
 		&messagePreview, &requestContent, &responseContent,
 		&routingMethod, &routingReason,
 		&matchedRuleID, &matchedRuleName, &allMatchesJSON,
-		&isInaccurate,
+		&isInaccurate, &retryChainJSON, &fallbackChainJSON, &thinkingClampedFrom,
+		&cacheCreationTokens, &cacheReadTokens,
+		&endUserID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan log: %w", err)
@@ -380,6 +801,22 @@ func (r *RequestLogRepositoryImpl) scanLog(rows *sql.Rows) (*models.RequestLog,
 		}
 	}
 	log.IsInaccurate = isInaccurate == 1
+	if retryChainJSON.Valid && retryChainJSON.String != "" {
+		var chain []models.RetryAttempt
+		if err := json.Unmarshal([]byte(retryChainJSON.String), &chain); err == nil && len(chain) > 0 {
+			log.RetryChain = chain
+		}
+	}
+	if fallbackChainJSON.Valid && fallbackChainJSON.String != "" {
+		var chain []string
+		if err := json.Unmarshal([]byte(fallbackChainJSON.String), &chain); err == nil && len(chain) > 0 {
+			log.FallbackChain = chain
+		}
+	}
+	log.ThinkingClampedFrom = int(thinkingClampedFrom.Int64)
+	log.CacheCreationInputTokens = int(cacheCreationTokens.Int64)
+	log.CacheReadInputTokens = int(cacheReadTokens.Int64)
+	log.EndUserID = endUserID.String
 
 	return &log, nil
 }
@@ -397,7 +834,9 @@ func (r *RequestLogRepositoryImpl) GetByID(ctx context.Context, id int64) (*mode
 			request_logs.message_preview, request_logs.request_content, request_logs.response_content,
 			request_logs.routing_method, request_logs.routing_reason,
 			request_logs.matched_rule_id, request_logs.matched_rule_name, request_logs.all_matches,
-			request_logs.is_inaccurate
+			request_logs.is_inaccurate, request_logs.retry_chain, request_logs.fallback_chain, request_logs.thinking_clamped_from,
+			request_logs.cache_creation_input_tokens, request_logs.cache_read_input_tokens,
+			request_logs.end_user_id
 		FROM request_logs
 		LEFT JOIN users u ON request_logs.user_id = u.id
 		WHERE request_logs.id = ?
@@ -452,12 +891,33 @@ func parseFlexibleTime(s string) time.Time {
 type LogStatistics struct {
 	TotalRequests     int64                `json:"total_requests"`
 	TotalCost         float64              `json:"total_cost"`
+	Currency          string               `json:"currency"` // Currency of all costs in the statistics
 	AvgLatency        float64              `json:"avg_latency"`
 	SuccessRate       float64              `json:"success_rate"`
 	TotalInputTokens  int64                `json:"total_input_tokens"`
 	TotalOutputTokens int64                `json:"total_output_tokens"`
+
+	// Prompt-cache usage; CacheSavings is what cache reads would have cost
+	// more at the full input price, priced with the models' current rates.
+	TotalCacheCreationTokens int64   `json:"total_cache_creation_tokens"`
+	TotalCacheReadTokens     int64   `json:"total_cache_read_tokens"`
+	CacheSavings             float64 `json:"cache_savings"`
+
 	ByModel           []ModelStatistics    `json:"by_model"`
 	ByEndpoint        []EndpointStatistics `json:"by_endpoint"`
+	ByEndUser         []EndUserStatistics  `json:"by_end_user"` // Top end users by cost
+}
+
+// APIKeyStatistics contains the usage of a single API key.
+type APIKeyStatistics struct {
+	APIKeyID          int64             `json:"api_key_id"`
+	TotalRequests     int64             `json:"total_requests"`
+	TotalCost         float64           `json:"total_cost"`
+	Currency          string            `json:"currency"`
+	SuccessRate       float64           `json:"success_rate"`
+	TotalInputTokens  int64             `json:"total_input_tokens"`
+	TotalOutputTokens int64             `json:"total_output_tokens"`
+	ByModel           []ModelStatistics `json:"by_model"` // Most requested first
 }
 
 // ModelStatistics contains per-model statistics.
@@ -479,18 +939,38 @@ type EndpointStatistics struct {
 	SuccessRate  float64 `json:"success_rate"`
 }
 
+// EndUserStatistics contains statistics for one end user, identified by the
+// metadata.user_id clients send.
+type EndUserStatistics struct {
+	EndUserID    string  `json:"end_user_id"`
+	Requests     int64   `json:"requests"`
+	Cost         float64 `json:"cost"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+}
+
 // RoutingAggregation holds SQL-aggregated routing statistics.
 type RoutingAggregation struct {
 	TotalRequests   int64
 	MethodCounts    map[string]int64
 	RuleCounts      map[string]int64
+	ObserveCounts   map[string]int64 // Requests each observe-only rule matched
 	RuleIDs         map[string]*int64
 	InaccurateCount int64
+	TaskTypeStats   map[string]*TaskTypeStats
+}
+
+// TaskTypeStats holds outcome statistics for one inferred task type.
+type TaskTypeStats struct {
+	Count        int64
+	SuccessCount int64
+	AvgLatencyMs float64
+	TotalCost    float64
 }
 
 // GetRoutingAggregation returns routing method/rule counts via SQL aggregation.
 func (r *RequestLogRepositoryImpl) GetRoutingAggregation(ctx context.Context, startTime, endTime *time.Time) (*RoutingAggregation, error) {
-	whereSQL, params := r.buildWhere(nil, nil, nil, startTime, endTime, nil)
+	whereSQL, params := r.buildWhere(nil, nil, nil, nil, startTime, endTime, nil)
 
 	// Total count
 	var total int64
@@ -503,7 +983,9 @@ func (r *RequestLogRepositoryImpl) GetRoutingAggregation(ctx context.Context, st
 		TotalRequests: total,
 		MethodCounts:  make(map[string]int64),
 		RuleCounts:    make(map[string]int64),
+		ObserveCounts: make(map[string]int64),
 		RuleIDs:       make(map[string]*int64),
+		TaskTypeStats: make(map[string]*TaskTypeStats),
 	}
 
 	// Aggregate by routing_method
@@ -524,6 +1006,9 @@ func (r *RequestLogRepositoryImpl) GetRoutingAggregation(ctx context.Context, st
 		}
 		agg.MethodCounts[method] = cnt
 	}
+	if err := methodRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to aggregate routing methods: %w", err)
+	}
 
 	// Aggregate by matched_rule_name (non-empty only)
 	ruleQ := fmt.Sprintf(`
@@ -550,6 +1035,65 @@ func (r *RequestLogRepositoryImpl) GetRoutingAggregation(ctx context.Context, st
 			agg.RuleIDs[name] = &id
 		}
 	}
+	if err := ruleRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to aggregate routing rules: %w", err)
+	}
+
+	// Aggregate observe-only rule hits, which never become matched_rule_name
+	// and are only recorded in all_matches
+	observeQ := fmt.Sprintf(`
+		SELECT json_extract(m.value, '$.name') AS name, MIN(json_extract(m.value, '$.rule_id')) AS rule_id, COUNT(*) AS cnt
+		FROM request_logs,
+			json_each(CASE WHEN json_valid(request_logs.all_matches) THEN request_logs.all_matches ELSE '[]' END) AS m
+		WHERE %s AND json_extract(m.value, '$.observe') = 1
+		GROUP BY name
+	`, whereSQL)
+	observeRows, err := r.readDB.QueryContext(ctx, observeQ, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate observe rules: %w", err)
+	}
+	defer observeRows.Close()
+	for observeRows.Next() {
+		var name string
+		var ruleID sql.NullInt64
+		var cnt int64
+		if err := observeRows.Scan(&name, &ruleID, &cnt); err != nil {
+			return nil, fmt.Errorf("failed to scan observe rule row: %w", err)
+		}
+		agg.ObserveCounts[name] = cnt
+		if ruleID.Valid {
+			id := ruleID.Int64
+			agg.RuleIDs[name] = &id
+		}
+	}
+	if err := observeRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to aggregate observe rules: %w", err)
+	}
+
+	// Outcome breakdown by inferred task_type
+	taskQ := fmt.Sprintf(`
+		SELECT COALESCE(NULLIF(task_type,''), 'unknown') AS tt, COUNT(*) AS cnt,
+			SUM(CASE WHEN success = 1 THEN 1 ELSE 0 END) AS ok,
+			COALESCE(AVG(latency_ms), 0) AS avg_latency,
+			COALESCE(SUM(cost), 0) AS total_cost
+		FROM request_logs WHERE %s GROUP BY tt
+	`, whereSQL)
+	taskRows, err := r.readDB.QueryContext(ctx, taskQ, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate task types: %w", err)
+	}
+	defer taskRows.Close()
+	for taskRows.Next() {
+		var taskType string
+		var stats TaskTypeStats
+		if err := taskRows.Scan(&taskType, &stats.Count, &stats.SuccessCount, &stats.AvgLatencyMs, &stats.TotalCost); err != nil {
+			return nil, fmt.Errorf("failed to scan task type row: %w", err)
+		}
+		agg.TaskTypeStats[taskType] = &stats
+	}
+	if err := taskRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to aggregate task types: %w", err)
+	}
 
 	// Inaccurate count
 	inaccQ := fmt.Sprintf(`SELECT COUNT(*) FROM request_logs WHERE %s AND is_inaccurate = 1`, whereSQL)
@@ -581,7 +1125,9 @@ func (r *RequestLogRepositoryImpl) ListInaccurate(ctx context.Context, limit, of
 			'' as message_preview, '' as request_content, '' as response_content,
 			request_logs.routing_method, request_logs.routing_reason,
 			request_logs.matched_rule_id, request_logs.matched_rule_name, request_logs.all_matches,
-			request_logs.is_inaccurate
+			request_logs.is_inaccurate, request_logs.retry_chain, request_logs.fallback_chain, request_logs.thinking_clamped_from,
+			request_logs.cache_creation_input_tokens, request_logs.cache_read_input_tokens,
+			request_logs.end_user_id
 		FROM request_logs
 		LEFT JOIN users u ON request_logs.user_id = u.id
 		WHERE request_logs.is_inaccurate = 1
@@ -634,7 +1180,9 @@ func (r *RequestLogRepositoryImpl) ListForAnalysis(ctx context.Context, startTim
 			request_logs.message_preview, request_logs.request_content, '' as response_content,
 			request_logs.routing_method, request_logs.routing_reason,
 			request_logs.matched_rule_id, request_logs.matched_rule_name, request_logs.all_matches,
-			request_logs.is_inaccurate
+			request_logs.is_inaccurate, request_logs.retry_chain, request_logs.fallback_chain, request_logs.thinking_clamped_from,
+			request_logs.cache_creation_input_tokens, request_logs.cache_read_input_tokens,
+			request_logs.end_user_id
 		FROM request_logs
 		LEFT JOIN users u ON request_logs.user_id = u.id
 		WHERE %s
@@ -668,15 +1216,28 @@ type EndpointModelStats struct {
 
 // GetEndpointModelStats returns historical stats grouped by endpoint_name/model_name.
 func (r *RequestLogRepositoryImpl) GetEndpointModelStats(ctx context.Context) (map[string]*EndpointModelStats, error) {
+	return r.GetEndpointModelStatsSince(ctx, time.Time{})
+}
+
+// GetEndpointModelStatsSince returns stats grouped by endpoint_name/model_name
+// over the requests logged since the given time; a zero time means all time.
+func (r *RequestLogRepositoryImpl) GetEndpointModelStatsSince(ctx context.Context, since time.Time) (map[string]*EndpointModelStats, error) {
+	where := ""
+	var params []any
+	if !since.IsZero() {
+		where = "WHERE created_at >= ?"
+		params = append(params, since.UTC().Format("2006-01-02 15:04:05"))
+	}
 	query := `
 		SELECT endpoint_name, model_name,
 			COUNT(*) AS total_requests,
 			SUM(CASE WHEN success = 0 THEN 1 ELSE 0 END) AS total_errors,
 			COALESCE(AVG(latency_ms), 0) AS avg_latency
 		FROM request_logs
+		` + where + `
 		GROUP BY endpoint_name, model_name
 	`
-	rows, err := r.readDB.QueryContext(ctx, query)
+	rows, err := r.readDB.QueryContext(ctx, query, params...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get endpoint model stats: %w", err)
 	}
@@ -6,7 +6,10 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -27,6 +30,93 @@ func TestRequestLogRepository_Insert(t *testing.T) {
 	assert.Greater(t, id, int64(0))
 }
 
+func TestRequestLogRepository_RetryChain(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	repo := NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	entry := testutil.SampleRequestLogEntry(1)
+	entry.RetryChain = []models.RetryAttempt{
+		{Endpoint: "p1/claude", StatusCode: 403, Error: "quota exhausted", LatencyMs: 12},
+		{Endpoint: "p2/claude", StatusCode: 200, LatencyMs: 340},
+	}
+	id, err := repo.Insert(ctx, entry)
+	require.NoError(t, err)
+
+	log, err := repo.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, entry.RetryChain, log.RetryChain)
+
+	// Entries without attempts read back as no chain.
+	plain := testutil.SampleRequestLogEntry(1)
+	plain.RequestID += "-plain"
+	id, err = repo.Insert(ctx, plain)
+	require.NoError(t, err)
+	log, err = repo.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.Nil(t, log.RetryChain)
+}
+
+func TestRequestLogRepository_FallbackChain(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	repo := NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	entry := testutil.SampleRequestLogEntry(1)
+	entry.FallbackChain = []string{"complex", "default", "simple"}
+	id, err := repo.Insert(ctx, entry)
+	require.NoError(t, err)
+
+	log, err := repo.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, entry.FallbackChain, log.FallbackChain)
+
+	plain := testutil.SampleRequestLogEntry(1)
+	plain.RequestID += "-plain"
+	id, err = repo.Insert(ctx, plain)
+	require.NoError(t, err)
+	log, err = repo.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.Nil(t, log.FallbackChain)
+}
+
+func TestRequestLogRepository_EndUser(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	repo := NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	entries := []*models.RequestLogEntry{
+		{RequestID: "eu_1", UserID: 1, ModelName: "claude-sonnet-4", EndpointName: "ep1", EndUserID: "alice", InputTokens: 100, OutputTokens: 50, Cost: 0.001, Success: true},
+		{RequestID: "eu_2", UserID: 1, ModelName: "claude-sonnet-4", EndpointName: "ep1", EndUserID: "bob", InputTokens: 300, OutputTokens: 80, Cost: 0.004, Success: true},
+		{RequestID: "eu_3", UserID: 1, ModelName: "claude-sonnet-4", EndpointName: "ep1", EndUserID: "alice", InputTokens: 50, OutputTokens: 10, Cost: 0.002, Success: true},
+		{RequestID: "eu_4", UserID: 1, ModelName: "claude-sonnet-4", EndpointName: "ep1", InputTokens: 10, OutputTokens: 10, Cost: 0.01, Success: true},
+	}
+	var firstID int64
+	for i, e := range entries {
+		id, err := repo.Insert(ctx, e)
+		require.NoError(t, err)
+		if i == 0 {
+			firstID = id
+		}
+	}
+
+	log, err := repo.GetByID(ctx, firstID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", log.EndUserID)
+
+	stats, err := repo.GetStatistics(ctx, nil, nil, nil, nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, stats.ByEndUser, 2, "requests without an end user are not grouped")
+	assert.Equal(t, "bob", stats.ByEndUser[0].EndUserID)
+	assert.Equal(t, "alice", stats.ByEndUser[1].EndUserID)
+	assert.Equal(t, int64(2), stats.ByEndUser[1].Requests)
+	assert.Equal(t, int64(150), stats.ByEndUser[1].InputTokens)
+	assert.InDelta(t, 0.003, stats.ByEndUser[1].Cost, 1e-9)
+}
+
 func TestRequestLogRepository_Insert_Multiple(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	testutil.SeedTestData(t, db)
@@ -86,6 +176,84 @@ func TestRequestLogRepository_List(t *testing.T) {
 	}
 }
 
+func TestRequestLogRepository_ListAfter(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	repo := NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	insert := func(reqID string) int64 {
+		id, err := repo.Insert(ctx, &models.RequestLogEntry{
+			RequestID: reqID, UserID: 1, ModelName: "claude-3-haiku", EndpointName: "ep", Success: true,
+		})
+		require.NoError(t, err)
+		return id
+	}
+	var want []int64
+	for i := range 5 {
+		want = append([]int64{insert(fmt.Sprintf("req-%d", i))}, want...)
+	}
+
+	var got []int64
+	cursor := ""
+	for page := 0; ; page++ {
+		logs, next, err := repo.ListAfter(ctx, cursor, 2, nil, nil, nil, nil, nil, nil)
+		require.NoError(t, err)
+		for _, l := range logs {
+			got = append(got, l.ID)
+		}
+		if page == 0 {
+			// Rows arriving mid-scroll must not shift later pages.
+			insert("req-late")
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, want, got)
+
+	_, _, err := repo.ListAfter(ctx, "not-a-cursor", 2, nil, nil, nil, nil, nil, nil)
+	assert.ErrorIs(t, err, ErrInvalidLogCursor)
+}
+
+func TestRequestLogRepository_Export(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	repo := NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	var want []int64
+	for i := range 4 {
+		id, err := repo.Insert(ctx, &models.RequestLogEntry{
+			RequestID: fmt.Sprintf("req-%d", i), UserID: 1, ModelName: "claude-3-haiku", EndpointName: "ep",
+			Success: i%2 == 0,
+		})
+		require.NoError(t, err)
+		if i%2 == 0 {
+			want = append(want, id)
+		}
+	}
+
+	var got []int64
+	success := true
+	err := repo.Export(ctx, nil, nil, nil, nil, nil, &success, func(l *models.RequestLog) error {
+		got = append(got, l.ID)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, want, got, "matching logs, oldest first")
+
+	stop := errors.New("stop")
+	calls := 0
+	err = repo.Export(ctx, nil, nil, nil, nil, nil, nil, func(*models.RequestLog) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
 func TestRequestLogRepository_GetStatistics(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	testutil.SeedTestData(t, db)
@@ -105,6 +273,66 @@ func TestRequestLogRepository_GetStatistics(t *testing.T) {
 	assert.NotEmpty(t, stats.ByEndpoint)
 }
 
+func TestRequestLogRepository_GetStatistics_CostDisplay(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	repo := NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	seedRequestLogs(t, db, repo)
+
+	stats, err := repo.GetStatistics(ctx, nil, nil, nil, nil, nil, nil)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.0035, stats.TotalCost, 1e-9)
+	assert.Equal(t, "USD", stats.Currency)
+
+	repo.SetCostDisplay(CostDisplay{Precision: 2, Currency: "USD", USDRate: 1})
+	stats, err = repo.GetStatistics(ctx, nil, nil, nil, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, stats.TotalCost)
+
+	repo.SetCostDisplay(CostDisplay{Precision: 4, Currency: "CNY", USDRate: 7.2})
+	stats, err = repo.GetStatistics(ctx, nil, nil, nil, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "CNY", stats.Currency)
+	assert.InDelta(t, 0.0252, stats.TotalCost, 1e-9)
+	for _, m := range stats.ByModel {
+		if m.ModelName == "claude-sonnet-4" {
+			assert.InDelta(t, 0.0216, m.Cost, 1e-9)
+		}
+	}
+
+	// Stored costs stay in USD.
+	var stored float64
+	require.NoError(t, db.QueryRow(`SELECT SUM(cost) FROM request_logs`).Scan(&stored))
+	assert.InDelta(t, 0.0035, stored, 1e-9)
+}
+
+func TestRequestLogRepository_PromptCacheUsage(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	repo := NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	entry := testutil.SampleRequestLogEntry(1)
+	entry.CacheCreationInputTokens = 2000
+	entry.CacheReadInputTokens = 100000
+	id, err := repo.Insert(ctx, entry)
+	require.NoError(t, err)
+
+	log, err := repo.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, 2000, log.CacheCreationInputTokens)
+	assert.Equal(t, 100000, log.CacheReadInputTokens)
+
+	stats, err := repo.GetStatistics(ctx, nil, nil, nil, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2000), stats.TotalCacheCreationTokens)
+	assert.Equal(t, int64(100000), stats.TotalCacheReadTokens)
+	// 100k reads of claude-sonnet-4 at $3/Mtok, billed at 0.1x: saves $0.27.
+	assert.InDelta(t, 0.27, stats.CacheSavings, 1e-9)
+}
+
 func TestRequestLogRepository_Count(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	testutil.SeedTestData(t, db)
@@ -169,6 +397,127 @@ func TestRequestLogRepository_Delete_All(t *testing.T) {
 	assert.Equal(t, int64(0), count)
 }
 
+func TestRequestLogRepository_DeleteOlderThan(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	repo := NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	seedRequestLogs(t, db, repo)
+	_, err := db.Exec(`UPDATE request_logs SET created_at = '2020-01-01 00:00:00' WHERE request_id IN ('req_1', 'req_2')`)
+	require.NoError(t, err)
+	cutoff := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// The limit bounds each batch.
+	deleted, err := repo.DeleteOlderThan(ctx, cutoff, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	deleted, err = repo.DeleteOlderThan(ctx, cutoff, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	deleted, err = repo.DeleteOlderThan(ctx, cutoff, 10)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	count, err := repo.Count(ctx, nil, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	require.NoError(t, repo.Vacuum(ctx))
+}
+
+func TestRequestLogRepository_RateLimited(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	repo := NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	hour := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, at := range []time.Time{hour.Add(5 * time.Minute), hour.Add(50 * time.Minute), hour.Add(2 * time.Hour)} {
+		require.NoError(t, repo.RecordRateLimited(ctx, 1, at))
+	}
+	require.NoError(t, repo.RecordRateLimited(ctx, 2, hour))
+
+	userID := int64(1)
+	count, err := repo.CountRateLimited(ctx, &userID, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	// The window is rounded down to the hour.
+	start := hour.Add(30 * time.Minute)
+	count, err = repo.CountRateLimited(ctx, &userID, &start, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+	start = hour.Add(90 * time.Minute)
+	count, err = repo.CountRateLimited(ctx, &userID, &start, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	// Rejections add no log rows.
+	logs, err := repo.Count(ctx, nil, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Zero(t, logs)
+}
+
+func TestRequestLogRepository_GetEndpointModelStatsSince(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	repo := NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	seedRequestLogs(t, db, repo)
+	_, err := db.Exec(`UPDATE request_logs SET created_at = '2020-01-01 00:00:00' WHERE request_id = 'req_1'`)
+	require.NoError(t, err)
+
+	all, err := repo.GetEndpointModelStats(ctx)
+	require.NoError(t, err)
+	require.Contains(t, all, "ep1/claude-sonnet-4")
+	assert.Equal(t, int64(1), all["ep1/claude-sonnet-4"].TotalRequests)
+
+	recent, err := repo.GetEndpointModelStatsSince(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.NotContains(t, recent, "ep1/claude-sonnet-4", "logs before the window are left out")
+	require.Contains(t, recent, "ep2/claude-sonnet-4")
+	assert.Equal(t, int64(1), recent["ep2/claude-sonnet-4"].TotalErrors)
+	assert.Len(t, recent, 2)
+}
+
+func TestRequestLogRepository_GetAPIKeyStatistics(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	repo := NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	entries := []*models.RequestLogEntry{
+		{RequestID: "k_1", UserID: 1, APIKeyID: ptrInt64(7), ModelName: "claude-sonnet-4", EndpointName: "ep1", InputTokens: 100, OutputTokens: 50, LatencyMs: 100, Cost: 0.001, Success: true},
+		{RequestID: "k_2", UserID: 1, APIKeyID: ptrInt64(7), ModelName: "claude-sonnet-4", EndpointName: "ep1", InputTokens: 200, OutputTokens: 10, LatencyMs: 300, Cost: 0.002, Success: false},
+		{RequestID: "k_3", UserID: 1, APIKeyID: ptrInt64(7), ModelName: "claude-3-haiku", EndpointName: "ep1", InputTokens: 10, OutputTokens: 5, LatencyMs: 50, Cost: 0.0001, Success: true},
+		{RequestID: "k_4", UserID: 1, APIKeyID: ptrInt64(8), ModelName: "claude-3-haiku", EndpointName: "ep1", InputTokens: 999, OutputTokens: 999, LatencyMs: 50, Cost: 1, Success: true},
+		{RequestID: "k_5", UserID: 1, ModelName: "claude-3-haiku", EndpointName: "ep1", InputTokens: 999, OutputTokens: 999, LatencyMs: 50, Cost: 1, Success: true},
+	}
+	for _, e := range entries {
+		_, err := repo.Insert(ctx, e)
+		require.NoError(t, err)
+	}
+
+	stats, err := repo.GetAPIKeyStatistics(ctx, 7, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), stats.APIKeyID)
+	assert.Equal(t, int64(3), stats.TotalRequests)
+	assert.InDelta(t, 0.0031, stats.TotalCost, 1e-9)
+	assert.InDelta(t, 66.67, stats.SuccessRate, 0.001)
+	assert.Equal(t, int64(310), stats.TotalInputTokens)
+	assert.Equal(t, int64(65), stats.TotalOutputTokens)
+	require.Len(t, stats.ByModel, 2)
+	assert.Equal(t, "claude-sonnet-4", stats.ByModel[0].ModelName)
+	assert.Equal(t, int64(2), stats.ByModel[0].Requests)
+	assert.Equal(t, float64(200), stats.ByModel[0].AvgLatency)
+
+	future := time.Now().Add(time.Hour)
+	stats, err = repo.GetAPIKeyStatistics(ctx, 7, &future, nil)
+	require.NoError(t, err)
+	assert.Zero(t, stats.TotalRequests)
+	assert.Empty(t, stats.ByModel)
+}
+
 func seedRequestLogs(t *testing.T, db *sql.DB, repo *RequestLogRepositoryImpl) {
 	t.Helper()
 	ctx := context.Background()
@@ -188,3 +537,112 @@ func seedRequestLogs(t *testing.T, db *sql.DB, repo *RequestLogRepositoryImpl) {
 // Helper functions
 func ptrInt64(v int64) *int64 { return &v }
 func ptrStr(v string) *string { return &v }
+
+func TestRequestLogRepository_GetRoutingAggregation_ByTaskType(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	repo := NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	entries := []*models.RequestLogEntry{
+		{RequestID: "tt_1", UserID: 1, ModelName: "claude-3-haiku", EndpointName: "ep1", TaskType: "simple", LatencyMs: 100, Cost: 0.001, Success: true},
+		{RequestID: "tt_2", UserID: 1, ModelName: "claude-3-haiku", EndpointName: "ep1", TaskType: "simple", LatencyMs: 300, Cost: 0.003, Success: false},
+		{RequestID: "tt_3", UserID: 1, ModelName: "claude-opus-4", EndpointName: "ep1", TaskType: "complex", LatencyMs: 2000, Cost: 0.05, Success: true},
+		{RequestID: "tt_4", UserID: 2, ModelName: "claude-sonnet-4", EndpointName: "ep2", TaskType: "", LatencyMs: 500, Cost: 0.01, Success: true},
+	}
+	for _, e := range entries {
+		_, err := repo.Insert(ctx, e)
+		require.NoError(t, err)
+	}
+
+	agg, err := repo.GetRoutingAggregation(ctx, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), agg.TotalRequests)
+	require.Len(t, agg.TaskTypeStats, 3)
+
+	simple := agg.TaskTypeStats["simple"]
+	require.NotNil(t, simple)
+	assert.Equal(t, int64(2), simple.Count)
+	assert.Equal(t, int64(1), simple.SuccessCount)
+	assert.InDelta(t, 200.0, simple.AvgLatencyMs, 0.001)
+	assert.InDelta(t, 0.004, simple.TotalCost, 1e-9)
+
+	complexStats := agg.TaskTypeStats["complex"]
+	require.NotNil(t, complexStats)
+	assert.Equal(t, int64(1), complexStats.Count)
+	assert.Equal(t, int64(1), complexStats.SuccessCount)
+	assert.InDelta(t, 2000.0, complexStats.AvgLatencyMs, 0.001)
+
+	unknown := agg.TaskTypeStats["unknown"]
+	require.NotNil(t, unknown)
+	assert.Equal(t, int64(1), unknown.Count)
+}
+
+func TestRequestLogRepository_GetRoutingAggregation_ObserveRules(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	repo := NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	candidate := &models.RuleHit{RuleID: 7, Name: "candidate", TaskType: "complex", Observe: true}
+	deploy := &models.RuleHit{RuleID: 8, Name: "deploy", TaskType: "simple"}
+	entries := []*models.RequestLogEntry{
+		{RequestID: "obs_1", UserID: 1, ModelName: "m", EndpointName: "ep1", MatchedRuleName: "deploy", AllMatches: []*models.RuleHit{candidate, deploy}},
+		{RequestID: "obs_2", UserID: 1, ModelName: "m", EndpointName: "ep1", AllMatches: []*models.RuleHit{candidate}},
+		{RequestID: "obs_3", UserID: 1, ModelName: "m", EndpointName: "ep1", MatchedRuleName: "deploy", AllMatches: []*models.RuleHit{deploy}},
+		{RequestID: "obs_4", UserID: 1, ModelName: "m", EndpointName: "ep1"},
+	}
+	for _, e := range entries {
+		_, err := repo.Insert(ctx, e)
+		require.NoError(t, err)
+	}
+
+	agg, err := repo.GetRoutingAggregation(ctx, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"candidate": 2}, agg.ObserveCounts)
+	require.NotNil(t, agg.RuleIDs["candidate"])
+	assert.Equal(t, int64(7), *agg.RuleIDs["candidate"])
+	assert.Equal(t, map[string]int64{"deploy": 2}, agg.RuleCounts, "observe hits do not count as matched rules")
+}
+
+func TestRequestLogRepository_Feed(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	repo := NewRequestLogRepositoryImpl(db, testutil.NewTestLogger())
+	ctx := context.Background()
+
+	// Without a feed inserts publish nothing.
+	_, err := repo.Insert(ctx, &models.RequestLogEntry{RequestID: "req_unfed", ModelName: "m"})
+	require.NoError(t, err)
+
+	feed := NewRequestLogFeed()
+	repo.SetFeed(feed)
+	sub := feed.Subscribe()
+	id, err := repo.Insert(ctx, &models.RequestLogEntry{
+		RequestID:      "req_fed",
+		ModelName:      "m",
+		Success:        true,
+		RequestContent: "secret prompt",
+	})
+	require.NoError(t, err)
+	log := <-sub.C
+	assert.Equal(t, id, log.ID)
+	assert.Equal(t, "req_fed", log.RequestID)
+	assert.True(t, log.Success)
+	assert.Empty(t, log.RequestContent, "content is left out like in List")
+	stored, err := repo.GetByID(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, stored.CreatedAt.Equal(log.CreatedAt))
+
+	// A subscriber that falls behind misses logs instead of blocking inserts.
+	for range requestLogFeedBuffer + 3 {
+		feed.Publish(&models.RequestLog{})
+	}
+	assert.Len(t, sub.C, requestLogFeedBuffer)
+	assert.Equal(t, int64(3), sub.Dropped())
+	assert.Zero(t, sub.Dropped())
+
+	feed.Unsubscribe(sub)
+	assert.Zero(t, feed.Subscribers())
+	feed.Publish(&models.RequestLog{})
+	assert.Len(t, sub.C, requestLogFeedBuffer)
+}
@@ -3,7 +3,11 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/user/llm-proxy-go/internal/models"
 	"go.uber.org/zap"
@@ -13,6 +17,11 @@ import (
 type RoutingConfigRepository struct {
 	db     *sql.DB
 	logger *zap.Logger
+
+	cacheTTL time.Duration // How long GetConfig reuses the last read config; 0 = no cache
+	mu       sync.Mutex
+	cached   *models.RoutingConfig
+	cachedAt time.Time
 }
 
 // NewRoutingConfigRepository creates a new RoutingConfigRepository.
@@ -30,12 +39,66 @@ var routingConfigBoolFields = map[string]bool{
 	"log_full_content":            true,
 }
 
+// SetCacheTTL sets how long GetConfig reuses the config it last read
+// (0 disables the cache). With a cache, a read that fails returns the last
+// config instead, so database contention does not fail requests. Updates
+// made on another worker take up to the TTL to apply.
+func (r *RoutingConfigRepository) SetCacheTTL(ttl time.Duration) {
+	r.cacheTTL = ttl
+}
+
+// InvalidateCache makes the next GetConfig read the database, e.g. after
+// the config was written other than through UpdateConfig.
+func (r *RoutingConfigRepository) InvalidateCache() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cached = nil
+}
+
 // GetConfig retrieves the LLM routing configuration.
 // Returns default config if no row exists.
 func (r *RoutingConfigRepository) GetConfig(ctx context.Context) (*models.RoutingConfig, error) {
+	if r.cacheTTL <= 0 {
+		return r.loadConfig(ctx)
+	}
+
+	r.mu.Lock()
+	cached, cachedAt := r.cached, r.cachedAt
+	r.mu.Unlock()
+	if cached != nil && time.Since(cachedAt) < r.cacheTTL {
+		return cloneRoutingConfig(cached), nil
+	}
+
+	cfg, err := r.loadConfig(ctx)
+	if err != nil {
+		if cached != nil {
+			r.logger.Warn("failed to read routing config, using cached config", zap.Error(err))
+			return cloneRoutingConfig(cached), nil
+		}
+		return nil, err
+	}
+	r.mu.Lock()
+	r.cached, r.cachedAt = cloneRoutingConfig(cfg), time.Now()
+	r.mu.Unlock()
+	return cfg, nil
+}
+
+// cloneRoutingConfig copies cfg so callers cannot change the cached config.
+func cloneRoutingConfig(cfg *models.RoutingConfig) *models.RoutingConfig {
+	clone := *cfg
+	clone.RoutingTriggerModels = slices.Clone(cfg.RoutingTriggerModels)
+	clone.RoleFallbackChain = slices.Clone(cfg.RoleFallbackChain)
+	return &clone
+}
+
+// loadConfig reads the routing configuration from the database.
+func (r *RoutingConfigRepository) loadConfig(ctx context.Context) (*models.RoutingConfig, error) {
 	var cfg models.RoutingConfig
 	var primaryModelID, fallbackModelID, embeddingModelID sql.NullInt64
-	var cacheTTLL3 sql.NullInt64
+	var cacheTTLL3, cacheMaxSize sql.NullInt64
 	var semanticEnabled sql.NullInt64
 	var similarityThreshold sql.NullFloat64
 	var localEmbeddingModel sql.NullString
@@ -51,13 +114,18 @@ func (r *RoutingConfigRepository) GetConfig(ctx context.Context) (*models.Routin
 	// Logging fields
 	var logFullContent sql.NullInt64
 
+	var maxOutputTokens sql.NullInt64
+	var routingTriggerModels sql.NullString
+	var roleFallbackChain sql.NullString
+
 	err := r.db.QueryRowContext(ctx, `
 		SELECT enabled, primary_model_id, fallback_model_id, timeout_seconds,
 			cache_enabled, cache_ttl_seconds, cache_ttl_l3_seconds, max_tokens,
 			temperature, retry_count, semantic_cache_enabled, embedding_model_id,
 			similarity_threshold, local_embedding_model, force_smart_routing,
 			rule_based_routing_enabled, rule_fallback_strategy, rule_fallback_task_type,
-			rule_fallback_model_id, log_full_content
+			rule_fallback_model_id, log_full_content, cache_max_size, max_output_tokens,
+			routing_trigger_models, role_fallback_chain
 		FROM routing_llm_config
 		WHERE id = 1
 	`).Scan(
@@ -66,7 +134,8 @@ func (r *RoutingConfigRepository) GetConfig(ctx context.Context) (*models.Routin
 		&cfg.Temperature, &cfg.RetryCount, &semanticEnabled, &embeddingModelID,
 		&similarityThreshold, &localEmbeddingModel, &forceSmartRouting,
 		&ruleBasedEnabled, &ruleFallbackStrategy, &ruleFallbackTaskType,
-		&ruleFallbackModelID, &logFullContent,
+		&ruleFallbackModelID, &logFullContent, &cacheMaxSize, &maxOutputTokens,
+		&routingTriggerModels, &roleFallbackChain,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -97,6 +166,11 @@ func (r *RoutingConfigRepository) GetConfig(ctx context.Context) (*models.Routin
 	} else {
 		cfg.CacheTTLL3Seconds = defaults.CacheTTLL3Seconds
 	}
+	if cacheMaxSize.Valid && cacheMaxSize.Int64 > 0 {
+		cfg.CacheMaxSize = int(cacheMaxSize.Int64)
+	} else {
+		cfg.CacheMaxSize = defaults.CacheMaxSize
+	}
 	if semanticEnabled.Valid {
 		cfg.SemanticCacheEnabled = semanticEnabled.Int64 == 1
 	} else {
@@ -144,6 +218,22 @@ func (r *RoutingConfigRepository) GetConfig(ctx context.Context) (*models.Routin
 	} else {
 		cfg.LogFullContent = defaults.LogFullContent
 	}
+	if maxOutputTokens.Valid && maxOutputTokens.Int64 > 0 {
+		cfg.MaxOutputTokens = int(maxOutputTokens.Int64)
+	}
+	cfg.RoutingTriggerModels = defaults.RoutingTriggerModels
+	if routingTriggerModels.Valid && routingTriggerModels.String != "" {
+		if err := json.Unmarshal([]byte(routingTriggerModels.String), &cfg.RoutingTriggerModels); err != nil {
+			r.logger.Warn("invalid routing_trigger_models, using default", zap.Error(err))
+			cfg.RoutingTriggerModels = defaults.RoutingTriggerModels
+		}
+	}
+	if roleFallbackChain.Valid && roleFallbackChain.String != "" {
+		if err := json.Unmarshal([]byte(roleFallbackChain.String), &cfg.RoleFallbackChain); err != nil {
+			r.logger.Warn("invalid role_fallback_chain, using built-in fallback order", zap.Error(err))
+			cfg.RoleFallbackChain = nil
+		}
+	}
 
 	return &cfg, nil
 }
@@ -181,6 +271,7 @@ func (r *RoutingConfigRepository) UpdateConfig(ctx context.Context, updates map[
 	if err != nil {
 		return fmt.Errorf("failed to update routing config: %w", err)
 	}
+	r.InvalidateCache()
 
 	rows, _ := result.RowsAffected()
 	r.logger.Debug("routing config updated", zap.Int64("rows_affected", rows))
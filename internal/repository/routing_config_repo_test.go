@@ -6,6 +6,7 @@ package repository
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -47,6 +48,43 @@ func TestRoutingConfigRepository_GetConfig_NoRow(t *testing.T) {
 	assert.True(t, config.CacheEnabled)
 }
 
+func TestRoutingConfigRepository_Cache(t *testing.T) {
+	db := testutil.NewTestDBWithDefaults(t)
+	repo := NewRoutingConfigRepository(db, zap.NewNop())
+	repo.SetCacheTTL(time.Hour)
+	ctx := context.Background()
+
+	cfg, err := repo.GetConfig(ctx)
+	require.NoError(t, err)
+	assert.False(t, cfg.ForceSmartRouting)
+	cfg.RoutingTriggerModels[0] = "changed"
+
+	// Writes made behind the repository's back are not seen until invalidated.
+	_, err = db.Exec(`UPDATE routing_llm_config SET force_smart_routing = 1 WHERE id = 1`)
+	require.NoError(t, err)
+	cfg, err = repo.GetConfig(ctx)
+	require.NoError(t, err)
+	assert.False(t, cfg.ForceSmartRouting)
+	assert.Equal(t, []string{"auto"}, cfg.RoutingTriggerModels, "callers cannot change the cached config")
+	repo.InvalidateCache()
+	cfg, err = repo.GetConfig(ctx)
+	require.NoError(t, err)
+	assert.True(t, cfg.ForceSmartRouting)
+
+	// UpdateConfig invalidates it.
+	require.NoError(t, repo.UpdateConfig(ctx, map[string]any{"force_smart_routing": false}))
+	cfg, err = repo.GetConfig(ctx)
+	require.NoError(t, err)
+	assert.False(t, cfg.ForceSmartRouting)
+
+	// An expired config is still returned when the database fails.
+	repo.SetCacheTTL(time.Nanosecond)
+	require.NoError(t, db.Close())
+	cfg, err = repo.GetConfig(ctx)
+	require.NoError(t, err)
+	assert.False(t, cfg.ForceSmartRouting)
+}
+
 func TestRoutingConfigRepository_UpdateConfig(t *testing.T) {
 	db := testutil.NewTestDBWithDefaults(t)
 	repo := NewRoutingConfigRepository(db, zap.NewNop())
@@ -132,6 +170,15 @@ func TestRoutingConfigRepository_UpdateConfig(t *testing.T) {
 				assert.True(t, cfg.ForceSmartRouting)
 			},
 		},
+		{
+			name: "set role fallback chain",
+			updates: map[string]any{
+				"role_fallback_chain": `["complex","default","simple"]`,
+			},
+			verify: func(t *testing.T, cfg *models.RoutingConfig) {
+				assert.Equal(t, []string{"complex", "default", "simple"}, cfg.RoleFallbackChain)
+			},
+		},
 		{
 			name:    "empty updates",
 			updates: map[string]any{},
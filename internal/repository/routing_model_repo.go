@@ -87,7 +87,7 @@ func (r *RoutingModelRepository) GetModelWithProvider(ctx context.Context, id in
 		SELECT rm.id, rm.provider_id, rm.model_name, rm.enabled, rm.priority,
 			rm.cost_per_mtok_input, rm.cost_per_mtok_output, rm.billing_multiplier,
 			rm.description, rm.created_at, rm.updated_at,
-			p.base_url, p.api_key
+			p.base_url, p.api_key, p.api_path_prefix
 		FROM routing_models rm
 		JOIN providers p ON rm.provider_id = p.id
 		WHERE rm.id = ? AND rm.enabled = 1 AND p.enabled = 1
@@ -95,7 +95,7 @@ func (r *RoutingModelRepository) GetModelWithProvider(ctx context.Context, id in
 		&m.ID, &m.ProviderID, &m.ModelName, &enabled, &m.Priority,
 		&m.CostPerMtokInput, &m.CostPerMtokOutput, &m.BillingMultiplier,
 		&description, &createdAt, &updatedAt,
-		&m.BaseURL, &m.APIKey,
+		&m.BaseURL, &m.APIKey, &m.APIPathPrefix,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -126,7 +126,7 @@ func (r *RoutingModelRepository) GetModelWithProviderAny(ctx context.Context, id
 		SELECT rm.id, rm.provider_id, rm.model_name, rm.enabled, rm.priority,
 			rm.cost_per_mtok_input, rm.cost_per_mtok_output, rm.billing_multiplier,
 			rm.description, rm.created_at, rm.updated_at,
-			p.base_url, p.api_key
+			p.base_url, p.api_key, p.api_path_prefix
 		FROM routing_models rm
 		JOIN providers p ON rm.provider_id = p.id
 		WHERE rm.id = ?
@@ -134,7 +134,7 @@ func (r *RoutingModelRepository) GetModelWithProviderAny(ctx context.Context, id
 		&m.ID, &m.ProviderID, &m.ModelName, &enabled, &m.Priority,
 		&m.CostPerMtokInput, &m.CostPerMtokOutput, &m.BillingMultiplier,
 		&description, &createdAt, &updatedAt,
-		&m.BaseURL, &m.APIKey,
+		&m.BaseURL, &m.APIKey, &m.APIPathPrefix,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
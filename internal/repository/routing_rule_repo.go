@@ -31,11 +31,11 @@ func (r *RoutingRuleRepo) ListRules(ctx context.Context, enabledOnly bool) ([]*m
 
 	if enabledOnly {
 		query = `SELECT id, name, description, keywords, pattern, condition, task_type,
-			priority, is_builtin, enabled, hit_count, created_at, updated_at
+			priority, is_builtin, enabled, rollout_percent, observe, hit_count, created_at, updated_at, last_hit_at
 			FROM routing_rules WHERE enabled = 1 ORDER BY priority DESC, id`
 	} else {
 		query = `SELECT id, name, description, keywords, pattern, condition, task_type,
-			priority, is_builtin, enabled, hit_count, created_at, updated_at
+			priority, is_builtin, enabled, rollout_percent, observe, hit_count, created_at, updated_at, last_hit_at
 			FROM routing_rules ORDER BY priority DESC, id`
 	}
 
@@ -60,7 +60,7 @@ func (r *RoutingRuleRepo) ListRules(ctx context.Context, enabledOnly bool) ([]*m
 func (r *RoutingRuleRepo) GetRule(ctx context.Context, id int64) (*models.RoutingRule, error) {
 	row := r.db.QueryRowContext(ctx, `
 		SELECT id, name, description, keywords, pattern, condition, task_type,
-			priority, is_builtin, enabled, hit_count, created_at, updated_at
+			priority, is_builtin, enabled, rollout_percent, observe, hit_count, created_at, updated_at, last_hit_at
 		FROM routing_rules WHERE id = ?
 	`, id)
 
@@ -76,6 +76,64 @@ func (r *RoutingRuleRepo) GetRule(ctx context.Context, id int64) (*models.Routin
 
 // AddRule inserts a new routing rule.
 func (r *RoutingRuleRepo) AddRule(ctx context.Context, rule *models.RoutingRule) (int64, error) {
+	return addRule(ctx, r.db, rule)
+}
+
+// ImportCustomRules inserts rules as custom rules in one transaction. In
+// replace mode all existing custom rules are deleted first; otherwise rules
+// whose name is already taken are skipped. Builtin rules are never modified.
+func (r *RoutingRuleRepo) ImportCustomRules(ctx context.Context, rules []*models.RoutingRule, replace bool) (inserted, skipped int, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM routing_rules WHERE is_builtin = 0`); err != nil {
+			return 0, 0, fmt.Errorf("failed to delete custom rules: %w", err)
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT name FROM routing_rules`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list rule names: %w", err)
+	}
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("failed to scan rule name: %w", err)
+		}
+		taken[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to list rule names: %w", err)
+	}
+
+	for _, rule := range rules {
+		if taken[rule.Name] {
+			skipped++
+			continue
+		}
+		custom := *rule
+		custom.IsBuiltin = false
+		if _, err := addRule(ctx, tx, &custom); err != nil {
+			return 0, 0, err
+		}
+		taken[rule.Name] = true
+		inserted++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit rule import: %w", err)
+	}
+	return inserted, skipped, nil
+}
+
+func addRule(ctx context.Context, db execer, rule *models.RoutingRule) (int64, error) {
 	now := time.Now().UTC().Format("2006-01-02 15:04:05")
 
 	keywordsJSON, err := json.Marshal(rule.Keywords)
@@ -83,18 +141,28 @@ func (r *RoutingRuleRepo) AddRule(ctx context.Context, rule *models.RoutingRule)
 		return 0, fmt.Errorf("failed to marshal keywords: %w", err)
 	}
 
-	result, err := r.db.ExecContext(ctx, `
+	result, err := db.ExecContext(ctx, `
 		INSERT INTO routing_rules (name, description, keywords, pattern, condition,
-			task_type, priority, is_builtin, enabled, hit_count, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 0, ?, ?)
+			task_type, priority, is_builtin, enabled, rollout_percent, observe, hit_count, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, ?, ?)
 	`, rule.Name, rule.Description, string(keywordsJSON), rule.Pattern, rule.Condition,
-		rule.TaskType, rule.Priority, boolToInt(rule.IsBuiltin), boolToInt(rule.Enabled), now, now)
+		rule.TaskType, rule.Priority, boolToInt(rule.IsBuiltin), boolToInt(rule.Enabled), rolloutPercent(rule), boolToInt(rule.Observe), now, now)
 	if err != nil {
 		return 0, fmt.Errorf("failed to add routing rule: %w", err)
 	}
 	return result.LastInsertId()
 }
 
+// rolloutPercent returns the rollout stored for rule, mapping the zero value
+// of a rule built in code to a full rollout. Rules from the API are validated
+// to 1-100 first.
+func rolloutPercent(rule *models.RoutingRule) int {
+	if rule.RolloutPercent == 0 {
+		return 100
+	}
+	return rule.RolloutPercent
+}
+
 // UpdateRule dynamically updates a routing rule.
 func (r *RoutingRuleRepo) UpdateRule(ctx context.Context, id int64, updates map[string]any) error {
 	if len(updates) == 0 {
@@ -106,7 +174,7 @@ func (r *RoutingRuleRepo) UpdateRule(ctx context.Context, id int64, updates map[
 
 	for field, value := range updates {
 		switch field {
-		case "enabled", "is_builtin":
+		case "enabled", "is_builtin", "observe":
 			if b, ok := value.(bool); ok {
 				value = boolToInt(b)
 			}
@@ -146,9 +214,11 @@ func (r *RoutingRuleRepo) DeleteRule(ctx context.Context, id int64) error {
 	return nil
 }
 
-// IncrementHitCount atomically increments the hit count for a rule.
+// IncrementHitCount atomically increments the hit count for a rule and
+// records the hit time.
 func (r *RoutingRuleRepo) IncrementHitCount(ctx context.Context, id int64) error {
-	_, err := r.db.ExecContext(ctx, `UPDATE routing_rules SET hit_count = hit_count + 1 WHERE id = ?`, id)
+	_, err := r.db.ExecContext(ctx, `UPDATE routing_rules SET hit_count = hit_count + 1, last_hit_at = ? WHERE id = ?`,
+		time.Now().UTC().Format("2006-01-02 15:04:05"), id)
 	if err != nil {
 		return fmt.Errorf("failed to increment hit count: %w", err)
 	}
@@ -203,7 +273,7 @@ func (r *RoutingRuleRepo) GetStats(ctx context.Context) (*models.RuleStats, erro
 func (r *RoutingRuleRepo) ListBuiltinRules(ctx context.Context) ([]*models.RoutingRule, error) {
 	rows, err := r.db.QueryContext(ctx, `
 		SELECT id, name, description, keywords, pattern, condition, task_type,
-			priority, is_builtin, enabled, hit_count, created_at, updated_at
+			priority, is_builtin, enabled, rollout_percent, observe, hit_count, created_at, updated_at, last_hit_at
 		FROM routing_rules WHERE is_builtin = 1 ORDER BY priority DESC, id
 	`)
 	if err != nil {
@@ -226,7 +296,7 @@ func (r *RoutingRuleRepo) ListBuiltinRules(ctx context.Context) ([]*models.Routi
 func (r *RoutingRuleRepo) ListCustomRules(ctx context.Context) ([]*models.RoutingRule, error) {
 	rows, err := r.db.QueryContext(ctx, `
 		SELECT id, name, description, keywords, pattern, condition, task_type,
-			priority, is_builtin, enabled, hit_count, created_at, updated_at
+			priority, is_builtin, enabled, rollout_percent, observe, hit_count, created_at, updated_at, last_hit_at
 		FROM routing_rules WHERE is_builtin = 0 ORDER BY priority DESC, id
 	`)
 	if err != nil {
@@ -245,18 +315,46 @@ func (r *RoutingRuleRepo) ListCustomRules(ctx context.Context) ([]*models.Routin
 	return result, rows.Err()
 }
 
+// ListIdleCustomRules retrieves enabled custom rules that have neither matched
+// a request nor been edited since cutoff. Builtin rules are never returned.
+func (r *RoutingRuleRepo) ListIdleCustomRules(ctx context.Context, cutoff time.Time) ([]*models.RoutingRule, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, name, description, keywords, pattern, condition, task_type,
+			priority, is_builtin, enabled, rollout_percent, observe, hit_count, created_at, updated_at, last_hit_at
+		FROM routing_rules
+		WHERE is_builtin = 0 AND enabled = 1
+			AND MAX(updated_at, COALESCE(last_hit_at, updated_at)) < ?
+		ORDER BY id
+	`, cutoff.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list idle rules: %w", err)
+	}
+	defer rows.Close()
+
+	var result []*models.RoutingRule
+	for rows.Next() {
+		rule, err := r.scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, rule)
+	}
+	return result, rows.Err()
+}
+
 // scanRule scans a routing rule from sql.Rows.
 func (r *RoutingRuleRepo) scanRule(rows *sql.Rows) (*models.RoutingRule, error) {
 	var rule models.RoutingRule
 	var keywordsJSON string
-	var isBuiltin, enabled int
+	var isBuiltin, enabled, observe int
 	var createdAt, updatedAt string
+	var lastHitAt sql.NullString
 
 	err := rows.Scan(
 		&rule.ID, &rule.Name, &rule.Description, &keywordsJSON,
 		&rule.Pattern, &rule.Condition, &rule.TaskType,
-		&rule.Priority, &isBuiltin, &enabled, &rule.HitCount,
-		&createdAt, &updatedAt,
+		&rule.Priority, &isBuiltin, &enabled, &rule.RolloutPercent, &observe, &rule.HitCount,
+		&createdAt, &updatedAt, &lastHitAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan routing rule: %w", err)
@@ -264,8 +362,14 @@ func (r *RoutingRuleRepo) scanRule(rows *sql.Rows) (*models.RoutingRule, error)
 
 	rule.IsBuiltin = isBuiltin == 1
 	rule.Enabled = enabled == 1
+	rule.Observe = observe == 1
 	rule.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
 	rule.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+	if lastHitAt.Valid {
+		if t, err := time.Parse("2006-01-02 15:04:05", lastHitAt.String); err == nil {
+			rule.LastHitAt = &t
+		}
+	}
 
 	if err := json.Unmarshal([]byte(keywordsJSON), &rule.Keywords); err != nil {
 		rule.Keywords = []string{}
@@ -278,14 +382,15 @@ func (r *RoutingRuleRepo) scanRule(rows *sql.Rows) (*models.RoutingRule, error)
 func (r *RoutingRuleRepo) scanRuleRow(row *sql.Row) (*models.RoutingRule, error) {
 	var rule models.RoutingRule
 	var keywordsJSON string
-	var isBuiltin, enabled int
+	var isBuiltin, enabled, observe int
 	var createdAt, updatedAt string
+	var lastHitAt sql.NullString
 
 	err := row.Scan(
 		&rule.ID, &rule.Name, &rule.Description, &keywordsJSON,
 		&rule.Pattern, &rule.Condition, &rule.TaskType,
-		&rule.Priority, &isBuiltin, &enabled, &rule.HitCount,
-		&createdAt, &updatedAt,
+		&rule.Priority, &isBuiltin, &enabled, &rule.RolloutPercent, &observe, &rule.HitCount,
+		&createdAt, &updatedAt, &lastHitAt,
 	)
 	if err != nil {
 		return nil, err
@@ -293,8 +398,14 @@ func (r *RoutingRuleRepo) scanRuleRow(row *sql.Row) (*models.RoutingRule, error)
 
 	rule.IsBuiltin = isBuiltin == 1
 	rule.Enabled = enabled == 1
+	rule.Observe = observe == 1
 	rule.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
 	rule.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+	if lastHitAt.Valid {
+		if t, err := time.Parse("2006-01-02 15:04:05", lastHitAt.String); err == nil {
+			rule.LastHitAt = &t
+		}
+	}
 
 	if err := json.Unmarshal([]byte(keywordsJSON), &rule.Keywords); err != nil {
 		rule.Keywords = []string{}
@@ -174,6 +174,48 @@ func TestRoutingRuleRepository_AddRule(t *testing.T) {
 	}
 }
 
+func TestRoutingRuleRepository_Observe(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	repo := NewRoutingRuleRepository(db, zap.NewNop())
+	ctx := context.Background()
+
+	id, err := repo.AddRule(ctx, &models.RoutingRule{Name: "candidate", TaskType: "complex", Enabled: true, Observe: true})
+	require.NoError(t, err)
+	rule, err := repo.GetRule(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, rule.Observe)
+
+	require.NoError(t, repo.UpdateRule(ctx, id, map[string]any{"observe": false}))
+	rules, err := repo.ListRules(ctx, true)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.False(t, rules[0].Observe)
+}
+
+func TestRoutingRuleRepository_RolloutPercent(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	repo := NewRoutingRuleRepository(db, zap.NewNop())
+	ctx := context.Background()
+
+	fullID, err := repo.AddRule(ctx, &models.RoutingRule{Name: "full", TaskType: "simple", Enabled: true})
+	require.NoError(t, err)
+	canaryID, err := repo.AddRule(ctx, &models.RoutingRule{Name: "canary", TaskType: "simple", Enabled: true, RolloutPercent: 25})
+	require.NoError(t, err)
+
+	full, err := repo.GetRule(ctx, fullID)
+	require.NoError(t, err)
+	assert.Equal(t, 100, full.RolloutPercent, "an unset rollout is stored as a full rollout")
+
+	canary, err := repo.GetRule(ctx, canaryID)
+	require.NoError(t, err)
+	assert.Equal(t, 25, canary.RolloutPercent)
+
+	require.NoError(t, repo.UpdateRule(ctx, canaryID, map[string]any{"rollout_percent": 60}))
+	canary, err = repo.GetRule(ctx, canaryID)
+	require.NoError(t, err)
+	assert.Equal(t, 60, canary.RolloutPercent)
+}
+
 func TestRoutingRuleRepository_UpdateRule(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	repo := NewRoutingRuleRepository(db, zap.NewNop())
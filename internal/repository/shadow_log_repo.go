@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// ShadowLogRepository provides access to the results of requests mirrored to
+// shadow providers.
+type ShadowLogRepository struct {
+	db *sql.DB
+}
+
+// NewShadowLogRepository creates a new ShadowLogRepository.
+func NewShadowLogRepository(db *sql.DB) *ShadowLogRepository {
+	return &ShadowLogRepository{db: db}
+}
+
+// Insert stores a shadow log entry and returns its ID.
+func (r *ShadowLogRepository) Insert(ctx context.Context, l *models.ShadowLog) (int64, error) {
+	routingMethod := l.RoutingMethod
+	if routingMethod == "" {
+		routingMethod = "shadow"
+	}
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO shadow_logs (request_id, model_name, primary_endpoint, shadow_endpoint, routing_method,
+		        status_code, success, error_message, latency_ms, primary_latency_ms, input_tokens, output_tokens,
+		        cost, primary_cost, diff_summary, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		l.RequestID, l.ModelName, l.PrimaryEndpoint, l.ShadowEndpoint, routingMethod,
+		l.StatusCode, boolToInt(l.Success), l.ErrorMessage, l.LatencyMs, l.PrimaryLatencyMs, l.InputTokens, l.OutputTokens,
+		l.Cost, l.PrimaryCost, l.DiffSummary, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("insert shadow log: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+// List returns paginated shadow logs (newest first) and the total count.
+func (r *ShadowLogRepository) List(ctx context.Context, limit, offset int) ([]*models.ShadowLog, int, error) {
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM shadow_logs`).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count shadow logs: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, request_id, model_name, primary_endpoint, shadow_endpoint, routing_method,
+		        status_code, success, error_message, latency_ms, primary_latency_ms, input_tokens, output_tokens,
+		        cost, primary_cost, diff_summary, created_at
+		 FROM shadow_logs ORDER BY id DESC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query shadow logs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := []*models.ShadowLog{}
+	for rows.Next() {
+		var l models.ShadowLog
+		var success int
+		var createdAt sql.NullTime
+		if err := rows.Scan(&l.ID, &l.RequestID, &l.ModelName, &l.PrimaryEndpoint, &l.ShadowEndpoint, &l.RoutingMethod,
+			&l.StatusCode, &success, &l.ErrorMessage, &l.LatencyMs, &l.PrimaryLatencyMs, &l.InputTokens, &l.OutputTokens,
+			&l.Cost, &l.PrimaryCost, &l.DiffSummary, &createdAt); err != nil {
+			return nil, 0, fmt.Errorf("scan shadow log: %w", err)
+		}
+		l.Success = success == 1
+		if createdAt.Valid {
+			l.CreatedAt = createdAt.Time
+		}
+		logs = append(logs, &l)
+	}
+	return logs, total, rows.Err()
+}
@@ -0,0 +1,45 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/tests/testutil"
+)
+
+func TestShadowLogRepository_InsertList(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	repo := NewShadowLogRepository(db)
+	ctx := context.Background()
+
+	for _, id := range []string{"req-1", "req-2"} {
+		_, err := repo.Insert(ctx, &models.ShadowLog{
+			RequestID:       id,
+			ModelName:       "claude-3",
+			PrimaryEndpoint: "prod/claude-3",
+			ShadowEndpoint:  "candidate/claude-3",
+			StatusCode:      200,
+			Success:         true,
+			LatencyMs:       120,
+			Cost:            0.01,
+			DiffSummary:     "identical text",
+		})
+		require.NoError(t, err)
+	}
+
+	logs, total, err := repo.List(ctx, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, logs, 1)
+	assert.Equal(t, "req-2", logs[0].RequestID)
+	assert.Equal(t, "shadow", logs[0].RoutingMethod)
+	assert.True(t, logs[0].Success)
+	assert.Equal(t, "candidate/claude-3", logs[0].ShadowEndpoint)
+	assert.False(t, logs[0].CreatedAt.IsZero())
+}
@@ -3,12 +3,17 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
+
+	"github.com/user/llm-proxy-go/internal/models"
 )
 
 // SystemConfigRepository handles system configuration data access.
-// Operates on routing_config, load_balance_config, health_check_config, ui_config tables.
+// Operates on routing_config, load_balance_config, health_check_config, ui_config,
+// log_retention_config, anthropic_version_config, health_webhook_config,
+// maintenance_config tables.
 type SystemConfigRepository struct {
 	db *sql.DB
 }
@@ -57,6 +62,96 @@ func (r *SystemConfigRepository) UpdateUIConfig(ctx context.Context, updates map
 	return r.updateConfig(ctx, "ui_config", updates)
 }
 
+// GetLogRetentionConfig retrieves the request log retention configuration.
+func (r *SystemConfigRepository) GetLogRetentionConfig(ctx context.Context) (map[string]any, error) {
+	return r.getConfig(ctx, "log_retention_config")
+}
+
+// UpdateLogRetentionConfig updates the request log retention configuration.
+func (r *SystemConfigRepository) UpdateLogRetentionConfig(ctx context.Context, updates map[string]any) error {
+	return r.updateConfig(ctx, "log_retention_config", updates)
+}
+
+// GetLogRetentionDays returns how many days of request logs are kept; 0 means
+// logs are kept forever.
+func (r *SystemConfigRepository) GetLogRetentionDays(ctx context.Context) (int, error) {
+	var days sql.NullInt64
+	err := r.db.QueryRowContext(ctx, "SELECT retention_days FROM log_retention_config WHERE id = 1").Scan(&days)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get log retention days: %w", err)
+	}
+	return int(days.Int64), nil
+}
+
+// GetAnthropicVersionConfig returns the anthropic-version header policy.
+func (r *SystemConfigRepository) GetAnthropicVersionConfig(ctx context.Context) (*models.AnthropicVersionConfig, error) {
+	var cfg models.AnthropicVersionConfig
+	var allowed string
+	err := r.db.QueryRowContext(ctx,
+		"SELECT pinned_version, default_version, allowed_versions FROM anthropic_version_config WHERE id = 1",
+	).Scan(&cfg.PinnedVersion, &cfg.DefaultVersion, &allowed)
+	if err == sql.ErrNoRows {
+		return &cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get anthropic version config: %w", err)
+	}
+	if allowed != "" {
+		if err := json.Unmarshal([]byte(allowed), &cfg.AllowedVersions); err != nil {
+			return nil, fmt.Errorf("unmarshal allowed_versions: %w", err)
+		}
+	}
+	return &cfg, nil
+}
+
+// UpdateAnthropicVersionConfig updates the anthropic-version header policy.
+func (r *SystemConfigRepository) UpdateAnthropicVersionConfig(ctx context.Context, updates map[string]any) error {
+	return r.updateConfig(ctx, "anthropic_version_config", updates)
+}
+
+// GetHealthWebhookConfig returns the health transition webhook settings.
+func (r *SystemConfigRepository) GetHealthWebhookConfig(ctx context.Context) (*models.HealthWebhookConfig, error) {
+	var cfg models.HealthWebhookConfig
+	err := r.db.QueryRowContext(ctx,
+		"SELECT url, secret FROM health_webhook_config WHERE id = 1",
+	).Scan(&cfg.URL, &cfg.Secret)
+	if err == sql.ErrNoRows {
+		return &cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get health webhook config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// UpdateHealthWebhookConfig updates the health transition webhook settings.
+func (r *SystemConfigRepository) UpdateHealthWebhookConfig(ctx context.Context, updates map[string]any) error {
+	return r.updateConfig(ctx, "health_webhook_config", updates)
+}
+
+// GetMaintenanceConfig returns the maintenance mode settings.
+func (r *SystemConfigRepository) GetMaintenanceConfig(ctx context.Context) (*models.MaintenanceConfig, error) {
+	var cfg models.MaintenanceConfig
+	err := r.db.QueryRowContext(ctx,
+		"SELECT enabled, message, retry_after_seconds FROM maintenance_config WHERE id = 1",
+	).Scan(&cfg.Enabled, &cfg.Message, &cfg.RetryAfterSeconds)
+	if err == sql.ErrNoRows {
+		return &cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// UpdateMaintenanceConfig updates the maintenance mode settings.
+func (r *SystemConfigRepository) UpdateMaintenanceConfig(ctx context.Context, updates map[string]any) error {
+	return r.updateConfig(ctx, "maintenance_config", updates)
+}
+
 // getConfig reads a single-row config table and returns all columns as a map.
 func (r *SystemConfigRepository) getConfig(ctx context.Context, table string) (map[string]any, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE id = 1", table)
@@ -159,3 +159,83 @@ func TestSystemConfigRepository_NoRow(t *testing.T) {
 	require.NoError(t, err)
 	assert.Empty(t, config)
 }
+
+func TestSystemConfigRepository_LogRetentionConfig(t *testing.T) {
+	db := testutil.NewTestDBWithDefaults(t)
+	repo := NewSystemConfigRepository(db)
+	ctx := context.Background()
+
+	days, err := repo.GetLogRetentionDays(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, days)
+
+	require.NoError(t, repo.UpdateLogRetentionConfig(ctx, map[string]any{"retention_days": 30}))
+	days, err = repo.GetLogRetentionDays(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 30, days)
+
+	config, err := repo.GetLogRetentionConfig(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 30, config["retention_days"])
+}
+
+func TestSystemConfigRepository_AnthropicVersionConfig(t *testing.T) {
+	db := testutil.NewTestDBWithDefaults(t)
+	repo := NewSystemConfigRepository(db)
+	ctx := context.Background()
+
+	cfg, err := repo.GetAnthropicVersionConfig(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "", cfg.PinnedVersion)
+	assert.Equal(t, "2023-06-01", cfg.DefaultVersion)
+	assert.Empty(t, cfg.AllowedVersions)
+
+	require.NoError(t, repo.UpdateAnthropicVersionConfig(ctx, map[string]any{
+		"pinned_version":   "2023-01-01",
+		"allowed_versions": `["2023-06-01"]`,
+	}))
+	cfg, err = repo.GetAnthropicVersionConfig(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "2023-01-01", cfg.PinnedVersion)
+	assert.Equal(t, []string{"2023-06-01"}, cfg.AllowedVersions)
+}
+
+func TestSystemConfigRepository_HealthWebhookConfig(t *testing.T) {
+	db := testutil.NewTestDBWithDefaults(t)
+	repo := NewSystemConfigRepository(db)
+	ctx := context.Background()
+
+	cfg, err := repo.GetHealthWebhookConfig(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "", cfg.URL)
+	assert.Equal(t, "", cfg.Secret)
+
+	require.NoError(t, repo.UpdateHealthWebhookConfig(ctx, map[string]any{
+		"url":    "https://hooks.example.com/llm",
+		"secret": "s3cret",
+	}))
+	cfg, err = repo.GetHealthWebhookConfig(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "https://hooks.example.com/llm", cfg.URL)
+	assert.Equal(t, "s3cret", cfg.Secret)
+}
+
+func TestSystemConfigRepository_MaintenanceConfig(t *testing.T) {
+	db := testutil.NewTestDBWithDefaults(t)
+	repo := NewSystemConfigRepository(db)
+	ctx := context.Background()
+
+	cfg, err := repo.GetMaintenanceConfig(ctx)
+	require.NoError(t, err)
+	assert.False(t, cfg.Enabled)
+	assert.Equal(t, 60, cfg.RetryAfterSeconds)
+
+	require.NoError(t, repo.UpdateMaintenanceConfig(ctx, map[string]any{
+		"enabled": true,
+		"message": "Rotating keys",
+	}))
+	cfg, err = repo.GetMaintenanceConfig(ctx)
+	require.NoError(t, err)
+	assert.True(t, cfg.Enabled)
+	assert.Equal(t, "Rotating keys", cfg.Message)
+}
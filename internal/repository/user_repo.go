@@ -20,58 +20,64 @@ func NewUserRepository(db *sql.DB) *SQLUserRepository {
 
 func (r *SQLUserRepository) FindByID(ctx context.Context, id int64) (*models.User, error) {
 	row := r.db.QueryRowContext(ctx,
-		`SELECT id, username, role, is_active, created_at, updated_at
+		`SELECT id, username, role, is_active, created_at, updated_at, monthly_budget_usd
 		 FROM users WHERE id = ?`, id)
 
 	var u models.User
 	var role string
 	var isActive int
+	var budget sql.NullFloat64
 
-	err := row.Scan(&u.ID, &u.Username, &role, &isActive, &u.CreatedAt, &u.UpdatedAt)
+	err := row.Scan(&u.ID, &u.Username, &role, &isActive, &u.CreatedAt, &u.UpdatedAt, &budget)
 	if err != nil {
 		return nil, err
 	}
 
 	u.Role = models.UserRole(role)
 	u.IsActive = isActive == 1
+	u.MonthlyBudgetUSD = nullFloat(budget)
 	return &u, nil
 }
 
 func (r *SQLUserRepository) FindByUsername(ctx context.Context, username string) (*models.User, error) {
 	row := r.db.QueryRowContext(ctx,
-		`SELECT id, username, role, is_active, created_at, updated_at
+		`SELECT id, username, role, is_active, created_at, updated_at, monthly_budget_usd
 		 FROM users WHERE username = ?`, username)
 
 	var u models.User
 	var role string
 	var isActive int
+	var budget sql.NullFloat64
 
-	err := row.Scan(&u.ID, &u.Username, &role, &isActive, &u.CreatedAt, &u.UpdatedAt)
+	err := row.Scan(&u.ID, &u.Username, &role, &isActive, &u.CreatedAt, &u.UpdatedAt, &budget)
 	if err != nil {
 		return nil, err
 	}
 
 	u.Role = models.UserRole(role)
 	u.IsActive = isActive == 1
+	u.MonthlyBudgetUSD = nullFloat(budget)
 	return &u, nil
 }
 
 func (r *SQLUserRepository) FindByUsernameWithHash(ctx context.Context, username string) (*models.User, error) {
 	row := r.db.QueryRowContext(ctx,
-		`SELECT id, username, password_hash, role, is_active, created_at, updated_at
+		`SELECT id, username, password_hash, role, is_active, created_at, updated_at, monthly_budget_usd
 		 FROM users WHERE username = ?`, username)
 
 	var u models.User
 	var role string
 	var isActive int
+	var budget sql.NullFloat64
 
-	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &role, &isActive, &u.CreatedAt, &u.UpdatedAt)
+	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &role, &isActive, &u.CreatedAt, &u.UpdatedAt, &budget)
 	if err != nil {
 		return nil, err
 	}
 
 	u.Role = models.UserRole(role)
 	u.IsActive = isActive == 1
+	u.MonthlyBudgetUSD = nullFloat(budget)
 	return &u, nil
 }
 
@@ -84,10 +90,10 @@ func (r *SQLUserRepository) Insert(ctx context.Context, user *models.User) (int6
 		user.UpdatedAt = now
 	}
 	result, err := r.db.ExecContext(ctx,
-		`INSERT INTO users (username, password_hash, role, is_active, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?)`,
+		`INSERT INTO users (username, password_hash, role, is_active, created_at, updated_at, monthly_budget_usd)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		user.Username, user.PasswordHash, string(user.Role),
-		boolToInt(user.IsActive), user.CreatedAt, user.UpdatedAt)
+		boolToInt(user.IsActive), user.CreatedAt, user.UpdatedAt, user.MonthlyBudgetUSD)
 	if err != nil {
 		return 0, err
 	}
@@ -105,7 +111,7 @@ func (r *SQLUserRepository) FindAll(ctx context.Context, offset, limit int) ([]*
 
 	// Get users
 	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, username, role, is_active, created_at, updated_at
+		`SELECT id, username, role, is_active, created_at, updated_at, monthly_budget_usd
 		 FROM users ORDER BY created_at DESC LIMIT ? OFFSET ?`, limit, offset)
 	if err != nil {
 		return nil, 0, err
@@ -117,11 +123,13 @@ func (r *SQLUserRepository) FindAll(ctx context.Context, offset, limit int) ([]*
 		var u models.User
 		var role string
 		var isActive int
-		if err := rows.Scan(&u.ID, &u.Username, &role, &isActive, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		var budget sql.NullFloat64
+		if err := rows.Scan(&u.ID, &u.Username, &role, &isActive, &u.CreatedAt, &u.UpdatedAt, &budget); err != nil {
 			return nil, 0, err
 		}
 		u.Role = models.UserRole(role)
 		u.IsActive = isActive == 1
+		u.MonthlyBudgetUSD = nullFloat(budget)
 		users = append(users, &u)
 	}
 	return users, total, rows.Err()
@@ -131,8 +139,8 @@ func (r *SQLUserRepository) FindAll(ctx context.Context, offset, limit int) ([]*
 func (r *SQLUserRepository) Update(ctx context.Context, user *models.User) error {
 	user.UpdatedAt = time.Now().UTC()
 	_, err := r.db.ExecContext(ctx,
-		`UPDATE users SET username = ?, role = ?, is_active = ?, updated_at = ? WHERE id = ?`,
-		user.Username, string(user.Role), boolToInt(user.IsActive), user.UpdatedAt, user.ID)
+		`UPDATE users SET username = ?, role = ?, is_active = ?, monthly_budget_usd = ?, updated_at = ? WHERE id = ?`,
+		user.Username, string(user.Role), boolToInt(user.IsActive), user.MonthlyBudgetUSD, user.UpdatedAt, user.ID)
 	return err
 }
 
@@ -160,19 +168,29 @@ func (r *SQLUserRepository) CountByRole(ctx context.Context, role models.UserRol
 // FindByIDWithHash returns a user by ID including password hash (for auth).
 func (r *SQLUserRepository) FindByIDWithHash(ctx context.Context, id int64) (*models.User, error) {
 	row := r.db.QueryRowContext(ctx,
-		`SELECT id, username, password_hash, role, is_active, created_at, updated_at
+		`SELECT id, username, password_hash, role, is_active, created_at, updated_at, monthly_budget_usd
 		 FROM users WHERE id = ?`, id)
 
 	var u models.User
 	var role string
 	var isActive int
+	var budget sql.NullFloat64
 
-	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &role, &isActive, &u.CreatedAt, &u.UpdatedAt)
+	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &role, &isActive, &u.CreatedAt, &u.UpdatedAt, &budget)
 	if err != nil {
 		return nil, err
 	}
 
 	u.Role = models.UserRole(role)
 	u.IsActive = isActive == 1
+	u.MonthlyBudgetUSD = nullFloat(budget)
 	return &u, nil
 }
+
+// nullFloat converts a nullable REAL column to a pointer, nil for NULL.
+func nullFloat(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
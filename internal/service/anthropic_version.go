@@ -0,0 +1,55 @@
+package service
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+// defaultAnthropicVersion is sent upstream when neither the client nor the
+// configuration names a version.
+const defaultAnthropicVersion = "2023-06-01"
+
+// AnthropicVersionPolicy decides the anthropic-version header sent upstream,
+// so upstreams that reject versions sent by newer clients keep working. The
+// policy is read from system config and cached briefly. A nil policy forwards
+// the client's version, honouring only per-provider pins.
+type AnthropicVersionPolicy struct {
+	cfg *cachedConfig[models.AnthropicVersionConfig]
+}
+
+// NewAnthropicVersionPolicy creates a policy reading from repo.
+func NewAnthropicVersionPolicy(repo *repository.SystemConfigRepository, logger *zap.Logger) *AnthropicVersionPolicy {
+	return &AnthropicVersionPolicy{
+		cfg: newCachedConfig("anthropic version config", 5*time.Second, repo.GetAnthropicVersionConfig, logger),
+	}
+}
+
+// Resolve returns the version to send to provider for a request with the
+// client headers h: the provider's pin, else the pinned version, else the
+// client's version if allowed, else the default version.
+func (p *AnthropicVersionPolicy) Resolve(provider *models.Provider, h http.Header) string {
+	if provider != nil && provider.AnthropicVersion != "" {
+		return provider.AnthropicVersion
+	}
+	if p == nil {
+		return headerOrDefault(h, "Anthropic-Version", defaultAnthropicVersion)
+	}
+	cfg := p.cfg.get()
+	if cfg.PinnedVersion != "" {
+		return cfg.PinnedVersion
+	}
+	def := cfg.DefaultVersion
+	if def == "" {
+		def = defaultAnthropicVersion
+	}
+	version := headerOrDefault(h, "Anthropic-Version", def)
+	if len(cfg.AllowedVersions) > 0 && !slices.Contains(cfg.AllowedVersions, version) {
+		return def
+	}
+	return version
+}
@@ -0,0 +1,109 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+func TestAnthropicVersionPolicy_Resolve(t *testing.T) {
+	header := func(v string) http.Header {
+		h := http.Header{}
+		if v != "" {
+			h.Set("Anthropic-Version", v)
+		}
+		return h
+	}
+	tests := []struct {
+		name     string
+		cfg      models.AnthropicVersionConfig
+		provider string
+		client   string
+		want     string
+	}{
+		{"passthrough", models.AnthropicVersionConfig{DefaultVersion: "2023-06-01"}, "", "2024-10-22", "2024-10-22"},
+		{"missing uses default", models.AnthropicVersionConfig{DefaultVersion: "2023-01-01"}, "", "", "2023-01-01"},
+		{"pinned", models.AnthropicVersionConfig{PinnedVersion: "2023-01-01", DefaultVersion: "2023-06-01"}, "", "2024-10-22", "2023-01-01"},
+		{"allowed", models.AnthropicVersionConfig{DefaultVersion: "2023-06-01", AllowedVersions: []string{"2023-06-01", "2024-10-22"}}, "", "2024-10-22", "2024-10-22"},
+		{"not allowed", models.AnthropicVersionConfig{DefaultVersion: "2023-06-01", AllowedVersions: []string{"2023-06-01"}}, "", "2099-01-01", "2023-06-01"},
+		{"provider pin wins", models.AnthropicVersionConfig{PinnedVersion: "2023-01-01"}, "2022-12-01", "2024-10-22", "2022-12-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewTestDBWithDefaults(t)
+			repo := repository.NewSystemConfigRepository(db)
+			allowed, _ := json.Marshal(tt.cfg.AllowedVersions)
+			require.NoError(t, repo.UpdateAnthropicVersionConfig(context.Background(), map[string]any{
+				"pinned_version":   tt.cfg.PinnedVersion,
+				"default_version":  tt.cfg.DefaultVersion,
+				"allowed_versions": string(allowed),
+			}))
+			p := NewAnthropicVersionPolicy(repo, zap.NewNop())
+			assert.Equal(t, tt.want, p.Resolve(&models.Provider{AnthropicVersion: tt.provider}, header(tt.client)))
+		})
+	}
+
+	var nilPolicy *AnthropicVersionPolicy
+	assert.Equal(t, "2024-10-22", nilPolicy.Resolve(&models.Provider{}, header("2024-10-22")))
+	assert.Equal(t, defaultAnthropicVersion, nilPolicy.Resolve(&models.Provider{}, header("")))
+	assert.Equal(t, "2022-12-01", nilPolicy.Resolve(&models.Provider{AnthropicVersion: "2022-12-01"}, header("2024-10-22")))
+}
+
+func TestProxyService_AnthropicVersionOverride(t *testing.T) {
+	var got []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("anthropic-version"))
+		if r.Header.Get("Accept") == "text/event-stream" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"type\":\"message_stop\"}\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.AnthropicResponse{ID: "msg_1", Type: "message", Role: "assistant"})
+	}))
+	defer upstream.Close()
+
+	repo := repository.NewSystemConfigRepository(testutil.NewTestDBWithDefaults(t))
+	require.NoError(t, repo.UpdateAnthropicVersionConfig(context.Background(), map[string]any{
+		"allowed_versions": `["2023-06-01"]`,
+	}))
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	ps.SetAnthropicVersionPolicy(NewAnthropicVersionPolicy(repo, logger))
+
+	ep := createProxyTestEndpoint(upstream.URL)
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: ep.Model.Role}
+	headers := http.Header{}
+	headers.Set("Anthropic-Version", "2099-01-01")
+
+	_, _, err := ps.ProxyRequest(context.Background(), req, headers, selection, []*models.Endpoint{ep})
+	require.NoError(t, err)
+
+	ch, _, err := ps.ProxyStreamRequest(context.Background(), req, headers, selection, []*models.Endpoint{ep})
+	require.NoError(t, err)
+	for range ch {
+	}
+
+	assert.Equal(t, []string{"2023-06-01", "2023-06-01"}, got)
+}
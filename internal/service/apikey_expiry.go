@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+// apiKeyExpiryInterval is how often expired API keys are deactivated.
+const apiKeyExpiryInterval = 5 * time.Minute
+
+// APIKeyExpiry periodically deactivates API keys whose expiry has passed, so
+// they stop showing as active in listings. ValidateAPIKey rejects expired
+// keys on its own; the sweep only keeps the stored state in line. Only the
+// primary worker sweeps.
+type APIKeyExpiry struct {
+	keys    repository.APIKeyRepository
+	primary func() bool
+	logger  *zap.Logger
+	now     func() time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewAPIKeyExpiry creates an APIKeyExpiry. isPrimary reports whether this
+// worker is the primary; nil means a single worker.
+func NewAPIKeyExpiry(keys repository.APIKeyRepository, isPrimary func() bool, logger *zap.Logger) *APIKeyExpiry {
+	if isPrimary == nil {
+		isPrimary = func() bool { return true }
+	}
+	return &APIKeyExpiry{keys: keys, primary: isPrimary, logger: logger, now: time.Now}
+}
+
+// Run deactivates expired keys and returns how many were deactivated. It
+// does nothing on secondary workers.
+func (e *APIKeyExpiry) Run(ctx context.Context) (int64, error) {
+	if !e.primary() {
+		return 0, nil
+	}
+	n, err := e.keys.DeactivateExpired(ctx, e.now())
+	if n > 0 {
+		e.logger.Info("deactivated expired API keys", zap.Int64("count", n))
+	}
+	return n, err
+}
+
+// Start runs the sweep immediately and then every five minutes until Stop.
+func (e *APIKeyExpiry) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan struct{})
+
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(apiKeyExpiryInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := e.Run(ctx); err != nil && ctx.Err() == nil {
+				e.logger.Warn("API key expiry sweep failed", zap.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop halts the sweep.
+func (e *APIKeyExpiry) Stop() {
+	if e.cancel == nil {
+		return
+	}
+	e.cancel()
+	<-e.done
+}
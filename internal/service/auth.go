@@ -5,8 +5,12 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
+	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/user/llm-proxy-go/internal/models"
@@ -27,6 +31,11 @@ type CurrentUser struct {
 	Role         string  `json:"role"`
 	APIKeyPrefix *string `json:"api_key_prefix,omitempty"`
 	APIKeyID     *int64  `json:"api_key_id,omitempty"`
+	// Restrictions of the API key used to authenticate, if any.
+	AllowedModels   []string `json:"allowed_models,omitempty"`
+	RateLimitPerMin int      `json:"rate_limit_per_min,omitempty"`
+	// Monthly spend cap of the user, set for API key authentication.
+	MonthlyBudgetUSD *float64 `json:"monthly_budget_usd,omitempty"`
 }
 
 // AuthService handles authentication: API key validation and session management.
@@ -35,6 +44,19 @@ type AuthService struct {
 	userRepo    repository.UserRepository
 	sessionRepo *repository.SessionRepository
 	logger      *zap.Logger
+	now         func() time.Time
+	bcryptCost  int // Cost of new password hashes; weaker ones are upgraded on login
+
+	keyCacheTTL time.Duration // How long a looked-up API key is trusted without the database; 0 = no cache
+	keyCacheMu  sync.Mutex
+	keyCache    map[string]*cachedAPIKey // By key hash
+}
+
+// cachedAPIKey is an API key and its user as last read from the database.
+type cachedAPIKey struct {
+	key      *models.APIKey
+	user     *models.User
+	loadedAt time.Time
 }
 
 // NewAuthService creates a new AuthService.
@@ -49,27 +71,55 @@ func NewAuthService(
 		userRepo:    userRepo,
 		sessionRepo: sessionRepo,
 		logger:      logger,
+		now:         time.Now,
+		bcryptCost:  bcrypt.DefaultCost,
+		keyCache:    make(map[string]*cachedAPIKey),
+	}
+}
+
+// SetBcryptCost sets the bcrypt cost of password hashes created from now on.
+// Users whose stored hash is weaker are re-hashed on their next login.
+func (s *AuthService) SetBcryptCost(cost int) {
+	s.bcryptCost = cost
+}
+
+// SetAPIKeyCacheTTL sets how long ValidateAPIKey reuses an API key and its
+// user without reading them again (0 disables the cache). Whatever the TTL,
+// a cached key is also used when reading it fails for a reason other than
+// the key not existing, so database contention does not reject live
+// traffic. Changes made on another worker take up to the TTL to apply.
+func (s *AuthService) SetAPIKeyCacheTTL(ttl time.Duration) {
+	s.keyCacheTTL = ttl
+}
+
+// InvalidateAPIKeys drops all cached API keys, e.g. after a key or user was
+// changed on this worker.
+func (s *AuthService) InvalidateAPIKeys() {
+	if s == nil {
+		return
 	}
+	s.keyCacheMu.Lock()
+	defer s.keyCacheMu.Unlock()
+	clear(s.keyCache)
 }
 
 // --- API Key Authentication ---
 
 // ValidateAPIKey validates an API key and returns the associated user.
 func (s *AuthService) ValidateAPIKey(ctx context.Context, rawKey string) (*CurrentUser, error) {
-	keyHash := HashAPIKey(rawKey)
-
-	apiKey, err := s.keyRepo.FindByKeyHash(ctx, keyHash)
+	apiKey, user, err := s.lookupAPIKey(ctx, HashAPIKey(rawKey))
 	if err != nil {
-		return nil, fmt.Errorf("invalid API key")
+		return nil, err
 	}
 
-	if !apiKey.IsActive {
-		return nil, fmt.Errorf("API key is inactive")
+	// Checked first so an expired key reports its expiry even after the
+	// sweep has deactivated it.
+	if apiKey.IsExpired(time.Now()) {
+		return nil, fmt.Errorf("API key expired")
 	}
 
-	user, err := s.userRepo.FindByID(ctx, apiKey.UserID)
-	if err != nil {
-		return nil, fmt.Errorf("user not found for API key")
+	if !apiKey.IsActive {
+		return nil, fmt.Errorf("API key is inactive")
 	}
 
 	if !user.IsActive {
@@ -91,9 +141,78 @@ func (s *AuthService) ValidateAPIKey(ctx context.Context, rawKey string) (*Curre
 		Role:         string(user.Role),
 		APIKeyPrefix: &prefix,
 		APIKeyID:     &apiKey.ID,
+
+		AllowedModels:    apiKey.AllowedModels,
+		RateLimitPerMin:  apiKey.RateLimitPerMin,
+		MonthlyBudgetUSD: user.MonthlyBudgetUSD,
 	}, nil
 }
 
+// lookupAPIKey returns the API key with hash keyHash and its user, from the
+// cache while fresh. When the database cannot be read, an expired cache
+// entry is used instead of failing.
+func (s *AuthService) lookupAPIKey(ctx context.Context, keyHash string) (*models.APIKey, *models.User, error) {
+	s.keyCacheMu.Lock()
+	cached := s.keyCache[keyHash]
+	s.keyCacheMu.Unlock()
+	if cached != nil && s.now().Sub(cached.loadedAt) < s.keyCacheTTL {
+		return cached.key, cached.user, nil
+	}
+
+	// useStale reports whether err is a database failure a cached entry can
+	// ride out, rather than the key or user being gone.
+	useStale := func(err error) bool {
+		if cached == nil || errors.Is(err, sql.ErrNoRows) {
+			return false
+		}
+		s.logger.Warn("API key lookup failed, using cached key", zap.Error(err))
+		return true
+	}
+
+	apiKey, err := s.keyRepo.FindByKeyHash(ctx, keyHash)
+	if err != nil {
+		if useStale(err) {
+			return cached.key, cached.user, nil
+		}
+		return nil, nil, fmt.Errorf("invalid API key")
+	}
+	user, err := s.userRepo.FindByID(ctx, apiKey.UserID)
+	if err != nil {
+		if useStale(err) {
+			return cached.key, cached.user, nil
+		}
+		return nil, nil, fmt.Errorf("user not found for API key")
+	}
+
+	if s.keyCacheTTL > 0 {
+		s.keyCacheMu.Lock()
+		s.keyCache[keyHash] = &cachedAPIKey{key: apiKey, user: user, loadedAt: s.now()}
+		s.keyCacheMu.Unlock()
+	}
+	return apiKey, user, nil
+}
+
+// AllowsModel reports whether the user's API key may request model. Users
+// without an allowlist may request any model.
+func (u *CurrentUser) AllowsModel(model string) bool {
+	return len(u.AllowedModels) == 0 || slices.Contains(u.AllowedModels, model)
+}
+
+// AllowedEndpoints returns the endpoints serving a model the user's API key
+// may request.
+func (u *CurrentUser) AllowedEndpoints(eps []*models.Endpoint) []*models.Endpoint {
+	if len(u.AllowedModels) == 0 {
+		return eps
+	}
+	var allowed []*models.Endpoint
+	for _, ep := range eps {
+		if u.AllowsModel(ep.Model.Name) {
+			allowed = append(allowed, ep)
+		}
+	}
+	return allowed
+}
+
 // --- Session Authentication ---
 
 // AuthenticateUser verifies username/password and returns the user.
@@ -111,9 +230,30 @@ func (s *AuthService) AuthenticateUser(ctx context.Context, username, password s
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
+	s.upgradePasswordHash(ctx, user, password)
 	return user, nil
 }
 
+// upgradePasswordHash re-hashes the just verified password of user with the
+// current bcrypt cost when the stored hash is in the legacy SHA-256 format or
+// uses a lower cost. Failing to do so is logged and does not fail the login;
+// the upgrade is tried again on the next one.
+func (s *AuthService) upgradePasswordHash(ctx context.Context, user *models.User, password string) {
+	if !needsRehash(user.PasswordHash, s.bcryptCost) {
+		return
+	}
+	hash, err := HashPasswordCost(password, s.bcryptCost)
+	if err == nil {
+		err = s.userRepo.UpdatePassword(ctx, user.ID, hash)
+	}
+	if err != nil {
+		s.logger.Warn("failed to upgrade password hash", zap.Int64("user_id", user.ID), zap.Error(err))
+		return
+	}
+	user.PasswordHash = hash
+	s.logger.Info("upgraded password hash", zap.Int64("user_id", user.ID), zap.Int("cost", s.bcryptCost))
+}
+
 // CreateSession creates a new session for the user.
 func (s *AuthService) CreateSession(ctx context.Context, userID int64, ipAddress, userAgent string) (*repository.Session, error) {
 	token, err := repository.GenerateSessionToken()
@@ -178,7 +318,7 @@ func (s *AuthService) CreateDefaultAdmin(ctx context.Context, username, password
 		return nil // Already exists
 	}
 
-	hash, err := HashPassword(password)
+	hash, err := HashPasswordCost(password, s.bcryptCost)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -201,7 +341,7 @@ func (s *AuthService) CreateDefaultAdmin(ctx context.Context, username, password
 
 // HashPassword hashes a password (method wrapper for handler use).
 func (s *AuthService) HashPassword(password string) (string, error) {
-	return HashPassword(password)
+	return HashPasswordCost(password, s.bcryptCost)
 }
 
 // VerifyPassword verifies a password against a stored hash (method wrapper for handler use).
@@ -211,15 +351,20 @@ func (s *AuthService) VerifyPassword(password, storedHash string) bool {
 
 // --- Password Utilities ---
 
-// HashPassword hashes a password using bcrypt.
+// HashPassword hashes a password using bcrypt with the default cost.
 // For passwords > 72 bytes, pre-hashes with SHA-256.
 func HashPassword(password string) (string, error) {
+	return HashPasswordCost(password, bcrypt.DefaultCost)
+}
+
+// HashPasswordCost hashes a password using bcrypt with the given cost.
+func HashPasswordCost(password string, cost int) (string, error) {
 	input := []byte(password)
 	if len(input) > 72 {
 		h := sha256.Sum256(input)
 		input = []byte(hex.EncodeToString(h[:]))
 	}
-	hash, err := bcrypt.GenerateFromPassword(input, bcrypt.DefaultCost)
+	hash, err := bcrypt.GenerateFromPassword(input, cost)
 	if err != nil {
 		return "", fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -250,6 +395,16 @@ func VerifyPassword(password, storedHash string) bool {
 	return subtle.ConstantTimeCompare([]byte(expectedHash), []byte(actualHash)) == 1
 }
 
+// needsRehash reports whether storedHash should be replaced by a bcrypt hash
+// of the given cost: it is in the legacy format or uses a lower cost.
+func needsRehash(storedHash string, cost int) bool {
+	hashCost, err := bcrypt.Cost([]byte(storedHash))
+	if err != nil {
+		return true
+	}
+	return hashCost < cost
+}
+
 // HashAPIKey computes SHA-256 hex digest of an API key.
 func HashAPIKey(key string) string {
 	h := sha256.Sum256([]byte(key))
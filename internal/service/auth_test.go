@@ -5,7 +5,11 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -13,6 +17,7 @@ import (
 	"github.com/user/llm-proxy-go/internal/repository"
 	"github.com/user/llm-proxy-go/tests/testutil"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHashPassword(t *testing.T) {
@@ -207,6 +212,155 @@ func TestAuthService_ValidateAPIKey_InactiveKey(t *testing.T) {
 	assert.Contains(t, err.Error(), "inactive")
 }
 
+func TestAuthService_ValidateAPIKey_Cache(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	logger := zap.NewNop()
+
+	keyRepo := repository.NewAPIKeyRepository(db)
+	userRepo := repository.NewUserRepository(db)
+	authService := NewAuthService(keyRepo, userRepo, repository.NewSessionRepository(db, logger), logger)
+	now := time.Now()
+	authService.now = func() time.Time { return now }
+	authService.SetAPIKeyCacheTTL(time.Minute)
+	ctx := context.Background()
+
+	userID, err := userRepo.Insert(ctx, &models.User{Username: "cached", PasswordHash: "x", Role: models.UserRoleUser, IsActive: true})
+	require.NoError(t, err)
+	fullKey, keyHash, keyPrefix := GenerateAPIKey()
+	keyID, err := keyRepo.Insert(ctx, &models.APIKey{UserID: userID, KeyHash: keyHash, KeyPrefix: keyPrefix, Name: "k", IsActive: true})
+	require.NoError(t, err)
+
+	_, err = authService.ValidateAPIKey(ctx, fullKey)
+	require.NoError(t, err)
+
+	// A change made elsewhere applies once the entry expires...
+	require.NoError(t, keyRepo.SetActive(ctx, keyID, nil, false))
+	_, err = authService.ValidateAPIKey(ctx, fullKey)
+	require.NoError(t, err, "served from the cache")
+	now = now.Add(time.Minute)
+	_, err = authService.ValidateAPIKey(ctx, fullKey)
+	assert.ErrorContains(t, err, "inactive")
+
+	// ...and at once when invalidated.
+	require.NoError(t, keyRepo.SetActive(ctx, keyID, nil, true))
+	authService.InvalidateAPIKeys()
+	_, err = authService.ValidateAPIKey(ctx, fullKey)
+	require.NoError(t, err)
+
+	// With the database unavailable an expired entry is still used, but
+	// unknown keys are rejected.
+	require.NoError(t, db.Close())
+	now = now.Add(time.Hour)
+	user, err := authService.ValidateAPIKey(ctx, fullKey)
+	require.NoError(t, err)
+	assert.Equal(t, userID, user.UserID)
+	unknownKey, _, _ := GenerateAPIKey()
+	_, err = authService.ValidateAPIKey(ctx, unknownKey)
+	assert.ErrorContains(t, err, "invalid API key")
+
+	// Without the cache a database failure rejects the key.
+	authService.SetAPIKeyCacheTTL(0)
+	authService.InvalidateAPIKeys()
+	_, err = authService.ValidateAPIKey(ctx, fullKey)
+	assert.Error(t, err)
+}
+
+func TestAuthService_ValidateAPIKey_Expiry(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	logger := zap.NewNop()
+
+	keyRepo := repository.NewAPIKeyRepository(db)
+	userRepo := repository.NewUserRepository(db)
+	sessionRepo := repository.NewSessionRepository(db, logger)
+
+	authService := NewAuthService(keyRepo, userRepo, sessionRepo, logger)
+	ctx := context.Background()
+
+	userID, err := userRepo.Insert(ctx, &models.User{
+		Username:     "testuser",
+		PasswordHash: "hash",
+		Role:         models.UserRoleUser,
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+
+	at := func(d time.Duration) *time.Time {
+		t := time.Now().Add(d)
+		return &t
+	}
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		active    bool
+		wantErr   string
+	}{
+		{"not yet expired", at(time.Hour), true, ""},
+		{"null expiry", nil, true, ""},
+		{"just expired", at(-time.Second), true, "API key expired"},
+		{"expired and swept", at(-time.Hour), false, "API key expired"},
+		{"inactive, not expired", at(time.Hour), false, "API key is inactive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fullKey, keyHash, keyPrefix := GenerateAPIKey()
+			_, err := keyRepo.Insert(ctx, &models.APIKey{
+				UserID:    userID,
+				KeyHash:   keyHash,
+				KeyPrefix: keyPrefix,
+				Name:      tt.name,
+				IsActive:  tt.active,
+				ExpiresAt: tt.expiresAt,
+			})
+			require.NoError(t, err)
+
+			user, err := authService.ValidateAPIKey(ctx, fullKey)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				assert.Equal(t, "testuser", user.Username)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Nil(t, user)
+			}
+		})
+	}
+}
+
+func TestAPIKeyExpiry_Run(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	keyRepo := repository.NewAPIKeyRepository(db)
+	ctx := context.Background()
+
+	expired := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	expiredID, err := keyRepo.Insert(ctx, &models.APIKey{UserID: 1, KeyHash: "h1", KeyPrefix: "sk-1", Name: "expired", IsActive: true, ExpiresAt: &expired})
+	require.NoError(t, err)
+	futureID, err := keyRepo.Insert(ctx, &models.APIKey{UserID: 1, KeyHash: "h2", KeyPrefix: "sk-2", Name: "future", IsActive: true, ExpiresAt: &future})
+	require.NoError(t, err)
+
+	secondary := NewAPIKeyExpiry(keyRepo, func() bool { return false }, zap.NewNop())
+	n, err := secondary.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n, "secondary workers do not sweep")
+
+	primary := NewAPIKeyExpiry(keyRepo, nil, zap.NewNop())
+	n, err = primary.Run(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+
+	key, err := keyRepo.FindByID(ctx, expiredID)
+	require.NoError(t, err)
+	assert.False(t, key.IsActive)
+	key, err = keyRepo.FindByID(ctx, futureID)
+	require.NoError(t, err)
+	assert.True(t, key.IsActive)
+
+	n, err = primary.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n, "already deactivated keys are not counted again")
+}
+
 func TestAuthService_AuthenticateUser(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	logger := zap.NewNop()
@@ -282,6 +436,93 @@ func TestAuthService_AuthenticateUser_InactiveUser(t *testing.T) {
 	assert.Contains(t, err.Error(), "inactive")
 }
 
+func TestAuthService_AuthenticateUser_UpgradesLegacyHash(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	logger := zap.NewNop()
+	userRepo := repository.NewUserRepository(db)
+	authService := NewAuthService(repository.NewAPIKeyRepository(db), userRepo, repository.NewSessionRepository(db, logger), logger)
+	ctx := context.Background()
+
+	password := "password123"
+	sum := sha256.Sum256([]byte("testsalt" + password))
+	id, err := userRepo.Insert(ctx, &models.User{
+		Username:     "legacyuser",
+		PasswordHash: "testsalt$" + hex.EncodeToString(sum[:]),
+		Role:         models.UserRoleUser,
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+
+	_, err = authService.AuthenticateUser(ctx, "legacyuser", "wrongpassword")
+	require.Error(t, err)
+	stored, err := userRepo.FindByUsernameWithHash(ctx, "legacyuser")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stored.PasswordHash, "testsalt$"), "a failed login leaves the hash alone")
+
+	user, err := authService.AuthenticateUser(ctx, "legacyuser", password)
+	require.NoError(t, err)
+	assert.Equal(t, id, user.ID)
+
+	stored, err = userRepo.FindByUsernameWithHash(ctx, "legacyuser")
+	require.NoError(t, err)
+	cost, err := bcrypt.Cost([]byte(stored.PasswordHash))
+	require.NoError(t, err, "the legacy hash is replaced by a bcrypt hash")
+	assert.Equal(t, bcrypt.DefaultCost, cost)
+	assert.True(t, VerifyPassword(password, stored.PasswordHash))
+
+	_, err = authService.AuthenticateUser(ctx, "legacyuser", password)
+	require.NoError(t, err, "the upgraded hash still logs in")
+}
+
+func TestAuthService_AuthenticateUser_UpgradesHashCost(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	logger := zap.NewNop()
+	userRepo := repository.NewUserRepository(db)
+	authService := NewAuthService(repository.NewAPIKeyRepository(db), userRepo, repository.NewSessionRepository(db, logger), logger)
+	ctx := context.Background()
+
+	password := "securePassword123"
+	hash, err := HashPasswordCost(password, bcrypt.MinCost)
+	require.NoError(t, err)
+	_, err = userRepo.Insert(ctx, &models.User{
+		Username:     "cheapuser",
+		PasswordHash: hash,
+		Role:         models.UserRoleUser,
+		IsActive:     true,
+	})
+	require.NoError(t, err)
+	storedCost := func() int {
+		stored, err := userRepo.FindByUsernameWithHash(ctx, "cheapuser")
+		require.NoError(t, err)
+		cost, err := bcrypt.Cost([]byte(stored.PasswordHash))
+		require.NoError(t, err)
+		return cost
+	}
+
+	// A hash at or above the target cost is kept.
+	authService.SetBcryptCost(bcrypt.MinCost)
+	_, err = authService.AuthenticateUser(ctx, "cheapuser", password)
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.MinCost, storedCost())
+
+	authService.SetBcryptCost(bcrypt.MinCost + 1)
+	_, err = authService.AuthenticateUser(ctx, "cheapuser", password)
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.MinCost+1, storedCost())
+
+	// Lowering the cost does not downgrade existing hashes.
+	authService.SetBcryptCost(bcrypt.MinCost)
+	_, err = authService.AuthenticateUser(ctx, "cheapuser", password)
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.MinCost+1, storedCost())
+
+	newHash, err := authService.HashPassword("another")
+	require.NoError(t, err)
+	cost, err := bcrypt.Cost([]byte(newHash))
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.MinCost, cost, "new hashes use the configured cost")
+}
+
 func TestAuthService_CreateSession(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	logger := zap.NewNop()
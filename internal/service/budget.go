@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+)
+
+// ErrBudgetExceeded is returned when a user has spent their monthly budget.
+var ErrBudgetExceeded = errors.New("monthly budget exceeded")
+
+// BudgetUsage is a user's spend in the current budget period.
+type BudgetUsage struct {
+	PeriodStart  time.Time `json:"period_start"`
+	PeriodEnd    time.Time `json:"period_end"`
+	SpentUSD     float64   `json:"spent_usd"`
+	BudgetUSD    *float64  `json:"budget_usd"`    // nil = unlimited
+	RemainingUSD *float64  `json:"remaining_usd"` // nil = unlimited
+	Exempt       bool      `json:"exempt"`        // Admin not subject to the budget
+}
+
+// BudgetService enforces per-user monthly spend caps. The cost of a request
+// is only known once it finishes, so the check runs before each request
+// against the spend already logged: the request that crosses the budget is
+// still served, later ones are rejected until the next calendar month (UTC).
+// Spend is read from a ledger that survives log retention and clearing.
+type BudgetService struct {
+	logs         repository.RequestLogRepository
+	exemptAdmins bool
+	now          func() time.Time
+}
+
+// NewBudgetService creates a BudgetService reading spend from logs.
+func NewBudgetService(logs repository.RequestLogRepository, cfg config.BudgetConfig) *BudgetService {
+	return &BudgetService{logs: logs, exemptAdmins: cfg.ExemptAdmins, now: time.Now}
+}
+
+// budgetPeriod returns the calendar month (UTC) containing t.
+func budgetPeriod(t time.Time) (start, end time.Time) {
+	t = t.UTC()
+	start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+func (b *BudgetService) exempt(role string) bool {
+	return b.exemptAdmins && role == string(models.UserRoleAdmin)
+}
+
+// Usage returns the user's spend in the current period against budget.
+func (b *BudgetService) Usage(ctx context.Context, userID int64, role string, budget *float64) (*BudgetUsage, error) {
+	start, end := budgetPeriod(b.now())
+	spent, err := b.logs.MonthlySpendForUser(ctx, userID, start)
+	if err != nil {
+		return nil, err
+	}
+	usage := &BudgetUsage{PeriodStart: start, PeriodEnd: end, SpentUSD: spent, Exempt: b.exempt(role)}
+	if budget != nil && !usage.Exempt {
+		remaining := max(*budget-spent, 0)
+		usage.BudgetUSD, usage.RemainingUSD = budget, &remaining
+	}
+	return usage, nil
+}
+
+// Check returns ErrBudgetExceeded, along with the usage, when user has no
+// budget left. Users without a budget cost no query.
+func (b *BudgetService) Check(ctx context.Context, user *CurrentUser) (*BudgetUsage, error) {
+	if user.MonthlyBudgetUSD == nil || b.exempt(user.Role) {
+		return nil, nil
+	}
+	usage, err := b.Usage(ctx, user.UserID, user.Role, user.MonthlyBudgetUSD)
+	if err != nil {
+		return nil, err
+	}
+	if usage.SpentUSD >= *user.MonthlyBudgetUSD {
+		return usage, ErrBudgetExceeded
+	}
+	return usage, nil
+}
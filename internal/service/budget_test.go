@@ -0,0 +1,90 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+func TestBudgetPeriod(t *testing.T) {
+	start, end := budgetPeriod(time.Date(2026, 12, 31, 23, 30, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), end)
+}
+
+func TestBudgetService_Check(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	logs := repository.NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	_, err := logs.Insert(ctx, &models.RequestLogEntry{RequestID: "b", UserID: 2, ModelName: "m", Cost: 2.5, Success: true})
+	require.NoError(t, err)
+	// Spend from last month does not count.
+	_, err = db.Exec(`UPDATE user_monthly_spend SET period = ? WHERE user_id = 2`, time.Now().UTC().AddDate(0, -1, 0).Format("2006-01"))
+	require.NoError(t, err)
+	for _, e := range []*models.RequestLogEntry{
+		{RequestID: "a", UserID: 2, ModelName: "m", Cost: 3, Success: true},
+		{RequestID: "c", UserID: 1, ModelName: "m", Cost: 100, Success: true},
+	} {
+		_, err := logs.Insert(ctx, e)
+		require.NoError(t, err)
+	}
+
+	b := NewBudgetService(logs, config.BudgetConfig{ExemptAdmins: true})
+	budget := func(v float64) *float64 { return &v }
+
+	usage, err := b.Check(ctx, &CurrentUser{UserID: 2, Role: "user", MonthlyBudgetUSD: budget(5)})
+	require.NoError(t, err)
+	assert.InDelta(t, 3, usage.SpentUSD, 1e-9)
+	assert.InDelta(t, 2, *usage.RemainingUSD, 1e-9)
+
+	usage, err = b.Check(ctx, &CurrentUser{UserID: 2, Role: "user", MonthlyBudgetUSD: budget(3)})
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+	assert.InDelta(t, 0, *usage.RemainingUSD, 1e-9)
+
+	usage, err = b.Check(ctx, &CurrentUser{UserID: 2, Role: "user"})
+	require.NoError(t, err)
+	assert.Nil(t, usage, "no budget, no query")
+
+	_, err = b.Check(ctx, &CurrentUser{UserID: 1, Role: "admin", MonthlyBudgetUSD: budget(1)})
+	require.NoError(t, err, "admins are exempt")
+
+	b = NewBudgetService(logs, config.BudgetConfig{ExemptAdmins: false})
+	_, err = b.Check(ctx, &CurrentUser{UserID: 1, Role: "admin", MonthlyBudgetUSD: budget(1)})
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+}
+
+func TestBudgetService_SpendSurvivesLogPruning(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	logs := repository.NewRequestLogRepositoryImpl(db, zap.NewNop())
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b"} {
+		_, err := logs.Insert(ctx, &models.RequestLogEntry{RequestID: id, UserID: 2, ModelName: "m", Cost: 2, Success: true})
+		require.NoError(t, err)
+	}
+	_, err := logs.DeleteOlderThan(ctx, time.Now().Add(time.Hour), 1)
+	require.NoError(t, err)
+	_, err = logs.Delete(ctx, nil, nil, nil, nil)
+	require.NoError(t, err)
+	count, err := logs.Count(ctx, nil, nil, nil, nil)
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	budget := 3.0
+	b := NewBudgetService(logs, config.BudgetConfig{})
+	usage, err := b.Check(ctx, &CurrentUser{UserID: 2, Role: "user", MonthlyBudgetUSD: &budget})
+	assert.ErrorIs(t, err, ErrBudgetExceeded, "pruned logs still count against the budget")
+	assert.InDelta(t, 4, usage.SpentUSD, 1e-9)
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+// proxyBufferedStream serves a streaming request with a non-streaming
+// upstream call and replays the response as the SSE events a streaming call
+// would have produced. Retries and metadata follow ProxyRequest.
+func (s *ProxyService) proxyBufferedStream(
+	ctx context.Context,
+	req *models.AnthropicRequest,
+	originalHeaders http.Header,
+	selection *EndpointSelectionResult,
+	endpoints []*models.Endpoint,
+) (<-chan StreamChunk, *ProxyMetadata, error) {
+	upstreamReq := *req
+	upstreamReq.Stream = false
+	resp, meta, err := s.proxyRequest(ctx, &upstreamReq, originalHeaders, selection, endpoints)
+	if err != nil {
+		return nil, meta, err
+	}
+	meta.Stream = true
+	meta.StatusCode = http.StatusOK
+	meta.Success = true
+
+	lines := synthesizeSSE(resp)
+	chunkChan := make(chan StreamChunk, len(lines)+1)
+	for _, line := range lines {
+		chunkChan <- StreamChunk{Data: line}
+	}
+	finalMeta := *meta
+	chunkChan <- StreamChunk{Done: true, Meta: &finalMeta}
+	close(chunkChan)
+
+	s.logger.Debug("served streaming request from a buffered upstream call",
+		zap.String("request_id", meta.RequestID),
+		zap.Int("max_tokens", req.MaxTokens))
+	return chunkChan, meta, nil
+}
+
+// synthesizeSSE renders a complete response as the lines of an Anthropic SSE
+// stream, one line per slice so line-based translators see upstream framing.
+// Each content block is sent as a single delta.
+func synthesizeSSE(resp *models.AnthropicResponse) [][]byte {
+	var lines [][]byte
+	emit := func(event string, data any) {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return
+		}
+		lines = append(lines,
+			[]byte("event: "+event+"\n"),
+			append(append([]byte("data: "), b...), '\n'),
+			[]byte("\n"))
+	}
+
+	startUsage := resp.Usage
+	startUsage.OutputTokens = 0
+	emit("message_start", map[string]any{
+		"type": "message_start",
+		"message": map[string]any{
+			"id":            resp.ID,
+			"type":          "message",
+			"role":          "assistant",
+			"model":         resp.Model,
+			"content":       []any{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         startUsage,
+		},
+	})
+
+	for i, part := range resp.Content {
+		block, delta := sseContentBlock(part)
+		emit("content_block_start", map[string]any{"type": "content_block_start", "index": i, "content_block": block})
+		if delta != nil {
+			emit("content_block_delta", map[string]any{"type": "content_block_delta", "index": i, "delta": delta})
+		}
+		emit("content_block_stop", map[string]any{"type": "content_block_stop", "index": i})
+	}
+
+	var stopSequence any
+	if resp.StopSequence != "" {
+		stopSequence = resp.StopSequence
+	}
+	emit("message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": resp.StopReason, "stop_sequence": stopSequence},
+		"usage": map[string]any{"output_tokens": resp.Usage.OutputTokens},
+	})
+	emit("message_stop", map[string]any{"type": "message_stop"})
+	return lines
+}
+
+// sseContentBlock splits a content block into its empty content_block_start
+// form and the delta carrying its content. Block types without a delta form
+// are sent whole in content_block_start.
+func sseContentBlock(part models.ContentPart) (block, delta any) {
+	switch part.Type {
+	case "text":
+		return map[string]any{"type": "text", "text": ""},
+			map[string]any{"type": "text_delta", "text": part.Text}
+	case "thinking":
+		return map[string]any{"type": "thinking", "thinking": ""},
+			map[string]any{"type": "thinking_delta", "thinking": part.Thinking}
+	case "tool_use":
+		input, err := json.Marshal(part.Input)
+		if err != nil || part.Input == nil {
+			input = []byte("{}")
+		}
+		return map[string]any{"type": "tool_use", "id": part.ID, "name": part.Name, "input": map[string]any{}},
+			map[string]any{"type": "input_json_delta", "partial_json": string(input)}
+	default:
+		return part, nil
+	}
+}
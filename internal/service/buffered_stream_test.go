@@ -0,0 +1,136 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestProxyService_BufferedStream(t *testing.T) {
+	var upstreamStream bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req models.AnthropicRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		upstreamStream = req.Stream
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.AnthropicResponse{
+			ID:   "msg_1",
+			Type: "message",
+			Role: "assistant",
+			Content: []models.ContentPart{
+				{Type: "text", Text: "Hello"},
+				{Type: "tool_use", ID: "tu_1", Name: "lookup", Input: map[string]any{"q": "x"}},
+			},
+			Model:      "claude-3-sonnet-20240229",
+			StopReason: "tool_use",
+			Usage:      models.Usage{InputTokens: 12, OutputTokens: 7},
+		})
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	ps.SetBufferedStreamMaxTokens(256)
+
+	ep := createProxyTestEndpoint(upstream.URL)
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+	req := &models.AnthropicRequest{
+		Model:     ep.Model.Name,
+		MaxTokens: 100,
+		Stream:    true,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: ep.Model.Role}
+
+	chunks, meta, err := ps.ProxyStreamRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+	require.NoError(t, err)
+	assert.True(t, meta.Stream)
+	assert.False(t, upstreamStream)
+	assert.True(t, req.Stream, "client request must not be modified")
+
+	var framer SSEFramer
+	var events []map[string]any
+	var finalMeta *ProxyMetadata
+	for chunk := range chunks {
+		if chunk.Done {
+			finalMeta = chunk.Meta
+			continue
+		}
+		for _, ev := range framer.Write(chunk.Data) {
+			lines := strings.Split(strings.TrimSpace(string(ev)), "\n")
+			require.Len(t, lines, 2)
+			require.True(t, strings.HasPrefix(lines[0], "event: "))
+			var data map[string]any
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &data))
+			assert.Equal(t, strings.TrimPrefix(lines[0], "event: "), data["type"])
+			events = append(events, data)
+		}
+	}
+	assert.Nil(t, framer.Flush())
+
+	var types []string
+	for _, ev := range events {
+		types = append(types, ev["type"].(string))
+	}
+	assert.Equal(t, []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}, types)
+	assert.Equal(t, "Hello", events[2]["delta"].(map[string]any)["text"])
+	assert.JSONEq(t, `{"q":"x"}`, events[5]["delta"].(map[string]any)["partial_json"].(string))
+	assert.Equal(t, "tool_use", events[7]["delta"].(map[string]any)["stop_reason"])
+
+	require.NotNil(t, finalMeta)
+	assert.True(t, finalMeta.Success)
+	assert.True(t, finalMeta.Stream)
+	assert.Equal(t, 12, finalMeta.InputTokens)
+	assert.Equal(t, 7, finalMeta.OutputTokens)
+}
+
+func TestProxyService_BufferedStream_AboveThreshold(t *testing.T) {
+	var upstreamStream bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req models.AnthropicRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		upstreamStream = req.Stream
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	ps.SetBufferedStreamMaxTokens(256)
+
+	ep := createProxyTestEndpoint(upstream.URL)
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+	req := &models.AnthropicRequest{
+		Model:     ep.Model.Name,
+		MaxTokens: 1024,
+		Stream:    true,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: ep.Model.Role}
+
+	chunks, _, err := ps.ProxyStreamRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+	require.NoError(t, err)
+	for range chunks {
+	}
+	assert.True(t, upstreamStream)
+}
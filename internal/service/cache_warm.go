@@ -0,0 +1,337 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	// cacheWarmScanLimit bounds the request logs read per warm-up.
+	cacheWarmScanLimit = 2000
+	// cacheWarmDefaultLimit is the number of distinct messages warmed when the
+	// request does not say.
+	cacheWarmDefaultLimit = 200
+	// cacheWarmDefaultDays is how far back logs are read when the request
+	// does not say.
+	cacheWarmDefaultDays = 7
+	// cacheWarmReason is the reason stored with L2 entries whose log carried
+	// none.
+	cacheWarmReason = "warmed from request logs"
+)
+
+var (
+	// ErrCacheWarmRunning is returned when a warm-up is already in progress.
+	ErrCacheWarmRunning = errors.New("cache warm-up already in progress")
+	// ErrRoutingCacheDisabled is returned when the routing cache is turned
+	// off, so warming it would have no effect.
+	ErrRoutingCacheDisabled = errors.New("routing cache is disabled")
+)
+
+// CacheWarmRequest selects the request logs a warm-up reads.
+type CacheWarmRequest struct {
+	Days  int `json:"days"`  // Read logs from the last N days; 0 = 7
+	Limit int `json:"limit"` // Warm at most N distinct messages, most frequent first; 0 = 200
+}
+
+// CacheWarmTask reports the state of a cache warm-up.
+type CacheWarmTask struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"` // pending/running/completed/failed
+	Stage      string     `json:"stage"`
+	Scanned    int        `json:"scanned"`   // Logs read
+	Total      int        `json:"total"`     // Distinct messages selected for warming
+	Processed  int        `json:"processed"` // Messages handled so far
+	Warmed     int        `json:"warmed"`    // Messages put into the caches
+	RuleRouted int        `json:"rule_routed"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// CacheWarmer pre-populates the L1 and L2 routing caches from recent request
+// logs, so a restarted proxy does not pay the routing model for every message
+// it has already seen. Messages the current rules match are skipped, since
+// rules are evaluated before the caches; the others are cached with the task
+// type their log recorded, so warming never calls the routing model. Entries
+// already in L2 are left as they are, which makes re-running safe.
+type CacheWarmer struct {
+	logRepo       repository.RequestLogRepository
+	ruleRepo      repository.RoutingRuleRepository
+	configRepo    *repository.RoutingConfigRepository
+	embeddingRepo *repository.EmbeddingCacheRepository
+	routingCache  *RoutingCache
+	embedder      Embedder // Embeds new L2 entries for the semantic lookup; nil = exact match only
+	roles         *RoleSet // Known task-type roles; nil = builtin roles only
+	logger        *zap.Logger
+	now           func() time.Time
+
+	mu    sync.RWMutex
+	tasks map[string]*CacheWarmTask
+}
+
+// NewCacheWarmer creates a new CacheWarmer.
+func NewCacheWarmer(
+	logRepo repository.RequestLogRepository,
+	ruleRepo repository.RoutingRuleRepository,
+	configRepo *repository.RoutingConfigRepository,
+	embeddingRepo *repository.EmbeddingCacheRepository,
+	routingCache *RoutingCache,
+	embedder Embedder,
+	logger *zap.Logger,
+) *CacheWarmer {
+	return &CacheWarmer{
+		logRepo:       logRepo,
+		ruleRepo:      ruleRepo,
+		configRepo:    configRepo,
+		embeddingRepo: embeddingRepo,
+		routingCache:  routingCache,
+		embedder:      embedder,
+		logger:        logger,
+		now:           time.Now,
+		tasks:         make(map[string]*CacheWarmTask),
+	}
+}
+
+// SetRoleSet sets the roles logged task types are checked against (nil
+// means the builtin roles only).
+func (w *CacheWarmer) SetRoleSet(rs *RoleSet) {
+	w.roles = rs
+}
+
+// StartWarm launches an async warm-up and returns its task ID.
+func (w *CacheWarmer) StartWarm(ctx context.Context, req CacheWarmRequest) (string, error) {
+	w.mu.RLock()
+	for _, t := range w.tasks {
+		if t.Status == "pending" || t.Status == "running" {
+			w.mu.RUnlock()
+			return "", fmt.Errorf("%w (task %s)", ErrCacheWarmRunning, t.ID)
+		}
+	}
+	w.mu.RUnlock()
+
+	cfg, err := w.configRepo.GetConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("load routing config: %w", err)
+	}
+	if !cfg.CacheEnabled {
+		return "", ErrRoutingCacheDisabled
+	}
+
+	taskID := fmt.Sprintf("cache-warm-%d", w.now().UnixMilli())
+	w.mu.Lock()
+	w.tasks[taskID] = &CacheWarmTask{
+		ID:        taskID,
+		Status:    "pending",
+		Stage:     "initializing",
+		CreatedAt: w.now(),
+	}
+	w.mu.Unlock()
+
+	go w.run(taskID, req, cfg)
+	return taskID, nil
+}
+
+// GetTask returns the current state of a warm-up task.
+func (w *CacheWarmer) GetTask(taskID string) *CacheWarmTask {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	t, ok := w.tasks[taskID]
+	if !ok {
+		return nil
+	}
+	snapshot := *t
+	return &snapshot
+}
+
+func (w *CacheWarmer) updateTask(taskID string, fn func(t *CacheWarmTask)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if t, ok := w.tasks[taskID]; ok {
+		fn(t)
+	}
+}
+
+func (w *CacheWarmer) run(taskID string, req CacheWarmRequest, cfg *models.RoutingConfig) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	err := w.warm(ctx, taskID, req, cfg)
+	now := w.now()
+	var task CacheWarmTask
+	w.updateTask(taskID, func(t *CacheWarmTask) {
+		t.FinishedAt = &now
+		if err != nil {
+			t.Status = "failed"
+			t.Error = err.Error()
+		} else {
+			t.Status = "completed"
+			t.Stage = "done"
+		}
+		task = *t
+	})
+
+	if err != nil {
+		w.logger.Error("cache warm-up failed", zap.String("task_id", taskID), zap.Error(err))
+		return
+	}
+	w.logger.Info("cache warm-up completed",
+		zap.String("task_id", taskID),
+		zap.Int("warmed", task.Warmed),
+		zap.Int("rule_routed", task.RuleRouted))
+}
+
+// warmCandidate is a distinct user message seen in the logs.
+type warmCandidate struct {
+	key      string
+	message  string
+	taskType string // From the newest log carrying the message
+	reason   string
+	count    int
+}
+
+func (w *CacheWarmer) warm(ctx context.Context, taskID string, req CacheWarmRequest, cfg *models.RoutingConfig) error {
+	w.updateTask(taskID, func(t *CacheWarmTask) {
+		t.Status = "running"
+		t.Stage = "collecting_logs"
+	})
+
+	days := req.Days
+	if days <= 0 {
+		days = cacheWarmDefaultDays
+	}
+	since := w.now().AddDate(0, 0, -days)
+	logs, err := w.logRepo.ListForAnalysis(ctx, &since, nil, cacheWarmScanLimit)
+	if err != nil {
+		return fmt.Errorf("collect logs: %w", err)
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = cacheWarmDefaultLimit
+	}
+	candidates := warmCandidates(logs, limit)
+	w.updateTask(taskID, func(t *CacheWarmTask) {
+		t.Stage = "warming"
+		t.Scanned = len(logs)
+		t.Total = len(candidates)
+	})
+
+	var classifier *RoutingClassifier
+	if cfg.RuleBasedRoutingEnabled {
+		rules, err := w.ruleRepo.ListRules(ctx, true)
+		if err != nil {
+			return fmt.Errorf("load routing rules: %w", err)
+		}
+		classifier = NewRoutingClassifier(rules)
+	}
+
+	for _, cand := range candidates {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		warmed, err := w.warmOne(ctx, cfg, classifier, cand)
+		if err != nil {
+			return err
+		}
+		w.updateTask(taskID, func(t *CacheWarmTask) {
+			t.Processed++
+			if warmed {
+				t.Warmed++
+			} else {
+				t.RuleRouted++
+			}
+		})
+	}
+	return nil
+}
+
+// warmOne caches one message. It reports false when a rule routes the
+// message, in which case the caches would never be consulted for it.
+func (w *CacheWarmer) warmOne(ctx context.Context, cfg *models.RoutingConfig, classifier *RoutingClassifier, cand *warmCandidate) (bool, error) {
+	if classifier != nil && classifier.Classify(cand.message).Rule != nil {
+		return false, nil
+	}
+
+	taskType := w.roles.Parse(cand.taskType)
+	w.routingCache.Set(cand.key, taskType)
+
+	existing, err := w.embeddingRepo.GetExactMatch(ctx, cand.key, cfg.CacheTTLSeconds)
+	if err != nil {
+		return false, err
+	}
+	if existing != nil {
+		return true, nil
+	}
+
+	preview := routingCachePreview(cand.message)
+	var embedding []float64
+	if cfg.SemanticCacheEnabled && w.embedder != nil {
+		embedding, err = w.embedder.GetEmbedding(ctx, preview)
+		if err != nil {
+			w.logger.Debug("embedding warmed cache entry failed", zap.Error(err))
+			embedding = nil
+		}
+	}
+	reason := cand.reason
+	if reason == "" {
+		reason = cacheWarmReason
+	}
+	if err := w.embeddingRepo.SaveCache(ctx, cand.key, preview, embedding, string(taskType), reason); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// warmCandidates groups logs by routing cache key and returns up to limit
+// distinct messages, most frequent first. Only logs whose decision came from
+// the routing model or a cache, and which were not marked inaccurate, are
+// used; logs without stored request content cannot be replayed.
+func warmCandidates(logs []*models.RequestLog, limit int) []*warmCandidate {
+	byKey := make(map[string]*warmCandidate)
+	var order []*warmCandidate
+	for _, log := range logs {
+		if log.IsInaccurate || log.RequestContent == "" || !cacheableRoutingMethod(log.RoutingMethod) {
+			continue
+		}
+		var req models.AnthropicRequest
+		if err := json.Unmarshal([]byte(log.RequestContent), &req); err != nil {
+			continue
+		}
+		message := extractLastUserMessage(&req)
+		if message == "" {
+			continue
+		}
+		key := GetCacheKey("", message)
+		if cand, ok := byKey[key]; ok {
+			cand.count++
+			continue
+		}
+		cand := &warmCandidate{key: key, message: message, taskType: log.TaskType, reason: log.RoutingReason, count: 1}
+		byKey[key] = cand
+		order = append(order, cand)
+	}
+
+	// Logs arrive newest first; the stable sort keeps that order among
+	// messages seen equally often.
+	sort.SliceStable(order, func(i, j int) bool { return order[i].count > order[j].count })
+	if len(order) > limit {
+		order = order[:limit]
+	}
+	return order
+}
+
+// cacheableRoutingMethod reports whether a logged routing decision is one
+// the router would have cached: a routing model answer or a cache hit.
+func cacheableRoutingMethod(method string) bool {
+	return method == "llm" || strings.HasPrefix(method, "cache_")
+}
@@ -0,0 +1,133 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+var warmLogSeq atomic.Int64
+
+func insertWarmLog(t *testing.T, repo repository.RequestLogRepository, message, method, taskType string, inaccurate bool) {
+	t.Helper()
+	content, err := json.Marshal(models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: message}}},
+	})
+	require.NoError(t, err)
+	_, err = repo.Insert(context.Background(), &models.RequestLogEntry{
+		RequestID:      fmt.Sprintf("warm-%d", warmLogSeq.Add(1)),
+		ModelName:      "claude-3-sonnet",
+		TaskType:       taskType,
+		Success:        true,
+		RequestContent: string(content),
+		RoutingMethod:  method,
+		RoutingReason:  "classified by routing model",
+		IsInaccurate:   inaccurate,
+	})
+	require.NoError(t, err)
+}
+
+func waitForWarm(t *testing.T, w *CacheWarmer, taskID string) *CacheWarmTask {
+	t.Helper()
+	var task *CacheWarmTask
+	require.Eventually(t, func() bool {
+		task = w.GetTask(taskID)
+		return task != nil && (task.Status == "completed" || task.Status == "failed")
+	}, 5*time.Second, 10*time.Millisecond)
+	return task
+}
+
+func TestCacheWarmer_WarmsFromLogs(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	logger := zap.NewNop()
+	ctx := context.Background()
+	logRepo := repository.NewRequestLogRepositoryImpl(db, logger, nil)
+	ruleRepo := repository.NewRoutingRuleRepository(db, logger)
+	embeddingRepo := repository.NewEmbeddingCacheRepository(db, logger)
+	cache := NewRoutingCache(100, logger)
+
+	_, err := ruleRepo.AddRule(ctx, &models.RoutingRule{Name: "deploys", Keywords: []string{"deploy"}, TaskType: "simple", Enabled: true})
+	require.NoError(t, err)
+
+	for range 3 {
+		insertWarmLog(t, logRepo, "summarize the quarterly report", "llm", "complex", false)
+	}
+	insertWarmLog(t, logRepo, "translate hello into french", "cache_l2", "simple", false)
+	insertWarmLog(t, logRepo, "please deploy the service", "llm", "complex", false)
+	insertWarmLog(t, logRepo, "was routed wrongly", "llm", "complex", true)
+	insertWarmLog(t, logRepo, "fell back", "fallback", "default", false)
+
+	// An entry already in L2 is kept rather than overwritten.
+	existingKey := GetCacheKey("", "translate hello into french")
+	require.NoError(t, embeddingRepo.SaveCache(ctx, existingKey, "translate hello into french", nil, "complex", "manual"))
+
+	w := NewCacheWarmer(logRepo, ruleRepo, repository.NewRoutingConfigRepository(db, logger), embeddingRepo, cache, fakeEmbedder{dim: 3}, logger)
+	taskID, err := w.StartWarm(ctx, CacheWarmRequest{})
+	require.NoError(t, err)
+	task := waitForWarm(t, w, taskID)
+	require.Equal(t, "completed", task.Status, task.Error)
+	assert.Equal(t, 7, task.Scanned)
+	assert.Equal(t, 3, task.Total)
+	assert.Equal(t, 3, task.Processed)
+	assert.Equal(t, 2, task.Warmed)
+	assert.Equal(t, 1, task.RuleRouted)
+
+	key := GetCacheKey("", "summarize the quarterly report")
+	role, hit := cache.Get(key, 300)
+	assert.True(t, hit)
+	assert.Equal(t, models.ModelRoleComplex, role)
+	entry, err := embeddingRepo.GetExactMatch(ctx, key, 300)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	assert.Equal(t, "complex", entry.TaskType)
+	assert.Equal(t, "classified by routing model", entry.Reason)
+	assert.Len(t, entry.Embedding, 3)
+
+	existing, err := embeddingRepo.GetExactMatch(ctx, existingKey, 300)
+	require.NoError(t, err)
+	assert.Equal(t, "manual", existing.Reason)
+
+	_, hit = cache.Get(GetCacheKey("", "please deploy the service"), 300)
+	assert.False(t, hit, "rule-routed messages never reach the cache")
+	_, hit = cache.Get(GetCacheKey("", "was routed wrongly"), 300)
+	assert.False(t, hit, "inaccurate decisions are not replayed")
+
+	// Re-running adds nothing new.
+	count, err := embeddingRepo.Count(ctx)
+	require.NoError(t, err)
+	taskID, err = w.StartWarm(ctx, CacheWarmRequest{Limit: 1})
+	require.NoError(t, err)
+	task = waitForWarm(t, w, taskID)
+	assert.Equal(t, "completed", task.Status)
+	assert.Equal(t, 1, task.Total, "only the most frequent message")
+	after, err := embeddingRepo.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, count, after)
+}
+
+func TestCacheWarmer_RoutingCacheDisabled(t *testing.T) {
+	db := testutil.NewTestDBWithDefaults(t)
+	logger := zap.NewNop()
+	configRepo := repository.NewRoutingConfigRepository(db, logger)
+	require.NoError(t, configRepo.UpdateConfig(context.Background(), map[string]any{"cache_enabled": false}))
+
+	w := NewCacheWarmer(repository.NewRequestLogRepositoryImpl(db, logger, nil), repository.NewRoutingRuleRepository(db, logger),
+		configRepo, repository.NewEmbeddingCacheRepository(db, logger), NewRoutingCache(100, logger), nil, logger)
+	_, err := w.StartWarm(context.Background(), CacheWarmRequest{})
+	assert.ErrorIs(t, err, ErrRoutingCacheDisabled)
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// cachedConfig caches settings read from system config for a short TTL. The
+// lock is held only to read or swap the cached value: once it expires, one
+// caller reloads it while concurrent callers keep using the previous value.
+// On a load error the previous value stays in use until the TTL expires
+// again.
+type cachedConfig[T any] struct {
+	name   string // Used in the load error log
+	load   func(ctx context.Context) (*T, error)
+	ttl    time.Duration
+	logger *zap.Logger
+	// onChange, if set, is called by the reloading caller with the previous
+	// and the new value after each successful load.
+	onChange func(old, cur T)
+
+	mu         sync.Mutex
+	cfg        T
+	loadedAt   time.Time
+	generation int // Bumped by invalidate, so a load started before it does not count as fresh
+	loading    atomic.Bool
+}
+
+func newCachedConfig[T any](name string, ttl time.Duration, load func(ctx context.Context) (*T, error), logger *zap.Logger) *cachedConfig[T] {
+	return &cachedConfig[T]{name: name, load: load, ttl: ttl, logger: logger}
+}
+
+// get returns the cached value, reloading it first if it expired and no
+// other caller is already reloading it.
+func (c *cachedConfig[T]) get() T {
+	c.mu.Lock()
+	cfg, fresh, generation := c.cfg, time.Since(c.loadedAt) < c.ttl, c.generation
+	c.mu.Unlock()
+	if fresh || !c.loading.CompareAndSwap(false, true) {
+		return cfg
+	}
+	defer c.loading.Store(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	loaded, err := c.load(ctx)
+
+	c.mu.Lock()
+	old := c.cfg
+	if err == nil {
+		c.cfg = *loaded
+	}
+	if c.generation == generation {
+		c.loadedAt = time.Now()
+	}
+	cfg = c.cfg
+	c.mu.Unlock()
+
+	if err != nil {
+		c.logger.Warn("failed to load "+c.name, zap.Error(err))
+	} else if c.onChange != nil {
+		c.onChange(old, cfg)
+	}
+	return cfg
+}
+
+// invalidate makes the next get reload the value.
+func (c *cachedConfig[T]) invalidate() {
+	c.mu.Lock()
+	c.loadedAt = time.Time{}
+	c.generation++
+	c.mu.Unlock()
+}
@@ -0,0 +1,43 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestCachedConfig(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	c := newCachedConfig("test config", time.Hour, func(ctx context.Context) (*int, error) {
+		n := int(loads.Add(1))
+		if n == 2 {
+			<-release
+		}
+		return &n, nil
+	}, zap.NewNop())
+
+	assert.Equal(t, 1, c.get(), "first get loads")
+	assert.Equal(t, 1, c.get(), "cached within the TTL")
+
+	// While one caller reloads, others get the previous value at once.
+	c.invalidate()
+	done := make(chan int)
+	go func() { done <- c.get() }()
+	assert.Eventually(t, func() bool { return loads.Load() == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, 1, c.get())
+
+	// Invalidating during a load makes the next get reload again.
+	c.invalidate()
+	close(release)
+	assert.Equal(t, 2, <-done)
+	assert.Equal(t, 3, c.get())
+	assert.Equal(t, 3, c.get())
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// CircuitState is the state of an endpoint's circuit breaker.
+type CircuitState string
+
+const (
+	// CircuitClosed lets all traffic through.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen rejects traffic until the cooldown elapses.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single probe request through; its outcome closes
+	// or re-opens the breaker.
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// circuitBreaker trips after consecutive request failures so live traffic
+// stops hitting a failing endpoint before the next periodic health check.
+// It is guarded by the owning EndpointState's mutex.
+type circuitBreaker struct {
+	open                bool
+	consecutiveFailures int
+	openedAt            time.Time
+	probeStartedAt      time.Time // Zero when no half-open probe is in flight
+	trips               int
+}
+
+func (b *circuitBreaker) state(now time.Time, cooldown time.Duration) CircuitState {
+	if !b.open {
+		return CircuitClosed
+	}
+	if now.Sub(b.openedAt) >= cooldown {
+		return CircuitHalfOpen
+	}
+	return CircuitOpen
+}
+
+// allows reports whether a request may be sent. In half-open state only one
+// probe is admitted; a probe that never reports back is abandoned after
+// another cooldown so the breaker cannot wedge.
+func (b *circuitBreaker) allows(now time.Time, cooldown time.Duration) bool {
+	switch b.state(now, cooldown) {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		return b.probeStartedAt.IsZero() || now.Sub(b.probeStartedAt) >= cooldown
+	}
+	return true
+}
+
+// admit reports whether a request may be sent and, in half-open state,
+// claims the single probe for it in the same step, so concurrent requests
+// cannot all pass as the probe.
+func (b *circuitBreaker) admit(now time.Time, cooldown time.Duration) bool {
+	if !b.allows(now, cooldown) {
+		return false
+	}
+	if b.state(now, cooldown) == CircuitHalfOpen {
+		b.probeStartedAt = now
+	}
+	return true
+}
+
+// release ends a half-open probe whose outcome says nothing about the
+// endpoint, e.g. a client error, so the next request can probe instead.
+func (b *circuitBreaker) release() {
+	b.probeStartedAt = time.Time{}
+}
+
+// record feeds a request outcome to the breaker and reports whether it
+// tripped open as a result.
+func (b *circuitBreaker) record(success bool, now time.Time, threshold int) bool {
+	if success {
+		b.open = false
+		b.consecutiveFailures = 0
+		b.probeStartedAt = time.Time{}
+		return false
+	}
+	b.consecutiveFailures++
+	if b.open {
+		// A failed probe (or a straggler) restarts the cooldown.
+		b.openedAt = now
+		b.probeStartedAt = time.Time{}
+		return false
+	}
+	if threshold > 0 && b.consecutiveFailures >= threshold {
+		b.open = true
+		b.openedAt = now
+		b.trips++
+		return true
+	}
+	return false
+}
+
+// endpointFault reports whether a failed request reflects on the endpoint's
+// health: server errors, rate limiting and overload, timeouts and transport
+// errors. Client errors (400, 404, 413, 422, ...) and client cancellations
+// do not, so one bad client cannot open the circuit for everyone.
+func endpointFault(err error) bool {
+	var ue *UpstreamError
+	switch {
+	case errors.As(err, &ue):
+		code := ue.StatusCode
+		return code >= 500 || code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code == statusOverloaded
+	case errors.Is(err, ErrStreamIdle):
+		return true
+	case errors.Is(err, context.Canceled):
+		return false
+	}
+	return true
+}
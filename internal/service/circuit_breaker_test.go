@@ -0,0 +1,172 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+func newBreakerTestChecker(t *testing.T, eps []*models.Endpoint) *HealthChecker {
+	t.Helper()
+	hc := NewHealthChecker(config.HealthCheckConfig{
+		CircuitBreakerThreshold:       3,
+		CircuitBreakerCooldownSeconds: 30,
+	}, zap.NewNop())
+	registerHealthyEndpoints(hc, eps)
+	return hc
+}
+
+// expireCooldown moves the breaker's open time past the cooldown window.
+func expireCooldown(hc *HealthChecker, name string) {
+	hc.mu.RLock()
+	state := hc.states[name]
+	hc.mu.RUnlock()
+	state.mu.Lock()
+	state.breaker.openedAt = time.Now().Add(-time.Minute)
+	state.mu.Unlock()
+}
+
+func TestHealthChecker_CircuitBreaker(t *testing.T) {
+	ep := createTestEndpoint("flaky", "claude-sonnet-4", 1)
+	name := EndpointName(ep)
+	hc := newBreakerTestChecker(t, []*models.Endpoint{ep})
+
+	// Failures below the threshold keep the circuit closed; a success resets the streak.
+	hc.UpdateRequestStats(name, false, 10)
+	hc.UpdateRequestStats(name, false, 10)
+	hc.UpdateRequestStats(name, true, 10)
+	hc.UpdateRequestStats(name, false, 10)
+	hc.UpdateRequestStats(name, false, 10)
+	assert.True(t, hc.IsHealthy(name))
+	assert.Equal(t, CircuitClosed, hc.GetState(name).CircuitState)
+
+	// Third consecutive failure trips the breaker.
+	hc.UpdateRequestStats(name, false, 10)
+	assert.False(t, hc.IsHealthy(name))
+	assert.Empty(t, hc.GetHealthyEndpoints([]*models.Endpoint{ep}))
+	state := hc.GetState(name)
+	require.NotNil(t, state)
+	assert.Equal(t, CircuitOpen, state.CircuitState)
+	assert.Equal(t, 3, state.ConsecutiveFailures)
+	assert.Equal(t, 1, state.CircuitTrips)
+	assert.Equal(t, models.EndpointHealthy, state.Status, "breaker does not change probe status")
+
+	// After the cooldown exactly one half-open probe is admitted.
+	expireCooldown(hc, name)
+	assert.Equal(t, CircuitHalfOpen, hc.GetState(name).CircuitState)
+	assert.True(t, hc.IsHealthy(name))
+	require.True(t, hc.BeginRequest(name))
+	assert.False(t, hc.IsHealthy(name), "only one probe while half-open")
+	assert.False(t, hc.BeginRequest(name))
+
+	// A failed probe re-opens the breaker for another cooldown.
+	hc.UpdateRequestStats(name, false, 10)
+	assert.False(t, hc.IsHealthy(name))
+	assert.Equal(t, CircuitOpen, hc.GetState(name).CircuitState)
+
+	// A successful probe closes it.
+	expireCooldown(hc, name)
+	require.True(t, hc.BeginRequest(name))
+	hc.UpdateRequestStats(name, true, 10)
+	assert.True(t, hc.IsHealthy(name))
+	state = hc.GetState(name)
+	assert.Equal(t, CircuitClosed, state.CircuitState)
+	assert.Equal(t, 0, state.ConsecutiveFailures)
+	assert.Equal(t, 1, state.CircuitTrips)
+}
+
+func TestHealthChecker_CircuitBreakerIgnoresClientErrors(t *testing.T) {
+	ep := createTestEndpoint("flaky", "claude-sonnet-4", 1)
+	name := EndpointName(ep)
+	hc := newBreakerTestChecker(t, []*models.Endpoint{ep})
+
+	for _, status := range []int{400, 404, 413, 422} {
+		hc.RecordRequestError(name, &UpstreamError{StatusCode: status}, 10)
+	}
+	hc.RecordRequestError(name, context.Canceled, 10)
+	hc.RecordRequestError(name, fmt.Errorf("upstream request failed: %w", context.Canceled), 10)
+	assert.Equal(t, CircuitClosed, hc.GetState(name).CircuitState)
+	assert.Zero(t, hc.GetState(name).ConsecutiveFailures)
+	assert.Equal(t, 6, hc.GetState(name).TotalErrors, "client errors still count as request errors")
+
+	// Server errors, rate limiting and transport failures trip it.
+	hc.RecordRequestError(name, &UpstreamError{StatusCode: 500}, 10)
+	hc.RecordRequestError(name, &UpstreamError{StatusCode: 429}, 10)
+	hc.RecordRequestError(name, errors.New("connection refused"), 10)
+	assert.Equal(t, CircuitOpen, hc.GetState(name).CircuitState)
+
+	// A client error during the half-open probe frees it for the next request.
+	expireCooldown(hc, name)
+	require.True(t, hc.BeginRequest(name))
+	hc.RecordRequestError(name, &UpstreamError{StatusCode: 400}, 10)
+	assert.Equal(t, CircuitHalfOpen, hc.GetState(name).CircuitState)
+	assert.True(t, hc.BeginRequest(name))
+}
+
+func TestHealthChecker_CircuitBreakerSingleProbe(t *testing.T) {
+	ep := createTestEndpoint("flaky", "claude-sonnet-4", 1)
+	name := EndpointName(ep)
+	hc := newBreakerTestChecker(t, []*models.Endpoint{ep})
+	for i := 0; i < 3; i++ {
+		hc.UpdateRequestStats(name, false, 10)
+	}
+	expireCooldown(hc, name)
+
+	var admitted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if hc.BeginRequest(name) {
+				admitted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), admitted.Load())
+}
+
+func TestHealthChecker_CircuitBreakerDisabled(t *testing.T) {
+	ep := createTestEndpoint("flaky", "claude-sonnet-4", 1)
+	name := EndpointName(ep)
+	hc := NewHealthChecker(config.HealthCheckConfig{}, zap.NewNop())
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+
+	for range 10 {
+		hc.UpdateRequestStats(name, false, 10)
+	}
+	assert.True(t, hc.IsHealthy(name))
+	assert.Equal(t, CircuitClosed, hc.GetState(name).CircuitState)
+}
+
+func TestProxyService_SelectAlternativeSkipsOpenCircuit(t *testing.T) {
+	flaky := createTestEndpoint("flaky", "claude-sonnet-4", 1)
+	stable := createTestEndpoint("stable", "claude-sonnet-4", 1)
+	stable.Model = flaky.Model
+	eps := []*models.Endpoint{flaky, stable}
+	hc := newBreakerTestChecker(t, eps)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, zap.NewNop())
+
+	for range 3 {
+		hc.UpdateRequestStats(EndpointName(flaky), false, 10)
+	}
+	for range 5 {
+		ep := ps.selectAlternativeEndpoint(flaky.Model, eps, map[string]bool{}, nil)
+		require.NotNil(t, ep)
+		assert.Equal(t, "stable", ep.Provider.Name)
+	}
+}
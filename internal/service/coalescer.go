@@ -0,0 +1,92 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// requestCoalescer lets concurrent identical requests share a single upstream
+// call (single-flight). Only successful responses are shared; if the leading
+// call fails, waiting requests go upstream on their own.
+type requestCoalescer struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// coalescedCall is an upstream call in flight that others can wait on.
+type coalescedCall struct {
+	done chan struct{}
+	resp *models.AnthropicResponse
+	meta *ProxyMetadata
+	err  error
+}
+
+func newRequestCoalescer() *requestCoalescer {
+	return &requestCoalescer{calls: make(map[string]*coalescedCall)}
+}
+
+// join returns the in-flight call for key. leader is true when the caller
+// registered the call and must finish it with complete.
+func (c *requestCoalescer) join(key string) (call *coalescedCall, leader bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if call, ok := c.calls[key]; ok {
+		return call, false
+	}
+	call = &coalescedCall{done: make(chan struct{})}
+	c.calls[key] = call
+	return call, true
+}
+
+// complete publishes the leader's result and releases waiting requests.
+// Copies are stored so the leader may keep mutating its own metadata.
+func (c *requestCoalescer) complete(key string, call *coalescedCall, resp *models.AnthropicResponse, meta *ProxyMetadata, err error) {
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.mu.Unlock()
+	call.err = err
+	if err == nil && resp != nil && meta != nil {
+		r, m := *resp, *meta
+		call.resp, call.meta = &r, &m
+	}
+	close(call.done)
+}
+
+// shared returns a follower's copy of a successful call's result. The
+// follower caused no upstream spend, so its cost is zero.
+func (call *coalescedCall) shared(requestID string) (*models.AnthropicResponse, *ProxyMetadata) {
+	r, m := *call.resp, *call.meta
+	m.RequestID = requestID
+	m.Cost = 0
+	m.Coalesced = true
+	return &r, &m
+}
+
+// isCoalescable reports whether a request is deterministic enough to share a
+// response: non-streaming with an explicit temperature of 0.
+func isCoalescable(req *models.AnthropicRequest) bool {
+	return !req.Stream && req.Temperature != nil && *req.Temperature == 0
+}
+
+// coalesceKey hashes the normalized request together with the selected model
+// and the headers that change upstream behavior.
+func coalesceKey(req *models.AnthropicRequest, headers http.Header, model string) (string, bool) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", false
+	}
+	h := sha256.New()
+	h.Write([]byte(model))
+	h.Write([]byte{0})
+	h.Write([]byte(headers.Get("Anthropic-Version")))
+	h.Write([]byte{0})
+	h.Write([]byte(headers.Get("Anthropic-Beta")))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
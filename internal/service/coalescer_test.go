@@ -0,0 +1,161 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestProxyService_ProxyRequest_CoalescesIdenticalRequests(t *testing.T) {
+	var upstreamCalls atomic.Int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.AnthropicResponse{
+			ID:      "msg_shared",
+			Type:    "message",
+			Role:    "assistant",
+			Content: []models.ContentPart{{Type: "text", Text: "42"}},
+			Usage:   models.Usage{InputTokens: 10, OutputTokens: 5},
+		})
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	ps.SetCoalescing(true)
+
+	ep := createProxyTestEndpoint(upstream.URL)
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: ep.Model.Role}
+
+	temperature := 0.0
+	newReq := func() *models.AnthropicRequest {
+		return &models.AnthropicRequest{
+			Model:       "claude-3-sonnet",
+			MaxTokens:   100,
+			Temperature: &temperature,
+			Messages:    []models.Message{{Role: "user", Content: models.MessageContent{Text: "What is 6*7?"}}},
+		}
+	}
+
+	const n = 8
+	var wg sync.WaitGroup
+	resps := make([]*models.AnthropicResponse, n)
+	metas := make([]*ProxyMetadata, n)
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resps[i], metas[i], errs[i] = ps.ProxyRequest(context.Background(), newReq(), http.Header{}, selection, []*models.Endpoint{ep})
+		}()
+	}
+
+	// Hold the upstream call until every request has had time to join it.
+	require.Eventually(t, func() bool { return upstreamCalls.Load() == 1 }, time.Second, 5*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), upstreamCalls.Load())
+	requestIDs := make(map[string]bool)
+	coalesced := 0
+	for i := range n {
+		require.NoError(t, errs[i])
+		assert.Equal(t, "msg_shared", resps[i].ID)
+		assert.Equal(t, 10, metas[i].InputTokens)
+		requestIDs[metas[i].RequestID] = true
+		if metas[i].Coalesced {
+			coalesced++
+			assert.Zero(t, metas[i].Cost)
+		} else {
+			assert.Greater(t, metas[i].Cost, 0.0)
+		}
+	}
+	assert.Equal(t, n-1, coalesced)
+	assert.Len(t, requestIDs, n)
+}
+
+func TestProxyService_ProxyRequest_FailuresNotShared(t *testing.T) {
+	var upstreamCalls atomic.Int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if upstreamCalls.Add(1) == 1 {
+			<-release
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.AnthropicResponse{ID: "msg_retry", Type: "message", Role: "assistant"})
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	ps.SetCoalescing(true)
+
+	ep := createProxyTestEndpoint(upstream.URL)
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: ep.Model.Role}
+
+	temperature := 0.0
+	req := &models.AnthropicRequest{
+		Model:       "claude-3-sonnet",
+		MaxTokens:   100,
+		Temperature: &temperature,
+		Messages:    []models.Message{{Role: "user", Content: models.MessageContent{Text: "hi"}}},
+	}
+
+	var leaderErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _, leaderErr = ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+	}()
+	require.Eventually(t, func() bool { return upstreamCalls.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+	followerDone := make(chan struct{})
+	var followerResp *models.AnthropicResponse
+	var followerErr error
+	go func() {
+		defer close(followerDone)
+		followerResp, _, followerErr = ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	<-done
+	<-followerDone
+
+	require.Error(t, leaderErr)
+	require.NoError(t, followerErr)
+	assert.Equal(t, "msg_retry", followerResp.ID)
+	assert.Equal(t, int32(2), upstreamCalls.Load())
+}
+
+func TestIsCoalescable(t *testing.T) {
+	zero, warm := 0.0, 0.7
+	assert.True(t, isCoalescable(&models.AnthropicRequest{Temperature: &zero}))
+	assert.False(t, isCoalescable(&models.AnthropicRequest{Temperature: &zero, Stream: true}))
+	assert.False(t, isCoalescable(&models.AnthropicRequest{Temperature: &warm}))
+	assert.False(t, isCoalescable(&models.AnthropicRequest{}))
+}
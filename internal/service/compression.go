@@ -0,0 +1,48 @@
+package service
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// upstreamAcceptEncoding is the Accept-Encoding sent with non-streaming
+// upstream requests. Setting it explicitly turns off the transport's own
+// gzip handling, so readResponseBody decodes the body instead.
+const upstreamAcceptEncoding = "gzip, deflate"
+
+// readResponseBody reads resp's body and undoes its Content-Encoding.
+func readResponseBody(resp *http.Response) ([]byte, error) {
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return raw, nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("decode gzip response: %w", err)
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	case "deflate":
+		// "deflate" is meant to be zlib-wrapped, but some servers send raw
+		// deflate data.
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			zr = flate.NewReader(bytes.NewReader(raw))
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("unsupported response content encoding %q", encoding)
+	}
+}
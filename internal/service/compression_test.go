@@ -0,0 +1,102 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+func encodeBody(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		require.NoError(t, err)
+		w = fw
+	default:
+		return body
+	}
+	_, err := w.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestReadResponseBody(t *testing.T) {
+	body := []byte(`{"id":"msg_1","type":"message"}`)
+	for _, tc := range []struct{ header, encoding string }{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"deflate", "raw-deflate"},
+	} {
+		resp := &http.Response{
+			Header: http.Header{"Content-Encoding": []string{tc.header}},
+			Body:   io.NopCloser(bytes.NewReader(encodeBody(t, tc.encoding, body))),
+		}
+		got, err := readResponseBody(resp)
+		require.NoError(t, err, tc.encoding)
+		assert.Equal(t, body, got, tc.encoding)
+	}
+
+	_, err := readResponseBody(&http.Response{
+		Header: http.Header{"Content-Encoding": []string{"br"}},
+		Body:   io.NopCloser(bytes.NewReader(body)),
+	})
+	assert.ErrorContains(t, err, `unsupported response content encoding "br"`)
+}
+
+func TestProxyService_CompressedUpstreamResponse(t *testing.T) {
+	var acceptEncoding string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(encodeBody(t, "gzip", []byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"compressed"}],"usage":{"input_tokens":3,"output_tokens":1}}`)))
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	model := &models.Model{ID: 1, Name: "claude-3-sonnet", Role: models.ModelRoleDefault, Enabled: true}
+	ep := &models.Endpoint{
+		Provider: &models.Provider{ID: 1, Name: "p1", BaseURL: upstream.URL, APIKey: "k", Enabled: true},
+		Model:    model,
+		Status:   models.EndpointHealthy,
+	}
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+
+	resp, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, &EndpointSelectionResult{Endpoint: ep, Model: model, TaskType: model.Role}, []*models.Endpoint{ep})
+	require.NoError(t, err)
+	assert.Equal(t, "gzip, deflate", acceptEncoding)
+	assert.Equal(t, "compressed", resp.Content[0].Text)
+	assert.Equal(t, 3, meta.InputTokens)
+}
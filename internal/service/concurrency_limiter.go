@@ -0,0 +1,176 @@
+package service
+
+import "sync"
+
+// ConcurrencySnapshot reports the concurrency limiter's state.
+type ConcurrencySnapshot struct {
+	Enabled         bool  `json:"enabled"`
+	MaxRequests     int   `json:"max_requests"` // 0 = unlimited
+	MaxStreams      int   `json:"max_streams"`  // 0 = streams share MaxRequests
+	InFlight        int   `json:"in_flight"`    // Streaming, non-streaming and not yet classified
+	InFlightStreams int   `json:"in_flight_streams"`
+	Rejected        int64 `json:"rejected"` // Since start
+}
+
+// ConcurrencyLimiter caps the proxy requests in flight across all clients,
+// so a burst cannot exhaust file descriptors or upstream quotas. Requests
+// over the limit are rejected rather than queued. With a stream limit,
+// streaming requests get their own budget and the request limit applies to
+// non-streaming requests only; otherwise both share the request limit.
+//
+// Whether a request streams is only known once its body is parsed, so a
+// request is first admitted against the combined budget and classified
+// later, when the per-kind limit is checked.
+//
+// A nil *ConcurrencyLimiter admits every request.
+type ConcurrencyLimiter struct {
+	maxRequests int
+	maxStreams  int
+
+	mu       sync.Mutex
+	requests int // Non-streaming requests in flight
+	streams  int
+	pending  int // Admitted, not yet classified
+	rejected int64
+}
+
+// ConcurrencySlot is an admitted request's place in a ConcurrencyLimiter.
+// A nil *ConcurrencySlot belongs to no limiter.
+type ConcurrencySlot struct {
+	l        *ConcurrencyLimiter
+	kind     slotKind // Guarded by l.mu
+	released bool
+}
+
+type slotKind int
+
+const (
+	slotPending slotKind = iota
+	slotRequest
+	slotStream
+)
+
+// NewConcurrencyLimiter creates a limiter. It returns nil, i.e. unlimited,
+// when both limits are 0.
+func NewConcurrencyLimiter(maxRequests, maxStreams int) *ConcurrencyLimiter {
+	if maxRequests <= 0 && maxStreams <= 0 {
+		return nil
+	}
+	return &ConcurrencyLimiter{maxRequests: maxRequests, maxStreams: maxStreams}
+}
+
+// Admit takes a slot for a request of either kind. It reports false when
+// the combined limit is reached; otherwise the slot must be released once
+// the request is done.
+func (l *ConcurrencyLimiter) Admit() (*ConcurrencySlot, bool) {
+	if l == nil {
+		return nil, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.admitsAny() {
+		l.rejected++
+		return nil, false
+	}
+	l.pending++
+	return &ConcurrencySlot{l: l}, true
+}
+
+// Classify counts the slot as a streaming or non-streaming request. It
+// reports false, leaving the slot to be released, when that kind's limit is
+// reached. Classifying a slot again is harmless.
+func (s *ConcurrencySlot) Classify(stream bool) bool {
+	if s == nil {
+		return true
+	}
+	l := s.l
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if s.released || s.kind != slotPending {
+		return true
+	}
+	if !l.admits(stream) {
+		l.rejected++
+		return false
+	}
+	l.pending--
+	if stream {
+		s.kind = slotStream
+		l.streams++
+	} else {
+		s.kind = slotRequest
+		l.requests++
+	}
+	return true
+}
+
+// Release frees the slot. Calling it more than once is harmless.
+func (s *ConcurrencySlot) Release() {
+	if s == nil {
+		return
+	}
+	l := s.l
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if s.released {
+		return
+	}
+	s.released = true
+	switch s.kind {
+	case slotStream:
+		l.streams--
+	case slotRequest:
+		l.requests--
+	default:
+		l.pending--
+	}
+}
+
+// admitsAny reports whether a request of not yet known kind fits the
+// combined limit. l.mu must be held.
+func (l *ConcurrencyLimiter) admitsAny() bool {
+	inFlight := l.requests + l.streams + l.pending
+	switch {
+	case l.maxRequests <= 0:
+		return true // Only streams are limited, which Classify checks
+	case l.maxStreams > 0:
+		return inFlight < l.maxRequests+l.maxStreams
+	default:
+		return inFlight < l.maxRequests
+	}
+}
+
+// admits reports whether a classified request fits the limits. Slots still
+// pending already fit the combined limit. l.mu must be held.
+func (l *ConcurrencyLimiter) admits(stream bool) bool {
+	switch {
+	case stream && l.maxStreams > 0:
+		return l.streams < l.maxStreams
+	case l.maxRequests <= 0:
+		return true
+	case l.maxStreams > 0:
+		return l.requests < l.maxRequests
+	default:
+		return true
+	}
+}
+
+// Snapshot returns the limits and the requests in flight.
+func (l *ConcurrencyLimiter) Snapshot() ConcurrencySnapshot {
+	if l == nil {
+		return ConcurrencySnapshot{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return ConcurrencySnapshot{
+		Enabled:         true,
+		MaxRequests:     l.maxRequests,
+		MaxStreams:      l.maxStreams,
+		InFlight:        l.requests + l.streams + l.pending,
+		InFlightStreams: l.streams,
+		Rejected:        l.rejected,
+	}
+}
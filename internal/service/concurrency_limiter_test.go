@@ -0,0 +1,114 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// acquire admits and classifies a request, as the middleware and proxy
+// handler do together.
+func acquire(l *ConcurrencyLimiter, stream bool) (*ConcurrencySlot, bool) {
+	slot, ok := l.Admit()
+	if !ok {
+		return nil, false
+	}
+	if !slot.Classify(stream) {
+		slot.Release()
+		return nil, false
+	}
+	return slot, true
+}
+
+func TestConcurrencyLimiter_Shared(t *testing.T) {
+	assert.Nil(t, NewConcurrencyLimiter(0, 0), "no limits means unlimited")
+	var unlimited *ConcurrencyLimiter
+	slot, ok := unlimited.Admit()
+	require.True(t, ok)
+	assert.True(t, slot.Classify(true))
+	slot.Release()
+	assert.False(t, unlimited.Snapshot().Enabled)
+
+	l := NewConcurrencyLimiter(2, 0)
+	s1, ok := acquire(l, false)
+	require.True(t, ok)
+	s2, ok := acquire(l, true)
+	require.True(t, ok)
+	_, ok = l.Admit()
+	assert.False(t, ok, "streams count against the request limit")
+
+	snap := l.Snapshot()
+	assert.True(t, snap.Enabled)
+	assert.Equal(t, 2, snap.InFlight)
+	assert.Equal(t, 1, snap.InFlightStreams)
+	assert.Equal(t, int64(1), snap.Rejected)
+
+	s1.Release()
+	s1.Release() // Releasing twice frees one slot only
+	_, ok = acquire(l, true)
+	assert.True(t, ok)
+	_, ok = l.Admit()
+	assert.False(t, ok)
+	s2.Release()
+	assert.Equal(t, 1, l.Snapshot().InFlight)
+}
+
+func TestConcurrencyLimiter_SeparateStreams(t *testing.T) {
+	l := NewConcurrencyLimiter(1, 2)
+	_, ok := acquire(l, false)
+	require.True(t, ok)
+	_, ok = acquire(l, false)
+	assert.False(t, ok)
+
+	// Streams have their own budget.
+	_, ok = acquire(l, true)
+	assert.True(t, ok)
+	_, ok = acquire(l, true)
+	assert.True(t, ok)
+	_, ok = acquire(l, true)
+	assert.False(t, ok)
+
+	snap := l.Snapshot()
+	assert.Equal(t, 3, snap.InFlight)
+	assert.Equal(t, 2, snap.InFlightStreams)
+	assert.Equal(t, int64(2), snap.Rejected)
+
+	// Only streams are limited without a request limit.
+	l = NewConcurrencyLimiter(0, 1)
+	for i := 0; i < 3; i++ {
+		_, ok = acquire(l, false)
+		assert.True(t, ok)
+	}
+	_, ok = acquire(l, true)
+	assert.True(t, ok)
+	_, ok = acquire(l, true)
+	assert.False(t, ok)
+}
+
+func TestConcurrencyLimiter_PendingSlots(t *testing.T) {
+	l := NewConcurrencyLimiter(1, 1)
+	s1, ok := l.Admit()
+	require.True(t, ok)
+	s2, ok := l.Admit()
+	require.True(t, ok)
+	_, ok = l.Admit()
+	assert.False(t, ok, "unclassified requests count against the combined limit")
+	assert.Equal(t, 2, l.Snapshot().InFlight)
+
+	require.True(t, s1.Classify(false))
+	assert.False(t, s2.Classify(false), "the request limit is checked on classification")
+	s2.Release()
+	assert.Equal(t, 1, l.Snapshot().InFlight)
+
+	s3, ok := l.Admit()
+	require.True(t, ok)
+	assert.True(t, s3.Classify(true))
+	assert.True(t, s3.Classify(true), "classifying again is harmless")
+	s3.Release()
+	s1.Release()
+	assert.Equal(t, ConcurrencySnapshot{Enabled: true, MaxRequests: 1, MaxStreams: 1, Rejected: 2}, l.Snapshot())
+}
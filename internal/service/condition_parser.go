@@ -16,6 +16,7 @@ import (
 //   - matches(message, "regex") → regex match
 //   - has_code_block(message)   → triple-backtick detection
 //   - count(message, "str")     → occurrence count
+//   - token_estimate(message)   → approximate token count (see estimateTokens)
 //
 // Supported operators: AND, OR, NOT, parentheses
 // Comparison operators: >, <, >=, <=, ==
@@ -23,6 +24,25 @@ type ConditionParser struct {
 	codeBlockRe *regexp.Regexp
 }
 
+// ConditionStep is one function evaluation recorded while tracing a
+// condition, e.g. `len(message)=42 > 100` with Result false.
+type ConditionStep struct {
+	Expr   string `json:"expr"`
+	Result bool   `json:"result"`
+}
+
+// String renders the step as "expr → result".
+func (s ConditionStep) String() string {
+	return s.Expr + " → " + strconv.FormatBool(s.Result)
+}
+
+// conditionTrace collects the steps of a traced evaluation. The parser
+// passes a nil trace when not tracing and only builds step text behind a
+// nil check, so classification pays nothing for it.
+type conditionTrace struct {
+	steps []ConditionStep
+}
+
 // NewConditionParser creates a new ConditionParser.
 func NewConditionParser() *ConditionParser {
 	return &ConditionParser{
@@ -33,6 +53,19 @@ func NewConditionParser() *ConditionParser {
 // Evaluate evaluates a condition expression against a message.
 // Empty or whitespace-only conditions always return true.
 func (p *ConditionParser) Evaluate(condition, message string) (bool, error) {
+	return p.evaluate(condition, message, nil)
+}
+
+// EvaluateTrace is like Evaluate but also returns each function evaluation
+// and comparison in the order they ran, showing which sub-clause decided
+// the result. Steps recorded before an error are returned with it.
+func (p *ConditionParser) EvaluateTrace(condition, message string) (bool, []ConditionStep, error) {
+	tr := &conditionTrace{}
+	result, err := p.evaluate(condition, message, tr)
+	return result, tr.steps, err
+}
+
+func (p *ConditionParser) evaluate(condition, message string, tr *conditionTrace) (bool, error) {
 	condition = strings.TrimSpace(condition)
 	if condition == "" {
 		return true, nil
@@ -44,7 +77,7 @@ func (p *ConditionParser) Evaluate(condition, message string) (bool, error) {
 	}
 
 	pos := 0
-	result, err := p.parseOr(tokens, &pos, message)
+	result, err := p.parseOr(tokens, &pos, message, tr)
 	if err != nil {
 		return false, err
 	}
@@ -60,7 +93,7 @@ func (p *ConditionParser) Evaluate(condition, message string) (bool, error) {
 type tokenKind int
 
 const (
-	tkFunc   tokenKind = iota // function call: len, contains, matches, etc.
+	tkFunc   tokenKind = iota // function call: len, contains, matches, token_estimate, etc.
 	tkNum                     // numeric literal
 	tkStr                     // string literal
 	tkOp                      // comparison operator: >, <, >=, <=, ==
@@ -254,15 +287,15 @@ func (p *ConditionParser) readIdent(runes []rune, start int) (string, int) {
 // Recursive descent parser: OR → AND → NOT → primary
 
 // parseOr handles OR expressions (lowest precedence).
-func (p *ConditionParser) parseOr(tokens []token, pos *int, msg string) (bool, error) {
-	left, err := p.parseAnd(tokens, pos, msg)
+func (p *ConditionParser) parseOr(tokens []token, pos *int, msg string, tr *conditionTrace) (bool, error) {
+	left, err := p.parseAnd(tokens, pos, msg, tr)
 	if err != nil {
 		return false, err
 	}
 
 	for *pos < len(tokens) && tokens[*pos].kind == tkOr {
 		*pos++ // consume OR
-		right, err := p.parseAnd(tokens, pos, msg)
+		right, err := p.parseAnd(tokens, pos, msg, tr)
 		if err != nil {
 			return false, err
 		}
@@ -273,15 +306,15 @@ func (p *ConditionParser) parseOr(tokens []token, pos *int, msg string) (bool, e
 }
 
 // parseAnd handles AND expressions.
-func (p *ConditionParser) parseAnd(tokens []token, pos *int, msg string) (bool, error) {
-	left, err := p.parseNot(tokens, pos, msg)
+func (p *ConditionParser) parseAnd(tokens []token, pos *int, msg string, tr *conditionTrace) (bool, error) {
+	left, err := p.parseNot(tokens, pos, msg, tr)
 	if err != nil {
 		return false, err
 	}
 
 	for *pos < len(tokens) && tokens[*pos].kind == tkAnd {
 		*pos++ // consume AND
-		right, err := p.parseNot(tokens, pos, msg)
+		right, err := p.parseNot(tokens, pos, msg, tr)
 		if err != nil {
 			return false, err
 		}
@@ -292,20 +325,20 @@ func (p *ConditionParser) parseAnd(tokens []token, pos *int, msg string) (bool,
 }
 
 // parseNot handles NOT expressions (highest precedence among logical ops).
-func (p *ConditionParser) parseNot(tokens []token, pos *int, msg string) (bool, error) {
+func (p *ConditionParser) parseNot(tokens []token, pos *int, msg string, tr *conditionTrace) (bool, error) {
 	if *pos < len(tokens) && tokens[*pos].kind == tkNot {
-		*pos++ // consume NOT
-		val, err := p.parseNot(tokens, pos, msg) // NOT is right-associative
+		*pos++                                       // consume NOT
+		val, err := p.parseNot(tokens, pos, msg, tr) // NOT is right-associative
 		if err != nil {
 			return false, err
 		}
 		return !val, nil
 	}
-	return p.parsePrimary(tokens, pos, msg)
+	return p.parsePrimary(tokens, pos, msg, tr)
 }
 
 // parsePrimary handles function calls, parenthesized expressions, and comparisons.
-func (p *ConditionParser) parsePrimary(tokens []token, pos *int, msg string) (bool, error) {
+func (p *ConditionParser) parsePrimary(tokens []token, pos *int, msg string, tr *conditionTrace) (bool, error) {
 	if *pos >= len(tokens) {
 		return false, fmt.Errorf("unexpected end of expression")
 	}
@@ -315,7 +348,7 @@ func (p *ConditionParser) parsePrimary(tokens []token, pos *int, msg string) (bo
 	// Parenthesized expression
 	if tok.kind == tkLParen {
 		*pos++ // consume (
-		result, err := p.parseOr(tokens, pos, msg)
+		result, err := p.parseOr(tokens, pos, msg, tr)
 		if err != nil {
 			return false, err
 		}
@@ -328,14 +361,14 @@ func (p *ConditionParser) parsePrimary(tokens []token, pos *int, msg string) (bo
 
 	// Function call
 	if tok.kind == tkFunc {
-		return p.evalFunction(tokens, pos, msg)
+		return p.evalFunction(tokens, pos, msg, tr)
 	}
 
 	return false, fmt.Errorf("unexpected token: %s", tok.value)
 }
 
 // evalFunction evaluates a function call and optional comparison.
-func (p *ConditionParser) evalFunction(tokens []token, pos *int, msg string) (bool, error) {
+func (p *ConditionParser) evalFunction(tokens []token, pos *int, msg string, tr *conditionTrace) (bool, error) {
 	funcName := tokens[*pos].value
 	*pos++ // consume function name
 
@@ -358,16 +391,18 @@ func (p *ConditionParser) evalFunction(tokens []token, pos *int, msg string) (bo
 	*pos++ // consume )
 
 	// Evaluate function
+	var result bool
+	var numVal int
+	numeric := false
 	switch funcName {
 	case "len":
-		numVal := utf8.RuneCountInString(msg)
-		return p.evalComparison(tokens, pos, numVal)
+		numeric, numVal = true, utf8.RuneCountInString(msg)
 
 	case "contains":
 		if len(args) < 1 {
 			return false, fmt.Errorf("contains() requires a search string argument")
 		}
-		return strings.Contains(msg, args[0]), nil
+		result = strings.Contains(msg, args[0])
 
 	case "matches":
 		if len(args) < 1 {
@@ -377,23 +412,58 @@ func (p *ConditionParser) evalFunction(tokens []token, pos *int, msg string) (bo
 		if err != nil {
 			return false, fmt.Errorf("invalid regex in matches(): %w", err)
 		}
-		return re.MatchString(msg), nil
+		result = re.MatchString(msg)
 
 	case "has_code_block":
 		// Count occurrences of ``` — need at least 2 (open + close)
 		count := strings.Count(msg, "```")
-		return count >= 2, nil
+		result = count >= 2
 
 	case "count":
 		if len(args) < 1 {
 			return false, fmt.Errorf("count() requires a search string argument")
 		}
-		numVal := strings.Count(msg, args[0])
-		return p.evalComparison(tokens, pos, numVal)
+		numeric, numVal = true, strings.Count(msg, args[0])
+
+	case "token_estimate":
+		numeric, numVal = true, estimateTokens(msg)
 
 	default:
 		return false, fmt.Errorf("unknown function: %s", funcName)
 	}
+
+	if !numeric {
+		if tr != nil {
+			tr.steps = append(tr.steps, ConditionStep{Expr: callString(funcName, args), Result: result})
+		}
+		return result, nil
+	}
+	var op string
+	var rhs int
+	result, op, rhs, err = p.evalComparison(tokens, pos, numVal)
+	if err != nil {
+		return false, err
+	}
+	if tr != nil {
+		tr.steps = append(tr.steps, ConditionStep{
+			Expr:   fmt.Sprintf("%s=%d %s %d", callString(funcName, args), numVal, op, rhs),
+			Result: result,
+		})
+	}
+	return result, nil
+}
+
+// callString renders a function call for a trace, e.g. `count(message, "x")`.
+func callString(funcName string, args []string) string {
+	var sb strings.Builder
+	sb.WriteString(funcName)
+	sb.WriteString("(message")
+	for _, arg := range args {
+		sb.WriteString(", ")
+		sb.WriteString(strconv.Quote(arg))
+	}
+	sb.WriteString(")")
+	return sb.String()
 }
 
 // readFuncArgs reads function arguments (string literals), skipping "message" identifiers.
@@ -429,40 +499,41 @@ func (p *ConditionParser) readFuncArgs(tokens []token, pos *int, _ string) ([]st
 	return args, nil
 }
 
-// evalComparison evaluates a comparison operator against a numeric value.
-// If no comparison follows, returns false (numeric functions need comparison).
-func (p *ConditionParser) evalComparison(tokens []token, pos *int, numVal int) (bool, error) {
+// evalComparison evaluates a comparison operator against a numeric value,
+// returning the result along with the operator and right-hand side.
+// If no comparison follows, returns an error (numeric functions need comparison).
+func (p *ConditionParser) evalComparison(tokens []token, pos *int, numVal int) (bool, string, int, error) {
 	if *pos >= len(tokens) || tokens[*pos].kind != tkOp {
-		return false, fmt.Errorf("expected comparison operator after numeric function")
+		return false, "", 0, fmt.Errorf("expected comparison operator after numeric function")
 	}
 
 	op := tokens[*pos].value
 	*pos++ // consume operator
 
 	if *pos >= len(tokens) || tokens[*pos].kind != tkNum {
-		return false, fmt.Errorf("expected number after operator %s", op)
+		return false, "", 0, fmt.Errorf("expected number after operator %s", op)
 	}
 
 	rhs, err := strconv.Atoi(tokens[*pos].value)
 	if err != nil {
-		return false, fmt.Errorf("invalid number: %s", tokens[*pos].value)
+		return false, "", 0, fmt.Errorf("invalid number: %s", tokens[*pos].value)
 	}
 	*pos++ // consume number
 
 	switch op {
 	case ">":
-		return numVal > rhs, nil
+		return numVal > rhs, op, rhs, nil
 	case "<":
-		return numVal < rhs, nil
+		return numVal < rhs, op, rhs, nil
 	case ">=":
-		return numVal >= rhs, nil
+		return numVal >= rhs, op, rhs, nil
 	case "<=":
-		return numVal <= rhs, nil
+		return numVal <= rhs, op, rhs, nil
 	case "==":
-		return numVal == rhs, nil
+		return numVal == rhs, op, rhs, nil
 	case "!=":
-		return numVal != rhs, nil
+		return numVal != rhs, op, rhs, nil
 	default:
-		return false, fmt.Errorf("unknown operator: %s", op)
+		return false, "", 0, fmt.Errorf("unknown operator: %s", op)
 	}
 }
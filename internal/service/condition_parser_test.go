@@ -4,6 +4,7 @@
 package service
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -397,3 +398,58 @@ func BenchmarkConditionParser_ComplexCondition(b *testing.B) {
 		)
 	}
 }
+
+func TestConditionParser_TokenEstimate(t *testing.T) {
+	parser := NewConditionParser()
+
+	tests := []struct {
+		name      string
+		condition string
+		message   string
+		expected  bool
+	}{
+		{"english words", "token_estimate(message) == 3", "hello world", true},
+		{"chinese characters", "token_estimate(message) == 4", "你好世界", true},
+		{"mixed text", "token_estimate(message) == 5", "用 Go 写代码", true},
+		{"empty message", "token_estimate(message) == 0", "", true},
+		{"long message over budget", "token_estimate(message) > 2000", strings.Repeat("代码", 1001), true},
+		{"long ascii under budget", "token_estimate(message) > 2000", strings.Repeat("word ", 1500), false},
+		{"combined with len", "token_estimate(message) < 10 AND len(message) > 3", "你好世界", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Evaluate(tt.condition, tt.message)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+
+	_, err := parser.Evaluate("token_estimate(message)", "hi")
+	assert.Error(t, err, "numeric function requires a comparison")
+}
+
+func TestConditionParser_EvaluateTrace(t *testing.T) {
+	parser := NewConditionParser()
+	msg := strings.Repeat("x", 39) + "API"
+
+	result, steps, err := parser.EvaluateTrace(`len(message) > 100 AND contains(message, "API")`, msg)
+	require.NoError(t, err)
+	assert.False(t, result)
+	require.Len(t, steps, 2)
+	assert.Equal(t, "len(message)=42 > 100 → false", steps[0].String())
+	assert.Equal(t, `contains(message, "API") → true`, steps[1].String())
+
+	result, steps, err = parser.EvaluateTrace(`NOT count(message, "x") >= 39`, msg)
+	require.NoError(t, err)
+	assert.False(t, result)
+	assert.Equal(t, []ConditionStep{{Expr: `count(message, "x")=39 >= 39`, Result: true}}, steps)
+
+	_, steps, err = parser.EvaluateTrace(`has_code_block(message) OR len(message) >`, msg)
+	assert.Error(t, err)
+	assert.Equal(t, []ConditionStep{{Expr: "has_code_block(message)", Result: false}}, steps, "steps before the error are kept")
+
+	_, steps, err = parser.EvaluateTrace("", msg)
+	require.NoError(t, err)
+	assert.Empty(t, steps)
+}
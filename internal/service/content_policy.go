@@ -0,0 +1,103 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// ContentPolicy rejects requests whose text matches forbidden patterns
+// (secrets, regulated identifiers) before they reach an upstream provider.
+type ContentPolicy struct {
+	patterns []*regexp.Regexp
+	blocked  atomic.Int64
+}
+
+// NewContentPolicy compiles the configured patterns. It returns nil when the
+// policy is disabled or has no patterns; a nil policy allows every request.
+func NewContentPolicy(cfg config.ContentPolicyConfig) (*ContentPolicy, error) {
+	if !cfg.Enabled || len(cfg.Patterns) == 0 {
+		return nil, nil
+	}
+	p := &ContentPolicy{patterns: make([]*regexp.Regexp, 0, len(cfg.Patterns))}
+	for _, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compile content policy pattern %q: %w", pattern, err)
+		}
+		p.patterns = append(p.patterns, re)
+	}
+	return p, nil
+}
+
+// Check scans the system prompt and all message text (including tool inputs
+// and results) and returns the first matching pattern. Matches are counted.
+func (p *ContentPolicy) Check(req *models.AnthropicRequest) (string, bool) {
+	if p == nil || req == nil {
+		return "", false
+	}
+	texts := requestTexts(req)
+	for _, re := range p.patterns {
+		for _, t := range texts {
+			if re.MatchString(t) {
+				p.blocked.Add(1)
+				return re.String(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// BlockedCount returns how many requests the policy has rejected.
+func (p *ContentPolicy) BlockedCount() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.blocked.Load()
+}
+
+// requestTexts collects every user-supplied text fragment of a request.
+func requestTexts(req *models.AnthropicRequest) []string {
+	var texts []string
+	if !req.System.IsEmpty() {
+		if s := req.System.String(); s != "" {
+			texts = append(texts, s)
+		}
+	}
+	for _, msg := range req.Messages {
+		for _, part := range msg.Content.GetParts() {
+			texts = appendPartTexts(texts, part)
+		}
+	}
+	return texts
+}
+
+func appendPartTexts(texts []string, part models.ContentPart) []string {
+	if part.Text != "" {
+		texts = append(texts, part.Text)
+	}
+	if part.Input != nil {
+		if b, err := json.Marshal(part.Input); err == nil {
+			texts = append(texts, string(b))
+		}
+	}
+	switch c := part.Content.(type) {
+	case string:
+		if c != "" {
+			texts = append(texts, c)
+		}
+	case []any:
+		for _, item := range c {
+			if m, ok := item.(map[string]any); ok {
+				if t, ok := m["text"].(string); ok && t != "" {
+					texts = append(texts, t)
+				}
+			}
+		}
+	}
+	return texts
+}
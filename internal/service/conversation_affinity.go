@@ -0,0 +1,128 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// ConversationAffinity keeps each conversation named by X-Conversation-Id on
+// the endpoint that last served it successfully, so tool-use loops do not
+// bounce between providers and lose the provider-side prompt cache. Unlike
+// the conversation_hash strategy it follows actual success: a conversation
+// moves only when its endpoint fails or becomes unhealthy, and then stays on
+// wherever the retry succeeded. Entries expire after a TTL of inactivity and
+// the number remembered is capped. A nil ConversationAffinity pins nothing.
+type ConversationAffinity struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*affinityEntry
+}
+
+// affinityEntry is the endpoint a conversation last succeeded on.
+type affinityEntry struct {
+	endpoint string // EndpointName
+	expires  time.Time
+}
+
+// NewConversationAffinity creates a ConversationAffinity. It returns nil
+// when conversation affinity is disabled.
+func NewConversationAffinity(cfg config.LoadBalanceConfig) *ConversationAffinity {
+	if !cfg.ConversationAffinity || cfg.ConversationAffinityTTLSeconds <= 0 || cfg.ConversationAffinityMaxEntries <= 0 {
+		return nil
+	}
+	return &ConversationAffinity{
+		ttl:        time.Duration(cfg.ConversationAffinityTTLSeconds) * time.Second,
+		maxEntries: cfg.ConversationAffinityMaxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*affinityEntry),
+	}
+}
+
+// Preferred returns the endpoint among candidates that req's conversation
+// last succeeded on, or nil when the request names no conversation, the
+// entry expired or that endpoint is not a candidate (e.g. unhealthy).
+func (a *ConversationAffinity) Preferred(req *models.AnthropicRequest, candidates []*models.Endpoint) *models.Endpoint {
+	if a == nil || req == nil || req.ConversationID == "" {
+		return nil
+	}
+	a.mu.Lock()
+	e, ok := a.entries[req.ConversationID]
+	if ok && a.now().After(e.expires) {
+		delete(a.entries, req.ConversationID)
+		ok = false
+	}
+	a.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	for _, ep := range candidates {
+		if EndpointName(ep) == e.endpoint {
+			return ep
+		}
+	}
+	return nil
+}
+
+// Remember records that req's conversation was served by the named
+// endpoint, refreshing its TTL.
+func (a *ConversationAffinity) Remember(req *models.AnthropicRequest, endpoint string) {
+	if a == nil || req.ConversationID == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	if _, ok := a.entries[req.ConversationID]; !ok && len(a.entries) >= a.maxEntries {
+		a.evict(now)
+	}
+	a.entries[req.ConversationID] = &affinityEntry{endpoint: endpoint, expires: now.Add(a.ttl)}
+}
+
+// Forget unpins req's conversation when it is pinned to the named endpoint,
+// which just failed it, so the next turn is balanced afresh.
+func (a *ConversationAffinity) Forget(req *models.AnthropicRequest, endpoint string) {
+	if a == nil || req.ConversationID == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if e, ok := a.entries[req.ConversationID]; ok && e.endpoint == endpoint {
+		delete(a.entries, req.ConversationID)
+	}
+}
+
+// Len returns the number of conversations remembered, expired ones included
+// until they are evicted.
+func (a *ConversationAffinity) Len() int {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.entries)
+}
+
+// evict drops expired entries and, if still full, the one closest to
+// expiring. a.mu must be held.
+func (a *ConversationAffinity) evict(now time.Time) {
+	var oldestID string
+	var oldest time.Time
+	for id, e := range a.entries {
+		if now.After(e.expires) {
+			delete(a.entries, id)
+			continue
+		}
+		if oldestID == "" || e.expires.Before(oldest) {
+			oldestID, oldest = id, e.expires
+		}
+	}
+	if len(a.entries) >= a.maxEntries && oldestID != "" {
+		delete(a.entries, oldestID)
+	}
+}
@@ -0,0 +1,145 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+func affinityTestEndpoint(provider string) *models.Endpoint {
+	return &models.Endpoint{
+		Provider: &models.Provider{Name: provider, Weight: 1, Enabled: true},
+		Model:    &models.Model{ID: 1, Name: "claude-sonnet-4", Role: models.ModelRoleDefault, Enabled: true},
+	}
+}
+
+func TestConversationAffinity_TTLAndCap(t *testing.T) {
+	a := NewConversationAffinity(config.LoadBalanceConfig{
+		ConversationAffinity:           true,
+		ConversationAffinityTTLSeconds: 60,
+		ConversationAffinityMaxEntries: 2,
+	})
+	require.NotNil(t, a)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	p1, p2 := affinityTestEndpoint("p1"), affinityTestEndpoint("p2")
+	candidates := []*models.Endpoint{p1, p2}
+	conv := func(id string) *models.AnthropicRequest { return &models.AnthropicRequest{ConversationID: id} }
+
+	a.Remember(conv("c1"), EndpointName(p2))
+	assert.Same(t, p2, a.Preferred(conv("c1"), candidates))
+	assert.Nil(t, a.Preferred(conv("c1"), []*models.Endpoint{p1}), "an endpoint that is no candidate is not forced")
+	assert.Nil(t, a.Preferred(conv("other"), candidates))
+	assert.Nil(t, a.Preferred(&models.AnthropicRequest{}, candidates), "requests without a conversation ID are not pinned")
+
+	// Forget only unpins the endpoint that failed.
+	a.Forget(conv("c1"), EndpointName(p1))
+	assert.Same(t, p2, a.Preferred(conv("c1"), candidates))
+	a.Forget(conv("c1"), EndpointName(p2))
+	assert.Nil(t, a.Preferred(conv("c1"), candidates))
+
+	// Entries expire after the TTL; remembering again refreshes it.
+	a.Remember(conv("c1"), EndpointName(p1))
+	now = now.Add(45 * time.Second)
+	a.Remember(conv("c1"), EndpointName(p1))
+	now = now.Add(45 * time.Second)
+	assert.Same(t, p1, a.Preferred(conv("c1"), candidates))
+	now = now.Add(61 * time.Second)
+	assert.Nil(t, a.Preferred(conv("c1"), candidates))
+
+	// At the cap the entry closest to expiring makes room.
+	a.Remember(conv("c1"), EndpointName(p1))
+	now = now.Add(time.Second)
+	a.Remember(conv("c2"), EndpointName(p1))
+	a.Remember(conv("c3"), EndpointName(p2))
+	assert.Equal(t, 2, a.Len())
+	assert.Nil(t, a.Preferred(conv("c1"), candidates))
+	assert.Same(t, p2, a.Preferred(conv("c3"), candidates))
+
+	assert.Nil(t, NewConversationAffinity(config.LoadBalanceConfig{ConversationAffinityTTLSeconds: 60, ConversationAffinityMaxEntries: 2}))
+	var disabled *ConversationAffinity
+	disabled.Remember(conv("c1"), EndpointName(p1))
+	assert.Nil(t, disabled.Preferred(conv("c1"), candidates))
+}
+
+func TestConversationAffinity_TurnsStayOnProvider(t *testing.T) {
+	var failing atomic.Value // Name of the provider answering 500
+	failing.Store("")
+	hits := map[string]*atomic.Int32{"p1": {}, "p2": {}}
+	upstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[name].Add(1)
+			if failing.Load() == name {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, `{"type":"error","error":{"type":"api_error","message":"boom"}}`)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"ok"}],"usage":{"input_tokens":1,"output_tokens":1}}`)
+		}))
+	}
+	s1, s2 := upstream("p1"), upstream("p2")
+	defer s1.Close()
+	defer s2.Close()
+	p1, p2 := affinityTestEndpoint("p1"), affinityTestEndpoint("p2")
+	p1.Provider.BaseURL, p2.Provider.BaseURL = s1.URL, s2.URL
+	endpoints := []*models.Endpoint{p1, p2}
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{Enabled: true}, logger)
+	registerHealthyEndpoints(hc, endpoints)
+	lb := NewLoadBalancerWithStrategy(models.StrategyRoundRobin)
+	affinity := NewConversationAffinity(config.LoadBalanceConfig{
+		ConversationAffinity:           true,
+		ConversationAffinityTTLSeconds: 600,
+		ConversationAffinityMaxEntries: 100,
+	})
+	ps := NewProxyService(hc, lb, nil, logger)
+	ps.SetConversationAffinity(affinity)
+	rcr := repository.NewRoutingConfigRepository(testutil.NewTestDB(t), logger)
+	es := NewEndpointSelector(NewModelSelector(hc, logger), hc, lb, nil, rcr, logger)
+	es.SetConversationAffinity(affinity)
+
+	turn := func() string {
+		req := &models.AnthropicRequest{
+			Model:          "claude-sonnet-4",
+			MaxTokens:      10,
+			Messages:       []models.Message{{Role: "user", Content: models.MessageContent{Text: "run the tests"}}},
+			ConversationID: "conv-1",
+		}
+		selection, err := es.SelectEndpoint(context.Background(), req, endpoints)
+		require.NoError(t, err)
+		_, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, endpoints)
+		require.NoError(t, err)
+		return meta.SelectedEndpoint
+	}
+
+	first := turn()
+	assert.Equal(t, first, turn(), "the second turn goes where the first succeeded, not round robin")
+	assert.Equal(t, first, turn())
+
+	// Once the pinned provider fails, the turn is retried elsewhere and the
+	// conversation follows the provider that succeeded.
+	failing.Store(first)
+	moved := turn()
+	assert.NotEqual(t, first, moved)
+	failedHits := hits[first].Load()
+	assert.Equal(t, moved, turn())
+	assert.Equal(t, failedHits, hits[first].Load(), "the failed provider is not tried again")
+}
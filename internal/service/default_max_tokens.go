@@ -0,0 +1,47 @@
+package service
+
+import (
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// ApplyDefaultMaxTokens fills in the default max_tokens when req omits it and
+// marks it as defaulted, so the endpoint finally serving it is sent the
+// default of its model's role instead. It reports whether req was changed.
+func (s *ProxyService) ApplyDefaultMaxTokens(req *models.AnthropicRequest) bool {
+	if s.defaultMaxTokens <= 0 || req.MaxTokens != 0 {
+		return false
+	}
+	req.MaxTokens = s.defaultMaxTokens
+	req.MaxTokensDefaulted = true
+	return true
+}
+
+// upstreamMaxTokens returns the max_tokens sent to ep for req, given the
+// thinking config sent with it. A defaulted value is replaced by the default
+// of the model's role and raised above the thinking budget, which max_tokens
+// must exceed; a client-supplied one is sent as is.
+func (s *ProxyService) upstreamMaxTokens(req *models.AnthropicRequest, ep *models.Endpoint, thinking *models.ThinkingConfig) int {
+	if !req.MaxTokensDefaulted {
+		return req.MaxTokens
+	}
+	n := req.MaxTokens
+	if roleMax := s.roleMaxTokens[ep.Model.Role]; roleMax > 0 {
+		n = roleMax
+	}
+	if thinking != nil && thinking.Type == "enabled" && thinking.BudgetTokens >= n {
+		n += thinking.BudgetTokens
+	}
+	return n
+}
+
+// ClientRequest returns req as the client sent it, without a defaulted
+// max_tokens, for the request log.
+func ClientRequest(req *models.AnthropicRequest) *models.AnthropicRequest {
+	if !req.MaxTokensDefaulted {
+		return req
+	}
+	client := *req
+	client.MaxTokens = 0
+	client.MaxTokensDefaulted = false
+	return &client
+}
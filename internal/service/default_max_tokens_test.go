@@ -0,0 +1,94 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestProxyService_DefaultMaxTokens(t *testing.T) {
+	var received []int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		received = append(received, int(body["max_tokens"].(float64)))
+		if body["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"type\":\"message_stop\"}\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.AnthropicResponse{ID: "msg_1", Type: "message", Role: "assistant"})
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{Enabled: true}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	ps.SetDefaultMaxTokens(4096, map[models.ModelRole]int{models.ModelRoleSimple: 1024})
+
+	send := func(role models.ModelRole, req *models.AnthropicRequest) int {
+		ep := createProxyTestEndpoint(upstream.URL)
+		ep.Model.Role = role
+		registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+		selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: role}
+		if req.Stream {
+			chunks, _, err := ps.ProxyStreamRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+			require.NoError(t, err)
+			for range chunks {
+			}
+		} else {
+			_, _, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+			require.NoError(t, err)
+		}
+		return received[len(received)-1]
+	}
+	omitted := func() *models.AnthropicRequest {
+		req := &models.AnthropicRequest{Model: "auto", Messages: []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hi"}}}}
+		require.True(t, ps.ApplyDefaultMaxTokens(req))
+		assert.Equal(t, 4096, req.MaxTokens)
+		return req
+	}
+
+	assert.Equal(t, 4096, send(models.ModelRoleDefault, omitted()))
+	assert.Equal(t, 1024, send(models.ModelRoleSimple, omitted()), "the role's default wins")
+	streamed := omitted()
+	streamed.Stream = true
+	assert.Equal(t, 1024, send(models.ModelRoleSimple, streamed))
+
+	thinking := omitted()
+	thinking.Thinking = &models.ThinkingConfig{Type: "enabled", BudgetTokens: 2048}
+	assert.Equal(t, 3072, send(models.ModelRoleSimple, thinking), "max_tokens must exceed the thinking budget")
+
+	// Values sent by the client are left alone, even on simple models.
+	explicit := &models.AnthropicRequest{Model: "auto", MaxTokens: 8000, Messages: omitted().Messages}
+	assert.False(t, ps.ApplyDefaultMaxTokens(explicit))
+	assert.Equal(t, 8000, send(models.ModelRoleSimple, explicit))
+
+	ps.SetDefaultMaxTokens(0, nil)
+	disabled := &models.AnthropicRequest{Model: "auto"}
+	assert.False(t, ps.ApplyDefaultMaxTokens(disabled))
+	assert.Zero(t, disabled.MaxTokens)
+}
+
+func TestClientRequest(t *testing.T) {
+	req := &models.AnthropicRequest{Model: "auto", MaxTokens: 4096, MaxTokensDefaulted: true}
+	client := ClientRequest(req)
+	assert.Zero(t, client.MaxTokens)
+	assert.False(t, client.MaxTokensDefaulted)
+	assert.Equal(t, 4096, req.MaxTokens, "the proxied request keeps its default")
+
+	sent := &models.AnthropicRequest{Model: "auto", MaxTokens: 100}
+	assert.Same(t, sent, ClientRequest(sent))
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+// embeddingRebuildBatchSize is the number of cache entries re-embedded per
+// batch; progress is published after each batch.
+const embeddingRebuildBatchSize = 50
+
+var (
+	// ErrNotPrimary is returned when a primary-only job is started on a
+	// secondary worker.
+	ErrNotPrimary = errors.New("only the primary worker can run this job")
+	// ErrRebuildRunning is returned when a rebuild is already in progress.
+	ErrRebuildRunning = errors.New("embedding rebuild already in progress")
+)
+
+// Embedder computes text embeddings. A nil embedding with a nil error means
+// no embedding is available.
+type Embedder interface {
+	GetEmbedding(ctx context.Context, text string) ([]float64, error)
+}
+
+// EmbeddingRebuildProgress reports the state of an embedding rebuild.
+type EmbeddingRebuildProgress struct {
+	Status     string     `json:"status"` // "idle", "running", "completed" or "failed"
+	Dimension  int        `json:"dimension,omitempty"`
+	Total      int64      `json:"total"`
+	Processed  int64      `json:"processed"`
+	Rebuilt    int64      `json:"rebuilt"` // Entries given a new embedding
+	Cleared    int64      `json:"cleared"` // Entries whose embedding could not be rebuilt and was removed
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// EmbeddingRebuilder recomputes the embeddings of the L2 routing cache from
+// the stored content previews, e.g. after the embedding model changed and the
+// stored vectors have the wrong dimension. Entries that cannot be re-embedded
+// keep their exact-match routing but lose their embedding. Only the primary
+// worker runs rebuilds, so workers do not re-embed the same table twice.
+type EmbeddingRebuilder struct {
+	repo     *repository.EmbeddingCacheRepository
+	embedder Embedder
+	primary  func() bool
+	logger   *zap.Logger
+
+	mu       sync.Mutex
+	progress EmbeddingRebuildProgress
+}
+
+// NewEmbeddingRebuilder creates an EmbeddingRebuilder. isPrimary reports
+// whether this worker is the primary; nil means a single worker.
+func NewEmbeddingRebuilder(
+	repo *repository.EmbeddingCacheRepository,
+	embedder Embedder,
+	isPrimary func() bool,
+	logger *zap.Logger,
+) *EmbeddingRebuilder {
+	return &EmbeddingRebuilder{
+		repo:     repo,
+		embedder: embedder,
+		primary:  isPrimary,
+		logger:   logger,
+		progress: EmbeddingRebuildProgress{Status: "idle"},
+	}
+}
+
+// Progress returns the state of the current or last rebuild.
+func (b *EmbeddingRebuilder) Progress() EmbeddingRebuildProgress {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.progress
+}
+
+// Start launches a rebuild in the background. dimension is the dimension of
+// the active embedding model; embeddings of any other length are discarded.
+// Zero accepts whatever the embedder returns.
+func (b *EmbeddingRebuilder) Start(dimension int) error {
+	if err := b.begin(dimension); err != nil {
+		return err
+	}
+	go b.run(context.Background(), dimension)
+	return nil
+}
+
+// Run performs a rebuild synchronously.
+func (b *EmbeddingRebuilder) Run(ctx context.Context, dimension int) error {
+	if err := b.begin(dimension); err != nil {
+		return err
+	}
+	return b.run(ctx, dimension)
+}
+
+func (b *EmbeddingRebuilder) begin(dimension int) error {
+	if b.primary != nil && !b.primary() {
+		return ErrNotPrimary
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.progress.Status == "running" {
+		return ErrRebuildRunning
+	}
+	now := time.Now()
+	b.progress = EmbeddingRebuildProgress{Status: "running", Dimension: dimension, StartedAt: &now}
+	return nil
+}
+
+func (b *EmbeddingRebuilder) run(ctx context.Context, dimension int) error {
+	err := b.rebuild(ctx, dimension)
+
+	b.mu.Lock()
+	now := time.Now()
+	b.progress.FinishedAt = &now
+	if err != nil {
+		b.progress.Status = "failed"
+		b.progress.Error = err.Error()
+	} else {
+		b.progress.Status = "completed"
+	}
+	p := b.progress
+	b.mu.Unlock()
+
+	if err != nil {
+		b.logger.Error("embedding rebuild failed", zap.Error(err))
+	} else {
+		b.logger.Info("embedding rebuild completed",
+			zap.Int64("rebuilt", p.Rebuilt),
+			zap.Int64("cleared", p.Cleared))
+	}
+	return err
+}
+
+func (b *EmbeddingRebuilder) rebuild(ctx context.Context, dimension int) error {
+	total, err := b.repo.Count(ctx)
+	if err != nil {
+		return err
+	}
+	b.update(func(p *EmbeddingRebuildProgress) { p.Total = total })
+
+	var lastID int64
+	for {
+		entries, err := b.repo.ListPreviewsAfter(ctx, lastID, embeddingRebuildBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		var rebuilt, cleared int64
+		for _, e := range entries {
+			lastID = e.ID
+			embedding := b.embed(ctx, e.ContentPreview, dimension)
+			if err := b.repo.UpdateEmbedding(ctx, e.ID, embedding); err != nil {
+				return err
+			}
+			if embedding != nil {
+				rebuilt++
+			} else {
+				cleared++
+			}
+		}
+		b.update(func(p *EmbeddingRebuildProgress) {
+			p.Processed += int64(len(entries))
+			p.Rebuilt += rebuilt
+			p.Cleared += cleared
+		})
+	}
+}
+
+// embed returns the new embedding for a preview, or nil when none of the
+// right dimension can be computed.
+func (b *EmbeddingRebuilder) embed(ctx context.Context, preview string, dimension int) []float64 {
+	if preview == "" || b.embedder == nil {
+		return nil
+	}
+	embedding, err := b.embedder.GetEmbedding(ctx, preview)
+	if err != nil {
+		b.logger.Debug("re-embedding cache entry failed", zap.Error(err))
+		return nil
+	}
+	if len(embedding) == 0 || (dimension > 0 && len(embedding) != dimension) {
+		return nil
+	}
+	return embedding
+}
+
+func (b *EmbeddingRebuilder) update(fn func(p *EmbeddingRebuildProgress)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fn(&b.progress)
+}
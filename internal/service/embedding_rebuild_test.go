@@ -0,0 +1,73 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+// fakeEmbedder returns fixed-dimension embeddings and fails for "fail".
+type fakeEmbedder struct{ dim int }
+
+func (f fakeEmbedder) GetEmbedding(_ context.Context, text string) ([]float64, error) {
+	if text == "fail" {
+		return nil, errors.New("embedding API unavailable")
+	}
+	return make([]float64, f.dim), nil
+}
+
+func TestEmbeddingRebuilder_RebuildsToNewDimension(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	repo := repository.NewEmbeddingCacheRepository(db, zap.NewNop())
+	ctx := t.Context()
+
+	// Entries embedded by the old 3-dimensional model, more than one batch.
+	for i := range embeddingRebuildBatchSize + 5 {
+		require.NoError(t, repo.SaveCache(ctx, fmt.Sprintf("hash-%d", i), fmt.Sprintf("message %d", i), []float64{1, 2, 3}, "simple", ""))
+	}
+	require.NoError(t, repo.SaveCache(ctx, "hash-fail", "fail", []float64{1, 2, 3}, "complex", ""))
+
+	b := NewEmbeddingRebuilder(repo, fakeEmbedder{dim: 5}, nil, zap.NewNop())
+	require.NoError(t, b.Run(ctx, 5))
+
+	p := b.Progress()
+	assert.Equal(t, "completed", p.Status)
+	assert.Equal(t, int64(embeddingRebuildBatchSize+6), p.Total)
+	assert.Equal(t, p.Total, p.Processed)
+	assert.Equal(t, int64(embeddingRebuildBatchSize+5), p.Rebuilt)
+	assert.Equal(t, int64(1), p.Cleared)
+
+	entries, err := repo.ExportAll(ctx)
+	require.NoError(t, err)
+	for _, e := range entries {
+		if e.ContentHash == "hash-fail" {
+			assert.Nil(t, e.Embedding)
+			assert.Equal(t, "complex", e.TaskType, "exact-match routing is kept")
+			continue
+		}
+		assert.Len(t, e.Embedding, 5, e.ContentHash)
+	}
+
+	// A wrong-dimension embedding is discarded rather than stored.
+	require.NoError(t, b.Run(ctx, 8))
+	assert.Equal(t, int64(embeddingRebuildBatchSize+6), b.Progress().Cleared)
+}
+
+func TestEmbeddingRebuilder_PrimaryOnly(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	repo := repository.NewEmbeddingCacheRepository(db, zap.NewNop())
+
+	b := NewEmbeddingRebuilder(repo, fakeEmbedder{dim: 5}, func() bool { return false }, zap.NewNop())
+	assert.ErrorIs(t, b.Start(5), ErrNotPrimary)
+	assert.Equal(t, "idle", b.Progress().Status)
+}
@@ -2,8 +2,10 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/user/llm-proxy-go/internal/models"
 	"github.com/user/llm-proxy-go/internal/repository"
@@ -18,8 +20,21 @@ type EndpointSelectionResult struct {
 	FallbackInfo    *models.FallbackInfo
 	RoutingDecision *models.RoutingDecision
 	RuleMatchResult *ClassifyResult
+	MaxOutputTokens int // Output token budget for the response; 0 means unlimited
+
+	// RoutingLatencyMs is the time smart routing spent inferring the task
+	// type (rules, caches and the routing model); 0 without smart routing.
+	RoutingLatencyMs float64
 }
 
+// ErrInvalidForcedRole is returned by SelectForcedRole for a role that is
+// not a known role.
+var ErrInvalidForcedRole = errors.New("invalid forced role")
+
+// ErrNoEndpointForRole is returned by SelectForcedRole when no endpoint is
+// configured for the forced role.
+var ErrNoEndpointForRole = errors.New("no endpoint configured for role")
+
 // EndpointSelector integrates routing decision and endpoint selection.
 type EndpointSelector struct {
 	modelSelector     *ModelSelector
@@ -27,6 +42,9 @@ type EndpointSelector struct {
 	loadBalancer      *LoadBalancer
 	llmRouter         *LLMRouter
 	routingConfigRepo *repository.RoutingConfigRepository
+	roles             *RoleSet              // Known task-type roles; nil = builtin roles only
+	defaultFallback   bool                  // Serve routed requests from the default role when the inferred role is unavailable
+	affinity          *ConversationAffinity // Endpoints conversations last succeeded on; nil = no stickiness
 	logger            *zap.Logger
 }
 
@@ -45,6 +63,7 @@ func NewEndpointSelector(
 		loadBalancer:      lb,
 		llmRouter:         lr,
 		routingConfigRepo: rcr,
+		defaultFallback:   true,
 		logger:            logger,
 	}
 }
@@ -52,11 +71,14 @@ func NewEndpointSelector(
 // SelectEndpoint selects an endpoint for the request.
 // Priority (aligned with Python route_request):
 // 1. ForceSmartRouting=true → smart routing
-// 2. req.Model == "auto" → smart routing
+// 2. req.Model is a routing trigger ("auto" by default) → smart routing
 // 3. req.Model exists and enabled → use specified model
 // 4. req.Model disabled → same-role fallback
 // 5. req.Model not found → default role fallback
 // 6. No model specified → default role fallback
+// Smart routing (1 and 2) falls back to the default role when the inferred
+// role has no available endpoint unless disabled with SetDefaultFallback.
+// A role forced per request (SelectForcedRole) takes precedence over all of these.
 func (s *EndpointSelector) SelectEndpoint(
 	ctx context.Context,
 	req *models.AnthropicRequest,
@@ -68,13 +90,14 @@ func (s *EndpointSelector) SelectEndpoint(
 	// 1. Force smart routing
 	if cfg != nil && cfg.ForceSmartRouting {
 		s.logger.Debug("force smart routing enabled")
-		return s.doSmartRouting(ctx, req, endpoints)
+		return s.doSmartRouting(ctx, cfg, req, endpoints)
 	}
 
-	// 2. User specified "auto"
-	if strings.EqualFold(req.Model, "auto") {
-		s.logger.Debug("auto model requested, using smart routing")
-		return s.doSmartRouting(ctx, req, endpoints)
+	// 2. User specified a routing trigger such as "auto"
+	if isRoutingTrigger(cfg, req.Model) {
+		s.logger.Debug("routing trigger model requested, using smart routing",
+			zap.String("model", req.Model))
+		return s.doSmartRouting(ctx, cfg, req, endpoints)
 	}
 
 	// 3. User specified a concrete model
@@ -93,7 +116,7 @@ func (s *EndpointSelector) SelectEndpoint(
 			}
 			// No healthy endpoints for this model → fallback within same role
 			fallbackModel, fallbackInfo, err := s.modelSelector.FindAvailableModelWithFallback(
-				model.Role, model, endpoints)
+				model.Role, model, endpoints, roleFallbackChain(cfg))
 			if err != nil {
 				return nil, fmt.Errorf("no available endpoint for model %s: %w", req.Model, err)
 			}
@@ -116,29 +139,122 @@ func (s *EndpointSelector) SelectEndpoint(
 	}
 
 	// 6. No model specified → default role fallback
-	return s.selectWithFallback(models.ModelRoleDefault, nil, endpoints)
+	return s.selectWithFallback(models.ModelRoleDefault, nil, endpoints, req, roleFallbackChain(cfg))
+}
+
+// SetRoleSet sets the roles SelectForcedRole accepts (nil means the builtin
+// roles only).
+func (s *EndpointSelector) SetRoleSet(rs *RoleSet) {
+	s.roles = rs
+}
+
+// SetDefaultFallback sets whether a smart-routed request whose inferred role
+// has no healthy endpoint may be served from the default role, even when the
+// configured fallback chain does not include it. Disabled, such requests fail
+// rather than cross to the default role. Enabled by default.
+func (s *EndpointSelector) SetDefaultFallback(enabled bool) {
+	s.defaultFallback = enabled
+}
+
+// SetConversationAffinity makes a conversation's next turn go to the
+// endpoint its last turn succeeded on while that endpoint is healthy and
+// serves the selected model (nil disables it).
+func (s *EndpointSelector) SetConversationAffinity(a *ConversationAffinity) {
+	s.affinity = a
+}
+
+// SelectForcedRole selects an endpoint of the given role without routing:
+// neither the requested model nor ForceSmartRouting is consulted, and there
+// is no fallback to other roles. The decision is recorded with routing
+// method "forced".
+func (s *EndpointSelector) SelectForcedRole(
+	role models.ModelRole,
+	req *models.AnthropicRequest,
+	endpoints []*models.Endpoint,
+) (*EndpointSelectionResult, error) {
+	if !s.roles.Valid(role) {
+		return nil, fmt.Errorf("%w %q, must be one of %s", ErrInvalidForcedRole, role, strings.Join(s.roles.Names(), ", "))
+	}
+	if len(s.modelSelector.GetModelsForRole(role, endpoints)) == 0 {
+		return nil, fmt.Errorf("%w %s", ErrNoEndpointForRole, role)
+	}
+
+	healthy := s.modelSelector.GetHealthyModelsForRole(role, endpoints)
+	model := s.modelSelector.SelectModelByWeight(healthy)
+	if model == nil {
+		return nil, fmt.Errorf("no healthy endpoint for forced role %s", role)
+	}
+	ep := s.selectEndpointForModel(model, endpoints, req)
+	if ep == nil {
+		return nil, fmt.Errorf("no endpoint selected for model %s", model.Name)
+	}
+	return &EndpointSelectionResult{
+		Endpoint: ep,
+		Model:    model,
+		TaskType: role,
+		RoutingDecision: &models.RoutingDecision{
+			TaskType:  role,
+			Reason:    "forced by request header",
+			CacheType: "forced",
+		},
+	}, nil
+}
+
+// roleFallbackChain returns the configured role fallback chain, nil without
+// a routing config.
+func roleFallbackChain(cfg *models.RoutingConfig) []string {
+	if cfg == nil {
+		return nil
+	}
+	return cfg.RoleFallbackChain
+}
+
+// isRoutingTrigger reports whether the requested model name triggers smart
+// routing. Without a routing config only "auto" does.
+func isRoutingTrigger(cfg *models.RoutingConfig, model string) bool {
+	triggers := models.DefaultRoutingConfig().RoutingTriggerModels
+	if cfg != nil {
+		triggers = cfg.RoutingTriggerModels
+	}
+	for _, trigger := range triggers {
+		if strings.EqualFold(model, trigger) {
+			return true
+		}
+	}
+	return false
 }
 
 // doSmartRouting performs smart routing via LLMRouter, then selects an endpoint for the inferred role.
 func (s *EndpointSelector) doSmartRouting(
 	ctx context.Context,
+	cfg *models.RoutingConfig,
 	req *models.AnthropicRequest,
 	endpoints []*models.Endpoint,
 ) (*EndpointSelectionResult, error) {
 	if s.llmRouter == nil {
 		s.logger.Warn("smart routing requested but LLMRouter is nil, falling back to default")
-		return s.selectWithFallback(models.ModelRoleDefault, nil, endpoints)
+		return s.selectWithFallback(models.ModelRoleDefault, nil, endpoints, req, roleFallbackChain(cfg))
 	}
 
+	inferStart := time.Now()
 	taskType, decision, err := s.llmRouter.InferTaskType(ctx, req)
+	routingLatencyMs := float64(time.Since(inferStart).Microseconds()) / 1000
 	if err != nil {
 		s.logger.Warn("smart routing inference failed, falling back to default", zap.Error(err))
-		return s.selectWithFallback(models.ModelRoleDefault, nil, endpoints)
+		result, selErr := s.selectWithFallback(models.ModelRoleDefault, nil, endpoints, req, roleFallbackChain(cfg))
+		if selErr != nil {
+			return nil, selErr
+		}
+		result.RoutingLatencyMs = routingLatencyMs
+		return result, nil
 	}
 
 	// Get rule match result if rule-based routing was used
 	var ruleResult *ClassifyResult
-	if decision != nil && decision.CacheType == "rule" {
+	if decision != nil && decision.RuleMatch != nil {
+		m := decision.RuleMatch
+		ruleResult = &ClassifyResult{TaskType: m.TaskType, Rule: m.Rule, Matches: m.Matches, Reason: m.Reason}
+	} else if decision != nil && decision.CacheType == "rule" {
 		userMessage := extractLastUserMessage(req)
 		if userMessage != "" {
 			classifier := NewRoutingClassifier(nil)
@@ -146,12 +262,16 @@ func (s *EndpointSelector) doSmartRouting(
 		}
 	}
 
-	result, selErr := s.selectWithFallback(taskType, nil, endpoints)
+	result, selErr := s.selectWithFallback(taskType, nil, endpoints, req, s.smartRoutingChain(taskType, roleFallbackChain(cfg)))
 	if selErr != nil {
 		return nil, selErr
 	}
+	// The inferred role stays the task type; FallbackInfo records the role
+	// that actually served the request.
+	result.TaskType = taskType
 	result.RoutingDecision = decision
 	result.RuleMatchResult = ruleResult
+	result.RoutingLatencyMs = routingLatencyMs
 	return result, nil
 }
 
@@ -160,12 +280,14 @@ func (s *EndpointSelector) selectWithFallback(
 	role models.ModelRole,
 	originalModel *models.Model,
 	endpoints []*models.Endpoint,
+	req *models.AnthropicRequest,
+	configuredChain []string,
 ) (*EndpointSelectionResult, error) {
-	model, fallbackInfo, err := s.modelSelector.FindAvailableModelWithFallback(role, originalModel, endpoints)
+	model, fallbackInfo, err := s.modelSelector.FindAvailableModelWithFallback(role, originalModel, endpoints, configuredChain)
 	if err != nil {
 		return nil, err
 	}
-	ep := s.selectEndpointForModel(model, endpoints, nil)
+	ep := s.selectEndpointForModel(model, endpoints, req)
 	if ep == nil {
 		return nil, fmt.Errorf("no endpoint selected for model %s", model.Name)
 	}
@@ -177,7 +299,33 @@ func (s *EndpointSelector) selectWithFallback(
 	}, nil
 }
 
-// selectEndpointForModel selects a healthy endpoint for the given model using load balancer.
+// smartRoutingChain is the role fallback chain for a smart-routed request
+// inferred as role. With the default fallback enabled it ends at the default
+// role even when the configured chain stops short of it; disabled, the chain
+// never crosses to the default role.
+func (s *EndpointSelector) smartRoutingChain(role models.ModelRole, configured []string) []string {
+	var chain []string
+	reachesDefault := false
+	for _, r := range RoleFallbackChain(role, configured) {
+		if r == models.ModelRoleDefault && r != role {
+			if !s.defaultFallback {
+				continue
+			}
+			reachesDefault = true
+		}
+		chain = append(chain, string(r))
+	}
+	if s.defaultFallback && role != models.ModelRoleDefault && !reachesDefault {
+		chain = append(chain, string(models.ModelRoleDefault))
+	}
+	return chain
+}
+
+// selectEndpointForModel selects a healthy endpoint for the given model.
+// Providers approaching their rate limits are skipped when others have
+// headroom; of the rest the endpoint the conversation last succeeded on is
+// kept if there is one, and otherwise only the best provider priority tier
+// is considered and the load balancer breaks ties within that tier.
 func (s *EndpointSelector) selectEndpointForModel(
 	model *models.Model,
 	endpoints []*models.Endpoint,
@@ -187,7 +335,11 @@ func (s *EndpointSelector) selectEndpointForModel(
 	if len(candidates) == 0 {
 		return nil
 	}
-	return s.loadBalancer.Select(candidates, req)
+	candidates = avoidThrottled(s.healthChecker, candidates)
+	if ep := s.affinity.Preferred(req, candidates); ep != nil {
+		return ep
+	}
+	return s.loadBalancer.Select(preferredTier(candidates), req)
 }
 
 // findModelByName finds a model by exact name (case-insensitive) from the endpoint list.
@@ -4,11 +4,19 @@
 package service
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/user/llm-proxy-go/internal/config"
 	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
 	"go.uber.org/zap"
 )
 
@@ -61,3 +69,340 @@ func TestFindModelByName(t *testing.T) {
 		})
 	}
 }
+
+func TestSelectEndpointForModel_CostFirstPriority(t *testing.T) {
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	lb := NewLoadBalancerWithStrategy(models.StrategyWeighted)
+	ms := NewModelSelector(hc, logger)
+	es := NewEndpointSelector(ms, hc, lb, nil, nil, logger)
+
+	model := &models.Model{ID: 1, Name: "claude-sonnet-4", Role: models.ModelRoleDefault, Enabled: true}
+	// Cheapest provider gets the best priority; the expensive one carries more
+	// weight so a plain weighted balancer would usually prefer it.
+	cheap := &models.Endpoint{Model: model, Provider: &models.Provider{ID: 1, Name: "cheap", Weight: 1, Priority: 0}}
+	mid := &models.Endpoint{Model: model, Provider: &models.Provider{ID: 2, Name: "mid", Weight: 50, Priority: 1}}
+	pricey := &models.Endpoint{Model: model, Provider: &models.Provider{ID: 3, Name: "pricey", Weight: 100, Priority: 2}}
+	endpoints := []*models.Endpoint{pricey, mid, cheap}
+	registerHealthyEndpoints(hc, endpoints)
+
+	for range 50 {
+		ep := es.selectEndpointForModel(model, endpoints, nil)
+		assert.Equal(t, "cheap", ep.Provider.Name)
+	}
+
+	hc.UpdateState(EndpointName(cheap), models.EndpointUnhealthy, "down")
+	for range 50 {
+		ep := es.selectEndpointForModel(model, endpoints, nil)
+		assert.Equal(t, "mid", ep.Provider.Name)
+	}
+}
+
+func TestPreferredTier(t *testing.T) {
+	a := createTestEndpoint("a", "m", 1)
+	b := createTestEndpoint("b", "m", 1)
+	c := createTestEndpoint("c", "m", 1)
+	b.Provider.Priority = 1
+	c.Provider.Priority = 1
+
+	assert.Equal(t, []*models.Endpoint{a}, preferredTier([]*models.Endpoint{b, a, c}))
+	assert.Equal(t, []*models.Endpoint{b, c}, preferredTier([]*models.Endpoint{b, c}))
+	assert.Empty(t, preferredTier(nil))
+}
+
+func TestSelectEndpointForModel_AvoidsProviderNearRateLimit(t *testing.T) {
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	lb := NewLoadBalancerWithStrategy(models.StrategyWeighted)
+	ms := NewModelSelector(hc, logger)
+	es := NewEndpointSelector(ms, hc, lb, nil, nil, logger)
+
+	model := &models.Model{ID: 1, Name: "claude-sonnet-4", Role: models.ModelRoleDefault, Enabled: true}
+	// The busy provider carries far more weight and would normally win.
+	busy := &models.Endpoint{Model: model, Provider: &models.Provider{ID: 1, Name: "busy", Weight: 100, RPMLimit: 10}}
+	idle := &models.Endpoint{Model: model, Provider: &models.Provider{ID: 2, Name: "idle", Weight: 1, RPMLimit: 10}}
+	endpoints := []*models.Endpoint{busy, idle}
+	registerHealthyEndpoints(hc, endpoints)
+
+	for range 9 {
+		hc.RecordProviderRequest("busy")
+	}
+	assert.True(t, hc.IsNearRateLimit(busy.Provider))
+	assert.False(t, hc.IsNearRateLimit(idle.Provider))
+
+	for range 50 {
+		ep := es.selectEndpointForModel(model, endpoints, nil)
+		assert.Equal(t, "idle", ep.Provider.Name)
+	}
+
+	// When every provider is near its limit, selection still succeeds.
+	for range 9 {
+		hc.RecordProviderRequest("idle")
+	}
+	assert.NotNil(t, es.selectEndpointForModel(model, endpoints, nil))
+}
+
+func TestHealthChecker_ProviderUsage(t *testing.T) {
+	hc := NewHealthChecker(config.HealthCheckConfig{}, zap.NewNop())
+	p := &models.Provider{Name: "p", RPMLimit: 100, TPMLimit: 1000}
+
+	hc.RecordProviderRequest("p")
+	hc.RecordProviderTokens("p", 600)
+	hc.RecordProviderTokens("p", 0)
+
+	usage := hc.ProviderUsage(p)
+	assert.Equal(t, 1, usage.RequestsPerMinute)
+	assert.Equal(t, 600, usage.TokensPerMinute)
+	assert.InDelta(t, 0.6, usage.Utilization, 1e-9)
+	assert.False(t, usage.Throttled)
+
+	hc.RecordProviderTokens("p", 300)
+	assert.True(t, hc.IsNearRateLimit(p))
+
+	// Providers without limits are never throttled.
+	assert.False(t, hc.IsNearRateLimit(&models.Provider{Name: "p"}))
+}
+
+func TestSelectEndpoint_RoutingTriggerModels(t *testing.T) {
+	logger := zap.NewNop()
+	db := testutil.NewTestDB(t)
+	_, err := db.Exec(`INSERT INTO routing_llm_config (id, routing_trigger_models) VALUES (1, '["claude-3-opus-latest"]')`)
+	require.NoError(t, err)
+	rcr := repository.NewRoutingConfigRepository(db, logger)
+
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	lb := NewLoadBalancerWithStrategy(models.StrategyRoundRobin)
+	es := NewEndpointSelector(NewModelSelector(hc, logger), hc, lb, nil, rcr, logger)
+
+	endpoints := []*models.Endpoint{
+		{
+			Model:    &models.Model{ID: 1, Name: "claude-sonnet-4-20250514", Role: models.ModelRoleDefault, Enabled: true},
+			Provider: &models.Provider{ID: 1, Name: "provider-1", Weight: 1, Enabled: true},
+		},
+		{
+			Model:    &models.Model{ID: 2, Name: "claude-haiku-4-5-20251001", Role: models.ModelRoleSimple, Enabled: true},
+			Provider: &models.Provider{ID: 2, Name: "provider-2", Weight: 1, Enabled: true},
+		},
+	}
+	hc.Start(endpoints)
+	defer hc.Stop()
+	ctx := context.Background()
+
+	// The configured trigger is routed (to the default role without an LLM router).
+	result, err := es.SelectEndpoint(ctx, &models.AnthropicRequest{Model: "Claude-3-Opus-Latest"}, endpoints)
+	require.NoError(t, err)
+	assert.Equal(t, "claude-sonnet-4-20250514", result.Model.Name)
+
+	// A concrete model that is not a trigger bypasses routing.
+	result, err = es.SelectEndpoint(ctx, &models.AnthropicRequest{Model: "claude-haiku-4-5-20251001"}, endpoints)
+	require.NoError(t, err)
+	assert.Equal(t, "claude-haiku-4-5-20251001", result.Model.Name)
+
+	// "auto" is no longer special once the triggers are replaced.
+	_, err = es.SelectEndpoint(ctx, &models.AnthropicRequest{Model: "auto"}, endpoints)
+	assert.ErrorContains(t, err, "not configured")
+
+	// Without a config row "auto" is the default trigger.
+	_, err = db.Exec(`DELETE FROM routing_llm_config`)
+	require.NoError(t, err)
+	result, err = es.SelectEndpoint(ctx, &models.AnthropicRequest{Model: "auto"}, endpoints)
+	require.NoError(t, err)
+	assert.Equal(t, "claude-sonnet-4-20250514", result.Model.Name)
+}
+
+func TestSelectForcedRole(t *testing.T) {
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	lb := NewLoadBalancerWithStrategy(models.StrategyRoundRobin)
+	es := NewEndpointSelector(NewModelSelector(hc, logger), hc, lb, nil, nil, logger)
+
+	endpoints := []*models.Endpoint{
+		{
+			Model:    &models.Model{ID: 1, Name: "claude-sonnet-4-20250514", Role: models.ModelRoleDefault, Enabled: true},
+			Provider: &models.Provider{ID: 1, Name: "provider-1", Weight: 1, Enabled: true},
+		},
+		{
+			Model:    &models.Model{ID: 2, Name: "claude-haiku-4-5-20251001", Role: models.ModelRoleSimple, Enabled: true},
+			Provider: &models.Provider{ID: 2, Name: "provider-2", Weight: 1, Enabled: true},
+		},
+	}
+	hc.Start(endpoints)
+	defer hc.Stop()
+
+	// The requested model does not matter.
+	result, err := es.SelectForcedRole(models.ModelRoleSimple, &models.AnthropicRequest{Model: "claude-sonnet-4-20250514"}, endpoints)
+	require.NoError(t, err)
+	assert.Equal(t, "claude-haiku-4-5-20251001", result.Model.Name)
+	assert.Equal(t, models.ModelRoleSimple, result.TaskType)
+	assert.Nil(t, result.FallbackInfo)
+	require.NotNil(t, result.RoutingDecision)
+	assert.Equal(t, "forced", routingMethodFromDecision(result.RoutingDecision))
+
+	// No silent fallback to another role.
+	_, err = es.SelectForcedRole(models.ModelRoleComplex, &models.AnthropicRequest{}, endpoints)
+	assert.ErrorIs(t, err, ErrNoEndpointForRole)
+
+	_, err = es.SelectForcedRole("fast", &models.AnthropicRequest{}, endpoints)
+	assert.ErrorIs(t, err, ErrInvalidForcedRole)
+
+	// Configured but unhealthy is not a client error.
+	hc.UpdateState("provider-2/claude-haiku-4-5-20251001", models.EndpointUnhealthy, "down")
+	_, err = es.SelectForcedRole(models.ModelRoleSimple, &models.AnthropicRequest{}, endpoints)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNoEndpointForRole)
+}
+
+func TestSelectEndpoint_RoleFallbackChain(t *testing.T) {
+	logger := zap.NewNop()
+	db := testutil.NewTestDB(t)
+	rcr := repository.NewRoutingConfigRepository(db, logger)
+
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	lb := NewLoadBalancerWithStrategy(models.StrategyRoundRobin)
+	es := NewEndpointSelector(NewModelSelector(hc, logger), hc, lb, nil, rcr, logger)
+
+	endpoints := []*models.Endpoint{
+		{
+			Model:    &models.Model{ID: 1, Name: "claude-opus-4-20250514", Role: models.ModelRoleComplex, Enabled: true},
+			Provider: &models.Provider{ID: 1, Name: "provider-1", Weight: 1, Enabled: true},
+		},
+		{
+			Model:    &models.Model{ID: 2, Name: "claude-haiku-4-5-20251001", Role: models.ModelRoleSimple, Enabled: true},
+			Provider: &models.Provider{ID: 2, Name: "provider-2", Weight: 1, Enabled: true},
+		},
+	}
+	hc.Start(endpoints)
+	defer hc.Stop()
+	hc.UpdateState("provider-1/claude-opus-4-20250514", models.EndpointUnhealthy, "down")
+	ctx := context.Background()
+	req := &models.AnthropicRequest{Model: "claude-opus-4-20250514"}
+
+	// The built-in order stops at default, which has no model.
+	_, err := es.SelectEndpoint(ctx, req, endpoints)
+	require.Error(t, err)
+
+	_, err = db.Exec(`INSERT INTO routing_llm_config (id, role_fallback_chain) VALUES (1, '["complex","default","simple"]')`)
+	require.NoError(t, err)
+	result, err := es.SelectEndpoint(ctx, req, endpoints)
+	require.NoError(t, err)
+	assert.Equal(t, "claude-haiku-4-5-20251001", result.Model.Name)
+	assert.Equal(t, models.ModelRoleSimple, result.TaskType)
+	require.NotNil(t, result.FallbackInfo)
+	assert.Equal(t, models.ModelRoleComplex, result.FallbackInfo.OriginalRole)
+	assert.Equal(t, models.ModelRoleSimple, result.FallbackInfo.FallbackRole)
+	assert.Equal(t, []string{"complex", "default", "simple"}, result.FallbackInfo.FallbackChain)
+}
+
+func TestSelectEndpoint_RoutingLatency(t *testing.T) {
+	logger := zap.NewNop()
+	db := testutil.NewTestDB(t)
+
+	routingLLM := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"{\"task_type\":\"simple\",\"reason\":\"greeting\"}"}}]}`)
+	}))
+	defer routingLLM.Close()
+	_, err := db.Exec(`INSERT INTO providers (id, name, base_url, api_key) VALUES (1, 'router', ?, 'k')`, routingLLM.URL)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO routing_models (id, provider_id, model_name) VALUES (1, 1, 'router-model')`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO routing_llm_config (id, enabled, primary_model_id, rule_fallback_strategy, timeout_seconds, cache_enabled)
+		VALUES (1, 1, 1, 'llm', 5, 0)`)
+	require.NoError(t, err)
+
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	lb := NewLoadBalancerWithStrategy(models.StrategyRoundRobin)
+	rcr := repository.NewRoutingConfigRepository(db, logger)
+	es := NewEndpointSelector(NewModelSelector(hc, logger), hc, lb, NewLLMRouter(db, nil, nil, logger), rcr, logger)
+
+	endpoints := []*models.Endpoint{
+		{
+			Model:    &models.Model{ID: 2, Name: "claude-haiku-4-5-20251001", Role: models.ModelRoleSimple, Enabled: true},
+			Provider: &models.Provider{ID: 2, Name: "provider-2", Weight: 1, Enabled: true},
+		},
+	}
+	hc.Start(endpoints)
+	defer hc.Stop()
+
+	req := &models.AnthropicRequest{
+		Model:    "auto",
+		Messages: []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello there"}}},
+	}
+	result, err := es.SelectEndpoint(context.Background(), req, endpoints)
+	require.NoError(t, err)
+	assert.Equal(t, models.ModelRoleSimple, result.TaskType)
+	assert.GreaterOrEqual(t, result.RoutingLatencyMs, 20.0)
+
+	// A concrete model is not routed.
+	result, err = es.SelectEndpoint(context.Background(), &models.AnthropicRequest{Model: "claude-haiku-4-5-20251001"}, endpoints)
+	require.NoError(t, err)
+	assert.Zero(t, result.RoutingLatencyMs)
+}
+
+func TestSelectEndpoint_DefaultFallback(t *testing.T) {
+	logger := zap.NewNop()
+	db := testutil.NewTestDB(t)
+
+	routingLLM := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"{\"task_type\":\"complex\",\"reason\":\"design work\"}"}}]}`)
+	}))
+	defer routingLLM.Close()
+	_, err := db.Exec(`INSERT INTO providers (id, name, base_url, api_key) VALUES (1, 'router', ?, 'k')`, routingLLM.URL)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO routing_models (id, provider_id, model_name) VALUES (1, 1, 'router-model')`)
+	require.NoError(t, err)
+	// The custom chain stops at complex, so nothing else is tried.
+	_, err = db.Exec(`INSERT INTO routing_llm_config (id, enabled, primary_model_id, rule_fallback_strategy, timeout_seconds, cache_enabled, role_fallback_chain)
+		VALUES (1, 1, 1, 'llm', 5, 0, '["complex"]')`)
+	require.NoError(t, err)
+
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	lb := NewLoadBalancerWithStrategy(models.StrategyRoundRobin)
+	rcr := repository.NewRoutingConfigRepository(db, logger)
+	es := NewEndpointSelector(NewModelSelector(hc, logger), hc, lb, NewLLMRouter(db, nil, nil, logger), rcr, logger)
+
+	endpoints := []*models.Endpoint{
+		{
+			Model:    &models.Model{ID: 1, Name: "claude-opus-4-20250514", Role: models.ModelRoleComplex, Enabled: true},
+			Provider: &models.Provider{ID: 1, Name: "provider-1", Weight: 1, Enabled: true},
+		},
+		{
+			Model:    &models.Model{ID: 2, Name: "claude-sonnet-4-20250514", Role: models.ModelRoleDefault, Enabled: true},
+			Provider: &models.Provider{ID: 2, Name: "provider-2", Weight: 1, Enabled: true},
+		},
+	}
+	hc.Start(endpoints)
+	defer hc.Stop()
+	hc.UpdateState("provider-1/claude-opus-4-20250514", models.EndpointUnhealthy, "down")
+	req := &models.AnthropicRequest{
+		Model:    "auto",
+		Messages: []models.Message{{Role: "user", Content: models.MessageContent{Text: "Design a distributed scheduler"}}},
+	}
+
+	result, err := es.SelectEndpoint(context.Background(), req, endpoints)
+	require.NoError(t, err)
+	assert.Equal(t, "claude-sonnet-4-20250514", result.Model.Name)
+	assert.Equal(t, models.ModelRoleComplex, result.TaskType, "the inferred role is the task type")
+	require.NotNil(t, result.RoutingDecision)
+	assert.Equal(t, models.ModelRoleComplex, result.RoutingDecision.TaskType, "the inferred role is kept")
+	require.NotNil(t, result.FallbackInfo)
+	assert.Equal(t, models.ModelRoleComplex, result.FallbackInfo.OriginalRole)
+	assert.Equal(t, models.ModelRoleDefault, result.FallbackInfo.FallbackRole)
+	assert.Equal(t, []string{"complex", "default"}, result.FallbackInfo.FallbackChain)
+
+	// A concrete model still fails hard.
+	_, err = es.SelectEndpoint(context.Background(), &models.AnthropicRequest{Model: "claude-opus-4-20250514"}, endpoints)
+	require.Error(t, err)
+
+	// Disabled, smart routing never crosses to the default role, not even
+	// along the builtin chain that includes it.
+	es.SetDefaultFallback(false)
+	_, err = es.SelectEndpoint(context.Background(), req, endpoints)
+	require.Error(t, err)
+	_, err = db.Exec(`UPDATE routing_llm_config SET role_fallback_chain = '[]' WHERE id = 1`)
+	require.NoError(t, err)
+	_, err = es.SelectEndpoint(context.Background(), req, endpoints)
+	require.Error(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/user/llm-proxy-go/internal/models"
 	"github.com/user/llm-proxy-go/internal/repository"
@@ -11,13 +12,16 @@ import (
 )
 
 // EndpointStore provides thread-safe, centralized endpoint management.
-// All consumers read endpoints dynamically via GetEndpoints().
+// All consumers read endpoints dynamically via GetEndpoints(). Endpoints of
+// shadow providers are kept apart, see GetShadowEndpoints.
 type EndpointStore struct {
 	mu            sync.RWMutex
 	endpoints     []*models.Endpoint
+	shadow        []*models.Endpoint
 	modelRepo     *repository.SQLModelRepository
 	providerRepo  *repository.SQLProviderRepository
 	healthChecker *HealthChecker
+	limiter       *ProviderLimiter
 	logger        *zap.Logger
 }
 
@@ -41,14 +45,24 @@ func (s *EndpointStore) SetHealthChecker(hc *HealthChecker) {
 	s.healthChecker = hc
 }
 
+// SetProviderLimiter injects the ProviderLimiter whose limits follow the
+// loaded providers' MaxConcurrent.
+func (s *EndpointStore) SetProviderLimiter(l *ProviderLimiter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limiter = l
+	l.Update(s.endpoints)
+}
+
 // Load performs the initial endpoint load from the database.
 func (s *EndpointStore) Load(ctx context.Context) error {
-	endpoints, err := s.loadFromDB(ctx)
+	endpoints, shadow, err := s.loadFromDB(ctx)
 	if err != nil {
 		return err
 	}
 	s.mu.Lock()
-	s.endpoints = endpoints
+	s.endpoints, s.shadow = endpoints, shadow
+	s.limiter.Update(endpoints)
 	s.mu.Unlock()
 	s.logger.Info("endpoints loaded", zap.Int("count", len(endpoints)))
 	return nil
@@ -56,22 +70,47 @@ func (s *EndpointStore) Load(ctx context.Context) error {
 
 // Reload re-reads endpoints from the database and atomically replaces the slice.
 func (s *EndpointStore) Reload(ctx context.Context) error {
-	endpoints, err := s.loadFromDB(ctx)
+	endpoints, shadow, err := s.loadFromDB(ctx)
 	if err != nil {
 		s.logger.Error("failed to reload endpoints", zap.Error(err))
 		return err
 	}
 	s.mu.Lock()
-	s.endpoints = endpoints
+	s.endpoints, s.shadow = endpoints, shadow
+	s.limiter.Update(endpoints)
 	s.mu.Unlock()
 	s.logger.Info("endpoints reloaded", zap.Int("count", len(endpoints)))
 	return nil
 }
 
 // ReloadAndNotify reloads endpoints and notifies the HealthChecker.
+// Removed endpoints drain in the background.
 func (s *EndpointStore) ReloadAndNotify(ctx context.Context) {
+	s.reloadAndNotify(ctx)
+}
+
+// ReloadAndDrain reloads endpoints like ReloadAndNotify, then waits up to
+// timeout for removed endpoints to finish their in-flight requests. It
+// returns the endpoints still draining at the timeout, with their active
+// connections; those keep draining in the background.
+func (s *EndpointStore) ReloadAndDrain(ctx context.Context, timeout time.Duration) (map[string]int, error) {
+	hc, err := s.reloadAndNotify(ctx)
+	if err != nil || hc == nil {
+		return nil, err
+	}
+	draining := hc.WaitDrained(ctx, timeout)
+	for name, conns := range draining {
+		s.logger.Warn("endpoint still draining after reload",
+			zap.String("endpoint", name),
+			zap.Int("active_connections", conns),
+			zap.Duration("waited", timeout))
+	}
+	return draining, nil
+}
+
+func (s *EndpointStore) reloadAndNotify(ctx context.Context) (*HealthChecker, error) {
 	if err := s.Reload(ctx); err != nil {
-		return
+		return nil, err
 	}
 	s.mu.RLock()
 	hc := s.healthChecker
@@ -81,6 +120,7 @@ func (s *EndpointStore) ReloadAndNotify(ctx context.Context) {
 		hc.UpdateEndpoints(eps)
 		hc.CheckNow()
 	}
+	return hc, nil
 }
 
 // GetEndpoints returns the current endpoint snapshot (zero-copy).
@@ -90,12 +130,22 @@ func (s *EndpointStore) GetEndpoints() []*models.Endpoint {
 	return s.endpoints
 }
 
-func (s *EndpointStore) loadFromDB(ctx context.Context) ([]*models.Endpoint, error) {
+// GetShadowEndpoints returns the endpoints of shadow providers, which only
+// receive mirrored requests and are never selected for client traffic.
+func (s *EndpointStore) GetShadowEndpoints() []*models.Endpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.shadow
+}
+
+// loadFromDB builds the serving endpoints and, separately, the endpoints of
+// shadow providers.
+func (s *EndpointStore) loadFromDB(ctx context.Context) ([]*models.Endpoint, []*models.Endpoint, error) {
 	enabledModels, err := s.modelRepo.FindAllEnabled(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("find enabled models: %w", err)
+		return nil, nil, fmt.Errorf("find enabled models: %w", err)
 	}
-	var endpoints []*models.Endpoint
+	var endpoints, shadow []*models.Endpoint
 	for _, m := range enabledModels {
 		providers, err := s.providerRepo.FindByModelID(ctx, m.ID)
 		if err != nil {
@@ -106,12 +156,17 @@ func (s *EndpointStore) loadFromDB(ctx context.Context) ([]*models.Endpoint, err
 			continue
 		}
 		for _, p := range providers {
-			endpoints = append(endpoints, &models.Endpoint{
+			ep := &models.Endpoint{
 				Provider: p,
 				Model:    m,
 				Status:   models.EndpointUnknown,
-			})
+			}
+			if p.Shadow {
+				shadow = append(shadow, ep)
+			} else {
+				endpoints = append(endpoints, ep)
+			}
 		}
 	}
-	return endpoints, nil
+	return endpoints, shadow, nil
 }
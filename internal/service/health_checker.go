@@ -1,9 +1,15 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,34 +28,45 @@ type EndpointState struct {
 	LastCheckTime     *time.Time
 	LastError         string
 	AvgResponseTimeMs float64
+	ProbeLatencyMs    float64 // Latency of the last active probe
 
 	mu              sync.Mutex
 	totalResponseMs float64
+	breaker         circuitBreaker
+	probeFailures   int // Consecutive failed probes, guarded by HealthChecker.mu
 }
 
 // EndpointStateSnapshot is a copy-safe snapshot of EndpointState (no mutex).
 type EndpointStateSnapshot struct {
-	Name               string                `json:"name"`
-	Status             models.EndpointStatus `json:"status"`
-	CurrentConnections int                   `json:"current_connections"`
-	TotalRequests      int                   `json:"total_requests"`
-	TotalErrors        int                   `json:"total_errors"`
-	LastCheckTime      *time.Time            `json:"last_check_time,omitempty"`
-	LastError          string                `json:"last_error,omitempty"`
-	AvgResponseTimeMs  float64               `json:"avg_response_time_ms"`
+	Name                string                `json:"name"`
+	Status              models.EndpointStatus `json:"status"`
+	CurrentConnections  int                   `json:"current_connections"`
+	TotalRequests       int                   `json:"total_requests"`
+	TotalErrors         int                   `json:"total_errors"`
+	LastCheckTime       *time.Time            `json:"last_check_time,omitempty"`
+	LastError           string                `json:"last_error,omitempty"`
+	AvgResponseTimeMs   float64               `json:"avg_response_time_ms"`
+	ProbeLatencyMs      float64               `json:"probe_latency_ms,omitempty"`
+	CircuitState        CircuitState          `json:"circuit_state"`
+	ConsecutiveFailures int                   `json:"consecutive_failures"`
+	CircuitTrips        int                   `json:"circuit_trips"`
 }
 
 // snapshot creates a copy-safe snapshot of the state.
 func (s *EndpointState) snapshot() EndpointStateSnapshot {
 	return EndpointStateSnapshot{
-		Name:               s.Name,
-		Status:             s.Status,
-		CurrentConnections: s.CurrentConnections,
-		TotalRequests:      s.TotalRequests,
-		TotalErrors:        s.TotalErrors,
-		LastCheckTime:      s.LastCheckTime,
-		LastError:          s.LastError,
-		AvgResponseTimeMs:  s.AvgResponseTimeMs,
+		Name:                s.Name,
+		Status:              s.Status,
+		CurrentConnections:  s.CurrentConnections,
+		TotalRequests:       s.TotalRequests,
+		TotalErrors:         s.TotalErrors,
+		LastCheckTime:       s.LastCheckTime,
+		LastError:           s.LastError,
+		AvgResponseTimeMs:   s.AvgResponseTimeMs,
+		ProbeLatencyMs:      s.ProbeLatencyMs,
+		CircuitState:        CircuitClosed,
+		ConsecutiveFailures: s.breaker.consecutiveFailures,
+		CircuitTrips:        s.breaker.trips,
 	}
 }
 
@@ -63,6 +80,13 @@ type HealthChecker struct {
 	states    map[string]*EndpointState
 	endpoints []*models.Endpoint
 
+	// Per-provider request/token usage for rate limit awareness.
+	usageMu sync.Mutex
+	usage   map[string]*providerUsage
+
+	webhook     *HealthWebhook // Notified of healthy/unhealthy transitions; nil = off
+	probeBudget *ProbeBudget   // Caps completion probe spend; nil = unlimited
+
 	cancel context.CancelFunc
 	done   chan struct{}
 }
@@ -76,10 +100,28 @@ func NewHealthChecker(cfg config.HealthCheckConfig, logger *zap.Logger) *HealthC
 		},
 		logger: logger,
 		states: make(map[string]*EndpointState),
+		usage:  make(map[string]*providerUsage),
 		done:   make(chan struct{}),
 	}
 }
 
+// SetWebhook notifies w whenever a probe turns an endpoint healthy or
+// unhealthy, or its circuit breaker opens or closes. Call before Start.
+func (hc *HealthChecker) SetWebhook(w *HealthWebhook) {
+	hc.webhook = w
+}
+
+// SetProbeBudget caps the daily spend of completion probes per provider;
+// providers over budget are probed over TCP instead. Call before Start.
+func (hc *HealthChecker) SetProbeBudget(b *ProbeBudget) {
+	hc.probeBudget = b
+}
+
+// ProbeBudget returns the completion probe budget, nil when unlimited.
+func (hc *HealthChecker) ProbeBudget() *ProbeBudget {
+	return hc.probeBudget
+}
+
 // Start begins periodic health checking.
 func (hc *HealthChecker) Start(endpoints []*models.Endpoint) {
 	// Save endpoints reference for CheckNow().
@@ -171,23 +213,52 @@ func (hc *HealthChecker) checkAll(ctx context.Context, endpoints []*models.Endpo
 
 func (hc *HealthChecker) checkEndpoint(ctx context.Context, ep *models.Endpoint) {
 	name := fmt.Sprintf("%s/%s", ep.Provider.Name, ep.Model.Name)
+	method := hc.probeMethod(ep.Provider)
+	if method == models.HealthCheckMessages && !hc.probeBudget.Allow(ep.Provider.Name, ep.Model) {
+		method = models.HealthCheckTCP
+	}
+
+	switch method {
+	case models.HealthCheckPassive:
+		// No probe: assume healthy until real traffic says otherwise.
+		hc.mu.Lock()
+		if state, ok := hc.states[name]; ok && state.Status == models.EndpointUnknown {
+			now := time.Now()
+			state.Status = models.EndpointHealthy
+			state.LastCheckTime = &now
+		}
+		hc.mu.Unlock()
+		return
+	case models.HealthCheckTCP:
+		start := time.Now()
+		if err := hc.dialProvider(ctx, ep.Provider); err != nil {
+			hc.updateState(name, models.EndpointUnhealthy, err.Error())
+			return
+		}
+		hc.updateProbeState(name, models.EndpointHealthy, "", msSince(start))
+		return
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ep.Provider.BaseURL, nil)
+	// Probes go straight to the provider rather than through the proxy, so
+	// they are never logged, billed or counted against rate limits.
+	req, err := newProbeRequest(ctx, ep, method)
 	if err != nil {
 		hc.updateState(name, models.EndpointUnhealthy, err.Error())
 		return
 	}
-	req.Header.Set("x-api-key", ep.Provider.APIKey)
 
+	start := time.Now()
 	resp, err := hc.client.Do(req)
 	if err != nil {
 		hc.updateState(name, models.EndpointUnhealthy, err.Error())
 		return
 	}
 	defer resp.Body.Close()
+	latencyMs := msSince(start)
 
 	// 401 = invalid key, 403 = quota/permission, <400 = healthy, >=400 = unhealthy
 	var status models.EndpointStatus
+	var errMsg string
 	switch {
 	case resp.StatusCode == http.StatusUnauthorized:
 		status = models.EndpointUnhealthy
@@ -198,21 +269,145 @@ func (hc *HealthChecker) checkEndpoint(ctx context.Context, ep *models.Endpoint)
 	default:
 		status = models.EndpointUnhealthy
 	}
-	hc.updateState(name, status, "")
+	if method == models.HealthCheckMessages {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if status == models.EndpointHealthy {
+			hc.probeBudget.Record(ep.Provider.Name, ep.Model, probeUsage(body))
+		} else {
+			// A failed completion usually names the reason (bad key, no quota).
+			errMsg = fmt.Sprintf("probe returned status %d", resp.StatusCode)
+			if _, msg, ok := parseUpstreamError(body); ok && msg != "" {
+				errMsg += ": " + truncateStr(msg, 200)
+			}
+		}
+	}
+	hc.updateProbeState(name, status, errMsg, latencyMs)
+}
+
+// probeUsage returns the usage reported by a completion probe response, or
+// nil when it reports none.
+func probeUsage(body []byte) *models.Usage {
+	var resp models.AnthropicResponse
+	if json.Unmarshal(body, &resp) != nil || resp.Usage.InputTokens+resp.Usage.OutputTokens == 0 {
+		return nil
+	}
+	return &resp.Usage
+}
+
+// probeMethod returns how the provider is probed: the configured probe mode
+// when set, otherwise the provider's own health check method.
+func (hc *HealthChecker) probeMethod(p *models.Provider) models.HealthCheckMethod {
+	switch hc.cfg.ProbeMode {
+	case config.ProbeModePassive:
+		return models.HealthCheckPassive
+	case config.ProbeModeTCP:
+		return models.HealthCheckTCP
+	case config.ProbeModeCompletion:
+		return models.HealthCheckMessages
+	}
+	return p.HealthCheckMethod
+}
+
+// dialProvider opens and closes a TCP connection to the provider's host.
+func (hc *HealthChecker) dialProvider(ctx context.Context, p *models.Provider) error {
+	u, err := url.Parse(p.BaseURL)
+	if err != nil {
+		return err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	dialer := net.Dialer{Timeout: time.Duration(hc.cfg.TimeoutSeconds) * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// newProbeRequest builds the health probe for method: a minimal one-token
+// /v1/messages request, or a GET to the health check path.
+func newProbeRequest(ctx context.Context, ep *models.Endpoint, method models.HealthCheckMethod) (*http.Request, error) {
+	var req *http.Request
+	var err error
+	if method == models.HealthCheckMessages {
+		body, _ := json.Marshal(models.AnthropicRequest{
+			Model:     ep.Model.Name,
+			MaxTokens: 1,
+			Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "ping"}}},
+		})
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, ep.Provider.MessagesURL(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("anthropic-version", "2023-06-01")
+	} else {
+		target := ep.Provider.BaseURL
+		if path := ep.Provider.HealthCheckPath; path != "" {
+			target = strings.TrimRight(target, "/") + "/" + strings.TrimLeft(path, "/")
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	setProviderAuth(ep.Provider, req.Header)
+	applyCustomHeaders(ep.Provider.CustomHeaders, req.Header)
+	return req, nil
 }
 
 func (hc *HealthChecker) updateState(name string, status models.EndpointStatus, errMsg string) {
 	hc.mu.Lock()
-	defer hc.mu.Unlock()
-
 	state, ok := hc.states[name]
-	if !ok {
+	if !ok || state.Status == models.EndpointDraining {
+		// A probe finishing after its endpoint was removed.
+		hc.mu.Unlock()
 		return
 	}
 	now := time.Now()
+	old := state.Status
 	state.Status = status
 	state.LastCheckTime = &now
 	state.LastError = errMsg
+	if status == models.EndpointUnhealthy {
+		state.probeFailures++
+	} else {
+		state.probeFailures = 0
+	}
+	failures := state.probeFailures
+	hc.mu.Unlock()
+
+	// Only changes between healthy and unhealthy are alerted; an endpoint
+	// leaving the unknown state at startup is not a transition.
+	if old != status && old != models.EndpointUnknown {
+		hc.webhook.Notify(HealthTransition{
+			Endpoint:            name,
+			Source:              HealthSourceProbe,
+			OldStatus:           old,
+			NewStatus:           status,
+			ConsecutiveFailures: failures,
+			Timestamp:           now.UTC(),
+		})
+	}
+}
+
+// updateProbeState records the outcome and latency of an active probe.
+func (hc *HealthChecker) updateProbeState(name string, status models.EndpointStatus, errMsg string, latencyMs float64) {
+	hc.updateState(name, status, errMsg)
+	hc.mu.RLock()
+	state, ok := hc.states[name]
+	hc.mu.RUnlock()
+	if !ok {
+		return
+	}
+	state.mu.Lock()
+	state.ProbeLatencyMs = latencyMs
+	state.mu.Unlock()
 }
 
 // IsHealthy returns whether the named endpoint is healthy.
@@ -223,7 +418,19 @@ func (hc *HealthChecker) IsHealthy(name string) bool {
 	if !ok {
 		return false
 	}
-	return state.Status == models.EndpointHealthy
+	return state.Status == models.EndpointHealthy && hc.breakerAllows(state)
+}
+
+// breakerAllows reports whether the endpoint's circuit breaker admits traffic.
+func (hc *HealthChecker) breakerAllows(state *EndpointState) bool {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.breaker.allows(time.Now(), hc.breakerCooldown())
+}
+
+// breakerCooldown returns how long a tripped breaker stays open.
+func (hc *HealthChecker) breakerCooldown() time.Duration {
+	return time.Duration(hc.cfg.CircuitBreakerCooldownSeconds) * time.Second
 }
 
 // GetHealthyEndpoints returns endpoints that are currently healthy.
@@ -235,7 +442,7 @@ func (hc *HealthChecker) GetHealthyEndpoints(endpoints []*models.Endpoint) []*mo
 	for _, ep := range endpoints {
 		name := fmt.Sprintf("%s/%s", ep.Provider.Name, ep.Model.Name)
 		state, ok := hc.states[name]
-		if ok && state.Status == models.EndpointHealthy {
+		if ok && state.Status == models.EndpointHealthy && hc.breakerAllows(state) {
 			result = append(result, ep)
 		}
 	}
@@ -267,28 +474,145 @@ func (hc *HealthChecker) DecrementConnections(name string) {
 	if state.CurrentConnections > 0 {
 		state.CurrentConnections--
 	}
+	idle := state.CurrentConnections == 0
 	state.mu.Unlock()
+	if idle {
+		hc.dropDrained(name)
+	}
 }
 
-// UpdateRequestStats records a completed request's outcome.
-func (hc *HealthChecker) UpdateRequestStats(name string, success bool, latencyMs float64) {
+// dropDrained removes the state of a draining endpoint once its last
+// connection has finished.
+func (hc *HealthChecker) dropDrained(name string) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	state, ok := hc.states[name]
+	if !ok || state.Status != models.EndpointDraining {
+		return
+	}
+	state.mu.Lock()
+	idle := state.CurrentConnections == 0
+	state.mu.Unlock()
+	if idle {
+		delete(hc.states, name)
+	}
+}
+
+// Draining returns the endpoints removed by a reload that still have
+// requests in flight, with their active connection counts.
+func (hc *HealthChecker) Draining() map[string]int {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	var draining map[string]int
+	for name, state := range hc.states {
+		if state.Status != models.EndpointDraining {
+			continue
+		}
+		if draining == nil {
+			draining = make(map[string]int)
+		}
+		state.mu.Lock()
+		draining[name] = state.CurrentConnections
+		state.mu.Unlock()
+	}
+	return draining
+}
+
+// WaitDrained waits until no endpoint is draining, for at most timeout or
+// until ctx is done. It returns the endpoints still draining, nil when all
+// have drained.
+func (hc *HealthChecker) WaitDrained(ctx context.Context, timeout time.Duration) map[string]int {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		draining := hc.Draining()
+		if len(draining) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return draining
+		case <-deadline.C:
+			return draining
+		case <-ticker.C:
+		}
+	}
+}
+
+// BeginRequest admits a request to the named endpoint through its circuit
+// breaker, claiming the half-open probe atomically. It reports false when
+// the breaker refuses the request; unknown endpoints are admitted.
+func (hc *HealthChecker) BeginRequest(name string) bool {
 	hc.mu.RLock()
 	state, ok := hc.states[name]
 	hc.mu.RUnlock()
 	if !ok {
-		return
+		return true
 	}
 	state.mu.Lock()
 	defer state.mu.Unlock()
+	return state.breaker.admit(time.Now(), hc.breakerCooldown())
+}
+
+// UpdateRequestStats records a completed request's outcome. Every failure
+// counts toward the circuit breaker; RecordRequestError only counts the
+// endpoint's own faults.
+func (hc *HealthChecker) UpdateRequestStats(name string, success bool, latencyMs float64) {
+	hc.recordRequest(name, success, !success, latencyMs)
+}
 
+// RecordRequestError records a completed request's outcome from its error,
+// nil on success. Only failures that are the endpoint's fault feed the
+// circuit breaker (see endpointFault).
+func (hc *HealthChecker) RecordRequestError(name string, err error, latencyMs float64) {
+	hc.recordRequest(name, err == nil, err != nil && endpointFault(err), latencyMs)
+}
+
+// recordRequest updates the request stats and, for successes and endpoint
+// faults, the circuit breaker.
+func (hc *HealthChecker) recordRequest(name string, success, fault bool, latencyMs float64) {
+	hc.mu.RLock()
+	state, ok := hc.states[name]
+	hc.mu.RUnlock()
+	if !ok {
+		return
+	}
+	now := time.Now()
+	state.mu.Lock()
 	state.TotalRequests++
 	if !success {
 		state.TotalErrors++
 	}
+	// The breaker opening or closing is a health transition too; with
+	// passive health checks it is the only one.
+	var transition *HealthTransition
+	if !success && !fault {
+		state.breaker.release()
+	} else if wasOpen := state.breaker.open; state.breaker.record(success, now, hc.cfg.CircuitBreakerThreshold) {
+		hc.logger.Warn("circuit breaker opened",
+			zap.String("endpoint", name),
+			zap.Int("consecutive_failures", state.breaker.consecutiveFailures),
+			zap.Duration("cooldown", hc.breakerCooldown()))
+		transition = &HealthTransition{OldStatus: models.EndpointHealthy, NewStatus: models.EndpointUnhealthy}
+	} else if wasOpen && !state.breaker.open {
+		transition = &HealthTransition{OldStatus: models.EndpointUnhealthy, NewStatus: models.EndpointHealthy}
+	}
 	state.totalResponseMs += latencyMs
 	if state.TotalRequests > 0 {
 		state.AvgResponseTimeMs = state.totalResponseMs / float64(state.TotalRequests)
 	}
+	failures := state.breaker.consecutiveFailures
+	state.mu.Unlock()
+
+	if transition != nil {
+		transition.Endpoint = name
+		transition.Source = HealthSourceCircuitBreaker
+		transition.ConsecutiveFailures = failures
+		transition.Timestamp = now.UTC()
+		hc.webhook.Notify(*transition)
+	}
 }
 
 // GetState returns a snapshot of the named endpoint's state.
@@ -303,6 +627,7 @@ func (hc *HealthChecker) GetState(name string) *EndpointStateSnapshot {
 	state.mu.Lock()
 	defer state.mu.Unlock()
 	snapshot := state.snapshot()
+	snapshot.CircuitState = state.breaker.state(time.Now(), hc.breakerCooldown())
 	return &snapshot
 }
 
@@ -311,9 +636,12 @@ func (hc *HealthChecker) GetAllStates() map[string]EndpointStateSnapshot {
 	hc.mu.RLock()
 	defer hc.mu.RUnlock()
 	result := make(map[string]EndpointStateSnapshot, len(hc.states))
+	now, cooldown := time.Now(), hc.breakerCooldown()
 	for k, v := range hc.states {
 		v.mu.Lock()
-		result[k] = v.snapshot()
+		snapshot := v.snapshot()
+		snapshot.CircuitState = v.breaker.state(now, cooldown)
+		result[k] = snapshot
 		v.mu.Unlock()
 	}
 	return result
@@ -325,7 +653,10 @@ func (hc *HealthChecker) UpdateState(name string, status models.EndpointStatus,
 }
 
 // UpdateEndpoints atomically replaces the endpoint list and reconciles state map.
-// New endpoints get an initial state; removed endpoints are pruned; existing ones keep stats.
+// New endpoints get an initial state; existing ones keep stats. Removed
+// endpoints with requests in flight are marked draining, which keeps them
+// out of selection, and are pruned once their last connection finishes;
+// idle ones are pruned at once.
 func (hc *HealthChecker) UpdateEndpoints(endpoints []*models.Endpoint) {
 	hc.mu.Lock()
 	defer hc.mu.Unlock()
@@ -337,22 +668,33 @@ func (hc *HealthChecker) UpdateEndpoints(endpoints []*models.Endpoint) {
 	for _, ep := range endpoints {
 		name := fmt.Sprintf("%s/%s", ep.Provider.Name, ep.Model.Name)
 		active[name] = struct{}{}
-		if _, exists := hc.states[name]; !exists {
+		status := models.EndpointUnknown
+		if !hc.cfg.Enabled {
+			status = models.EndpointHealthy
+		}
+		if state, exists := hc.states[name]; !exists {
 			// New endpoint — initialize state.
-			status := models.EndpointUnknown
-			if !hc.cfg.Enabled {
-				status = models.EndpointHealthy
-			}
 			hc.states[name] = &EndpointState{
 				Name:   name,
 				Status: status,
 			}
+		} else if state.Status == models.EndpointDraining {
+			// Re-added before it finished draining: probe it again.
+			state.Status = status
 		}
 	}
 
-	// Remove stale entries.
-	for name := range hc.states {
-		if _, ok := active[name]; !ok {
+	// Drain or remove stale entries.
+	for name, state := range hc.states {
+		if _, ok := active[name]; ok {
+			continue
+		}
+		state.mu.Lock()
+		busy := state.CurrentConnections > 0
+		state.mu.Unlock()
+		if busy {
+			state.Status = models.EndpointDraining
+		} else {
 			delete(hc.states, name)
 		}
 	}
@@ -4,6 +4,8 @@
 package service
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -225,6 +227,130 @@ func TestHealthChecker_CheckEndpoint_Healthy(t *testing.T) {
 	assert.Equal(t, models.EndpointHealthy, state.Status)
 }
 
+func TestHealthChecker_CheckEndpoint_ProbeMethods(t *testing.T) {
+	var probes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes = append(probes, r.Method+" "+r.URL.Path)
+		if r.URL.Path == "/v1/messages" && r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		method models.HealthCheckMethod
+		path   string
+		want   []string
+	}{
+		{name: "get health path", method: models.HealthCheckGet, path: "/health", want: []string{"GET /health"}},
+		{name: "messages probe", method: models.HealthCheckMessages, want: []string{"POST /v1/messages"}},
+		{name: "passive", method: models.HealthCheckPassive, want: nil},
+		{name: "tcp dial", method: models.HealthCheckTCP, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probes = nil
+			hc := NewHealthChecker(config.HealthCheckConfig{Enabled: true, IntervalSeconds: 60, TimeoutSeconds: 5}, zap.NewNop())
+			ep := &models.Endpoint{
+				Provider: &models.Provider{
+					Name:              "test-provider",
+					BaseURL:           server.URL,
+					APIKey:            "test-key",
+					HealthCheckMethod: tt.method,
+					HealthCheckPath:   tt.path,
+				},
+				Model: &models.Model{Name: "test-model"},
+			}
+			name := "test-provider/test-model"
+			hc.mu.Lock()
+			hc.states[name] = &EndpointState{Name: name, Status: models.EndpointUnknown}
+			hc.mu.Unlock()
+
+			hc.checkEndpoint(t.Context(), ep)
+
+			assert.Equal(t, tt.want, probes)
+			state := hc.GetState(name)
+			require.NotNil(t, state)
+			assert.Equal(t, models.EndpointHealthy, state.Status)
+		})
+	}
+}
+
+func TestHealthChecker_CheckEndpoint_CompletionProbeMode(t *testing.T) {
+	var probes []string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes = append(probes, r.Method+" "+r.URL.Path)
+		time.Sleep(2 * time.Millisecond)
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			w.Write([]byte(`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`))
+		}
+	}))
+	defer server.Close()
+
+	cfg := config.HealthCheckConfig{Enabled: true, IntervalSeconds: 60, TimeoutSeconds: 5, ProbeMode: config.ProbeModeCompletion}
+	hc := NewHealthChecker(cfg, zap.NewNop())
+	ep := &models.Endpoint{
+		Provider: &models.Provider{
+			Name:              "test-provider",
+			BaseURL:           server.URL,
+			APIKey:            "test-key",
+			HealthCheckMethod: models.HealthCheckGet,
+			HealthCheckPath:   "/health",
+		},
+		Model: &models.Model{Name: "test-model"},
+	}
+	name := "test-provider/test-model"
+	hc.mu.Lock()
+	hc.states[name] = &EndpointState{Name: name, Status: models.EndpointUnknown}
+	hc.mu.Unlock()
+
+	// The probe mode overrides the provider's own GET method.
+	hc.checkEndpoint(t.Context(), ep)
+	assert.Equal(t, []string{"POST /v1/messages"}, probes)
+	state := hc.GetState(name)
+	require.NotNil(t, state)
+	assert.Equal(t, models.EndpointHealthy, state.Status)
+	assert.Greater(t, state.ProbeLatencyMs, 0.0)
+
+	// An auth failure marks the endpoint unhealthy with the upstream reason.
+	status = http.StatusUnauthorized
+	hc.checkEndpoint(t.Context(), ep)
+	state = hc.GetState(name)
+	assert.Equal(t, models.EndpointUnhealthy, state.Status)
+	assert.Contains(t, state.LastError, "401")
+	assert.Contains(t, state.LastError, "invalid x-api-key")
+}
+
+func TestHealthChecker_CheckEndpoint_TCPUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	cfg := config.HealthCheckConfig{Enabled: true, IntervalSeconds: 60, TimeoutSeconds: 1, ProbeMode: config.ProbeModeTCP}
+	hc := NewHealthChecker(cfg, zap.NewNop())
+	ep := &models.Endpoint{
+		Provider: &models.Provider{Name: "test-provider", BaseURL: "http://" + addr},
+		Model:    &models.Model{Name: "test-model"},
+	}
+	name := "test-provider/test-model"
+	hc.mu.Lock()
+	hc.states[name] = &EndpointState{Name: name, Status: models.EndpointUnknown}
+	hc.mu.Unlock()
+
+	hc.checkEndpoint(t.Context(), ep)
+	state := hc.GetState(name)
+	require.NotNil(t, state)
+	assert.Equal(t, models.EndpointUnhealthy, state.Status)
+	assert.NotEmpty(t, state.LastError)
+}
+
 func TestHealthChecker_CheckEndpoint_Unhealthy_ServerError(t *testing.T) {
 	// Create mock server that returns 500
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -385,6 +511,51 @@ func TestEndpointStateSnapshot(t *testing.T) {
 }
 
 // Helper function to create test endpoints
+func TestHealthChecker_UpdateEndpoints_Draining(t *testing.T) {
+	hc := NewHealthChecker(config.HealthCheckConfig{}, zap.NewNop())
+	kept := createHealthTestEndpoint("kept", "model")
+	busy := createHealthTestEndpoint("busy", "model")
+	idle := createHealthTestEndpoint("idle", "model")
+	hc.Start([]*models.Endpoint{kept, busy, idle})
+	hc.IncrementConnections("busy/model")
+
+	hc.UpdateEndpoints([]*models.Endpoint{kept})
+	assert.Nil(t, hc.GetState("idle/model"), "idle endpoints are removed at once")
+	state := hc.GetState("busy/model")
+	require.NotNil(t, state)
+	assert.Equal(t, models.EndpointDraining, state.Status)
+	assert.False(t, hc.IsHealthy("busy/model"))
+	assert.Equal(t, []*models.Endpoint{kept}, hc.GetHealthyEndpoints([]*models.Endpoint{kept, busy}))
+	assert.Equal(t, map[string]int{"busy/model": 1}, hc.Draining())
+
+	// Probes finishing late do not revive a draining endpoint.
+	hc.UpdateState("busy/model", models.EndpointHealthy, "")
+	assert.Equal(t, models.EndpointDraining, hc.GetState("busy/model").Status)
+
+	assert.Equal(t, map[string]int{"busy/model": 1}, hc.WaitDrained(context.Background(), 50*time.Millisecond))
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		hc.DecrementConnections("busy/model")
+	}()
+	assert.Nil(t, hc.WaitDrained(context.Background(), 2*time.Second))
+	assert.Nil(t, hc.GetState("busy/model"), "removed once its last connection finished")
+}
+
+func TestHealthChecker_UpdateEndpoints_ReaddedWhileDraining(t *testing.T) {
+	hc := NewHealthChecker(config.HealthCheckConfig{}, zap.NewNop())
+	ep := createHealthTestEndpoint("p", "model")
+	hc.Start([]*models.Endpoint{ep})
+	hc.IncrementConnections("p/model")
+
+	hc.UpdateEndpoints(nil)
+	assert.Equal(t, models.EndpointDraining, hc.GetState("p/model").Status)
+
+	hc.UpdateEndpoints([]*models.Endpoint{ep})
+	assert.True(t, hc.IsHealthy("p/model"))
+	hc.DecrementConnections("p/model")
+	assert.NotNil(t, hc.GetState("p/model"), "an endpoint back in the config is kept")
+}
+
 func createHealthTestEndpoint(providerName, modelName string) *models.Endpoint {
 	return &models.Endpoint{
 		Provider: &models.Provider{
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+// HealthWebhookSignatureHeader carries "sha256=" followed by the hex
+// HMAC-SHA256 of the request body when a webhook secret is configured.
+const HealthWebhookSignatureHeader = "X-Signature-256"
+
+// Sources of a health transition.
+const (
+	// HealthSourceProbe is an active health check changing the status.
+	HealthSourceProbe = "probe"
+	// HealthSourceCircuitBreaker is real traffic opening or closing the
+	// endpoint's circuit breaker.
+	HealthSourceCircuitBreaker = "circuit_breaker"
+)
+
+// HealthTransition is the JSON body posted to the health webhook.
+type HealthTransition struct {
+	Endpoint            string                `json:"endpoint"`
+	Source              string                `json:"source"`
+	OldStatus           models.EndpointStatus `json:"old_status"`
+	NewStatus           models.EndpointStatus `json:"new_status"`
+	ConsecutiveFailures int                   `json:"consecutive_failures"`
+	Timestamp           time.Time             `json:"timestamp"`
+}
+
+// HealthWebhook posts endpoint health transitions to the webhook in system
+// config. Deliveries run in the background with a short timeout and one
+// retry, so a slow receiver never delays health checks. Only the primary
+// worker sends, so several workers do not alert twice. A nil HealthWebhook
+// sends nothing.
+type HealthWebhook struct {
+	cfg        *cachedConfig[models.HealthWebhookConfig]
+	primary    func() bool
+	client     *http.Client
+	retryDelay time.Duration
+	logger     *zap.Logger
+}
+
+// NewHealthWebhook creates a HealthWebhook reading its settings from repo.
+// isPrimary reports whether this worker is the primary; nil means a single
+// worker.
+func NewHealthWebhook(repo *repository.SystemConfigRepository, isPrimary func() bool, logger *zap.Logger) *HealthWebhook {
+	return &HealthWebhook{
+		cfg:        newCachedConfig("health webhook config", 5*time.Second, repo.GetHealthWebhookConfig, logger),
+		primary:    isPrimary,
+		client:     &http.Client{Timeout: 5 * time.Second},
+		retryDelay: time.Second,
+		logger:     logger,
+	}
+}
+
+// Notify delivers t in the background.
+func (w *HealthWebhook) Notify(t HealthTransition) {
+	if w == nil || (w.primary != nil && !w.primary()) {
+		return
+	}
+	go w.deliver(t)
+}
+
+func (w *HealthWebhook) deliver(t HealthTransition) {
+	cfg := w.cfg.get()
+	if cfg.URL == "" {
+		return
+	}
+	body, err := json.Marshal(t)
+	if err != nil {
+		w.logger.Warn("failed to encode health webhook", zap.Error(err))
+		return
+	}
+	err = w.post(cfg, body)
+	if err != nil {
+		time.Sleep(w.retryDelay)
+		err = w.post(cfg, body)
+	}
+	if err != nil {
+		w.logger.Warn("health webhook delivery failed",
+			zap.String("endpoint", t.Endpoint),
+			zap.String("new_status", string(t.NewStatus)),
+			zap.Error(err))
+	}
+}
+
+func (w *HealthWebhook) post(cfg models.HealthWebhookConfig, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.Secret != "" {
+		req.Header.Set(HealthWebhookSignatureHeader, "sha256="+signWebhookBody(cfg.Secret, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signWebhookBody returns the hex HMAC-SHA256 of body keyed by secret.
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
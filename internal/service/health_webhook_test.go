@@ -0,0 +1,168 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+type webhookDelivery struct {
+	body      []byte
+	signature string
+}
+
+// newTestHealthWebhook returns a HealthWebhook posting to a test server that
+// answers with the given statuses in turn, then 200.
+func newTestHealthWebhook(t *testing.T, secret string, primary func() bool, statuses ...int) (*HealthWebhook, chan webhookDelivery) {
+	t.Helper()
+	deliveries := make(chan webhookDelivery, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- webhookDelivery{body: body, signature: r.Header.Get(HealthWebhookSignatureHeader)}
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	repo := repository.NewSystemConfigRepository(testutil.NewTestDBWithDefaults(t))
+	require.NoError(t, repo.UpdateHealthWebhookConfig(context.Background(), map[string]any{
+		"url":    srv.URL,
+		"secret": secret,
+	}))
+	w := NewHealthWebhook(repo, primary, zap.NewNop())
+	w.retryDelay = 10 * time.Millisecond
+	return w, deliveries
+}
+
+func receiveDelivery(t *testing.T, deliveries chan webhookDelivery) webhookDelivery {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not delivered")
+		return webhookDelivery{}
+	}
+}
+
+func TestHealthChecker_WebhookOnTransition(t *testing.T) {
+	w, deliveries := newTestHealthWebhook(t, "s3cret", nil)
+	hc := NewHealthChecker(config.HealthCheckConfig{Enabled: true}, zap.NewNop())
+	hc.SetWebhook(w)
+	hc.mu.Lock()
+	hc.states["p/m"] = &EndpointState{Name: "p/m", Status: models.EndpointUnknown}
+	hc.mu.Unlock()
+
+	// Leaving the unknown state and staying healthy are not transitions.
+	hc.UpdateState("p/m", models.EndpointHealthy, "")
+	hc.UpdateState("p/m", models.EndpointHealthy, "")
+	hc.UpdateState("p/m", models.EndpointUnhealthy, "boom")
+
+	d := receiveDelivery(t, deliveries)
+	var got HealthTransition
+	require.NoError(t, json.Unmarshal(d.body, &got))
+	assert.Equal(t, "p/m", got.Endpoint)
+	assert.Equal(t, HealthSourceProbe, got.Source)
+	assert.Equal(t, models.EndpointHealthy, got.OldStatus)
+	assert.Equal(t, models.EndpointUnhealthy, got.NewStatus)
+	assert.Equal(t, 1, got.ConsecutiveFailures)
+	assert.False(t, got.Timestamp.IsZero())
+	assert.Equal(t, "sha256="+signWebhookBody("s3cret", d.body), d.signature)
+
+	// A second failure is not a transition; recovering is.
+	hc.UpdateState("p/m", models.EndpointUnhealthy, "boom")
+	hc.UpdateState("p/m", models.EndpointHealthy, "")
+	d = receiveDelivery(t, deliveries)
+	require.NoError(t, json.Unmarshal(d.body, &got))
+	assert.Equal(t, models.EndpointUnhealthy, got.OldStatus)
+	assert.Equal(t, models.EndpointHealthy, got.NewStatus)
+	assert.Equal(t, 0, got.ConsecutiveFailures)
+
+	select {
+	case d := <-deliveries:
+		t.Fatalf("unexpected delivery: %s", d.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestHealthChecker_WebhookOnCircuitBreaker(t *testing.T) {
+	w, deliveries := newTestHealthWebhook(t, "", nil)
+	hc := NewHealthChecker(config.HealthCheckConfig{CircuitBreakerThreshold: 2}, zap.NewNop())
+	hc.SetWebhook(w)
+	hc.mu.Lock()
+	hc.states["p/m"] = &EndpointState{Name: "p/m", Status: models.EndpointHealthy}
+	hc.mu.Unlock()
+
+	// The breaker opening, e.g. under passive health checks, is alerted.
+	hc.UpdateRequestStats("p/m", false, 10)
+	hc.UpdateRequestStats("p/m", false, 10)
+	var got HealthTransition
+	require.NoError(t, json.Unmarshal(receiveDelivery(t, deliveries).body, &got))
+	assert.Equal(t, HealthSourceCircuitBreaker, got.Source)
+	assert.Equal(t, models.EndpointHealthy, got.OldStatus)
+	assert.Equal(t, models.EndpointUnhealthy, got.NewStatus)
+	assert.Equal(t, 2, got.ConsecutiveFailures)
+
+	// Further failures are not transitions; the breaker closing is.
+	hc.UpdateRequestStats("p/m", false, 10)
+	hc.UpdateRequestStats("p/m", true, 10)
+	require.NoError(t, json.Unmarshal(receiveDelivery(t, deliveries).body, &got))
+	assert.Equal(t, HealthSourceCircuitBreaker, got.Source)
+	assert.Equal(t, models.EndpointUnhealthy, got.OldStatus)
+	assert.Equal(t, models.EndpointHealthy, got.NewStatus)
+	assert.Equal(t, 0, got.ConsecutiveFailures)
+
+	select {
+	case d := <-deliveries:
+		t.Fatalf("unexpected delivery: %s", d.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestHealthWebhook_RetriesOnce(t *testing.T) {
+	w, deliveries := newTestHealthWebhook(t, "", nil, http.StatusBadGateway, http.StatusBadGateway)
+	w.Notify(HealthTransition{Endpoint: "p/m", OldStatus: models.EndpointHealthy, NewStatus: models.EndpointUnhealthy})
+
+	first := receiveDelivery(t, deliveries)
+	second := receiveDelivery(t, deliveries)
+	assert.Equal(t, first.body, second.body)
+	assert.Empty(t, first.signature, "unsigned without a secret")
+
+	select {
+	case <-deliveries:
+		t.Fatal("delivery retried more than once")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestHealthWebhook_OnlyPrimarySends(t *testing.T) {
+	w, deliveries := newTestHealthWebhook(t, "", func() bool { return false })
+	w.Notify(HealthTransition{Endpoint: "p/m", OldStatus: models.EndpointHealthy, NewStatus: models.EndpointUnhealthy})
+
+	select {
+	case <-deliveries:
+		t.Fatal("non-primary worker sent a webhook")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	var nilWebhook *HealthWebhook
+	assert.NotPanics(t, func() { nilWebhook.Notify(HealthTransition{}) })
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// IdempotencyKeyHeader is the request header carrying a client-chosen key
+// that makes a retried non-streaming request replay the first response.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+var (
+	// ErrIdempotencyInProgress is returned for a key whose first request
+	// has not finished yet.
+	ErrIdempotencyInProgress = errors.New("a request with this Idempotency-Key is still in progress")
+	// ErrIdempotencyMismatch is returned when a key is reused with a
+	// different request body.
+	ErrIdempotencyMismatch = errors.New("this Idempotency-Key was already used with a different request")
+)
+
+// IdempotencyStore remembers successful non-streaming responses by
+// idempotency key for a short time, so a client retrying after a network
+// error gets the original response instead of paying for a second upstream
+// call. Keys are scoped per user. Failed requests are not remembered and can
+// be retried with the same key.
+type IdempotencyStore struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+}
+
+// idempotencyEntry is a reserved key, holding the response once the first
+// request has succeeded.
+type idempotencyEntry struct {
+	fingerprint string
+	created     time.Time
+	done        bool
+	resp        *models.AnthropicResponse
+	meta        ProxyMetadata
+}
+
+// NewIdempotencyStore creates an IdempotencyStore. It returns nil when
+// idempotency keys are disabled; a nil store ignores all keys.
+func NewIdempotencyStore(cfg config.IdempotencyConfig) *IdempotencyStore {
+	if !cfg.Enabled || cfg.TTLSeconds <= 0 || cfg.MaxEntries <= 0 {
+		return nil
+	}
+	return &IdempotencyStore{
+		ttl:        time.Duration(cfg.TTLSeconds) * time.Second,
+		maxEntries: cfg.MaxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*idempotencyEntry),
+	}
+}
+
+// Reserve claims key for a request. It returns the stored response and its
+// metadata when the key already completed, and an error when the key is in
+// use by a request still running or by a different request. On (nil, nil,
+// nil) the caller owns the key and must call Complete or Release.
+func (s *IdempotencyStore) Reserve(userID int64, key string, req *models.AnthropicRequest) (*models.AnthropicResponse, *ProxyMetadata, error) {
+	fingerprint := requestFingerprint(req)
+	id := idempotencyID(userID, key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if e, ok := s.entries[id]; ok && now.Sub(e.created) <= s.ttl {
+		switch {
+		case e.fingerprint != fingerprint:
+			return nil, nil, ErrIdempotencyMismatch
+		case !e.done:
+			return nil, nil, ErrIdempotencyInProgress
+		}
+		r, m := *e.resp, e.meta
+		return &r, &m, nil
+	}
+
+	if len(s.entries) >= s.maxEntries {
+		s.evict(now)
+	}
+	s.entries[id] = &idempotencyEntry{fingerprint: fingerprint, created: now}
+	return nil, nil, nil
+}
+
+// Complete stores the successful response of a reserved key. The TTL counts
+// from here, so a slow first request is still replayable for the full window.
+func (s *IdempotencyStore) Complete(userID int64, key string, resp *models.AnthropicResponse, meta *ProxyMetadata) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[idempotencyID(userID, key)]
+	if !ok {
+		return
+	}
+	r := *resp
+	e.resp, e.meta = &r, *meta
+	// Only the response headers are replayed from the metadata.
+	e.meta.RequestContent, e.meta.ResponseContent = "", ""
+	e.done = true
+	e.created = s.now()
+}
+
+// Release frees a reserved key after its request failed.
+func (s *IdempotencyStore) Release(userID int64, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := idempotencyID(userID, key)
+	if e, ok := s.entries[id]; ok && !e.done {
+		delete(s.entries, id)
+	}
+}
+
+// evict drops expired entries and, if the store is still full, the oldest
+// completed one. Keys still in progress are kept so a retry never runs twice.
+func (s *IdempotencyStore) evict(now time.Time) {
+	var oldestID string
+	var oldest time.Time
+	for id, e := range s.entries {
+		if now.Sub(e.created) > s.ttl {
+			delete(s.entries, id)
+			continue
+		}
+		if e.done && (oldestID == "" || e.created.Before(oldest)) {
+			oldestID, oldest = id, e.created
+		}
+	}
+	if len(s.entries) >= s.maxEntries && oldestID != "" {
+		delete(s.entries, oldestID)
+	}
+}
+
+func idempotencyID(userID int64, key string) string {
+	return strconv.FormatInt(userID, 10) + ":" + key
+}
+
+// requestFingerprint hashes the request so a key reused for a different
+// request is detected.
+func requestFingerprint(req *models.AnthropicRequest) string {
+	body, _ := json.Marshal(req)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
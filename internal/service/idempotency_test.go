@@ -0,0 +1,104 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+func idempotencyTestRequest(text string) *models.AnthropicRequest {
+	return &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: text}}},
+	}
+}
+
+func TestNewIdempotencyStore_Disabled(t *testing.T) {
+	assert.Nil(t, NewIdempotencyStore(config.IdempotencyConfig{TTLSeconds: 60, MaxEntries: 10}))
+	assert.Nil(t, NewIdempotencyStore(config.IdempotencyConfig{Enabled: true, MaxEntries: 10}))
+}
+
+func TestIdempotencyStore_Replay(t *testing.T) {
+	s := NewIdempotencyStore(config.IdempotencyConfig{Enabled: true, TTLSeconds: 60, MaxEntries: 10})
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	req := idempotencyTestRequest("hello")
+
+	resp, meta, err := s.Reserve(1, "k1", req)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+	assert.Nil(t, meta)
+
+	// A retry while the first request runs must not go upstream.
+	_, _, err = s.Reserve(1, "k1", req)
+	assert.ErrorIs(t, err, ErrIdempotencyInProgress)
+
+	s.Complete(1, "k1",
+		&models.AnthropicResponse{ID: "msg_1", Content: []models.ContentPart{{Type: "text", Text: "hi"}}},
+		&ProxyMetadata{RequestID: "req-1", Cost: 0.5, RequestContent: "hello"})
+
+	resp, meta, err = s.Reserve(1, "k1", req)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, "msg_1", resp.ID)
+	assert.Equal(t, "req-1", meta.RequestID)
+	assert.Equal(t, 0.5, meta.Cost)
+	assert.Empty(t, meta.RequestContent)
+
+	_, _, err = s.Reserve(1, "k1", idempotencyTestRequest("something else"))
+	assert.ErrorIs(t, err, ErrIdempotencyMismatch)
+
+	// Keys are per user.
+	resp, _, err = s.Reserve(2, "k1", req)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// Expired keys start over.
+	now = now.Add(61 * time.Second)
+	resp, _, err = s.Reserve(1, "k1", req)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+}
+
+func TestIdempotencyStore_Release(t *testing.T) {
+	s := NewIdempotencyStore(config.IdempotencyConfig{Enabled: true, TTLSeconds: 60, MaxEntries: 10})
+	req := idempotencyTestRequest("hello")
+
+	_, _, err := s.Reserve(1, "k1", req)
+	require.NoError(t, err)
+	s.Release(1, "k1")
+
+	resp, _, err := s.Reserve(1, "k1", req)
+	require.NoError(t, err, "a failed request can be retried with the same key")
+	assert.Nil(t, resp)
+}
+
+func TestIdempotencyStore_EvictsOldestCompleted(t *testing.T) {
+	s := NewIdempotencyStore(config.IdempotencyConfig{Enabled: true, TTLSeconds: 60, MaxEntries: 2})
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	req := idempotencyTestRequest("hello")
+
+	for _, key := range []string{"a", "b"} {
+		_, _, err := s.Reserve(1, key, req)
+		require.NoError(t, err)
+		s.Complete(1, key, &models.AnthropicResponse{ID: key}, &ProxyMetadata{})
+		now = now.Add(time.Second)
+	}
+	_, _, err := s.Reserve(1, "c", req)
+	require.NoError(t, err)
+
+	assert.Len(t, s.entries, 2)
+	resp, _, err := s.Reserve(1, "b", req)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, "b", resp.ID)
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// keyRateWindow is the sliding window of per-key rate limits.
+const keyRateWindow = time.Minute
+
+// KeyRateLimiter enforces per-API-key request limits over a one-minute
+// sliding window. It is independent of the global rate limit middleware.
+type KeyRateLimiter struct {
+	mu       sync.Mutex
+	requests map[int64][]time.Time
+	now      func() time.Time
+}
+
+// NewKeyRateLimiter creates a KeyRateLimiter.
+func NewKeyRateLimiter() *KeyRateLimiter {
+	return &KeyRateLimiter{requests: make(map[int64][]time.Time), now: time.Now}
+}
+
+// Allow records a request for keyID and reports whether it is within limit
+// requests per minute. When it is not, it also returns how long until the
+// oldest request leaves the window. A limit of 0 or less is unlimited.
+func (l *KeyRateLimiter) Allow(keyID int64, limit int) (bool, time.Duration) {
+	if l == nil || limit <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	cutoff := now.Add(-keyRateWindow)
+	reqs := l.requests[keyID]
+	valid := reqs[:0]
+	for _, t := range reqs {
+		if t.After(cutoff) {
+			valid = append(valid, t)
+		}
+	}
+
+	if len(valid) >= limit {
+		l.requests[keyID] = valid
+		return false, valid[0].Sub(cutoff)
+	}
+	l.requests[keyID] = append(valid, now)
+	return true, 0
+}
@@ -5,12 +5,14 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/user/llm-proxy-go/internal/models"
 	"github.com/user/llm-proxy-go/internal/repository"
@@ -25,38 +27,117 @@ type LLMRouter struct {
 	configRepo    *repository.RoutingConfigRepository
 	modelRepo     *repository.RoutingModelRepository
 	embeddingRepo *repository.EmbeddingCacheRepository
+	semantic      *semanticIndex // Newest L2 embeddings for the semantic lookup
 	routingCache  *RoutingCache
-	embeddingSvc  *EmbeddingService
+	embeddingSvc  Embedder // Embeds messages for the semantic L2 lookup; nil = exact match only
 	ruleRepo      *repository.RoutingRuleRepo
 	logger        *zap.Logger
 	client        *http.Client
+	latency       *routingLatency
+	metrics       *Metrics         // Cache hit/miss counters; nil = disabled
+	roles         *RoleSet         // Known task-type roles; nil = builtin roles only
+	now           func() time.Time // Clock for layer timings; replaceable in tests
 }
 
-// NewLLMRouter creates a new LLMRouter.
+// NewLLMRouter creates a new LLMRouter. routingCache is the L1 cache, shared
+// with the cache monitoring API; nil gives the router a default-sized one.
 func NewLLMRouter(
 	db *sql.DB,
-	embeddingSvc *EmbeddingService,
+	embeddingSvc Embedder,
+	routingCache *RoutingCache,
 	logger *zap.Logger,
 ) *LLMRouter {
+	if routingCache == nil {
+		routingCache = NewRoutingCache(0, logger)
+	}
+	embeddingRepo := repository.NewEmbeddingCacheRepository(db, logger)
 	return &LLMRouter{
 		configRepo:    repository.NewRoutingConfigRepository(db, logger),
 		modelRepo:     repository.NewRoutingModelRepository(db, logger),
-		embeddingRepo: repository.NewEmbeddingCacheRepository(db, logger),
-		routingCache:  NewRoutingCache(10000, logger),
+		embeddingRepo: embeddingRepo,
+		semantic:      newSemanticIndex(embeddingRepo, logger),
+		routingCache:  routingCache,
 		embeddingSvc:  embeddingSvc,
 		ruleRepo:      repository.NewRoutingRuleRepository(db, logger),
 		logger:        logger,
 		client: &http.Client{
 			Timeout: 15 * time.Second,
 		},
+		latency: newRoutingLatency(),
+		now:     time.Now,
+	}
+}
+
+// LatencyStats returns the aggregate time spent in each routing layer since
+// startup, so slow layers (e.g. the routing LLM) can be identified.
+func (r *LLMRouter) LatencyStats() []RoutingLayerLatency {
+	if r == nil {
+		return nil
 	}
+	return r.latency.snapshot()
+}
+
+// timeLayer starts timing a routing layer; call the returned func when the
+// layer is done. Dry runs are not timed.
+func (r *LLMRouter) timeLayer(ctx context.Context, layer RoutingLayer) func() {
+	if isRoutingDryRun(ctx) {
+		return func() {}
+	}
+	start := r.now()
+	return func() { r.latency.record(layer, r.now().Sub(start)) }
+}
+
+// routingDryRunKey marks a context routed as a dry run.
+type routingDryRunKey struct{}
+
+// withRoutingDryRun returns ctx marked for routing without side effects: no
+// rule hit counts, cache writes, metrics or latency are recorded and the
+// routing model is not called.
+func withRoutingDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, routingDryRunKey{}, true)
+}
+
+// isRoutingDryRun reports whether ctx is marked by withRoutingDryRun.
+func isRoutingDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(routingDryRunKey{}).(bool)
+	return dryRun
+}
+
+// SetMetrics records routing cache hits and misses in m.
+func (r *LLMRouter) SetMetrics(m *Metrics) {
+	r.metrics = m
+}
+
+// SetRoleSet sets the roles routing decisions may pick (nil means the
+// builtin roles only).
+func (r *LLMRouter) SetRoleSet(rs *RoleSet) {
+	r.roles = rs
 }
 
 // InferTaskType infers the task type for a request first using rule-based routing,
 // then falling back to LLM routing if configured.
 // Returns (task_type, decision, error).
 // On any failure, returns (ModelRoleDefault, nil, nil) as safe fallback.
-func (r *LLMRouter) InferTaskType(ctx context.Context, req *models.AnthropicRequest) (models.ModelRole, *models.RoutingDecision, error) {
+func (r *LLMRouter) InferTaskType(ctx context.Context, req *models.AnthropicRequest) (taskType models.ModelRole, decision *models.RoutingDecision, err error) {
+	// Rule matches that did not decide, e.g. observe-only ones, stay on
+	// whatever decision the later steps reach.
+	var ruleMatch *models.RuleMatchResult
+	defer func() {
+		if ruleMatch == nil || (decision != nil && decision.RuleMatch != nil) {
+			return
+		}
+		if decision == nil {
+			decision = &models.RoutingDecision{TaskType: taskType, Reason: "fallback: no routing decision"}
+		}
+		decision.RuleMatch = ruleMatch
+	}()
+
+	dryRun := isRoutingDryRun(ctx)
+	metrics := r.metrics
+	if dryRun {
+		metrics = nil
+	}
+
 	// Step 1: Get routing configuration
 	cfg, err := r.configRepo.GetConfig(ctx)
 	if err != nil {
@@ -74,12 +155,17 @@ func (r *LLMRouter) InferTaskType(ctx context.Context, req *models.AnthropicRequ
 
 	// Step 3: Rule-based routing (if enabled)
 	if cfg.RuleBasedRoutingEnabled {
+		done := r.timeLayer(ctx, RoutingLayerRule)
 		taskType, decision, fallback := r.classifyWithRules(ctx, cfg, userMessage)
+		done()
 		if !fallback {
 			// Rule matched - return immediately
 			return taskType, decision, nil
 		}
 		// No rule matched, proceed to fallback strategy
+		if decision != nil && decision.RuleMatch != nil && len(decision.RuleMatch.Matches) > 0 {
+			ruleMatch = decision.RuleMatch
+		}
 	}
 
 	// If rule-based routing is disabled or no rules matched, check if LLM routing is enabled
@@ -101,7 +187,11 @@ func (r *LLMRouter) InferTaskType(ctx context.Context, req *models.AnthropicRequ
 	cacheTTL := cfg.CacheTTLSeconds
 	cacheKey := GetCacheKey(systemContent, userMessage)
 	if cfg.CacheEnabled {
-		if taskType, hit := r.routingCache.Get(cacheKey, cacheTTL); hit {
+		done := r.timeLayer(ctx, RoutingLayerL1)
+		taskType, hit := r.routingCache.Get(cacheKey, cacheTTL)
+		done()
+		metrics.observeCacheLookup("L1", hit)
+		if hit {
 			decision := &models.RoutingDecision{
 				TaskType:  taskType,
 				FromCache: true,
@@ -111,17 +201,26 @@ func (r *LLMRouter) InferTaskType(ctx context.Context, req *models.AnthropicRequ
 		}
 	}
 
-	// Step 5: L2 persistent cache lookup (exact match)
+	// Step 5: L2 persistent cache lookup (exact match, then semantic)
+	contentPreview := routingCachePreview(userMessage)
+	var embedding []float64
 	if cfg.CacheEnabled {
+		done := r.timeLayer(ctx, RoutingLayerL2)
 		entry, err := r.embeddingRepo.GetExactMatch(ctx, cacheKey, cacheTTL)
+		done()
 		if err != nil {
 			r.logger.Warn("L2 cache lookup failed", zap.Error(err))
-		} else if entry != nil {
-			taskType := parseModelRole(entry.TaskType)
-			// Promote to L1
-			r.routingCache.Set(cacheKey, taskType)
-			// Update hit count async
-			go func() { _ = r.embeddingRepo.UpdateHitCountByHash(context.Background(), cacheKey) }()
+		} else {
+			metrics.observeCacheLookup("L2", entry != nil)
+		}
+		if entry != nil {
+			taskType := r.roles.Parse(entry.TaskType)
+			if !dryRun {
+				// Promote to L1
+				r.routingCache.Set(cacheKey, taskType)
+				// Update hit count async
+				go func() { _ = r.embeddingRepo.UpdateHitCountByHash(context.Background(), cacheKey) }()
+			}
 
 			decision := &models.RoutingDecision{
 				TaskType:  taskType,
@@ -131,25 +230,103 @@ func (r *LLMRouter) InferTaskType(ctx context.Context, req *models.AnthropicRequ
 			}
 			return taskType, decision, nil
 		}
+
+		if cfg.SemanticCacheEnabled && r.embeddingSvc != nil {
+			done := r.timeLayer(ctx, RoutingLayerSemantic)
+			var match *repository.EmbeddingCacheEntry
+			embedding, match = r.semanticLookup(ctx, cfg, contentPreview)
+			done()
+			if embedding != nil {
+				metrics.observeCacheLookup("L2-semantic", match != nil)
+			}
+			if match != nil {
+				taskType := r.roles.Parse(match.TaskType)
+				if !dryRun {
+					r.routingCache.Set(cacheKey, taskType)
+					go func() { _ = r.embeddingRepo.UpdateHitCountByHash(context.Background(), match.ContentHash) }()
+				}
+
+				decision := &models.RoutingDecision{
+					TaskType:  taskType,
+					Reason:    match.Reason,
+					FromCache: true,
+					CacheType: "L2-semantic",
+				}
+				return taskType, decision, nil
+			}
+		}
 	}
 
-	// Step 6: Call routing LLM model with retry
-	taskType, decision := r.callRoutingWithRetry(ctx, cfg, systemContent, userMessage)
+	// Step 6: Call routing LLM model with retry, within the routing budget.
+	// The default used when the budget runs out is not cached.
+	if dryRun {
+		return models.ModelRoleDefault, &models.RoutingDecision{
+			TaskType: models.ModelRoleDefault,
+			Reason:   "dry run: routing model not called, using default",
+		}, nil
+	}
+	budget := routingBudget(cfg)
+	done := r.timeLayer(ctx, RoutingLayerLLM)
+	budgetCtx, cancel := context.WithTimeout(ctx, budget)
+	taskType, decision = r.callRoutingWithRetry(budgetCtx, cfg, systemContent, userMessage)
+	budgetErr := budgetCtx.Err()
+	cancel()
+	done()
+	if decision == nil && errors.Is(budgetErr, context.DeadlineExceeded) && ctx.Err() == nil {
+		return models.ModelRoleDefault, &models.RoutingDecision{
+			TaskType: models.ModelRoleDefault,
+			Reason:   fmt.Sprintf("routing budget of %s exhausted, using default", budget),
+		}, nil
+	}
 
 	// Step 7: Save to caches
 	if decision != nil && cfg.CacheEnabled {
 		r.routingCache.Set(cacheKey, taskType)
-
-		contentPreview := userMessage
-		if len(contentPreview) > 200 {
-			contentPreview = contentPreview[:200]
+		if err := r.embeddingRepo.SaveCache(ctx, cacheKey, contentPreview, embedding, string(taskType), decision.Reason); err == nil {
+			r.semantic.add(&repository.EmbeddingCacheEntry{
+				ContentHash: cacheKey,
+				Embedding:   embedding,
+				TaskType:    string(taskType),
+				Reason:      decision.Reason,
+				CreatedAt:   r.now().UTC(),
+			})
 		}
-		_ = r.embeddingRepo.SaveCache(ctx, cacheKey, contentPreview, nil, string(taskType), decision.Reason)
 	}
 
 	return taskType, decision, nil
 }
 
+// routingCachePreview is the part of the user message stored with an L2
+// entry: its first 200 characters. Embeddings are computed from it too,
+// matching the rebuilder.
+func routingCachePreview(userMessage string) string {
+	runes := 0
+	for i := range userMessage {
+		if runes == 200 {
+			return userMessage[:i]
+		}
+		runes++
+	}
+	return userMessage
+}
+
+// semanticLookup embeds text and returns the cached entry, among the newest
+// held by the semantic index within the semantic cache TTL, most similar to
+// it at or above the configured threshold. The embedding is nil when none could be computed, in which case
+// only the exact match applies.
+func (r *LLMRouter) semanticLookup(ctx context.Context, cfg *models.RoutingConfig, text string) ([]float64, *repository.EmbeddingCacheEntry) {
+	embedding, err := r.embeddingSvc.GetEmbedding(ctx, text)
+	if err != nil {
+		r.logger.Warn("embedding for semantic cache failed", zap.Error(err))
+		return nil, nil
+	}
+	if len(embedding) == 0 {
+		return nil, nil
+	}
+
+	return embedding, r.semantic.lookup(ctx, cfg.CacheTTLL3Seconds, embedding, cfg.SimilarityThreshold)
+}
+
 // classifyWithRules runs rule-based classification.
 // Returns (taskType, decision, fallback) where fallback=true means no rule matched.
 func (r *LLMRouter) classifyWithRules(ctx context.Context, cfg *models.RoutingConfig, message string) (models.ModelRole, *models.RoutingDecision, bool) {
@@ -162,17 +339,36 @@ func (r *LLMRouter) classifyWithRules(ctx context.Context, cfg *models.RoutingCo
 	classifier := NewRoutingClassifier(customRules)
 	result := classifier.Classify(message)
 
-	// Increment hit count for matched rule async
+	// Increment hit counts for the matched rule and observe-only rules async
+	var hitIDs []int64
 	if result.Rule != nil && result.Rule.ID > 0 {
-		go func() { _ = r.ruleRepo.IncrementHitCount(context.Background(), result.Rule.ID) }()
+		hitIDs = append(hitIDs, result.Rule.ID)
+	}
+	for _, hit := range result.Matches {
+		if hit.Observe && hit.RuleID > 0 {
+			hitIDs = append(hitIDs, hit.RuleID)
+		}
+	}
+	if len(hitIDs) > 0 && !isRoutingDryRun(ctx) {
+		go func() {
+			for _, id := range hitIDs {
+				_ = r.ruleRepo.IncrementHitCount(context.Background(), id)
+			}
+		}()
 	}
 
-	taskType := parseModelRole(result.TaskType)
+	taskType := r.roles.Parse(result.TaskType)
 	decision := &models.RoutingDecision{
 		TaskType:  taskType,
 		Reason:    result.Reason,
 		FromCache: false,
 		CacheType: "rule",
+		RuleMatch: &models.RuleMatchResult{
+			Rule:     result.Rule,
+			Matches:  result.Matches,
+			TaskType: result.TaskType,
+			Reason:   result.Reason,
+		},
 	}
 
 	// If no rule matched (fallback reason), delegate to fallback strategy
@@ -183,30 +379,50 @@ func (r *LLMRouter) classifyWithRules(ctx context.Context, cfg *models.RoutingCo
 	return taskType, decision, false
 }
 
-// handleFallbackStrategy applies the configured fallback when no rule matches.
-// Returns (taskType, decision, fallback=false) — always resolves.
-func (r *LLMRouter) handleFallbackStrategy(_ context.Context, cfg *models.RoutingConfig, _ *models.RoutingDecision) (models.ModelRole, *models.RoutingDecision, bool) {
+// handleFallbackStrategy applies the configured fallback when no rule
+// matches. The returned decision keeps ruleDecision's RuleMatch, if any, so
+// non-deciding matches are still recorded. fallback=true means the caller
+// should proceed with LLM routing; the decision is then ruleDecision itself.
+func (r *LLMRouter) handleFallbackStrategy(_ context.Context, cfg *models.RoutingConfig, ruleDecision *models.RoutingDecision) (models.ModelRole, *models.RoutingDecision, bool) {
+	var ruleMatch *models.RuleMatchResult
+	if ruleDecision != nil {
+		ruleMatch = ruleDecision.RuleMatch
+	}
 	switch cfg.RuleFallbackStrategy {
 	case models.FallbackLLM:
 		// Signal caller to proceed with LLM routing
-		return models.ModelRoleDefault, nil, true
+		return models.ModelRoleDefault, ruleDecision, true
 	case models.FallbackUserChoice:
-		taskType := parseModelRole(cfg.RuleFallbackTaskType)
+		taskType := r.roles.Parse(cfg.RuleFallbackTaskType)
 		return taskType, &models.RoutingDecision{
 			TaskType:  taskType,
 			Reason:    "fallback: user-configured task type",
 			CacheType: "rule",
+			RuleMatch: ruleMatch,
 		}, false
 	default: // FallbackDefault
 		return models.ModelRoleDefault, &models.RoutingDecision{
 			TaskType:  models.ModelRoleDefault,
 			Reason:    "fallback: no rule matched, using default",
 			CacheType: "rule",
+			RuleMatch: ruleMatch,
 		}, false
 	}
 }
 
+// routingBudget bounds the whole routing model call, retries included: the
+// configured timeout, capped by the proxy's own request timeout since client
+// requests carry no deadline of their own.
+func routingBudget(cfg *models.RoutingConfig) time.Duration {
+	if cfg.TimeoutSeconds <= 0 {
+		return defaultRequestTimeout
+	}
+	return min(time.Duration(cfg.TimeoutSeconds)*time.Second, defaultRequestTimeout)
+}
+
 // callRoutingWithRetry calls the routing LLM with retry and fallback logic.
+// All attempts share ctx, which the caller bounds by the routing budget, so
+// a slow routing model delays a request by at most that budget.
 func (r *LLMRouter) callRoutingWithRetry(
 	ctx context.Context,
 	cfg *models.RoutingConfig,
@@ -221,6 +437,11 @@ func (r *LLMRouter) callRoutingWithRetry(
 	maxAttempts := cfg.RetryCount + 1
 
 	for attempt := range maxAttempts {
+		if ctx.Err() != nil {
+			r.logger.Warn("routing budget exhausted, using default",
+				zap.Int("attempts", attempt), zap.Error(ctx.Err()))
+			return models.ModelRoleDefault, nil
+		}
 		modelCfg, err := r.modelRepo.GetModelWithProvider(ctx, currentModelID)
 		if err != nil || modelCfg == nil {
 			r.logger.Warn("failed to get routing model",
@@ -273,7 +494,7 @@ func (r *LLMRouter) callRoutingModel(
 		"max_tokens":  routingCfg.MaxTokens,
 		"temperature": routingCfg.Temperature,
 		"messages": []map[string]string{
-			{"role": "system", "content": RoutingSystemPrompt},
+			{"role": "system", "content": BuildRoutingSystemPrompt(r.roles.Custom())},
 			{"role": "user", "content": userPrompt},
 		},
 	}
@@ -283,8 +504,8 @@ func (r *LLMRouter) callRoutingModel(
 		return nil, fmt.Errorf("marshal routing request: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/v1/chat/completions", modelCfg.BaseURL)
-	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(routingCfg.TimeoutSeconds)*time.Second)
+	url := modelCfg.ChatCompletionsURL()
+	timeoutCtx, cancel := context.WithTimeout(ctx, routingBudget(routingCfg))
 	defer cancel()
 
 	httpReq, err := http.NewRequestWithContext(timeoutCtx, http.MethodPost, url, bytes.NewReader(bodyBytes))
@@ -328,11 +549,11 @@ func (r *LLMRouter) callRoutingModel(
 	}
 
 	content := chatResp.Choices[0].Message.Content
-	return parseRoutingDecision(content)
+	return parseRoutingDecision(content, r.roles)
 }
 
 // parseRoutingDecision extracts a RoutingDecision from LLM response text.
-func parseRoutingDecision(text string) (*models.RoutingDecision, error) {
+func parseRoutingDecision(text string, roles *RoleSet) (*models.RoutingDecision, error) {
 	jsonStr := extractJSON(text)
 	if jsonStr == "" {
 		return nil, fmt.Errorf("no JSON found in routing response: %s", truncate(text, 200))
@@ -347,7 +568,7 @@ func parseRoutingDecision(text string) (*models.RoutingDecision, error) {
 		return nil, fmt.Errorf("parse routing JSON: %w", err)
 	}
 
-	taskType := parseModelRole(result.TaskType)
+	taskType := roles.Parse(result.TaskType)
 
 	return &models.RoutingDecision{
 		TaskType:  taskType,
@@ -377,19 +598,37 @@ func extractJSON(text string) string {
 	return ""
 }
 
-// extractSystemContent extracts system content from the request.
+// extractSystemContent extracts system content from the request. The system
+// prompt is either a string or, as Claude Code sends it, an array of blocks;
+// the text blocks are joined and other block types ignored. Injected tags
+// are stripped as for user messages.
 func extractSystemContent(req *models.AnthropicRequest) string {
-	if req.System == nil || req.System.IsEmpty() {
+	if req.System.IsEmpty() {
 		return ""
 	}
-	return req.System.String()
+	if !req.System.IsArray {
+		return stripSystemInjections(req.System.Text)
+	}
+	var parts []string
+	for _, block := range req.System.Blocks {
+		if block.Type != "text" {
+			continue
+		}
+		if text := stripSystemInjections(block.Text); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " ")
 }
 
 // extractLastUserMessage extracts the last user message text from the request.
+// Tool calls and tool results in it are summarized as text, so agentic turns
+// that carry only tool output still give rules something to match.
 func extractLastUserMessage(req *models.AnthropicRequest) string {
 	if len(req.Messages) == 0 {
 		return ""
 	}
+	toolNames := toolUseNames(req.Messages)
 
 	// Iterate from the end to find the last user message
 	for i := len(req.Messages) - 1; i >= 0; i-- {
@@ -406,8 +645,11 @@ func extractLastUserMessage(req *models.AnthropicRequest) string {
 
 		var textParts []string
 		for _, part := range parts {
-			if part.Type == "text" && part.Text != "" {
+			switch {
+			case part.Type == "text" && part.Text != "":
 				textParts = append(textParts, part.Text)
+			case part.Type == "tool_use" || part.Type == "tool_result":
+				textParts = append(textParts, summarizeToolPart(part, toolNames))
 			}
 		}
 
@@ -420,6 +662,83 @@ func extractLastUserMessage(req *models.AnthropicRequest) string {
 	return ""
 }
 
+// toolSummaryMaxLen caps how many bytes of a tool call's input or a tool
+// result's output are kept in the routing text.
+const toolSummaryMaxLen = 500
+
+// toolUseNames maps tool_use IDs to tool names, so a tool result can be
+// labelled with the tool that produced it.
+func toolUseNames(messages []models.Message) map[string]string {
+	names := make(map[string]string)
+	for _, msg := range messages {
+		for _, part := range msg.Content.GetParts() {
+			if part.Type == "tool_use" && part.ID != "" {
+				names[part.ID] = part.Name
+			}
+		}
+	}
+	return names
+}
+
+// summarizeToolPart renders a tool_use or tool_result part as a short line:
+// the tool name followed by the truncated input or output.
+func summarizeToolPart(part models.ContentPart, toolNames map[string]string) string {
+	if part.Type == "tool_use" {
+		input, _ := json.Marshal(part.Input)
+		return fmt.Sprintf("[tool_use: %s] %s", part.Name, truncateUTF8(string(input), toolSummaryMaxLen))
+	}
+	label := "tool_result"
+	if part.IsError != nil && *part.IsError {
+		label = "tool_error"
+	}
+	if name := toolNames[part.ToolUseID]; name != "" {
+		label += ": " + name
+	}
+	// Strip injections before truncating, so a cut-off <system-reminder>
+	// cannot survive into the routing text and its cache key.
+	output := stripSystemInjections(toolResultText(part.Content))
+	return fmt.Sprintf("[%s] %s", label, truncateUTF8(output, toolSummaryMaxLen))
+}
+
+// toolResultText returns the text of a tool_result content, which is either
+// a string or a list of content blocks.
+func toolResultText(content any) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []models.ContentPart:
+		var texts []string
+		for _, p := range v {
+			if p.Type == "text" {
+				texts = append(texts, p.Text)
+			}
+		}
+		return strings.Join(texts, "\n")
+	case []any:
+		var texts []string
+		for _, item := range v {
+			if block, ok := item.(map[string]any); ok && block["type"] == "text" {
+				if text, ok := block["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+// truncateUTF8 cuts s to at most maxLen bytes without splitting a rune.
+func truncateUTF8(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	for maxLen > 0 && !utf8.RuneStart(s[maxLen]) {
+		maxLen--
+	}
+	return s[:maxLen]
+}
+
 // systemInjectionRe matches system-injected XML tags from Claude Code clients.
 var systemInjectionRe = regexp.MustCompile(`(?s)<(?:system-reminder|command-name|command-message|command-args|local-command-caveat|local-command-stdout)>.*?</(?:system-reminder|command-name|command-message|command-args|local-command-caveat|local-command-stdout)>`)
 
@@ -430,20 +749,6 @@ func stripSystemInjections(text string) string {
 	return strings.TrimSpace(cleaned)
 }
 
-// parseModelRole converts a string to ModelRole with fallback to default.
-func parseModelRole(s string) models.ModelRole {
-	switch strings.ToLower(strings.TrimSpace(s)) {
-	case "simple":
-		return models.ModelRoleSimple
-	case "complex":
-		return models.ModelRoleComplex
-	case "default":
-		return models.ModelRoleDefault
-	default:
-		return models.ModelRoleDefault
-	}
-}
-
 // truncate truncates a string to maxLen characters.
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
@@ -4,9 +4,20 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/user/llm-proxy-go/internal/models"
 	"github.com/user/llm-proxy-go/tests/testutil"
 	"go.uber.org/zap"
@@ -16,7 +27,7 @@ func TestNewLLMRouter(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	logger := zap.NewNop()
 
-	router := NewLLMRouter(db, nil, logger)
+	router := NewLLMRouter(db, nil, nil, logger)
 	assert.NotNil(t, router)
 	assert.NotNil(t, router.configRepo)
 	assert.NotNil(t, router.modelRepo)
@@ -64,6 +75,36 @@ func TestExtractSystemContent(t *testing.T) {
 			},
 			expected: "",
 		},
+		{
+			name: "string system with injected reminder",
+			req: &models.AnthropicRequest{
+				System: &models.SystemPrompt{Text: "<system-reminder>ignore</system-reminder>\nYou review Go code."},
+			},
+			expected: "You review Go code.",
+		},
+		{
+			name: "array system skips non-text and injected blocks",
+			req: &models.AnthropicRequest{
+				System: &models.SystemPrompt{
+					Blocks: []models.ContentPart{
+						{Type: "text", Text: "You are Claude Code."},
+						{Type: "image", Source: &models.ImageSource{Type: "base64", MediaType: "image/png", Data: "AA=="}},
+						{Type: "text", Text: "<system-reminder>today is Monday</system-reminder>"},
+						{Type: "text", Text: ""},
+						{Type: "text", Text: "Work in the repo. <command-name>/review</command-name>"},
+					},
+					IsArray: true,
+				},
+			},
+			expected: "You are Claude Code. Work in the repo.",
+		},
+		{
+			name: "empty array system",
+			req: &models.AnthropicRequest{
+				System: &models.SystemPrompt{IsArray: true},
+			},
+			expected: "",
+		},
 	}
 
 	for _, tt := range tests {
@@ -74,7 +115,29 @@ func TestExtractSystemContent(t *testing.T) {
 	}
 }
 
+func TestExtractSystemContent_JSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{"string", `{"system":"You are terse."}`, "You are terse."},
+		{"array", `{"system":[{"type":"text","text":"You are terse.","cache_control":{"type":"ephemeral"}},{"type":"text","text":"Prefer Go."}]}`, "You are terse. Prefer Go."},
+		{"null", `{"system":null}`, ""},
+		{"missing", `{}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req models.AnthropicRequest
+			require.NoError(t, json.Unmarshal([]byte(tt.body), &req))
+			assert.Equal(t, tt.expected, extractSystemContent(&req))
+		})
+	}
+}
+
 func TestExtractLastUserMessage(t *testing.T) {
+	isError := true
 	tests := []struct {
 		name     string
 		req      *models.AnthropicRequest
@@ -145,6 +208,44 @@ func TestExtractLastUserMessage(t *testing.T) {
 			},
 			expected: "Actual text",
 		},
+		{
+			name: "tool results summarized with tool name",
+			req: &models.AnthropicRequest{
+				Messages: []models.Message{
+					{Role: "user", Content: models.MessageContent{Text: "Run the tests"}},
+					{Role: "assistant", Content: models.MessageContent{
+						Parts: []models.ContentPart{
+							{Type: "tool_use", ID: "toolu_1", Name: "bash", Input: map[string]any{"command": "go test"}},
+						},
+						IsArray: true,
+					}},
+					{Role: "user", Content: models.MessageContent{
+						Parts: []models.ContentPart{
+							{Type: "tool_result", ToolUseID: "toolu_1", Content: []any{
+								map[string]any{"type": "text", "text": "```\nFAIL\n```"},
+							}},
+						},
+						IsArray: true,
+					}},
+				},
+			},
+			expected: "[tool_result: bash] ```\nFAIL\n```",
+		},
+		{
+			name: "tool use and failed tool result",
+			req: &models.AnthropicRequest{
+				Messages: []models.Message{
+					{Role: "user", Content: models.MessageContent{
+						Parts: []models.ContentPart{
+							{Type: "tool_result", ToolUseID: "toolu_9", Content: "not found", IsError: &isError},
+							{Type: "tool_use", Name: "grep", Input: map[string]any{"pattern": "foo"}},
+						},
+						IsArray: true,
+					}},
+				},
+			},
+			expected: "[tool_error] not found\n[tool_use: grep] {\"pattern\":\"foo\"}",
+		},
 	}
 
 	for _, tt := range tests {
@@ -155,7 +256,19 @@ func TestExtractLastUserMessage(t *testing.T) {
 	}
 }
 
-func TestParseModelRole(t *testing.T) {
+func TestExtractLastUserMessage_TruncatesToolOutput(t *testing.T) {
+	req := &models.AnthropicRequest{
+		Messages: []models.Message{{Role: "user", Content: models.MessageContent{
+			Parts:   []models.ContentPart{{Type: "tool_result", Content: strings.Repeat("日志", 1000)}},
+			IsArray: true,
+		}}},
+	}
+	msg := extractLastUserMessage(req)
+	assert.LessOrEqual(t, len(msg), len("[tool_result] ")+toolSummaryMaxLen)
+	assert.True(t, utf8.ValidString(msg))
+}
+
+func TestRoleSet_ParseBuiltin(t *testing.T) {
 	tests := []struct {
 		name     string
 		input    string
@@ -173,7 +286,8 @@ func TestParseModelRole(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := parseModelRole(tt.input)
+			var roles *RoleSet // nil knows the builtin roles only
+			result := roles.Parse(tt.input)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -266,7 +380,7 @@ func TestParseRoutingDecision(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			decision, err := parseRoutingDecision(tt.input)
+			decision, err := parseRoutingDecision(tt.input, nil)
 			if tt.wantErr {
 				assert.Error(t, err)
 				assert.Nil(t, decision)
@@ -312,7 +426,7 @@ func TestLLMRouter_InferTaskType_RuleBasedDisabled(t *testing.T) {
 	_, execErr = db.Exec(`UPDATE routing_llm_config SET rule_based_routing_enabled = 0, enabled = 0 WHERE id = 1`)
 	assert.NoError(t, execErr)
 
-	router := NewLLMRouter(db, nil, logger)
+	router := NewLLMRouter(db, nil, nil, logger)
 
 	req := &models.AnthropicRequest{
 		Messages: []models.Message{
@@ -333,7 +447,7 @@ func TestLLMRouter_InferTaskType_RuleMatch(t *testing.T) {
 	logger := zap.NewNop()
 
 	// Enable rule-based routing (default)
-	router := NewLLMRouter(db, nil, logger)
+	router := NewLLMRouter(db, nil, nil, logger)
 
 	req := &models.AnthropicRequest{
 		Messages: []models.Message{
@@ -349,12 +463,87 @@ func TestLLMRouter_InferTaskType_RuleMatch(t *testing.T) {
 	assert.Equal(t, "rule", decision.CacheType)
 }
 
+func TestLLMRouter_InferTaskType_ObserveRule(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	_, err := db.Exec(`
+		INSERT INTO routing_rules (name, keywords, task_type, priority, is_builtin, enabled, observe)
+		VALUES ('candidate', '["微服务"]', 'simple', 900, 0, 1, 1)
+	`)
+	require.NoError(t, err)
+	router := NewLLMRouter(db, nil, nil, zap.NewNop())
+
+	req := &models.AnthropicRequest{
+		Messages: []models.Message{
+			{Role: "user", Content: models.MessageContent{Text: "帮我设计一个微服务架构"}},
+		},
+	}
+	taskType, decision, err := router.InferTaskType(t.Context(), req)
+	require.NoError(t, err)
+	assert.Equal(t, models.ModelRoleComplex, taskType, "the observe rule does not change routing")
+	require.NotNil(t, decision.RuleMatch)
+	var observed *models.RuleHit
+	for _, hit := range decision.RuleMatch.Matches {
+		if hit.Observe {
+			observed = hit
+		}
+	}
+	require.NotNil(t, observed, "the observe rule is recorded among the matches")
+	assert.Equal(t, "candidate", observed.Name)
+
+	assert.Eventually(t, func() bool {
+		var hits int
+		_ = db.QueryRow(`SELECT hit_count FROM routing_rules WHERE name = 'candidate'`).Scan(&hits)
+		return hits == 1
+	}, time.Second, 10*time.Millisecond, "observe hits are counted")
+}
+
+func TestLLMRouter_InferTaskType_OnlyObserveRuleMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		wantType models.ModelRole
+	}{
+		{"fallback default", `UPDATE routing_llm_config SET rule_fallback_strategy = 'default' WHERE id = 1`, models.ModelRoleDefault},
+		{"fallback user choice", `UPDATE routing_llm_config SET rule_fallback_strategy = 'user', rule_fallback_task_type = 'complex' WHERE id = 1`, models.ModelRoleComplex},
+		{"fallback llm, llm disabled", `UPDATE routing_llm_config SET rule_fallback_strategy = 'llm', enabled = 0 WHERE id = 1`, models.ModelRoleDefault},
+		{"fallback llm, no routing model", `UPDATE routing_llm_config SET rule_fallback_strategy = 'llm', enabled = 1, primary_model_id = NULL WHERE id = 1`, models.ModelRoleDefault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewTestDB(t)
+			_, err := db.Exec(`INSERT OR IGNORE INTO routing_llm_config (id, enabled) VALUES (1, 0)`)
+			require.NoError(t, err)
+			_, err = db.Exec(tt.config)
+			require.NoError(t, err)
+			_, err = db.Exec(`
+				INSERT INTO routing_rules (name, keywords, task_type, priority, is_builtin, enabled, observe)
+				VALUES ('candidate', '["zzqx"]', 'simple', 900, 0, 1, 1)
+			`)
+			require.NoError(t, err)
+			router := NewLLMRouter(db, nil, nil, zap.NewNop())
+
+			req := &models.AnthropicRequest{
+				Messages: []models.Message{{Role: "user", Content: models.MessageContent{Text: "zzqx"}}},
+			}
+			taskType, decision, err := router.InferTaskType(t.Context(), req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantType, taskType)
+			require.NotNil(t, decision)
+			require.NotNil(t, decision.RuleMatch, "the observe match survives the fallback")
+			assert.Nil(t, decision.RuleMatch.Rule)
+			require.Len(t, decision.RuleMatch.Matches, 1)
+			assert.Equal(t, "candidate", decision.RuleMatch.Matches[0].Name)
+			assert.True(t, decision.RuleMatch.Matches[0].Observe)
+		})
+	}
+}
+
 func TestLLMRouter_InferTaskType_NoRuleMatch_FallbackDefault(t *testing.T) {
 	db := testutil.NewTestDB(t)
 	logger := zap.NewNop()
 
 	// Enable rule-based routing with default fallback (default config)
-	router := NewLLMRouter(db, nil, logger)
+	router := NewLLMRouter(db, nil, nil, logger)
 
 	req := &models.AnthropicRequest{
 		Messages: []models.Message{
@@ -379,7 +568,7 @@ func TestLLMRouter_InferTaskType_NoRuleMatch_FallbackUserChoice(t *testing.T) {
 	_, execErr = db.Exec(`UPDATE routing_llm_config SET rule_fallback_strategy = 'user', rule_fallback_task_type = 'complex' WHERE id = 1`)
 	assert.NoError(t, execErr)
 
-	router := NewLLMRouter(db, nil, logger)
+	router := NewLLMRouter(db, nil, nil, logger)
 
 	req := &models.AnthropicRequest{
 		Messages: []models.Message{
@@ -404,7 +593,7 @@ func TestLLMRouter_InferTaskType_EmptyMessage(t *testing.T) {
 	_, execErr = db.Exec(`UPDATE routing_llm_config SET enabled = 1 WHERE id = 1`)
 	assert.NoError(t, execErr)
 
-	router := NewLLMRouter(db, nil, logger)
+	router := NewLLMRouter(db, nil, nil, logger)
 
 	req := &models.AnthropicRequest{
 		Messages: []models.Message{},
@@ -415,3 +604,230 @@ func TestLLMRouter_InferTaskType_EmptyMessage(t *testing.T) {
 	assert.Equal(t, models.ModelRoleDefault, taskType)
 	assert.Nil(t, decision)
 }
+
+func TestLLMRouter_LatencyStats(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	logger := zap.NewNop()
+
+	routingLLM := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"{\"task_type\":\"simple\",\"reason\":\"greeting\"}"}}]}`)
+	}))
+	defer routingLLM.Close()
+
+	// No rule matches, so the request falls through rules, L1 and L2 to the LLM.
+	_, err := db.Exec(`INSERT INTO providers (id, name, base_url, api_key) VALUES (1, 'router', ?, 'k')`, routingLLM.URL)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO routing_models (id, provider_id, model_name) VALUES (1, 1, 'router-model')`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO routing_llm_config (id, enabled, primary_model_id, rule_fallback_strategy, timeout_seconds)
+		VALUES (1, 1, 1, 'llm', 5)`)
+	require.NoError(t, err)
+
+	router := NewLLMRouter(db, nil, nil, logger)
+	// Each clock reading advances 10ms, so every timed layer takes exactly 10ms.
+	clock := time.Unix(0, 0)
+	router.now = func() time.Time {
+		clock = clock.Add(10 * time.Millisecond)
+		return clock
+	}
+
+	req := &models.AnthropicRequest{
+		Messages: []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello there"}}},
+	}
+	taskType, decision, err := router.InferTaskType(t.Context(), req)
+	require.NoError(t, err)
+	require.NotNil(t, decision)
+	assert.Equal(t, models.ModelRoleSimple, taskType)
+
+	stats := router.LatencyStats()
+	require.Len(t, stats, 5)
+	for _, layer := range stats {
+		if layer.Layer == RoutingLayerSemantic {
+			// No embedding service, so the semantic lookup never runs.
+			assert.Zero(t, layer.Count)
+			continue
+		}
+		assert.Equal(t, int64(1), layer.Count, "layer %s", layer.Layer)
+		assert.Equal(t, 10.0, layer.TotalMs, "layer %s", layer.Layer)
+		assert.Equal(t, 10.0, layer.AvgMs, "layer %s", layer.Layer)
+		assert.Equal(t, 10.0, layer.MaxMs, "layer %s", layer.Layer)
+	}
+
+	// The second identical request is answered by L1 and stops there.
+	_, decision, err = router.InferTaskType(t.Context(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "L1", decision.CacheType)
+
+	counts := map[RoutingLayer]int64{}
+	for _, layer := range router.LatencyStats() {
+		counts[layer.Layer] = layer.Count
+	}
+	assert.Equal(t, map[RoutingLayer]int64{
+		RoutingLayerRule: 2, RoutingLayerL1: 2, RoutingLayerL2: 1, RoutingLayerSemantic: 0, RoutingLayerLLM: 1,
+	}, counts)
+}
+
+func TestLLMRouter_InferTaskType_DryRun(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	logger := zap.NewNop()
+
+	var calls atomic.Int32
+	routingLLM := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"{\"task_type\":\"simple\",\"reason\":\"greeting\"}"}}]}`)
+	}))
+	defer routingLLM.Close()
+
+	_, err := db.Exec(`INSERT INTO providers (id, name, base_url, api_key) VALUES (1, 'router', ?, 'k')`, routingLLM.URL)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO routing_models (id, provider_id, model_name) VALUES (1, 1, 'router-model')`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO routing_llm_config (id, enabled, primary_model_id, rule_fallback_strategy, timeout_seconds)
+		VALUES (1, 1, 1, 'llm', 5)`)
+	require.NoError(t, err)
+
+	router := NewLLMRouter(db, nil, nil, logger)
+	req := &models.AnthropicRequest{
+		Messages: []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello there"}}},
+	}
+	taskType, decision, err := router.InferTaskType(withRoutingDryRun(t.Context()), req)
+	require.NoError(t, err)
+	require.NotNil(t, decision)
+	assert.Equal(t, models.ModelRoleDefault, taskType)
+	assert.Contains(t, decision.Reason, "dry run")
+	assert.Equal(t, int32(0), calls.Load(), "a dry run does not call the routing model")
+	assert.Equal(t, 0, router.routingCache.Size())
+	for _, layer := range router.LatencyStats() {
+		assert.Zero(t, layer.Count, "layer %s", layer.Layer)
+	}
+
+	// A real request still asks the routing model and caches its answer,
+	// which later dry runs may read.
+	_, _, err = router.InferTaskType(t.Context(), req)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+	taskType, decision, err = router.InferTaskType(withRoutingDryRun(t.Context()), req)
+	require.NoError(t, err)
+	assert.Equal(t, models.ModelRoleSimple, taskType)
+	assert.Equal(t, "L1", decision.CacheType)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+// mapEmbedder returns a fixed embedding per text, and none for unknown text.
+type mapEmbedder map[string][]float64
+
+func (m mapEmbedder) GetEmbedding(_ context.Context, text string) ([]float64, error) {
+	return m[text], nil
+}
+
+func TestLLMRouter_InferTaskType_SemanticCache(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	_, err := db.Exec(`INSERT INTO routing_llm_config (id, enabled, rule_based_routing_enabled, similarity_threshold)
+		VALUES (1, 1, 0, 0.9)`)
+	require.NoError(t, err)
+
+	embedder := mapEmbedder{
+		"fix the failing build": {0.98, 0.2, 0},
+		"write me a poem":       {0, 0, 1},
+	}
+	router := NewLLMRouter(db, embedder, nil, zap.NewNop())
+	require.NoError(t, router.embeddingRepo.SaveCache(t.Context(),
+		"other-hash", "fix the broken build", []float64{1, 0, 0}, "complex", "cached decision"))
+
+	req := func(text string) *models.AnthropicRequest {
+		return &models.AnthropicRequest{
+			Messages: []models.Message{{Role: "user", Content: models.MessageContent{Text: text}}},
+		}
+	}
+
+	// A similar message hits the semantic cache and is promoted to L1.
+	taskType, decision, err := router.InferTaskType(t.Context(), req("fix the failing build"))
+	require.NoError(t, err)
+	require.NotNil(t, decision)
+	assert.Equal(t, models.ModelRoleComplex, taskType)
+	assert.Equal(t, "L2-semantic", decision.CacheType)
+	assert.Equal(t, "cached decision", decision.Reason)
+	assert.Equal(t, "cache_l2_semantic", routingMethodFromDecision(decision))
+
+	_, decision, err = router.InferTaskType(t.Context(), req("fix the failing build"))
+	require.NoError(t, err)
+	assert.Equal(t, "L1", decision.CacheType)
+
+	// The routing trace reports the semantic hit.
+	router.routingCache.Clear()
+	trace, err := router.Trace(t.Context(), req("fix the failing build"), false)
+	require.NoError(t, err)
+	assert.True(t, traceLayers(trace)["l2_semantic"].Decisive)
+
+	// A dissimilar message, or one without an embedding, misses.
+	for _, text := range []string{"write me a poem", "no embedding for this"} {
+		_, decision, err = router.InferTaskType(t.Context(), req(text))
+		require.NoError(t, err)
+		if decision != nil {
+			assert.NotEqual(t, "L2-semantic", decision.CacheType, text)
+		}
+	}
+}
+
+func TestRoutingCachePreview(t *testing.T) {
+	assert.Equal(t, "short", routingCachePreview("short"))
+	assert.Equal(t, strings.Repeat("a", 200), routingCachePreview(strings.Repeat("a", 250)))
+
+	// Multi-byte characters are kept whole and counted as one each.
+	preview := routingCachePreview(strings.Repeat("路由", 150))
+	assert.True(t, utf8.ValidString(preview))
+	assert.Equal(t, strings.Repeat("路由", 100), preview)
+}
+
+func TestLLMRouter_InferTaskType_SlowRoutingModel(t *testing.T) {
+	db := testutil.NewTestDB(t)
+
+	var calls atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		io.Copy(io.Discard, r.Body) // Lets the server notice the client hanging up
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	_, err := db.Exec(`INSERT INTO providers (id, name, base_url, api_key) VALUES (1, 'router', ?, 'k')`, slow.URL)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO routing_models (id, provider_id, model_name) VALUES (1, 1, 'router-model')`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO routing_llm_config (id, enabled, primary_model_id, rule_fallback_strategy, rule_fallback_task_type, timeout_seconds, retry_count)
+		VALUES (1, 1, 1, 'llm', 'complex', 1, 2)`)
+	require.NoError(t, err)
+
+	router := NewLLMRouter(db, nil, nil, zap.NewNop())
+	req := &models.AnthropicRequest{
+		Messages: []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello there"}}},
+	}
+
+	t.Run("retries share the budget", func(t *testing.T) {
+		began := time.Now()
+		taskType, decision, err := router.InferTaskType(t.Context(), req)
+		require.NoError(t, err)
+		require.NotNil(t, decision, "the default is explained")
+		assert.Equal(t, "routing budget of 1s exhausted, using default", decision.Reason)
+		assert.Equal(t, models.ModelRoleDefault, taskType)
+		assert.Less(t, time.Since(began), 2500*time.Millisecond)
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Zero(t, router.routingCache.Size(), "not cached")
+	})
+}
+
+func TestRoutingBudget(t *testing.T) {
+	cfg := &models.RoutingConfig{TimeoutSeconds: 5}
+	assert.Equal(t, 5*time.Second, routingBudget(cfg))
+
+	// Capped by the proxy's own request timeout.
+	cfg.TimeoutSeconds = 600
+	assert.Equal(t, defaultRequestTimeout, routingBudget(cfg))
+	cfg.TimeoutSeconds = 0
+	assert.Equal(t, defaultRequestTimeout, routingBudget(cfg))
+}
@@ -40,6 +40,12 @@ type LoadBalancer struct {
 
 	// Stateful balancers (need to persist across strategy changes)
 	roundRobin *roundRobinBalancer
+
+	// Live connection counts and latencies for weighted_least_connections
+	healthChecker *HealthChecker
+
+	// Optional success rate scaling of provider weights (nil = disabled)
+	successRates *SuccessRateTracker
 }
 
 // NewLoadBalancer creates a LoadBalancer that dynamically reads strategy from database.
@@ -63,6 +69,30 @@ func NewLoadBalancerWithStrategy(strategy models.LoadBalanceStrategy) *LoadBalan
 	}
 }
 
+// SetHealthChecker sets the source of live endpoint state used by
+// connection-aware strategies.
+func (lb *LoadBalancer) SetHealthChecker(hc *HealthChecker) {
+	lb.healthChecker = hc
+}
+
+// SetSuccessRates enables scaling provider weights by endpoint success rate
+// in the weight-based strategies (nil disables it).
+func (lb *LoadBalancer) SetSuccessRates(t *SuccessRateTracker) {
+	lb.successRates = t
+}
+
+// EffectiveWeight returns the provider weight scaled by success rate, the
+// weight the weight-based strategies select with.
+func (lb *LoadBalancer) EffectiveWeight(ep *models.Endpoint) float64 {
+	return float64(ep.Provider.Weight) * lb.SuccessRateFactor(ep)
+}
+
+// SuccessRateFactor returns the multiplier success rate applies to the
+// endpoint's weight; 1 when success rate weighting is disabled.
+func (lb *LoadBalancer) SuccessRateFactor(ep *models.Endpoint) float64 {
+	return lb.successRates.Factor(ep)
+}
+
 // getStrategy returns the current strategy, using cache to reduce DB queries.
 func (lb *LoadBalancer) getStrategy() models.LoadBalanceStrategy {
 	lb.mu.RLock()
@@ -112,13 +142,45 @@ func (lb *LoadBalancer) Select(endpoints []*models.Endpoint, req *models.Anthrop
 		return lb.roundRobin.Select(endpoints, req)
 	case models.StrategyLeastConnections:
 		return selectLeastConnections(endpoints)
+	case models.StrategyWeightedLeastConnections:
+		return lb.selectWeightedLeastConnections(endpoints, req)
 	case models.StrategyConversationHash:
 		return selectConversationHash(endpoints, req)
+	case models.StrategyLeastCost:
+		return lb.selectLeastCost(endpoints, req)
 	default:
+		if lb.successRates != nil {
+			return selectWeightedBy(endpoints, lb.EffectiveWeight)
+		}
 		return selectWeighted(endpoints)
 	}
 }
 
+// --- Provider Priority Tiers ---
+
+// preferredTier returns the endpoints belonging to the best (lowest) provider
+// priority tier. Load balancing strategies only pick within this tier, so a
+// strict preference order (e.g. cheapest first) is honored and lower tiers are
+// only used once every endpoint in a better tier is unhealthy or has failed.
+func preferredTier(endpoints []*models.Endpoint) []*models.Endpoint {
+	if len(endpoints) <= 1 {
+		return endpoints
+	}
+	best := endpoints[0].Provider.Priority
+	for _, ep := range endpoints[1:] {
+		if ep.Provider.Priority < best {
+			best = ep.Provider.Priority
+		}
+	}
+	tier := make([]*models.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if ep.Provider.Priority == best {
+			tier = append(tier, ep)
+		}
+	}
+	return tier
+}
+
 // --- Weighted Random ---
 
 func selectWeighted(endpoints []*models.Endpoint) *models.Endpoint {
@@ -141,6 +203,32 @@ func selectWeighted(endpoints []*models.Endpoint) *models.Endpoint {
 	return endpoints[len(endpoints)-1]
 }
 
+// selectWeightedBy is selectWeighted with fractional weights computed by
+// weight.
+func selectWeightedBy(endpoints []*models.Endpoint, weight func(*models.Endpoint) float64) *models.Endpoint {
+	weights := make([]float64, len(endpoints))
+	var total float64
+	for i, ep := range endpoints {
+		weights[i] = weight(ep)
+		total += weights[i]
+	}
+	if total <= 0 {
+		return endpoints[secureRandIntn(len(endpoints))]
+	}
+
+	rngMu.Lock()
+	r := rng.Float64() * total
+	rngMu.Unlock()
+	var cumulative float64
+	for i, ep := range endpoints {
+		cumulative += weights[i]
+		if r < cumulative {
+			return ep
+		}
+	}
+	return endpoints[len(endpoints)-1]
+}
+
 // --- Round Robin ---
 
 type roundRobinBalancer struct {
@@ -165,13 +253,132 @@ func selectLeastConnections(endpoints []*models.Endpoint) *models.Endpoint {
 	return endpoints[secureRandIntn(len(endpoints))]
 }
 
+// --- Weighted Least Connections ---
+
+// selectWeightedLeastConnections picks the endpoint with the lowest
+// active connections per unit of provider weight (scaled by success rate when
+// enabled), breaking ties on lowest
+// average latency. Endpoints with zero weight are skipped; it falls back to
+// round robin when no endpoint has a weight or there is no health checker.
+func (lb *LoadBalancer) selectWeightedLeastConnections(endpoints []*models.Endpoint, req *models.AnthropicRequest) *models.Endpoint {
+	if lb.healthChecker == nil {
+		return lb.roundRobin.Select(endpoints, req)
+	}
+
+	var best *models.Endpoint
+	var bestLoad, bestLatency float64
+	for _, ep := range endpoints {
+		if ep.Provider.Weight <= 0 {
+			continue
+		}
+		var conns int
+		var latency float64
+		if state := lb.healthChecker.GetState(EndpointName(ep)); state != nil {
+			conns = state.CurrentConnections
+			latency = state.AvgResponseTimeMs
+		}
+		load := float64(conns) / lb.EffectiveWeight(ep)
+		if best == nil || load < bestLoad || (load == bestLoad && latency < bestLatency) {
+			best, bestLoad, bestLatency = ep, load, latency
+		}
+	}
+	if best == nil {
+		return lb.roundRobin.Select(endpoints, req)
+	}
+	return best
+}
+
+// --- Least Cost ---
+
+// unitCostUsage is the usage an endpoint is priced at by least_cost: one
+// million input and output tokens, so input and output prices both count.
+var unitCostUsage = models.Usage{InputTokens: 1_000_000, OutputTokens: 1_000_000}
+
+// selectLeastCost picks the cheapest endpoint, pricing each by its model's
+// prices and its provider's cost multiplier as endpointCost does. The
+// endpoints of one model share its prices, so between them only the
+// multiplier decides. Ties go to the
+// endpoint with the fewest active connections. When every endpoint costs the
+// same, or there is no health checker to break a tie, it falls back to round
+// robin.
+func (lb *LoadBalancer) selectLeastCost(endpoints []*models.Endpoint, req *models.AnthropicRequest) *models.Endpoint {
+	costs := make([]float64, len(endpoints))
+	lowest := 0
+	for i, ep := range endpoints {
+		costs[i] = endpointCost(ep, unitCostUsage)
+		if costs[i] < costs[lowest] {
+			lowest = i
+		}
+	}
+	cheapest := make([]*models.Endpoint, 0, len(endpoints))
+	for i, ep := range endpoints {
+		if costs[i] == costs[lowest] {
+			cheapest = append(cheapest, ep)
+		}
+	}
+
+	switch {
+	case len(cheapest) == 1:
+		return cheapest[0]
+	case len(cheapest) == len(endpoints), lb.healthChecker == nil:
+		return lb.roundRobin.Select(cheapest, req)
+	}
+	var best *models.Endpoint
+	bestConns := 0
+	for _, ep := range cheapest {
+		conns := 0
+		if state := lb.healthChecker.GetState(EndpointName(ep)); state != nil {
+			conns = state.CurrentConnections
+		}
+		if best == nil || conns < bestConns {
+			best, bestConns = ep, conns
+		}
+	}
+	return best
+}
+
 // --- Conversation Hash ---
 
+// ConversationIDHeader lets clients pin a multi-turn conversation to one
+// endpoint under the conversation_hash strategy.
+const ConversationIDHeader = "X-Conversation-Id"
+
+// selectConversationHash places every endpoint on a hash ring by name and
+// picks the first one clockwise from the conversation's key. Only healthy
+// candidates are passed in, so when a conversation's endpoint drops out it
+// moves to the next endpoint in ring order, and returns once it recovers.
 func selectConversationHash(endpoints []*models.Endpoint, req *models.AnthropicRequest) *models.Endpoint {
-	if req == nil || len(req.Messages) == 0 {
+	key, ok := conversationKey(req)
+	if !ok {
 		return endpoints[secureRandIntn(len(endpoints))]
 	}
 
+	keyHash := hash64(key)
+	var best *models.Endpoint
+	var bestDistance uint64
+	for _, ep := range endpoints {
+		// Unsigned subtraction wraps around, giving the clockwise distance.
+		distance := hash64(EndpointName(ep)) - keyHash
+		if best == nil || distance < bestDistance {
+			best, bestDistance = ep, distance
+		}
+	}
+	return best
+}
+
+// conversationKey returns the request's ConversationID, or else a key
+// derived from the first message, which stays the same on every turn.
+func conversationKey(req *models.AnthropicRequest) (string, bool) {
+	if req == nil {
+		return "", false
+	}
+	if req.ConversationID != "" {
+		return "id:" + req.ConversationID, true
+	}
+	if len(req.Messages) == 0 {
+		return "", false
+	}
+
 	first := req.Messages[0]
 	content := first.Role + ":"
 	for _, part := range first.Content.GetParts() {
@@ -184,11 +391,12 @@ func selectConversationHash(endpoints []*models.Endpoint, req *models.AnthropicR
 			break
 		}
 	}
+	return "msg:" + content, true
+}
 
-	hash := sha256.Sum256([]byte(content))
-	hashVal := binary.BigEndian.Uint64(hash[:8])
-	idx := hashVal % uint64(len(endpoints))
-	return endpoints[idx]
+func hash64(s string) uint64 {
+	hash := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(hash[:8])
 }
 
 // EndpointName returns a display name for an endpoint.
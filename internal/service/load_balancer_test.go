@@ -4,11 +4,19 @@
 package service
 
 import (
+	"context"
+	"fmt"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
 	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
 )
 
 func TestNewLoadBalancer(t *testing.T) {
@@ -19,6 +27,7 @@ func TestNewLoadBalancer(t *testing.T) {
 		{"round robin", models.StrategyRoundRobin},
 		{"weighted", models.StrategyWeighted},
 		{"least connections", models.StrategyLeastConnections},
+		{"weighted least connections", models.StrategyWeightedLeastConnections},
 		{"conversation hash", models.StrategyConversationHash},
 		{"unknown defaults to weighted", "unknown"},
 	}
@@ -105,6 +114,121 @@ func TestWeightedBalancer_ZeroWeight(t *testing.T) {
 	assert.NotNil(t, selected)
 }
 
+type fakeEndpointStats map[string]*repository.EndpointModelStats
+
+func (f fakeEndpointStats) GetEndpointModelStatsSince(context.Context, time.Time) (map[string]*repository.EndpointModelStats, error) {
+	return f, nil
+}
+
+func TestWeightedBalancer_SuccessRateWeighting(t *testing.T) {
+	reliable := createTestEndpoint("reliable", "model1", 1)
+	flaky := createTestEndpoint("flaky", "model1", 1)
+	endpoints := []*models.Endpoint{reliable, flaky}
+
+	stats := fakeEndpointStats{
+		EndpointName(reliable): {TotalRequests: 1000, TotalErrors: 0},
+		EndpointName(flaky):    {TotalRequests: 1000, TotalErrors: 750},
+	}
+	tracker := NewSuccessRateTracker(stats, nil, config.LoadBalanceConfig{
+		SuccessRateWeighting:   true,
+		SuccessRateMinRequests: 20,
+	}, zap.NewNop())
+	require.NoError(t, tracker.Refresh(context.Background()))
+	assert.InDelta(t, 1.0, tracker.Factor(reliable), 1e-9)
+	assert.InDelta(t, 0.25, tracker.Factor(flaky), 1e-9)
+
+	lb := NewLoadBalancerWithStrategy(models.StrategyWeighted)
+	lb.SetSuccessRates(tracker)
+
+	counts := make(map[string]int)
+	iterations := 4000
+	for range iterations {
+		counts[lb.Select(endpoints, nil).Provider.Name]++
+	}
+	// Equal weights scaled 1 : 0.25 → the flaky endpoint gets ~20% of traffic.
+	assert.InDelta(t, 0.2, float64(counts["flaky"])/float64(iterations), 0.04)
+	assert.Greater(t, counts["reliable"], 3*counts["flaky"])
+}
+
+func TestSuccessRateTracker_BlendsLiveHealth(t *testing.T) {
+	ep := createTestEndpoint("provider1", "model1", 1)
+	hc := NewHealthChecker(config.HealthCheckConfig{}, zap.NewNop())
+	hc.Start([]*models.Endpoint{ep})
+	defer hc.Stop()
+	for i := range 20 {
+		hc.UpdateRequestStats(EndpointName(ep), i%2 == 0, 10)
+	}
+
+	cfg := config.LoadBalanceConfig{SuccessRateWeighting: true, SuccessRateMinRequests: 20}
+	stats := fakeEndpointStats{EndpointName(ep): {TotalRequests: 100, TotalErrors: 0}}
+	tracker := NewSuccessRateTracker(stats, hc, cfg, zap.NewNop())
+	require.NoError(t, tracker.Refresh(context.Background()))
+
+	// History 100%, live 50%.
+	assert.InDelta(t, 0.75, tracker.Factor(ep), 1e-9)
+
+	// Too few historical samples: live rate alone.
+	stats[EndpointName(ep)].TotalRequests = 10
+	assert.InDelta(t, 0.5, tracker.Factor(ep), 1e-9)
+
+	// Disabled tracker leaves weights unchanged.
+	cfg.SuccessRateWeighting = false
+	assert.Nil(t, NewSuccessRateTracker(stats, hc, cfg, zap.NewNop()))
+	var disabled *SuccessRateTracker
+	assert.Equal(t, 1.0, disabled.Factor(ep))
+}
+
+func TestSuccessRateTracker_RecentWindow(t *testing.T) {
+	ep := createTestEndpoint("provider1", "model1", 1)
+	name := EndpointName(ep)
+	hc := NewHealthChecker(config.HealthCheckConfig{}, zap.NewNop())
+	hc.Start([]*models.Endpoint{ep})
+	defer hc.Stop()
+
+	var since time.Time
+	source := endpointStatsFunc(func(s time.Time) map[string]*repository.EndpointModelStats {
+		since = s
+		return nil
+	})
+	cfg := config.LoadBalanceConfig{SuccessRateWeighting: true, SuccessRateMinRequests: 20, SuccessRateWindowMinutes: 10}
+	tracker := NewSuccessRateTracker(source, hc, cfg, zap.NewNop())
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+
+	// An outage: every request fails.
+	for range 20 {
+		hc.UpdateRequestStats(name, false, 10)
+	}
+	require.NoError(t, tracker.Refresh(context.Background()))
+	assert.Equal(t, now.Add(-10*time.Minute), since, "history is read over the window")
+	assert.InDelta(t, minSuccessRateFactor, tracker.Factor(ep), 1e-9)
+
+	// One window later the endpoint has recovered; the outage has mostly
+	// faded.
+	now = now.Add(10 * time.Minute)
+	for range 40 {
+		hc.UpdateRequestStats(name, true, 10)
+	}
+	require.NoError(t, tracker.Refresh(context.Background()))
+	recovered := tracker.Factor(ep)
+	assert.InDelta(t, 40/(40+20*math.Exp(-1)), recovered, 1e-9)
+
+	// Quiet intervals keep the rate but thin out its samples until it is no
+	// longer trusted.
+	now = now.Add(time.Minute)
+	require.NoError(t, tracker.Refresh(context.Background()))
+	assert.InDelta(t, recovered, tracker.Factor(ep), 1e-9)
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, tracker.Refresh(context.Background()))
+	assert.Equal(t, 1.0, tracker.Factor(ep))
+}
+
+type endpointStatsFunc func(since time.Time) map[string]*repository.EndpointModelStats
+
+func (f endpointStatsFunc) GetEndpointModelStatsSince(_ context.Context, since time.Time) (map[string]*repository.EndpointModelStats, error) {
+	return f(since), nil
+}
+
 func TestConversationHashBalancer(t *testing.T) {
 	lb := NewLoadBalancerWithStrategy(models.StrategyConversationHash)
 
@@ -180,6 +304,76 @@ func TestConversationHashBalancer_EmptyMessages(t *testing.T) {
 	assert.NotNil(t, selected)
 }
 
+func TestConversationHashBalancer_ConversationID(t *testing.T) {
+	lb := NewLoadBalancerWithStrategy(models.StrategyConversationHash)
+
+	endpoints := []*models.Endpoint{
+		createTestEndpoint("provider1", "model1", 1),
+		createTestEndpoint("provider2", "model1", 1),
+		createTestEndpoint("provider3", "model1", 1),
+		createTestEndpoint("provider4", "model1", 1),
+	}
+	turn := func(text string) *models.AnthropicRequest {
+		return &models.AnthropicRequest{
+			ConversationID: "conv-42",
+			Messages: []models.Message{
+				{Role: "user", Content: models.MessageContent{Text: text}},
+			},
+		}
+	}
+
+	// The conversation ID wins over message content.
+	first := lb.Select(endpoints, turn("Hello"))
+	for _, text := range []string{"Follow-up", "Another question", ""} {
+		assert.Equal(t, first, lb.Select(endpoints, turn(text)))
+	}
+
+	// Candidate order does not matter.
+	reversed := []*models.Endpoint{endpoints[3], endpoints[2], endpoints[1], endpoints[0]}
+	assert.Equal(t, first, lb.Select(reversed, turn("Hello")))
+}
+
+func TestConversationHashBalancer_UnhealthyFallsBackInRingOrder(t *testing.T) {
+	lb := NewLoadBalancerWithStrategy(models.StrategyConversationHash)
+
+	endpoints := []*models.Endpoint{
+		createTestEndpoint("provider1", "model1", 1),
+		createTestEndpoint("provider2", "model1", 1),
+		createTestEndpoint("provider3", "model1", 1),
+		createTestEndpoint("provider4", "model1", 1),
+	}
+	without := func(eps []*models.Endpoint, drop *models.Endpoint) []*models.Endpoint {
+		var out []*models.Endpoint
+		for _, ep := range eps {
+			if ep != drop {
+				out = append(out, ep)
+			}
+		}
+		return out
+	}
+
+	for i := range 20 {
+		req := &models.AnthropicRequest{ConversationID: fmt.Sprintf("conv-%d", i)}
+		primary := lb.Select(endpoints, req)
+
+		// Removing the primary moves the conversation to the next endpoint
+		// on the ring; removing that one as well moves it one further.
+		healthy := without(endpoints, primary)
+		next := lb.Select(healthy, req)
+		assert.NotEqual(t, primary, next)
+		after := lb.Select(without(healthy, next), req)
+		assert.NotEqual(t, next, after)
+
+		// An unrelated endpoint dropping out does not move the conversation.
+		for _, other := range healthy {
+			assert.Equal(t, primary, lb.Select(without(endpoints, other), req))
+		}
+
+		// Ring order is fixed: with only next and after left, next wins.
+		assert.Equal(t, next, lb.Select([]*models.Endpoint{after, next}, req))
+	}
+}
+
 func TestLeastConnectionsBalancer(t *testing.T) {
 	lb := NewLoadBalancerWithStrategy(models.StrategyLeastConnections)
 
@@ -192,6 +386,138 @@ func TestLeastConnectionsBalancer(t *testing.T) {
 	assert.NotNil(t, selected)
 }
 
+func TestWeightedLeastConnectionsBalancer(t *testing.T) {
+	hc := NewHealthChecker(config.HealthCheckConfig{}, zap.NewNop())
+	lb := NewLoadBalancerWithStrategy(models.StrategyWeightedLeastConnections)
+	lb.SetHealthChecker(hc)
+
+	big := createTestEndpoint("big", "model1", 10)
+	small := createTestEndpoint("small", "model1", 1)
+	endpoints := []*models.Endpoint{big, small}
+	registerHealthyEndpoints(hc, endpoints)
+	for i := 0; i < 5; i++ {
+		hc.IncrementConnections(EndpointName(big))
+	}
+
+	// 5/10 = 0.5 versus 0/1 = 0: the idle small provider wins.
+	assert.Equal(t, small, lb.Select(endpoints, nil))
+
+	// 5/10 = 0.5 versus 1/1 = 1: the big provider absorbs the next request.
+	hc.IncrementConnections(EndpointName(small))
+	assert.Equal(t, big, lb.Select(endpoints, nil))
+}
+
+func TestWeightedLeastConnectionsBalancer_LatencyTieBreak(t *testing.T) {
+	hc := NewHealthChecker(config.HealthCheckConfig{}, zap.NewNop())
+	lb := NewLoadBalancerWithStrategy(models.StrategyWeightedLeastConnections)
+	lb.SetHealthChecker(hc)
+
+	slow := createTestEndpoint("slow", "model1", 2)
+	fast := createTestEndpoint("fast", "model1", 2)
+	endpoints := []*models.Endpoint{slow, fast}
+	registerHealthyEndpoints(hc, endpoints)
+	hc.UpdateRequestStats(EndpointName(slow), true, 900)
+	hc.UpdateRequestStats(EndpointName(fast), true, 100)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, fast, lb.Select(endpoints, nil))
+	}
+}
+
+func TestWeightedLeastConnectionsBalancer_RoundRobinFallback(t *testing.T) {
+	ep1 := createTestEndpoint("provider1", "model1", 0)
+	ep2 := createTestEndpoint("provider2", "model1", 0)
+	endpoints := []*models.Endpoint{ep1, ep2}
+
+	t.Run("zero weights", func(t *testing.T) {
+		lb := NewLoadBalancerWithStrategy(models.StrategyWeightedLeastConnections)
+		lb.SetHealthChecker(NewHealthChecker(config.HealthCheckConfig{}, zap.NewNop()))
+		assert.Equal(t, ep1, lb.Select(endpoints, nil))
+		assert.Equal(t, ep2, lb.Select(endpoints, nil))
+	})
+
+	t.Run("no health checker", func(t *testing.T) {
+		lb := NewLoadBalancerWithStrategy(models.StrategyWeightedLeastConnections)
+		assert.Equal(t, ep1, lb.Select(endpoints, nil))
+		assert.Equal(t, ep2, lb.Select(endpoints, nil))
+	})
+}
+
+func TestLeastCostBalancer(t *testing.T) {
+	priced := func(provider string, input, output, multiplier float64) *models.Endpoint {
+		ep := createTestEndpoint(provider, "model1", 1)
+		ep.Model.CostPerMtokInput = input
+		ep.Model.CostPerMtokOutput = output
+		ep.Model.BillingMultiplier = multiplier
+		return ep
+	}
+
+	t.Run("cheapest wins", func(t *testing.T) {
+		lb := NewLoadBalancerWithStrategy(models.StrategyLeastCost)
+		pricey := priced("pricey", 3, 15, 1)
+		cheap := priced("cheap", 3, 15, 0.5)
+		endpoints := []*models.Endpoint{pricey, cheap}
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, cheap, lb.Select(endpoints, nil))
+		}
+	})
+
+	t.Run("tie broken by least connections", func(t *testing.T) {
+		hc := NewHealthChecker(config.HealthCheckConfig{}, zap.NewNop())
+		lb := NewLoadBalancerWithStrategy(models.StrategyLeastCost)
+		lb.SetHealthChecker(hc)
+		busy := priced("busy", 1, 5, 1)
+		idle := priced("idle", 1, 5, 1)
+		pricey := priced("pricey", 3, 15, 1)
+		endpoints := []*models.Endpoint{busy, idle, pricey}
+		registerHealthyEndpoints(hc, endpoints)
+		hc.IncrementConnections(EndpointName(busy))
+		assert.Equal(t, idle, lb.Select(endpoints, nil))
+	})
+
+	t.Run("equal costs fall back to round robin", func(t *testing.T) {
+		lb := NewLoadBalancerWithStrategy(models.StrategyLeastCost)
+		ep1 := createTestEndpoint("provider1", "model1", 1)
+		ep2 := createTestEndpoint("provider2", "model1", 1)
+		endpoints := []*models.Endpoint{ep1, ep2}
+		assert.Equal(t, ep1, lb.Select(endpoints, nil))
+		assert.Equal(t, ep2, lb.Select(endpoints, nil))
+	})
+}
+
+func TestLeastCostBalancer_ProviderPricing(t *testing.T) {
+	// Endpoints loaded from the database share one *Model per model, so only
+	// the providers' cost multipliers can tell them apart.
+	db := testutil.NewTestDB(t)
+	ctx := context.Background()
+	modelRepo := repository.NewModelRepository(db)
+	providerRepo := repository.NewProviderRepository(db)
+	modelID, err := modelRepo.Insert(ctx, &models.Model{Name: "claude-sonnet-4", Role: models.ModelRoleDefault,
+		CostPerMtokInput: 3, CostPerMtokOutput: 15, BillingMultiplier: 1, Enabled: true, Weight: 100})
+	require.NoError(t, err)
+	for _, p := range []*models.Provider{
+		{Name: "list", BaseURL: "https://list.example.com", APIKey: "k", Weight: 1, Enabled: true},
+		{Name: "reseller", BaseURL: "https://reseller.example.com", APIKey: "k", Weight: 1, Enabled: true, CostMultiplier: 0.8},
+	} {
+		_, err := providerRepo.Insert(ctx, p, []int64{modelID})
+		require.NoError(t, err)
+	}
+
+	store := NewEndpointStore(modelRepo, providerRepo, zap.NewNop())
+	require.NoError(t, store.Load(ctx))
+	endpoints := store.GetEndpoints()
+	require.Len(t, endpoints, 2)
+	require.Same(t, endpoints[0].Model, endpoints[1].Model)
+
+	lb := NewLoadBalancerWithStrategy(models.StrategyLeastCost)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "reseller", lb.Select(endpoints, nil).Provider.Name)
+	}
+	usage := models.Usage{InputTokens: 1_000_000, OutputTokens: 1_000_000}
+	assert.InDelta(t, 18.0, endpointCost(endpoints[0], usage), 1e-9)
+	assert.InDelta(t, 14.4, endpointCost(endpoints[1], usage), 1e-9)
+}
+
 func TestEndpointName(t *testing.T) {
 	ep := createTestEndpoint("my-provider", "my-model", 1)
 	name := EndpointName(ep)
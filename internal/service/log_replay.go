@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrReplayLogNotFound is returned when replaying a log that does not
+	// exist.
+	ErrReplayLogNotFound = errors.New("log not found")
+	// ErrReplayNoContent is returned when the log has no stored request, i.e.
+	// full content logging was off when it was written.
+	ErrReplayNoContent = errors.New("log has no stored request content; enable full content logging to replay requests")
+	// ErrReplayInvalidContent is returned when the stored request cannot be
+	// parsed.
+	ErrReplayInvalidContent = errors.New("stored request content is not a valid request")
+	// ErrReplayRedacted is returned when executing a log whose stored request
+	// was redacted, since upstream would get the placeholders instead of the
+	// original content.
+	ErrReplayRedacted = errors.New("stored request content was redacted and cannot be sent upstream; replay it without execute")
+)
+
+// ReplayDecision is where a request was routed.
+type ReplayDecision struct {
+	TaskType        string               `json:"task_type"`
+	Model           string               `json:"model"`
+	Endpoint        string               `json:"endpoint"`
+	RoutingMethod   string               `json:"routing_method,omitempty"`
+	RoutingReason   string               `json:"routing_reason,omitempty"`
+	MatchedRuleName string               `json:"matched_rule_name,omitempty"`
+	FallbackInfo    *models.FallbackInfo `json:"fallback_info,omitempty"`
+}
+
+// LogReplayResult compares a logged request's routing with the routing it
+// gets now, and carries the new response when the replay was executed.
+type LogReplayResult struct {
+	LogID    int64          `json:"log_id"`
+	Original ReplayDecision `json:"original"`
+	Replay   ReplayDecision `json:"replay"`
+	Changed  bool           `json:"changed"` // Task type or model differs
+	Executed bool           `json:"executed"`
+
+	RequestID  string                    `json:"request_id,omitempty"` // Log of the executed replay
+	StatusCode int                       `json:"status_code,omitempty"`
+	Response   *models.AnthropicResponse `json:"response,omitempty"`
+	Error      string                    `json:"error,omitempty"`
+}
+
+// LogReplayer re-runs logged requests through the current routing, to check
+// whether a rule or configuration change fixes a past misroute. By default
+// only the routing decision is made; executing the request upstream is
+// opt-in because it costs money.
+type LogReplayer struct {
+	logRepo   repository.RequestLogRepository
+	selector  *EndpointSelector
+	proxy     *ProxyService
+	endpoints func() []*models.Endpoint
+	logger    *zap.Logger
+}
+
+// NewLogReplayer creates a new LogReplayer. endpoints returns the current
+// endpoint list, as served to the proxy.
+func NewLogReplayer(
+	logRepo repository.RequestLogRepository,
+	selector *EndpointSelector,
+	proxy *ProxyService,
+	endpoints func() []*models.Endpoint,
+	logger *zap.Logger,
+) *LogReplayer {
+	return &LogReplayer{
+		logRepo:   logRepo,
+		selector:  selector,
+		proxy:     proxy,
+		endpoints: endpoints,
+		logger:    logger,
+	}
+}
+
+// Replay routes the request stored with log logID again. Without execute
+// routing is a dry run (see withRoutingDryRun); with it the request is also
+// sent upstream (always non-streaming) and logged under userID, unless its
+// stored content was redacted. Routing and upstream failures are reported in the result rather
+// than as errors.
+func (r *LogReplayer) Replay(ctx context.Context, logID int64, execute bool, userID int64) (*LogReplayResult, error) {
+	log, err := r.logRepo.GetByID(ctx, logID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReplayLogNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get log: %w", err)
+	}
+	if log.RequestContent == "" {
+		return nil, ErrReplayNoContent
+	}
+	if execute && isRedacted(log.RequestContent) {
+		return nil, ErrReplayRedacted
+	}
+	var req models.AnthropicRequest
+	if err := json.Unmarshal([]byte(log.RequestContent), &req); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrReplayInvalidContent, err)
+	}
+	req.Stream = false
+	r.proxy.ApplyDefaultMaxTokens(&req)
+
+	result := &LogReplayResult{
+		LogID: log.ID,
+		Original: ReplayDecision{
+			TaskType:        log.TaskType,
+			Model:           log.ModelName,
+			Endpoint:        log.EndpointName,
+			RoutingMethod:   log.RoutingMethod,
+			RoutingReason:   log.RoutingReason,
+			MatchedRuleName: log.MatchedRuleName,
+		},
+	}
+
+	// Only an executed replay is a real request; a dry run must not count
+	// rule hits, fill the routing caches or call the routing model.
+	routeCtx := ctx
+	if !execute {
+		routeCtx = withRoutingDryRun(ctx)
+	}
+	eps := r.endpoints()
+	selection, err := r.selector.SelectEndpoint(routeCtx, &req, eps)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	result.Replay = replayDecision(selection)
+	result.Changed = result.Replay.TaskType != result.Original.TaskType || result.Replay.Model != result.Original.Model
+	if !execute {
+		return result, nil
+	}
+
+	result.Executed = true
+	resp, meta, err := r.proxy.ProxyRequest(ctx, &req, http.Header{}, selection, eps)
+	if meta == nil {
+		meta = &ProxyMetadata{RequestID: uuid.New().String()}
+	}
+	meta.RoutingDecision = selection.RoutingDecision
+	meta.RuleMatchResult = selection.RuleMatchResult
+	meta.InferredTaskType = string(selection.TaskType)
+	meta.RequestContent = log.RequestContent
+	meta.EndUserID = req.EndUserID()
+	result.RequestID = meta.RequestID
+	if err != nil {
+		result.StatusCode = http.StatusBadGateway
+		var ue *UpstreamError
+		switch {
+		case errors.As(err, &ue):
+			result.StatusCode = ue.StatusCode
+		case errors.Is(err, ErrProvidersSaturated):
+			result.StatusCode = http.StatusServiceUnavailable
+		}
+		result.Error = err.Error()
+		meta.StatusCode = result.StatusCode
+		meta.Success = false
+		meta.SelectedModel = selection.Model.Name
+		meta.SelectedEndpoint = selection.Endpoint.Provider.Name
+		meta.ErrorMessage = err.Error()
+	} else {
+		result.StatusCode = http.StatusOK
+		result.Response = resp
+		meta.StatusCode = http.StatusOK
+		meta.Success = true
+	}
+	r.proxy.SaveRequestLog(ctx, meta, userID, nil)
+	r.logger.Info("replayed logged request upstream",
+		zap.Int64("log_id", logID),
+		zap.String("request_id", result.RequestID),
+		zap.Int("status_code", result.StatusCode))
+	return result, nil
+}
+
+// replayDecision describes the routing of selection.
+func replayDecision(selection *EndpointSelectionResult) ReplayDecision {
+	d := ReplayDecision{
+		TaskType:     string(selection.TaskType),
+		FallbackInfo: selection.FallbackInfo,
+	}
+	if selection.Model != nil {
+		d.Model = selection.Model.Name
+	}
+	if selection.Endpoint != nil && selection.Endpoint.Provider != nil {
+		d.Endpoint = selection.Endpoint.Provider.Name
+	}
+	if selection.RoutingDecision != nil {
+		d.RoutingMethod = routingMethodFromDecision(selection.RoutingDecision)
+		d.RoutingReason = selection.RoutingDecision.Reason
+	}
+	if selection.RuleMatchResult != nil && selection.RuleMatchResult.Rule != nil {
+		d.MatchedRuleName = selection.RuleMatchResult.Rule.Name
+	}
+	return d
+}
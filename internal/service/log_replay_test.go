@@ -0,0 +1,126 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+func TestLogReplayer_Replay(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	testutil.SeedTestData(t, db)
+	logger := zap.NewNop()
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.AnthropicResponse{
+			ID:      "msg_replay",
+			Type:    "message",
+			Role:    "assistant",
+			Content: []models.ContentPart{{Type: "text", Text: "replayed"}},
+		})
+	}))
+	defer upstream.Close()
+
+	provider := &models.Provider{ID: 1, Name: "upstream", BaseURL: upstream.URL, APIKey: "k", Weight: 1, Enabled: true}
+	var eps []*models.Endpoint
+	for i, m := range []struct {
+		name string
+		role models.ModelRole
+	}{{"claude-3-haiku", models.ModelRoleSimple}, {"claude-sonnet-4", models.ModelRoleDefault}, {"claude-opus-4", models.ModelRoleComplex}} {
+		eps = append(eps, &models.Endpoint{
+			Provider: provider,
+			Model:    &models.Model{ID: int64(i + 1), Name: m.name, Role: m.role, Enabled: true},
+		})
+	}
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	hc.Start(eps)
+	defer hc.Stop()
+	lb := NewLoadBalancerWithStrategy(models.StrategyRoundRobin)
+	selector := NewEndpointSelector(NewModelSelector(hc, logger), hc, lb, NewLLMRouter(db, nil, nil, logger),
+		repository.NewRoutingConfigRepository(db, logger), logger)
+	logRepo := repository.NewRequestLogRepositoryImpl(db, logger)
+	replayer := NewLogReplayer(logRepo, selector, NewProxyService(hc, lb, nil, logger), func() []*models.Endpoint { return eps }, logger)
+
+	// A past request the routing model sent to the simple role; the builtin
+	// architecture rule now routes it to complex.
+	content, err := json.Marshal(&models.AnthropicRequest{
+		Model:     "auto",
+		MaxTokens: 100,
+		Stream:    true,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "帮我设计一个微服务架构"}}},
+	})
+	require.NoError(t, err)
+	logID, err := logRepo.Insert(ctx, &models.RequestLogEntry{
+		RequestID:      "req-misrouted",
+		UserID:         2,
+		ModelName:      "claude-3-haiku",
+		EndpointName:   "upstream",
+		TaskType:       "simple",
+		Success:        true,
+		RequestContent: string(content),
+		RoutingMethod:  "llm",
+	})
+	require.NoError(t, err)
+
+	result, err := replayer.Replay(ctx, logID, false, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "simple", result.Original.TaskType)
+	assert.Equal(t, "llm", result.Original.RoutingMethod)
+	assert.Equal(t, "complex", result.Replay.TaskType)
+	assert.Equal(t, "claude-opus-4", result.Replay.Model)
+	assert.Equal(t, "rule", result.Replay.RoutingMethod)
+	assert.NotEmpty(t, result.Replay.MatchedRuleName)
+	assert.True(t, result.Changed)
+	assert.False(t, result.Executed)
+	assert.Nil(t, result.Response)
+	assert.Equal(t, int32(0), calls.Load(), "a dry run makes no upstream call")
+
+	result, err = replayer.Replay(ctx, logID, true, 1)
+	require.NoError(t, err)
+	assert.True(t, result.Executed)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	require.NotNil(t, result.Response)
+	assert.Equal(t, "replayed", result.Response.Content[0].Text)
+	assert.NotEmpty(t, result.RequestID)
+	assert.Equal(t, int32(1), calls.Load())
+
+	_, err = replayer.Replay(ctx, logID+100, false, 1)
+	assert.ErrorIs(t, err, ErrReplayLogNotFound)
+
+	noContentID, err := logRepo.Insert(ctx, &models.RequestLogEntry{RequestID: "req-no-content", UserID: 2, Success: true})
+	require.NoError(t, err)
+	_, err = replayer.Replay(ctx, noContentID, false, 1)
+	assert.ErrorIs(t, err, ErrReplayNoContent)
+
+	// Redacted content can be routed again but never sent upstream.
+	redactedID, err := logRepo.Insert(ctx, &models.RequestLogEntry{
+		RequestID:      "req-redacted",
+		UserID:         2,
+		Success:        true,
+		RequestContent: `{"model":"auto","max_tokens":100,"messages":[{"role":"user","content":"my key is [REDACTED]"}]}`,
+	})
+	require.NoError(t, err)
+	_, err = replayer.Replay(ctx, redactedID, false, 1)
+	assert.NoError(t, err)
+	_, err = replayer.Replay(ctx, redactedID, true, 1)
+	assert.ErrorIs(t, err, ErrReplayRedacted)
+	assert.Equal(t, int32(1), calls.Load())
+}
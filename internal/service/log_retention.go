@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+// LogRetention periodically deletes request logs older than the retention
+// window stored in system config. Logs are deleted in batches so no single
+// statement holds the SQLite write lock for long, and the database is vacuumed
+// after large prunes. Only the primary worker prunes.
+type LogRetention struct {
+	logs    *repository.RequestLogRepositoryImpl
+	config  *repository.SystemConfigRepository
+	cfg     config.LogRetentionConfig
+	primary func() bool
+	logger  *zap.Logger
+	now     func() time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewLogRetention creates a LogRetention. isPrimary reports whether this
+// worker is the primary; nil means a single worker.
+func NewLogRetention(
+	logs *repository.RequestLogRepositoryImpl,
+	configRepo *repository.SystemConfigRepository,
+	cfg config.LogRetentionConfig,
+	isPrimary func() bool,
+	logger *zap.Logger,
+) *LogRetention {
+	if isPrimary == nil {
+		isPrimary = func() bool { return true }
+	}
+	return &LogRetention{
+		logs:    logs,
+		config:  configRepo,
+		cfg:     cfg,
+		primary: isPrimary,
+		logger:  logger,
+		now:     time.Now,
+	}
+}
+
+// Run prunes logs older than the retention window and returns how many were
+// deleted. It does nothing on secondary workers or when retention is off.
+func (r *LogRetention) Run(ctx context.Context) (int64, error) {
+	if !r.primary() {
+		return 0, nil
+	}
+	days, err := r.config.GetLogRetentionDays(ctx)
+	if err != nil || days <= 0 {
+		return 0, err
+	}
+	cutoff := r.now().Add(-time.Duration(days) * 24 * time.Hour)
+
+	var pruned int64
+	for {
+		n, err := r.logs.DeleteOlderThan(ctx, cutoff, r.cfg.BatchSize)
+		pruned += n
+		if err != nil {
+			return pruned, err
+		}
+		if n < int64(r.cfg.BatchSize) {
+			break
+		}
+	}
+	r.logger.Info("pruned request logs",
+		zap.Int64("count", pruned),
+		zap.Int("retention_days", days))
+
+	if r.cfg.VacuumThreshold > 0 && pruned >= int64(r.cfg.VacuumThreshold) {
+		if err := r.logs.Vacuum(ctx); err != nil {
+			return pruned, err
+		}
+		r.logger.Info("vacuumed database after log pruning")
+	}
+	return pruned, nil
+}
+
+// Start runs the retention job immediately and then every interval until
+// Stop.
+func (r *LogRetention) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(time.Duration(r.cfg.IntervalMinutes) * time.Minute)
+		defer ticker.Stop()
+		for {
+			if _, err := r.Run(ctx); err != nil && ctx.Err() == nil {
+				r.logger.Warn("log retention run failed", zap.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop halts the retention job.
+func (r *LogRetention) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+}
@@ -0,0 +1,60 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+func TestLogRetention_Run(t *testing.T) {
+	db := testutil.NewTestDBWithDefaults(t)
+	testutil.SeedTestData(t, db)
+	logs := repository.NewRequestLogRepositoryImpl(db, zap.NewNop())
+	configRepo := repository.NewSystemConfigRepository(db)
+	ctx := context.Background()
+
+	for i := 0; i < 7; i++ {
+		_, err := logs.Insert(ctx, &models.RequestLogEntry{RequestID: fmt.Sprintf("req_%d", i), UserID: 1, ModelName: "m", Success: true})
+		require.NoError(t, err)
+	}
+	// Backdate five of the seven logs past a 30-day window.
+	_, err := db.ExecContext(ctx, `UPDATE request_logs SET created_at = datetime('now', '-40 days')
+		WHERE request_id IN ('req_0', 'req_1', 'req_2', 'req_3', 'req_4')`)
+	require.NoError(t, err)
+
+	primary := false
+	r := NewLogRetention(logs, configRepo, config.LogRetentionConfig{BatchSize: 2, VacuumThreshold: 5}, func() bool { return primary }, zap.NewNop())
+
+	// Retention off: nothing is pruned.
+	primary = true
+	pruned, err := r.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, pruned)
+
+	// Secondary workers leave pruning to the primary.
+	require.NoError(t, configRepo.UpdateLogRetentionConfig(ctx, map[string]any{"retention_days": 30}))
+	primary = false
+	pruned, err = r.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, pruned)
+
+	// The primary prunes every expired log across several batches.
+	primary = true
+	pruned, err = r.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), pruned)
+	count, err := logs.Count(ctx, nil, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
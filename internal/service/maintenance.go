@@ -0,0 +1,58 @@
+package service
+
+import (
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+// defaultMaintenanceMessage is returned to clients when maintenance mode has
+// no message configured.
+const defaultMaintenanceMessage = "The service is under maintenance, please retry later"
+
+// MaintenanceMode reports whether proxy traffic is paused for maintenance.
+// The setting is read from system config and cached briefly, so every
+// worker picks up a change within the cache TTL; changes are logged as each
+// worker sees them. A nil MaintenanceMode is never enabled.
+type MaintenanceMode struct {
+	cfg *cachedConfig[models.MaintenanceConfig]
+}
+
+// NewMaintenanceMode creates a MaintenanceMode reading from repo.
+func NewMaintenanceMode(repo *repository.SystemConfigRepository, logger *zap.Logger) *MaintenanceMode {
+	cfg := newCachedConfig("maintenance config", 2*time.Second, repo.GetMaintenanceConfig, logger)
+	cfg.onChange = func(old, cur models.MaintenanceConfig) {
+		if cur.Enabled == old.Enabled {
+			return
+		}
+		if cur.Enabled {
+			logger.Warn("maintenance mode enabled, refusing proxy traffic", zap.String("message", cur.Message))
+		} else {
+			logger.Info("maintenance mode disabled, accepting proxy traffic")
+		}
+	}
+	return &MaintenanceMode{cfg: cfg}
+}
+
+// Status returns the current maintenance settings with the message
+// defaulted.
+func (m *MaintenanceMode) Status() models.MaintenanceConfig {
+	if m == nil {
+		return models.MaintenanceConfig{}
+	}
+	cfg := m.cfg.get()
+	if cfg.Message == "" {
+		cfg.Message = defaultMaintenanceMessage
+	}
+	return cfg
+}
+
+// Invalidate drops the cached settings so the next request reloads them.
+func (m *MaintenanceMode) Invalidate() {
+	if m == nil {
+		return
+	}
+	m.cfg.invalidate()
+}
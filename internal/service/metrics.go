@@ -0,0 +1,149 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// latencyBuckets spans fast cached replies up to long streamed completions.
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Metrics exposes proxy traffic, routing cache and endpoint health as
+// Prometheus metrics. Labels are limited to configured models, endpoints,
+// status codes and cache levels so cardinality stays bounded. A nil *Metrics
+// records nothing.
+type Metrics struct {
+	registry     *prometheus.Registry
+	requests     *prometheus.CounterVec
+	latency      *prometheus.HistogramVec
+	cost         *prometheus.CounterVec
+	cacheLookups *prometheus.CounterVec
+}
+
+// NewMetrics creates the metrics registry. Endpoint health and breaker state
+// are read from health at scrape time; health may be nil.
+func NewMetrics(health *HealthChecker) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "llm_proxy_requests_total",
+			Help: "Proxied requests by model, endpoint and upstream status code.",
+		}, []string{"model", "endpoint", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "llm_proxy_request_duration_seconds",
+			Help:    "End-to-end latency of proxied requests.",
+			Buckets: latencyBuckets,
+		}, []string{"model", "endpoint"}),
+		cost: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "llm_proxy_cost_usd_total",
+			Help: "Cost of proxied requests in USD.",
+		}, []string{"model", "endpoint"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "llm_proxy_routing_cache_lookups_total",
+			Help: "Routing cache lookups by cache level and result.",
+		}, []string{"level", "result"}),
+	}
+	m.registry.MustRegister(
+		m.requests, m.latency, m.cost, m.cacheLookups,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if health != nil {
+		m.registry.MustRegister(&endpointStateCollector{health: health})
+	}
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// unknownModelLabel labels requests rejected before a model was resolved.
+const unknownModelLabel = "unknown"
+
+// observeRequest records a finished proxied request. Until an endpoint is
+// selected SelectedModel is whatever the client asked for, so such requests
+// are labelled with unknownModelLabel to keep the label set bounded.
+func (m *Metrics) observeRequest(meta *ProxyMetadata) {
+	if m == nil || meta == nil {
+		return
+	}
+	status := "error" // No upstream response, e.g. a connection failure
+	if meta.StatusCode > 0 {
+		status = strconv.Itoa(meta.StatusCode)
+	}
+	model := meta.SelectedModel
+	if meta.SelectedEndpoint == "" {
+		model = unknownModelLabel
+	}
+	m.requests.WithLabelValues(model, meta.SelectedEndpoint, status).Inc()
+	m.latency.WithLabelValues(model, meta.SelectedEndpoint).Observe(meta.LatencyMs / 1000)
+	if meta.Cost > 0 {
+		m.cost.WithLabelValues(model, meta.SelectedEndpoint).Add(meta.Cost)
+	}
+}
+
+// observeCacheLookup records a routing cache hit or miss at level (L1, L2).
+func (m *Metrics) observeCacheLookup(level string, hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(level, result).Inc()
+}
+
+var (
+	endpointUpDesc = prometheus.NewDesc(
+		"llm_proxy_endpoint_up",
+		"Whether the endpoint is healthy (1) or not (0).",
+		[]string{"endpoint"}, nil)
+	endpointCircuitDesc = prometheus.NewDesc(
+		"llm_proxy_endpoint_circuit_state",
+		"Circuit breaker state of the endpoint; 1 for the current state.",
+		[]string{"endpoint", "state"}, nil)
+	endpointConnectionsDesc = prometheus.NewDesc(
+		"llm_proxy_endpoint_connections",
+		"In-flight requests to the endpoint.",
+		[]string{"endpoint"}, nil)
+)
+
+// endpointStateCollector reports health checker state at scrape time, so it
+// always matches /api/status without being updated on every transition.
+type endpointStateCollector struct {
+	health *HealthChecker
+}
+
+func (c *endpointStateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- endpointUpDesc
+	ch <- endpointCircuitDesc
+	ch <- endpointConnectionsDesc
+}
+
+func (c *endpointStateCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, state := range c.health.GetAllStates() {
+		ch <- prometheus.MustNewConstMetric(endpointUpDesc, prometheus.GaugeValue,
+			boolGauge(state.Status == models.EndpointHealthy), name)
+		for _, cs := range []CircuitState{CircuitClosed, CircuitOpen, CircuitHalfOpen} {
+			ch <- prometheus.MustNewConstMetric(endpointCircuitDesc, prometheus.GaugeValue,
+				boolGauge(state.CircuitState == cs), name, string(cs))
+		}
+		ch <- prometheus.MustNewConstMetric(endpointConnectionsDesc, prometheus.GaugeValue,
+			float64(state.CurrentConnections), name)
+	}
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+func scrapeMetrics(t *testing.T, m *Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetrics_Requests(t *testing.T) {
+	m := NewMetrics(nil)
+	m.observeRequest(&ProxyMetadata{SelectedModel: "sonnet", SelectedEndpoint: "p/sonnet", StatusCode: 200, LatencyMs: 1500, Cost: 0.25})
+	m.observeRequest(&ProxyMetadata{SelectedModel: "sonnet", SelectedEndpoint: "p/sonnet", StatusCode: 200, LatencyMs: 500, Cost: 0.25})
+	m.observeRequest(&ProxyMetadata{SelectedModel: "sonnet", SelectedEndpoint: "p/sonnet", LatencyMs: 10})
+	// Rejected before routing: the client's model name is not a label.
+	m.observeRequest(&ProxyMetadata{SelectedModel: "client-chosen-name", StatusCode: 429})
+	m.observeCacheLookup("L1", true)
+	m.observeCacheLookup("L2", false)
+
+	out := scrapeMetrics(t, m)
+	assert.Contains(t, out, `llm_proxy_requests_total{endpoint="p/sonnet",model="sonnet",status="200"} 2`)
+	assert.Contains(t, out, `llm_proxy_requests_total{endpoint="p/sonnet",model="sonnet",status="error"} 1`)
+	assert.Contains(t, out, `llm_proxy_request_duration_seconds_count{endpoint="p/sonnet",model="sonnet"} 3`)
+	assert.Contains(t, out, `llm_proxy_request_duration_seconds_bucket{endpoint="p/sonnet",model="sonnet",le="1"} 2`)
+	assert.Contains(t, out, `llm_proxy_cost_usd_total{endpoint="p/sonnet",model="sonnet"} 0.5`)
+	assert.Contains(t, out, `llm_proxy_requests_total{endpoint="",model="unknown",status="429"} 1`)
+	assert.NotContains(t, out, "client-chosen-name")
+	assert.Contains(t, out, `llm_proxy_routing_cache_lookups_total{level="L1",result="hit"} 1`)
+	assert.Contains(t, out, `llm_proxy_routing_cache_lookups_total{level="L2",result="miss"} 1`)
+}
+
+func TestMetrics_EndpointState(t *testing.T) {
+	hc := NewHealthChecker(config.HealthCheckConfig{Enabled: true, IntervalSeconds: 60, TimeoutSeconds: 5}, zap.NewNop())
+	hc.mu.Lock()
+	hc.states["p/sonnet"] = &EndpointState{Name: "p/sonnet", Status: models.EndpointHealthy, CurrentConnections: 2}
+	hc.states["p/haiku"] = &EndpointState{Name: "p/haiku", Status: models.EndpointUnhealthy}
+	hc.mu.Unlock()
+
+	out := scrapeMetrics(t, NewMetrics(hc))
+	assert.Contains(t, out, `llm_proxy_endpoint_up{endpoint="p/sonnet"} 1`)
+	assert.Contains(t, out, `llm_proxy_endpoint_up{endpoint="p/haiku"} 0`)
+	assert.Contains(t, out, `llm_proxy_endpoint_circuit_state{endpoint="p/sonnet",state="closed"} 1`)
+	assert.Contains(t, out, `llm_proxy_endpoint_circuit_state{endpoint="p/sonnet",state="open"} 0`)
+	assert.Contains(t, out, `llm_proxy_endpoint_connections{endpoint="p/sonnet"} 2`)
+}
+
+func TestMetrics_NilIsNoop(t *testing.T) {
+	var m *Metrics
+	m.observeRequest(&ProxyMetadata{StatusCode: 200})
+	m.observeCacheLookup("L1", true)
+}
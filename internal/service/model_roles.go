@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+// roleSetRefreshInterval bounds how long a worker keeps using a role list
+// another worker has since changed.
+const roleSetRefreshInterval = 30 * time.Second
+
+// builtinRoleDefinitions is the role list without a repository.
+var builtinRoleDefinitions = func() []*models.ModelRoleDefinition {
+	defs := make([]*models.ModelRoleDefinition, 0, len(models.BuiltinModelRoles))
+	for _, role := range models.BuiltinModelRoles {
+		defs = append(defs, &models.ModelRoleDefinition{Name: role, Builtin: true})
+	}
+	return defs
+}()
+
+// RoleSet is the set of task-type roles that routing, routing rules and
+// endpoint selection accept. It is loaded from the model_roles table and
+// reloaded periodically in the background, so roles added on one worker
+// reach the others without lookups waiting on the database. A nil RoleSet
+// knows only the builtin roles.
+type RoleSet struct {
+	repo   *repository.ModelRoleRepository
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	roles    []*models.ModelRoleDefinition
+	loadedAt time.Time
+	loaded   bool        // Roles were read from the repository at least once
+	loading  atomic.Bool // A background reload is running
+}
+
+// NewRoleSet creates a RoleSet backed by repo. Until the first load it knows
+// only the builtin roles.
+func NewRoleSet(repo *repository.ModelRoleRepository, logger *zap.Logger) *RoleSet {
+	return &RoleSet{
+		repo:   repo,
+		logger: logger,
+		now:    time.Now,
+		roles:  builtinRoleDefinitions,
+	}
+}
+
+// Reload reads the roles from the repository.
+func (s *RoleSet) Reload(ctx context.Context) error {
+	roles, err := s.repo.List(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.roles = roles
+	s.loadedAt = s.now()
+	s.loaded = true
+	return nil
+}
+
+// Invalidate reloads the roles at once, e.g. after they were changed on this
+// worker. If that fails the next lookup reloads them in the background.
+func (s *RoleSet) Invalidate() {
+	if s == nil || s.repo == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Reload(ctx); err != nil {
+		s.logger.Warn("failed to reload model roles", zap.Error(err))
+		s.mu.Lock()
+		s.loadedAt = time.Time{}
+		s.mu.Unlock()
+	}
+}
+
+// Roles returns all known roles, builtin roles first.
+func (s *RoleSet) Roles() []*models.ModelRoleDefinition {
+	if s == nil {
+		return builtinRoleDefinitions
+	}
+	s.mu.Lock()
+	stale := s.repo != nil && s.now().Sub(s.loadedAt) >= roleSetRefreshInterval
+	loaded := s.loaded
+	roles := s.roles
+	s.mu.Unlock()
+
+	if !stale || !s.loading.CompareAndSwap(false, true) {
+		return roles
+	}
+	if loaded {
+		// Serve the current list while the reload runs.
+		go func() {
+			defer s.loading.Store(false)
+			s.reload()
+		}()
+		return roles
+	}
+	defer s.loading.Store(false)
+	if s.reload() {
+		s.mu.Lock()
+		roles = s.roles
+		s.mu.Unlock()
+	}
+	return roles
+}
+
+// reload reloads the roles, keeping the current list until the next refresh
+// interval if that fails.
+func (s *RoleSet) reload() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Reload(ctx); err != nil {
+		s.logger.Warn("failed to reload model roles, keeping the current list", zap.Error(err))
+		s.mu.Lock()
+		s.loadedAt = s.now()
+		s.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// Valid reports whether role is a known role.
+func (s *RoleSet) Valid(role models.ModelRole) bool {
+	for _, r := range s.Roles() {
+		if r.Name == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse converts a routing model or rule answer to a known role, falling
+// back to the default role.
+func (s *RoleSet) Parse(str string) models.ModelRole {
+	role := models.ModelRole(strings.ToLower(strings.TrimSpace(str)))
+	if s.Valid(role) {
+		return role
+	}
+	return models.ModelRoleDefault
+}
+
+// Names returns the names of all known roles.
+func (s *RoleSet) Names() []string {
+	roles := s.Roles()
+	names := make([]string, len(roles))
+	for i, r := range roles {
+		names[i] = string(r.Name)
+	}
+	return names
+}
+
+// Custom returns the admin-defined roles.
+func (s *RoleSet) Custom() []*models.ModelRoleDefinition {
+	var custom []*models.ModelRoleDefinition
+	for _, r := range s.Roles() {
+		if !r.Builtin {
+			custom = append(custom, r)
+		}
+	}
+	return custom
+}
+
+// Validate returns an error naming the known roles when role is not one.
+func (s *RoleSet) Validate(role string) error {
+	if s.Valid(models.ModelRole(role)) {
+		return nil
+	}
+	return fmt.Errorf("unknown role %q, must be one of %s", role, strings.Join(s.Names(), ", "))
+}
@@ -0,0 +1,86 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+func TestRoleSet_CustomRoles(t *testing.T) {
+	repo := repository.NewModelRoleRepository(testutil.NewTestDB(t))
+	ctx := context.Background()
+	require.NoError(t, repo.Create(ctx, &models.ModelRoleDefinition{Name: "vision", Description: "requests with images"}))
+
+	rs := NewRoleSet(repo, zap.NewNop())
+	now := time.Now()
+	rs.now = func() time.Time { return now }
+
+	assert.Equal(t, []string{"simple", "default", "complex", "vision"}, rs.Names(), "loaded on first use")
+	assert.Equal(t, models.ModelRole("vision"), rs.Parse(" Vision "))
+	assert.Equal(t, models.ModelRoleDefault, rs.Parse("long-context"))
+	assert.NoError(t, rs.Validate("vision"))
+	assert.EqualError(t, rs.Validate("long-context"), `unknown role "long-context", must be one of simple, default, complex, vision`)
+
+	// A role added elsewhere shows up once the background reload after the
+	// refresh interval finishes, or at once when invalidated.
+	require.NoError(t, repo.Create(ctx, &models.ModelRoleDefinition{Name: "long-context"}))
+	assert.False(t, rs.Valid("long-context"))
+	now = now.Add(roleSetRefreshInterval)
+	assert.Eventually(t, func() bool { return rs.Valid("long-context") }, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, repo.Delete(ctx, "long-context"))
+	rs.Invalidate()
+	assert.False(t, rs.Valid("long-context"))
+	require.Len(t, rs.Custom(), 1)
+	assert.Equal(t, "requests with images", rs.Custom()[0].Description)
+
+	var builtinOnly *RoleSet
+	assert.Equal(t, []string{"simple", "default", "complex"}, builtinOnly.Names())
+	assert.Empty(t, builtinOnly.Custom())
+}
+
+func TestBuildRoutingSystemPrompt(t *testing.T) {
+	assert.Equal(t, RoutingSystemPrompt, BuildRoutingSystemPrompt(nil))
+
+	prompt := BuildRoutingSystemPrompt([]*models.ModelRoleDefinition{
+		{Name: "vision", Description: "请求包含图片"},
+		{Name: "long-context"},
+	})
+	assert.Contains(t, prompt, "### vision（自定义）\n请求包含图片\n\n### long-context（自定义）\n管理员自定义角色\n\n## 判断原则")
+	assert.Contains(t, prompt, `{"task_type": "simple|default|complex|vision|long-context"`)
+}
+
+func TestSelectForcedRole_CustomRole(t *testing.T) {
+	logger := zap.NewNop()
+	repo := repository.NewModelRoleRepository(testutil.NewTestDB(t))
+	require.NoError(t, repo.Create(context.Background(), &models.ModelRoleDefinition{Name: "vision"}))
+
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	es := NewEndpointSelector(NewModelSelector(hc, logger), hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, nil, logger)
+	endpoints := []*models.Endpoint{{
+		Model:    &models.Model{ID: 1, Name: "claude-vision", Role: "vision", Enabled: true},
+		Provider: &models.Provider{ID: 1, Name: "provider-1", Weight: 1, Enabled: true},
+	}}
+	hc.Start(endpoints)
+	defer hc.Stop()
+
+	_, err := es.SelectForcedRole("vision", &models.AnthropicRequest{}, endpoints)
+	assert.ErrorIs(t, err, ErrInvalidForcedRole, "unknown without the role set")
+
+	es.SetRoleSet(NewRoleSet(repo, logger))
+	result, err := es.SelectForcedRole("vision", &models.AnthropicRequest{}, endpoints)
+	require.NoError(t, err)
+	assert.Equal(t, "claude-vision", result.Model.Name)
+	assert.Equal(t, models.ModelRole("vision"), result.TaskType)
+}
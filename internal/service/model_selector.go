@@ -28,8 +28,10 @@ func NewModelSelector(hc *HealthChecker, logger *zap.Logger) *ModelSelector {
 	}
 }
 
-// SelectModelByWeight picks the model with the highest weight (deterministic selection).
-// When weights are equal, returns the first model (stable ordering).
+// SelectModelByWeight picks a model at random in proportion to its weight,
+// so weights of 80 and 20 send about 80% of a role's requests to the first
+// model. Models with a weight of 0 or less are never picked unless no model
+// has a positive weight, in which case the first model is returned.
 func (s *ModelSelector) SelectModelByWeight(modelList []*models.Model) *models.Model {
 	if len(modelList) == 0 {
 		return nil
@@ -38,23 +40,27 @@ func (s *ModelSelector) SelectModelByWeight(modelList []*models.Model) *models.M
 		return modelList[0]
 	}
 
-	// Select the model with the highest weight (deterministic)
-	// When weights are equal, select the first one (stable sort semantics)
-	var best *models.Model
+	total := 0
+	for _, m := range modelList {
+		if m.Weight > 0 {
+			total += m.Weight
+		}
+	}
+	if total == 0 {
+		return modelList[0]
+	}
+
+	r := secureRandIntn(total)
 	for _, m := range modelList {
 		if m.Weight <= 0 {
 			continue
 		}
-		if best == nil || m.Weight > best.Weight {
-			best = m
+		if r < m.Weight {
+			return m
 		}
+		r -= m.Weight
 	}
-
-	// If all models have weight 0, return the first one (deterministic fallback)
-	if best == nil {
-		return modelList[0]
-	}
-	return best
+	return modelList[len(modelList)-1]
 }
 
 // GetModelsForRole extracts unique models with the specified role from endpoints.
@@ -95,17 +101,45 @@ func (s *ModelSelector) HasHealthyEndpoints(model *models.Model, endpoints []*mo
 	return false
 }
 
-// FindAvailableModelWithFallback finds an available model with cross-role fallback.
+// RoleFallbackChain returns the roles to try, in order, for a request whose
+// preferred role is role. configured is the admin-defined degradation chain
+// (RoutingConfig.RoleFallbackChain): role is followed by the roles after it
+// in the chain, or by the whole chain when role is not part of it. An empty
+// chain uses FallbackPriority.
+func RoleFallbackChain(role models.ModelRole, configured []string) []models.ModelRole {
+	if len(configured) == 0 {
+		if chain := FallbackPriority[role]; len(chain) > 0 {
+			return chain
+		}
+		return []models.ModelRole{role, models.ModelRoleDefault}
+	}
+
+	rest := configured
+	for i, r := range configured {
+		if models.ModelRole(r) == role {
+			rest = configured[i+1:]
+			break
+		}
+	}
+	chain := []models.ModelRole{role}
+	for _, r := range rest {
+		if models.ModelRole(r) != role {
+			chain = append(chain, models.ModelRole(r))
+		}
+	}
+	return chain
+}
+
+// FindAvailableModelWithFallback finds an available model with cross-role
+// fallback along RoleFallbackChain(originalRole, configuredChain).
 // Returns (model, fallbackInfo, error).
 func (s *ModelSelector) FindAvailableModelWithFallback(
 	originalRole models.ModelRole,
 	originalModel *models.Model,
 	endpoints []*models.Endpoint,
+	configuredChain []string,
 ) (*models.Model, *models.FallbackInfo, error) {
-	fallbackChain := FallbackPriority[originalRole]
-	if len(fallbackChain) == 0 {
-		fallbackChain = []models.ModelRole{originalRole, models.ModelRoleDefault}
-	}
+	fallbackChain := RoleFallbackChain(originalRole, configuredChain)
 
 	var triedRoles []string
 	for _, role := range fallbackChain {
@@ -137,6 +171,13 @@ func (s *ModelSelector) FindAvailableModelWithFallback(
 			}
 		}
 
+		if role != originalRole {
+			s.logger.Warn("preferred role has no healthy endpoint, degraded along fallback chain",
+				zap.String("original_role", string(originalRole)),
+				zap.String("fallback_role", string(role)),
+				zap.Strings("fallback_chain", triedRoles))
+		}
+
 		s.logger.Debug("model selected",
 			zap.String("original_role", string(originalRole)),
 			zap.String("selected_role", string(role)),
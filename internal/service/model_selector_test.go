@@ -34,24 +34,6 @@ func TestSelectModelByWeight(t *testing.T) {
 			},
 			wantModel: &models.Model{ID: 1, Name: "model-1", Weight: 5},
 		},
-		{
-			name: "multiple models with different weights returns highest weight",
-			modelList: []*models.Model{
-				{ID: 1, Name: "model-1", Weight: 3},
-				{ID: 2, Name: "model-2", Weight: 10},
-				{ID: 3, Name: "model-3", Weight: 5},
-			},
-			wantModel: &models.Model{ID: 2, Name: "model-2", Weight: 10},
-		},
-		{
-			name: "multiple models with same weight returns first",
-			modelList: []*models.Model{
-				{ID: 1, Name: "model-1", Weight: 5},
-				{ID: 2, Name: "model-2", Weight: 5},
-				{ID: 3, Name: "model-3", Weight: 5},
-			},
-			wantModel: &models.Model{ID: 1, Name: "model-1", Weight: 5},
-		},
 		{
 			name: "all models with zero weight returns first",
 			modelList: []*models.Model{
@@ -62,7 +44,7 @@ func TestSelectModelByWeight(t *testing.T) {
 			wantModel: &models.Model{ID: 1, Name: "model-1", Weight: 0},
 		},
 		{
-			name: "mixed zero and positive weights returns highest positive",
+			name: "mixed zero and positive weights returns the only positive",
 			modelList: []*models.Model{
 				{ID: 1, Name: "model-1", Weight: 0},
 				{ID: 2, Name: "model-2", Weight: 8},
@@ -104,32 +86,120 @@ func TestSelectModelByWeight(t *testing.T) {
 	}
 }
 
-// TestSelectModelByWeightDeterministic verifies that the function is deterministic
-// by calling it multiple times with the same input and expecting the same result.
-func TestSelectModelByWeightDeterministic(t *testing.T) {
+// TestSelectModelByWeightDistribution verifies that over many selections
+// each model is picked in proportion to its weight.
+func TestSelectModelByWeightDistribution(t *testing.T) {
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ms := NewModelSelector(hc, logger)
+
+	tests := []struct {
+		name      string
+		modelList []*models.Model
+		want      map[int64]float64
+	}{
+		{
+			name: "80/20 migration split",
+			modelList: []*models.Model{
+				{ID: 1, Name: "complex-old", Weight: 80},
+				{ID: 2, Name: "complex-new", Weight: 20},
+			},
+			want: map[int64]float64{1: 0.8, 2: 0.2},
+		},
+		{
+			name: "equal weights share evenly",
+			modelList: []*models.Model{
+				{ID: 1, Name: "model-1", Weight: 5},
+				{ID: 2, Name: "model-2", Weight: 5},
+			},
+			want: map[int64]float64{1: 0.5, 2: 0.5},
+		},
+		{
+			name: "zero weight is never picked",
+			modelList: []*models.Model{
+				{ID: 1, Name: "model-1", Weight: 3},
+				{ID: 2, Name: "model-2", Weight: 0},
+				{ID: 3, Name: "model-3", Weight: 1},
+			},
+			want: map[int64]float64{1: 0.75, 2: 0, 3: 0.25},
+		},
+	}
+
+	const draws = 20000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts := make(map[int64]int)
+			for range draws {
+				counts[ms.SelectModelByWeight(tt.modelList).ID]++
+			}
+			for id, share := range tt.want {
+				assert.InDelta(t, share, float64(counts[id])/draws, 0.02, "model %d", id)
+			}
+		})
+	}
+}
+
+func TestRoleFallbackChain(t *testing.T) {
+	degrade := []string{"complex", "default", "simple"}
+	tests := []struct {
+		name       string
+		role       models.ModelRole
+		configured []string
+		want       []models.ModelRole
+	}{
+		{"built-in order", models.ModelRoleComplex, nil, []models.ModelRole{"complex", "default"}},
+		{"built-in custom role", "vision", nil, []models.ModelRole{"vision", "default"}},
+		{"head of chain", models.ModelRoleComplex, degrade, []models.ModelRole{"complex", "default", "simple"}},
+		{"middle of chain", models.ModelRoleDefault, degrade, []models.ModelRole{"default", "simple"}},
+		{"end of chain", models.ModelRoleSimple, degrade, []models.ModelRole{"simple"}},
+		{"role not in chain", "vision", degrade, []models.ModelRole{"vision", "complex", "default", "simple"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, RoleFallbackChain(tt.role, tt.configured))
+		})
+	}
+}
+
+func TestFindAvailableModelWithFallback_WeightedWithinRole(t *testing.T) {
 	logger := zap.NewNop()
 	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
 	ms := NewModelSelector(hc, logger)
 
-	modelList := []*models.Model{
-		{ID: 1, Name: "model-1", Weight: 3},
-		{ID: 2, Name: "model-2", Weight: 10},
-		{ID: 3, Name: "model-3", Weight: 5},
+	endpoints := []*models.Endpoint{
+		{
+			Model:    &models.Model{ID: 1, Name: "complex-old", Role: models.ModelRoleComplex, Weight: 80, Enabled: true},
+			Provider: &models.Provider{ID: 1, Name: "provider-1", Weight: 1, Enabled: true},
+		},
+		{
+			Model:    &models.Model{ID: 2, Name: "complex-new", Role: models.ModelRoleComplex, Weight: 20, Enabled: true},
+			Provider: &models.Provider{ID: 1, Name: "provider-1", Weight: 1, Enabled: true},
+		},
+		{
+			Model:    &models.Model{ID: 3, Name: "complex-disabled", Role: models.ModelRoleComplex, Weight: 1000, Enabled: false},
+			Provider: &models.Provider{ID: 1, Name: "provider-1", Weight: 1, Enabled: true},
+		},
+		{
+			Model:    &models.Model{ID: 4, Name: "complex-down", Role: models.ModelRoleComplex, Weight: 1000, Enabled: true},
+			Provider: &models.Provider{ID: 1, Name: "provider-1", Weight: 1, Enabled: true},
+		},
 	}
+	hc.Start(endpoints)
+	defer hc.Stop()
+	hc.UpdateState("provider-1/complex-down", models.EndpointUnhealthy, "down")
 
-	// Call the function 100 times and verify it always returns the same model
-	var firstResult *models.Model
-	for range 100 {
-		result := ms.SelectModelByWeight(modelList)
-		if firstResult == nil {
-			firstResult = result
-		} else {
-			assert.Equal(t, firstResult.ID, result.ID, "SelectModelByWeight should be deterministic")
+	const draws = 10000
+	counts := make(map[string]int)
+	for range draws {
+		model, fallbackInfo, err := ms.FindAvailableModelWithFallback(models.ModelRoleComplex, nil, endpoints, nil)
+		if !assert.NoError(t, err) {
+			return
 		}
+		assert.Nil(t, fallbackInfo)
+		counts[model.Name]++
 	}
-
-	// Verify it's the highest weight model
-	assert.Equal(t, int64(2), firstResult.ID)
-	assert.Equal(t, "model-2", firstResult.Name)
-	assert.Equal(t, 10, firstResult.Weight)
+	assert.Zero(t, counts["complex-disabled"])
+	assert.Zero(t, counts["complex-down"])
+	assert.InDelta(t, 0.8, float64(counts["complex-old"])/draws, 0.03)
+	assert.InDelta(t, 0.2, float64(counts["complex-new"])/draws, 0.03)
 }
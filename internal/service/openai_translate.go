@@ -0,0 +1,241 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// ChatRequestToAnthropic translates an OpenAI chat completions request into an
+// Anthropic Messages request. System and developer messages are joined into
+// the system prompt. MaxTokens is left 0 when the request sets neither
+// max_tokens nor max_completion_tokens, for the configured default to apply.
+func ChatRequestToAnthropic(req *models.ChatCompletionRequest) (*models.AnthropicRequest, error) {
+	out := &models.AnthropicRequest{
+		Model:         req.Model,
+		Stream:        req.Stream,
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: req.Stop,
+	}
+	if req.MaxCompletionTokens != nil {
+		out.MaxTokens = *req.MaxCompletionTokens
+	} else if req.MaxTokens != nil {
+		out.MaxTokens = *req.MaxTokens
+	}
+	if (req.MaxCompletionTokens != nil || req.MaxTokens != nil) && out.MaxTokens <= 0 {
+		return nil, fmt.Errorf("max_tokens must be positive")
+	}
+	if req.User != "" {
+		out.Metadata = map[string]string{"user_id": req.User}
+	}
+
+	var system []string
+	for i, msg := range req.Messages {
+		switch msg.Role {
+		case "system", "developer":
+			if msg.Content.Text != "" {
+				system = append(system, msg.Content.Text)
+			}
+		case "user", "assistant":
+			out.Messages = append(out.Messages, models.Message{
+				Role:    msg.Role,
+				Content: models.MessageContent{Text: msg.Content.Text},
+			})
+		default:
+			return nil, fmt.Errorf("messages[%d]: unsupported role %q", i, msg.Role)
+		}
+	}
+	if len(out.Messages) == 0 {
+		return nil, fmt.Errorf("messages must contain at least one user or assistant message")
+	}
+	if len(system) > 0 {
+		out.System = &models.SystemPrompt{Text: strings.Join(system, "\n\n")}
+	}
+	return out, nil
+}
+
+// AnthropicToChatResponse translates an Anthropic Messages response into an
+// OpenAI chat completion.
+func AnthropicToChatResponse(resp *models.AnthropicResponse) *models.ChatCompletionResponse {
+	var text strings.Builder
+	for _, part := range resp.Content {
+		if part.Type == "text" {
+			text.WriteString(part.Text)
+		}
+	}
+	return &models.ChatCompletionResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   resp.Model,
+		Choices: []models.ChatChoice{{
+			Message: models.ChatMessage{
+				Role:    "assistant",
+				Content: models.ChatContent{Text: text.String()},
+			},
+			FinishReason: chatFinishReason(resp.StopReason),
+		}},
+		Usage: chatUsage(resp.Usage.InputTokens, resp.Usage.OutputTokens),
+	}
+}
+
+// AnthropicErrorToChat rewrites an Anthropic error body into the OpenAI error
+// envelope. Bodies that are not Anthropic errors become the message verbatim.
+func AnthropicErrorToChat(body []byte) *models.ChatErrorResponse {
+	var anthropicErr models.ErrorResponse
+	if err := json.Unmarshal(body, &anthropicErr); err == nil && anthropicErr.Error.Message != "" {
+		return &models.ChatErrorResponse{Error: models.ChatErrorDetail{
+			Message: anthropicErr.Error.Message,
+			Type:    anthropicErr.Error.Type,
+		}}
+	}
+	return &models.ChatErrorResponse{Error: models.ChatErrorDetail{
+		Message: string(body),
+		Type:    "api_error",
+	}}
+}
+
+// chatFinishReason maps an Anthropic stop_reason to an OpenAI finish_reason.
+func chatFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+func chatUsage(input, output int) models.ChatUsage {
+	return models.ChatUsage{
+		PromptTokens:     input,
+		CompletionTokens: output,
+		TotalTokens:      input + output,
+	}
+}
+
+// ChatStreamTranslator converts an Anthropic SSE stream, one line at a time,
+// into OpenAI chat.completion.chunk events. It holds per-stream state and
+// must not be shared between requests.
+type ChatStreamTranslator struct {
+	includeUsage bool
+	id           string
+	model        string
+	created      int64
+	inputTokens  int
+	outputTokens int
+}
+
+// NewChatStreamTranslator creates a translator. When includeUsage is set a
+// final usage-only chunk is emitted before [DONE], as with OpenAI's
+// stream_options.include_usage.
+func NewChatStreamTranslator(includeUsage bool) *ChatStreamTranslator {
+	return &ChatStreamTranslator{includeUsage: includeUsage, created: time.Now().Unix()}
+}
+
+// chatStreamEvent is the subset of Anthropic stream events used for translation.
+type chatStreamEvent struct {
+	Type    string `json:"type"`
+	Message *struct {
+		ID    string        `json:"id"`
+		Model string        `json:"model"`
+		Usage *models.Usage `json:"usage"`
+	} `json:"message"`
+	Delta *struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *models.Usage       `json:"usage"`
+	Error *models.ErrorDetail `json:"error"`
+}
+
+// Translate converts one upstream SSE line into zero or more OpenAI SSE
+// events. Event-name lines, blank lines and pings produce no output.
+func (t *ChatStreamTranslator) Translate(line []byte) []byte {
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return nil
+	}
+	var event chatStreamEvent
+	if err := json.Unmarshal(bytes.TrimSpace(data), &event); err != nil {
+		return nil
+	}
+
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			t.id = event.Message.ID
+			t.model = event.Message.Model
+			if event.Message.Usage != nil {
+				t.inputTokens = event.Message.Usage.InputTokens
+			}
+		}
+		return t.chunk(models.ChatDelta{Role: "assistant"}, nil, nil)
+	case "content_block_delta":
+		if event.Delta == nil || event.Delta.Type != "text_delta" || event.Delta.Text == "" {
+			return nil
+		}
+		return t.chunk(models.ChatDelta{Content: event.Delta.Text}, nil, nil)
+	case "message_delta":
+		if event.Usage != nil {
+			t.outputTokens = event.Usage.OutputTokens
+		}
+		if event.Delta == nil || event.Delta.StopReason == "" {
+			return nil
+		}
+		reason := chatFinishReason(event.Delta.StopReason)
+		return t.chunk(models.ChatDelta{}, &reason, nil)
+	case "message_stop":
+		var out []byte
+		if t.includeUsage {
+			usage := chatUsage(t.inputTokens, t.outputTokens)
+			out = t.chunk(models.ChatDelta{}, nil, &usage)
+		}
+		return append(out, "data: [DONE]\n\n"...)
+	case "error":
+		if event.Error == nil {
+			return nil
+		}
+		return sseData(models.ChatErrorResponse{Error: models.ChatErrorDetail{
+			Message: event.Error.Message,
+			Type:    event.Error.Type,
+		}})
+	}
+	return nil
+}
+
+// chunk renders a chat.completion.chunk event. A usage chunk carries no choices.
+func (t *ChatStreamTranslator) chunk(delta models.ChatDelta, finishReason *string, usage *models.ChatUsage) []byte {
+	c := models.ChatCompletionChunk{
+		ID:      t.id,
+		Object:  "chat.completion.chunk",
+		Created: t.created,
+		Model:   t.model,
+		Choices: []models.ChatChunkChoice{},
+		Usage:   usage,
+	}
+	if usage == nil {
+		c.Choices = append(c.Choices, models.ChatChunkChoice{Delta: delta, FinishReason: finishReason})
+	}
+	return sseData(c)
+}
+
+func sseData(v any) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	out := make([]byte, 0, len(b)+8)
+	out = append(out, "data: "...)
+	out = append(out, b...)
+	return append(out, "\n\n"...)
+}
@@ -0,0 +1,127 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+func TestChatRequestToAnthropic(t *testing.T) {
+	var req models.ChatCompletionRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"model": "auto",
+		"max_completion_tokens": 256,
+		"temperature": 0.2,
+		"stop": "END",
+		"stream": true,
+		"messages": [
+			{"role": "system", "content": "be brief"},
+			{"role": "developer", "content": [{"type": "text", "text": "use english"}]},
+			{"role": "user", "content": "hi"},
+			{"role": "assistant", "content": "hello"},
+			{"role": "user", "content": [{"type": "text", "text": "more"}]}
+		]
+	}`), &req))
+
+	out, err := ChatRequestToAnthropic(&req)
+	require.NoError(t, err)
+	assert.Equal(t, "auto", out.Model)
+	assert.Equal(t, 256, out.MaxTokens)
+	assert.True(t, out.Stream)
+	require.NotNil(t, out.Temperature)
+	assert.Equal(t, 0.2, *out.Temperature)
+	assert.Equal(t, []string{"END"}, out.StopSequences)
+	assert.Equal(t, "be brief\n\nuse english", out.System.String())
+	require.Len(t, out.Messages, 3)
+	assert.Equal(t, "user", out.Messages[0].Role)
+	assert.Equal(t, "hi", out.Messages[0].Content.Text)
+	assert.Equal(t, "assistant", out.Messages[1].Role)
+	assert.Equal(t, "more", out.Messages[2].Content.Text)
+
+	req.MaxCompletionTokens = nil
+	out, err = ChatRequestToAnthropic(&req)
+	require.NoError(t, err)
+	assert.Zero(t, out.MaxTokens, "left for the configured default")
+
+	zero := 0
+	req.MaxTokens = &zero
+	_, err = ChatRequestToAnthropic(&req)
+	assert.Error(t, err)
+
+	_, err = ChatRequestToAnthropic(&models.ChatCompletionRequest{
+		Model:    "auto",
+		Messages: []models.ChatMessage{{Role: "system", Content: models.ChatContent{Text: "x"}}},
+	})
+	assert.Error(t, err)
+}
+
+func TestAnthropicToChatResponse(t *testing.T) {
+	resp := AnthropicToChatResponse(&models.AnthropicResponse{
+		ID:         "msg_1",
+		Model:      "claude-sonnet-4",
+		Content:    []models.ContentPart{{Type: "thinking", Thinking: "hmm"}, {Type: "text", Text: "answer"}},
+		StopReason: "max_tokens",
+		Usage:      models.Usage{InputTokens: 10, OutputTokens: 5},
+	})
+	assert.Equal(t, "chat.completion", resp.Object)
+	assert.Equal(t, "claude-sonnet-4", resp.Model)
+	require.Len(t, resp.Choices, 1)
+	assert.Equal(t, "answer", resp.Choices[0].Message.Content.Text)
+	assert.Equal(t, "length", resp.Choices[0].FinishReason)
+	assert.Equal(t, models.ChatUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}, resp.Usage)
+}
+
+func TestChatStreamTranslator(t *testing.T) {
+	upstream := []string{
+		"event: message_start\n",
+		`data: {"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4","usage":{"input_tokens":7}}}` + "\n",
+		"\n",
+		`data: {"type":"ping"}` + "\n",
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}` + "\n",
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}` + "\n",
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}` + "\n",
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":3}}` + "\n",
+		`data: {"type":"message_stop"}` + "\n",
+	}
+
+	tr := NewChatStreamTranslator(true)
+	var out strings.Builder
+	for _, line := range upstream {
+		out.Write(tr.Translate([]byte(line)))
+	}
+
+	var chunks []models.ChatCompletionChunk
+	var done bool
+	for _, event := range strings.Split(strings.TrimSpace(out.String()), "\n\n") {
+		data := strings.TrimPrefix(event, "data: ")
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk models.ChatCompletionChunk
+		require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+		chunks = append(chunks, chunk)
+	}
+
+	assert.True(t, done)
+	require.Len(t, chunks, 5)
+	for _, chunk := range chunks {
+		assert.Equal(t, "chat.completion.chunk", chunk.Object)
+		assert.Equal(t, "msg_1", chunk.ID)
+		assert.Equal(t, "claude-sonnet-4", chunk.Model)
+	}
+	assert.Equal(t, "assistant", chunks[0].Choices[0].Delta.Role)
+	assert.Equal(t, "Hel", chunks[1].Choices[0].Delta.Content)
+	assert.Equal(t, "lo", chunks[2].Choices[0].Delta.Content)
+	require.NotNil(t, chunks[3].Choices[0].FinishReason)
+	assert.Equal(t, "stop", *chunks[3].Choices[0].FinishReason)
+	assert.Empty(t, chunks[4].Choices)
+	assert.Equal(t, &models.ChatUsage{PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10}, chunks[4].Usage)
+}
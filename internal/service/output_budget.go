@@ -0,0 +1,130 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+)
+
+// outputBudget tracks a stream's output tokens against a configured cap.
+// Anthropic only reports output usage in message_start and the closing
+// message_delta, so in between the count is estimated from streamed deltas.
+// Reported usage is cumulative, and the larger of the two figures is used,
+// so nothing is counted twice.
+type outputBudget struct {
+	limit     int
+	estimated int
+	openBlock *int // Index of the content block currently streaming
+	stopped   bool // Upstream has already sent its stop_reason
+}
+
+// budgetStreamEvent is the subset of a stream event needed for budgeting.
+type budgetStreamEvent struct {
+	Type  string `json:"type"`
+	Index *int   `json:"index"`
+	Delta *struct {
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+}
+
+// observe updates the estimate from one upstream SSE line.
+func (b *outputBudget) observe(line []byte) {
+	if b.limit <= 0 {
+		return
+	}
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return
+	}
+	var event budgetStreamEvent
+	if err := json.Unmarshal(bytes.TrimSpace(data), &event); err != nil {
+		return
+	}
+	switch event.Type {
+	case "content_block_start":
+		b.openBlock = event.Index
+	case "content_block_stop":
+		b.openBlock = nil
+	case "content_block_delta":
+		if event.Delta != nil {
+			b.estimated += estimateTokens(event.Delta.Text) +
+				estimateTokens(event.Delta.Thinking) +
+				estimateTokens(event.Delta.PartialJSON)
+		}
+	case "message_delta":
+		if event.Delta != nil && event.Delta.StopReason != "" {
+			b.stopped = true
+		}
+	case "message_stop":
+		b.stopped = true
+	}
+}
+
+// used returns the output token count given the latest reported usage.
+func (b *outputBudget) used(reported int) int {
+	return max(reported, b.estimated)
+}
+
+// exceeded reports whether the stream should be cut off. A stream whose
+// upstream has already finished is left alone.
+func (b *outputBudget) exceeded(reported int) bool {
+	return b.limit > 0 && !b.stopped && b.used(reported) > b.limit
+}
+
+// stopEvents returns the SSE lines that close the stream on the client's
+// side: the open content block, a max_tokens message_delta and message_stop.
+// Each line is returned separately, as they are read from upstream.
+func (b *outputBudget) stopEvents(outputTokens int) [][]byte {
+	var lines [][]byte
+	event := func(name, data string) {
+		lines = append(lines,
+			[]byte("event: "+name+"\n"),
+			[]byte("data: "+data+"\n"),
+			[]byte("\n"))
+	}
+	if b.openBlock != nil {
+		event("content_block_stop", fmt.Sprintf(`{"type":"content_block_stop","index":%d}`, *b.openBlock))
+	}
+	event("message_delta", fmt.Sprintf(
+		`{"type":"message_delta","delta":{"stop_reason":"max_tokens","stop_sequence":null},"usage":{"output_tokens":%d}}`,
+		outputTokens))
+	event("message_stop", `{"type":"message_stop"}`)
+	b.stopped = true
+	return lines
+}
+
+// estimateTokens roughly estimates the token count of s: about four ASCII
+// characters per token, and one token per non-ASCII character. It is also
+// what token_estimate() in routing rule conditions reports.
+func estimateTokens(s string) int {
+	if s == "" {
+		return 0
+	}
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// outputBudgetError is returned when a non-streaming response reports more
+// output tokens than the configured budget.
+func outputBudgetError(outputTokens, budget int) *UpstreamError {
+	body, _ := json.Marshal(map[string]any{
+		"type": "error",
+		"error": map[string]string{
+			"type":    "invalid_request_error",
+			"message": fmt.Sprintf("response used %d output tokens, exceeding the budget of %d", outputTokens, budget),
+		},
+	})
+	return newUpstreamError(http.StatusBadRequest, body, 0)
+}
@@ -0,0 +1,126 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestProxyService_StreamOutputBudgetCutoff(t *testing.T) {
+	upstreamClosed := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":12,\"output_tokens\":1}}}\n\n")
+		fmt.Fprint(w, "event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n")
+		// A runaway generation: 40 tokens per delta, far past the budget.
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":%q}}\n\n", strings.Repeat("word", 40))
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+		close(upstreamClosed)
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	lb := NewLoadBalancerWithStrategy(models.StrategyRoundRobin)
+	ps := NewProxyService(hc, lb, nil, logger)
+
+	ep := createProxyTestEndpoint(upstream.URL)
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+
+	req := &models.AnthropicRequest{
+		Model:     ep.Model.Name,
+		MaxTokens: 8192,
+		Stream:    true,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: ep.Model.Role, MaxOutputTokens: 100}
+
+	chunks, _, err := ps.ProxyStreamRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+	require.NoError(t, err)
+
+	var body string
+	var finalMeta *ProxyMetadata
+	for chunk := range chunks {
+		body += string(chunk.Data)
+		if chunk.Done {
+			finalMeta = chunk.Meta
+		}
+	}
+
+	select {
+	case <-upstreamClosed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream connection was not closed")
+	}
+
+	assert.Equal(t, 3, strings.Count(body, "text_delta"), "stream should stop once the budget is exceeded")
+	assert.Contains(t, body, "event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n")
+	assert.Contains(t, body, "event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"max_tokens\",\"stop_sequence\":null},\"usage\":{\"output_tokens\":120}}\n\n")
+	assert.True(t, strings.HasSuffix(body, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+
+	require.NotNil(t, finalMeta)
+	assert.True(t, finalMeta.Success)
+	assert.Equal(t, 120, finalMeta.OutputTokens)
+}
+
+func TestProxyService_StreamOutputBudgetIgnoresFinishedStream(t *testing.T) {
+	budget := &outputBudget{limit: 10}
+	budget.observe([]byte(`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":50}}`))
+	assert.False(t, budget.exceeded(50), "a stream that already stopped is not cut off")
+
+	unlimited := &outputBudget{}
+	unlimited.observe([]byte(`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hello"}}`))
+	assert.False(t, unlimited.exceeded(1000))
+}
+
+func TestProxyService_ProxyRequest_OutputBudgetExceeded(t *testing.T) {
+	var calls int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"long"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":500}}`)
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	lb := NewLoadBalancerWithStrategy(models.StrategyRoundRobin)
+	ps := NewProxyService(hc, lb, nil, logger)
+
+	ep := createProxyTestEndpoint(upstream.URL)
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+
+	req := &models.AnthropicRequest{
+		Model:     ep.Model.Name,
+		MaxTokens: 1024,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: ep.Model.Role, MaxOutputTokens: 100}
+
+	resp, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+	assert.Nil(t, resp)
+	var ue *UpstreamError
+	require.True(t, errors.As(err, &ue))
+	assert.Equal(t, http.StatusBadRequest, ue.StatusCode)
+	assert.Contains(t, string(ue.Body), "exceeding the budget of 100")
+	require.NotNil(t, meta, "spent tokens are reported for logging")
+	assert.Equal(t, 500, meta.OutputTokens)
+	assert.Equal(t, 1, calls, "an over-budget response is not retried")
+}
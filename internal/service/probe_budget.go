@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+// probeSpendKeyPrefix prefixes the shared_state key holding a provider's
+// probe spend for the day.
+const probeSpendKeyPrefix = "probe_spend:"
+
+// probeUsageEstimate is the usage assumed for a completion probe whose
+// response does not report any: a short prompt and a single output token.
+var probeUsageEstimate = models.Usage{InputTokens: 10, OutputTokens: 1}
+
+// ProbeBudgetStatus reports one provider's probe spend for the day.
+type ProbeBudgetStatus struct {
+	Provider  string  `json:"provider"`
+	Date      string  `json:"date"` // UTC day the spend counts toward
+	SpentUSD  float64 `json:"spent_usd"`
+	Remaining float64 `json:"remaining_usd"`
+	Exhausted bool    `json:"exhausted"`
+}
+
+// ProbeBudgetSnapshot reports the probe budget for the system status.
+type ProbeBudgetSnapshot struct {
+	Enabled        bool                `json:"enabled"`
+	DailyBudgetUSD float64             `json:"daily_budget_usd"`
+	Providers      []ProbeBudgetStatus `json:"providers"`
+}
+
+// probeSpend is a provider's probe spend on one UTC day.
+type probeSpend struct {
+	Date     string  `json:"date"`
+	SpentUSD float64 `json:"spent_usd"`
+}
+
+// ProbeBudget caps what completion health probes may spend per provider and
+// UTC day. Once a provider's cap is reached its endpoints are probed over
+// TCP until the next day. Spend is kept in shared_state so it survives
+// restarts, and only the primary worker sends completion probes, so running
+// several workers does not multiply it. A nil ProbeBudget allows every
+// probe.
+type ProbeBudget struct {
+	daily   float64
+	store   *repository.SharedStateRepository
+	primary func() bool
+	now     func() time.Time
+	logger  *zap.Logger
+
+	mu     sync.Mutex
+	loaded bool
+	spend  map[string]*probeSpend
+}
+
+// NewProbeBudget creates a ProbeBudget allowing dailyUSD of probe spend per
+// provider. It returns nil, meaning unlimited, when dailyUSD is 0.
+// isPrimary reports whether this worker is the primary; nil means a single
+// worker.
+func NewProbeBudget(dailyUSD float64, store *repository.SharedStateRepository, isPrimary func() bool, logger *zap.Logger) *ProbeBudget {
+	if dailyUSD <= 0 {
+		return nil
+	}
+	if isPrimary == nil {
+		isPrimary = func() bool { return true }
+	}
+	return &ProbeBudget{
+		daily:   dailyUSD,
+		store:   store,
+		primary: isPrimary,
+		now:     time.Now,
+		logger:  logger,
+		spend:   make(map[string]*probeSpend),
+	}
+}
+
+// Allow reports whether a completion probe of model may be sent to
+// provider: this worker is the primary and the probe's estimated cost fits
+// what is left of the provider's budget for the day.
+func (b *ProbeBudget) Allow(provider string, model *models.Model) bool {
+	if b == nil {
+		return true
+	}
+	if !b.primary() {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.load()
+	return b.today(provider).SpentUSD+calculateCost(model, probeUsageEstimate) <= b.daily
+}
+
+// Record adds the cost of a completion probe of model to provider's spend.
+// usage is the probe response's usage; nil falls back to the estimate.
+func (b *ProbeBudget) Record(provider string, model *models.Model, usage *models.Usage) {
+	if b == nil {
+		return
+	}
+	if usage == nil {
+		usage = &probeUsageEstimate
+	}
+	cost := calculateCost(model, *usage)
+
+	b.mu.Lock()
+	b.load()
+	s := b.today(provider)
+	wasExhausted := s.SpentUSD >= b.daily
+	s.SpentUSD += cost
+	saved := *s
+	b.mu.Unlock()
+
+	if !wasExhausted && saved.SpentUSD >= b.daily {
+		b.logger.Warn("health probe budget exhausted, probing over TCP until tomorrow",
+			zap.String("provider", provider),
+			zap.Float64("spent_usd", saved.SpentUSD),
+			zap.Float64("daily_budget_usd", b.daily))
+	}
+	value, _ := json.Marshal(saved)
+	if err := b.store.SetState(context.Background(), probeSpendKeyPrefix+provider, string(value), "health_checker"); err != nil {
+		b.logger.Warn("failed to save probe spend", zap.String("provider", provider), zap.Error(err))
+	}
+}
+
+// Snapshot returns each provider's probe spend for the day.
+func (b *ProbeBudget) Snapshot() ProbeBudgetSnapshot {
+	if b == nil {
+		return ProbeBudgetSnapshot{Providers: []ProbeBudgetStatus{}}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.load()
+
+	providers := make([]ProbeBudgetStatus, 0, len(b.spend))
+	for name := range b.spend {
+		s := b.today(name)
+		providers = append(providers, ProbeBudgetStatus{
+			Provider:  name,
+			Date:      s.Date,
+			SpentUSD:  s.SpentUSD,
+			Remaining: math.Max(0, b.daily-s.SpentUSD),
+			Exhausted: s.SpentUSD >= b.daily,
+		})
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Provider < providers[j].Provider })
+	return ProbeBudgetSnapshot{Enabled: true, DailyBudgetUSD: b.daily, Providers: providers}
+}
+
+// today returns provider's spend, reset when it was counted on an earlier
+// day. b.mu must be held.
+func (b *ProbeBudget) today(provider string) *probeSpend {
+	date := b.now().UTC().Format("2006-01-02")
+	s, ok := b.spend[provider]
+	if !ok {
+		s = &probeSpend{}
+		b.spend[provider] = s
+	}
+	if s.Date != date {
+		*s = probeSpend{Date: date}
+	}
+	return s
+}
+
+// load reads the stored probe spend once. b.mu must be held.
+func (b *ProbeBudget) load() {
+	if b.loaded {
+		return
+	}
+	b.loaded = true
+	states, err := b.store.GetAllStates(context.Background())
+	if err != nil {
+		b.logger.Warn("failed to load probe spend", zap.Error(err))
+		return
+	}
+	for _, state := range states {
+		provider, ok := strings.CutPrefix(state.Key, probeSpendKeyPrefix)
+		if !ok {
+			continue
+		}
+		var s probeSpend
+		if err := json.Unmarshal([]byte(state.Value), &s); err != nil {
+			continue
+		}
+		if _, seen := b.spend[provider]; !seen {
+			b.spend[provider] = &s
+		}
+	}
+}
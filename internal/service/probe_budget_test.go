@@ -0,0 +1,106 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+// probeTestModel prices a 10-in/1-out probe at $0.000045.
+var probeTestModel = &models.Model{Name: "test-model", CostPerMtokInput: 3, CostPerMtokOutput: 15, BillingMultiplier: 1}
+
+func TestProbeBudget_DailyCap(t *testing.T) {
+	store := repository.NewSharedStateRepository(testutil.NewTestDB(t), zap.NewNop())
+	now := time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC)
+	b := NewProbeBudget(0.0001, store, nil, zap.NewNop())
+	b.now = func() time.Time { return now }
+
+	assert.True(t, b.Allow("p1", probeTestModel))
+	b.Record("p1", probeTestModel, nil)
+	assert.True(t, b.Allow("p1", probeTestModel))
+	b.Record("p1", probeTestModel, &models.Usage{InputTokens: 10, OutputTokens: 1})
+	assert.False(t, b.Allow("p1", probeTestModel), "a third probe would exceed the cap")
+	assert.True(t, b.Allow("p2", probeTestModel), "budgets are per provider")
+
+	snap := b.Snapshot()
+	assert.True(t, snap.Enabled)
+	require.Len(t, snap.Providers, 2)
+	assert.Equal(t, "p1", snap.Providers[0].Provider)
+	assert.Equal(t, "2026-10-16", snap.Providers[0].Date)
+	assert.InDelta(t, 0.00009, snap.Providers[0].SpentUSD, 1e-12)
+	assert.InDelta(t, 0.00001, snap.Providers[0].Remaining, 1e-12)
+
+	// The spend survives a restart.
+	restarted := NewProbeBudget(0.0001, store, nil, zap.NewNop())
+	restarted.now = b.now
+	assert.False(t, restarted.Allow("p1", probeTestModel))
+
+	// And resets the next UTC day.
+	now = now.Add(2 * time.Hour)
+	assert.True(t, restarted.Allow("p1", probeTestModel))
+	assert.Zero(t, restarted.Snapshot().Providers[0].SpentUSD)
+}
+
+func TestProbeBudget_PrimaryOnly(t *testing.T) {
+	store := repository.NewSharedStateRepository(testutil.NewTestDB(t), zap.NewNop())
+	primary := false
+	b := NewProbeBudget(1, store, func() bool { return primary }, zap.NewNop())
+	assert.False(t, b.Allow("p1", probeTestModel))
+	primary = true
+	assert.True(t, b.Allow("p1", probeTestModel))
+}
+
+func TestProbeBudget_Disabled(t *testing.T) {
+	b := NewProbeBudget(0, nil, nil, zap.NewNop())
+	assert.Nil(t, b)
+	assert.True(t, b.Allow("p1", probeTestModel))
+	b.Record("p1", probeTestModel, nil)
+	assert.False(t, b.Snapshot().Enabled)
+}
+
+func TestHealthChecker_ProbeBudgetFallsBackToTCP(t *testing.T) {
+	var probes int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"msg_1","type":"message","role":"assistant","content":[],"usage":{"input_tokens":10,"output_tokens":1}}`)
+	}))
+	defer server.Close()
+
+	cfg := config.HealthCheckConfig{Enabled: true, IntervalSeconds: 60, TimeoutSeconds: 5, ProbeMode: config.ProbeModeCompletion}
+	hc := NewHealthChecker(cfg, zap.NewNop())
+	store := repository.NewSharedStateRepository(testutil.NewTestDB(t), zap.NewNop())
+	hc.SetProbeBudget(NewProbeBudget(0.0001, store, nil, zap.NewNop()))
+	ep := &models.Endpoint{
+		Provider: &models.Provider{Name: "test-provider", BaseURL: server.URL, APIKey: "test-key"},
+		Model:    probeTestModel,
+	}
+	name := "test-provider/test-model"
+	hc.mu.Lock()
+	hc.states[name] = &EndpointState{Name: name, Status: models.EndpointUnknown}
+	hc.mu.Unlock()
+
+	for range 4 {
+		hc.checkEndpoint(t.Context(), ep)
+	}
+	assert.Equal(t, 2, probes, "completion probes stop once the budget is spent")
+	state := hc.GetState(name)
+	require.NotNil(t, state)
+	assert.Equal(t, models.EndpointHealthy, state.Status, "TCP probes keep the endpoint checked")
+	snap := hc.ProbeBudget().Snapshot()
+	require.Len(t, snap.Providers, 1)
+	assert.InDelta(t, 0.00001, snap.Providers[0].Remaining, 1e-12)
+}
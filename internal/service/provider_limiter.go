@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// ErrProvidersSaturated is returned when every candidate provider is at its
+// MaxConcurrent limit.
+var ErrProvidersSaturated = errors.New("all providers for this model are at their concurrency limit")
+
+// ProviderLimiter caps in-flight upstream requests per provider at
+// Provider.MaxConcurrent. Acquiring never blocks: a saturated provider is
+// skipped so the request can fail over to another endpoint instead of
+// queueing. A limit of 0 or less is unlimited.
+type ProviderLimiter struct {
+	mu    sync.Mutex
+	slots map[int64]*providerSlot
+}
+
+type providerSlot struct {
+	limit int
+	inUse int
+}
+
+// NewProviderLimiter creates a ProviderLimiter.
+func NewProviderLimiter() *ProviderLimiter {
+	return &ProviderLimiter{slots: make(map[int64]*providerSlot)}
+}
+
+// Update rebuilds the limits from the providers of endpoints. Requests in
+// flight keep counting against their provider's new limit; providers no
+// longer present are dropped.
+func (l *ProviderLimiter) Update(endpoints []*models.Endpoint) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	slots := make(map[int64]*providerSlot, len(l.slots))
+	for _, ep := range endpoints {
+		if ep.Provider == nil {
+			continue
+		}
+		slot := l.slots[ep.Provider.ID]
+		if slot == nil {
+			slot = &providerSlot{}
+		}
+		slot.limit = ep.Provider.MaxConcurrent
+		slots[ep.Provider.ID] = slot
+	}
+	l.slots = slots
+}
+
+// TryAcquire takes a slot of p's limit. ok is false when the provider is
+// saturated; otherwise release must be called once the upstream request ends.
+func (l *ProviderLimiter) TryAcquire(p *models.Provider) (release func(), ok bool) {
+	if l == nil || p == nil {
+		return func() {}, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	slot := l.slots[p.ID]
+	if slot == nil {
+		slot = &providerSlot{limit: p.MaxConcurrent}
+		l.slots[p.ID] = slot
+	}
+	if slot.limit > 0 && slot.inUse >= slot.limit {
+		return nil, false
+	}
+	slot.inUse++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			slot.inUse--
+			l.mu.Unlock()
+		})
+	}, true
+}
+
+// InUse returns the number of requests in flight to provider id.
+func (l *ProviderLimiter) InUse(id int64) int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if slot := l.slots[id]; slot != nil {
+		return slot.inUse
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestProviderLimiter_TryAcquire(t *testing.T) {
+	l := NewProviderLimiter()
+	p := &models.Provider{ID: 1, MaxConcurrent: 2}
+	l.Update([]*models.Endpoint{{Provider: p}})
+
+	r1, ok := l.TryAcquire(p)
+	require.True(t, ok)
+	r2, ok := l.TryAcquire(p)
+	require.True(t, ok)
+	_, ok = l.TryAcquire(p)
+	assert.False(t, ok, "third request exceeds the limit")
+	assert.Equal(t, 2, l.InUse(1))
+
+	r1()
+	r1() // releasing twice must not free a second slot
+	assert.Equal(t, 1, l.InUse(1))
+	r3, ok := l.TryAcquire(p)
+	require.True(t, ok)
+	r2()
+	r3()
+	assert.Zero(t, l.InUse(1))
+
+	// Zero is unlimited, as is a nil limiter.
+	unlimited := &models.Provider{ID: 2}
+	for i := 0; i < 10; i++ {
+		_, ok := l.TryAcquire(unlimited)
+		require.True(t, ok)
+	}
+	var nilLimiter *ProviderLimiter
+	release, ok := nilLimiter.TryAcquire(p)
+	assert.True(t, ok)
+	release()
+}
+
+func TestProviderLimiter_UpdateKeepsInFlight(t *testing.T) {
+	l := NewProviderLimiter()
+	p := &models.Provider{ID: 1, MaxConcurrent: 3}
+	l.Update([]*models.Endpoint{{Provider: p}})
+	release, ok := l.TryAcquire(p)
+	require.True(t, ok)
+	_, ok = l.TryAcquire(p)
+	require.True(t, ok)
+
+	// Lowering the limit below the in-flight count blocks new requests
+	// until enough of them finish.
+	l.Update([]*models.Endpoint{{Provider: &models.Provider{ID: 1, MaxConcurrent: 1}}})
+	assert.Equal(t, 2, l.InUse(1))
+	_, ok = l.TryAcquire(p)
+	assert.False(t, ok)
+	release()
+	_, ok = l.TryAcquire(p)
+	assert.False(t, ok)
+}
+
+func TestProxyService_ProviderLimiter(t *testing.T) {
+	var calls [2]atomic.Int32
+	var servers []*httptest.Server
+	for i := range calls {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls[i].Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"id":"msg_1","type":"message","role":"assistant","content":[]}`)
+		}))
+		defer srv.Close()
+		servers = append(servers, srv)
+	}
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	limiter := NewProviderLimiter()
+	ps.SetProviderLimiter(limiter)
+
+	model := &models.Model{ID: 1, Name: "claude-3-sonnet", Role: models.ModelRoleDefault, Enabled: true}
+	var eps []*models.Endpoint
+	for i, srv := range servers {
+		eps = append(eps, &models.Endpoint{
+			Provider: &models.Provider{ID: int64(i + 1), Name: fmt.Sprintf("p%d", i+1), BaseURL: srv.URL, APIKey: "k", Priority: i, Enabled: true, MaxConcurrent: 1},
+			Model:    model,
+			Status:   models.EndpointHealthy,
+		})
+	}
+	registerHealthyEndpoints(hc, eps)
+	limiter.Update(eps)
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: eps[0], Model: model, TaskType: model.Role}
+
+	// A saturated selected provider fails over to the next one.
+	hold1, ok := limiter.TryAcquire(eps[0].Provider)
+	require.True(t, ok)
+	_, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, eps)
+	require.NoError(t, err)
+	assert.Equal(t, "p2", meta.SelectedEndpoint)
+	assert.Zero(t, calls[0].Load())
+	assert.Equal(t, int32(1), calls[1].Load())
+	assert.Zero(t, limiter.InUse(2), "slot is released after the request")
+
+	// With every provider saturated nothing is sent upstream.
+	hold2, ok := limiter.TryAcquire(eps[1].Provider)
+	require.True(t, ok)
+	_, _, err = ps.ProxyRequest(context.Background(), req, http.Header{}, selection, eps)
+	assert.ErrorIs(t, err, ErrProvidersSaturated)
+	_, _, err = ps.ProxyStreamRequest(context.Background(), req, http.Header{}, selection, eps)
+	assert.ErrorIs(t, err, ErrProvidersSaturated)
+	assert.Equal(t, int32(1), calls[1].Load())
+
+	hold1()
+	hold2()
+	_, meta, err = ps.ProxyRequest(context.Background(), req, http.Header{}, selection, eps)
+	require.NoError(t, err)
+	assert.Equal(t, "p1", meta.SelectedEndpoint)
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+const (
+	// providerUsageWindow is the sliding window over which RPM/TPM are counted.
+	providerUsageWindow = time.Minute
+	// providerThrottleThreshold is the utilization at which a provider is
+	// considered close enough to its rate limit to be avoided.
+	providerThrottleThreshold = 0.9
+)
+
+// ProviderUsageSnapshot reports a provider's usage against its rate limits
+// over the last minute.
+type ProviderUsageSnapshot struct {
+	Provider          string  `json:"provider"`
+	RequestsPerMinute int     `json:"requests_per_minute"`
+	TokensPerMinute   int     `json:"tokens_per_minute"`
+	RPMLimit          int     `json:"rpm_limit"`
+	TPMLimit          int     `json:"tpm_limit"`
+	Utilization       float64 `json:"utilization"`
+	Throttled         bool    `json:"throttled"`
+	Overloaded        bool    `json:"overloaded"`
+	OverloadEvents    int     `json:"overload_events"`
+}
+
+type tokenSample struct {
+	at     time.Time
+	tokens int
+}
+
+// providerUsage records request and token events within the sliding window,
+// and 529 overload responses since startup.
+type providerUsage struct {
+	mu       sync.Mutex
+	requests []time.Time
+	tokens   []tokenSample
+
+	overloads       int
+	overloadedUntil time.Time
+}
+
+// prune drops events older than the window. Must be called with lock held.
+func (u *providerUsage) prune(now time.Time) {
+	cutoff := now.Add(-providerUsageWindow)
+	i := 0
+	for i < len(u.requests) && !u.requests[i].After(cutoff) {
+		i++
+	}
+	u.requests = u.requests[i:]
+	j := 0
+	for j < len(u.tokens) && !u.tokens[j].at.After(cutoff) {
+		j++
+	}
+	u.tokens = u.tokens[j:]
+}
+
+// counts returns the requests and tokens seen within the window.
+func (u *providerUsage) counts(now time.Time) (requests, tokens int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.prune(now)
+	for _, s := range u.tokens {
+		tokens += s.tokens
+	}
+	return len(u.requests), tokens
+}
+
+// usageFor returns the usage tracker for a provider, creating it if needed.
+func (hc *HealthChecker) usageFor(provider string) *providerUsage {
+	hc.usageMu.Lock()
+	defer hc.usageMu.Unlock()
+	u, ok := hc.usage[provider]
+	if !ok {
+		u = &providerUsage{}
+		hc.usage[provider] = u
+	}
+	return u
+}
+
+// RecordProviderRequest counts a request dispatched to the provider.
+func (hc *HealthChecker) RecordProviderRequest(provider string) {
+	u := hc.usageFor(provider)
+	now := time.Now()
+	u.mu.Lock()
+	u.prune(now)
+	u.requests = append(u.requests, now)
+	u.mu.Unlock()
+}
+
+// RecordProviderTokens counts tokens consumed by a completed request.
+func (hc *HealthChecker) RecordProviderTokens(provider string, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	u := hc.usageFor(provider)
+	now := time.Now()
+	u.mu.Lock()
+	u.prune(now)
+	u.tokens = append(u.tokens, tokenSample{at: now, tokens: tokens})
+	u.mu.Unlock()
+}
+
+// RecordProviderOverload counts a 529 from the provider and has selection
+// avoid it for cooldown.
+func (hc *HealthChecker) RecordProviderOverload(provider string, cooldown time.Duration) {
+	u := hc.usageFor(provider)
+	until := time.Now().Add(cooldown)
+	u.mu.Lock()
+	u.overloads++
+	if until.After(u.overloadedUntil) {
+		u.overloadedUntil = until
+	}
+	u.mu.Unlock()
+}
+
+// overloadState returns the provider's overload count and whether it is
+// still cooling down after a 529.
+func (u *providerUsage) overloadState(now time.Time) (events int, overloaded bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.overloads, now.Before(u.overloadedUntil)
+}
+
+// IsOverloaded reports whether the provider recently answered 529 and is
+// still within its cooldown.
+func (hc *HealthChecker) IsOverloaded(p *models.Provider) bool {
+	if p == nil {
+		return false
+	}
+	_, overloaded := hc.usageFor(p.Name).overloadState(time.Now())
+	return overloaded
+}
+
+// ProviderUsage returns the provider's current usage against its configured
+// RPM/TPM limits. Utilization is the higher of the two ratios.
+func (hc *HealthChecker) ProviderUsage(p *models.Provider) ProviderUsageSnapshot {
+	u, now := hc.usageFor(p.Name), time.Now()
+	requests, tokens := u.counts(now)
+	events, overloaded := u.overloadState(now)
+	snap := ProviderUsageSnapshot{
+		Provider:          p.Name,
+		RequestsPerMinute: requests,
+		TokensPerMinute:   tokens,
+		RPMLimit:          p.RPMLimit,
+		TPMLimit:          p.TPMLimit,
+		Overloaded:        overloaded,
+		OverloadEvents:    events,
+	}
+	if p.RPMLimit > 0 {
+		snap.Utilization = float64(requests) / float64(p.RPMLimit)
+	}
+	if p.TPMLimit > 0 {
+		snap.Utilization = max(snap.Utilization, float64(tokens)/float64(p.TPMLimit))
+	}
+	snap.Throttled = snap.Utilization >= providerThrottleThreshold
+	return snap
+}
+
+// IsNearRateLimit reports whether the provider is approaching its RPM or TPM
+// ceiling. Providers without limits are never throttled.
+func (hc *HealthChecker) IsNearRateLimit(p *models.Provider) bool {
+	if p == nil || (p.RPMLimit <= 0 && p.TPMLimit <= 0) {
+		return false
+	}
+	return hc.ProviderUsage(p).Throttled
+}
+
+// avoidThrottled removes endpoints whose provider is near its rate limit or
+// cooling down after a 529 so selection prefers providers with headroom. When
+// every candidate is affected the list is returned unchanged rather than
+// failing the request.
+func avoidThrottled(hc *HealthChecker, endpoints []*models.Endpoint) []*models.Endpoint {
+	if len(endpoints) <= 1 {
+		return endpoints
+	}
+	available := make([]*models.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if !hc.IsNearRateLimit(ep.Provider) && !hc.IsOverloaded(ep.Provider) {
+			available = append(available, ep)
+		}
+	}
+	if len(available) == 0 {
+		return endpoints
+	}
+	return available
+}
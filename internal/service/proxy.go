@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/user/llm-proxy-go/internal/config"
 	"github.com/user/llm-proxy-go/internal/models"
 	"github.com/user/llm-proxy-go/internal/repository"
 	"go.uber.org/zap"
@@ -31,13 +32,23 @@ type ProxyMetadata struct {
 	Stream           bool
 	StatusCode       int
 	Success          bool
+	ErrorMessage     string                // Failure reason, e.g. from an upstream SSE error event
+	Coalesced        bool                  // Response shared from an identical in-flight request
+	RetryChain       []models.RetryAttempt // Endpoints tried, in order
+
+	ThinkingClampedFrom int // Requested thinking budget when it was clamped, 0 otherwise
+
+	CacheCreationInputTokens int // Prompt tokens written to the upstream prompt cache
+	CacheReadInputTokens     int // Prompt tokens served from the upstream prompt cache
 
 	// Routing decision info
-	RoutingDecision *models.RoutingDecision
-	RuleMatchResult *ClassifyResult
-	FallbackInfo    *models.FallbackInfo
-	RequestContent  string // Full request content
-	ResponseContent string // Full response content
+	RoutingDecision  *models.RoutingDecision
+	RuleMatchResult  *ClassifyResult
+	FallbackInfo     *models.FallbackInfo
+	RoutingLatencyMs float64 // Time spent inferring the task type; 0 without smart routing
+	EndUserID        string  // Request's metadata.user_id
+	RequestContent   string  // Full request content
+	ResponseContent  string  // Full response content
 }
 
 // StreamChunk represents a chunk of SSE stream data.
@@ -58,6 +69,21 @@ type ProxyService struct {
 	logger        *zap.Logger
 	client        *http.Client
 	streamClient  *http.Client // Separate client for streaming with longer timeout
+	coalescer     *requestCoalescer
+	backoff       retryBackoff
+	retryBudget   *RetryBudget            // Caps retries under widespread failures; nil = unlimited
+	limiter       *ProviderLimiter        // Per-provider MaxConcurrent; nil = unlimited
+	metrics       *Metrics                // Prometheus metrics; nil = disabled
+	versions      *AnthropicVersionPolicy // anthropic-version sent upstream; nil = client's
+	shadow        *ShadowMirror           // Mirrors sampled requests to shadow providers; nil = off
+	affinity      *ConversationAffinity   // Remembers where conversations succeeded; nil = off
+	redactor      *ContentRedactor        // Masks secrets in logged error messages; nil = none
+
+	bufferedStreamMaxTokens int           // See SetBufferedStreamMaxTokens
+	streamIdleTimeout       time.Duration // See SetStreamIdleTimeout
+	stripEndUserID          bool          // See SetForwardEndUserID
+	defaultMaxTokens        int           // See SetDefaultMaxTokens
+	roleMaxTokens           map[models.ModelRole]int
 }
 
 // NewProxyService creates a new ProxyService.
@@ -73,7 +99,7 @@ func NewProxyService(
 		logRepo:       logRepo,
 		logger:        logger,
 		client: &http.Client{
-			Timeout: 120 * time.Second,
+			Timeout: 0, // Bounded per request, see requestTimeout
 			Transport: &http.Transport{
 				MaxIdleConns:        100,
 				MaxIdleConnsPerHost: 20,
@@ -91,13 +117,152 @@ func NewProxyService(
 	}
 }
 
+// SetCoalescing enables or disables sharing one upstream call among identical
+// concurrent non-streaming, temperature-0 requests.
+func (s *ProxyService) SetCoalescing(enabled bool) {
+	if enabled {
+		s.coalescer = newRequestCoalescer()
+	} else {
+		s.coalescer = nil
+	}
+}
+
+// SetBufferedStreamMaxTokens makes streaming requests with max_tokens up to n
+// use a non-streaming upstream call, replayed to the client as an SSE
+// stream. Short responses arrive sooner that way. 0 disables it.
+func (s *ProxyService) SetBufferedStreamMaxTokens(n int) {
+	s.bufferedStreamMaxTokens = n
+}
+
+// SetRetryBackoff configures the wait between endpoint retries. Without it
+// retries are immediate.
+func (s *ProxyService) SetRetryBackoff(cfg config.RetryBackoffConfig) {
+	s.backoff = newRetryBackoff(cfg)
+}
+
+// SetRetryBudget limits endpoint retries to what b allows. The first attempt
+// of a request is never limited.
+func (s *ProxyService) SetRetryBudget(b *RetryBudget) {
+	s.retryBudget = b
+}
+
+// SetProviderLimiter enforces each provider's MaxConcurrent on upstream
+// requests. The limiter's limits are kept current by the EndpointStore.
+func (s *ProxyService) SetProviderLimiter(l *ProviderLimiter) {
+	s.limiter = l
+}
+
+// SetContentRedactor masks secrets in the error messages SaveRequestLog
+// stores. Request and response content is redacted by the caller.
+func (s *ProxyService) SetContentRedactor(r *ContentRedactor) {
+	s.redactor = r
+}
+
+// SetStreamIdleTimeout aborts a streaming upstream request that sends no
+// data for d. Streams have no overall timeout, so this is what catches a
+// stalled provider. 0 disables it.
+func (s *ProxyService) SetStreamIdleTimeout(d time.Duration) {
+	s.streamIdleTimeout = d
+}
+
+// SetAnthropicVersionPolicy rewrites the anthropic-version header of
+// upstream requests according to p.
+func (s *ProxyService) SetAnthropicVersionPolicy(p *AnthropicVersionPolicy) {
+	s.versions = p
+}
+
+// SetForwardEndUserID sets whether metadata.user_id is sent upstream. It is
+// by default; either way it is recorded in the request log.
+func (s *ProxyService) SetForwardEndUserID(forward bool) {
+	s.stripEndUserID = !forward
+}
+
+// SetDefaultMaxTokens makes requests that omit max_tokens, which Anthropic
+// rejects, ask for n tokens, or for the override in byRole of the role of
+// the model serving them. 0 forwards such requests unchanged.
+func (s *ProxyService) SetDefaultMaxTokens(n int, byRole map[models.ModelRole]int) {
+	s.defaultMaxTokens = n
+	s.roleMaxTokens = byRole
+}
+
+// upstreamMetadata returns the metadata sent upstream for md.
+func (s *ProxyService) upstreamMetadata(md map[string]string) map[string]string {
+	if !s.stripEndUserID {
+		return md
+	}
+	if _, ok := md["user_id"]; !ok {
+		return md
+	}
+	out := make(map[string]string, len(md)-1)
+	for k, v := range md {
+		if k != "user_id" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// SetConversationAffinity records the endpoint each conversation succeeds
+// on, for the endpoint selector to prefer on its next turn (nil disables
+// it).
+func (s *ProxyService) SetConversationAffinity(a *ConversationAffinity) {
+	s.affinity = a
+}
+
+// SetMetrics records every logged request in m.
+func (s *ProxyService) SetMetrics(m *Metrics) {
+	s.metrics = m
+}
+
 // ProxyRequest forwards a non-streaming request with endpoint retry support.
+// When coalescing is enabled, identical deterministic requests in flight at
+// the same time share the first one's successful response.
 func (s *ProxyService) ProxyRequest(
 	ctx context.Context,
 	req *models.AnthropicRequest,
 	originalHeaders http.Header,
 	selection *EndpointSelectionResult,
 	endpoints []*models.Endpoint,
+) (*models.AnthropicResponse, *ProxyMetadata, error) {
+	if s.coalescer == nil || selection == nil || selection.Model == nil || !isCoalescable(req) {
+		return s.proxyRequest(ctx, req, originalHeaders, selection, endpoints)
+	}
+	key, ok := coalesceKey(req, originalHeaders, selection.Model.Name)
+	if !ok {
+		return s.proxyRequest(ctx, req, originalHeaders, selection, endpoints)
+	}
+
+	call, leader := s.coalescer.join(key)
+	if leader {
+		resp, meta, err := s.proxyRequest(ctx, req, originalHeaders, selection, endpoints)
+		s.coalescer.complete(key, call, resp, meta, err)
+		return resp, meta, err
+	}
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	if call.err != nil || call.resp == nil {
+		// Failures are not shared; make our own attempt.
+		return s.proxyRequest(ctx, req, originalHeaders, selection, endpoints)
+	}
+	resp, meta := call.shared(uuid.New().String())
+	meta.FallbackInfo = selection.FallbackInfo
+	s.logger.Debug("coalesced identical in-flight request",
+		zap.String("request_id", meta.RequestID),
+		zap.String("model", selection.Model.Name))
+	return resp, meta, nil
+}
+
+// proxyRequest performs the upstream call for ProxyRequest.
+func (s *ProxyService) proxyRequest(
+	ctx context.Context,
+	req *models.AnthropicRequest,
+	originalHeaders http.Header,
+	selection *EndpointSelectionResult,
+	endpoints []*models.Endpoint,
 ) (*models.AnthropicResponse, *ProxyMetadata, error) {
 	requestID := uuid.New().String()
 
@@ -105,24 +270,45 @@ func (s *ProxyService) ProxyRequest(
 		return nil, nil, fmt.Errorf("no endpoint selected")
 	}
 
+	s.retryBudget.Request()
 	triedEndpoints := make(map[string]bool)
+	var chain []models.RetryAttempt
 	ep := selection.Endpoint
 
 	for attempt := 0; attempt < maxEndpointRetries; attempt++ {
+		acquired, release, acqErr := s.acquireEndpoint(ep, selection.Model, endpoints, triedEndpoints, req)
+		if acqErr != nil {
+			return nil, failedAttemptsMeta(requestID, chain), acqErr
+		}
+		ep = acquired
 		attemptStart := time.Now()
 		epName := EndpointName(ep)
 		triedEndpoints[epName] = true
 
-		resp, meta, err := s.proxyToEndpoint(ctx, req, originalHeaders, ep, requestID, attemptStart)
+		resp, meta, err := s.proxyToEndpoint(ctx, req, originalHeaders, ep, requestID, attemptStart, selection.MaxOutputTokens)
+		release()
+		chain = append(chain, retryAttempt(epName, err, attemptStart))
 		if err == nil {
 			meta.FallbackInfo = selection.FallbackInfo
+			meta.RetryChain = chain
+			s.affinity.Remember(req, epName)
+			s.mirrorToShadows(req, originalHeaders, ep, resp, meta)
 			return resp, meta, nil
 		}
+		if meta != nil {
+			// The endpoint answered but the response was rejected (over the
+			// output budget); retrying elsewhere would only spend more.
+			meta.FallbackInfo = selection.FallbackInfo
+			meta.RetryChain = chain
+			return nil, meta, err
+		}
+
+		s.noteOverload(ep, err)
+		s.affinity.Forget(req, epName)
 
 		// Check if the error is non-retryable (e.g. 400, 404, 422)
-		var ue *UpstreamError
-		if errors.As(err, &ue) && !isRetryableStatusCode(ue.StatusCode) {
-			return nil, nil, err
+		if !shouldRetryEndpoint(ep, err) {
+			return nil, failedAttemptsMeta(requestID, chain), err
 		}
 
 		s.logger.Warn("endpoint request failed, trying alternative",
@@ -131,13 +317,54 @@ func (s *ProxyService) ProxyRequest(
 			zap.Error(err))
 
 		// Select alternative endpoint
-		ep = s.selectAlternativeEndpoint(selection.Model, endpoints, triedEndpoints)
+		ep = s.selectAlternativeEndpoint(selection.Model, endpoints, triedEndpoints, req)
 		if ep == nil {
-			return nil, nil, fmt.Errorf("all endpoints failed for model %s: %w", selection.Model.Name, err)
+			return nil, failedAttemptsMeta(requestID, chain), fmt.Errorf("all endpoints failed for model %s: %w", selection.Model.Name, err)
+		}
+		if attempt+1 < maxEndpointRetries {
+			if !s.retryBudget.TryRetry() {
+				s.logRetryBudgetExhausted(epName, err)
+				return nil, failedAttemptsMeta(requestID, chain), err
+			}
+			if waitErr := s.backoff.wait(ctx, attempt, err); waitErr != nil {
+				return nil, failedAttemptsMeta(requestID, chain), waitErr
+			}
 		}
 	}
 
-	return nil, nil, fmt.Errorf("max retries exceeded for model %s", selection.Model.Name)
+	return nil, failedAttemptsMeta(requestID, chain), fmt.Errorf("max retries exceeded for model %s", selection.Model.Name)
+}
+
+// logRetryBudgetExhausted notes a failed request returned without retrying
+// because the retry budget is spent.
+func (s *ProxyService) logRetryBudgetExhausted(epName string, err error) {
+	s.logger.Warn("retry budget exhausted, not trying alternative endpoint",
+		zap.String("endpoint", epName),
+		zap.Error(err))
+}
+
+// retryAttempt records the outcome of one endpoint attempt.
+func retryAttempt(epName string, err error, start time.Time) models.RetryAttempt {
+	attempt := models.RetryAttempt{Endpoint: epName, LatencyMs: msSince(start)}
+	var ue *UpstreamError
+	switch {
+	case err == nil:
+		attempt.StatusCode = http.StatusOK
+	case errors.As(err, &ue):
+		attempt.StatusCode = ue.StatusCode
+		if _, msg, ok := parseUpstreamError(ue.Body); ok {
+			attempt.Error = truncateStr(msg, 200)
+		}
+	default:
+		attempt.Error = truncateStr(err.Error(), 200)
+	}
+	return attempt
+}
+
+// failedAttemptsMeta is the metadata returned with a request that failed on
+// every endpoint tried, so the attempts still reach the request log.
+func failedAttemptsMeta(requestID string, chain []models.RetryAttempt) *ProxyMetadata {
+	return &ProxyMetadata{RequestID: requestID, RetryChain: chain}
 }
 
 // proxyToEndpoint sends a request to a single endpoint.
@@ -148,28 +375,46 @@ func (s *ProxyService) proxyToEndpoint(
 	ep *models.Endpoint,
 	requestID string,
 	start time.Time,
+	maxOutputTokens int,
 ) (*models.AnthropicResponse, *ProxyMetadata, error) {
 	epName := EndpointName(ep)
 	s.healthChecker.IncrementConnections(epName)
 	defer s.healthChecker.DecrementConnections(epName)
+	s.healthChecker.RecordProviderRequest(ep.Provider.Name)
 
 	// Create a copy of the request and replace model name with the selected endpoint's model
 	proxyReq := *req
 	proxyReq.Model = ep.Model.Name
+	proxyReq.Metadata = s.upstreamMetadata(req.Metadata)
+	var thinkingClampedFrom int
+	proxyReq.Thinking, thinkingClampedFrom = thinkingBudget(req.Thinking, ep.Model)
+	s.logThinkingClamp(requestID, ep, thinkingClampedFrom)
+	proxyReq.MaxTokens = s.upstreamMaxTokens(req, ep, proxyReq.Thinking)
+	// Stream-only providers reject non-streaming calls; the response is
+	// assembled from the stream instead.
+	proxyReq.Stream = ep.Provider.StreamOnly
 	body, err := json.Marshal(&proxyReq)
 	if err != nil {
 		return nil, nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	upstreamURL := fmt.Sprintf("%s/v1/messages", ep.Provider.BaseURL)
-	upReq, err := http.NewRequestWithContext(ctx, http.MethodPost, upstreamURL, bytes.NewReader(body))
+	timeout := requestTimeout(ep)
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	upstreamURL := ep.Provider.MessagesURL()
+	upReq, err := http.NewRequestWithContext(reqCtx, http.MethodPost, upstreamURL, bytes.NewReader(body))
 	if err != nil {
 		return nil, nil, fmt.Errorf("create upstream request: %w", err)
 	}
 
 	upReq.Header.Set("Content-Type", "application/json")
-	upReq.Header.Set("x-api-key", ep.Provider.APIKey)
-	upReq.Header.Set("anthropic-version", headerOrDefault(originalHeaders, "Anthropic-Version", "2023-06-01"))
+	upReq.Header.Set("Accept-Encoding", upstreamAcceptEncoding)
+	if ep.Provider.StreamOnly {
+		upReq.Header.Set("Accept", "text/event-stream")
+	}
+	setProviderAuth(ep.Provider, upReq.Header)
+	upReq.Header.Set("anthropic-version", s.versions.Resolve(ep.Provider, originalHeaders))
 	copyAnthropicHeaders(originalHeaders, upReq.Header)
 	// Forward client User-Agent if present
 	if ua := originalHeaders.Get("User-Agent"); ua != "" {
@@ -180,28 +425,49 @@ func (s *ProxyService) proxyToEndpoint(
 
 	resp, err := s.client.Do(upReq)
 	if err != nil {
-		s.healthChecker.UpdateRequestStats(epName, false, msSince(start))
+		err = timeoutError(ctx, timeout, err)
+		s.healthChecker.RecordRequestError(epName, err, msSince(start))
 		return nil, nil, fmt.Errorf("upstream request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	latencyMs := msSince(start)
-	success := resp.StatusCode < 400
 
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err := readResponseBody(resp)
 	if err != nil {
-		s.healthChecker.UpdateRequestStats(epName, false, latencyMs)
+		err = timeoutError(ctx, timeout, err)
+		s.healthChecker.RecordRequestError(epName, err, latencyMs)
 		return nil, nil, fmt.Errorf("read upstream response: %w", err)
 	}
 
-	s.healthChecker.UpdateRequestStats(epName, success, latencyMs)
+	// Some providers report failures as a 200 carrying an error envelope.
+	var upstreamErr error
+	if _, _, isErrorBody := parseUpstreamError(respBody); resp.StatusCode >= 400 || isErrorBody {
+		upstreamErr = newUpstreamError(resp.StatusCode, respBody, parseRetryAfter(resp.Header))
+	}
 
-	if resp.StatusCode >= 400 {
-		return nil, nil, &UpstreamError{StatusCode: resp.StatusCode, Body: respBody}
+	var assembled *models.AnthropicResponse
+	var assembleErr error
+	if upstreamErr == nil && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		assembled, assembleErr = s.assembleSSEResponse(respBody, resp.StatusCode)
+		var upErr *UpstreamError
+		if errors.As(assembleErr, &upErr) {
+			upstreamErr = assembleErr
+		}
+	}
+	s.healthChecker.RecordRequestError(epName, upstreamErr, latencyMs)
+
+	if upstreamErr != nil {
+		return nil, nil, upstreamErr
+	}
+	if assembleErr != nil {
+		return nil, nil, assembleErr
 	}
 
 	var anthropicResp models.AnthropicResponse
-	if err := json.Unmarshal(respBody, &anthropicResp); err != nil {
+	if assembled != nil {
+		anthropicResp = *assembled
+	} else if err := json.Unmarshal(respBody, &anthropicResp); err != nil {
 		return nil, nil, fmt.Errorf("decode upstream response: %w", err)
 	}
 
@@ -213,17 +479,94 @@ func (s *ProxyService) proxyToEndpoint(
 		LatencyMs:        latencyMs,
 		InputTokens:      anthropicResp.Usage.InputTokens,
 		OutputTokens:     anthropicResp.Usage.OutputTokens,
-		Cost:             calculateCost(ep.Model, anthropicResp.Usage),
+		Cost:             endpointCost(ep, anthropicResp.Usage),
+
+		ThinkingClampedFrom: thinkingClampedFrom,
+
+		CacheCreationInputTokens: anthropicResp.Usage.CacheCreationInputTokens,
+		CacheReadInputTokens:     anthropicResp.Usage.CacheReadInputTokens,
+	}
+	s.healthChecker.RecordProviderTokens(ep.Provider.Name, meta.InputTokens+meta.OutputTokens)
+
+	if maxOutputTokens > 0 && meta.OutputTokens > maxOutputTokens {
+		s.logger.Warn("response exceeded output token budget",
+			zap.String("request_id", requestID),
+			zap.String("endpoint", epName),
+			zap.Int("output_tokens", meta.OutputTokens),
+			zap.Int("budget", maxOutputTokens))
+		return nil, meta, outputBudgetError(meta.OutputTokens, maxOutputTokens)
 	}
 
 	return &anthropicResp, meta, nil
 }
 
+// logThinkingClamp records that a request's thinking budget was clamped to
+// the model's cap. clampedFrom is 0 when nothing was clamped.
+func (s *ProxyService) logThinkingClamp(requestID string, ep *models.Endpoint, clampedFrom int) {
+	if clampedFrom == 0 {
+		return
+	}
+	s.logger.Info("thinking budget clamped",
+		zap.String("request_id", requestID),
+		zap.String("model", ep.Model.Name),
+		zap.Int("requested", clampedFrom),
+		zap.Int("cap", ep.Model.MaxThinkingTokens))
+}
+
+// acquireEndpoint takes a concurrency slot on ep's provider, failing over to
+// alternative endpoints while providers are saturated. Saturated endpoints
+// are marked tried. It returns ErrProvidersSaturated when no candidate is left.
+func (s *ProxyService) acquireEndpoint(
+	ep *models.Endpoint,
+	model *models.Model,
+	endpoints []*models.Endpoint,
+	triedEndpoints map[string]bool,
+	req *models.AnthropicRequest,
+) (*models.Endpoint, func(), error) {
+	for ep != nil {
+		epName := EndpointName(ep)
+		release, ok := s.limiter.TryAcquire(ep.Provider)
+		if ok {
+			// Another request may have claimed the half-open probe since
+			// the endpoint was selected.
+			if s.healthChecker.BeginRequest(epName) {
+				return ep, release, nil
+			}
+			release()
+			s.logger.Debug("circuit breaker probe already in flight, trying alternative",
+				zap.String("endpoint", epName))
+		} else {
+			s.logger.Warn("provider at concurrency limit, trying alternative",
+				zap.String("endpoint", epName),
+				zap.Int("max_concurrent", ep.Provider.MaxConcurrent))
+		}
+		triedEndpoints[epName] = true
+		ep = s.selectAlternativeEndpoint(model, endpoints, triedEndpoints, req)
+	}
+	return nil, nil, ErrProvidersSaturated
+}
+
+// noteOverload backs off ep's whole provider after a 529 so the retry and
+// following requests go to other providers while it recovers.
+func (s *ProxyService) noteOverload(ep *models.Endpoint, err error) {
+	cooldown := s.backoff.overloadCooldown(err)
+	if cooldown <= 0 {
+		return
+	}
+	s.healthChecker.RecordProviderOverload(ep.Provider.Name, cooldown)
+	s.logger.Warn("provider overloaded, backing off",
+		zap.String("provider", ep.Provider.Name),
+		zap.Duration("cooldown", cooldown))
+}
+
 // selectAlternativeEndpoint selects an alternative healthy endpoint for the model.
+// Remaining endpoints in the current priority tier are tried before falling
+// through to the next tier.
 func (s *ProxyService) selectAlternativeEndpoint(
 	model *models.Model,
 	endpoints []*models.Endpoint,
 	excludeNames map[string]bool,
+	req *models.AnthropicRequest,
 ) *models.Endpoint {
 	var candidates []*models.Endpoint
 	for _, ep := range endpoints {
@@ -237,26 +580,113 @@ func (s *ProxyService) selectAlternativeEndpoint(
 	if len(candidates) == 0 {
 		return nil
 	}
-	return s.loadBalancer.Select(candidates, nil)
+	return s.loadBalancer.Select(preferredTier(avoidThrottled(s.healthChecker, candidates)), req)
 }
 
 // UpstreamError represents an error response from the upstream provider.
 type UpstreamError struct {
 	StatusCode int
 	Body       []byte
+	RetryAfter time.Duration // Parsed Retry-After header, 0 if absent
+	ErrorType  string        // error.type from Body, or the default for StatusCode
+}
+
+// newUpstreamError builds an UpstreamError, taking its ErrorType from the
+// body's error envelope when it has one. An error reported with a success
+// status, as some providers do, gets the status of its error type instead, so
+// clients and retry classification never see a 200 failure.
+func newUpstreamError(statusCode int, body []byte, retryAfter time.Duration) *UpstreamError {
+	errType, _, ok := parseUpstreamError(body)
+	if statusCode < 400 {
+		statusCode = errorTypeStatus(errType)
+	}
+	if !ok || errType == "" {
+		errType = defaultErrorType(statusCode)
+	}
+	return &UpstreamError{StatusCode: statusCode, Body: body, RetryAfter: retryAfter, ErrorType: errType}
+}
+
+// errorTypeStatus maps an Anthropic error type to its HTTP status, the
+// reverse of defaultErrorType. Unknown or missing types map to 502.
+func errorTypeStatus(errType string) int {
+	switch errType {
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	case "authentication_error":
+		return http.StatusUnauthorized
+	case "permission_error":
+		return http.StatusForbidden
+	case "not_found_error":
+		return http.StatusNotFound
+	case "request_too_large":
+		return http.StatusRequestEntityTooLarge
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "overloaded_error":
+		return statusOverloaded
+	case "api_error":
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadGateway
+	}
 }
 
 func (e *UpstreamError) Error() string {
 	return fmt.Sprintf("upstream returned status %d", e.StatusCode)
 }
 
+// ClientBody returns the Anthropic error envelope sent to the client: the
+// upstream body when it is one, otherwise an envelope carrying ErrorType and
+// the start of the raw body.
+func (e *UpstreamError) ClientBody() []byte {
+	if _, _, ok := parseUpstreamError(e.Body); ok {
+		return e.Body
+	}
+	errType := e.ErrorType
+	if errType == "" {
+		errType = defaultErrorType(e.StatusCode)
+	}
+	message := e.Error()
+	if raw := strings.TrimSpace(string(e.Body)); raw != "" {
+		message += ": " + truncateStr(raw, 200)
+	}
+	body, _ := json.Marshal(models.ErrorResponse{
+		Type:  "error",
+		Error: models.ErrorDetail{Type: errType, Message: message},
+	})
+	return body
+}
+
+// defaultErrorType maps an upstream status to the Anthropic error type used
+// when the body does not name one.
+func defaultErrorType(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusPaymentRequired, http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case statusOverloaded, http.StatusServiceUnavailable:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
 // isRetryableStatusCode determines if a status code should trigger endpoint retry.
 // Retryable: 401 (invalid key), 402 (insufficient balance), 403 (quota/permission),
 // 408 (timeout), 429 (rate limit), >=500 (server errors).
 // Non-retryable: 400 (bad request), 404 (not found), 413 (too large), 422 (validation).
 func isRetryableStatusCode(code int) bool {
 	switch code {
-	case 401, 402, 403, 408, 429:
+	case 401, 402, 403, 408, 429, statusOverloaded:
 		return true
 	default:
 		return code >= 500
@@ -292,6 +722,20 @@ func copyAnthropicHeaders(src, dst http.Header) {
 	}
 }
 
+// setProviderAuth sets the credential header for the provider's auth scheme.
+// Providers without a scheme, or a custom_header scheme without a header
+// name, use x-api-key.
+func setProviderAuth(p *models.Provider, dst http.Header) {
+	switch {
+	case p.AuthScheme == models.AuthSchemeBearer:
+		dst.Set("Authorization", "Bearer "+p.APIKey)
+	case p.AuthScheme == models.AuthSchemeCustomHeader && p.AuthHeader != "":
+		dst.Set(p.AuthHeader, p.APIKey)
+	default:
+		dst.Set("x-api-key", p.APIKey)
+	}
+}
+
 // applyCustomHeaders applies provider-level custom headers to the request.
 // Custom headers have the highest priority and override any previously set headers.
 func applyCustomHeaders(custom map[string]string, dst http.Header) {
@@ -304,22 +748,31 @@ func msSince(start time.Time) float64 {
 	return float64(time.Since(start).Milliseconds())
 }
 
+// calculateCost prices a response's usage. Prompt-cache writes and reads are
+// charged at the model's cache multipliers of the input price.
 func calculateCost(model *models.Model, usage models.Usage) float64 {
-	inputCost := float64(usage.InputTokens) / 1_000_000 * model.CostPerMtokInput
+	inputTokens := float64(usage.InputTokens) +
+		float64(usage.CacheCreationInputTokens)*model.CacheWriteMultiplier +
+		float64(usage.CacheReadInputTokens)*model.CacheReadMultiplier
+	inputCost := inputTokens / 1_000_000 * model.CostPerMtokInput
 	outputCost := float64(usage.OutputTokens) / 1_000_000 * model.CostPerMtokOutput * model.BillingMultiplier
 	return inputCost + outputCost
 }
 
-func calculateCostFromTokens(model *models.Model, inputTokens, outputTokens int) float64 {
-	inputCost := float64(inputTokens) / 1_000_000 * model.CostPerMtokInput
-	outputCost := float64(outputTokens) / 1_000_000 * model.CostPerMtokOutput * model.BillingMultiplier
-	return inputCost + outputCost
+// endpointCost prices usage on ep: the model's prices scaled by the
+// provider's cost multiplier.
+func endpointCost(ep *models.Endpoint, usage models.Usage) float64 {
+	return calculateCost(ep.Model, usage) * ep.Provider.PriceFactor()
 }
 
 // SaveRequestLog persists a request log entry to the database asynchronously.
 // Uses a detached context because the request context may already be cancelled.
 func (s *ProxyService) SaveRequestLog(ctx context.Context, meta *ProxyMetadata, userID int64, apiKeyID *int64) {
-	if s.logRepo == nil || meta == nil {
+	if meta == nil {
+		return
+	}
+	s.metrics.observeRequest(meta)
+	if s.logRepo == nil {
 		return
 	}
 	statusCode := meta.StatusCode
@@ -339,6 +792,13 @@ func (s *ProxyService) SaveRequestLog(ctx context.Context, meta *ProxyMetadata,
 		Stream:       meta.Stream,
 		RequestContent:  meta.RequestContent,
 		ResponseContent: meta.ResponseContent,
+		RetryChain:      meta.RetryChain,
+		EndUserID:       meta.EndUserID,
+
+		ThinkingClampedFrom: meta.ThinkingClampedFrom,
+
+		CacheCreationInputTokens: meta.CacheCreationInputTokens,
+		CacheReadInputTokens:     meta.CacheReadInputTokens,
 	}
 
 	// Populate routing decision fields
@@ -348,6 +808,11 @@ func (s *ProxyService) SaveRequestLog(ctx context.Context, meta *ProxyMetadata,
 		entry.RoutingMethod = routingMethodFromDecision(d)
 	}
 
+	// Record the roles walked when the preferred role had no healthy endpoint
+	if meta.FallbackInfo != nil {
+		entry.FallbackChain = meta.FallbackInfo.FallbackChain
+	}
+
 	// Populate rule match fields
 	if meta.RuleMatchResult != nil {
 		r := meta.RuleMatchResult
@@ -358,6 +823,12 @@ func (s *ProxyService) SaveRequestLog(ctx context.Context, meta *ProxyMetadata,
 		entry.AllMatches = r.Matches
 	}
 
+	// Save a failure reason without an error body, e.g. from an upstream
+	// SSE error event, as the response content like other errors.
+	if entry.ResponseContent == "" && meta.ErrorMessage != "" {
+		entry.ResponseContent = s.redactor.Redact(meta.ErrorMessage)
+	}
+
 	// Generate message preview from request content
 	if meta.RequestContent != "" {
 		entry.MessagePreview = truncateStr(meta.RequestContent, 200)
@@ -374,6 +845,26 @@ func (s *ProxyService) SaveRequestLog(ctx context.Context, meta *ProxyMetadata,
 	}()
 }
 
+// RecordRateLimited counts a request of userID rejected by its API key's rate
+// limit. Unlike SaveRequestLog it writes no log entry, only a per-user
+// counter, so rejected retries cannot flood the request log.
+func (s *ProxyService) RecordRateLimited(userID int64) {
+	s.metrics.observeRequest(&ProxyMetadata{StatusCode: http.StatusTooManyRequests})
+	if s.logRepo == nil {
+		return
+	}
+	now := time.Now()
+	go func() {
+		saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.logRepo.RecordRateLimited(saveCtx, userID, now); err != nil {
+			s.logger.Error("failed to record rate-limited request",
+				zap.Int64("user_id", userID),
+				zap.Error(err))
+		}
+	}()
+}
+
 // routingMethodFromDecision derives the routing_method string from a RoutingDecision.
 func routingMethodFromDecision(d *models.RoutingDecision) string {
 	if d.FromCache {
@@ -382,6 +873,8 @@ func routingMethodFromDecision(d *models.RoutingDecision) string {
 			return "cache_l1"
 		case "L2":
 			return "cache_l2"
+		case "L2-semantic":
+			return "cache_l2_semantic"
 		case "L3":
 			return "cache_l3"
 		default:
@@ -391,6 +884,8 @@ func routingMethodFromDecision(d *models.RoutingDecision) string {
 	switch d.CacheType {
 	case "rule":
 		return "rule"
+	case "forced":
+		return "forced"
 	default:
 		if d.ModelUsed != "" {
 			return "llm"
@@ -417,26 +912,40 @@ func (s *ProxyService) ProxyStreamRequest(
 	selection *EndpointSelectionResult,
 	endpoints []*models.Endpoint,
 ) (<-chan StreamChunk, *ProxyMetadata, error) {
+	if s.bufferedStreamMaxTokens > 0 && req.MaxTokens > 0 && req.MaxTokens <= s.bufferedStreamMaxTokens {
+		return s.proxyBufferedStream(ctx, req, originalHeaders, selection, endpoints)
+	}
+
 	requestID := uuid.New().String()
 
 	if selection == nil || selection.Endpoint == nil {
 		return nil, nil, fmt.Errorf("no endpoint selected")
 	}
 
+	s.retryBudget.Request()
 	triedEndpoints := make(map[string]bool)
+	var chain []models.RetryAttempt
 	ep := selection.Endpoint
 
 	for attempt := 0; attempt < maxEndpointRetries; attempt++ {
+		acquired, release, acqErr := s.acquireEndpoint(ep, selection.Model, endpoints, triedEndpoints, req)
+		if acqErr != nil {
+			return nil, failedAttemptsMeta(requestID, chain), acqErr
+		}
+		ep = acquired
 		attemptStart := time.Now()
 		epName := EndpointName(ep)
 		triedEndpoints[epName] = true
 
 		resp, err := s.connectStreamEndpoint(ctx, req, originalHeaders, ep, attemptStart)
+		chain = append(chain, retryAttempt(epName, err, attemptStart))
 		if err != nil {
+			release()
+			s.noteOverload(ep, err)
+			s.affinity.Forget(req, epName)
 			// Check if the error is non-retryable
-			var ue *UpstreamError
-			if errors.As(err, &ue) && !isRetryableStatusCode(ue.StatusCode) {
-				return nil, nil, err
+			if !shouldRetryEndpoint(ep, err) {
+				return nil, failedAttemptsMeta(requestID, chain), err
 			}
 
 			s.logger.Warn("stream endpoint failed, trying alternative",
@@ -444,15 +953,27 @@ func (s *ProxyService) ProxyStreamRequest(
 				zap.String("endpoint", epName),
 				zap.Error(err))
 
-			ep = s.selectAlternativeEndpoint(selection.Model, endpoints, triedEndpoints)
+			ep = s.selectAlternativeEndpoint(selection.Model, endpoints, triedEndpoints, req)
 			if ep == nil {
-				return nil, nil, fmt.Errorf("all endpoints failed for model %s: %w", selection.Model.Name, err)
+				return nil, failedAttemptsMeta(requestID, chain), fmt.Errorf("all endpoints failed for model %s: %w", selection.Model.Name, err)
+			}
+			if attempt+1 < maxEndpointRetries {
+				if !s.retryBudget.TryRetry() {
+					s.logRetryBudgetExhausted(epName, err)
+					return nil, failedAttemptsMeta(requestID, chain), err
+				}
+				if waitErr := s.backoff.wait(ctx, attempt, err); waitErr != nil {
+					return nil, failedAttemptsMeta(requestID, chain), waitErr
+				}
 			}
 			continue
 		}
 
 		// Connection succeeded — track it and start streaming
 		s.healthChecker.IncrementConnections(epName)
+		s.affinity.Remember(req, epName)
+		_, thinkingClampedFrom := thinkingBudget(req.Thinking, ep.Model)
+		s.logThinkingClamp(requestID, ep, thinkingClampedFrom)
 
 		meta := &ProxyMetadata{
 			RequestID:        requestID,
@@ -463,17 +984,24 @@ func (s *ProxyService) ProxyStreamRequest(
 			StatusCode:       resp.StatusCode,
 			Success:          true,
 			FallbackInfo:     selection.FallbackInfo,
+			RetryChain:       chain,
+
+			ThinkingClampedFrom: thinkingClampedFrom,
 		}
 
 		chunkChan := make(chan StreamChunk, 100)
 		// Return a copy so the caller cannot race with the goroutine
 		// that populates streaming fields (LatencyMs, InputTokens, etc.).
 		returnMeta := *meta
-		go s.readSSEStream(ctx, resp, ep, epName, attemptStart, meta, chunkChan)
+		budget := &outputBudget{limit: selection.MaxOutputTokens}
+		go func() {
+			defer release() // The provider slot is held until the stream ends
+			s.readSSEStream(ctx, resp, ep, epName, attemptStart, meta, budget, chunkChan)
+		}()
 		return chunkChan, &returnMeta, nil
 	}
 
-	return nil, nil, fmt.Errorf("max retries exceeded for model %s", selection.Model.Name)
+	return nil, failedAttemptsMeta(requestID, chain), fmt.Errorf("max retries exceeded for model %s", selection.Model.Name)
 }
 
 // connectStreamEndpoint establishes a streaming connection to a single endpoint.
@@ -486,52 +1014,86 @@ func (s *ProxyService) connectStreamEndpoint(
 	start time.Time,
 ) (*http.Response, error) {
 	epName := EndpointName(ep)
+	s.healthChecker.RecordProviderRequest(ep.Provider.Name)
 
 	streamReq := *req
 	streamReq.Model = ep.Model.Name
+	streamReq.Metadata = s.upstreamMetadata(req.Metadata)
 	streamReq.Stream = true
+	streamReq.Thinking, _ = thinkingBudget(req.Thinking, ep.Model)
+	streamReq.MaxTokens = s.upstreamMaxTokens(req, ep, streamReq.Thinking)
 
 	body, err := json.Marshal(&streamReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	upstreamURL := fmt.Sprintf("%s/v1/messages", ep.Provider.BaseURL)
-	upReq, err := http.NewRequestWithContext(ctx, http.MethodPost, upstreamURL, bytes.NewReader(body))
+	// The stream itself has no timeout; the idle deadline cancels streamCtx
+	// when the upstream goes quiet, and closing the body releases it.
+	streamCtx, cancel := context.WithCancel(ctx)
+	upstreamURL := ep.Provider.MessagesURL()
+	upReq, err := http.NewRequestWithContext(streamCtx, http.MethodPost, upstreamURL, bytes.NewReader(body))
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("create upstream request: %w", err)
 	}
 
 	upReq.Header.Set("Content-Type", "application/json")
 	upReq.Header.Set("Accept", "text/event-stream")
-	upReq.Header.Set("x-api-key", ep.Provider.APIKey)
-	upReq.Header.Set("anthropic-version", headerOrDefault(originalHeaders, "Anthropic-Version", "2023-06-01"))
+	setProviderAuth(ep.Provider, upReq.Header)
+	upReq.Header.Set("anthropic-version", s.versions.Resolve(ep.Provider, originalHeaders))
 	copyAnthropicHeaders(originalHeaders, upReq.Header)
 	if ua := originalHeaders.Get("User-Agent"); ua != "" {
 		upReq.Header.Set("User-Agent", ua)
 	}
 	applyCustomHeaders(ep.Provider.CustomHeaders, upReq.Header)
 
+	deadline := startIdleDeadline(s.streamIdleTimeout, cancel)
 	resp, err := s.streamClient.Do(upReq)
 	if err != nil {
-		s.healthChecker.UpdateRequestStats(epName, false, msSince(start))
+		deadline.stop()
+		cancel()
+		err = deadline.wrap(err)
+		s.healthChecker.RecordRequestError(epName, err, msSince(start))
 		return nil, fmt.Errorf("upstream request failed: %w", err)
 	}
+	resp.Body = &idleBody{ReadCloser: resp.Body, deadline: deadline, cancel: cancel}
 
 	if resp.StatusCode >= 400 {
 		respBody, readErr := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		s.healthChecker.UpdateRequestStats(epName, false, msSince(start))
+		upstreamErr := newUpstreamError(resp.StatusCode, respBody, parseRetryAfter(resp.Header))
+		s.healthChecker.RecordRequestError(epName, upstreamErr, msSince(start))
 		if readErr != nil {
 			return nil, fmt.Errorf("read upstream error response (status %d): %w", resp.StatusCode, readErr)
 		}
-		return nil, &UpstreamError{StatusCode: resp.StatusCode, Body: respBody}
+		return nil, upstreamErr
+	}
+
+	// A JSON (non-SSE) success response on a stream request is usually an
+	// error envelope from a provider that reports failures with status 200.
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		respBody, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			readErr = deadline.wrap(readErr)
+			s.healthChecker.RecordRequestError(epName, readErr, msSince(start))
+			return nil, fmt.Errorf("read upstream response: %w", readErr)
+		}
+		if _, _, isErrorBody := parseUpstreamError(respBody); isErrorBody {
+			upstreamErr := newUpstreamError(resp.StatusCode, respBody, 0)
+			s.healthChecker.RecordRequestError(epName, upstreamErr, msSince(start))
+			return nil, upstreamErr
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(respBody))
 	}
 
 	return resp, nil
 }
 
 // readSSEStream reads SSE events from the response and sends chunks to the channel.
+// When the output token budget is exceeded, the upstream connection is closed
+// and the client receives a synthetic max_tokens stop instead.
 func (s *ProxyService) readSSEStream(
 	ctx context.Context,
 	resp *http.Response,
@@ -539,22 +1101,25 @@ func (s *ProxyService) readSSEStream(
 	epName string,
 	start time.Time,
 	meta *ProxyMetadata,
+	budget *outputBudget,
 	chunkChan chan<- StreamChunk,
 ) {
 	defer close(chunkChan)
 	defer resp.Body.Close()
 	defer s.healthChecker.DecrementConnections(epName)
 
-	var inputTokens, outputTokens int
+	var usage models.Usage
 	var firstByteTime time.Time
+	var streamErr string
+	var streamFault error // The upstream error event, for the circuit breaker
 	reader := bufio.NewReader(resp.Body)
 
 	for {
 		select {
 		case <-ctx.Done():
 			latencyMs := streamLatency(firstByteTime, start)
-			s.healthChecker.UpdateRequestStats(epName, false, latencyMs)
-			finalMeta := buildStreamMeta(meta, ep, false, latencyMs, inputTokens, outputTokens)
+			s.healthChecker.RecordRequestError(epName, ctx.Err(), latencyMs)
+			finalMeta := buildStreamMeta(meta, ep, false, latencyMs, usage)
 			chunkChan <- StreamChunk{Err: ctx.Err(), Done: true, Meta: &finalMeta}
 			return
 		default:
@@ -566,14 +1131,26 @@ func (s *ProxyService) readSSEStream(
 				// EOF may carry remaining data — send it before finishing
 				if len(line) > 0 {
 					chunkChan <- StreamChunk{Data: line}
-					s.parseSSEUsage(line, &inputTokens, &outputTokens)
+					s.parseSSEUsage(line, &usage)
+					if reason, ok := parseSSEError(line); ok {
+						streamErr, streamFault = reason, sseUpstreamError(line)
+					}
 				}
 				break
 			}
-			s.logger.Error("error reading stream", zap.Error(err))
+			if errors.Is(err, ErrStreamIdle) {
+				// The idle deadline already cancelled the upstream request.
+				s.logger.Warn("upstream stream stalled, aborted",
+					zap.String("request_id", meta.RequestID),
+					zap.String("endpoint", epName),
+					zap.Duration("idle_timeout", s.streamIdleTimeout))
+			} else {
+				s.logger.Error("error reading stream", zap.Error(err))
+			}
 			latencyMs := streamLatency(firstByteTime, start)
-			s.healthChecker.UpdateRequestStats(epName, false, latencyMs)
-			finalMeta := buildStreamMeta(meta, ep, false, latencyMs, inputTokens, outputTokens)
+			s.healthChecker.RecordRequestError(epName, err, latencyMs)
+			finalMeta := buildStreamMeta(meta, ep, false, latencyMs, usage)
+			finalMeta.ErrorMessage = err.Error()
 			chunkChan <- StreamChunk{Err: err, Done: true, Meta: &finalMeta}
 			return
 		}
@@ -587,29 +1164,64 @@ func (s *ProxyService) readSSEStream(
 		}
 
 		// Parse SSE event for token counting
-		s.parseSSEUsage(line, &inputTokens, &outputTokens)
+		s.parseSSEUsage(line, &usage)
+
+		// Upstream error events are forwarded as-is but fail the request.
+		if reason, ok := parseSSEError(line); ok {
+			streamErr, streamFault = reason, sseUpstreamError(line)
+		}
+
+		budget.observe(line)
+		if budget.exceeded(usage.OutputTokens) {
+			resp.Body.Close()
+			usage.OutputTokens = budget.used(usage.OutputTokens)
+			for _, stop := range budget.stopEvents(usage.OutputTokens) {
+				chunkChan <- StreamChunk{Data: stop}
+			}
+			s.logger.Warn("stream exceeded output token budget, cut off upstream",
+				zap.String("request_id", meta.RequestID),
+				zap.String("endpoint", epName),
+				zap.Int("output_tokens", usage.OutputTokens),
+				zap.Int("budget", budget.limit))
+			break
+		}
 	}
 
 	// Calculate final metrics using TTFB
 	latencyMs := streamLatency(firstByteTime, start)
-	finalMeta := buildStreamMeta(meta, ep, true, latencyMs, inputTokens, outputTokens)
+	success := streamErr == ""
+	finalMeta := buildStreamMeta(meta, ep, success, latencyMs, usage)
+	finalMeta.ErrorMessage = streamErr
+	if !success {
+		s.logger.Warn("upstream stream reported error",
+			zap.String("request_id", meta.RequestID),
+			zap.String("endpoint", epName),
+			zap.String("reason", streamErr))
+	}
 
 	// Send final chunk with completed metadata
 	chunkChan <- StreamChunk{Done: true, Meta: &finalMeta}
 
 	// Update health stats
-	s.healthChecker.UpdateRequestStats(epName, true, latencyMs)
+	s.healthChecker.RecordRequestError(epName, streamFault, latencyMs)
+	s.healthChecker.RecordProviderTokens(ep.Provider.Name, usage.InputTokens+usage.OutputTokens)
 
 	s.logger.Debug("stream completed",
 		zap.String("request_id", meta.RequestID),
-		zap.Int("input_tokens", inputTokens),
-		zap.Int("output_tokens", outputTokens),
+		zap.Int("input_tokens", usage.InputTokens),
+		zap.Int("output_tokens", usage.OutputTokens),
+		zap.Int("cache_read_input_tokens", usage.CacheReadInputTokens),
 		zap.Float64("cost", finalMeta.Cost),
 		zap.Float64("latency_ms", latencyMs))
 }
 
-// parseSSEUsage extracts token usage from an SSE data line.
-func (s *ProxyService) parseSSEUsage(line []byte, inputTokens, outputTokens *int) {
+// parseSSEUsage extracts token usage from an SSE data line: the usage of
+// message_delta events and the message usage of message_start. Counts are
+// cumulative, so each reported non-zero field replaces the previous value;
+// a missing or zero field keeps it, as upstreams differ in which events
+// repeat which counts. The input count of message_start is preferred: later
+// events only fill it in when message_start did not report one.
+func (s *ProxyService) parseSSEUsage(line []byte, usage *models.Usage) {
 	lineStr := string(line)
 	if !strings.HasPrefix(lineStr, "data: ") {
 		return
@@ -622,16 +1234,55 @@ func (s *ProxyService) parseSSEUsage(line []byte, inputTokens, outputTokens *int
 	if err := json.Unmarshal([]byte(dataStr), &event); err != nil {
 		return
 	}
-	usage, ok := event["usage"].(map[string]any)
+	fields, ok := event["usage"].(map[string]any)
 	if !ok {
-		return
+		message, _ := event["message"].(map[string]any)
+		if fields, ok = message["usage"].(map[string]any); !ok {
+			return
+		}
+	}
+	counts := map[string]*int{
+		"output_tokens":               &usage.OutputTokens,
+		"cache_creation_input_tokens": &usage.CacheCreationInputTokens,
+		"cache_read_input_tokens":     &usage.CacheReadInputTokens,
+	}
+	if event["type"] == "message_start" || usage.InputTokens == 0 {
+		counts["input_tokens"] = &usage.InputTokens
 	}
-	if it, ok := usage["input_tokens"].(float64); ok {
-		*inputTokens = int(it)
+	for name, dst := range counts {
+		if v, ok := fields[name].(float64); ok && v > 0 {
+			*dst = int(v)
+		}
 	}
-	if ot, ok := usage["output_tokens"].(float64); ok {
-		*outputTokens = int(ot)
+}
+
+// parseSSEError extracts the failure reason from an SSE error event data line.
+func parseSSEError(line []byte) (string, bool) {
+	lineStr := string(line)
+	if !strings.HasPrefix(lineStr, "data: ") {
+		return "", false
 	}
+	errType, message, ok := parseUpstreamError([]byte(strings.TrimSpace(strings.TrimPrefix(lineStr, "data: "))))
+	if !ok {
+		return "", false
+	}
+	switch {
+	case errType != "" && message != "":
+		return errType + ": " + message, true
+	case message != "":
+		return message, true
+	case errType != "":
+		return errType, true
+	default:
+		return "upstream stream error", true
+	}
+}
+
+// sseUpstreamError converts an SSE error event line into an UpstreamError
+// whose status follows the event's error type.
+func sseUpstreamError(line []byte) *UpstreamError {
+	data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data: ")))
+	return newUpstreamError(http.StatusOK, data, 0)
 }
 
 // streamLatency returns TTFB if available, otherwise falls back to time since start.
@@ -643,12 +1294,14 @@ func streamLatency(firstByteTime, start time.Time) float64 {
 }
 
 // buildStreamMeta creates a copy of metadata with final streaming values.
-func buildStreamMeta(meta *ProxyMetadata, ep *models.Endpoint, success bool, latencyMs float64, inputTokens, outputTokens int) ProxyMetadata {
+func buildStreamMeta(meta *ProxyMetadata, ep *models.Endpoint, success bool, latencyMs float64, usage models.Usage) ProxyMetadata {
 	finalMeta := *meta
 	finalMeta.LatencyMs = latencyMs
-	finalMeta.InputTokens = inputTokens
-	finalMeta.OutputTokens = outputTokens
-	finalMeta.Cost = calculateCostFromTokens(ep.Model, inputTokens, outputTokens)
+	finalMeta.InputTokens = usage.InputTokens
+	finalMeta.OutputTokens = usage.OutputTokens
+	finalMeta.CacheCreationInputTokens = usage.CacheCreationInputTokens
+	finalMeta.CacheReadInputTokens = usage.CacheReadInputTokens
+	finalMeta.Cost = endpointCost(ep, usage)
 	finalMeta.Success = success
 	return finalMeta
 }
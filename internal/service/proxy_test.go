@@ -17,6 +17,8 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/user/llm-proxy-go/internal/config"
 	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
 	"go.uber.org/zap"
 )
 
@@ -171,13 +173,17 @@ func TestProxyService_ProxyRequest_UpstreamError(t *testing.T) {
 	}
 	resp, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
 	assert.Nil(t, resp)
-	assert.Nil(t, meta)
+	// Failed attempts are still reported for the request log.
+	require.NotNil(t, meta)
+	require.Len(t, meta.RetryChain, 1)
+	assert.Equal(t, 400, meta.RetryChain[0].StatusCode)
 	assert.Error(t, err)
 
 	// Should be UpstreamError
 	var upErr *UpstreamError
 	require.True(t, errors.As(err, &upErr))
 	assert.Equal(t, http.StatusBadRequest, upErr.StatusCode)
+	assert.Equal(t, "invalid_request_error", upErr.ErrorType)
 }
 
 func TestProxyService_ProxyRequest_ServerError(t *testing.T) {
@@ -210,7 +216,10 @@ func TestProxyService_ProxyRequest_ServerError(t *testing.T) {
 	}
 	resp, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
 	assert.Nil(t, resp)
-	assert.Nil(t, meta)
+	// Failed attempts are still reported for the request log.
+	require.NotNil(t, meta)
+	require.Len(t, meta.RetryChain, 1)
+	assert.Equal(t, 500, meta.RetryChain[0].StatusCode)
 	assert.Error(t, err)
 
 	// With retry logic, 500 errors trigger retry. Since there's only one endpoint,
@@ -271,7 +280,10 @@ func TestProxyService_ProxyStreamRequest_UpstreamError(t *testing.T) {
 	}
 	ch, meta, err := ps.ProxyStreamRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
 	assert.Nil(t, ch)
-	assert.Nil(t, meta)
+	// Failed attempts are still reported for the request log.
+	require.NotNil(t, meta)
+	require.Len(t, meta.RetryChain, 1)
+	assert.Equal(t, 401, meta.RetryChain[0].StatusCode)
 	assert.Error(t, err)
 
 	// 401 is retryable, so with one endpoint it wraps as "all endpoints failed"
@@ -371,6 +383,68 @@ func TestUpstreamError_Error(t *testing.T) {
 	assert.Equal(t, "upstream returned status 400", err.Error())
 }
 
+func TestNewUpstreamError_ErrorType(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		expected string
+	}{
+		{"envelope type wins", 400, `{"type":"error","error":{"type":"authentication_error","message":"bad key"}}`, "authentication_error"},
+		{"overloaded envelope", 529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, "overloaded_error"},
+		{"envelope without type", 429, `{"type":"error","error":{"message":"slow down"}}`, "rate_limit_error"},
+		{"html body", 502, `<html>Bad Gateway</html>`, "api_error"},
+		{"truncated json", 401, `{"type":"error","error":{"type":"authen`, "authentication_error"},
+		{"empty body", 503, ``, "overloaded_error"},
+		{"unknown status", 418, `teapot`, "api_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ue := newUpstreamError(tt.status, []byte(tt.body), 0)
+			assert.Equal(t, tt.expected, ue.ErrorType)
+			assert.Equal(t, tt.status, ue.StatusCode, "the original status is kept")
+		})
+	}
+}
+
+func TestNewUpstreamError_SuccessStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"rate limit", `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`, 429},
+		{"overloaded", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, 529},
+		{"invalid request", `{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`, 400},
+		{"without type", `{"type":"error","error":{"message":"failed"}}`, 502},
+		{"unknown type", `{"type":"error","error":{"type":"mystery_error","message":"?"}}`, 502},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ue := newUpstreamError(http.StatusOK, []byte(tt.body), 0)
+			assert.Equal(t, tt.status, ue.StatusCode, "a 200 error takes the status of its type")
+		})
+	}
+}
+
+func TestUpstreamError_ClientBody(t *testing.T) {
+	envelope := `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`
+	assert.JSONEq(t, envelope, string(newUpstreamError(429, []byte(envelope), 0).ClientBody()),
+		"a well-formed envelope is passed through verbatim")
+
+	var got models.ErrorResponse
+	require.NoError(t, json.Unmarshal(newUpstreamError(401, []byte("  <html>denied</html>\n"), 0).ClientBody(), &got))
+	assert.Equal(t, "error", got.Type)
+	assert.Equal(t, "authentication_error", got.Error.Type)
+	assert.Equal(t, "upstream returned status 401: <html>denied</html>", got.Error.Message)
+
+	// Errors built without the constructor still get a type.
+	require.NoError(t, json.Unmarshal((&UpstreamError{StatusCode: 500}).ClientBody(), &got))
+	assert.Equal(t, "api_error", got.Error.Type)
+	assert.Equal(t, "upstream returned status 500", got.Error.Message)
+}
+
 func TestHeaderOrDefault(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -410,6 +484,66 @@ func TestHeaderOrDefault(t *testing.T) {
 	}
 }
 
+func TestSetProviderAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		p      models.Provider
+		header string
+		value  string
+	}{
+		{"default", models.Provider{APIKey: "k"}, "x-api-key", "k"},
+		{"anthropic", models.Provider{APIKey: "k", AuthScheme: models.AuthSchemeAnthropic}, "x-api-key", "k"},
+		{"bearer", models.Provider{APIKey: "k", AuthScheme: models.AuthSchemeBearer}, "Authorization", "Bearer k"},
+		{"custom", models.Provider{APIKey: "k", AuthScheme: models.AuthSchemeCustomHeader, AuthHeader: "api-key"}, "Api-Key", "k"},
+		{"custom without header", models.Provider{APIKey: "k", AuthScheme: models.AuthSchemeCustomHeader}, "x-api-key", "k"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			setProviderAuth(&tt.p, h)
+			assert.Equal(t, tt.value, h.Get(tt.header))
+			assert.Len(t, h, 1)
+		})
+	}
+}
+
+func TestProxyService_BearerAuthWithCustomHeaders(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"msg_1","type":"message","role":"assistant","content":[]}`)
+	}))
+	defer server.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	model := &models.Model{ID: 1, Name: "claude-3-sonnet", Role: models.ModelRoleDefault, Enabled: true}
+	ep := &models.Endpoint{
+		Provider: &models.Provider{
+			ID: 1, Name: "gateway", BaseURL: server.URL, APIKey: "sk-gw", Enabled: true,
+			AuthScheme:    models.AuthSchemeBearer,
+			CustomHeaders: map[string]string{"X-Client": "proxy"},
+		},
+		Model:  model,
+		Status: models.EndpointHealthy,
+	}
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: model, TaskType: model.Role}
+
+	_, _, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer sk-gw", got.Get("Authorization"))
+	assert.Empty(t, got.Get("x-api-key"))
+	assert.Equal(t, "proxy", got.Get("X-Client"))
+}
+
 func TestCopyAnthropicHeaders(t *testing.T) {
 	src := http.Header{
 		"Anthropic-Beta":    []string{"beta-feature"},
@@ -454,20 +588,96 @@ func TestProxy_CalculateCost(t *testing.T) {
 	assert.InDelta(t, 0.0105, cost, 0.0001)
 }
 
-func TestCalculateCostFromTokens(t *testing.T) {
+func TestProxy_CalculateCost_BillingMultiplier(t *testing.T) {
 	model := &models.Model{
 		CostPerMtokInput:  3.0,
 		CostPerMtokOutput: 15.0,
 		BillingMultiplier: 2.0, // 2x multiplier
 	}
 
-	cost := calculateCostFromTokens(model, 1000, 500)
+	cost := calculateCost(model, models.Usage{InputTokens: 1000, OutputTokens: 500})
 	// Input: 1000/1M * 3 = 0.003
 	// Output: 500/1M * 15 * 2 = 0.015
 	// Total: 0.018
 	assert.InDelta(t, 0.018, cost, 0.0001)
 }
 
+func TestProxy_CalculateCost_PromptCache(t *testing.T) {
+	model := &models.Model{
+		CostPerMtokInput:     3.0,
+		CostPerMtokOutput:    15.0,
+		BillingMultiplier:    1.0,
+		CacheWriteMultiplier: models.DefaultCacheWriteMultiplier,
+		CacheReadMultiplier:  models.DefaultCacheReadMultiplier,
+	}
+
+	cost := calculateCost(model, models.Usage{
+		InputTokens:              1000,
+		OutputTokens:             500,
+		CacheCreationInputTokens: 2000,
+		CacheReadInputTokens:     10000,
+	})
+	// Input: 1000/1M * 3 = 0.003
+	// Cache write: 2000/1M * 3 * 1.25 = 0.0075
+	// Cache read: 10000/1M * 3 * 0.1 = 0.003
+	// Output: 500/1M * 15 = 0.0075
+	// Total: 0.021
+	assert.InDelta(t, 0.021, cost, 0.00001)
+}
+
+func TestProxyService_ParseSSEUsage(t *testing.T) {
+	svc := &ProxyService{}
+	var usage models.Usage
+
+	svc.parseSSEUsage([]byte(`data: {"type":"message_start","message":{"usage":{"input_tokens":12,"cache_creation_input_tokens":300,"cache_read_input_tokens":4000,"output_tokens":1}}}`+"\n"), &usage)
+	svc.parseSSEUsage([]byte(`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"hi"}}`+"\n"), &usage)
+	svc.parseSSEUsage([]byte(`data: {"type":"message_delta","usage":{"output_tokens":42}}`+"\n"), &usage)
+
+	assert.Equal(t, models.Usage{
+		InputTokens:              12,
+		OutputTokens:             42,
+		CacheCreationInputTokens: 300,
+		CacheReadInputTokens:     4000,
+	}, usage)
+}
+
+func TestProxyService_ParseSSEUsage_MultiEvent(t *testing.T) {
+	svc := &ProxyService{}
+	parse := func(usage *models.Usage, lines ...string) {
+		for _, line := range lines {
+			svc.parseSSEUsage([]byte(line+"\n"), usage)
+		}
+	}
+
+	// A message_delta reporting input_tokens 0 keeps the message_start count.
+	var usage models.Usage
+	parse(&usage,
+		`data: {"type":"message_start","message":{"usage":{"input_tokens":120,"output_tokens":1}}}`,
+		`data: {"type":"message_delta","usage":{"input_tokens":0,"output_tokens":42}}`)
+	assert.Equal(t, models.Usage{InputTokens: 120, OutputTokens: 42}, usage)
+
+	// The message_start input count wins over a differing later one.
+	usage = models.Usage{}
+	parse(&usage,
+		`data: {"type":"message_start","message":{"usage":{"input_tokens":120,"cache_read_input_tokens":900}}}`,
+		`data: {"type":"message_delta","usage":{"input_tokens":7,"output_tokens":42}}`)
+	assert.Equal(t, models.Usage{InputTokens: 120, OutputTokens: 42, CacheReadInputTokens: 900}, usage)
+
+	// Without an input count in message_start the final message_delta supplies it.
+	usage = models.Usage{}
+	parse(&usage,
+		`data: {"type":"message_start","message":{"usage":{"output_tokens":1}}}`,
+		`data: {"type":"message_delta","usage":{"input_tokens":95,"output_tokens":42}}`)
+	assert.Equal(t, models.Usage{InputTokens: 95, OutputTokens: 42}, usage)
+
+	// Input omitted entirely, output only in message_delta.
+	usage = models.Usage{}
+	parse(&usage,
+		`data: {"type":"message_start","message":{"usage":{}}}`,
+		`data: {"type":"message_delta","usage":{"output_tokens":42}}`)
+	assert.Equal(t, models.Usage{OutputTokens: 42}, usage)
+}
+
 func TestProxyService_ModelNameMapping(t *testing.T) {
 	// Test that the proxy correctly maps client's model name to endpoint's model name
 	var receivedModel string
@@ -543,6 +753,131 @@ func TestProxyService_ModelNameMapping(t *testing.T) {
 	assert.Equal(t, "claude-3-sonnet-20240229", meta.SelectedModel, "metadata should reflect selected model")
 }
 
+func TestProxyService_ForwardsArraySystemWithCacheControl(t *testing.T) {
+	var received map[string]json.RawMessage
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.AnthropicResponse{
+			ID:      "msg_123",
+			Type:    "message",
+			Role:    "assistant",
+			Content: []models.ContentPart{{Type: "text", Text: "Hello!"}},
+		})
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{Enabled: true}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	ep := createProxyTestEndpoint(upstream.URL)
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+
+	system := `[{"type":"text","text":"Reference manual...","cache_control":{"type":"ephemeral"}},{"type":"text","text":"Answer briefly."}]`
+	messages := `[{"role":"user","content":[{"type":"text","text":"Hi","cache_control":{"type":"ephemeral"}}]}]`
+	var req models.AnthropicRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"model":"auto","max_tokens":100,"system":`+system+`,"messages":`+messages+`}`), &req))
+	assert.Equal(t, "Reference manual... Answer briefly.", extractSystemContent(&req))
+
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: ep.Model.Role}
+	_, _, err := ps.ProxyRequest(context.Background(), &req, http.Header{}, selection, []*models.Endpoint{ep})
+	require.NoError(t, err)
+
+	assert.JSONEq(t, system, string(received["system"]), "array-form system prompt must reach upstream intact")
+	assert.JSONEq(t, messages, string(received["messages"]))
+}
+
+func TestProxyService_EndUserIDForwarding(t *testing.T) {
+	var received models.AnthropicRequest
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = models.AnthropicRequest{}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.AnthropicResponse{
+			ID:      "msg_123",
+			Type:    "message",
+			Role:    "assistant",
+			Content: []models.ContentPart{{Type: "text", Text: "Hello!"}},
+		})
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{Enabled: true}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	ep := createProxyTestEndpoint(upstream.URL)
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: ep.Model.Role}
+
+	newReq := func() *models.AnthropicRequest {
+		return &models.AnthropicRequest{
+			Model:     "auto",
+			MaxTokens: 100,
+			Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hi"}}},
+			Metadata:  map[string]string{"user_id": "user-42", "trace": "abc"},
+		}
+	}
+
+	req := newReq()
+	_, _, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+	require.NoError(t, err)
+	assert.Equal(t, "user-42", received.Metadata["user_id"], "forwarded by default")
+
+	ps.SetForwardEndUserID(false)
+	req = newReq()
+	_, _, err = ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+	require.NoError(t, err)
+	assert.NotContains(t, received.Metadata, "user_id")
+	assert.Equal(t, "abc", received.Metadata["trace"])
+	assert.Equal(t, "user-42", req.EndUserID(), "the client's request is left untouched")
+}
+
+func TestProxyService_ClampsThinkingBudget(t *testing.T) {
+	var received []*models.ThinkingConfig
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req models.AnthropicRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		received = append(received, req.Thinking)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.AnthropicResponse{
+			ID:      "msg_123",
+			Type:    "message",
+			Role:    "assistant",
+			Content: []models.ContentPart{{Type: "text", Text: "Hello!"}},
+		})
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{Enabled: true}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	ep := createProxyTestEndpoint(upstream.URL)
+	ep.Model.MaxThinkingTokens = 4096
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: ep.Model.Role}
+
+	send := func(budget int) (*models.ThinkingConfig, *ProxyMetadata) {
+		req := &models.AnthropicRequest{
+			Model:     "auto",
+			MaxTokens: 16000,
+			Thinking:  &models.ThinkingConfig{Type: "enabled", BudgetTokens: budget},
+			Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hi"}}},
+		}
+		_, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+		require.NoError(t, err)
+		assert.Equal(t, budget, req.Thinking.BudgetTokens, "the client's request must not be modified")
+		return received[len(received)-1], meta
+	}
+
+	sent, meta := send(10000)
+	assert.Equal(t, 4096, sent.BudgetTokens)
+	assert.Equal(t, 10000, meta.ThinkingClampedFrom)
+
+	sent, meta = send(2048)
+	assert.Equal(t, 2048, sent.BudgetTokens)
+	assert.Zero(t, meta.ThinkingClampedFrom)
+}
+
 // Helper function to create test endpoint
 func createProxyTestEndpoint(baseURL string) *models.Endpoint {
 	return &models.Endpoint{
@@ -597,6 +932,7 @@ func TestIsRetryableStatusCode(t *testing.T) {
 		{500, true},  // Internal server error
 		{502, true},  // Bad gateway
 		{503, true},  // Service unavailable
+		{529, true},  // Overloaded (Anthropic)
 	}
 
 	for _, tt := range tests {
@@ -864,7 +1200,10 @@ func TestProxyService_ProxyRequest_NoRetryOn400(t *testing.T) {
 
 	resp, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep1, ep2})
 	assert.Nil(t, resp)
-	assert.Nil(t, meta)
+	// Failed attempts are still reported for the request log.
+	require.NotNil(t, meta)
+	require.Len(t, meta.RetryChain, 1)
+	assert.Equal(t, 400, meta.RetryChain[0].StatusCode)
 	assert.Error(t, err)
 
 	// Should be UpstreamError with 400
@@ -911,12 +1250,13 @@ func TestBuildStreamMeta(t *testing.T) {
 		},
 	}
 
-	result := buildStreamMeta(meta, ep, false, 42.0, 100, 50)
+	result := buildStreamMeta(meta, ep, false, 42.0, models.Usage{InputTokens: 100, OutputTokens: 50, CacheReadInputTokens: 20})
 
 	assert.Equal(t, "req-123", result.RequestID)
 	assert.Equal(t, float64(42), result.LatencyMs)
 	assert.Equal(t, 100, result.InputTokens)
 	assert.Equal(t, 50, result.OutputTokens)
+	assert.Equal(t, 20, result.CacheReadInputTokens)
 	assert.False(t, result.Success)
 	assert.Greater(t, result.Cost, float64(0))
 
@@ -1042,3 +1382,317 @@ func TestProxyService_RetryUsesPerAttemptTiming(t *testing.T) {
 	assert.Less(t, meta.LatencyMs, float64(50),
 		"retry latency should measure only the successful attempt, not cumulative time")
 }
+
+// TestProxyService_ProxyRequest_PriorityFallthrough verifies that retries stay in
+// the cheapest tier first and only fall through to a worse tier on failure.
+func TestProxyService_ProxyRequest_PriorityFallthrough(t *testing.T) {
+	var calls []string
+	newUpstream := func(name string, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, name)
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(models.AnthropicResponse{
+				ID:      "msg_1",
+				Type:    "message",
+				Role:    "assistant",
+				Content: []models.ContentPart{{Type: "text", Text: "from " + name}},
+			})
+		}))
+	}
+	cheapSrv := newUpstream("cheap", http.StatusServiceUnavailable)
+	defer cheapSrv.Close()
+	midSrv := newUpstream("mid", http.StatusOK)
+	defer midSrv.Close()
+	priceySrv := newUpstream("pricey", http.StatusOK)
+	defer priceySrv.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	lb := NewLoadBalancerWithStrategy(models.StrategyWeighted)
+	ps := NewProxyService(hc, lb, nil, logger)
+
+	model := &models.Model{ID: 1, Name: "claude-3-sonnet", Role: models.ModelRoleDefault, Enabled: true}
+	cheap := &models.Endpoint{Model: model, Provider: &models.Provider{ID: 1, Name: "cheap", BaseURL: cheapSrv.URL, Weight: 1, Priority: 0}}
+	mid := &models.Endpoint{Model: model, Provider: &models.Provider{ID: 2, Name: "mid", BaseURL: midSrv.URL, Weight: 1, Priority: 1}}
+	pricey := &models.Endpoint{Model: model, Provider: &models.Provider{ID: 3, Name: "pricey", BaseURL: priceySrv.URL, Weight: 100, Priority: 2}}
+	endpoints := []*models.Endpoint{pricey, mid, cheap}
+	registerHealthyEndpoints(hc, endpoints)
+
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: cheap, Model: model, TaskType: model.Role}
+
+	resp, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, endpoints)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cheap", "mid"}, calls)
+	assert.Equal(t, "mid", meta.SelectedEndpoint)
+	assert.Equal(t, "from mid", resp.Content[0].Text)
+}
+
+// TestProxyService_ProxyRequest_RetryOnErrorBody verifies that provider retry
+// rules and error envelopes in success responses trigger failover.
+func TestProxyService_ProxyRequest_RetryOnErrorBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		rules  []models.RetryRule
+	}{
+		{
+			name:   "200 with error body",
+			status: http.StatusOK,
+			body:   `{"type":"error","error":{"type":"api_error","message":"upstream overloaded"}}`,
+		},
+		{
+			name:   "configured retryable 400",
+			status: http.StatusBadRequest,
+			body:   `{"type":"error","error":{"type":"invalid_request_error","message":"Model is loading, try again"}}`,
+			rules: []models.RetryRule{
+				{StatusCodes: []int{400}, MessageRegex: `(?i)model is loading`, Retry: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider1Calls := 0
+			upstream1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				provider1Calls++
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer upstream1.Close()
+
+			provider2Calls := 0
+			upstream2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				provider2Calls++
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(models.AnthropicResponse{
+					ID:      "msg_123",
+					Type:    "message",
+					Role:    "assistant",
+					Content: []models.ContentPart{{Type: "text", Text: "Success from provider2"}},
+				})
+			}))
+			defer upstream2.Close()
+
+			logger := zap.NewNop()
+			hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+			lb := NewLoadBalancerWithStrategy(models.StrategyRoundRobin)
+			ps := NewProxyService(hc, lb, nil, logger)
+
+			ep1 := createProxyTestEndpoint(upstream1.URL)
+			ep1.Provider.Name = "provider1"
+			ep1.Provider.RetryRules = tt.rules
+			ep2 := createProxyTestEndpoint(upstream2.URL)
+			ep2.Provider.ID = 2
+			ep2.Provider.Name = "provider2"
+			endpoints := []*models.Endpoint{ep1, ep2}
+			registerHealthyEndpoints(hc, endpoints)
+
+			req := &models.AnthropicRequest{
+				Model:     ep1.Model.Name,
+				MaxTokens: 100,
+				Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+			}
+			selection := &EndpointSelectionResult{Endpoint: ep1, Model: ep1.Model, TaskType: ep1.Model.Role}
+
+			resp, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, endpoints)
+			require.NoError(t, err)
+			assert.Equal(t, 1, provider1Calls)
+			assert.Equal(t, 1, provider2Calls)
+			assert.Equal(t, "provider2", meta.SelectedEndpoint)
+			assert.Equal(t, "Success from provider2", resp.Content[0].Text)
+		})
+	}
+}
+
+// TestProxyService_ProxyStreamRequest_RetryOnErrorBody verifies that a JSON
+// error envelope returned with status 200 on a stream request fails over.
+func TestProxyService_ProxyStreamRequest_RetryOnErrorBody(t *testing.T) {
+	upstream1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`))
+	}))
+	defer upstream1.Close()
+
+	upstream2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+	}))
+	defer upstream2.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	lb := NewLoadBalancerWithStrategy(models.StrategyRoundRobin)
+	ps := NewProxyService(hc, lb, nil, logger)
+
+	ep1 := createProxyTestEndpoint(upstream1.URL)
+	ep1.Provider.Name = "provider1"
+	ep2 := createProxyTestEndpoint(upstream2.URL)
+	ep2.Provider.ID = 2
+	ep2.Provider.Name = "provider2"
+	endpoints := []*models.Endpoint{ep1, ep2}
+	registerHealthyEndpoints(hc, endpoints)
+
+	req := &models.AnthropicRequest{
+		Model:     ep1.Model.Name,
+		MaxTokens: 100,
+		Stream:    true,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: ep1, Model: ep1.Model, TaskType: ep1.Model.Role}
+
+	chunks, meta, err := ps.ProxyStreamRequest(context.Background(), req, http.Header{}, selection, endpoints)
+	require.NoError(t, err)
+	assert.Equal(t, "provider2", meta.SelectedEndpoint)
+	for range chunks {
+	}
+}
+
+// TestProxyService_StreamMidStreamErrorEvent verifies that ping and error events
+// are forwarded verbatim and that an error event fails the final metadata.
+func TestProxyService_StreamMidStreamErrorEvent(t *testing.T) {
+	pingEvent := "event: ping\ndata: {\"type\": \"ping\"}\n\n"
+	errorEvent := "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":12,\"output_tokens\":1}}}\n\n")
+		fmt.Fprint(w, pingEvent)
+		fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi\"}}\n\n")
+		fmt.Fprint(w, errorEvent)
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	db := testutil.NewTestDB(t)
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	lb := NewLoadBalancerWithStrategy(models.StrategyRoundRobin)
+	ps := NewProxyService(hc, lb, repository.NewRequestLogRepositoryImpl(db, logger), logger)
+
+	ep := createProxyTestEndpoint(upstream.URL)
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+
+	req := &models.AnthropicRequest{
+		Model:     ep.Model.Name,
+		MaxTokens: 100,
+		Stream:    true,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: ep.Model.Role}
+
+	chunks, _, err := ps.ProxyStreamRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+	require.NoError(t, err)
+
+	var body string
+	var finalMeta *ProxyMetadata
+	for chunk := range chunks {
+		body += string(chunk.Data)
+		if chunk.Done {
+			finalMeta = chunk.Meta
+		}
+	}
+
+	assert.Contains(t, body, pingEvent)
+	assert.Contains(t, body, errorEvent)
+	require.NotNil(t, finalMeta)
+	assert.False(t, finalMeta.Success)
+	assert.Equal(t, "overloaded_error: Overloaded", finalMeta.ErrorMessage)
+
+	state := hc.GetState(EndpointName(ep))
+	require.NotNil(t, state)
+	assert.Equal(t, 1, state.TotalErrors)
+
+	// The saved log entry keeps the failure reason.
+	ps.SaveRequestLog(context.Background(), finalMeta, 1, nil)
+	var success bool
+	var responseContent string
+	require.Eventually(t, func() bool {
+		return db.QueryRow(`SELECT success, response_content FROM request_logs WHERE request_id = ?`,
+			finalMeta.RequestID).Scan(&success, &responseContent) == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.False(t, success)
+	assert.Equal(t, "overloaded_error: Overloaded", responseContent)
+
+	// The reason is redacted like any other logged content.
+	redactor, err := NewContentRedactor(config.RedactionConfig{Enabled: true, Patterns: config.DefaultRedactionPatterns})
+	require.NoError(t, err)
+	ps.SetContentRedactor(redactor)
+	leaky := &ProxyMetadata{RequestID: "req-leaky-error", ErrorMessage: "invalid_request_error: bad key sk-ant-REDACTED"}
+	ps.SaveRequestLog(context.Background(), leaky, 1, nil)
+	require.Eventually(t, func() bool {
+		return db.QueryRow(`SELECT response_content FROM request_logs WHERE request_id = ?`,
+			leaky.RequestID).Scan(&responseContent) == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "invalid_request_error: bad key [REDACTED]", responseContent)
+}
+
+func TestProxyService_ProxyRequest_RecordsRetryChain(t *testing.T) {
+	failing := func(status int, errType, message string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"type":"error","error":{"type":%q,"message":%q}}`, errType, message)
+		}))
+	}
+	upstream1 := failing(http.StatusForbidden, "permission_error", "quota exhausted")
+	defer upstream1.Close()
+	upstream2 := failing(http.StatusInternalServerError, "api_error", "internal error")
+	defer upstream2.Close()
+	upstream3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.AnthropicResponse{
+			ID:      "msg_ok",
+			Type:    "message",
+			Role:    "assistant",
+			Content: []models.ContentPart{{Type: "text", Text: "ok"}},
+			Usage:   models.Usage{InputTokens: 5, OutputTokens: 2},
+		})
+	}))
+	defer upstream3.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	lb := NewLoadBalancerWithStrategy(models.StrategyRoundRobin)
+	ps := NewProxyService(hc, lb, nil, logger)
+
+	model := &models.Model{ID: 1, Name: "claude-3-sonnet", Role: models.ModelRoleDefault, Enabled: true}
+	// Priorities make the failover order deterministic: p1, then p2, then p3.
+	var eps []*models.Endpoint
+	for i, url := range []string{upstream1.URL, upstream2.URL, upstream3.URL} {
+		eps = append(eps, &models.Endpoint{
+			Provider: &models.Provider{ID: int64(i + 1), Name: fmt.Sprintf("p%d", i+1), BaseURL: url, APIKey: "k", Priority: i, Enabled: true},
+			Model:    model,
+			Status:   models.EndpointHealthy,
+		})
+	}
+	registerHealthyEndpoints(hc, eps)
+
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: eps[0], Model: model, TaskType: model.Role}
+
+	resp, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, eps)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	require.Len(t, meta.RetryChain, 3)
+	assert.Equal(t, "p1/claude-3-sonnet", meta.RetryChain[0].Endpoint)
+	assert.Equal(t, 403, meta.RetryChain[0].StatusCode)
+	assert.Equal(t, "quota exhausted", meta.RetryChain[0].Error)
+	assert.Equal(t, "p2/claude-3-sonnet", meta.RetryChain[1].Endpoint)
+	assert.Equal(t, 500, meta.RetryChain[1].StatusCode)
+	assert.Equal(t, "p3/claude-3-sonnet", meta.RetryChain[2].Endpoint)
+	assert.Equal(t, 200, meta.RetryChain[2].StatusCode)
+	assert.Empty(t, meta.RetryChain[2].Error)
+}
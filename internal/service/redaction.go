@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/user/llm-proxy-go/internal/config"
+)
+
+// redactedPlaceholder replaces every redacted match.
+const redactedPlaceholder = "[REDACTED]"
+
+// ContentRedactor masks secrets and personal data in request and response
+// content before it is written to the request log.
+type ContentRedactor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewContentRedactor compiles the configured patterns. It returns nil when
+// redaction is disabled or has no patterns; a nil redactor leaves content
+// unchanged.
+func NewContentRedactor(cfg config.RedactionConfig) (*ContentRedactor, error) {
+	if !cfg.Enabled || len(cfg.Patterns) == 0 {
+		return nil, nil
+	}
+	r := &ContentRedactor{patterns: make([]*regexp.Regexp, 0, len(cfg.Patterns))}
+	for _, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compile redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// Redact returns content with every pattern match replaced. Serialized JSON
+// is redacted one string value at a time, so the result is still valid JSON
+// with the same structure; object keys are left alone. Anything else, such
+// as a plain error message, is redacted as text.
+func (r *ContentRedactor) Redact(content string) string {
+	if r == nil || content == "" {
+		return content
+	}
+	if !json.Valid([]byte(content)) {
+		return r.redactText(content)
+	}
+
+	var b strings.Builder
+	b.Grow(len(content))
+	last := 0
+	for i := 0; i < len(content); i++ {
+		if content[i] != '"' {
+			continue
+		}
+		end := jsonStringEnd(content, i)
+		if !isJSONKey(content, end) {
+			if redacted, ok := r.redactLiteral(content[i:end]); ok {
+				b.WriteString(content[last:i])
+				b.WriteString(redacted)
+				last = end
+			}
+		}
+		i = end - 1
+	}
+	if last == 0 {
+		return content
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
+
+// redactLiteral redacts the quoted JSON string literal and reports whether
+// anything matched.
+func (r *ContentRedactor) redactLiteral(literal string) (string, bool) {
+	var s string
+	if err := json.Unmarshal([]byte(literal), &s); err != nil {
+		return "", false
+	}
+	redacted := r.redactText(s)
+	if redacted == s {
+		return "", false
+	}
+	out, err := json.Marshal(redacted)
+	if err != nil {
+		return "", false
+	}
+	return string(out), true
+}
+
+// isRedacted reports whether content has been through a redactor and had
+// something masked.
+func isRedacted(content string) bool {
+	return strings.Contains(content, redactedPlaceholder)
+}
+
+func (r *ContentRedactor) redactText(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllLiteralString(s, redactedPlaceholder)
+	}
+	return s
+}
+
+// jsonStringEnd returns the index just past the closing quote of the JSON
+// string starting at start. The input is known to be valid JSON.
+func jsonStringEnd(s string, start int) int {
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// isJSONKey reports whether the string literal ending at end is an object
+// key, i.e. followed by a colon.
+func isJSONKey(s string, end int) bool {
+	for i := end; i < len(s); i++ {
+		switch s[i] {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case ':':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// defaultRequestTimeout bounds a non-streaming upstream request when neither
+// its model nor its provider sets a timeout.
+const defaultRequestTimeout = 120 * time.Second
+
+// ErrStreamIdle is returned when a streaming upstream sends nothing, neither
+// response headers nor body bytes, for the stream idle timeout.
+var ErrStreamIdle = errors.New("upstream stream idle timeout")
+
+// requestTimeout returns how long a non-streaming request to ep may take:
+// the model's timeout, else the provider's, else the default.
+func requestTimeout(ep *models.Endpoint) time.Duration {
+	if ep.Model != nil && ep.Model.TimeoutSeconds > 0 {
+		return time.Duration(ep.Model.TimeoutSeconds) * time.Second
+	}
+	if ep.Provider != nil && ep.Provider.TimeoutSeconds > 0 {
+		return time.Duration(ep.Provider.TimeoutSeconds) * time.Second
+	}
+	return defaultRequestTimeout
+}
+
+// timeoutError reports a request that hit its own deadline rather than one
+// cancelled by the caller.
+func timeoutError(parent context.Context, timeout time.Duration, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) && parent.Err() == nil {
+		return fmt.Errorf("upstream request timed out after %s: %w", timeout, err)
+	}
+	return err
+}
+
+// idleDeadline cancels a streaming upstream request once no data has
+// arrived for timeout. Every read that returns data pushes it back.
+type idleDeadline struct {
+	timeout time.Duration
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+// startIdleDeadline arms the deadline; a zero timeout never expires.
+func startIdleDeadline(timeout time.Duration, cancel context.CancelFunc) *idleDeadline {
+	d := &idleDeadline{timeout: timeout}
+	if timeout > 0 {
+		d.timer = time.AfterFunc(timeout, func() {
+			d.expired.Store(true)
+			cancel()
+		})
+	}
+	return d
+}
+
+func (d *idleDeadline) touch() {
+	if d.timer != nil {
+		d.timer.Reset(d.timeout)
+	}
+}
+
+func (d *idleDeadline) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
+
+// wrap replaces err with ErrStreamIdle when the deadline caused it.
+func (d *idleDeadline) wrap(err error) error {
+	if err != nil && d.expired.Load() {
+		return fmt.Errorf("%w after %s: %v", ErrStreamIdle, d.timeout, err)
+	}
+	return err
+}
+
+// idleBody is a streaming response body guarded by an idle deadline.
+// Closing it releases the deadline and the request context.
+type idleBody struct {
+	io.ReadCloser
+	deadline *idleDeadline
+	cancel   context.CancelFunc
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.deadline.touch()
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = b.deadline.wrap(err)
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.deadline.stop()
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,173 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    int
+		provider int
+		want     time.Duration
+	}{
+		{"default", 0, 0, defaultRequestTimeout},
+		{"provider", 0, 30, 30 * time.Second},
+		{"model overrides provider", 10, 30, 10 * time.Second},
+		{"model only", 45, 0, 45 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := createProxyTestEndpoint("http://unused")
+			ep.Model.TimeoutSeconds = tt.model
+			ep.Provider.TimeoutSeconds = tt.provider
+			assert.Equal(t, tt.want, requestTimeout(ep))
+		})
+	}
+}
+
+func TestProxyService_ProxyRequest_TimeoutFailsOver(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body) // Lets the server notice the client hanging up
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.AnthropicResponse{
+			ID:      "msg_1",
+			Type:    "message",
+			Role:    "assistant",
+			Content: []models.ContentPart{{Type: "text", Text: "fast"}},
+		})
+	}))
+	defer fast.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+
+	ep1 := createProxyTestEndpoint(slow.URL)
+	ep1.Provider.TimeoutSeconds = 1
+	ep2 := createProxyTestEndpoint(fast.URL)
+	ep2.Provider = &models.Provider{ID: 2, Name: "fast-provider", BaseURL: fast.URL, Enabled: true}
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep1, ep2})
+
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: ep1, Model: ep1.Model, TaskType: ep1.Model.Role}
+
+	began := time.Now()
+	resp, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep1, ep2})
+	require.NoError(t, err)
+	assert.Less(t, time.Since(began), 4*time.Second)
+	assert.Equal(t, "fast", resp.Content[0].Text)
+	assert.Equal(t, "fast-provider", meta.SelectedEndpoint)
+	require.Len(t, meta.RetryChain, 2)
+	assert.Contains(t, meta.RetryChain[0].Error, "timed out after 1s")
+}
+
+func TestProxyService_StreamIdleTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"usage\":{\"input_tokens\":10,\"output_tokens\":0}}}\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{Enabled: true}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	ps.SetStreamIdleTimeout(100 * time.Millisecond)
+
+	ep := createProxyTestEndpoint(upstream.URL)
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: ep.Model.Role}
+
+	ch, _, err := ps.ProxyStreamRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+	require.NoError(t, err)
+
+	var final StreamChunk
+	for c := range ch {
+		final = c
+	}
+	assert.True(t, final.Done)
+	assert.ErrorIs(t, final.Err, ErrStreamIdle)
+	require.NotNil(t, final.Meta)
+	assert.False(t, final.Meta.Success)
+	assert.Contains(t, final.Meta.ErrorMessage, "idle timeout")
+
+	state := hc.GetState(EndpointName(ep))
+	require.NotNil(t, state)
+	assert.Equal(t, 1, state.TotalErrors)
+}
+
+func TestProxyService_StreamIdleTimeout_BeforeHeadersFailsOver(t *testing.T) {
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer stalled.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"type\":\"message_stop\"}\n\n"))
+	}))
+	defer healthy.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{Enabled: true}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	ps.SetStreamIdleTimeout(100 * time.Millisecond)
+
+	ep1 := createProxyTestEndpoint(stalled.URL)
+	ep2 := createProxyTestEndpoint(healthy.URL)
+	ep2.Provider = &models.Provider{ID: 2, Name: "healthy-provider", BaseURL: healthy.URL, Enabled: true}
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep1, ep2})
+
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: ep1, Model: ep1.Model, TaskType: ep1.Model.Role}
+
+	ch, _, err := ps.ProxyStreamRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep1, ep2})
+	require.NoError(t, err)
+
+	var final StreamChunk
+	for c := range ch {
+		final = c
+	}
+	require.NoError(t, final.Err)
+	assert.Equal(t, "healthy-provider", final.Meta.SelectedEndpoint)
+	assert.Equal(t, 1, hc.GetState(EndpointName(ep1)).TotalErrors)
+}
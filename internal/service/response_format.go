@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+// ResponseFormatHeader lets a client request a response format the proxy
+// enforces regardless of model. The only supported value is "json".
+const ResponseFormatHeader = "X-Proxy-Response-Format"
+
+// jsonOnlyInstruction is appended to the system prompt in JSON mode.
+const jsonOnlyInstruction = "Respond with a single valid JSON value only. " +
+	"Do not wrap it in markdown code fences and do not add any text before or after it."
+
+// WithJSONInstruction returns a copy of req whose system prompt ends with an
+// instruction to answer in JSON only. The original request is not modified.
+func WithJSONInstruction(req *models.AnthropicRequest) *models.AnthropicRequest {
+	out := *req
+	switch {
+	case req.System == nil:
+		out.System = &models.SystemPrompt{Text: jsonOnlyInstruction}
+	case req.System.IsArray:
+		blocks := make([]models.ContentPart, 0, len(req.System.Blocks)+1)
+		blocks = append(blocks, req.System.Blocks...)
+		blocks = append(blocks, models.ContentPart{Type: "text", Text: jsonOnlyInstruction})
+		out.System = &models.SystemPrompt{Blocks: blocks, IsArray: true}
+	case req.System.Text == "":
+		out.System = &models.SystemPrompt{Text: jsonOnlyInstruction}
+	default:
+		out.System = &models.SystemPrompt{Text: req.System.Text + "\n\n" + jsonOnlyInstruction}
+	}
+	return &out
+}
+
+// IsJSONResponse reports whether the response text is a parseable JSON value.
+// A response stopping for tool use, or without text blocks, carries no JSON
+// answer yet and passes: its tool_use blocks are structured already.
+func IsJSONResponse(resp *models.AnthropicResponse) bool {
+	if resp.StopReason == "tool_use" {
+		return true
+	}
+	var text strings.Builder
+	hasText := false
+	for _, part := range resp.Content {
+		if part.Type == "text" {
+			text.WriteString(part.Text)
+			hasText = true
+		}
+	}
+	return !hasText || json.Valid([]byte(strings.TrimSpace(text.String())))
+}
+
+// ProxyJSONRequest proxies a JSON-mode request: the JSON-only instruction is
+// injected and a response that is not valid JSON is retried once. Usage and
+// cost of both attempts are reported in the returned metadata.
+func (s *ProxyService) ProxyJSONRequest(
+	ctx context.Context,
+	req *models.AnthropicRequest,
+	originalHeaders http.Header,
+	selection *EndpointSelectionResult,
+	endpoints []*models.Endpoint,
+) (*models.AnthropicResponse, *ProxyMetadata, error) {
+	req = WithJSONInstruction(req)
+	resp, meta, err := s.ProxyRequest(ctx, req, originalHeaders, selection, endpoints)
+	if err != nil || IsJSONResponse(resp) {
+		return resp, meta, err
+	}
+
+	s.logger.Warn("response is not valid JSON, retrying once",
+		zap.String("request_id", meta.RequestID),
+		zap.String("model", meta.SelectedModel))
+	first := meta
+	resp, meta, err = s.ProxyRequest(ctx, req, originalHeaders, selection, endpoints)
+	if meta == nil {
+		meta = first
+	} else {
+		meta.InputTokens += first.InputTokens
+		meta.OutputTokens += first.OutputTokens
+		meta.Cost += first.Cost
+	}
+	if err != nil {
+		return nil, meta, err
+	}
+	if !IsJSONResponse(resp) {
+		return nil, meta, fmt.Errorf("response is not valid JSON after retry")
+	}
+	return resp, meta, nil
+}
@@ -0,0 +1,115 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestIsJSONResponse(t *testing.T) {
+	toolUse := models.ContentPart{Type: "tool_use", ID: "toolu_1", Name: "lookup", Input: json.RawMessage(`{"q":"a"}`)}
+	tests := []struct {
+		name string
+		resp models.AnthropicResponse
+		want bool
+	}{
+		{"json text", models.AnthropicResponse{Content: []models.ContentPart{{Type: "text", Text: ` {"a":1} `}}}, true},
+		{"prose", models.AnthropicResponse{Content: []models.ContentPart{{Type: "text", Text: "Sure!"}}}, false},
+		{"tool use only", models.AnthropicResponse{StopReason: "tool_use", Content: []models.ContentPart{toolUse}}, true},
+		{
+			"tool use with preamble",
+			models.AnthropicResponse{StopReason: "tool_use", Content: []models.ContentPart{{Type: "text", Text: "Let me look."}, toolUse}},
+			true,
+		},
+		{"no text blocks", models.AnthropicResponse{StopReason: "end_turn", Content: []models.ContentPart{toolUse}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsJSONResponse(&tt.resp))
+		})
+	}
+}
+
+func TestWithJSONInstruction(t *testing.T) {
+	tests := []struct {
+		name   string
+		system *models.SystemPrompt
+		want   string
+	}{
+		{"no system", nil, `"` + jsonOnlyInstruction + `"`},
+		{"string system", &models.SystemPrompt{Text: "Be brief."}, `"Be brief.\n\n` + jsonOnlyInstruction + `"`},
+		{
+			"array system",
+			&models.SystemPrompt{IsArray: true, Blocks: []models.ContentPart{{Type: "text", Text: "Be brief."}}},
+			`[{"type":"text","text":"Be brief."},{"type":"text","text":"` + jsonOnlyInstruction + `"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &models.AnthropicRequest{Model: "m", System: tt.system}
+			out := WithJSONInstruction(req)
+			got, err := json.Marshal(out.System)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+			assert.Equal(t, tt.system, req.System, "original request must not change")
+		})
+	}
+}
+
+func TestProxyService_ProxyJSONRequest_RetriesNonJSON(t *testing.T) {
+	replies := []string{"Sure! Here it is: {\"a\": 1}", "{\"a\": 1}"}
+	var systems []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req models.AnthropicRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		systems = append(systems, req.System.String())
+
+		text := replies[len(systems)-1]
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.AnthropicResponse{
+			ID:      "msg_1",
+			Type:    "message",
+			Role:    "assistant",
+			Content: []models.ContentPart{{Type: "text", Text: text}},
+			Usage:   models.Usage{InputTokens: 10, OutputTokens: 5},
+		})
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	lb := NewLoadBalancerWithStrategy(models.StrategyRoundRobin)
+	ps := NewProxyService(hc, lb, nil, logger)
+
+	ep := createProxyTestEndpoint(upstream.URL)
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+
+	req := &models.AnthropicRequest{
+		Model:     ep.Model.Name,
+		MaxTokens: 100,
+		System:    &models.SystemPrompt{Text: "You are a parser."},
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Parse a=1"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: ep.Model.Role}
+
+	resp, meta, err := ps.ProxyJSONRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+	require.NoError(t, err)
+	require.Len(t, systems, 2, "non-JSON output should be retried once")
+	for _, system := range systems {
+		assert.Equal(t, "You are a parser.\n\n"+jsonOnlyInstruction, system)
+	}
+	assert.True(t, IsJSONResponse(resp))
+	assert.Equal(t, 20, meta.InputTokens, "usage covers both attempts")
+	assert.Equal(t, 10, meta.OutputTokens)
+}
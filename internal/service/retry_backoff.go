@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/config"
+)
+
+// statusOverloaded is the non-standard status Anthropic answers with when its
+// API is overloaded.
+const statusOverloaded = 529
+
+// retryBackoff computes the wait between endpoint retries: exponential from
+// base up to max, with a random fraction (jitter) taken off so concurrent
+// requests failing together do not retry in lockstep. The zero value never
+// waits.
+type retryBackoff struct {
+	base          time.Duration
+	max           time.Duration
+	jitter        float64
+	maxRetryAfter time.Duration
+	overload      time.Duration
+}
+
+func newRetryBackoff(cfg config.RetryBackoffConfig) retryBackoff {
+	return retryBackoff{
+		base:          time.Duration(cfg.BaseDelayMs) * time.Millisecond,
+		max:           time.Duration(cfg.MaxDelayMs) * time.Millisecond,
+		jitter:        cfg.Jitter,
+		maxRetryAfter: time.Duration(cfg.MaxRetryAfterMs) * time.Millisecond,
+		overload:      time.Duration(cfg.OverloadCooldownMs) * time.Millisecond,
+	}
+}
+
+// delay returns the wait before retry number retry (0 for the first) after
+// err. A 429 or 529 carrying a Retry-After within maxRetryAfter is waited out
+// as is.
+func (b retryBackoff) delay(retry int, err error) time.Duration {
+	if d := b.retryAfter(err); d > 0 {
+		return d
+	}
+	if b.base <= 0 {
+		return 0
+	}
+	d := b.base
+	for i := 0; i < retry && (b.max <= 0 || d < b.max); i++ {
+		d *= 2
+	}
+	if b.max > 0 && d > b.max {
+		d = b.max
+	}
+	if b.jitter > 0 {
+		d -= time.Duration(b.jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// retryAfter returns the usable Retry-After of a 429 or 529, or 0.
+func (b retryBackoff) retryAfter(err error) time.Duration {
+	var ue *UpstreamError
+	if !errors.As(err, &ue) || (ue.StatusCode != http.StatusTooManyRequests && ue.StatusCode != statusOverloaded) {
+		return 0
+	}
+	if ue.RetryAfter <= 0 || ue.RetryAfter > b.maxRetryAfter {
+		return 0
+	}
+	return ue.RetryAfter
+}
+
+// overloadCooldown returns how long the provider that failed with err should
+// be avoided: the upstream's Retry-After when usable, otherwise the configured
+// cooldown. It is 0 when err is not a 529 or provider cooldown is disabled.
+func (b retryBackoff) overloadCooldown(err error) time.Duration {
+	var ue *UpstreamError
+	if b.overload <= 0 || !errors.As(err, &ue) || ue.StatusCode != statusOverloaded {
+		return 0
+	}
+	if d := b.retryAfter(err); d > 0 {
+		return d
+	}
+	return b.overload
+}
+
+// wait sleeps for the delay before retry number retry, returning early with
+// the context's error if the request is cancelled.
+func (b retryBackoff) wait(ctx context.Context, retry int, err error) error {
+	d := b.delay(retry, err)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date. It returns 0 when the header is absent or invalid.
+func parseRetryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
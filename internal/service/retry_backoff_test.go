@@ -0,0 +1,214 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestRetryBackoff_Delay(t *testing.T) {
+	b := newRetryBackoff(config.RetryBackoffConfig{BaseDelayMs: 100, MaxDelayMs: 350, MaxRetryAfterMs: 5000})
+	err := errors.New("connection refused")
+	assert.Equal(t, 100*time.Millisecond, b.delay(0, err))
+	assert.Equal(t, 200*time.Millisecond, b.delay(1, err))
+	assert.Equal(t, 350*time.Millisecond, b.delay(2, err))
+	assert.Equal(t, 350*time.Millisecond, b.delay(30, err))
+
+	// Retry-After on a 429 replaces the backoff unless it is over the cap.
+	assert.Equal(t, 2*time.Second, b.delay(0, &UpstreamError{StatusCode: 429, RetryAfter: 2 * time.Second}))
+	assert.Equal(t, 100*time.Millisecond, b.delay(0, &UpstreamError{StatusCode: 429, RetryAfter: time.Minute}))
+	assert.Equal(t, 100*time.Millisecond, b.delay(0, &UpstreamError{StatusCode: 503, RetryAfter: 2 * time.Second}))
+
+	assert.Zero(t, retryBackoff{}.delay(3, err))
+}
+
+func TestRetryBackoff_Overload(t *testing.T) {
+	b := newRetryBackoff(config.RetryBackoffConfig{BaseDelayMs: 100, MaxDelayMs: 1000, MaxRetryAfterMs: 5000, OverloadCooldownMs: 3000})
+	overloaded := &UpstreamError{StatusCode: statusOverloaded}
+	assert.Equal(t, 3*time.Second, b.overloadCooldown(overloaded))
+	assert.Equal(t, 100*time.Millisecond, b.delay(0, overloaded))
+
+	// A usable Retry-After on the 529 sets both the retry wait and the cooldown.
+	withHint := &UpstreamError{StatusCode: statusOverloaded, RetryAfter: 2 * time.Second}
+	assert.Equal(t, 2*time.Second, b.overloadCooldown(withHint))
+	assert.Equal(t, 2*time.Second, b.delay(0, withHint))
+
+	assert.Zero(t, b.overloadCooldown(&UpstreamError{StatusCode: 503}))
+	assert.Zero(t, b.overloadCooldown(errors.New("connection refused")))
+	assert.Zero(t, newRetryBackoff(config.RetryBackoffConfig{}).overloadCooldown(overloaded))
+}
+
+func TestRetryBackoff_Jitter(t *testing.T) {
+	b := newRetryBackoff(config.RetryBackoffConfig{BaseDelayMs: 100, MaxDelayMs: 1000, Jitter: 0.5})
+	for i := 0; i < 100; i++ {
+		d := b.delay(1, nil)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.LessOrEqual(t, d, 200*time.Millisecond)
+	}
+}
+
+func TestRetryBackoff_WaitCancelled(t *testing.T) {
+	b := newRetryBackoff(config.RetryBackoffConfig{BaseDelayMs: 10000, MaxDelayMs: 10000})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.ErrorIs(t, b.wait(ctx, 0, nil), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	h := http.Header{}
+	assert.Zero(t, parseRetryAfter(h))
+	h.Set("Retry-After", "3")
+	assert.Equal(t, 3*time.Second, parseRetryAfter(h))
+	h.Set("Retry-After", "-1")
+	assert.Zero(t, parseRetryAfter(h))
+	h.Set("Retry-After", "soon")
+	assert.Zero(t, parseRetryAfter(h))
+	h.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, float64(time.Hour), float64(parseRetryAfter(h)), float64(2*time.Second))
+}
+
+func TestProxyService_RetryBackoff(t *testing.T) {
+	var calls atomic.Int32
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "30")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`)
+	}))
+	defer limited.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"msg_1","type":"message","role":"assistant","content":[]}`)
+	}))
+	defer healthy.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	ps.SetRetryBackoff(config.RetryBackoffConfig{BaseDelayMs: 10, MaxDelayMs: 10, MaxRetryAfterMs: 60000})
+
+	model := &models.Model{ID: 1, Name: "claude-3-sonnet", Role: models.ModelRoleDefault, Enabled: true}
+	var eps []*models.Endpoint
+	for i, url := range []string{limited.URL, healthy.URL} {
+		eps = append(eps, &models.Endpoint{
+			Provider: &models.Provider{ID: int64(i + 1), Name: fmt.Sprintf("p%d", i+1), BaseURL: url, APIKey: "k", Priority: i, Enabled: true},
+			Model:    model,
+			Status:   models.EndpointHealthy,
+		})
+	}
+	registerHealthyEndpoints(hc, eps)
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: eps[0], Model: model, TaskType: model.Role}
+
+	// The 429's Retry-After is honored, so a client that gives up first
+	// stops the retry instead of waiting.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, meta, err := ps.ProxyRequest(ctx, req, http.Header{}, selection, eps)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, int32(1), calls.Load(), "no retry after the client is gone")
+	require.NotNil(t, meta)
+	require.Len(t, meta.RetryChain, 1)
+	assert.Equal(t, http.StatusTooManyRequests, meta.RetryChain[0].StatusCode)
+
+	// The same applies to the streaming connect loop.
+	calls.Store(0)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = ps.ProxyStreamRequest(ctx, req, http.Header{}, selection, eps)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Without a usable Retry-After the short backoff applies and the retry
+	// reaches the healthy endpoint.
+	ps.SetRetryBackoff(config.RetryBackoffConfig{BaseDelayMs: 10, MaxDelayMs: 10, MaxRetryAfterMs: 1000})
+	calls.Store(0)
+	resp, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, eps)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Len(t, meta.RetryChain, 2)
+}
+
+func TestProxyService_Overload529(t *testing.T) {
+	var overloadedCalls, healthyCalls atomic.Int32
+	overloaded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		overloadedCalls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusOverloaded)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+	}))
+	defer overloaded.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		healthyCalls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"msg_1","type":"message","role":"assistant","content":[]}`)
+	}))
+	defer healthy.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	ps.SetRetryBackoff(config.RetryBackoffConfig{BaseDelayMs: 30, MaxDelayMs: 30, MaxRetryAfterMs: 1000, OverloadCooldownMs: 60000})
+
+	model := &models.Model{ID: 1, Name: "claude-3-sonnet", Role: models.ModelRoleDefault, Enabled: true}
+	var eps []*models.Endpoint
+	for i, url := range []string{overloaded.URL, healthy.URL} {
+		eps = append(eps, &models.Endpoint{
+			Provider: &models.Provider{ID: int64(i + 1), Name: fmt.Sprintf("p%d", i+1), BaseURL: url, APIKey: "k", Enabled: true},
+			Model:    model,
+			Status:   models.EndpointHealthy,
+		})
+	}
+	registerHealthyEndpoints(hc, eps)
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: eps[0], Model: model, TaskType: model.Role}
+
+	start := time.Now()
+	resp, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, eps)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond, "failover waits out the backoff")
+	assert.Equal(t, "p2", meta.SelectedEndpoint)
+	require.Len(t, meta.RetryChain, 2)
+	assert.Equal(t, statusOverloaded, meta.RetryChain[0].StatusCode)
+
+	// The 529 is counted as an overload event and the provider is avoided.
+	usage := hc.ProviderUsage(eps[0].Provider)
+	assert.Equal(t, 1, usage.OverloadEvents)
+	assert.True(t, usage.Overloaded)
+	assert.Zero(t, hc.ProviderUsage(eps[1].Provider).OverloadEvents)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, eps[1], ps.selectAlternativeEndpoint(model, eps, map[string]bool{}, req))
+	}
+	assert.Equal(t, int32(1), overloadedCalls.Load())
+	assert.Equal(t, int32(1), healthyCalls.Load())
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/config"
+)
+
+// RetryBudgetSnapshot reports the retry budget for the system status.
+type RetryBudgetSnapshot struct {
+	Enabled       bool    `json:"enabled"`
+	Ratio         float64 `json:"ratio"`
+	WindowSeconds int     `json:"window_seconds"`
+	Requests      int64   `json:"requests"`  // Requests in the window
+	Retries       int64   `json:"retries"`   // Retries spent in the window
+	Available     int64   `json:"available"` // Retries still allowed in the window
+	Denied        int64   `json:"denied"`    // Retries refused since start
+}
+
+// RetryBudget caps endpoint retries at a fraction of recent requests, so a
+// widespread outage does not multiply the load on providers that are already
+// failing. Every request earns Ratio retries and every retry spends one; a
+// floor of MinPerSecond retries keeps low-traffic proxies retrying normally.
+// Counts are kept per second over a sliding window. A nil RetryBudget never
+// refuses a retry.
+type RetryBudget struct {
+	ratio        float64
+	minPerSecond int
+	window       int // Seconds
+	now          func() time.Time
+
+	mu       sync.Mutex
+	requests []int64 // Ring of per-second counts, indexed by unix second % window
+	retries  []int64
+	seconds  []int64 // Unix second each slot was last reset for
+	denied   int64
+}
+
+// NewRetryBudget creates a RetryBudget from cfg. It returns nil, meaning
+// unlimited retries, when cfg.Ratio is 0.
+func NewRetryBudget(cfg config.RetryBudgetConfig) *RetryBudget {
+	if cfg.Ratio <= 0 {
+		return nil
+	}
+	window := cfg.WindowSeconds
+	if window < 1 {
+		window = 1
+	}
+	return &RetryBudget{
+		ratio:        cfg.Ratio,
+		minPerSecond: cfg.MinPerSecond,
+		window:       window,
+		now:          time.Now,
+		requests:     make([]int64, window),
+		retries:      make([]int64, window),
+		seconds:      make([]int64, window),
+	}
+}
+
+// slot returns the ring index for the current second, clearing it when it
+// last held an older second. Callers hold mu.
+func (b *RetryBudget) slot() int {
+	sec := b.now().Unix()
+	i := int(sec % int64(b.window))
+	if b.seconds[i] != sec {
+		b.seconds[i] = sec
+		b.requests[i] = 0
+		b.retries[i] = 0
+	}
+	return i
+}
+
+// totals sums the counts of the seconds still inside the window. Callers
+// hold mu.
+func (b *RetryBudget) totals() (requests, retries int64) {
+	oldest := b.now().Unix() - int64(b.window)
+	for i := range b.seconds {
+		if b.seconds[i] > oldest {
+			requests += b.requests[i]
+			retries += b.retries[i]
+		}
+	}
+	return requests, retries
+}
+
+// available returns how many retries the window still allows. Callers hold
+// mu.
+func (b *RetryBudget) available() int64 {
+	requests, retries := b.totals()
+	allowed := int64(b.ratio * float64(requests))
+	if floor := int64(b.minPerSecond * b.window); allowed < floor {
+		allowed = floor
+	}
+	if retries >= allowed {
+		return 0
+	}
+	return allowed - retries
+}
+
+// Request records a request's first attempt, which is always made.
+func (b *RetryBudget) Request() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests[b.slot()]++
+}
+
+// TryRetry spends one retry if the budget allows it and reports whether it
+// did.
+func (b *RetryBudget) TryRetry() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := b.slot()
+	if b.available() <= 0 {
+		b.denied++
+		return false
+	}
+	b.retries[i]++
+	return true
+}
+
+// Snapshot returns the current state of the budget.
+func (b *RetryBudget) Snapshot() RetryBudgetSnapshot {
+	if b == nil {
+		return RetryBudgetSnapshot{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	requests, retries := b.totals()
+	return RetryBudgetSnapshot{
+		Enabled:       true,
+		Ratio:         b.ratio,
+		WindowSeconds: b.window,
+		Requests:      requests,
+		Retries:       retries,
+		Available:     b.available(),
+		Denied:        b.denied,
+	}
+}
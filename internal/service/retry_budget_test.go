@@ -0,0 +1,135 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestRetryBudget(t *testing.T) {
+	assert.Nil(t, NewRetryBudget(config.RetryBudgetConfig{}), "ratio 0 means unlimited")
+	var unlimited *RetryBudget
+	unlimited.Request()
+	assert.True(t, unlimited.TryRetry())
+	assert.False(t, unlimited.Snapshot().Enabled)
+
+	b := NewRetryBudget(config.RetryBudgetConfig{Ratio: 0.1, MinPerSecond: 0, WindowSeconds: 10})
+	now := time.Unix(1_700_000_000, 0)
+	b.now = func() time.Time { return now }
+
+	assert.False(t, b.TryRetry(), "no requests, no budget")
+	for i := 0; i < 20; i++ {
+		b.Request()
+	}
+	assert.True(t, b.TryRetry())
+	assert.True(t, b.TryRetry())
+	assert.False(t, b.TryRetry(), "10% of 20 requests spent")
+
+	snap := b.Snapshot()
+	assert.True(t, snap.Enabled)
+	assert.Equal(t, int64(20), snap.Requests)
+	assert.Equal(t, int64(2), snap.Retries)
+	assert.Zero(t, snap.Available)
+	assert.Equal(t, int64(2), snap.Denied)
+
+	// Requests and retries leave the window as time passes.
+	now = now.Add(10 * time.Second)
+	snap = b.Snapshot()
+	assert.Zero(t, snap.Requests)
+	assert.Zero(t, snap.Retries)
+	assert.Equal(t, int64(2), snap.Denied, "denials are counted since start")
+}
+
+func TestRetryBudget_MinPerSecond(t *testing.T) {
+	b := NewRetryBudget(config.RetryBudgetConfig{Ratio: 0.1, MinPerSecond: 1, WindowSeconds: 3})
+	now := time.Unix(1_700_000_000, 0)
+	b.now = func() time.Time { return now }
+
+	// The floor allows retries without any traffic.
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			now = now.Add(time.Second)
+		}
+		assert.True(t, b.TryRetry())
+	}
+	assert.False(t, b.TryRetry())
+	assert.Equal(t, int64(0), b.Snapshot().Available)
+
+	now = now.Add(time.Second)
+	assert.True(t, b.TryRetry(), "the oldest second left the window")
+}
+
+func TestProxyService_RetryBudgetExhausted(t *testing.T) {
+	var calls atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"api_error","message":"down"}}`)
+	}))
+	defer failing.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+	budget := NewRetryBudget(config.RetryBudgetConfig{Ratio: 0.5, WindowSeconds: 10})
+	ps.SetRetryBudget(budget)
+
+	model := &models.Model{ID: 1, Name: "claude-3-sonnet", Role: models.ModelRoleDefault, Enabled: true}
+	var eps []*models.Endpoint
+	for i := 0; i < 3; i++ {
+		eps = append(eps, &models.Endpoint{
+			Provider: &models.Provider{ID: int64(i + 1), Name: fmt.Sprintf("p%d", i+1), BaseURL: failing.URL, APIKey: "k", Enabled: true},
+			Model:    model,
+			Status:   models.EndpointHealthy,
+		})
+	}
+	registerHealthyEndpoints(hc, eps)
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: eps[0], Model: model, TaskType: model.Role}
+
+	// Half a retry per request: the first request gets none, the second
+	// gets one and is refused another.
+	_, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, eps)
+	var ue *UpstreamError
+	require.ErrorAs(t, err, &ue, "the original error is returned")
+	assert.Equal(t, http.StatusServiceUnavailable, ue.StatusCode)
+	require.NotNil(t, meta)
+	assert.Len(t, meta.RetryChain, 1)
+	assert.Equal(t, int32(1), calls.Load())
+
+	calls.Store(0)
+	_, meta, err = ps.ProxyRequest(context.Background(), req, http.Header{}, selection, eps)
+	require.Error(t, err)
+	assert.Len(t, meta.RetryChain, 2)
+	assert.Equal(t, int32(2), calls.Load())
+
+	// The streaming connect loop spends the same budget.
+	calls.Store(0)
+	_, meta, err = ps.ProxyStreamRequest(context.Background(), req, http.Header{}, selection, eps)
+	require.ErrorAs(t, err, &ue)
+	assert.Len(t, meta.RetryChain, 1)
+	assert.Equal(t, int32(1), calls.Load())
+
+	snap := budget.Snapshot()
+	assert.Equal(t, int64(3), snap.Requests)
+	assert.Equal(t, int64(1), snap.Retries)
+	assert.Equal(t, int64(3), snap.Denied)
+}
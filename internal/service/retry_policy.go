@@ -0,0 +1,115 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// retryRegexCache holds compiled retry rule patterns keyed by source.
+var retryRegexCache sync.Map
+
+// upstreamErrorBody matches both the Anthropic error envelope
+// ({"type":"error","error":{...}}) and the OpenAI style ({"error":{...}}).
+type upstreamErrorBody struct {
+	Type  string `json:"type"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// parseUpstreamError extracts the error type and message from an upstream body.
+// ok is false when the body is not an error envelope.
+func parseUpstreamError(body []byte) (errType, message string, ok bool) {
+	var eb upstreamErrorBody
+	if err := json.Unmarshal(body, &eb); err != nil || eb.Error == nil {
+		return "", "", false
+	}
+	if eb.Type != "error" && eb.Error.Type == "" && eb.Error.Message == "" {
+		return "", "", false
+	}
+	return eb.Error.Type, eb.Error.Message, true
+}
+
+// ValidateRetryRules checks that every rule pattern compiles.
+func ValidateRetryRules(rules []models.RetryRule) error {
+	for i, r := range rules {
+		for _, pattern := range []string{r.ErrorType, r.MessageRegex} {
+			if pattern == "" {
+				continue
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("retry rule %d: invalid pattern %q: %w", i, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matchRetryPattern reports whether s matches pattern. Empty patterns match
+// anything; invalid patterns never match.
+func matchRetryPattern(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	if re, ok := retryRegexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp).MatchString(s)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false
+	}
+	retryRegexCache.Store(pattern, re)
+	return re.MatchString(s)
+}
+
+// matchRetryRules returns the decision of the first rule matching the error.
+// matched is false when no rule applies.
+func matchRetryRules(rules []models.RetryRule, ue *UpstreamError) (retry, matched bool) {
+	if len(rules) == 0 {
+		return false, false
+	}
+	errType, message, _ := parseUpstreamError(ue.Body)
+	for _, r := range rules {
+		if len(r.StatusCodes) > 0 && !slices.Contains(r.StatusCodes, ue.StatusCode) {
+			continue
+		}
+		if !matchRetryPattern(r.ErrorType, errType) || !matchRetryPattern(r.MessageRegex, message) {
+			continue
+		}
+		return r.Retry, true
+	}
+	return false, false
+}
+
+// shouldRetryEndpoint decides whether a failed attempt should fail over to
+// another endpoint. Provider retry rules take precedence over the status-code
+// default; transport errors and error bodies returned with a success status
+// are always retryable unless a rule says otherwise.
+func shouldRetryEndpoint(ep *models.Endpoint, err error) bool {
+	var ue *UpstreamError
+	if !errors.As(err, &ue) {
+		return true
+	}
+	// A payload one endpoint rejects as too large is too large for all of
+	// them, so the 413 is surfaced as-is whatever the retry rules say.
+	if ue.StatusCode == http.StatusRequestEntityTooLarge {
+		return false
+	}
+	if ep != nil && ep.Provider != nil {
+		if retry, matched := matchRetryRules(ep.Provider.RetryRules, ue); matched {
+			return retry
+		}
+	}
+	if ue.StatusCode < 400 {
+		return true
+	}
+	return isRetryableStatusCode(ue.StatusCode)
+}
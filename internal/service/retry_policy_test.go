@@ -0,0 +1,97 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+func TestParseUpstreamError(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantType string
+		wantMsg  string
+		wantOK   bool
+	}{
+		{"anthropic envelope", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, "overloaded_error", "Overloaded", true},
+		{"openai envelope", `{"error":{"type":"server_error","message":"boom"}}`, "server_error", "boom", true},
+		{"success message", `{"type":"message","content":[]}`, "", "", false},
+		{"not json", `upstream down`, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errType, msg, ok := parseUpstreamError([]byte(tt.body))
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantType, errType)
+			assert.Equal(t, tt.wantMsg, msg)
+		})
+	}
+}
+
+func TestShouldRetryEndpoint(t *testing.T) {
+	loading := `{"type":"error","error":{"type":"invalid_request_error","message":"model loading, try again"}}`
+	overloaded := `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`
+
+	tests := []struct {
+		name  string
+		rules []models.RetryRule
+		err   error
+		want  bool
+	}{
+		{"transport error", nil, errors.New("connection refused"), true},
+		{"400 default", nil, &UpstreamError{StatusCode: 400, Body: []byte(loading)}, false},
+		{"500 default", nil, &UpstreamError{StatusCode: 500}, true},
+		{"200 error body default", nil, &UpstreamError{StatusCode: 200, Body: []byte(overloaded)}, true},
+		{
+			"400 message rule",
+			[]models.RetryRule{{MessageRegex: "loading", Retry: true}},
+			&UpstreamError{StatusCode: 400, Body: []byte(loading)},
+			true,
+		},
+		{
+			"rule restricted to other status",
+			[]models.RetryRule{{StatusCodes: []int{503}, MessageRegex: "loading", Retry: true}},
+			&UpstreamError{StatusCode: 400, Body: []byte(loading)},
+			false,
+		},
+		{
+			"type rule disables retry",
+			[]models.RetryRule{{ErrorType: "^overloaded_error$", Retry: false}},
+			&UpstreamError{StatusCode: 529, Body: []byte(overloaded)},
+			false,
+		},
+		{
+			"413 ignores retry rules",
+			[]models.RetryRule{{Retry: true}},
+			&UpstreamError{StatusCode: 413, Body: []byte(loading)},
+			false,
+		},
+		{
+			"first matching rule wins",
+			[]models.RetryRule{
+				{ErrorType: "invalid_request", MessageRegex: "context length", Retry: false},
+				{ErrorType: "invalid_request", Retry: true},
+			},
+			&UpstreamError{StatusCode: 400, Body: []byte(loading)},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := &models.Endpoint{Provider: &models.Provider{Name: "p", RetryRules: tt.rules}}
+			assert.Equal(t, tt.want, shouldRetryEndpoint(ep, tt.err))
+		})
+	}
+}
+
+func TestValidateRetryRules(t *testing.T) {
+	assert.NoError(t, ValidateRetryRules(nil))
+	assert.NoError(t, ValidateRetryRules([]models.RetryRule{{ErrorType: "^api_error$", MessageRegex: "(?i)retry"}}))
+	assert.Error(t, ValidateRetryRules([]models.RetryRule{{MessageRegex: "("}}))
+}
@@ -270,7 +270,7 @@ func (a *RoutingAnalyzer) callAnalysisModel(ctx context.Context, userPrompt stri
 		return "", fmt.Errorf("marshal request: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/v1/chat/completions", modelCfg.BaseURL)
+	url := modelCfg.ChatCompletionsURL()
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(bodyBytes))
 	if err != nil {
 		return "", fmt.Errorf("create request: %w", err)
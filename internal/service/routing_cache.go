@@ -3,7 +3,12 @@ package service
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -56,10 +61,17 @@ func NormalizeText(text string) string {
 	return text
 }
 
+// cacheKeyMaxLen caps how many bytes of the user message are hashed into a
+// cache key, so huge pasted or tool outputs cost no more than a short prompt.
+const cacheKeyMaxLen = 2000
+
 // GetCacheKey generates an MD5 hash cache key from user message.
-// Only user_message is used (system_content is ignored for key generation).
+// Only user_message is used (system_content is ignored for key generation),
+// with client-injected blocks such as <system-reminder> stripped, so requests
+// differing only in those volatile blocks share a cache entry.
 func GetCacheKey(_ string, userMessage string) string {
-	normalized := NormalizeText(userMessage)
+	userMessage = stripSystemInjections(userMessage)
+	normalized := NormalizeText(truncateUTF8(userMessage, cacheKeyMaxLen))
 	hash := md5.Sum([]byte(normalized))
 	return hex.EncodeToString(hash[:])
 }
@@ -134,11 +146,13 @@ func (rc *RoutingCache) Set(cacheKey string, taskType models.ModelRole) {
 	}
 }
 
-// Clear removes all entries from the cache.
-func (rc *RoutingCache) Clear() {
+// Clear removes all entries from the cache and returns how many there were.
+func (rc *RoutingCache) Clear() int {
 	rc.mu.Lock()
 	defer rc.mu.Unlock()
+	n := len(rc.cache)
 	rc.cache = make(map[string]*routingCacheEntry)
+	return n
 }
 
 // Size returns the current number of entries.
@@ -148,6 +162,129 @@ func (rc *RoutingCache) Size() int {
 	return len(rc.cache)
 }
 
+// MaxSize returns the current capacity.
+func (rc *RoutingCache) MaxSize() int {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return rc.maxSize
+}
+
+// Resize changes the capacity, evicting the oldest entries if the cache
+// currently holds more than the new limit. Non-positive sizes are ignored.
+func (rc *RoutingCache) Resize(maxSize int) {
+	if maxSize <= 0 {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	old := rc.maxSize
+	rc.maxSize = maxSize
+	evicted := rc.evictOldestN(len(rc.cache) - maxSize)
+	rc.logger.Info("routing cache resized",
+		zap.Int("old_max_size", old),
+		zap.Int("max_size", maxSize),
+		zap.Int("evicted", evicted))
+}
+
+// routingCacheSnapshotEntry is the on-disk form of one cache entry.
+type routingCacheSnapshotEntry struct {
+	Key       string           `json:"key"`
+	TaskType  models.ModelRole `json:"task_type"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+// SaveSnapshot writes all entries to path as JSON. The file is written to a
+// temporary file first and renamed, so a crash never leaves a partial snapshot.
+func (rc *RoutingCache) SaveSnapshot(path string) error {
+	rc.mu.RLock()
+	entries := make([]routingCacheSnapshotEntry, 0, len(rc.cache))
+	for k, v := range rc.cache {
+		entries = append(entries, routingCacheSnapshotEntry{Key: k, TaskType: v.taskType, Timestamp: v.timestamp})
+	}
+	rc.mu.RUnlock()
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("marshal routing cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("create routing cache snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write routing cache snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write routing cache snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename routing cache snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot adds the entries saved by SaveSnapshot, skipping those older
+// than ttlSeconds, and returns how many were loaded. Entries keep their
+// original timestamps, so they expire as if the process never restarted. If
+// the snapshot holds more entries than fit, the newest are kept.
+func (rc *RoutingCache) LoadSnapshot(path string, ttlSeconds int) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var entries []routingCacheSnapshotEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, fmt.Errorf("parse routing cache snapshot: %w", err)
+	}
+
+	ttl := time.Duration(ttlSeconds) * time.Second
+	fresh := entries[:0]
+	for _, e := range entries {
+		if e.Key != "" && time.Since(e.Timestamp) <= ttl {
+			fresh = append(fresh, e)
+		}
+	}
+	sort.Slice(fresh, func(i, j int) bool { return fresh[i].Timestamp.Before(fresh[j].Timestamp) })
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(fresh) > rc.maxSize {
+		fresh = fresh[len(fresh)-rc.maxSize:]
+	}
+	for _, e := range fresh {
+		if _, exists := rc.cache[e.Key]; !exists && len(rc.cache) >= rc.maxSize {
+			rc.evictOldest()
+		}
+		rc.cache[e.Key] = &routingCacheEntry{taskType: e.TaskType, timestamp: e.Timestamp}
+	}
+	return len(fresh), nil
+}
+
+// evictOldestN removes the n oldest entries in one pass and returns how many
+// were removed. Must be called with lock held.
+func (rc *RoutingCache) evictOldestN(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	if n >= len(rc.cache) {
+		n = len(rc.cache)
+		rc.cache = make(map[string]*routingCacheEntry)
+		return n
+	}
+	keys := make([]string, 0, len(rc.cache))
+	for k := range rc.cache {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return rc.cache[keys[i]].timestamp.Before(rc.cache[keys[j]].timestamp) })
+	for _, k := range keys[:n] {
+		delete(rc.cache, k)
+	}
+	return n
+}
+
 // evictOldest removes the oldest entry. Must be called with lock held.
 func (rc *RoutingCache) evictOldest() {
 	if len(rc.cache) == 0 {
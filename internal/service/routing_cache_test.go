@@ -4,6 +4,10 @@
 package service
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -83,6 +87,43 @@ func TestGetCacheKey_NormalizationEffect(t *testing.T) {
 	assert.Equal(t, key1, key3)
 }
 
+func TestGetCacheKey_Truncated(t *testing.T) {
+	prefix := strings.Repeat("x", cacheKeyMaxLen)
+	// Only the first cacheKeyMaxLen bytes are hashed.
+	assert.Equal(t, GetCacheKey("", prefix+"tail one"), GetCacheKey("", prefix+"tail two"))
+	assert.NotEqual(t, GetCacheKey("", prefix[1:]+"a"), GetCacheKey("", prefix[1:]+"b"))
+}
+
+func TestGetCacheKey_IgnoresSystemInjections(t *testing.T) {
+	plain := GetCacheKey("", "fix the failing test")
+	assert.Equal(t, plain, GetCacheKey("", "<system-reminder>Today is Monday.</system-reminder>\nfix the failing test"))
+	assert.Equal(t, plain, GetCacheKey("", "fix the failing test\n<system-reminder>\nTodo list changed: 3 items\n</system-reminder>"))
+
+	// Whole requests differing only in injected reminders, including a long
+	// one inside a tool result, route under the same key.
+	request := func(reminder string, textReminder bool) *models.AnthropicRequest {
+		text := "fix the failing test"
+		if textReminder {
+			text = "<system-reminder>" + reminder + "</system-reminder>\n" + text
+		}
+		return &models.AnthropicRequest{Messages: []models.Message{
+			{Role: "assistant", Content: models.MessageContent{IsArray: true, Parts: []models.ContentPart{
+				{Type: "tool_use", ID: "tu_1", Name: "Bash", Input: map[string]any{"command": "go test ./..."}},
+			}}},
+			{Role: "user", Content: models.MessageContent{IsArray: true, Parts: []models.ContentPart{
+				{Type: "tool_result", ToolUseID: "tu_1", Content: "FAIL TestFoo\n<system-reminder>" + reminder + "</system-reminder>"},
+				{Type: "text", Text: text},
+			}}},
+		}}
+	}
+	for _, textReminder := range []bool{false, true} {
+		first := GetCacheKey("", extractLastUserMessage(request(strings.Repeat("files changed: a.go ", 40), textReminder)))
+		second := GetCacheKey("", extractLastUserMessage(request(strings.Repeat("files changed: b.go ", 40), textReminder)))
+		assert.Equal(t, first, second, "text reminder: %v", textReminder)
+		assert.NotEqual(t, plain, first, "the tool result still counts")
+	}
+}
+
 func TestRoutingCache_SetAndGet(t *testing.T) {
 	cache := NewRoutingCache(100, zap.NewNop())
 
@@ -187,6 +228,56 @@ func TestRoutingCache_Eviction(t *testing.T) {
 	assert.Equal(t, models.ModelRoleSimple, role)
 }
 
+func TestRoutingCache_Resize(t *testing.T) {
+	cache := NewRoutingCache(5, zap.NewNop())
+
+	for _, key := range []string{"key1", "key2", "key3", "key4"} {
+		cache.Set(key, models.ModelRoleSimple)
+		time.Sleep(5 * time.Millisecond)
+	}
+	require.Equal(t, 4, cache.Size())
+
+	// Shrinking evicts the oldest entries down to the new capacity
+	cache.Resize(2)
+	assert.Equal(t, 2, cache.MaxSize())
+	assert.Equal(t, 2, cache.Size())
+	_, found := cache.Get("key1", 300)
+	assert.False(t, found)
+	_, found = cache.Get("key2", 300)
+	assert.False(t, found)
+	_, found = cache.Get("key4", 300)
+	assert.True(t, found)
+
+	// Growing keeps existing entries
+	cache.Resize(10)
+	assert.Equal(t, 10, cache.MaxSize())
+	assert.Equal(t, 2, cache.Size())
+
+	// Non-positive sizes are ignored
+	cache.Resize(0)
+	assert.Equal(t, 10, cache.MaxSize())
+}
+
+func TestRoutingCache_ResizeLarge(t *testing.T) {
+	cache := NewRoutingCache(20000, zap.NewNop())
+	base := time.Now()
+	for i := 0; i < 20000; i++ {
+		cache.cache[fmt.Sprintf("key%d", i)] = &routingCacheEntry{taskType: models.ModelRoleSimple, timestamp: base.Add(time.Duration(i) * time.Millisecond)}
+	}
+
+	cache.Resize(100)
+	assert.Equal(t, 100, cache.Size())
+	_, found := cache.cache["key19899"]
+	assert.False(t, found, "older entries are evicted")
+	_, found = cache.cache["key19900"]
+	assert.True(t, found, "the newest entries are kept")
+
+	cache.Resize(1)
+	assert.Equal(t, 1, cache.Size())
+	_, found = cache.cache["key19999"]
+	assert.True(t, found)
+}
+
 func TestRoutingCache_DefaultMaxSize(t *testing.T) {
 	// Zero or negative maxSize should default to 10000
 	cache := NewRoutingCache(0, zap.NewNop())
@@ -224,3 +315,47 @@ func TestRoutingCache_Concurrent(t *testing.T) {
 	// Should not panic or deadlock
 	assert.True(t, cache.Size() > 0)
 }
+
+func TestRoutingCache_Snapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routing_cache.json")
+
+	cache := NewRoutingCache(100, zap.NewNop())
+	cache.Set("fresh", models.ModelRoleSimple)
+	cache.Set("stale", models.ModelRoleComplex)
+	cache.cache["stale"].timestamp = time.Now().Add(-time.Hour)
+	require.NoError(t, cache.SaveSnapshot(path))
+
+	restored := NewRoutingCache(100, zap.NewNop())
+	n, err := restored.LoadSnapshot(path, 300)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	role, ok := restored.Get("fresh", 300)
+	assert.True(t, ok)
+	assert.Equal(t, models.ModelRoleSimple, role)
+	_, ok = restored.Get("stale", 7200)
+	assert.False(t, ok, "expired entries are dropped on load")
+
+	// Only the newest entries are kept when the snapshot exceeds capacity.
+	small := NewRoutingCache(1, zap.NewNop())
+	cache.cache["stale"].timestamp = time.Now().Add(-time.Minute)
+	require.NoError(t, cache.SaveSnapshot(path))
+	n, err = small.LoadSnapshot(path, 300)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, ok = small.Get("fresh", 300)
+	assert.True(t, ok)
+}
+
+func TestRoutingCache_LoadSnapshot_MissingOrCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewRoutingCache(100, zap.NewNop())
+
+	_, err := cache.LoadSnapshot(filepath.Join(dir, "missing.json"), 300)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	require.NoError(t, os.WriteFile(corrupt, []byte("{not json"), 0o644))
+	_, err = cache.LoadSnapshot(corrupt, 300)
+	assert.Error(t, err)
+	assert.Equal(t, 0, cache.Size())
+}
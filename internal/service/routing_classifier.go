@@ -1,10 +1,13 @@
 package service
 
 import (
+	"fmt"
+	"hash/fnv"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/user/llm-proxy-go/internal/models"
 )
@@ -19,6 +22,8 @@ type ClassifyResult struct {
 
 // RoutingClassifier performs rule-based request classification.
 // Rules are evaluated by priority (highest first); the first match wins.
+// Observe-only rules are evaluated and reported in Matches like the others
+// but never win, so a candidate rule can be measured without routing risk.
 type RoutingClassifier struct {
 	rules           []*models.RoutingRule // sorted by priority desc
 	compiledPatterns map[int64]*regexp.Regexp
@@ -77,6 +82,33 @@ func NewRoutingClassifier(customRules []*models.RoutingRule) *RoutingClassifier
 	}
 }
 
+// ValidateRule checks that a routing rule is usable: it needs a name and a
+// task type, its Pattern must compile and its Condition must parse.
+func ValidateRule(rule *models.RoutingRule) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.TrimSpace(rule.TaskType) == "" {
+		return fmt.Errorf("task_type is required")
+	}
+	if rule.RolloutPercent < 1 || rule.RolloutPercent > 100 {
+		return fmt.Errorf("rollout_percent must be between 1 and 100")
+	}
+	if rule.Pattern != "" {
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	if rule.Condition != "" {
+		// Every sub-expression is evaluated, so an empty message surfaces
+		// syntax errors, unknown functions and bad regexes alike.
+		if _, err := NewConditionParser().Evaluate(rule.Condition, ""); err != nil {
+			return fmt.Errorf("invalid condition: %w", err)
+		}
+	}
+	return nil
+}
+
 // Classify evaluates all rules against the message and returns the highest-priority match.
 func (c *RoutingClassifier) Classify(message string) *ClassifyResult {
 	if message == "" {
@@ -94,6 +126,12 @@ func (c *RoutingClassifier) Classify(message string) *ClassifyResult {
 		if !matched {
 			continue
 		}
+		if inRollout(rule) {
+			if !rolloutSelects(rule, message) {
+				continue
+			}
+			reason = fmt.Sprintf("rollout %d%%, %s", rule.RolloutPercent, reason)
+		}
 
 		hit := &models.RuleHit{
 			RuleID:   rule.ID,
@@ -101,10 +139,11 @@ func (c *RoutingClassifier) Classify(message string) *ClassifyResult {
 			Priority: rule.Priority,
 			TaskType: rule.TaskType,
 			Reason:   reason,
+			Observe:  rule.Observe,
 		}
 		allHits = append(allHits, hit)
 
-		if bestRule == nil {
+		if bestRule == nil && !rule.Observe {
 			bestRule = rule
 		}
 	}
@@ -130,6 +169,69 @@ func (c *RoutingClassifier) TestMessage(message string) *ClassifyResult {
 	return c.Classify(message)
 }
 
+// ConditionTraceResult reports how a rule's condition evaluated against a
+// message, step by step.
+type ConditionTraceResult struct {
+	RuleID    int64           `json:"rule_id"`
+	RuleName  string          `json:"rule_name"`
+	Condition string          `json:"condition"`
+	Result    bool            `json:"result"`
+	Steps     []ConditionStep `json:"steps"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// TraceConditions evaluates the condition of every enabled rule that has
+// one against message, in priority order, recording each sub-clause.
+// It is for debugging rules; Classify never traces.
+func (c *RoutingClassifier) TraceConditions(message string) []*ConditionTraceResult {
+	traces := make([]*ConditionTraceResult, 0)
+	for _, rule := range c.rules {
+		if rule.Condition == "" {
+			continue
+		}
+		ok, steps, err := c.condParser.EvaluateTrace(rule.Condition, message)
+		t := &ConditionTraceResult{
+			RuleID:    rule.ID,
+			RuleName:  rule.Name,
+			Condition: rule.Condition,
+			Result:    ok,
+			Steps:     steps,
+		}
+		if t.Steps == nil {
+			t.Steps = []ConditionStep{}
+		}
+		if err != nil {
+			t.Error = err.Error()
+		}
+		traces = append(traces, t)
+	}
+	return traces
+}
+
+// ClassifyAll classifies messages on up to workers goroutines and returns the
+// results in message order.
+func (c *RoutingClassifier) ClassifyAll(messages []string, workers int) []*ClassifyResult {
+	results := make([]*ClassifyResult, len(messages))
+	workers = max(1, min(workers, len(messages)))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = c.Classify(messages[i])
+			}
+		}()
+	}
+	for i := range messages {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
 // matchRule checks if a single rule matches the message.
 // Returns (matched, reason).
 func (c *RoutingClassifier) matchRule(rule *models.RoutingRule, message string) (bool, string) {
@@ -183,6 +285,22 @@ func (c *RoutingClassifier) matchRule(rule *models.RoutingRule, message string)
 	return false, ""
 }
 
+// inRollout reports whether rule applies to only part of the traffic.
+func inRollout(rule *models.RoutingRule) bool {
+	return rule.RolloutPercent > 0 && rule.RolloutPercent < 100
+}
+
+// rolloutSelects decides whether a message falls inside rule's rollout. The
+// bucket is a hash of the rule name and message, so a message always gets
+// the same treatment while different rules sample independently.
+func rolloutSelects(rule *models.RoutingRule, message string) bool {
+	h := fnv.New32a()
+	h.Write([]byte(rule.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(message))
+	return int(h.Sum32()%100) < rule.RolloutPercent
+}
+
 // buildMatchReason constructs a human-readable reason string.
 func buildMatchReason(rule *models.RoutingRule, hits []*models.RuleHit) string {
 	if len(hits) == 0 {
@@ -4,6 +4,7 @@
 package service
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -337,6 +338,86 @@ func TestRoutingClassifier_CombinedMatching(t *testing.T) {
 	}
 }
 
+func TestRoutingClassifier_Rollout(t *testing.T) {
+	rollout := func(percent int) *RoutingClassifier {
+		return NewRoutingClassifier([]*models.RoutingRule{{
+			ID:             400,
+			Name:           "canary",
+			Keywords:       []string{"canary"},
+			TaskType:       "complex",
+			Priority:       500,
+			Enabled:        true,
+			RolloutPercent: percent,
+		}})
+	}
+
+	matched := func(c *RoutingClassifier, msg string) bool {
+		res := c.Classify(msg)
+		return res.Rule != nil && res.Rule.ID == 400
+	}
+
+	full, none, half := rollout(100), rollout(0), rollout(30)
+	hits := 0
+	for i := 0; i < 1000; i++ {
+		msg := fmt.Sprintf("canary request %d", i)
+		assert.True(t, matched(full, msg))
+		assert.True(t, matched(none, msg), "0 is the unset value and means a full rollout")
+		got := matched(half, msg)
+		assert.Equal(t, got, matched(half, msg), "the same message always gets the same treatment")
+		if got {
+			hits++
+		}
+	}
+	assert.InDelta(t, 300, hits, 60)
+
+	for i := 0; ; i++ {
+		msg := fmt.Sprintf("canary request %d", i)
+		res := half.Classify(msg)
+		if res.Rule == nil || res.Rule.ID != 400 {
+			continue
+		}
+		assert.Equal(t, "rollout 30%, keyword: canary", res.Matches[0].Reason)
+		break
+	}
+	assert.Equal(t, "keyword: canary", full.Classify("canary").Matches[0].Reason)
+}
+
+func TestRoutingClassifier_ObserveRule(t *testing.T) {
+	c := NewRoutingClassifier([]*models.RoutingRule{
+		{ID: 500, Name: "candidate", Keywords: []string{"deploy"}, TaskType: "complex", Priority: 900, Enabled: true, Observe: true},
+		{ID: 501, Name: "deploy_simple", Keywords: []string{"deploy"}, TaskType: "simple", Priority: 10, Enabled: true},
+	})
+
+	res := c.Classify("deploy the service")
+	require.NotNil(t, res.Rule)
+	assert.Equal(t, int64(501), res.Rule.ID, "observe rules never win, even with a higher priority")
+	assert.Equal(t, "simple", res.TaskType)
+	require.Len(t, res.Matches, 2)
+	assert.Equal(t, int64(500), res.Matches[0].RuleID)
+	assert.True(t, res.Matches[0].Observe)
+	assert.False(t, res.Matches[1].Observe)
+
+	only := NewRoutingClassifier([]*models.RoutingRule{
+		{ID: 500, Name: "candidate", Keywords: []string{"zzqx"}, TaskType: "complex", Priority: 900, Enabled: true, Observe: true},
+	})
+	res = only.Classify("zzqx")
+	assert.Nil(t, res.Rule)
+	assert.Equal(t, string(models.ModelRoleDefault), res.TaskType)
+	require.Len(t, res.Matches, 1)
+	assert.True(t, res.Matches[0].Observe)
+}
+
+func TestValidateRule_RolloutPercent(t *testing.T) {
+	rule := &models.RoutingRule{Name: "r", TaskType: "simple", RolloutPercent: 101}
+	assert.ErrorContains(t, ValidateRule(rule), "rollout_percent")
+	rule.RolloutPercent = -1
+	assert.Error(t, ValidateRule(rule))
+	rule.RolloutPercent = 0
+	assert.Error(t, ValidateRule(rule), "0 would read as a full rollout")
+	rule.RolloutPercent = 50
+	assert.NoError(t, ValidateRule(rule))
+}
+
 func TestRoutingClassifier_EmptyMessage(t *testing.T) {
 	classifier := NewRoutingClassifier(nil)
 
@@ -364,3 +445,20 @@ func BenchmarkRoutingClassifier_Classify(b *testing.B) {
 		_ = classifier.Classify(message)
 	}
 }
+
+func TestRoutingClassifier_ClassifyAll(t *testing.T) {
+	classifier := NewRoutingClassifier(nil)
+	messages := []string{"帮我设计一个微服务架构", "列出所有文件", "帮我看看这段代码", ""}
+	for i := 0; i < 50; i++ {
+		messages = append(messages, fmt.Sprintf("翻译第 %d 段", i))
+	}
+
+	for _, workers := range []int{0, 1, 8, 1000} {
+		results := classifier.ClassifyAll(messages, workers)
+		require.Len(t, results, len(messages))
+		for i, msg := range messages {
+			assert.Equal(t, classifier.Classify(msg).TaskType, results[i].TaskType, "workers=%d message %d", workers, i)
+		}
+	}
+	assert.Empty(t, classifier.ClassifyAll(nil, 4))
+}
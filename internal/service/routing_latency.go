@@ -0,0 +1,69 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// RoutingLayer identifies a step of task type inference.
+type RoutingLayer string
+
+const (
+	RoutingLayerRule     RoutingLayer = "rule"        // Rule-based classification
+	RoutingLayerL1       RoutingLayer = "l1"          // In-memory routing cache
+	RoutingLayerL2       RoutingLayer = "l2"          // Persistent exact-match cache
+	RoutingLayerSemantic RoutingLayer = "l2_semantic" // Embedding and nearest-neighbour search
+	RoutingLayerLLM      RoutingLayer = "llm"         // Routing model call, including retries
+)
+
+// routingLayers is the order layers are reported in.
+var routingLayers = []RoutingLayer{RoutingLayerRule, RoutingLayerL1, RoutingLayerL2, RoutingLayerSemantic, RoutingLayerLLM}
+
+// RoutingLayerLatency is the aggregate time spent in one routing layer.
+type RoutingLayerLatency struct {
+	Layer   RoutingLayer `json:"layer"`
+	Count   int64        `json:"count"`
+	TotalMs float64      `json:"total_ms"`
+	AvgMs   float64      `json:"avg_ms"`
+	MaxMs   float64      `json:"max_ms"`
+}
+
+// routingLatency accumulates per-layer durations since startup.
+type routingLatency struct {
+	mu     sync.Mutex
+	layers map[RoutingLayer]*RoutingLayerLatency
+}
+
+func newRoutingLatency() *routingLatency {
+	return &routingLatency{layers: make(map[RoutingLayer]*RoutingLayerLatency)}
+}
+
+func (l *routingLatency) record(layer RoutingLayer, d time.Duration) {
+	ms := float64(d.Microseconds()) / 1000
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.layers[layer]
+	if !ok {
+		s = &RoutingLayerLatency{Layer: layer}
+		l.layers[layer] = s
+	}
+	s.Count++
+	s.TotalMs += ms
+	s.MaxMs = max(s.MaxMs, ms)
+}
+
+// snapshot returns every layer in pipeline order, including unused ones.
+func (l *routingLatency) snapshot() []RoutingLayerLatency {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]RoutingLayerLatency, 0, len(routingLayers))
+	for _, layer := range routingLayers {
+		s := RoutingLayerLatency{Layer: layer}
+		if recorded, ok := l.layers[layer]; ok {
+			s = *recorded
+			s.AvgMs = s.TotalMs / float64(s.Count)
+		}
+		out = append(out, s)
+	}
+	return out
+}
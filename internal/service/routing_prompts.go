@@ -1,6 +1,11 @@
 package service
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/user/llm-proxy-go/internal/models"
+)
 
 // Routing prompt definitions for LLM-based task type inference.
 
@@ -90,6 +95,32 @@ const RoutingSystemPrompt = `你是一个智能路由系统。分析用户请求
 返回有效的 JSON：
 {"task_type": "simple|default|complex", "reason": "简短理由（20字以内）"}`
 
+// BuildRoutingSystemPrompt returns RoutingSystemPrompt extended with the
+// admin-defined roles: each is described after the builtin roles and
+// allowed in the output format.
+func BuildRoutingSystemPrompt(custom []*models.ModelRoleDefinition) string {
+	if len(custom) == 0 {
+		return RoutingSystemPrompt
+	}
+
+	var sections strings.Builder
+	names := make([]string, 0, len(models.BuiltinModelRoles)+len(custom))
+	for _, role := range models.BuiltinModelRoles {
+		names = append(names, string(role))
+	}
+	for _, role := range custom {
+		names = append(names, string(role.Name))
+		description := role.Description
+		if description == "" {
+			description = "管理员自定义角色"
+		}
+		fmt.Fprintf(&sections, "### %s（自定义）\n%s\n\n", role.Name, description)
+	}
+
+	prompt := strings.Replace(RoutingSystemPrompt, "## 判断原则", sections.String()+"## 判断原则", 1)
+	return strings.Replace(prompt, `"simple|default|complex"`, `"`+strings.Join(names, "|")+`"`, 1)
+}
+
 // RoutingUserPromptTemplate is the user prompt template for routing.
 const RoutingUserPromptTemplate = `请分析以下请求并判断任务复杂度：
 
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// Outcomes of a traced routing step.
+const (
+	TraceHit     = "hit"     // The layer produced a decision
+	TraceMiss    = "miss"    // The layer ran but produced no decision
+	TraceSkipped = "skipped" // The layer did not run; Reason says why
+	TraceError   = "error"   // The layer failed
+)
+
+// RoutingTraceStep is the outcome of one routing layer in a dry run.
+// Decisive marks the step whose decision a real request would use; layers
+// after it are still evaluated so the whole pipeline can be inspected.
+type RoutingTraceStep struct {
+	Layer    string                  `json:"layer"` // "rule", "fallback", "l1", "l2", "l2_semantic", "llm"
+	Outcome  string                  `json:"outcome"`
+	Reason   string                  `json:"reason,omitempty"`
+	Decisive bool                    `json:"decisive"`
+	Decision *models.RoutingDecision `json:"decision,omitempty"`
+}
+
+// RoutingTrace is the full decision trace of a dry-run routing request.
+type RoutingTrace struct {
+	TaskType      models.ModelRole        `json:"task_type,omitempty"` // Empty when the routing LLM would decide but was not called
+	Decision      *models.RoutingDecision `json:"decision,omitempty"`
+	RuleMatch     *models.RuleMatchResult `json:"rule_match,omitempty"`
+	CacheKey      string                  `json:"cache_key,omitempty"`
+	RoutingPrompt string                  `json:"routing_prompt,omitempty"`
+	Steps         []RoutingTraceStep      `json:"steps"`
+}
+
+// add appends a step, making it decisive if no earlier step was.
+func (t *RoutingTrace) add(step RoutingTraceStep, decides bool) {
+	if decides && !t.decided() {
+		step.Decisive = true
+		if step.Decision != nil {
+			t.TaskType = step.Decision.TaskType
+			t.Decision = step.Decision
+		} else {
+			t.TaskType = models.ModelRoleDefault
+		}
+	}
+	t.Steps = append(t.Steps, step)
+}
+
+func (t *RoutingTrace) decided() bool {
+	for _, s := range t.Steps {
+		if s.Decisive {
+			return true
+		}
+	}
+	return false
+}
+
+// Trace runs the routing pipeline of InferTaskType as a dry run and reports
+// every layer's outcome. Nothing is written: caches are not populated and
+// rule hit counts are not incremented. The routing LLM is only called when
+// callLLM is set; otherwise the prompt it would receive is returned.
+func (r *LLMRouter) Trace(ctx context.Context, req *models.AnthropicRequest, callLLM bool) (*RoutingTrace, error) {
+	cfg, err := r.configRepo.GetConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get routing config: %w", err)
+	}
+
+	trace := &RoutingTrace{Steps: []RoutingTraceStep{}}
+	systemContent := extractSystemContent(req)
+	userMessage := extractLastUserMessage(req)
+	if userMessage == "" {
+		trace.TaskType = models.ModelRoleDefault
+		return trace, nil
+	}
+
+	// Rules, then the fallback strategy when no rule matches or rule-based
+	// routing is off along with LLM routing.
+	if cfg.RuleBasedRoutingEnabled {
+		customRules, err := r.ruleRepo.ListRules(ctx, true)
+		if err != nil {
+			return nil, fmt.Errorf("list routing rules: %w", err)
+		}
+		result := NewRoutingClassifier(customRules).Classify(userMessage)
+		trace.RuleMatch = &models.RuleMatchResult{
+			Rule:     result.Rule,
+			Matches:  result.Matches,
+			TaskType: result.TaskType,
+			Reason:   result.Reason,
+		}
+		if result.Rule != nil {
+			trace.add(RoutingTraceStep{Layer: "rule", Outcome: TraceHit, Decision: &models.RoutingDecision{
+				TaskType:  r.roles.Parse(result.TaskType),
+				Reason:    result.Reason,
+				CacheType: "rule",
+			}}, true)
+		} else {
+			trace.add(RoutingTraceStep{Layer: "rule", Outcome: TraceMiss, Reason: result.Reason}, false)
+			r.traceFallback(trace, cfg)
+		}
+	} else {
+		trace.add(RoutingTraceStep{Layer: "rule", Outcome: TraceSkipped, Reason: "rule-based routing disabled"}, false)
+		if !cfg.Enabled {
+			r.traceFallback(trace, cfg)
+		}
+	}
+
+	if !cfg.Enabled {
+		for _, layer := range []string{"l1", "l2", "l2_semantic", "llm"} {
+			trace.add(RoutingTraceStep{Layer: layer, Outcome: TraceSkipped, Reason: "LLM routing disabled"}, false)
+		}
+		return trace, nil
+	}
+
+	// Cache layers.
+	trace.CacheKey = GetCacheKey(systemContent, userMessage)
+	if cfg.CacheEnabled {
+		if taskType, hit := r.routingCache.Get(trace.CacheKey, cfg.CacheTTLSeconds); hit {
+			trace.add(RoutingTraceStep{Layer: "l1", Outcome: TraceHit, Decision: &models.RoutingDecision{
+				TaskType:  taskType,
+				FromCache: true,
+				CacheType: "L1",
+			}}, true)
+		} else {
+			trace.add(RoutingTraceStep{Layer: "l1", Outcome: TraceMiss}, false)
+		}
+
+		entry, err := r.embeddingRepo.GetExactMatch(ctx, trace.CacheKey, cfg.CacheTTLSeconds)
+		switch {
+		case err != nil:
+			trace.add(RoutingTraceStep{Layer: "l2", Outcome: TraceError, Reason: err.Error()}, false)
+		case entry != nil:
+			trace.add(RoutingTraceStep{Layer: "l2", Outcome: TraceHit, Decision: &models.RoutingDecision{
+				TaskType:  r.roles.Parse(entry.TaskType),
+				Reason:    entry.Reason,
+				FromCache: true,
+				CacheType: "L2",
+			}}, true)
+		default:
+			trace.add(RoutingTraceStep{Layer: "l2", Outcome: TraceMiss}, false)
+		}
+		r.traceSemantic(ctx, trace, cfg, userMessage)
+	} else {
+		for _, layer := range []string{"l1", "l2", "l2_semantic"} {
+			trace.add(RoutingTraceStep{Layer: layer, Outcome: TraceSkipped, Reason: "routing cache disabled"}, false)
+		}
+	}
+
+	// Routing LLM.
+	trace.RoutingPrompt = BuildRoutingPrompt(systemContent, userMessage)
+	switch {
+	case !callLLM:
+		trace.add(RoutingTraceStep{Layer: "llm", Outcome: TraceSkipped, Reason: "dry run; pass call_llm=true to call the routing model"}, false)
+	case cfg.PrimaryModelID == nil:
+		trace.add(RoutingTraceStep{Layer: "llm", Outcome: TraceError, Reason: "no primary routing model configured"}, true)
+	default:
+		if _, decision := r.callRoutingWithRetry(ctx, cfg, systemContent, userMessage); decision != nil {
+			trace.add(RoutingTraceStep{Layer: "llm", Outcome: TraceHit, Decision: decision}, true)
+		} else {
+			trace.add(RoutingTraceStep{Layer: "llm", Outcome: TraceError, Reason: "all routing attempts failed, using default"}, true)
+		}
+	}
+	return trace, nil
+}
+
+// traceFallback records the fallback strategy step. A strategy that defers
+// to the routing LLM decides nothing unless LLM routing is disabled, in which
+// case the default role is used.
+func (r *LLMRouter) traceFallback(trace *RoutingTrace, cfg *models.RoutingConfig) {
+	_, decision, useLLM := r.handleFallbackStrategy(context.Background(), cfg, nil)
+	switch {
+	case !useLLM:
+		trace.add(RoutingTraceStep{Layer: "fallback", Outcome: TraceHit, Decision: decision}, true)
+	case cfg.Enabled:
+		trace.add(RoutingTraceStep{Layer: "fallback", Outcome: TraceMiss, Reason: "fallback strategy defers to the routing LLM"}, false)
+	default:
+		trace.add(RoutingTraceStep{Layer: "fallback", Outcome: TraceHit, Decision: &models.RoutingDecision{
+			TaskType:  models.ModelRoleDefault,
+			Reason:    "fallback: LLM routing disabled, using default",
+			CacheType: "rule",
+		}}, true)
+	}
+}
+
+// traceSemantic reports the semantic L2 lookup.
+func (r *LLMRouter) traceSemantic(ctx context.Context, trace *RoutingTrace, cfg *models.RoutingConfig, userMessage string) {
+	step := RoutingTraceStep{Layer: "l2_semantic", Outcome: TraceSkipped}
+	switch {
+	case !cfg.SemanticCacheEnabled:
+		step.Reason = "semantic cache disabled"
+	case r.embeddingSvc == nil:
+		step.Reason = "no embedding service"
+	default:
+		embedding, match := r.semanticLookup(ctx, cfg, routingCachePreview(userMessage))
+		switch {
+		case embedding == nil:
+			step.Reason = "embedding unavailable"
+		case match != nil:
+			trace.add(RoutingTraceStep{Layer: "l2_semantic", Outcome: TraceHit, Decision: &models.RoutingDecision{
+				TaskType:  r.roles.Parse(match.TaskType),
+				Reason:    match.Reason,
+				FromCache: true,
+				CacheType: "L2-semantic",
+			}}, true)
+			return
+		default:
+			step.Outcome = TraceMiss
+		}
+	}
+	trace.add(step, false)
+}
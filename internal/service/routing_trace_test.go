@@ -0,0 +1,106 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+func traceRequest(text string) *models.AnthropicRequest {
+	return &models.AnthropicRequest{
+		Messages: []models.Message{{Role: "user", Content: models.MessageContent{Text: text}}},
+	}
+}
+
+func traceLayers(trace *RoutingTrace) map[string]RoutingTraceStep {
+	steps := make(map[string]RoutingTraceStep, len(trace.Steps))
+	for _, s := range trace.Steps {
+		steps[s.Layer] = s
+	}
+	return steps
+}
+
+func TestLLMRouter_Trace_RuleMatch(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	router := NewLLMRouter(db, nil, nil, zap.NewNop())
+
+	trace, err := router.Trace(t.Context(), traceRequest("帮我设计一个微服务架构"), false)
+	require.NoError(t, err)
+	assert.Equal(t, models.ModelRoleComplex, trace.TaskType)
+	require.NotNil(t, trace.RuleMatch)
+	require.NotNil(t, trace.RuleMatch.Rule)
+	assert.NotEmpty(t, trace.RuleMatch.Matches)
+
+	steps := traceLayers(trace)
+	assert.Equal(t, TraceHit, steps["rule"].Outcome)
+	assert.True(t, steps["rule"].Decisive)
+	assert.NotContains(t, steps, "fallback")
+	assert.Equal(t, TraceSkipped, steps["llm"].Outcome)
+}
+
+func TestLLMRouter_Trace_LLMLayers(t *testing.T) {
+	db := testutil.NewTestDB(t)
+
+	var calls atomic.Int32
+	routingLLM := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"{\"task_type\":\"simple\",\"reason\":\"greeting\"}"}}]}`)
+	}))
+	defer routingLLM.Close()
+
+	_, err := db.Exec(`INSERT INTO providers (id, name, base_url, api_key) VALUES (1, 'router', ?, 'k')`, routingLLM.URL)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO routing_models (id, provider_id, model_name) VALUES (1, 1, 'router-model')`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO routing_llm_config (id, enabled, primary_model_id, rule_fallback_strategy, timeout_seconds)
+		VALUES (1, 1, 1, 'llm', 5)`)
+	require.NoError(t, err)
+
+	router := NewLLMRouter(db, nil, nil, zap.NewNop())
+
+	// Dry run: the pipeline reaches the LLM, which is not called.
+	trace, err := router.Trace(t.Context(), traceRequest("Hello there"), false)
+	require.NoError(t, err)
+	assert.Empty(t, trace.TaskType)
+	assert.Nil(t, trace.Decision)
+	assert.Contains(t, trace.RoutingPrompt, "Hello there")
+	steps := traceLayers(trace)
+	assert.Equal(t, TraceMiss, steps["rule"].Outcome)
+	assert.Equal(t, TraceMiss, steps["fallback"].Outcome)
+	assert.Equal(t, TraceMiss, steps["l1"].Outcome)
+	assert.Equal(t, TraceMiss, steps["l2"].Outcome)
+	assert.Equal(t, TraceSkipped, steps["llm"].Outcome)
+	assert.Zero(t, calls.Load())
+
+	// With call_llm the routing model decides, but nothing is cached.
+	trace, err = router.Trace(t.Context(), traceRequest("Hello there"), true)
+	require.NoError(t, err)
+	assert.Equal(t, models.ModelRoleSimple, trace.TaskType)
+	require.NotNil(t, trace.Decision)
+	assert.Equal(t, "router-model", trace.Decision.ModelUsed)
+	assert.True(t, traceLayers(trace)["llm"].Decisive)
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Zero(t, router.routingCache.Size())
+
+	// An L1 entry decides; later layers are still reported.
+	router.routingCache.Set(trace.CacheKey, models.ModelRoleComplex)
+	trace, err = router.Trace(t.Context(), traceRequest("Hello there"), false)
+	require.NoError(t, err)
+	assert.Equal(t, models.ModelRoleComplex, trace.TaskType)
+	steps = traceLayers(trace)
+	assert.True(t, steps["l1"].Decisive)
+	assert.False(t, steps["l2"].Decisive)
+	assert.Equal(t, TraceSkipped, steps["llm"].Outcome)
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+// ruleJanitorInterval is how often the janitor re-evaluates idle rules.
+const ruleJanitorInterval = time.Hour
+
+// RuleJanitor flags custom routing rules that have not matched any request
+// within the idle window, and optionally disables them after a grace period.
+// Builtin rules are never touched. Editing a rule restarts its idle window.
+type RuleJanitor struct {
+	repo   *repository.RoutingRuleRepo
+	cfg    config.RuleJanitorConfig
+	logger *zap.Logger
+	now    func() time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRuleJanitor creates a RuleJanitor. It returns nil when IdleDays is not
+// positive; a nil janitor reports no idle rules.
+func NewRuleJanitor(repo *repository.RoutingRuleRepo, cfg config.RuleJanitorConfig, logger *zap.Logger) *RuleJanitor {
+	if cfg.IdleDays <= 0 {
+		return nil
+	}
+	return &RuleJanitor{repo: repo, cfg: cfg, logger: logger, now: time.Now}
+}
+
+// IdleRules returns the enabled custom rules that are idle, without
+// modifying anything.
+func (j *RuleJanitor) IdleRules(ctx context.Context) ([]models.IdleRule, error) {
+	if j == nil {
+		return nil, nil
+	}
+	idle := time.Duration(j.cfg.IdleDays) * 24 * time.Hour
+	rules, err := j.repo.ListIdleCustomRules(ctx, j.now().Add(-idle))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.IdleRule, 0, len(rules))
+	for _, rule := range rules {
+		idleSince := rule.UpdatedAt
+		if rule.LastHitAt != nil && rule.LastHitAt.After(idleSince) {
+			idleSince = *rule.LastHitAt
+		}
+		ir := models.IdleRule{
+			ID:        rule.ID,
+			Name:      rule.Name,
+			HitCount:  rule.HitCount,
+			LastHitAt: rule.LastHitAt,
+			IdleSince: idleSince,
+		}
+		if j.cfg.AutoDisable {
+			disableAt := idleSince.Add(idle + time.Duration(j.cfg.GraceDays)*24*time.Hour)
+			ir.DisableAt = &disableAt
+		}
+		result = append(result, ir)
+	}
+	return result, nil
+}
+
+// Run flags idle rules and, when auto-disable is on, disables those whose
+// grace period has elapsed.
+func (j *RuleJanitor) Run(ctx context.Context) ([]models.IdleRule, error) {
+	if j == nil {
+		return nil, nil
+	}
+	rules, err := j.IdleRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := j.now()
+	for i := range rules {
+		rule := &rules[i]
+		if rule.DisableAt == nil || now.Before(*rule.DisableAt) {
+			continue
+		}
+		if err := j.repo.UpdateRule(ctx, rule.ID, map[string]any{"enabled": false}); err != nil {
+			j.logger.Warn("failed to disable idle routing rule",
+				zap.Int64("rule_id", rule.ID), zap.Error(err))
+			continue
+		}
+		rule.Disabled = true
+		j.logger.Info("disabled idle routing rule",
+			zap.Int64("rule_id", rule.ID),
+			zap.String("name", rule.Name),
+			zap.Time("idle_since", rule.IdleSince))
+	}
+	if len(rules) > 0 {
+		j.logger.Info("idle routing rules found", zap.Int("count", len(rules)))
+	}
+	return rules, nil
+}
+
+// Start runs the janitor immediately and then every hour until Stop.
+func (j *RuleJanitor) Start() {
+	if j == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	j.done = make(chan struct{})
+
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(ruleJanitorInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := j.Run(ctx); err != nil && ctx.Err() == nil {
+				j.logger.Warn("rule janitor run failed", zap.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop halts the janitor.
+func (j *RuleJanitor) Stop() {
+	if j == nil || j.cancel == nil {
+		return
+	}
+	j.cancel()
+	<-j.done
+}
@@ -0,0 +1,86 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+func TestRuleJanitor_IdleRules(t *testing.T) {
+	db := testutil.NewTestDB(t)
+	repo := repository.NewRoutingRuleRepository(db, zap.NewNop())
+	ctx := context.Background()
+
+	addRule := func(name string, builtin bool) int64 {
+		id, err := repo.AddRule(ctx, &models.RoutingRule{
+			Name:      name,
+			Keywords:  []string{name},
+			TaskType:  "simple",
+			IsBuiltin: builtin,
+			Enabled:   true,
+		})
+		require.NoError(t, err)
+		return id
+	}
+	idleID := addRule("idle_custom", false)
+	activeID := addRule("active_custom", false)
+	builtinID := addRule("idle_builtin", true)
+
+	// Backdate every rule well past the idle window.
+	_, err := db.ExecContext(ctx, `UPDATE routing_rules
+		SET created_at = datetime('now', '-60 days'), updated_at = datetime('now', '-60 days')`)
+	require.NoError(t, err)
+	require.NoError(t, repo.IncrementHitCount(ctx, activeID))
+
+	cfg := config.RuleJanitorConfig{IdleDays: 30, GraceDays: 7}
+
+	t.Run("advisory only", func(t *testing.T) {
+		janitor := NewRuleJanitor(repo, cfg, zap.NewNop())
+		idle, err := janitor.Run(ctx)
+		require.NoError(t, err)
+		require.Len(t, idle, 1)
+		assert.Equal(t, idleID, idle[0].ID)
+		assert.Nil(t, idle[0].DisableAt)
+		assert.False(t, idle[0].Disabled)
+
+		rule, err := repo.GetRule(ctx, idleID)
+		require.NoError(t, err)
+		assert.True(t, rule.Enabled)
+	})
+
+	t.Run("auto disable after grace period", func(t *testing.T) {
+		autoCfg := cfg
+		autoCfg.AutoDisable = true
+		janitor := NewRuleJanitor(repo, autoCfg, zap.NewNop())
+		idle, err := janitor.Run(ctx)
+		require.NoError(t, err)
+		require.Len(t, idle, 1)
+		assert.True(t, idle[0].Disabled)
+		require.NotNil(t, idle[0].DisableAt)
+
+		enabled := map[int64]bool{idleID: false, activeID: true, builtinID: true}
+		for id, want := range enabled {
+			rule, err := repo.GetRule(ctx, id)
+			require.NoError(t, err)
+			assert.Equal(t, want, rule.Enabled, "rule %s", rule.Name)
+		}
+	})
+
+	t.Run("disabled janitor", func(t *testing.T) {
+		janitor := NewRuleJanitor(repo, config.RuleJanitorConfig{}, zap.NewNop())
+		assert.Nil(t, janitor)
+		idle, err := janitor.IdleRules(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, idle)
+	})
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	// semanticIndexSize bounds the embeddings a semantic lookup compares
+	// against: the newest entries of the L2 cache, not the whole table.
+	semanticIndexSize = 2000
+	// semanticIndexRefresh is how often the index is reloaded, picking up
+	// entries saved by other workers and dropping cleared ones.
+	semanticIndexRefresh = 30 * time.Second
+)
+
+// semanticIndex holds the newest L2 cache embeddings in memory so a semantic
+// lookup is a bounded in-memory scan instead of a full table read. After the
+// first load it is refreshed in the background; lookups use the last
+// snapshot meanwhile.
+type semanticIndex struct {
+	repo   *repository.EmbeddingCacheRepository
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu         sync.RWMutex
+	entries    []*repository.EmbeddingCacheEntry // Newest first
+	ttlSeconds int                               // TTL entries were loaded with
+	loadedAt   time.Time
+	loading    atomic.Bool
+}
+
+func newSemanticIndex(repo *repository.EmbeddingCacheRepository, logger *zap.Logger) *semanticIndex {
+	return &semanticIndex{repo: repo, logger: logger, now: time.Now}
+}
+
+// lookup returns the entry within ttlSeconds most similar to embedding at or
+// above threshold, or nil.
+func (ix *semanticIndex) lookup(ctx context.Context, ttlSeconds int, embedding []float64, threshold float64) *repository.EmbeddingCacheEntry {
+	if ttlSeconds <= 0 {
+		return nil
+	}
+	ix.refresh(ctx, ttlSeconds)
+
+	ix.mu.RLock()
+	entries := ix.entries
+	ix.mu.RUnlock()
+
+	cutoff := ix.now().Add(-time.Duration(ttlSeconds) * time.Second)
+	var best *repository.EmbeddingCacheEntry
+	var bestSimilarity float64
+	for _, entry := range entries {
+		if !entry.CreatedAt.IsZero() && entry.CreatedAt.Before(cutoff) {
+			continue
+		}
+		similarity := cosineSimilarity(embedding, entry.Embedding)
+		if similarity >= threshold && similarity > bestSimilarity {
+			best, bestSimilarity = entry, similarity
+		}
+	}
+	return best
+}
+
+// add makes a newly saved entry visible before the next refresh, replacing
+// any entry with the same content hash.
+func (ix *semanticIndex) add(entry *repository.EmbeddingCacheEntry) {
+	if len(entry.Embedding) == 0 {
+		return
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	entries := make([]*repository.EmbeddingCacheEntry, 0, min(len(ix.entries)+1, semanticIndexSize))
+	entries = append(entries, entry)
+	for _, e := range ix.entries {
+		if len(entries) == semanticIndexSize {
+			break
+		}
+		if e.ContentHash != entry.ContentHash {
+			entries = append(entries, e)
+		}
+	}
+	ix.entries = entries
+}
+
+// refresh loads the index when it is stale or was loaded with another TTL.
+// The first load happens inline; later ones run in the background, one at a
+// time.
+func (ix *semanticIndex) refresh(ctx context.Context, ttlSeconds int) {
+	ix.mu.RLock()
+	loadedAt, loadedTTL := ix.loadedAt, ix.ttlSeconds
+	ix.mu.RUnlock()
+	if !loadedAt.IsZero() && loadedTTL == ttlSeconds && ix.now().Sub(loadedAt) < semanticIndexRefresh {
+		return
+	}
+	if !ix.loading.CompareAndSwap(false, true) {
+		return
+	}
+	if loadedAt.IsZero() {
+		defer ix.loading.Store(false)
+		ix.load(ctx, ttlSeconds)
+		return
+	}
+	go func() {
+		defer ix.loading.Store(false)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		ix.load(ctx, ttlSeconds)
+	}()
+}
+
+func (ix *semanticIndex) load(ctx context.Context, ttlSeconds int) {
+	entries, err := ix.repo.FindRecentEmbeddings(ctx, ttlSeconds, semanticIndexSize)
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	// A failed load keeps the last snapshot and is retried after the
+	// refresh interval rather than on every lookup.
+	ix.loadedAt = ix.now()
+	ix.ttlSeconds = ttlSeconds
+	if err != nil {
+		ix.logger.Warn("semantic cache index load failed", zap.Error(err))
+		return
+	}
+	ix.entries = entries
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+// maxShadowInFlight bounds the mirrored requests running at once; samples
+// beyond it are dropped so mirroring never piles up behind a slow provider.
+const maxShadowInFlight = 16
+
+// ShadowMirror picks the shadow endpoints a successful request is mirrored
+// to and records the outcome. Shadow providers are providers marked shadow:
+// they never serve clients and receive a copy of their shadow_sample_rate
+// fraction of the requests for models they serve.
+type ShadowMirror struct {
+	endpoints func() []*models.Endpoint // Current shadow endpoints
+	repo      *repository.ShadowLogRepository
+	logger    *zap.Logger
+	slots     chan struct{}
+	sample    func() float64 // Uniform in [0, 1)
+}
+
+// NewShadowMirror creates a ShadowMirror mirroring to the endpoints returned
+// by endpoints, e.g. EndpointStore.GetShadowEndpoints.
+func NewShadowMirror(endpoints func() []*models.Endpoint, repo *repository.ShadowLogRepository, logger *zap.Logger) *ShadowMirror {
+	return &ShadowMirror{
+		endpoints: endpoints,
+		repo:      repo,
+		logger:    logger,
+		slots:     make(chan struct{}, maxShadowInFlight),
+		sample: func() float64 {
+			rngMu.Lock()
+			defer rngMu.Unlock()
+			return rng.Float64()
+		},
+	}
+}
+
+// targets returns the shadow endpoints serving model that sampled this
+// request.
+func (m *ShadowMirror) targets(model string) []*models.Endpoint {
+	var out []*models.Endpoint
+	for _, ep := range m.endpoints() {
+		if ep.Model.Name == model && m.sample() < ep.Provider.ShadowSampleRate {
+			out = append(out, ep)
+		}
+	}
+	return out
+}
+
+// SetShadowMirror mirrors sampled non-streaming requests to shadow providers
+// (nil disables mirroring).
+func (s *ProxyService) SetShadowMirror(m *ShadowMirror) {
+	s.shadow = m
+}
+
+// mirrorToShadows fires a copy of a request that succeeded on primary at
+// the sampled shadow endpoints. It returns at once; the copies run in the
+// background and their responses only reach the shadow log.
+func (s *ProxyService) mirrorToShadows(req *models.AnthropicRequest, headers http.Header, primary *models.Endpoint, resp *models.AnthropicResponse, meta *ProxyMetadata) {
+	if s.shadow == nil {
+		return
+	}
+	for _, ep := range s.shadow.targets(primary.Model.Name) {
+		select {
+		case s.shadow.slots <- struct{}{}:
+		default:
+			s.logger.Debug("shadow request dropped, too many in flight",
+				zap.String("request_id", meta.RequestID),
+				zap.String("shadow_endpoint", EndpointName(ep)))
+			continue
+		}
+		shadowReq := *req
+		go func(ep *models.Endpoint) {
+			defer func() { <-s.shadow.slots }()
+			s.runShadow(&shadowReq, headers.Clone(), primary, ep, resp, meta)
+		}(ep)
+	}
+}
+
+// runShadow sends one mirrored request and logs how it compares with the
+// primary response.
+func (s *ProxyService) runShadow(req *models.AnthropicRequest, headers http.Header, primary, ep *models.Endpoint, primaryResp *models.AnthropicResponse, primaryMeta *ProxyMetadata) {
+	start := time.Now()
+	resp, meta, err := s.proxyToEndpoint(context.Background(), req, headers, ep, primaryMeta.RequestID, start, 0)
+
+	entry := &models.ShadowLog{
+		RequestID:        primaryMeta.RequestID,
+		ModelName:        ep.Model.Name,
+		PrimaryEndpoint:  EndpointName(primary),
+		ShadowEndpoint:   EndpointName(ep),
+		RoutingMethod:    "shadow",
+		LatencyMs:        msSince(start),
+		PrimaryLatencyMs: primaryMeta.LatencyMs,
+		PrimaryCost:      primaryMeta.Cost,
+	}
+	var ue *UpstreamError
+	switch {
+	case err == nil:
+		entry.StatusCode = http.StatusOK
+		entry.Success = true
+		entry.LatencyMs = meta.LatencyMs
+		entry.InputTokens, entry.OutputTokens = meta.InputTokens, meta.OutputTokens
+		entry.Cost = meta.Cost
+		entry.DiffSummary = shadowDiffSummary(primaryResp, resp)
+	case errors.As(err, &ue):
+		entry.StatusCode = ue.StatusCode
+		entry.ErrorMessage = truncateStr(ue.Error(), 500)
+	default:
+		entry.ErrorMessage = truncateStr(err.Error(), 500)
+	}
+
+	s.logger.Info("shadow request completed",
+		zap.String("request_id", entry.RequestID),
+		zap.String("routing_method", entry.RoutingMethod),
+		zap.String("shadow_endpoint", entry.ShadowEndpoint),
+		zap.Int("status_code", entry.StatusCode),
+		zap.Float64("latency_ms", entry.LatencyMs),
+		zap.Float64("cost", entry.Cost),
+		zap.String("diff", entry.DiffSummary))
+
+	if s.shadow.repo == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := s.shadow.repo.Insert(ctx, entry); err != nil {
+		s.logger.Warn("failed to save shadow log", zap.String("request_id", entry.RequestID), zap.Error(err))
+	}
+}
+
+// shadowDiffSummary describes how a shadow response differs from the
+// primary one: text similarity, stop reason and tools called.
+func shadowDiffSummary(primary, shadow *models.AnthropicResponse) string {
+	pText, sText := responseText(primary), responseText(shadow)
+	var parts []string
+	if pText == sText {
+		parts = append(parts, "identical text")
+	} else {
+		parts = append(parts, fmt.Sprintf("text similarity %.2f (%d vs %d chars)",
+			wordSimilarity(pText, sText), len([]rune(pText)), len([]rune(sText))))
+	}
+	if primary.StopReason != shadow.StopReason {
+		parts = append(parts, fmt.Sprintf("stop_reason %s vs %s", primary.StopReason, shadow.StopReason))
+	}
+	if pTools, sTools := responseTools(primary), responseTools(shadow); !slices.Equal(pTools, sTools) {
+		parts = append(parts, fmt.Sprintf("tools [%s] vs [%s]", strings.Join(pTools, ", "), strings.Join(sTools, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// responseText joins the text blocks of a response.
+func responseText(resp *models.AnthropicResponse) string {
+	var b strings.Builder
+	for _, part := range resp.Content {
+		if part.Type == "text" {
+			b.WriteString(part.Text)
+		}
+	}
+	return b.String()
+}
+
+// responseTools lists the tools a response calls, in order.
+func responseTools(resp *models.AnthropicResponse) []string {
+	var names []string
+	for _, part := range resp.Content {
+		if part.Type == "tool_use" {
+			names = append(names, part.Name)
+		}
+	}
+	return names
+}
+
+// wordSimilarity is the Jaccard similarity of the two texts' word sets.
+func wordSimilarity(a, b string) float64 {
+	aWords, bWords := wordSet(a), wordSet(b)
+	if len(aWords) == 0 && len(bWords) == 0 {
+		return 1
+	}
+	shared := 0
+	for w := range aWords {
+		if _, ok := bWords[w]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(aWords)+len(bWords)-shared)
+}
+
+func wordSet(s string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, w := range strings.Fields(strings.ToLower(s)) {
+		set[w] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,107 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"github.com/user/llm-proxy-go/tests/testutil"
+	"go.uber.org/zap"
+)
+
+func textResponseServer(t *testing.T, text string, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.AnthropicResponse{
+			ID:         "msg_1",
+			Type:       "message",
+			Role:       "assistant",
+			Content:    []models.ContentPart{{Type: "text", Text: text}},
+			StopReason: "end_turn",
+			Usage:      models.Usage{InputTokens: 10, OutputTokens: 5},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProxyService_ShadowMirror(t *testing.T) {
+	var primaryCalls, shadowCalls, pausedCalls atomic.Int32
+	primarySrv := textResponseServer(t, "the answer is four", &primaryCalls)
+	shadowSrv := textResponseServer(t, "the answer is 4", &shadowCalls)
+	pausedSrv := textResponseServer(t, "unused", &pausedCalls)
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+
+	primary := createProxyTestEndpoint(primarySrv.URL)
+	shadow := createProxyTestEndpoint(shadowSrv.URL)
+	shadow.Provider = &models.Provider{ID: 2, Name: "candidate", BaseURL: shadowSrv.URL, Enabled: true, Shadow: true, ShadowSampleRate: 1}
+	paused := createProxyTestEndpoint(pausedSrv.URL)
+	paused.Provider = &models.Provider{ID: 3, Name: "paused", BaseURL: pausedSrv.URL, Enabled: true, Shadow: true}
+	registerHealthyEndpoints(hc, []*models.Endpoint{primary})
+
+	repo := repository.NewShadowLogRepository(testutil.NewTestDB(t))
+	ps.SetShadowMirror(NewShadowMirror(func() []*models.Endpoint {
+		return []*models.Endpoint{shadow, paused}
+	}, repo, logger))
+
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "2+2?"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: primary, Model: primary.Model, TaskType: primary.Model.Role}
+	resp, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{primary})
+	require.NoError(t, err)
+	assert.Equal(t, "the answer is four", resp.Content[0].Text, "the client only sees the primary response")
+	assert.Equal(t, "test-provider", meta.SelectedEndpoint)
+
+	var logs []*models.ShadowLog
+	require.Eventually(t, func() bool {
+		logs, _, err = repo.List(context.Background(), 10, 0)
+		return err == nil && len(logs) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	l := logs[0]
+	assert.Equal(t, meta.RequestID, l.RequestID)
+	assert.Equal(t, "shadow", l.RoutingMethod)
+	assert.Equal(t, "test-provider/claude-3-sonnet", l.PrimaryEndpoint)
+	assert.Equal(t, "candidate/claude-3-sonnet", l.ShadowEndpoint)
+	assert.True(t, l.Success)
+	assert.Equal(t, 5, l.OutputTokens)
+	assert.Greater(t, l.Cost, 0.0)
+	assert.Contains(t, l.DiffSummary, "text similarity 0.60")
+
+	assert.EqualValues(t, 1, primaryCalls.Load())
+	assert.EqualValues(t, 1, shadowCalls.Load())
+	assert.Zero(t, pausedCalls.Load(), "a zero sample rate mirrors nothing")
+}
+
+func TestShadowDiffSummary(t *testing.T) {
+	text := func(s, stop string) *models.AnthropicResponse {
+		return &models.AnthropicResponse{Content: []models.ContentPart{{Type: "text", Text: s}}, StopReason: stop}
+	}
+
+	assert.Equal(t, "identical text", shadowDiffSummary(text("same", "end_turn"), text("same", "end_turn")))
+	assert.Equal(t, "text similarity 0.50 (3 vs 7 chars); stop_reason end_turn vs max_tokens",
+		shadowDiffSummary(text("a b", "end_turn"), text("a b c d", "max_tokens")))
+
+	tool := &models.AnthropicResponse{Content: []models.ContentPart{{Type: "tool_use", Name: "search"}}, StopReason: "tool_use"}
+	assert.Equal(t, "text similarity 0.00 (4 vs 0 chars); stop_reason end_turn vs tool_use; tools [] vs [search]",
+		shadowDiffSummary(text("done", "end_turn"), tool))
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	// statsCacheMaxEntries caps how many filter sets are cached at once.
+	statsCacheMaxEntries = 256
+	// statsCacheMaxStaleTTLs is how many TTLs old an entry may get and still
+	// be served while it refreshes; older entries are queried afresh.
+	statsCacheMaxStaleTTLs = 10
+	// statsRefreshTimeout caps a background refresh, like the handler's log
+	// query timeout caps a foreground one.
+	statsRefreshTimeout = 10 * time.Second
+)
+
+// StatsFilter is the filter set of a request log statistics query.
+type StatsFilter struct {
+	StartTime, EndTime *time.Time
+	Model, Endpoint    *string
+	Success            *bool
+}
+
+// key identifies the filter set in the cache.
+func (f StatsFilter) key() string {
+	timeKey := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	strKey := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return fmt.Sprintf("%q", *s)
+	}
+	successKey := ""
+	if f.Success != nil {
+		successKey = fmt.Sprint(*f.Success)
+	}
+	return timeKey(f.StartTime) + "|" + timeKey(f.EndTime) + "|" + strKey(f.Model) + "|" + strKey(f.Endpoint) + "|" + successKey
+}
+
+// StatsCache keeps request log statistics in memory for a short TTL, keyed
+// by filter set, so dashboards polling /api/logs/stats do not rescan the
+// request log on every hit. It serves stale-while-revalidate: an entry past
+// its TTL is still returned while one background query refreshes it, unless
+// it is too old, in which case the caller waits for a fresh query. The cache
+// is per worker.
+type StatsCache struct {
+	repo   repository.RequestLogRepository
+	ttl    time.Duration
+	now    func() time.Time
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	entries map[string]*statsCacheEntry
+}
+
+// statsCacheEntry is the cached statistics of one filter set.
+type statsCacheEntry struct {
+	stats      *repository.LogStatistics
+	fetched    time.Time
+	refreshing bool
+}
+
+// NewStatsCache creates a StatsCache. It returns nil, meaning no caching,
+// when the TTL is 0.
+func NewStatsCache(repo repository.RequestLogRepository, cfg config.StatsCacheConfig, logger *zap.Logger) *StatsCache {
+	if cfg.TTLSeconds <= 0 {
+		return nil
+	}
+	return &StatsCache{
+		repo:    repo,
+		ttl:     time.Duration(cfg.TTLSeconds) * time.Second,
+		now:     time.Now,
+		logger:  logger,
+		entries: make(map[string]*statsCacheEntry),
+	}
+}
+
+// Get returns the statistics for filter, from the cache when possible.
+// fresh skips the cache and stores the result of a new query.
+func (c *StatsCache) Get(ctx context.Context, filter StatsFilter, fresh bool) (*repository.LogStatistics, error) {
+	key := filter.key()
+	if !fresh {
+		c.mu.Lock()
+		e, ok := c.entries[key]
+		age := time.Duration(0)
+		if ok {
+			age = c.now().Sub(e.fetched)
+		}
+		switch {
+		case ok && age <= c.ttl:
+			c.mu.Unlock()
+			c.logger.Debug("stats cache hit", zap.String("filter", key), zap.Duration("age", age))
+			return e.stats, nil
+		case ok && age <= c.ttl*statsCacheMaxStaleTTLs:
+			refresh := !e.refreshing
+			e.refreshing = true
+			c.mu.Unlock()
+			c.logger.Debug("stats cache stale", zap.String("filter", key), zap.Duration("age", age), zap.Bool("refreshing", refresh))
+			if refresh {
+				go c.refresh(key, filter)
+			}
+			return e.stats, nil
+		}
+		c.mu.Unlock()
+	}
+
+	c.logger.Debug("stats cache miss", zap.String("filter", key), zap.Bool("fresh", fresh))
+	stats, err := c.query(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	c.store(key, stats)
+	return stats, nil
+}
+
+// Len returns the number of cached filter sets.
+func (c *StatsCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// refresh replaces the entry of key with a new query. On failure the stale
+// entry is kept and the next request past its TTL tries again.
+func (c *StatsCache) refresh(key string, filter StatsFilter) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsRefreshTimeout)
+	defer cancel()
+	stats, err := c.query(ctx, filter)
+	if err != nil {
+		c.logger.Warn("failed to refresh cached statistics", zap.String("filter", key), zap.Error(err))
+		c.mu.Lock()
+		if e, ok := c.entries[key]; ok {
+			e.refreshing = false
+		}
+		c.mu.Unlock()
+		return
+	}
+	c.store(key, stats)
+}
+
+// store caches stats for key, making room by dropping the oldest entry.
+func (c *StatsCache) store(key string, stats *repository.LogStatistics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= statsCacheMaxEntries {
+		var oldestKey string
+		var oldest time.Time
+		for k, e := range c.entries {
+			if oldestKey == "" || e.fetched.Before(oldest) {
+				oldestKey, oldest = k, e.fetched
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+	c.entries[key] = &statsCacheEntry{stats: stats, fetched: c.now()}
+}
+
+// query runs the statistics query for filter.
+func (c *StatsCache) query(ctx context.Context, filter StatsFilter) (*repository.LogStatistics, error) {
+	return c.repo.GetStatistics(ctx, filter.StartTime, filter.EndTime, nil, filter.Model, filter.Endpoint, filter.Success)
+}
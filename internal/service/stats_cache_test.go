@@ -0,0 +1,77 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+// countingStatsRepo answers GetStatistics with the number of queries run.
+type countingStatsRepo struct {
+	repository.RequestLogRepository
+	queries atomic.Int64
+	fail    atomic.Bool
+}
+
+func (r *countingStatsRepo) GetStatistics(ctx context.Context, startTime, endTime *time.Time, userID *int64, modelName, endpointName *string, success *bool) (*repository.LogStatistics, error) {
+	n := r.queries.Add(1)
+	if r.fail.Load() {
+		return nil, errors.New("database is locked")
+	}
+	return &repository.LogStatistics{TotalRequests: n}, nil
+}
+
+func TestStatsCache_StaleWhileRevalidate(t *testing.T) {
+	repo := &countingStatsRepo{}
+	c := NewStatsCache(repo, config.StatsCacheConfig{TTLSeconds: 30}, zap.NewNop())
+	require.NotNil(t, c)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+	get := func(filter StatsFilter, fresh bool) int64 {
+		stats, err := c.Get(ctx, filter, fresh)
+		require.NoError(t, err)
+		return stats.TotalRequests
+	}
+
+	assert.Equal(t, int64(1), get(StatsFilter{}, false), "miss")
+	assert.Equal(t, int64(1), get(StatsFilter{}, false), "hit")
+
+	model := "claude-sonnet-4"
+	assert.Equal(t, int64(2), get(StatsFilter{Model: &model}, false), "filter sets are cached separately")
+
+	// Past the TTL the stale stats are served while one refresh runs.
+	now = now.Add(31 * time.Second)
+	assert.Equal(t, int64(1), get(StatsFilter{}, false))
+	require.Eventually(t, func() bool { return get(StatsFilter{}, false) == 3 }, time.Second, time.Millisecond)
+	assert.Equal(t, int64(3), repo.queries.Load(), "only one background refresh")
+
+	// fresh bypasses the cache and updates it.
+	assert.Equal(t, int64(4), get(StatsFilter{}, true))
+	assert.Equal(t, int64(4), get(StatsFilter{}, false))
+
+	// Entries far past the TTL are not served at all.
+	now = now.Add(time.Hour)
+	assert.Equal(t, int64(5), get(StatsFilter{}, false))
+
+	// A failed refresh keeps the stale entry.
+	repo.fail.Store(true)
+	now = now.Add(31 * time.Second)
+	assert.Equal(t, int64(5), get(StatsFilter{}, false))
+	require.Eventually(t, func() bool { return repo.queries.Load() == 6 }, time.Second, time.Millisecond)
+	assert.Equal(t, int64(5), get(StatsFilter{}, false))
+	assert.Equal(t, 2, c.Len())
+
+	assert.Nil(t, NewStatsCache(repo, config.StatsCacheConfig{}, zap.NewNop()))
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// assembleSSEResponse rebuilds the complete response of a non-streaming
+// request from the SSE stream of a stream-only provider: the reverse of
+// synthesizeSSE. Content blocks are assembled from their deltas and usage
+// follows parseSSEUsage, so the final message_delta output count wins. An error
+// event in the stream is returned as an UpstreamError carrying its payload; a
+// content block started out of index order is an error.
+func (s *ProxyService) assembleSSEResponse(body []byte, statusCode int) (*models.AnthropicResponse, error) {
+	resp := &models.AnthropicResponse{Type: "message", Role: "assistant"}
+	var toolInputs []strings.Builder
+	sawStart := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if _, ok := parseSSEError(line); ok {
+			return nil, newUpstreamError(statusCode, bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data: "))), 0)
+		}
+		s.parseSSEUsage(line, &resp.Usage)
+
+		data, ok := bytes.CutPrefix(line, []byte("data: "))
+		if !ok {
+			continue
+		}
+		var event struct {
+			Type         string                   `json:"type"`
+			Index        int                      `json:"index"`
+			Message      models.AnthropicResponse `json:"message"`
+			ContentBlock models.ContentPart       `json:"content_block"`
+			Delta        struct {
+				Type         string `json:"type"`
+				Text         string `json:"text"`
+				Thinking     string `json:"thinking"`
+				Signature    string `json:"signature"`
+				PartialJSON  string `json:"partial_json"`
+				StopReason   string `json:"stop_reason"`
+				StopSequence string `json:"stop_sequence"`
+			} `json:"delta"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			continue
+		}
+
+		switch event.Type {
+		case "message_start":
+			sawStart = true
+			resp.ID, resp.Model = event.Message.ID, event.Message.Model
+		case "content_block_start":
+			// Blocks start in index order; anything else would leave gaps
+			// (or, for a bogus index, allocate without bound).
+			if event.Index < 0 || event.Index > len(resp.Content) {
+				return nil, fmt.Errorf("content block %d started after %d blocks", event.Index, len(resp.Content))
+			}
+			if event.Index == len(resp.Content) {
+				resp.Content = append(resp.Content, models.ContentPart{})
+				toolInputs = append(toolInputs, strings.Builder{})
+			}
+			resp.Content[event.Index] = event.ContentBlock
+		case "content_block_delta":
+			if event.Index < 0 || event.Index >= len(resp.Content) {
+				continue
+			}
+			part := &resp.Content[event.Index]
+			switch event.Delta.Type {
+			case "text_delta":
+				part.Text += event.Delta.Text
+			case "thinking_delta":
+				part.Thinking += event.Delta.Thinking
+			case "signature_delta":
+				part.Signature += event.Delta.Signature
+			case "input_json_delta":
+				toolInputs[event.Index].WriteString(event.Delta.PartialJSON)
+			}
+		case "message_delta":
+			resp.StopReason, resp.StopSequence = event.Delta.StopReason, event.Delta.StopSequence
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read upstream stream: %w", err)
+	}
+	if !sawStart {
+		return nil, fmt.Errorf("upstream stream has no message_start event")
+	}
+
+	for i := range resp.Content {
+		if resp.Content[i].Type != "tool_use" || toolInputs[i].Len() == 0 {
+			continue
+		}
+		var input any
+		if err := json.Unmarshal([]byte(toolInputs[i].String()), &input); err != nil {
+			return nil, fmt.Errorf("decode tool input of content block %d: %w", i, err)
+		}
+		resp.Content[i].Input = input
+	}
+	if resp.Content == nil {
+		resp.Content = []models.ContentPart{}
+	}
+	return resp, nil
+}
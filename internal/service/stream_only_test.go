@@ -0,0 +1,150 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"go.uber.org/zap"
+)
+
+const streamOnlySSE = `event: message_start
+data: {"type":"message_start","message":{"id":"msg_s","type":"message","role":"assistant","model":"claude-3-sonnet","content":[],"usage":{"input_tokens":12,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello, "}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"world"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: content_block_start
+data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"search","input":{}}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"go\"}"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":1}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"output_tokens":30}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+
+func TestProxyService_ProxyRequest_StreamOnlyProvider(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, true, body["stream"])
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, streamOnlySSE)
+	}))
+	defer upstream.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+
+	ep := createProxyTestEndpoint(upstream.URL)
+	ep.Provider.StreamOnly = true
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep})
+
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: ep, Model: ep.Model, TaskType: ep.Model.Role}
+
+	resp, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep})
+	require.NoError(t, err)
+	assert.Equal(t, "msg_s", resp.ID)
+	assert.Equal(t, "tool_use", resp.StopReason)
+	require.Len(t, resp.Content, 2)
+	assert.Equal(t, "Hello, world", resp.Content[0].Text)
+	assert.Equal(t, "search", resp.Content[1].Name)
+	assert.Equal(t, map[string]any{"q": "go"}, resp.Content[1].Input)
+	assert.Equal(t, 12, resp.Usage.InputTokens)
+	assert.Equal(t, 30, resp.Usage.OutputTokens, "final message_delta usage")
+	assert.Equal(t, 30, meta.OutputTokens)
+	assert.False(t, req.Stream, "client request untouched")
+}
+
+func TestProxyService_ProxyRequest_StreamOnlyErrorFailsOver(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"m\"}}\n\n"+
+			"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"busy\"}}\n\n")
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, strings.ReplaceAll(streamOnlySSE, "msg_s", "msg_ok"))
+	}))
+	defer healthy.Close()
+
+	logger := zap.NewNop()
+	hc := NewHealthChecker(config.HealthCheckConfig{Enabled: true}, logger)
+	ps := NewProxyService(hc, NewLoadBalancerWithStrategy(models.StrategyRoundRobin), nil, logger)
+
+	ep1 := createProxyTestEndpoint(failing.URL)
+	ep1.Provider.StreamOnly = true
+	ep2 := createProxyTestEndpoint(healthy.URL)
+	ep2.Provider = &models.Provider{ID: 2, Name: "healthy-provider", BaseURL: healthy.URL, Enabled: true, StreamOnly: true}
+	registerHealthyEndpoints(hc, []*models.Endpoint{ep1, ep2})
+
+	req := &models.AnthropicRequest{
+		Model:     "claude-3-sonnet",
+		MaxTokens: 100,
+		Messages:  []models.Message{{Role: "user", Content: models.MessageContent{Text: "Hello"}}},
+	}
+	selection := &EndpointSelectionResult{Endpoint: ep1, Model: ep1.Model, TaskType: ep1.Model.Role}
+
+	resp, meta, err := ps.ProxyRequest(context.Background(), req, http.Header{}, selection, []*models.Endpoint{ep1, ep2})
+	require.NoError(t, err)
+	assert.Equal(t, "msg_ok", resp.ID)
+	assert.Equal(t, "healthy-provider", meta.SelectedEndpoint)
+	assert.Equal(t, 1, hc.GetState(EndpointName(ep1)).TotalErrors)
+}
+
+func TestProxyService_AssembleSSEResponse_Thinking(t *testing.T) {
+	ps := NewProxyService(NewHealthChecker(config.HealthCheckConfig{}, zap.NewNop()), nil, nil, zap.NewNop())
+	start := "data: {\"type\":\"message_start\",\"message\":{\"id\":\"m\"}}\n"
+
+	resp, err := ps.assembleSSEResponse([]byte(start+
+		"data: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"thinking\",\"thinking\":\"\"}}\n"+
+		"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"thinking_delta\",\"thinking\":\"hmm\"}}\n"+
+		"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"signature_delta\",\"signature\":\"EqQB\"}}\n"), http.StatusOK)
+	require.NoError(t, err)
+	require.Len(t, resp.Content, 1)
+	assert.Equal(t, "hmm", resp.Content[0].Thinking)
+	assert.Equal(t, "EqQB", resp.Content[0].Signature, "signature is needed to send the block back")
+
+	// A block index skipping ahead is rejected instead of allocating up to it.
+	_, err = ps.assembleSSEResponse([]byte(start+
+		"data: {\"type\":\"content_block_start\",\"index\":1000000000,\"content_block\":{\"type\":\"text\"}}\n"), http.StatusOK)
+	assert.ErrorContains(t, err, "content block 1000000000 started after 0 blocks")
+}
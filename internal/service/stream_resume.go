@@ -0,0 +1,242 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/config"
+)
+
+// StreamEvent is one SSE event forwarded to a client, with its sequence
+// number within the stream.
+type StreamEvent struct {
+	Seq  int64
+	Data []byte
+}
+
+// StreamEventID formats the SSE id of an event: "<request id>:<seq>".
+func StreamEventID(requestID string, seq int64) string {
+	return requestID + ":" + strconv.FormatInt(seq, 10)
+}
+
+// ParseStreamEventID splits a Last-Event-ID value produced by StreamEventID.
+func ParseStreamEventID(id string) (requestID string, seq int64, ok bool) {
+	i := strings.LastIndexByte(id, ':')
+	if i <= 0 {
+		return "", 0, false
+	}
+	seq, err := strconv.ParseInt(id[i+1:], 10, 64)
+	if err != nil || seq < 0 {
+		return "", 0, false
+	}
+	return id[:i], seq, true
+}
+
+// StreamResumeStore keeps the tail of recent streams so a client that lost
+// its connection can reconnect with Last-Event-ID and pick up where it left
+// off. While resumption is enabled a stream keeps reading upstream after the
+// client disconnects; it is cancelled if nobody reconnects within the window.
+type StreamResumeStore struct {
+	capacity int
+	window   time.Duration
+
+	mu      sync.Mutex
+	streams map[string]*ResumableStream
+}
+
+// NewStreamResumeStore creates a StreamResumeStore. It returns nil when
+// resumption is disabled; a nil store opens no streams.
+func NewStreamResumeStore(cfg config.StreamResumeConfig) *StreamResumeStore {
+	if !cfg.Enabled || cfg.BufferEvents <= 0 || cfg.WindowSeconds <= 0 {
+		return nil
+	}
+	return &StreamResumeStore{
+		capacity: cfg.BufferEvents,
+		window:   time.Duration(cfg.WindowSeconds) * time.Second,
+		streams:  make(map[string]*ResumableStream),
+	}
+}
+
+// Open registers a new stream. owner identifies the user allowed to resume
+// it and cancel stops the upstream read once the stream is abandoned.
+func (s *StreamResumeStore) Open(requestID string, owner int64, cancel func()) *ResumableStream {
+	if s == nil {
+		return nil
+	}
+	rs := &ResumableStream{
+		id:     requestID,
+		owner:  owner,
+		store:  s,
+		cancel: cancel,
+		events: make([]StreamEvent, s.capacity),
+		notify: make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.streams[requestID] = rs
+	s.mu.Unlock()
+	return rs
+}
+
+// Lookup returns the buffered stream for requestID, or nil when it is unknown
+// or has expired.
+func (s *StreamResumeStore) Lookup(requestID string) *ResumableStream {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[requestID]
+}
+
+func (s *StreamResumeStore) remove(rs *ResumableStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.streams[rs.id] == rs {
+		delete(s.streams, rs.id)
+	}
+}
+
+// ResumableStream is a bounded ring buffer of the most recent events of one
+// stream. Readers follow it with Since and wait on the returned channel for
+// more events.
+type ResumableStream struct {
+	id     string
+	owner  int64
+	store  *StreamResumeStore
+	cancel func()
+
+	mu      sync.Mutex
+	events  []StreamEvent // Ring buffer; the oldest event is at start
+	start   int
+	count   int
+	nextSeq int64
+	done    bool
+	readers int
+	notify  chan struct{} // Closed and replaced whenever the stream changes
+}
+
+// Owner returns the ID of the user the stream belongs to.
+func (rs *ResumableStream) Owner() int64 {
+	return rs.owner
+}
+
+// Append adds an event, evicting the oldest one when the buffer is full, and
+// returns its sequence number.
+func (rs *ResumableStream) Append(data []byte) int64 {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	seq := rs.nextSeq
+	rs.nextSeq++
+	ev := StreamEvent{Seq: seq, Data: data}
+	if rs.count < len(rs.events) {
+		rs.events[(rs.start+rs.count)%len(rs.events)] = ev
+		rs.count++
+	} else {
+		rs.events[rs.start] = ev
+		rs.start = (rs.start + 1) % len(rs.events)
+	}
+	rs.wake()
+	return seq
+}
+
+// Close marks the stream complete. The buffer stays available for
+// reconnects until the window elapses.
+func (rs *ResumableStream) Close() {
+	rs.mu.Lock()
+	rs.done = true
+	rs.wake()
+	rs.mu.Unlock()
+	time.AfterFunc(rs.store.window, func() { rs.store.remove(rs) })
+}
+
+// Since returns the buffered events after seq (all events when seq is
+// negative), whether the stream is complete, and a channel closed on the next
+// change. ok is false when events after seq were already evicted.
+func (rs *ResumableStream) Since(seq int64) (events []StreamEvent, done bool, changed <-chan struct{}, ok bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	oldest := rs.nextSeq - int64(rs.count)
+	if seq+1 < oldest {
+		return nil, rs.done, rs.notify, false
+	}
+	for i := 0; i < rs.count; i++ {
+		ev := rs.events[(rs.start+i)%len(rs.events)]
+		if ev.Seq > seq {
+			events = append(events, ev)
+		}
+	}
+	return events, rs.done, rs.notify, true
+}
+
+// Attach registers a client reading the stream.
+func (rs *ResumableStream) Attach() {
+	rs.mu.Lock()
+	rs.readers++
+	rs.mu.Unlock()
+}
+
+// Detach unregisters a client. If the stream is still running and no client
+// reattaches within the window, the upstream read is cancelled.
+func (rs *ResumableStream) Detach() {
+	rs.mu.Lock()
+	rs.readers--
+	abandoned := rs.readers == 0 && !rs.done
+	rs.mu.Unlock()
+	if !abandoned {
+		return
+	}
+	time.AfterFunc(rs.store.window, func() {
+		rs.mu.Lock()
+		abandoned := rs.readers == 0 && !rs.done
+		rs.mu.Unlock()
+		if abandoned && rs.cancel != nil {
+			rs.cancel()
+		}
+	})
+}
+
+// wake notifies waiting readers. The caller holds rs.mu.
+func (rs *ResumableStream) wake() {
+	close(rs.notify)
+	rs.notify = make(chan struct{})
+}
+
+// SSEFramer splits a byte stream into complete SSE events (terminated by a
+// blank line) and tags each with an id line.
+type SSEFramer struct {
+	pending []byte
+}
+
+// Write buffers data and returns the events it completes.
+func (f *SSEFramer) Write(data []byte) [][]byte {
+	f.pending = append(f.pending, data...)
+	var events [][]byte
+	for {
+		i := bytes.Index(f.pending, []byte("\n\n"))
+		if i < 0 {
+			return events
+		}
+		events = append(events, bytes.Clone(f.pending[:i+2]))
+		f.pending = f.pending[i+2:]
+	}
+}
+
+// Flush returns any trailing partial event, terminated as a full one.
+func (f *SSEFramer) Flush() []byte {
+	if len(bytes.TrimSpace(f.pending)) == 0 {
+		f.pending = nil
+		return nil
+	}
+	ev := append(bytes.TrimRight(f.pending, "\n"), "\n\n"...)
+	f.pending = nil
+	return ev
+}
+
+// WithEventID prefixes an SSE event with its id field.
+func WithEventID(event []byte, id string) []byte {
+	return append([]byte(fmt.Sprintf("id: %s\n", id)), event...)
+}
@@ -0,0 +1,73 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/user/llm-proxy-go/internal/config"
+)
+
+func TestStreamResumeStore_Disabled(t *testing.T) {
+	assert.Nil(t, NewStreamResumeStore(config.StreamResumeConfig{BufferEvents: 16, WindowSeconds: 30}))
+	var store *StreamResumeStore
+	assert.Nil(t, store.Open("req", 1, nil))
+	assert.Nil(t, store.Lookup("req"))
+}
+
+func TestResumableStream_RingBuffer(t *testing.T) {
+	store := NewStreamResumeStore(config.StreamResumeConfig{Enabled: true, BufferEvents: 3, WindowSeconds: 30})
+	rs := store.Open("req", 1, nil)
+	require.Same(t, rs, store.Lookup("req"))
+
+	for _, data := range []string{"a", "b", "c", "d"} {
+		rs.Append([]byte(data))
+	}
+
+	// Event 0 was evicted; a reader that saw it can still continue.
+	events, done, _, ok := rs.Since(0)
+	require.True(t, ok)
+	assert.False(t, done)
+	require.Len(t, events, 3)
+	assert.Equal(t, int64(1), events[0].Seq)
+	assert.Equal(t, "d", string(events[2].Data))
+
+	// A reader that missed event 0 cannot.
+	_, _, _, ok = rs.Since(-1)
+	assert.False(t, ok)
+
+	_, _, changed, _ := rs.Since(3)
+	rs.Close()
+	<-changed
+	events, done, _, ok = rs.Since(3)
+	assert.True(t, ok)
+	assert.True(t, done)
+	assert.Empty(t, events)
+}
+
+func TestParseStreamEventID(t *testing.T) {
+	id := StreamEventID("3f2a-uuid", 12)
+	requestID, seq, ok := ParseStreamEventID(id)
+	require.True(t, ok)
+	assert.Equal(t, "3f2a-uuid", requestID)
+	assert.Equal(t, int64(12), seq)
+
+	for _, bad := range []string{"", "12", ":3", "req:", "req:x", "req:-1"} {
+		_, _, ok := ParseStreamEventID(bad)
+		assert.False(t, ok, bad)
+	}
+}
+
+func TestSSEFramer(t *testing.T) {
+	var f SSEFramer
+	assert.Empty(t, f.Write([]byte("event: a\n")))
+	events := f.Write([]byte("data: 1\n\nevent: b\ndata: 2\n\ndata: 3\n"))
+	require.Len(t, events, 2)
+	assert.Equal(t, "event: a\ndata: 1\n\n", string(events[0]))
+	assert.Equal(t, "event: b\ndata: 2\n\n", string(events[1]))
+	assert.Equal(t, "data: 3\n\n", string(f.Flush()))
+	assert.Nil(t, f.Flush())
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/user/llm-proxy-go/internal/config"
+	"github.com/user/llm-proxy-go/internal/models"
+	"github.com/user/llm-proxy-go/internal/repository"
+	"go.uber.org/zap"
+)
+
+// minSuccessRateFactor keeps a poorly performing endpoint from being starved
+// entirely, so it can still earn back its share of traffic.
+const minSuccessRateFactor = 0.05
+
+// EndpointStatsSource provides per-endpoint request statistics since a
+// time (zero for all time), keyed by EndpointName.
+type EndpointStatsSource interface {
+	GetEndpointModelStatsSince(ctx context.Context, since time.Time) (map[string]*repository.EndpointModelStats, error)
+}
+
+// SuccessRateTracker scales provider weights by each endpoint's recent
+// success rate. Both rates it uses are recomputed on every refresh: the
+// historical rate from the request log over the configured window, and the
+// live rate as an exponentially weighted moving average of the health
+// checker's request counts since the previous refresh, decaying over the
+// same window. When both have enough samples they are averaged, otherwise
+// whichever has enough is used. Endpoints without enough samples keep their
+// configured weight.
+type SuccessRateTracker struct {
+	source        EndpointStatsSource
+	healthChecker *HealthChecker
+	cfg           config.LoadBalanceConfig
+	logger        *zap.Logger
+	now           func() time.Time
+
+	mu          sync.RWMutex
+	history     map[string]*repository.EndpointModelStats
+	live        map[string]*liveSuccessRate
+	refreshedAt time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// liveSuccessRate is the moving average of an endpoint's live success rate.
+type liveSuccessRate struct {
+	rate    float64
+	samples float64 // Requests behind rate, decayed like it
+	seen    [2]int  // Request and error counts at the last refresh
+}
+
+// NewSuccessRateTracker creates a SuccessRateTracker. It returns nil when
+// success rate weighting is disabled; a nil tracker leaves weights unchanged.
+func NewSuccessRateTracker(source EndpointStatsSource, hc *HealthChecker, cfg config.LoadBalanceConfig, logger *zap.Logger) *SuccessRateTracker {
+	if !cfg.SuccessRateWeighting {
+		return nil
+	}
+	return &SuccessRateTracker{
+		source:        source,
+		healthChecker: hc,
+		cfg:           cfg,
+		logger:        logger,
+		now:           time.Now,
+		live:          make(map[string]*liveSuccessRate),
+	}
+}
+
+// window returns the period success rates are computed over; 0 means all
+// time.
+func (t *SuccessRateTracker) window() time.Duration {
+	return time.Duration(t.cfg.SuccessRateWindowMinutes) * time.Minute
+}
+
+// Refresh reloads the windowed statistics from the request log and folds
+// the live requests since the previous refresh into the moving averages.
+func (t *SuccessRateTracker) Refresh(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	now := t.now()
+	var since time.Time
+	if window := t.window(); window > 0 {
+		since = now.Add(-window)
+	}
+	stats, err := t.source.GetEndpointModelStatsSince(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.history = stats
+	if t.healthChecker != nil {
+		// Weight of the new interval, so that older intervals fade over
+		// the window. Without a window the average never forgets.
+		alpha := 1.0
+		if window := t.window(); window > 0 && !t.refreshedAt.IsZero() {
+			alpha = 1 - math.Exp(-float64(now.Sub(t.refreshedAt))/float64(window))
+		}
+		for name, state := range t.healthChecker.GetAllStates() {
+			t.observeLive(name, state.TotalRequests, state.TotalErrors, alpha)
+		}
+	}
+	t.refreshedAt = now
+	return nil
+}
+
+// observeLive folds an endpoint's live request counts into its moving
+// average. t.mu must be held.
+func (t *SuccessRateTracker) observeLive(name string, requests, errors int, alpha float64) {
+	l := t.live[name]
+	if l == nil {
+		l = &liveSuccessRate{}
+		t.live[name] = l
+	}
+	dRequests, dErrors := requests-l.seen[0], errors-l.seen[1]
+	if dRequests < 0 || dErrors < 0 {
+		// The counters were reset, e.g. the endpoint was removed and added.
+		dRequests, dErrors = requests, errors
+	}
+	l.seen = [2]int{requests, errors}
+
+	decay := 1 - alpha
+	if t.window() <= 0 {
+		decay = 1
+	}
+	l.samples *= decay
+	if dRequests <= 0 {
+		return
+	}
+	rate := float64(dRequests-dErrors) / float64(dRequests)
+	// Blend by sample count so a busy interval outweighs a quiet history.
+	l.rate = (rate*float64(dRequests) + l.rate*l.samples) / (float64(dRequests) + l.samples)
+	l.samples += float64(dRequests)
+}
+
+// Factor returns the multiplier applied to the endpoint's weight, between
+// minSuccessRateFactor and 1.
+func (t *SuccessRateTracker) Factor(ep *models.Endpoint) float64 {
+	if t == nil {
+		return 1
+	}
+	name := EndpointName(ep)
+	var rates []float64
+
+	t.mu.RLock()
+	hist := t.history[name]
+	live := t.live[name]
+	if hist != nil && hist.TotalRequests >= int64(t.cfg.SuccessRateMinRequests) && hist.TotalRequests > 0 {
+		rates = append(rates, float64(hist.TotalRequests-hist.TotalErrors)/float64(hist.TotalRequests))
+	}
+	if live != nil && live.samples >= float64(max(t.cfg.SuccessRateMinRequests, 1)) {
+		rates = append(rates, live.rate)
+	}
+	t.mu.RUnlock()
+	if len(rates) == 0 {
+		return 1
+	}
+
+	var sum float64
+	for _, r := range rates {
+		sum += r
+	}
+	return max(sum/float64(len(rates)), minSuccessRateFactor)
+}
+
+// Start loads the statistics immediately and then refreshes them on the
+// configured interval until Stop.
+func (t *SuccessRateTracker) Start() {
+	if t == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	t.done = make(chan struct{})
+
+	interval := time.Duration(t.cfg.SuccessRateRefreshSeconds) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := t.Refresh(ctx); err != nil && ctx.Err() == nil {
+				t.logger.Warn("failed to refresh endpoint success rates", zap.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop halts periodic refreshes.
+func (t *SuccessRateTracker) Stop() {
+	if t == nil || t.cancel == nil {
+		return
+	}
+	t.cancel()
+	<-t.done
+}
@@ -0,0 +1,28 @@
+package service
+
+import "github.com/user/llm-proxy-go/internal/models"
+
+// thinkingBudget returns the thinking config to send to a model: the
+// requested budget clamped to the model's cap, or the model's default budget
+// when thinking is enabled without one. clampedFrom is the requested budget
+// when it was clamped and 0 otherwise. The request's own config is never
+// modified.
+func thinkingBudget(t *models.ThinkingConfig, m *models.Model) (out *models.ThinkingConfig, clampedFrom int) {
+	if t == nil || t.Type != "enabled" || m == nil {
+		return t, 0
+	}
+	budget := t.BudgetTokens
+	if budget <= 0 {
+		budget = m.DefaultThinkingTokens
+	}
+	if m.MaxThinkingTokens > 0 && budget > m.MaxThinkingTokens {
+		if t.BudgetTokens > 0 {
+			clampedFrom = t.BudgetTokens
+		}
+		budget = m.MaxThinkingTokens
+	}
+	if budget == t.BudgetTokens {
+		return t, 0
+	}
+	return &models.ThinkingConfig{Type: t.Type, BudgetTokens: budget}, clampedFrom
+}
@@ -0,0 +1,40 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+func TestThinkingBudget(t *testing.T) {
+	model := &models.Model{MaxThinkingTokens: 8000, DefaultThinkingTokens: 2000}
+	tests := []struct {
+		name        string
+		thinking    *models.ThinkingConfig
+		model       *models.Model
+		wantBudget  int
+		wantClamped int
+	}{
+		{"under cap", &models.ThinkingConfig{Type: "enabled", BudgetTokens: 4000}, model, 4000, 0},
+		{"over cap", &models.ThinkingConfig{Type: "enabled", BudgetTokens: 20000}, model, 8000, 20000},
+		{"default when omitted", &models.ThinkingConfig{Type: "enabled"}, model, 2000, 0},
+		{"default above cap", &models.ThinkingConfig{Type: "enabled"}, &models.Model{MaxThinkingTokens: 1024, DefaultThinkingTokens: 4096}, 1024, 0},
+		{"no cap configured", &models.ThinkingConfig{Type: "enabled", BudgetTokens: 20000}, &models.Model{}, 20000, 0},
+		{"disabled thinking untouched", &models.ThinkingConfig{Type: "disabled"}, model, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, clampedFrom := thinkingBudget(tt.thinking, tt.model)
+			assert.Equal(t, tt.wantBudget, out.BudgetTokens)
+			assert.Equal(t, tt.wantClamped, clampedFrom)
+		})
+	}
+
+	out, clampedFrom := thinkingBudget(nil, model)
+	assert.Nil(t, out)
+	assert.Zero(t, clampedFrom)
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+// toolNamePattern is the name format the Messages API accepts for custom
+// tools.
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,128}$`)
+
+// ValidateTools checks the tool definitions of a request the way the
+// upstream API would, so malformed ones are rejected locally instead of
+// costing an upstream round trip that ends in a 400. Every tool needs a
+// unique name; custom tools also need a valid name and an input_schema that
+// is a JSON Schema object. Server tools (a type other than "custom") are
+// only checked for a name, their other fields vary by type. The error names
+// the offending tool by its index.
+func ValidateTools(tools []models.Tool) error {
+	seen := make(map[string]int, len(tools))
+	for i, tool := range tools {
+		if tool.Name == "" {
+			return fmt.Errorf("tools[%d]: name is required", i)
+		}
+		if first, ok := seen[tool.Name]; ok {
+			return fmt.Errorf("tools[%d]: duplicate tool name %q (also tools[%d])", i, tool.Name, first)
+		}
+		seen[tool.Name] = i
+		if tool.Type != "" && tool.Type != "custom" {
+			continue
+		}
+		if !toolNamePattern.MatchString(tool.Name) {
+			return fmt.Errorf("tools[%d]: name %q must match %s", i, tool.Name, toolNamePattern)
+		}
+		if tool.InputSchema == nil {
+			return fmt.Errorf("tools[%d]: input_schema is required", i)
+		}
+		schema, ok := tool.InputSchema.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("tools[%d]: input_schema must be an object", i)
+		}
+		if schema["type"] != "object" {
+			return fmt.Errorf(`tools[%d]: input_schema.type must be "object"`, i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+//go:build !integration && !e2e
+// +build !integration,!e2e
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/user/llm-proxy-go/internal/models"
+)
+
+func TestValidateTools(t *testing.T) {
+	schema := map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	tests := []struct {
+		name    string
+		tools   []models.Tool
+		wantErr string
+	}{
+		{name: "no tools"},
+		{name: "valid custom tools", tools: []models.Tool{
+			{Name: "get_weather", InputSchema: schema},
+			{Type: "custom", Name: "run-tests", InputSchema: schema},
+		}},
+		{name: "server tool without schema", tools: []models.Tool{
+			{Type: "web_search_20250305", Name: "web_search"},
+		}},
+		{name: "missing name", tools: []models.Tool{
+			{Name: "ok", InputSchema: schema},
+			{InputSchema: schema},
+		}, wantErr: "tools[1]: name is required"},
+		{name: "invalid name", tools: []models.Tool{
+			{Name: "get weather", InputSchema: schema},
+		}, wantErr: "tools[0]: name \"get weather\" must match"},
+		{name: "duplicate name", tools: []models.Tool{
+			{Name: "a", InputSchema: schema},
+			{Name: "b", InputSchema: schema},
+			{Name: "a", InputSchema: schema},
+		}, wantErr: "tools[2]: duplicate tool name \"a\" (also tools[0])"},
+		{name: "missing schema", tools: []models.Tool{
+			{Name: "a"},
+		}, wantErr: "tools[0]: input_schema is required"},
+		{name: "schema not an object", tools: []models.Tool{
+			{Name: "a", InputSchema: "object"},
+		}, wantErr: "tools[0]: input_schema must be an object"},
+		{name: "schema type not object", tools: []models.Tool{
+			{Name: "a", InputSchema: map[string]interface{}{"type": "string"}},
+		}, wantErr: "tools[0]: input_schema.type must be \"object\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTools(tt.tools)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
@@ -81,8 +81,22 @@ CREATE TABLE IF NOT EXISTS models (
     supports_thinking INTEGER DEFAULT 0,
     enabled INTEGER DEFAULT 1,
     weight INTEGER DEFAULT 100,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    max_thinking_tokens INTEGER DEFAULT 0,
+    default_thinking_tokens INTEGER DEFAULT 0,
+    cache_write_multiplier REAL DEFAULT 1.25,
+    cache_read_multiplier REAL DEFAULT 0.1,
+    timeout_seconds INTEGER DEFAULT 0 NOT NULL
+);
+
+-- Task-type roles
+CREATE TABLE IF NOT EXISTS model_roles (
+    name TEXT PRIMARY KEY,
+    description TEXT DEFAULT '' NOT NULL,
+    builtin INTEGER DEFAULT 0 NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
+INSERT OR IGNORE INTO model_roles (name, builtin) VALUES ('simple', 1), ('default', 1), ('complex', 1);
 
 -- Providers table
 CREATE TABLE IF NOT EXISTS providers (
@@ -92,9 +106,24 @@ CREATE TABLE IF NOT EXISTS providers (
     api_key TEXT NOT NULL,
     weight INTEGER DEFAULT 1,
     max_concurrent INTEGER DEFAULT 10,
+    priority INTEGER DEFAULT 0 NOT NULL,
+    rpm_limit INTEGER DEFAULT 0 NOT NULL,
+    tpm_limit INTEGER DEFAULT 0 NOT NULL,
     enabled INTEGER DEFAULT 1,
     description TEXT,
     custom_headers TEXT DEFAULT '' NOT NULL,
+    retry_rules TEXT DEFAULT '' NOT NULL,
+    health_check_method TEXT DEFAULT 'get' NOT NULL,
+    health_check_path TEXT DEFAULT '' NOT NULL,
+    auth_scheme TEXT DEFAULT 'anthropic' NOT NULL,
+    auth_header TEXT DEFAULT '' NOT NULL,
+    timeout_seconds INTEGER DEFAULT 0 NOT NULL,
+    stream_only INTEGER DEFAULT 0 NOT NULL,
+    anthropic_version TEXT DEFAULT '' NOT NULL,
+    api_path_prefix TEXT DEFAULT '' NOT NULL,
+    cost_multiplier REAL DEFAULT 1.0 NOT NULL,
+    shadow INTEGER DEFAULT 0 NOT NULL,
+    shadow_sample_rate REAL DEFAULT 0 NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -116,6 +145,7 @@ CREATE TABLE IF NOT EXISTS users (
     password_hash TEXT NOT NULL,
     role TEXT NOT NULL DEFAULT 'user',
     is_active INTEGER DEFAULT 1,
+    monthly_budget_usd REAL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -144,6 +174,8 @@ CREATE TABLE IF NOT EXISTS api_keys (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     last_used_at TIMESTAMP,
     expires_at TIMESTAMP,
+    allowed_models TEXT DEFAULT '' NOT NULL,
+    rate_limit_per_min INTEGER DEFAULT 0 NOT NULL,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
@@ -154,6 +186,35 @@ CREATE TABLE IF NOT EXISTS ui_config (
     logs_refresh_seconds INTEGER DEFAULT 15
 );
 
+-- Request log retention configuration (singleton)
+CREATE TABLE IF NOT EXISTS log_retention_config (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    retention_days INTEGER DEFAULT 0
+);
+
+-- anthropic-version header policy (singleton)
+CREATE TABLE IF NOT EXISTS anthropic_version_config (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    pinned_version TEXT DEFAULT '' NOT NULL,
+    default_version TEXT DEFAULT '2023-06-01' NOT NULL,
+    allowed_versions TEXT DEFAULT '[]' NOT NULL
+);
+
+-- Health transition webhook (singleton)
+CREATE TABLE IF NOT EXISTS health_webhook_config (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    url TEXT DEFAULT '' NOT NULL,
+    secret TEXT DEFAULT '' NOT NULL
+);
+
+-- Maintenance mode (singleton)
+CREATE TABLE IF NOT EXISTS maintenance_config (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    enabled INTEGER DEFAULT 0 NOT NULL,
+    message TEXT DEFAULT '' NOT NULL,
+    retry_after_seconds INTEGER DEFAULT 60 NOT NULL
+);
+
 -- LLM routing configuration (singleton)
 CREATE TABLE IF NOT EXISTS routing_llm_config (
     id INTEGER PRIMARY KEY CHECK (id = 1),
@@ -164,6 +225,8 @@ CREATE TABLE IF NOT EXISTS routing_llm_config (
     cache_enabled INTEGER DEFAULT 1,
     cache_ttl_seconds INTEGER DEFAULT 300,
     cache_ttl_l3_seconds INTEGER DEFAULT 604800,
+    cache_max_size INTEGER DEFAULT 10000,
+    max_output_tokens INTEGER DEFAULT 0,
     max_tokens INTEGER DEFAULT 1024,
     temperature REAL DEFAULT 0.0,
     retry_count INTEGER DEFAULT 2,
@@ -176,7 +239,9 @@ CREATE TABLE IF NOT EXISTS routing_llm_config (
     rule_fallback_strategy TEXT DEFAULT 'default',
     rule_fallback_task_type TEXT DEFAULT 'default',
     rule_fallback_model_id INTEGER,
-    log_full_content INTEGER DEFAULT 1
+    log_full_content INTEGER DEFAULT 1,
+    routing_trigger_models TEXT,
+    role_fallback_chain TEXT
 );
 
 -- Routing models table
@@ -253,6 +318,12 @@ CREATE TABLE IF NOT EXISTS request_logs (
     matched_rule_name TEXT DEFAULT '',
     all_matches TEXT DEFAULT '[]',
     is_inaccurate INTEGER DEFAULT 0,
+    retry_chain TEXT DEFAULT '[]',
+    fallback_chain TEXT DEFAULT '[]',
+    end_user_id TEXT DEFAULT '',
+    thinking_clamped_from INTEGER DEFAULT 0,
+    cache_creation_input_tokens INTEGER DEFAULT 0,
+    cache_read_input_tokens INTEGER DEFAULT 0,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
     FOREIGN KEY (api_key_id) REFERENCES api_keys(id) ON DELETE SET NULL
@@ -287,6 +358,27 @@ CREATE TABLE IF NOT EXISTS routing_embedding_cache (
     last_hit_at TIMESTAMP
 );
 
+-- Mirrored requests to shadow providers
+CREATE TABLE IF NOT EXISTS shadow_logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    request_id TEXT NOT NULL,
+    model_name TEXT NOT NULL,
+    primary_endpoint TEXT NOT NULL,
+    shadow_endpoint TEXT NOT NULL,
+    routing_method TEXT DEFAULT 'shadow' NOT NULL,
+    status_code INTEGER DEFAULT 0 NOT NULL,
+    success INTEGER DEFAULT 0 NOT NULL,
+    error_message TEXT DEFAULT '' NOT NULL,
+    latency_ms REAL DEFAULT 0 NOT NULL,
+    primary_latency_ms REAL DEFAULT 0 NOT NULL,
+    input_tokens INTEGER DEFAULT 0 NOT NULL,
+    output_tokens INTEGER DEFAULT 0 NOT NULL,
+    cost REAL DEFAULT 0 NOT NULL,
+    primary_cost REAL DEFAULT 0 NOT NULL,
+    diff_summary TEXT DEFAULT '' NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Routing rules table
 CREATE TABLE IF NOT EXISTS routing_rules (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -300,6 +392,9 @@ CREATE TABLE IF NOT EXISTS routing_rules (
     is_builtin INTEGER DEFAULT 0,
     enabled INTEGER DEFAULT 1,
     hit_count INTEGER DEFAULT 0,
+    rollout_percent INTEGER DEFAULT 100 NOT NULL,
+    observe INTEGER DEFAULT 0 NOT NULL,
+    last_hit_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -312,8 +407,22 @@ CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
 CREATE INDEX IF NOT EXISTS idx_api_keys_key_hash ON api_keys(key_hash);
 CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
 CREATE INDEX IF NOT EXISTS idx_routing_models_provider_id ON routing_models(provider_id);
+CREATE TABLE IF NOT EXISTS user_monthly_spend (
+    user_id INTEGER NOT NULL,
+    period TEXT NOT NULL,
+    cost REAL DEFAULT 0 NOT NULL,
+    PRIMARY KEY (user_id, period)
+);
+CREATE TABLE IF NOT EXISTS user_rate_limit_rejections (
+    user_id INTEGER NOT NULL,
+    hour TEXT NOT NULL,
+    count INTEGER DEFAULT 0 NOT NULL,
+    PRIMARY KEY (user_id, hour)
+);
+
 CREATE INDEX IF NOT EXISTS idx_request_logs_user_id ON request_logs(user_id);
 CREATE INDEX IF NOT EXISTS idx_request_logs_created_at ON request_logs(created_at);
+CREATE INDEX IF NOT EXISTS idx_request_logs_end_user_id ON request_logs(end_user_id);
 `
 	_, err := db.Exec(schema)
 	return err
@@ -327,6 +436,10 @@ INSERT OR IGNORE INTO health_check_config (id, enabled, interval_seconds, timeou
 INSERT OR IGNORE INTO load_balance_config (id, strategy) VALUES (1, 'conversation_hash');
 INSERT OR IGNORE INTO routing_config (id, default_role) VALUES (1, 'default');
 INSERT OR IGNORE INTO ui_config (id, dashboard_refresh_seconds, logs_refresh_seconds) VALUES (1, 30, 15);
+INSERT OR IGNORE INTO log_retention_config (id, retention_days) VALUES (1, 0);
+INSERT OR IGNORE INTO anthropic_version_config (id) VALUES (1);
+INSERT OR IGNORE INTO health_webhook_config (id) VALUES (1);
+INSERT OR IGNORE INTO maintenance_config (id) VALUES (1);
 INSERT OR IGNORE INTO routing_llm_config (id, enabled) VALUES (1, 0);
 `
 	_, err := db.Exec(defaults)